@@ -0,0 +1,97 @@
+package annotate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Kind 表示标注的类型
+type Kind string
+
+const (
+	// Arrow 从起点指向终点的箭头
+	Arrow Kind = "arrow"
+	// Box 以起点和终点为对角的方框
+	Box Kind = "box"
+	// Note 位于起点的文字说明
+	Note Kind = "note"
+)
+
+// Annotation 是一条标注，坐标均为渲染图像的像素坐标，与窗口缩放无关
+type Annotation struct {
+	Kind Kind    `json:"kind"`
+	X1   float32 `json:"x1"`
+	Y1   float32 `json:"y1"`
+	X2   float32 `json:"x2,omitempty"`
+	Y2   float32 `json:"y2,omitempty"`
+	Text string  `json:"text,omitempty"`
+}
+
+// Set 是一个图表文件的全部标注
+type Set struct {
+	Items []Annotation `json:"items"`
+}
+
+// SidecarPath 返回图表文件对应的标注文件路径，标注单独保存，不修改图表源文件
+func SidecarPath(diagramPath string) string {
+	return diagramPath + ".annotations.json"
+}
+
+// Load 读取图表文件的标注，标注文件不存在时返回空集合
+func Load(diagramPath string) (*Set, error) {
+	set := &Set{}
+
+	data, err := ioutil.ReadFile(SidecarPath(diagramPath))
+	if os.IsNotExist(err) {
+		return set, nil
+	}
+	if err != nil {
+		return set, fmt.Errorf("无法读取标注文件: %v", err)
+	}
+
+	if err := json.Unmarshal(data, set); err != nil {
+		return &Set{}, fmt.Errorf("标注文件格式错误: %v", err)
+	}
+	return set, nil
+}
+
+// Save 保存图表文件的标注，没有标注时删除标注文件
+func (s *Set) Save(diagramPath string) error {
+	path := SidecarPath(diagramPath)
+	if len(s.Items) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("无法删除标注文件: %v", err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法序列化标注: %v", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("无法写入标注文件: %v", err)
+	}
+	return nil
+}
+
+// Add 添加一条标注
+func (s *Set) Add(a Annotation) {
+	s.Items = append(s.Items, a)
+}
+
+// Undo 删除最后一条标注，没有标注时返回false
+func (s *Set) Undo() bool {
+	if len(s.Items) == 0 {
+		return false
+	}
+	s.Items = s.Items[:len(s.Items)-1]
+	return true
+}
+
+// Clear 删除全部标注
+func (s *Set) Clear() {
+	s.Items = nil
+}
@@ -0,0 +1,116 @@
+package annotate
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// 标注使用的颜色和线宽，与界面上的标注层保持一致
+var (
+	// StrokeColor 箭头和方框的颜色
+	StrokeColor = color.NRGBA{R: 220, G: 38, B: 38, A: 255}
+	// NoteBackground 文字说明的背景颜色
+	NoteBackground = color.NRGBA{R: 255, G: 241, B: 118, A: 235}
+	// NoteTextColor 文字说明的文字颜色
+	NoteTextColor = color.NRGBA{A: 255}
+)
+
+const (
+	// StrokeWidth 线宽（像素）
+	StrokeWidth = 3
+	// ArrowHeadLength 箭头头部长度（像素）
+	ArrowHeadLength = 14
+	// notePadding 文字说明的内边距（像素）
+	notePadding = 4
+)
+
+// FlattenPNG 将标注绘制到PNG图像上，输出合成后的PNG，原始图像不受影响
+func FlattenPNG(pngData []byte, set *Set, w io.Writer) error {
+	src, err := png.Decode(bytes.NewReader(pngData))
+	if err != nil {
+		return fmt.Errorf("无法解析渲染图像: %v", err)
+	}
+
+	if err := png.Encode(w, Flatten(src, set)); err != nil {
+		return fmt.Errorf("无法写入合成图像: %v", err)
+	}
+	return nil
+}
+
+// Flatten 返回绘制了全部标注的新图像
+func Flatten(src image.Image, set *Set) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	for _, a := range set.Items {
+		switch a.Kind {
+		case Arrow:
+			drawArrow(dst, a.X1, a.Y1, a.X2, a.Y2)
+		case Box:
+			drawLine(dst, a.X1, a.Y1, a.X2, a.Y1)
+			drawLine(dst, a.X2, a.Y1, a.X2, a.Y2)
+			drawLine(dst, a.X2, a.Y2, a.X1, a.Y2)
+			drawLine(dst, a.X1, a.Y2, a.X1, a.Y1)
+		case Note:
+			drawNote(dst, a.X1, a.Y1, a.Text)
+		}
+	}
+	return dst
+}
+
+// drawArrow 绘制带箭头的线段
+func drawArrow(dst *image.RGBA, x1, y1, x2, y2 float32) {
+	drawLine(dst, x1, y1, x2, y2)
+
+	angle := math.Atan2(float64(y2-y1), float64(x2-x1))
+	for _, side := range []float64{-1, 1} {
+		a := angle + math.Pi - side*math.Pi/7
+		hx := x2 + float32(ArrowHeadLength*math.Cos(a))
+		hy := y2 + float32(ArrowHeadLength*math.Sin(a))
+		drawLine(dst, x2, y2, hx, hy)
+	}
+}
+
+// drawLine 沿线段逐点绘制方形笔触，得到指定线宽的线条
+func drawLine(dst *image.RGBA, x1, y1, x2, y2 float32) {
+	steps := int(math.Max(math.Abs(float64(x2-x1)), math.Abs(float64(y2-y1))))
+	if steps == 0 {
+		steps = 1
+	}
+	half := StrokeWidth / 2
+	for i := 0; i <= steps; i++ {
+		t := float32(i) / float32(steps)
+		x := int(x1 + (x2-x1)*t)
+		y := int(y1 + (y2-y1)*t)
+		rect := image.Rect(x-half, y-half, x-half+StrokeWidth, y-half+StrokeWidth)
+		draw.Draw(dst, rect, image.NewUniform(StrokeColor), image.Point{}, draw.Over)
+	}
+}
+
+// drawNote 在指定位置绘制带背景的文字说明
+func drawNote(dst *image.RGBA, x, y float32, text string) {
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, text).Ceil()
+	height := face.Metrics().Height.Ceil()
+
+	box := image.Rect(int(x), int(y), int(x)+width+2*notePadding, int(y)+height+2*notePadding)
+	draw.Draw(dst, box, image.NewUniform(NoteBackground), image.Point{}, draw.Over)
+
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(NoteTextColor),
+		Face: face,
+		Dot:  fixed.P(box.Min.X+notePadding, box.Min.Y+notePadding+face.Metrics().Ascent.Ceil()),
+	}
+	d.DrawString(text)
+}
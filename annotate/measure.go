@@ -0,0 +1,44 @@
+package annotate
+
+import (
+	"fmt"
+	"math"
+)
+
+// mmPerInch 每英寸的毫米数
+const mmPerInch = 25.4
+
+// DefaultDPI PlantUML输出PNG的默认分辨率
+const DefaultDPI = 96
+
+// Measurement 是两点之间的测量结果，单位为图像像素
+type Measurement struct {
+	Width    float64 // 外接矩形宽度
+	Height   float64 // 外接矩形高度
+	Distance float64 // 两点直线距离
+}
+
+// Measure 计算图像像素坐标中两点之间的距离和外接矩形
+func Measure(x1, y1, x2, y2 float32) Measurement {
+	w := math.Abs(float64(x2 - x1))
+	h := math.Abs(float64(y2 - y1))
+	return Measurement{Width: w, Height: h, Distance: math.Hypot(w, h)}
+}
+
+// PixelsToMM 按指定DPI将像素换算为毫米
+func PixelsToMM(px, dpi float64) float64 {
+	if dpi <= 0 {
+		dpi = DefaultDPI
+	}
+	return px / dpi * mmPerInch
+}
+
+// Format 返回测量结果的文字描述，同时给出像素和指定DPI下的毫米值
+func (m Measurement) Format(dpi float64) string {
+	if dpi <= 0 {
+		dpi = DefaultDPI
+	}
+	return fmt.Sprintf("%.0f × %.0f px，距离 %.0f px（%.1f × %.1f mm，距离 %.1f mm @ %.0f DPI）",
+		m.Width, m.Height, m.Distance,
+		PixelsToMM(m.Width, dpi), PixelsToMM(m.Height, dpi), PixelsToMM(m.Distance, dpi), dpi)
+}
@@ -0,0 +1,107 @@
+package c4
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Level 是C4模型的缩放层级，从系统上下文逐级深入到组件
+type Level int
+
+const (
+	// Context 系统上下文图（C4_Context.puml）
+	Context Level = iota + 1
+	// Container 容器图（C4_Container.puml）
+	Container
+	// Component 组件图（C4_Component.puml）
+	Component
+)
+
+// Levels 按从外到内的顺序列出所有层级
+var Levels = []Level{Context, Container, Component}
+
+// String 返回层级在C4-PlantUML中的名称，也是配套文件名中使用的后缀
+func (l Level) String() string {
+	switch l {
+	case Context:
+		return "Context"
+	case Container:
+		return "Container"
+	case Component:
+		return "Component"
+	}
+	return ""
+}
+
+// Label 返回层级在界面上显示的名称
+func (l Level) Label() string {
+	switch l {
+	case Context:
+		return "系统上下文"
+	case Container:
+		return "容器"
+	case Component:
+		return "组件"
+	}
+	return ""
+}
+
+// includePattern 匹配引入C4-PlantUML层级库的!include行，例如
+// !include <C4/C4_Container> 或 !include https://.../C4_Component.puml
+var includePattern = regexp.MustCompile(`(?m)^\s*!include(?:url)?\s+\S*C4_(Context|Container|Component)\b`)
+
+// Detect 根据引入的C4-PlantUML库判断图表的层级，引入了多个层级的库时取最深的一个。不是C4图表时返回false
+func Detect(source string) (Level, bool) {
+	var level Level
+	for _, match := range includePattern.FindAllStringSubmatch(source, -1) {
+		for _, l := range Levels {
+			if match[1] == l.String() && l > level {
+				level = l
+			}
+		}
+	}
+	return level, level != 0
+}
+
+// DetectFile 读取文件并判断其层级，无法读取或不是C4图表时返回false
+func DetectFile(path string) (Level, bool) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	return Detect(string(data))
+}
+
+// suffixPattern 匹配文件名（不含扩展名）末尾的层级后缀，例如 billing-context、billing_Container、billing.component
+var suffixPattern = regexp.MustCompile(`(?i)^(.+)([-_.])(context|container|component)$`)
+
+// Companions 按命名约定查找同一系统在各层级的配套文件：同一目录中、扩展名相同，
+// 只有层级后缀不同的文件（例如 billing-context.puml、billing-container.puml、billing-component.puml），
+// 后缀不区分大小写。返回的结果包含path本身，文件名没有层级后缀时返回nil
+func Companions(path string) map[Level]string {
+	ext := filepath.Ext(path)
+	match := suffixPattern.FindStringSubmatch(strings.TrimSuffix(filepath.Base(path), ext))
+	if match == nil {
+		return nil
+	}
+	stem, sep := match[1], match[2]
+
+	dir := filepath.Dir(path)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	companions := make(map[Level]string)
+	for _, l := range Levels {
+		want := stem + sep + l.String() + ext
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.EqualFold(entry.Name(), want) {
+				companions[l] = filepath.Join(dir, entry.Name())
+				break
+			}
+		}
+	}
+	return companions
+}
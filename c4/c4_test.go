@@ -0,0 +1,53 @@
+package c4
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	cases := []struct {
+		source string
+		level  Level
+		ok     bool
+	}{
+		{"@startuml\n!include <C4/C4_Context>\nPerson(user, \"User\")\n@enduml", Context, true},
+		{"@startuml\n!include https://raw.githubusercontent.com/plantuml-stdlib/C4-PlantUML/master/C4_Container.puml\n@enduml", Container, true},
+		{"@startuml\n  !includeurl C4_Component.puml\n@enduml", Component, true},
+		// 引入多个层级的库时取最深的一个
+		{"!include <C4/C4_Context>\n!include <C4/C4_Component>\n", Component, true},
+		{"@startuml\nAlice -> Bob\n' !include <C4/C4_Context>\n@enduml", 0, false},
+		{"@startuml\n!include <C4/C4_Deployment>\n@enduml", 0, false},
+	}
+	for _, c := range cases {
+		level, ok := Detect(c.source)
+		if level != c.level || ok != c.ok {
+			t.Errorf("Detect(%q) = %v, %v，应为 %v, %v", c.source, level, ok, c.level, c.ok)
+		}
+	}
+}
+
+func TestCompanions(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"billing-context.puml", "billing-Container.puml", "billing_component.puml", "billing-component.pu", "other-component.puml"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[Level]string{
+		Context:   filepath.Join(dir, "billing-context.puml"),
+		Container: filepath.Join(dir, "billing-Container.puml"),
+	}
+	for _, path := range want {
+		if got := Companions(path); !reflect.DeepEqual(got, want) {
+			t.Errorf("Companions(%s) = %v，应为 %v", path, got, want)
+		}
+	}
+
+	if got := Companions(filepath.Join(dir, "billing.puml")); got != nil {
+		t.Errorf("没有层级后缀时应返回nil，得到 %v", got)
+	}
+}
@@ -0,0 +1,820 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	fyneapp "fyne.io/fyne/v2/app"
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/export"
+	"plantumlmacviewer/internal/app"
+	"plantumlmacviewer/internal/charset"
+	"plantumlmacviewer/internal/companion"
+	"plantumlmacviewer/internal/doctor"
+	"plantumlmacviewer/internal/instance"
+	"plantumlmacviewer/internal/ipc"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/internal/selftest"
+	"plantumlmacviewer/internal/session"
+	"plantumlmacviewer/plantuml"
+)
+
+var (
+	version = "0.1.0"
+)
+
+// 单实例锁文件路径
+const lockFile = "/tmp/plantumlviewer.lock"
+
+// 会话文件，记录当前实例启动的渲染进程，程序崩溃后下次启动时据此清理
+const sessionFile = "/tmp/plantumlviewer.session"
+
+// IPC服务器地址
+const ipcAddr = "/tmp/plantumlviewer.sock"
+
+// 编辑器扩展接口的默认地址
+const companionAddr = "/tmp/plantumlviewer-companion.sock"
+
+// 守护模式的锁文件、会话文件和IPC地址，与窗口实例分开，两者可以同时运行
+const (
+	daemonLockFile    = "/tmp/plantumlviewer-daemon.lock"
+	daemonSessionFile = "/tmp/plantumlviewer-daemon.session"
+	daemonAddr        = "/tmp/plantumlviewer-daemon.sock"
+)
+
+// 日志文件，setupLogger创建失败时为nil
+var logFileWriter io.Writer
+
+func main() {
+	// 设置日志输出到文件
+	setupLogger()
+
+	// 子命令，不启动界面。doctor在读取管理员设置之前运行，管理员设置无效时也能检查出来
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		logToFileOnly()
+		os.Exit(runDoctor())
+	}
+
+	// 管理员下发的系统级设置对其他所有模式都有效，用户设置和项目配置都不能覆盖
+	managed := loadManaged()
+
+	if len(os.Args) > 1 && os.Args[1] == "convert" {
+		logToFileOnly()
+		os.Exit(runConvert(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		logToFileOnly()
+		os.Exit(runDiff(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "evolution" {
+		logToFileOnly()
+		os.Exit(runEvolution(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		logToFileOnly()
+		os.Exit(runCheck(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		logToFileOnly()
+		os.Exit(runFmt(os.Args[2:]))
+	}
+
+	// 解析命令行参数
+	showVersion := flag.Bool("version", false, "显示版本信息")
+	showHelp := flag.Bool("help", false, "显示帮助信息")
+	refreshOnFocus := flag.Bool("refresh-on-focus", false, "窗口获得焦点时检查并刷新已变化的文件")
+	noWatch := flag.Bool("no-watch", false, "不在后台持续监控文件变化")
+	renderTimeout := flag.Float64("render-timeout", 0, "查看时一次渲染最长的时间（秒），超过后结束PlantUML进程并显示超时错误，0表示使用设置中的renderTimeout")
+	exportFormat := flag.String("export", "", "不打开窗口，直接将文件导出为指定格式（png、pdf或svg，auto表示按项目的渲染配置选择），结果以JSON输出")
+	exportOut := flag.String("out", "", "导出文件的目录，默认与源文件相同")
+	exportScale := flag.Float64("scale", 1, "导出比例，例如2表示以2倍分辨率重新渲染")
+	gallery := flag.String("gallery", "", "不打开窗口，将文件和目录中的所有图表导出为HTML图库到指定目录，结果以JSON输出")
+	galleryTitle := flag.String("gallery-title", "PlantUML图表", "HTML图库首页的标题")
+	embedSource := flag.Bool("embed-source", false, "导出SVG时嵌入PlantUML源码，之后用查看器打开该SVG可以导入源码")
+	redact := flag.Bool("redact", false, "-export 时按项目配置中的redaction规则替换主机名、IP等内容后再渲染，导出文件名加上 -redacted")
+	upload := flag.Bool("publish", false, "-export 后把导出的文件上传到项目配置中publish设置的Confluence页面或webhook")
+	pauseWatching := flag.Bool("pause-watching", false, "让运行中的实例暂停监控文件变化")
+	resumeWatching := flag.Bool("resume-watching", false, "让运行中的实例恢复监控文件变化，并重新渲染暂停期间有变化的文件")
+	follow := flag.String("follow", "", "始终显示匹配该模式（例如 'build/diagrams/latest-*.puml'）的最新文件，用于不断生成带时间戳新文件的流程")
+	closeAll := flag.Bool("close-all", false, "让运行中的实例关闭所有标签页")
+	closeOthers := flag.Bool("close-others", false, "让运行中的实例关闭当前标签以外的所有标签页")
+	page := flag.Int("page", 0, "发送给运行中的实例时，显示多页图表的第几页（从1开始）")
+	noFocus := flag.Bool("no-focus", false, "发送给运行中的实例时不激活窗口，例如编辑器保存后在后台刷新图表")
+	noSelect := flag.Bool("no-select", false, "发送给运行中的实例时不切换到文件的标签")
+	background := flag.Bool("background", false, "发送给运行中的实例时在后台标签中打开，相当于同时使用 -no-focus 和 -no-select")
+	stdinName := flag.String("stdin-name", "", "从标准输入读取源码并以该文件名预览，编辑器可以不保存就预览缓冲区")
+	elementAt := flag.Int("element-at", 0, "不打开窗口，以JSON输出源码中该行（从1开始）对应的元素，供编辑器插件映射光标所在行")
+	companionListen := flag.String("companion", companionAddr, "编辑器扩展接口的地址：UNIX套接字路径或本机TCP地址（例如 127.0.0.1:17395），为空时不启动")
+	httpListen := flag.String("http", "", "以HTTP提供编辑器扩展接口的本机地址（例如 127.0.0.1:17396），请求需要配置目录中http.token的令牌，为空时不启动")
+	daemon := flag.Bool("daemon", false, "不打开窗口，持续监控配置文件daemon中的目录（或命令行中的目录，导出到 -out），图表变化后自动导出")
+	daemonFormat := flag.String("daemon-format", "png", "守护模式下命令行中的目录的导出格式（png、pdf或svg，auto表示按渲染配置）")
+	daemonTUI := flag.Bool("tui", false, "守护模式下在终端中显示各文件的导出状态，可以输入命令重新导出或在查看器窗口中打开文件")
+	metricsListen := flag.String("metrics", "", "守护模式下以OpenMetrics格式提供指标的TCP地址（例如 :9464），Prometheus从 /metrics 抓取，为空时不启动")
+	selfTest := flag.Bool("selftest", false, "渲染内置的样例图表并与本机PlantUML版本的基准数据比较")
+	debugLog := flag.Bool("debug", false, "在日志中记录完整的文件路径、按键和IPC请求内容，用于排查问题")
+	rendererName := flag.String("renderer", "", "查看时使用的渲染器（auto、jar、command、pipe或kroki），覆盖配置文件中的renderer")
+	charsetName := flag.String("charset", "", "源文件的字符编码（UTF-8、GBK、Shift_JIS或ISO-8859-1，auto表示自动识别），覆盖配置文件中的charset")
+	reportFormat := flag.String("report-format", app.ReportJSON, "不打开窗口导出时结果的输出格式（json；github输出GitHub Actions的错误注释；junit输出JUnit XML）")
+	flag.Parse()
+	if err := app.SetReportFormat(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(2)
+	}
+
+	// 读取用户设置，命令行参数只对本次运行生效
+	settings, err := config.Load()
+	if err != nil {
+		log.Printf("警告：%v，使用默认设置", err)
+	}
+	if *refreshOnFocus {
+		settings.RefreshOnFocus = true
+	}
+	if *noWatch {
+		settings.WatchFiles = false
+	}
+	logging.SetDebug(settings.DebugLog || *debugLog)
+	if *rendererName != "" && !config.IsRenderer(*rendererName) {
+		fmt.Fprintf(os.Stderr, "错误: 未知的渲染器 %s（可选: %s）\n", *rendererName, strings.Join(config.Renderers, "、"))
+		os.Exit(2)
+	}
+	// 不修改settings，避免保存设置时把命令行参数写入配置文件
+	if *charsetName == "" {
+		*charsetName = settings.Charset
+	}
+	defaultCharset, err := charset.Normalize(*charsetName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	plantuml.SetDefaultCharset(defaultCharset)
+	if *renderTimeout < 0 {
+		fmt.Fprintf(os.Stderr, "错误: 渲染超时不能小于0: %g\n", *renderTimeout)
+		os.Exit(2)
+	}
+	timeout := settings.RenderTimeoutDuration()
+	if *renderTimeout > 0 {
+		timeout = time.Duration(*renderTimeout * float64(time.Second))
+	}
+	plantuml.SetRenderTimeout(timeout)
+	plantuml.SetMaxRenders(settings.MaxRenders)
+
+	// 如果请求显示版本信息
+	if *showVersion {
+		fmt.Printf("PlantUML Viewer v%s\n", version)
+		os.Exit(0)
+	}
+
+	// 如果请求显示帮助信息
+	if *showHelp {
+		fmt.Printf("PlantUML Viewer v%s\n\n", version)
+		fmt.Println("用法: plantumlviewer [选项] [文件...]")
+		fmt.Println("      plantumlviewer convert 源目录 -out 输出目录 [-format svg] [-jobs 4]")
+		fmt.Println("      plantumlviewer diff 文件 -from origin/main [-to HEAD] -out diff.html")
+		fmt.Println("      plantumlviewer evolution 文件 [-from v1.0] [-to HEAD] -out evolution.gif")
+		fmt.Println("      plantumlviewer check [文件或目录...] [-ignore 模式] [-include 目录]    只检查语法，不生成图像")
+		fmt.Println("      plantumlviewer fmt [文件或目录...] [-check] [-ignore 模式]    整理源码格式，-check只检查不改写")
+		fmt.Println("      plantumlviewer doctor    检查Java、PlantUML、Graphviz和配置等运行环境")
+		fmt.Println("\n选项:")
+		flag.PrintDefaults()
+		fmt.Println("\n支持的文件类型: .puml, .plantuml, .pu")
+		fmt.Println("\n快捷键:")
+		fmt.Println("  Tab 或 PageDown: 下一个标签页")
+		fmt.Println("  PageUp: 上一个标签页")
+		fmt.Println("  Alt+←/→: 上一个/下一个标签页 (某些系统上)")
+		fmt.Println("  Cmd+Shift+L: 锁定/解锁各标签的缩放与滚动位置")
+		fmt.Println("  Cmd+Shift+P: 暂停/恢复监控文件变化")
+		fmt.Println("  Cmd+Shift+T: 重新打开关闭的标签")
+		fmt.Println("  Cmd+R: 立即刷新当前标签")
+		fmt.Println("  Cmd+N / Cmd+S / Cmd+Shift+S: 新建草稿 / 保存草稿 / 草稿另存为")
+		fmt.Println("  触控板双指左右轻扫: 下一个/上一个标签页（方向与Safari一致，已按系统滚动方向设置校正）")
+		os.Exit(0)
+	}
+
+	// 自检模式，检查本机PlantUML的渲染结果是否与基准一致
+	if *selfTest {
+		logToFileOnly()
+		pumlVersion, err := plantuml.Version()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(selftest.Run(os.Stdout, selftest.RenderPNG, pumlVersion))
+	}
+
+	// 按设置注入图表字体，查看和导出都会使用；自检按PlantUML的默认设置渲染，与基准数据比较
+	if err := plantuml.ValidateJavaEncoding(settings.JavaEncoding); err != nil {
+		log.Printf("警告：%v，使用Java的默认编码", err)
+		settings.JavaEncoding = ""
+	}
+	plantuml.SetFont(settings.FontName, settings.JavaEncoding)
+
+	// 设置中的水印在所有导出中使用，项目配置中的watermark优先
+	if settings.Watermark != nil {
+		if err := settings.Watermark.Validate(); err != nil {
+			log.Printf("警告：%v，导出时不加水印", err)
+		} else {
+			export.SetWatermark(settings.Watermark)
+		}
+	}
+
+	// 渲染配置的postProcess按名称引用设置中的后处理命令
+	if err := config.ValidatePostProcessors(settings.PostProcessors); err != nil {
+		log.Printf("警告：%v，导出时不做后处理", err)
+	} else {
+		export.SetPostProcessors(export.CommandProcessors(settings.PostProcessors))
+	}
+
+	// 让运行中的实例执行命令，例如在git操作或代码生成前后暂停和恢复文件监控
+	var command string
+	switch {
+	case *pauseWatching:
+		command = ipc.CommandPauseWatching
+	case *resumeWatching:
+		command = ipc.CommandResumeWatching
+	case *closeAll:
+		command = ipc.CommandCloseAll
+	case *closeOthers:
+		command = ipc.CommandCloseOthers
+	}
+	if command != "" {
+		logToFileOnly()
+		// 暂停和恢复监控对窗口实例和守护模式都有效，关闭标签只对窗口实例有效
+		var addrs []string
+		if instance.IsRunning(lockFile) {
+			addrs = append(addrs, ipcAddr)
+		}
+		if instance.IsRunning(daemonLockFile) && (command == ipc.CommandPauseWatching || command == ipc.CommandResumeWatching) {
+			addrs = append(addrs, daemonAddr)
+		}
+		if len(addrs) == 0 {
+			fmt.Fprintln(os.Stderr, "PlantUML Viewer 没有在运行")
+			os.Exit(1)
+		}
+		code := 0
+		for _, addr := range addrs {
+			if c := app.SendCommand(addr, command, os.Stderr); c != 0 {
+				code = c
+			}
+		}
+		os.Exit(code)
+	}
+
+	// 获取传入的文件路径参数
+	files := flag.Args()
+
+	// 查询光标所在行对应的元素，源码来自标准输入（使用 -stdin-name 时）或第一个文件
+	if *elementAt > 0 {
+		logToFileOnly()
+		var source []byte
+		if *stdinName != "" {
+			source, err = ioutil.ReadAll(os.Stdin)
+		} else if len(files) > 0 {
+			source, err = ioutil.ReadFile(files[0])
+		} else {
+			err = fmt.Errorf("需要指定文件或使用 -stdin-name")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "无法读取源码: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(app.ReportElementAt(string(source), *elementAt, os.Stdout, os.Stderr))
+	}
+
+	// 预览编辑器中未保存的缓冲区：标准输入的内容作为虚拟文件打开，不写入任何文件
+	var stdinFile *ipc.VirtualFile
+	if *stdinName != "" {
+		text, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "无法读取标准输入: %v\n", err)
+			os.Exit(1)
+		}
+		name := *stdinName
+		if absName, err := filepath.Abs(name); err == nil {
+			name = absName
+		}
+		stdinFile = &ipc.VirtualFile{Name: name, Text: string(text), Options: ipc.OpenOptions{Page: *page}}
+	}
+
+	// 命令行导出模式，不启动界面
+	if *exportFormat != "" {
+		logToFileOnly()
+		os.Exit(app.ExportFiles(files, *exportFormat, *exportOut, *exportScale, *embedSource, *redact, *upload, os.Stdout, os.Stderr))
+	}
+	if *gallery != "" {
+		logToFileOnly()
+		os.Exit(app.ExportGallery(files, *gallery, *galleryTitle, *exportScale, os.Stdout, os.Stderr))
+	}
+
+	// 守护模式，不启动界面，代替窗口实例接收IPC命令
+	if *daemon {
+		targets := settings.Daemon
+		if len(files) > 0 {
+			targets = nil
+			for _, dir := range files {
+				targets = append(targets, config.DaemonTarget{Source: dir, Out: *exportOut, Format: *daemonFormat, Scale: *exportScale})
+			}
+		}
+		if managed.DisableNetwork && *metricsListen != "" {
+			log.Printf("管理员禁止访问网络，不在 %s 上启动指标接口", *metricsListen)
+			*metricsListen = ""
+		}
+		os.Exit(runDaemon(targets, *daemonTUI, *metricsListen))
+	}
+
+	// 服务器上的文件（user@host:/path）先通过ssh复制到本机，以只读的副本打开
+	files = app.FetchRemote(files)
+
+	// 验证文件路径有效性
+	validFiles := app.ValidateFiles(files)
+	if len(files) > 0 && len(validFiles) == 0 {
+		log.Println("警告：没有找到有效的PlantUML文件")
+	}
+
+	// 只有守护模式在运行时，命令行发来的文件交给守护模式重新导出；
+	// 需要同时打开窗口时，先不带文件启动查看器
+	addr := ipcAddr
+	if !instance.IsRunning(lockFile) && len(files) > 0 && stdinFile == nil && instance.IsRunning(daemonLockFile) {
+		addr = daemonAddr
+	}
+
+	// 检查应用程序是否已在运行
+	if addr == daemonAddr || instance.IsRunning(lockFile) {
+		if *follow != "" {
+			fmt.Fprintln(os.Stderr, "-follow 只能在启动新实例时使用")
+			os.Exit(1)
+		}
+		// 如果应用程序已在运行，发送文件列表给现有实例
+		log.Println("检测到PlantUML Viewer已经在运行，将发送文件列表到现有实例")
+		logToFileOnly()
+		opts := ipc.OpenOptions{Page: *page, NoFocus: *noFocus || *background, NoSelect: *noSelect || *background}
+		code := 0
+		if stdinFile != nil {
+			stdinFile.Options = opts
+			code = app.SendVirtual(addr, *stdinFile, os.Stdout, os.Stderr)
+		}
+		if c := app.SendFiles(addr, files, opts, os.Stdout, os.Stderr); code == 0 {
+			code = c
+		}
+		// 稍等片刻，确保文件被打开
+		time.Sleep(500 * time.Millisecond)
+		os.Exit(code)
+	}
+
+	if managed.DisableNetwork && companion.IsTCPAddr(*companionListen) {
+		log.Printf("管理员禁止访问网络，不在TCP地址 %s 上启动编辑器接口", *companionListen)
+		*companionListen = ""
+	}
+	if managed.DisableNetwork && *httpListen != "" {
+		log.Printf("管理员禁止访问网络，不在 %s 上启动HTTP接口", *httpListen)
+		*httpListen = ""
+	}
+
+	// 如果应用程序未在运行，清理上一次崩溃遗留的资源，然后创建锁文件
+	sess := startSession(sessionFile, ipcAddr, *companionListen)
+	defer sess.End()
+	lock, err := instance.Acquire(lockFile)
+	if err != nil {
+		log.Printf("警告：%v", err)
+	}
+	defer lock.Release()
+
+	// 常驻进程也通过render.RunCommand运行，需要在startSession之后创建
+	// 命令行指定的渲染器只对本次运行生效，不写入配置文件
+	rendererSettings := *settings
+	if *rendererName != "" {
+		rendererSettings.Renderer = *rendererName
+	}
+	renderer, closeRenderer, err := plantuml.NewRenderer(&rendererSettings)
+	if err != nil {
+		log.Printf("警告：%v，每次渲染启动新的PlantUML进程", err)
+	} else {
+		defer closeRenderer()
+		plantuml.DefaultRenderer = renderer
+	}
+
+	// 减少动态效果时通过Fyne的全局设置关闭动画
+	app.FyneSettingsFile = (&fyneapp.SettingsSchema{}).StoragePath()
+	application := app.New(fyneapp.New(), settings, lock, plantuml.DefaultRenderer)
+
+	// 启动IPC服务器来接收文件请求
+	log.Println("启动IPC服务器...")
+	server, err := ipc.Listen(ipcAddr, application.OpenFiles)
+	if err != nil {
+		log.Printf("%v", err)
+	} else {
+		server.HandleCommand(ipc.CommandPauseWatching, application.PauseWatching)
+		server.HandleCommand(ipc.CommandResumeWatching, application.ResumeWatching)
+		server.HandleCommand(ipc.CommandCloseAll, application.CloseAllTabs)
+		server.HandleCommand(ipc.CommandCloseOthers, application.CloseOtherTabs)
+		server.HandleVirtual(application.OpenVirtual)
+		go server.Serve()
+		defer server.Close()
+	}
+
+	// 启动供VS Code等编辑器扩展使用的接口
+	if *companionListen != "" {
+		companionServer, err := companion.Listen(*companionListen)
+		if err != nil {
+			log.Printf("%v", err)
+		} else {
+			application.ServeCompanion(companionServer)
+			go companionServer.Serve()
+			defer companionServer.Close()
+		}
+	}
+	if *httpListen != "" {
+		if httpServer, err := listenHTTP(*httpListen); err != nil {
+			log.Printf("%v", err)
+		} else {
+			application.ServeCompanion(httpServer)
+			go httpServer.Serve()
+			defer httpServer.Close()
+		}
+	}
+
+	if stdinFile != nil {
+		application.OpenVirtualOnStart(*stdinFile)
+	}
+	application.Run(validFiles, *follow)
+}
+
+// listenHTTP 读取（没有时生成）HTTP接口的令牌，并在addr上启动HTTP接口
+func listenHTTP(addr string) (*companion.HTTPServer, error) {
+	token, err := companion.LoadHTTPToken()
+	if err != nil {
+		return nil, err
+	}
+	return companion.ListenHTTP(addr, token)
+}
+
+// loadManaged 读取管理员下发的系统级设置并应用到渲染。设置无效时退出，不能因为文件写错就取消管理员的限制
+func loadManaged() *config.Managed {
+	managed, err := config.LoadManaged(config.ManagedPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v，请联系管理员\n", err)
+		os.Exit(1)
+	}
+	if managed.Active() {
+		log.Printf("使用管理员设置: %s", managed.Path())
+	}
+	plantuml.SetManaged(managed)
+	return managed
+}
+
+// setupLogger 配置日志输出到文件
+func setupLogger() {
+	// 获取当前执行程序所在目录
+	execPath, err := os.Executable()
+	if err != nil {
+		log.Printf("获取程序路径失败: %v", err)
+		return
+	}
+	execDir := filepath.Dir(execPath)
+
+	// 日志文件路径（放在程序所在目录下）
+	logFilePath := filepath.Join(execDir, "plantumlviewer.log")
+
+	// 创建或截断日志文件，只有当前用户可读，大小有上限
+	logFile, err := logging.OpenFile(logFilePath, logging.DefaultMaxSize)
+	if err != nil {
+		log.Printf("无法创建日志文件: %v", err)
+		return
+	}
+
+	// 设置日志同时输出到文件和标准输出
+	logFileWriter = logFile
+	multiWriter := io.MultiWriter(logFile, os.Stdout)
+	log.SetOutput(multiWriter)
+
+	// 设置日志前缀和标志
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+
+	// 记录应用启动信息
+	log.Printf("PlantUML Viewer v%s 启动", version)
+	log.Printf("日志文件位置: %s", logFilePath)
+}
+
+// runConvert 解析convert子命令的参数，把目录中的所有图表批量导出，返回退出码
+func runConvert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	out := fs.String("out", "", "输出目录，按源目录的结构存放导出的文件")
+	format := fs.String("format", "png", "导出格式（png、pdf或svg，auto表示按项目的渲染配置选择）")
+	scale := fs.Float64("scale", 1, "导出比例，例如2表示以2倍分辨率重新渲染")
+	jobs := fs.Int("jobs", runtime.NumCPU(), "同时渲染的文件数")
+	reportFormat := fs.String("report-format", app.ReportJSON, "结果的输出格式（json；github输出GitHub Actions的错误注释；junit输出JUnit XML）")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: plantumlviewer convert 源目录 -out 输出目录 [选项]")
+		fs.PrintDefaults()
+	}
+
+	// 源目录可以写在选项前面，例如 convert docs --out site --format svg
+	var dirs []string
+	for {
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			return 0
+		} else if err != nil {
+			return 2
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		dirs = append(dirs, args[0])
+		args = args[1:]
+	}
+	if len(dirs) != 1 {
+		fs.Usage()
+		return 2
+	}
+	if err := app.SetReportFormat(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		return 2
+	}
+	return app.Convert(dirs[0], *out, *format, *scale, *jobs, os.Stdout, os.Stderr)
+}
+
+// runDiff 渲染一个文件在两个git版本中的样子并生成差异报告，返回退出码
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	from := fs.String("from", "", "比较的旧版本，例如 origin/main 或提交的哈希")
+	to := fs.String("to", "", "比较的新版本，为空时为工作区中的文件")
+	out := fs.String("out", "", "差异报告的路径")
+	format := fs.String("format", "", "差异报告的格式（png为左右并排的图像，html为拖动滑块对比的网页），为空时按 -out 的扩展名选择")
+	scale := fs.Float64("scale", 1, "渲染比例，例如2表示以2倍分辨率渲染")
+	reportFormat := fs.String("report-format", app.ReportJSON, "结果的输出格式（json；github输出GitHub Actions的错误注释；junit输出JUnit XML）")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: plantumlviewer diff 文件 -from 版本 [-to 版本] -out 报告路径 [选项]")
+		fs.PrintDefaults()
+	}
+
+	// 文件可以写在选项前面，例如 diff docs/login.puml --from origin/main --out diff.png
+	var files []string
+	for {
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			return 0
+		} else if err != nil {
+			return 2
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		files = append(files, args[0])
+		args = args[1:]
+	}
+	if len(files) != 1 {
+		fs.Usage()
+		return 2
+	}
+	if err := app.SetReportFormat(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		return 2
+	}
+	return app.ExportDiff(files[0], *from, *to, *out, *format, *scale, os.Stdout, os.Stderr)
+}
+
+// runEvolution 渲染一个文件在一段git历史中的各个版本并生成演变动画，返回退出码
+func runEvolution(args []string) int {
+	fs := flag.NewFlagSet("evolution", flag.ContinueOnError)
+	from := fs.String("from", "", "动画开始的版本，例如 v1.0 或提交的哈希，为空时从文件的第一个提交开始")
+	to := fs.String("to", "", "动画结束的版本，为空时为HEAD")
+	out := fs.String("out", "", "动画的路径")
+	format := fs.String("format", "", "动画的格式（gif兼容性最好，apng保留完整颜色），为空时按 -out 的扩展名选择")
+	scale := fs.Float64("scale", 1, "渲染比例，例如2表示以2倍分辨率渲染")
+	delay := fs.Float64("delay", export.DefaultFrameDelay.Seconds(), "每一帧显示的秒数")
+	reportFormat := fs.String("report-format", app.ReportJSON, "结果的输出格式（json；github输出GitHub Actions的错误注释；junit输出JUnit XML）")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: plantumlviewer evolution 文件 [-from 版本] [-to 版本] -out 动画路径 [选项]")
+		fs.PrintDefaults()
+	}
+
+	var files []string
+	for {
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			return 0
+		} else if err != nil {
+			return 2
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		files = append(files, args[0])
+		args = args[1:]
+	}
+	if len(files) != 1 {
+		fs.Usage()
+		return 2
+	}
+	if err := app.SetReportFormat(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		return 2
+	}
+	return app.ExportEvolution(files[0], *from, *to, *out, *format, *scale, *delay, os.Stdout, os.Stderr)
+}
+
+// stringList 是可以重复指定的命令行选项，例如 -ignore drafts -ignore '*-wip.puml'
+type stringList []string
+
+func (l *stringList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runCheck 只检查文件和目录中的图表的语法，不生成图像，返回退出码
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	var ignore, includes stringList
+	fs.Var(&ignore, "ignore", "跳过匹配该模式的文件，可以重复指定（例如 drafts 或 'docs/*-wip.puml'）")
+	fs.Var(&includes, "include", "!include查找文件的目录，可以重复指定")
+	jobs := fs.Int("jobs", runtime.NumCPU(), "同时检查的文件数")
+	reportFormat := fs.String("report-format", app.ReportJSON, "结果的输出格式（json；github输出GitHub Actions的错误注释；junit输出JUnit XML）")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: plantumlviewer check [文件或目录...] [选项]，没有给出时检查当前目录")
+		fs.PrintDefaults()
+	}
+
+	// 文件可以写在选项前面，例如 check docs --ignore drafts
+	var paths []string
+	for {
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			return 0
+		} else if err != nil {
+			return 2
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		paths = append(paths, args[0])
+		args = args[1:]
+	}
+	if err := app.SetReportFormat(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		return 2
+	}
+	return app.Check(paths, ignore, includes, *jobs, os.Stdout, os.Stderr)
+}
+
+// runFmt 整理文件和目录中的图表的源码格式，--check时只检查不改写，返回退出码
+func runFmt(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	var ignore stringList
+	fs.Var(&ignore, "ignore", "跳过匹配该模式的文件，可以重复指定（例如 drafts 或 'docs/*-wip.puml'）")
+	check := fs.Bool("check", false, "只检查格式，不改写文件，有格式不同的文件时退出码为1，用于CI")
+	reportFormat := fs.String("report-format", app.ReportJSON, "结果的输出格式（json；github输出GitHub Actions的错误注释；junit输出JUnit XML）")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: plantumlviewer fmt [文件或目录...] [选项]，没有给出时整理当前目录，- 表示从标准输入读取并写入标准输出")
+		fs.PrintDefaults()
+	}
+
+	// 文件可以写在选项前面，例如 fmt docs --check
+	var paths []string
+	for {
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			return 0
+		} else if err != nil {
+			return 2
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		paths = append(paths, args[0])
+		args = args[1:]
+	}
+	if err := app.SetReportFormat(*reportFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		return 2
+	}
+	return app.Fmt(paths, ignore, *check, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// runDoctor 检查运行环境并输出结果和修复方法，项目配置从当前目录开始查找，返回退出码
+func runDoctor() int {
+	dir, err := os.Getwd()
+	if err != nil {
+		dir = ""
+	}
+	fmt.Printf("PlantUML Viewer v%s\n", version)
+	return doctor.Run(os.Stdout, doctor.Paths{
+		LockFile:    lockFile,
+		IPCAddr:     ipcAddr,
+		TempDir:     os.TempDir(),
+		ConfigFile:  config.Path(),
+		ManagedFile: config.ManagedPath(),
+		ProjectDir:  dir,
+	})
+}
+
+// runDaemon 以守护模式运行直到收到中断信号，返回退出码。守护模式使用自己的锁和IPC地址，可以与窗口实例同时运行，
+// -pause-watching、-resume-watching以及（窗口实例没有运行时）发送文件都可以用来控制它。
+// tui为true时在终端中显示状态并读取命令，此时日志只写入日志文件；metricsAddr不为空时在该地址上提供指标
+func runDaemon(targets []config.DaemonTarget, tui bool, metricsAddr string) int {
+	if instance.IsRunning(daemonLockFile) {
+		fmt.Fprintln(os.Stderr, "守护模式已经在运行")
+		return 1
+	}
+	d, err := app.NewDaemon(targets)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	sess := startSession(daemonSessionFile, daemonAddr)
+	defer sess.End()
+	lock, err := instance.Acquire(daemonLockFile)
+	if err != nil {
+		log.Printf("警告：%v", err)
+	}
+	defer lock.Release()
+
+	server, err := ipc.Listen(daemonAddr, d.Export)
+	if err != nil {
+		log.Printf("%v", err)
+	} else {
+		server.HandleCommand(ipc.CommandPauseWatching, d.Pause)
+		server.HandleCommand(ipc.CommandResumeWatching, d.Resume)
+		go server.Serve()
+		defer server.Close()
+	}
+	if metricsAddr != "" {
+		if metrics, err := app.ListenMetrics(d, metricsAddr); err != nil {
+			log.Printf("%v", err)
+		} else {
+			go metrics.Serve()
+			defer metrics.Close()
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		d.Stop()
+	}()
+	if tui {
+		logToFileOnly()
+		go app.RunDaemonStatus(d, os.Stdin, os.Stdout, openInViewer)
+	}
+	d.Run()
+	return 0
+}
+
+// openInViewer 让运行中的窗口实例打开文件，用于守护模式的状态界面
+func openInViewer(file string) error {
+	if !instance.IsRunning(lockFile) {
+		return fmt.Errorf("查看器窗口没有在运行，请先不带文件启动 plantumlviewer")
+	}
+	results, err := ipc.Send(ipcAddr, []string{file}, []ipc.OpenOptions{{}}, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	if len(results) > 0 && !results[0].OK {
+		return fmt.Errorf("%s", results[0].Error)
+	}
+	return nil
+}
+
+// startSession 根据会话文件path清理上一次崩溃遗留的渲染进程、临时目录和sockets中的套接字，
+// 然后开始记录本次启动的渲染进程和创建的临时目录。需要在确认没有其他实例运行之后、获取锁之前调用，创建会话文件失败时返回nil
+func startSession(path string, sockets ...string) *session.Session {
+	if prev, ok := session.Crashed(path); ok {
+		log.Println("上一次运行没有正常退出，清理遗留的资源")
+		for _, item := range prev.Cleanup(sockets) {
+			log.Printf("已清理%s", item)
+		}
+	}
+	sess, err := session.Start(path)
+	if err != nil {
+		log.Printf("警告：%v", err)
+		return nil
+	}
+	render.RunCommand = sess.Run
+	render.MakeTempDir, render.RemoveTempDir = sess.MakeTempDir, sess.RemoveTempDir
+	return sess
+}
+
+// logToFileOnly 让日志只写入日志文件，用于需要在标准输出中输出JSON结果的场合
+func logToFileOnly() {
+	if logFileWriter != nil {
+		log.SetOutput(logFileWriter)
+	} else {
+		log.SetOutput(ioutil.Discard)
+	}
+}
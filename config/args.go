@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AllowedFlags 是可以作为额外参数传给PlantUML的开关。改变输出格式、输出位置或读取其他文件的参数（-t、-o、-pipe、-config、-I等）
+// 会让查看器读不到图像或绕过安全配置，不在其中
+var AllowedFlags = []string{"-nometadata", "-darkmode", "-disablestats", "-enablestats"}
+
+// allowedArgPattern 匹配 -P名称=值（pragma，例如 -Playout=smetana）、-S名称=值（skinparam）和 -D名称=值（预处理变量）
+var allowedArgPattern = regexp.MustCompile(`^-[PSD][A-Za-z_][A-Za-z0-9_.]*=\S*$`)
+
+// ValidateArgs 检查额外的PlantUML参数：只允许AllowedFlags中的开关和 -P、-S、-D 形式的 名称=值 参数
+func ValidateArgs(args []string) error {
+	for _, arg := range args {
+		if allowedArgPattern.MatchString(arg) || isAllowedFlag(arg) {
+			continue
+		}
+		return fmt.Errorf("不允许的PlantUML参数 %s（可以使用 -P名称=值、-S名称=值、-D名称=值 和 %s）", arg, strings.Join(AllowedFlags, "、"))
+	}
+	return nil
+}
+
+// isAllowedFlag 判断是否为AllowedFlags中的开关，不区分大小写
+func isAllowedFlag(arg string) bool {
+	for _, flag := range AllowedFlags {
+		if strings.EqualFold(flag, arg) {
+			return true
+		}
+	}
+	return false
+}
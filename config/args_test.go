@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestValidateArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{nil, true},
+		{[]string{"-Playout=smetana", "-nometadata", "-darkmode", "-SdefaultFontSize=14", "-DVERSION=1.2"}, true},
+		{[]string{"-NOMETADATA"}, true},
+		{[]string{"-tsvg"}, false},
+		{[]string{"-pipe"}, false},
+		{[]string{"-config", "a.cfg"}, false},
+		{[]string{"-Playout"}, false},
+		{[]string{"-P=smetana"}, false},
+		{[]string{"-Ilib/*.puml"}, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateArgs(tt.args); (err == nil) != tt.ok {
+			t.Errorf("ValidateArgs(%q) = %v", tt.args, err)
+		}
+	}
+}
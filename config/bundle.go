@@ -0,0 +1,172 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BundleVersion 是设置文件格式的版本，导入时拒绝更新的版本
+const BundleVersion = 1
+
+// BundleExt 是导出的设置文件的扩展名
+const BundleExt = ".plantumlviewer-settings.json"
+
+// Bundle 是导出的设置文件，包含用户设置和工作区状态，团队可以用它共享统一的查看器设置。
+// 快捷键目前不能自定义，没有需要导出的内容。用户主目录下的路径保存为以~开头的路径，导入时展开为导入者的主目录
+type Bundle struct {
+	Version   int      `json:"version"`
+	Config    *Config  `json:"config"`
+	Workspace *Session `json:"workspace,omitempty"`
+}
+
+// NewBundle 创建cfg和session的设置文件。includePaths为false时不包含本机的路径：守护模式的目录，
+// 以及以文件路径为键的标签标题、颜色、定时刷新、文件编码、布局引擎和额外参数，只保留分组的折叠状态等与路径无关的设置
+func NewBundle(cfg *Config, session *Session, includePaths bool) *Bundle {
+	c := *cfg
+	c.Daemon = nil
+	ws := NewSession()
+	for group, collapsed := range session.Collapsed {
+		ws.Collapsed[group] = collapsed
+	}
+	if includePaths {
+		for _, target := range cfg.Daemon {
+			target.Source = portablePath(target.Source)
+			target.Out = portablePath(target.Out)
+			c.Daemon = append(c.Daemon, target)
+		}
+		for path, style := range session.Tabs {
+			ws.Tabs[portablePath(path)] = style
+		}
+		for path, seconds := range session.Intervals {
+			ws.Intervals[portablePath(path)] = seconds
+		}
+		for path, name := range session.Charsets {
+			ws.Charsets[portablePath(path)] = name
+		}
+		for path, engine := range session.Layouts {
+			ws.Layouts[portablePath(path)] = engine
+		}
+		for path, args := range session.Args {
+			ws.Args[portablePath(path)] = args
+		}
+		for path, flags := range session.Flags {
+			ws.Flags[portablePath(path)] = flags
+		}
+		for path, format := range session.Formats {
+			ws.Formats[portablePath(path)] = format
+		}
+	}
+	return &Bundle{Version: BundleVersion, Config: &c, Workspace: ws}
+}
+
+// Encode 将设置文件写入w
+func (b *Bundle) Encode(w io.Writer) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法序列化设置: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("无法写入设置文件: %v", err)
+	}
+	return nil
+}
+
+// ReadBundle 从r读取设置文件。文件中没有的设置项取base中的值，因此较早版本导出的文件不会把新的设置项改为零值
+func ReadBundle(r io.Reader, base *Config) (*Bundle, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取设置文件: %v", err)
+	}
+	c := *base
+	c.Daemon = nil
+	b := &Bundle{Config: &c}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("设置文件格式错误: %v", err)
+	}
+	if b.Version < 1 || b.Version > BundleVersion {
+		return nil, fmt.Errorf("不支持的设置文件版本 %d，请升级查看器", b.Version)
+	}
+	// 导入的参数与项目配置中的一样需要检查，不能借设置文件传入其他参数
+	if b.Workspace != nil {
+		for path, args := range b.Workspace.Args {
+			if err := ValidateArgs(args); err != nil {
+				return nil, fmt.Errorf("设置文件中 %s 的%v", path, err)
+			}
+		}
+	}
+	return b, nil
+}
+
+// Apply 用设置文件中的设置替换cfg，合并到session中并保存session；cfg由调用方保存。
+// 设置文件不包含守护模式的目录时保留cfg原有的目录
+func (b *Bundle) Apply(cfg *Config, session *Session) error {
+	daemon := cfg.Daemon
+	*cfg = *b.Config
+	cfg.Daemon = daemon
+	if len(b.Config.Daemon) > 0 {
+		cfg.Daemon = nil
+		for _, target := range b.Config.Daemon {
+			target.Source = ExpandPath(target.Source)
+			target.Out = ExpandPath(target.Out)
+			cfg.Daemon = append(cfg.Daemon, target)
+		}
+	}
+
+	if b.Workspace == nil {
+		return nil
+	}
+	for group, collapsed := range b.Workspace.Collapsed {
+		session.Collapsed[group] = collapsed
+	}
+	for path, style := range b.Workspace.Tabs {
+		session.Tabs[ExpandPath(path)] = style
+	}
+	for path, seconds := range b.Workspace.Intervals {
+		session.Intervals[ExpandPath(path)] = seconds
+	}
+	for path, name := range b.Workspace.Charsets {
+		session.Charsets[ExpandPath(path)] = name
+	}
+	for path, engine := range b.Workspace.Layouts {
+		session.Layouts[ExpandPath(path)] = engine
+	}
+	for path, args := range b.Workspace.Args {
+		session.Args[ExpandPath(path)] = args
+	}
+	for path, flags := range b.Workspace.Flags {
+		session.Flags[ExpandPath(path)] = flags
+	}
+	for path, format := range b.Workspace.Formats {
+		session.Formats[ExpandPath(path)] = format
+	}
+	return session.Save()
+}
+
+// portablePath 把用户主目录下的路径改为以~开头的路径
+func portablePath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(filepath.Join("~", rel))
+	}
+	return path
+}
+
+// ExpandPath 把以~开头的路径展开为当前用户主目录下的路径，其他路径原样返回
+func ExpandPath(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, filepath.FromSlash(strings.TrimPrefix(path, "~")))
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	diagram := filepath.Join(home, "docs", "login.puml")
+
+	cfg := Default()
+	cfg.HighContrast = true
+	cfg.FontName = "PingFang SC"
+	cfg.Daemon = []DaemonTarget{{Source: filepath.Join(home, "docs"), Out: "/srv/site", Format: "svg"}}
+	session := NewSession()
+	session.Tabs[diagram] = TabStyle{Color: "blue"}
+	session.Charsets[diagram] = "GBK"
+	session.Collapsed["billing"] = true
+
+	var buf bytes.Buffer
+	if err := NewBundle(cfg, session, true).Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if data := buf.String(); strings.Contains(data, home) || !strings.Contains(data, `"~/docs/login.puml"`) {
+		t.Errorf("主目录下的路径应保存为以~开头的路径: %s", data)
+	}
+
+	// 在另一台机器上导入：主目录不同，已有的设置被替换，工作区状态合并
+	other := t.TempDir()
+	t.Setenv("HOME", other)
+	b, err := ReadBundle(&buf, Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported := Default()
+	target := NewSession()
+	target.Collapsed["frontend"] = true
+	if err := b.Apply(imported, target); err != nil {
+		t.Fatal(err)
+	}
+	if !imported.HighContrast || imported.FontName != "PingFang SC" {
+		t.Errorf("应导入用户设置，得到 %+v", imported)
+	}
+	wantDaemon := []DaemonTarget{{Source: filepath.Join(other, "docs"), Out: "/srv/site", Format: "svg"}}
+	if !reflect.DeepEqual(imported.Daemon, wantDaemon) {
+		t.Errorf("守护模式的目录 = %+v，应为 %+v", imported.Daemon, wantDaemon)
+	}
+	moved := filepath.Join(other, "docs", "login.puml")
+	if target.TabStyle(moved).Color != "blue" || target.Charset(moved) != "GBK" {
+		t.Errorf("应按导入者的主目录恢复标签设置，得到 %+v，%+v", target.Tabs, target.Charsets)
+	}
+	if !target.GroupCollapsed("billing") || !target.GroupCollapsed("frontend") {
+		t.Errorf("分组的折叠状态应合并，得到 %+v", target.Collapsed)
+	}
+}
+
+func TestBundleWithoutPaths(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg := Default()
+	cfg.Daemon = []DaemonTarget{{Source: "/data/docs", Out: "/srv/site"}}
+	session := NewSession()
+	session.Tabs["/data/docs/a.puml"] = TabStyle{Title: "登录"}
+	session.Collapsed["billing"] = true
+
+	b := NewBundle(cfg, session, false)
+	if b.Config.Daemon != nil || len(b.Workspace.Tabs) != 0 || !b.Workspace.Collapsed["billing"] {
+		t.Errorf("不包含路径时应去掉守护模式的目录和各文件的设置，得到 %+v，%+v", b.Config, b.Workspace)
+	}
+	if len(cfg.Daemon) != 1 {
+		t.Error("导出不应修改原来的设置")
+	}
+
+	// 导入不包含路径的设置文件时保留本机的守护模式目录
+	local := Default()
+	local.Daemon = []DaemonTarget{{Source: "/home/me/docs", Out: "/home/me/site"}}
+	if err := b.Apply(local, NewSession()); err != nil {
+		t.Fatal(err)
+	}
+	if len(local.Daemon) != 1 || local.Daemon[0].Source != "/home/me/docs" {
+		t.Errorf("应保留本机的守护模式目录，得到 %+v", local.Daemon)
+	}
+}
+
+func TestReadBundle(t *testing.T) {
+	// 文件中没有的设置项保留原来的值
+	base := Default()
+	base.RenderRetries = 7
+	b, err := ReadBundle(strings.NewReader(`{"version": 1, "config": {"highContrast": true}}`), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Config.HighContrast || b.Config.RenderRetries != 7 || b.Config.MeasureDPI != 96 {
+		t.Errorf("文件中没有的设置项应保留原来的值，得到 %+v", b.Config)
+	}
+
+	for _, content := range []string{`{"version": 2, "config": {}}`, `{"config": {}}`, `{`} {
+		if _, err := ReadBundle(strings.NewReader(content), Default()); err == nil {
+			t.Errorf("ReadBundle(%s) 应返回错误", content)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Config 保存应用程序的用户设置
+type Config struct {
+	WatchFiles       bool    `json:"watchFiles"`       // 是否在后台持续监控已打开文件的变化
+	RefreshOnFocus   bool    `json:"refreshOnFocus"`   // 窗口重新获得焦点时是否检查并刷新已变化的文件
+	MeasureDPI       float64 `json:"measureDPI"`       // 测量工具将像素换算为毫米所用的DPI
+	ShowOutline      bool    `json:"showOutline"`      // 是否在右侧显示当前标签的大纲
+	OpenInBackground bool    `json:"openInBackground"` // 其他实例发来的文件是否在后台标签中打开，不激活窗口也不切换标签
+	ReduceMotion     bool    `json:"reduceMotion"`     // 是否关闭切换标签等动画，系统开启了“减弱动态效果”时也会关闭
+	HighContrast     bool    `json:"highContrast"`     // 是否以高对比度查看图表：注入加粗线条和黑色文字的skinparam，不影响导出
+	ColorBlindSafe   bool    `json:"colorBlindSafe"`   // 是否把查看的图像中红绿色盲难以区分的颜色重新映射，不影响导出
+	DebugLog         bool    `json:"debugLog"`         // 日志中是否记录完整的文件路径、按键和IPC请求内容，默认只记录路径的哈希
+	SVGMode          bool    `json:"svgMode"`          // 是否以SVG渲染查看的图表，放大后仍然清晰，可以为单个文件另外指定
+
+	ConfirmCloseTabs int `json:"confirmCloseTabs"` // 一次关闭超过这么多标签页时先确认，0表示不确认
+	ConfirmQuitTabs  int `json:"confirmQuitTabs"`  // 打开超过这么多标签页时退出前先确认，0表示不确认
+	RenderRetries    int `json:"renderRetries"`    // 遇到找不到Java、临时目录被锁定等暂时性错误时最多重试的次数，0表示不重试
+
+	SyncInterval float64 `json:"syncInterval,omitempty"` // Dropbox、Syncthing等同步文件夹中的文件的检查间隔（秒），0表示默认的3秒
+
+	Renderer        string  `json:"renderer,omitempty"`        // 查看时使用的渲染器（见Renderers），为空时按pipeRenderers和krokiURL选择
+	PipeRenderers   int     `json:"pipeRenderers,omitempty"`   // 常驻的 plantuml -pipe 进程数，0表示每次渲染启动新的进程
+	PipeIdleTimeout float64 `json:"pipeIdleTimeout,omitempty"` // 常驻进程空闲多久（秒）后结束，0表示默认的5分钟
+
+	KrokiURL string `json:"krokiURL,omitempty"` // Kroki服务的地址，设置后查看时通过该服务渲染，不需要本地的Java和PlantUML
+
+	RenderCacheMB int     `json:"renderCacheMB,omitempty"` // 渲染结果的磁盘缓存最大的大小（MB），0表示默认的512，小于0表示不缓存
+	RenderTimeout float64 `json:"renderTimeout,omitempty"` // 查看时一次渲染最长的时间（秒），超过后结束PlantUML进程并显示超时错误，0表示默认的120
+	MaxRenders    int     `json:"maxRenders,omitempty"`    // 查看时同一时间最多运行的PlantUML数，0表示CPU核数的一半（至少1个）
+
+	Watermark     *Watermark `json:"watermark,omitempty"`     // 导出时叠加的水印，项目配置中的watermark优先，为nil时不加水印
+	SlideFontFile string     `json:"slideFontFile,omitempty"` // 导出幻灯片时标题使用的TrueType或OpenType字体文件，标题包含中日韩文字时指定，为空时使用内置字体
+	// PostProcessors 是可以在渲染配置的postProcess中按名称引用的后处理命令，例如用pngquant压缩导出的PNG
+	PostProcessors map[string]PostProcessor `json:"postProcessors,omitempty"`
+
+	AgeIdentity string `json:"ageIdentity,omitempty"` // 解密age加密的图表默认使用的密钥文件，为空时打开时选择
+
+	Workspaces string `json:"workspaces,omitempty"` // 其他实例发来的文件按工作区分开的方式（group或window），为空时都在同一个标签栏中
+
+	Charset      string `json:"charset,omitempty"`      // 源文件默认的字符编码（UTF-8、GBK、Shift_JIS或ISO-8859-1），为空或auto时自动识别
+	FontName     string `json:"fontName,omitempty"`     // 图表使用的字体，以skinparam defaultFontName注入，为空时使用PlantUML的默认字体
+	JavaEncoding string `json:"javaEncoding,omitempty"` // 渲染时Java的默认编码（-Dfile.encoding），为空时使用Java的默认值
+
+	Daemon []DaemonTarget `json:"daemon,omitempty"` // 守护模式（-daemon）下监控并保持导出结果最新的目录
+}
+
+// DaemonTarget 是守护模式下的一个目录：其中的图表变化后自动导出到Out，保持原来的目录结构
+type DaemonTarget struct {
+	Source string        `json:"source"`           // 监控的目录
+	Out    string        `json:"out"`              // 导出目录
+	Format string        `json:"format,omitempty"` // 导出格式（png、pdf或svg，auto表示按渲染配置），为空时为png
+	Scale  float64       `json:"scale,omitempty"`  // 导出比例，为0时为1
+	Ignore []string      `json:"ignore,omitempty"` // 忽略的文件，使用filepath.Match的语法：包含/时匹配相对于Source的路径，否则只匹配文件名
+	Upload *BucketUpload `json:"upload,omitempty"` // 重新导出后上传到的S3或GCS位置，为nil时不上传
+}
+
+// Default 返回默认设置
+func Default() *Config {
+	return &Config{
+		WatchFiles:     true,
+		RefreshOnFocus: false,
+		MeasureDPI:     96,
+
+		ConfirmCloseTabs: 5,
+		RenderRetries:    3,
+	}
+}
+
+// Dir 返回配置目录，位于系统的用户配置目录下
+func Dir() string {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		base = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(base, "plantumlviewer")
+}
+
+// DraftDir 返回草稿的恢复目录，未保存的草稿标签内容保存在这里，程序崩溃后可以恢复
+func DraftDir() string {
+	return filepath.Join(Dir(), "drafts")
+}
+
+// UndoDir 返回编辑区的撤销历史目录，每个文件的历史保存为一个文件，重新启动后仍然可以撤销
+func UndoDir() string {
+	return filepath.Join(Dir(), "undo")
+}
+
+// Path 返回配置文件路径
+func Path() string {
+	return filepath.Join(Dir(), "config.json")
+}
+
+// Load 读取配置文件，文件不存在时返回默认设置
+func Load() (*Config, error) {
+	return LoadFile(Path())
+}
+
+// LoadFile 读取path上的配置文件，文件不存在时返回默认设置
+func LoadFile(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("无法读取配置文件: %v", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return Default(), fmt.Errorf("配置文件格式错误: %v", err)
+	}
+	return cfg, nil
+}
+
+// Save 将设置写入配置文件
+func (c *Config) Save() error {
+	if err := os.MkdirAll(Dir(), 0755); err != nil {
+		return fmt.Errorf("无法创建配置目录: %v", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法序列化配置: %v", err)
+	}
+
+	if err := ioutil.WriteFile(Path(), data, 0644); err != nil {
+		return fmt.Errorf("无法写入配置文件: %v", err)
+	}
+	return nil
+}
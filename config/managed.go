@@ -0,0 +1,108 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Backends 是可以用来渲染的PlantUML：jar为plantuml.jar，command为plantuml命令行工具（例如Homebrew安装的）
+var Backends = []string{"jar", "command"}
+
+// Managed 是管理员为受管理的电脑下发的系统级设置，用户设置和项目配置都不能覆盖。
+// 零值表示没有限制
+type Managed struct {
+	// Security 是所有渲染使用的PlantUML安全配置，项目渲染配置中的安全配置被忽略
+	Security string `json:"security,omitempty"`
+	// Backends 是允许使用的PlantUML，按顺序优先使用，为空时不限制
+	Backends []string `json:"backends,omitempty"`
+	// DisableNetwork 禁止渲染时访问网络，并且编辑器接口不能监听TCP地址
+	DisableNetwork bool `json:"disableNetwork,omitempty"`
+
+	path string // 读取的文件，没有时为空
+}
+
+// ManagedPath 返回管理员设置的路径：macOS上为 /Library/Preferences/plantumlviewer/managed.json，
+// 其他系统为 /etc/plantumlviewer/managed.json。普通用户不能修改这些位置
+func ManagedPath() string {
+	if runtime.GOOS == "darwin" {
+		return "/Library/Preferences/plantumlviewer/managed.json"
+	}
+	return "/etc/plantumlviewer/managed.json"
+}
+
+// LoadManaged 读取path上的管理员设置，文件不存在时返回没有限制的设置
+func LoadManaged(path string) (*Managed, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Managed{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无法读取管理员设置: %v", err)
+	}
+	m := &Managed{path: path}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("管理员设置 %s 格式错误: %v", path, err)
+	}
+	if m.Security != "" && !isSecurityProfile(m.Security) {
+		return nil, fmt.Errorf("管理员设置 %s 的安全配置 %s 无效（可选: %s）", path, m.Security, strings.Join(SecurityProfiles, ", "))
+	}
+	for _, backend := range m.Backends {
+		if !isBackend(backend) {
+			return nil, fmt.Errorf("管理员设置 %s 的后端 %s 无效（可选: %s）", path, backend, strings.Join(Backends, ", "))
+		}
+	}
+	return m, nil
+}
+
+// Path 返回读取的文件，没有管理员设置时为空字符串
+func (m *Managed) Path() string {
+	return m.path
+}
+
+// Active 返回是否有任何限制
+func (m *Managed) Active() bool {
+	return m.Security != "" || len(m.Backends) > 0 || m.DisableNetwork
+}
+
+// networkProfiles 是允许访问网络的安全配置，空字符串为PlantUML的默认配置，同样允许访问网络
+var networkProfiles = map[string]bool{"": true, "INTERNET": true, "UNSECURE": true, "LEGACY": true}
+
+// EffectiveSecurity 返回渲染时实际使用的安全配置：有管理员指定的安全配置时使用它，
+// 禁止访问网络并且安全配置允许访问网络时改为SANDBOX
+func (m *Managed) EffectiveSecurity(requested string) string {
+	security := strings.ToUpper(requested)
+	if m.Security != "" {
+		security = strings.ToUpper(m.Security)
+	}
+	if m.DisableNetwork && networkProfiles[security] {
+		security = "SANDBOX"
+	}
+	return security
+}
+
+// AllowsBackend 返回是否允许使用名为backend的PlantUML
+func (m *Managed) AllowsBackend(backend string) bool {
+	if len(m.Backends) == 0 {
+		return true
+	}
+	for _, b := range m.Backends {
+		if strings.EqualFold(b, backend) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBackend 判断是否为Backends中的名称，不区分大小写
+func isBackend(name string) bool {
+	for _, b := range Backends {
+		if strings.EqualFold(b, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadManaged(t *testing.T) {
+	dir := t.TempDir()
+	m, err := LoadManaged(filepath.Join(dir, "missing.json"))
+	if err != nil || m.Active() || m.Path() != "" {
+		t.Fatalf("文件不存在时应没有限制，得到 %+v，%v", m, err)
+	}
+
+	path := filepath.Join(dir, "managed.json")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"security": "allowlist", "backends": ["jar"], "disableNetwork": true}`)
+	m, err = LoadManaged(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Active() || m.Path() != path || !m.AllowsBackend("jar") || m.AllowsBackend("command") {
+		t.Errorf("管理员设置不正确: %+v", m)
+	}
+
+	for content, want := range map[string]string{
+		`{"security": "open"}`:     "安全配置 open",
+		`{"backends": ["server"]}`: "后端 server",
+		`{`:                        "格式错误",
+	} {
+		write(content)
+		if _, err := LoadManaged(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadManaged(%s) 的错误应包含 %q，得到 %v", content, want, err)
+		}
+	}
+}
+
+func TestEffectiveSecurity(t *testing.T) {
+	tests := []struct {
+		managed   Managed
+		requested string
+		want      string
+	}{
+		{Managed{}, "internet", "INTERNET"},
+		{Managed{Security: "allowlist"}, "unsecure", "ALLOWLIST"},
+		{Managed{DisableNetwork: true}, "", "SANDBOX"},
+		{Managed{DisableNetwork: true}, "INTERNET", "SANDBOX"},
+		{Managed{DisableNetwork: true}, "allowlist", "ALLOWLIST"},
+		{Managed{Security: "legacy", DisableNetwork: true}, "sandbox", "SANDBOX"},
+	}
+	for _, tt := range tests {
+		if got := tt.managed.EffectiveSecurity(tt.requested); got != tt.want {
+			t.Errorf("%+v.EffectiveSecurity(%q) = %q，应为 %q", tt.managed, tt.requested, got, tt.want)
+		}
+	}
+}
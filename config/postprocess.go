@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PostProcessFile 是后处理命令参数中的占位符，替换为保存导出内容的临时文件，命令直接修改该文件（例如 oxipng {file}）
+const PostProcessFile = "{file}"
+
+// PostProcessor 是用户设置中定义的一个后处理命令，对导出的图像做压缩、缩放等处理，渲染配置按名称引用。
+// 命令只能在用户设置中定义，项目配置不能让导出时执行任意命令
+type PostProcessor struct {
+	// Command 是命令和参数，默认从标准输入读取导出的内容、把处理后的内容写到标准输出，例如 ["pngquant", "-"]、
+	// ["svgo", "-i", "-", "-o", "-"]；参数中包含PostProcessFile时改为就地修改临时文件
+	Command []string `json:"command"`
+	Formats []string `json:"formats,omitempty"` // 处理的导出格式（png、pdf或svg），为空时处理所有格式
+}
+
+// Applies 判断是否处理format格式的导出
+func (p PostProcessor) Applies(format string) bool {
+	if len(p.Formats) == 0 {
+		return true
+	}
+	for _, f := range p.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 检查命令和格式
+func (p PostProcessor) Validate() error {
+	if len(p.Command) == 0 || strings.TrimSpace(p.Command[0]) == "" {
+		return fmt.Errorf("后处理的command不能为空")
+	}
+	for _, f := range p.Formats {
+		switch f {
+		case "png", "pdf", "svg":
+		default:
+			return fmt.Errorf("后处理 %s 的格式 %s 不支持（可选: png, pdf, svg）", p.Command[0], f)
+		}
+	}
+	return nil
+}
+
+// ValidatePostProcessors 检查用户设置中的所有后处理命令，名称按字母顺序检查
+func ValidatePostProcessors(processors map[string]PostProcessor) error {
+	names := make([]string, 0, len(processors))
+	for name := range processors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := processors[name].Validate(); err != nil {
+			return fmt.Errorf("后处理 %s 无效: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPostProcessor(t *testing.T) {
+	p := PostProcessor{Command: []string{"pngquant", "-"}, Formats: []string{"png"}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("%+v 应有效: %v", p, err)
+	}
+	if !p.Applies("png") || p.Applies("svg") {
+		t.Error("只应处理formats中的格式")
+	}
+	if !(PostProcessor{Command: []string{"cat"}}).Applies("pdf") {
+		t.Error("没有设置formats时应处理所有格式")
+	}
+
+	invalid := []PostProcessor{
+		{},
+		{Command: []string{" "}},
+		{Command: []string{"svgo"}, Formats: []string{"gif"}},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%+v 应无效", p)
+		}
+	}
+
+	err := ValidatePostProcessors(map[string]PostProcessor{"pngquant": p, "svgo": {}})
+	if err == nil || !strings.Contains(err.Error(), "后处理 svgo 无效") {
+		t.Errorf("错误应指出无效的后处理，得到 %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"plantumlmacviewer/internal/charset"
+)
+
+// ProjectFile 是项目配置的文件名。打开或导出文件时，从文件所在目录开始向上查找最近的项目配置
+const ProjectFile = ".plantumlviewer.json"
+
+// SecurityProfiles 是PlantUML支持的安全配置（PLANTUML_SECURITY_PROFILE），限制!include等读取文件和网络的能力
+var SecurityProfiles = []string{"SANDBOX", "ALLOWLIST", "INTERNET", "UNSECURE", "LEGACY"}
+
+// RenderProfile 是一组命名的渲染设置，打开和导出匹配的文件时自动使用
+type RenderProfile struct {
+	Format   string            `json:"format,omitempty"`   // 按渲染配置导出时使用的格式（png、pdf或svg），为空时为png
+	Scale    float64           `json:"scale,omitempty"`    // 渲染比例，查看和导出都按这个比例渲染，导出时再乘以导出比例；为0时为1
+	Theme    string            `json:"theme,omitempty"`    // 注入的主题，相当于在图表开头加上 !theme
+	Defines  map[string]string `json:"defines,omitempty"`  // 预处理变量，相当于 -D名称=值
+	Security string            `json:"security,omitempty"` // PlantUML的安全配置，例如SANDBOX，为空时使用PlantUML的默认值
+	Charset  string            `json:"charset,omitempty"`  // 源文件的字符编码，例如GBK，为空时使用全局设置或自动识别
+	Args     []string          `json:"args,omitempty"`     // 额外的PlantUML参数，例如 -Playout=smetana、-nometadata，只允许ValidateArgs接受的参数
+	// PostProcess 是导出后按顺序应用的后处理，引用用户设置的postProcessors中的名称，例如 ["pngquant", "svgo"]
+	PostProcess []string `json:"postProcess,omitempty"`
+}
+
+// ScaleFactor 返回渲染比例，没有设置时为1
+func (p RenderProfile) ScaleFactor() float64 {
+	if p.Scale > 0 {
+		return p.Scale
+	}
+	return 1
+}
+
+// ProfileRule 把匹配pattern的文件关联到名为profile的渲染配置
+type ProfileRule struct {
+	// Pattern 是相对于项目目录、以/分隔的路径，可以使用filepath.Match的通配符，
+	// 例如 docs/print/*.puml；不包含/时只匹配文件名，例如 *-print.puml
+	Pattern string `json:"pattern"`
+	Profile string `json:"profile"`
+}
+
+// RedactionRule 是导出脱敏副本时对源码做的一次替换：把匹配正则表达式Pattern的内容替换为Replace，
+// Replace中可以用$1等引用分组，例如把 db01.corp.example.com 替换为 host-$1
+type RedactionRule struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+// Project 是项目配置，保存在项目目录的.plantumlviewer.json中
+type Project struct {
+	Dir       string                   `json:"-"` // 项目目录，即配置文件所在的目录
+	Profiles  map[string]RenderProfile `json:"profiles"`
+	Files     []ProfileRule            `json:"files"`               // 按顺序匹配，使用第一个匹配的规则
+	Redaction []RedactionRule          `json:"redaction,omitempty"` // 导出脱敏副本时按顺序应用的替换
+	Watermark *Watermark               `json:"watermark,omitempty"` // 导出这个项目中的图表时叠加的水印，优先于用户设置
+	Publish   *Publish                 `json:"publish,omitempty"`   // 导出这个项目中的图表后上传图像的位置，为nil时不上传
+}
+
+// LoadProject 读取目录dir中的项目配置，检查规则引用的渲染配置是否存在
+func LoadProject(dir string) (*Project, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ProjectFile))
+	if err != nil {
+		return nil, fmt.Errorf("无法读取项目配置: %v", err)
+	}
+	p := &Project{Dir: dir}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("项目配置 %s 格式错误: %v", filepath.Join(dir, ProjectFile), err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("项目配置 %s 无效: %v", filepath.Join(dir, ProjectFile), err)
+	}
+	return p, nil
+}
+
+// validate 检查渲染配置和规则
+func (p *Project) validate() error {
+	names := make([]string, 0, len(p.Profiles))
+	for name := range p.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		profile := p.Profiles[name]
+		switch profile.Format {
+		case "", "png", "pdf", "svg":
+		default:
+			return fmt.Errorf("渲染配置 %s 的格式 %s 不支持", name, profile.Format)
+		}
+		if profile.Scale < 0 {
+			return fmt.Errorf("渲染配置 %s 的比例不能小于0", name)
+		}
+		if profile.Security != "" && !isSecurityProfile(profile.Security) {
+			return fmt.Errorf("渲染配置 %s 的安全配置 %s 无效（可选: %s）", name, profile.Security, strings.Join(SecurityProfiles, ", "))
+		}
+		if _, err := charset.Normalize(profile.Charset); err != nil {
+			return fmt.Errorf("渲染配置 %s 的字符编码 %s 无效（可选: %s）", name, profile.Charset, strings.Join(charset.Names, ", "))
+		}
+		if err := ValidateArgs(profile.Args); err != nil {
+			return fmt.Errorf("渲染配置 %s 的%v", name, err)
+		}
+		for _, step := range profile.PostProcess {
+			if strings.TrimSpace(step) == "" {
+				return fmt.Errorf("渲染配置 %s 的postProcess中有空的名称", name)
+			}
+		}
+	}
+	for _, rule := range p.Files {
+		if _, err := filepath.Match(rule.Pattern, ""); err != nil {
+			return fmt.Errorf("无效的匹配模式 %s: %v", rule.Pattern, err)
+		}
+		if _, ok := p.Profiles[rule.Profile]; !ok {
+			return fmt.Errorf("%s 引用的渲染配置 %s 不存在", rule.Pattern, rule.Profile)
+		}
+	}
+	for _, rule := range p.Redaction {
+		if rule.Pattern == "" {
+			return fmt.Errorf("脱敏规则的pattern不能为空")
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("无效的脱敏规则 %s: %v", rule.Pattern, err)
+		}
+	}
+	if p.Watermark != nil {
+		if err := p.Watermark.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.Publish != nil {
+		if err := p.Publish.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSecurityProfile 判断是否为PlantUML支持的安全配置，不区分大小写
+func isSecurityProfile(name string) bool {
+	for _, s := range SecurityProfiles {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Profile 返回项目为文件path（绝对路径）关联的渲染配置名称和设置，没有匹配的规则时返回false
+func (p *Project) Profile(path string) (string, RenderProfile, bool) {
+	rel, err := filepath.Rel(p.Dir, path)
+	if err != nil {
+		return "", RenderProfile{}, false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, rule := range p.Files {
+		name := rel
+		if !strings.Contains(rule.Pattern, "/") {
+			name = filepath.Base(path)
+		}
+		if ok, _ := filepath.Match(rule.Pattern, name); ok {
+			return rule.Profile, p.Profiles[rule.Profile], true
+		}
+	}
+	return "", RenderProfile{}, false
+}
+
+// FindProject 从path所在目录开始向上查找最近的项目配置，找不到时返回nil。
+// 找到的配置文件无效时返回错误
+func FindProject(path string) (*Project, error) {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ProjectFile)); err == nil {
+			return LoadProject(dir)
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return nil, nil
+		}
+	}
+}
+
+// ProfileFor 查找文件path（绝对路径）所在项目为它关联的渲染配置，返回配置名称和设置。
+// 没有项目配置或没有匹配的规则时返回空的设置；项目配置无效时返回错误
+func ProfileFor(path string) (string, RenderProfile, error) {
+	project, err := FindProject(path)
+	if err != nil || project == nil {
+		return "", RenderProfile{}, err
+	}
+	name, profile, _ := project.Profile(path)
+	return name, profile, nil
+}
+
+// RedactionFor 返回文件path（绝对路径）所在项目的脱敏规则，没有项目配置或没有设置规则时为空；项目配置无效时返回错误
+func RedactionFor(path string) ([]RedactionRule, error) {
+	project, err := FindProject(path)
+	if err != nil || project == nil {
+		return nil, err
+	}
+	return project.Redaction, nil
+}
+
+// WatermarkFor 返回文件path（绝对路径）所在项目设置的水印，没有项目配置或没有设置水印时为nil；项目配置无效时返回错误
+func WatermarkFor(path string) (*Watermark, error) {
+	project, err := FindProject(path)
+	if err != nil || project == nil {
+		return nil, err
+	}
+	return project.Watermark, nil
+}
+
+// PublishFor 返回文件path（绝对路径）所在项目设置的发布目标，没有项目配置或没有设置发布目标时为nil；项目配置无效时返回错误
+func PublishFor(path string) (*Publish, error) {
+	project, err := FindProject(path)
+	if err != nil || project == nil {
+		return nil, err
+	}
+	return project.Publish, nil
+}
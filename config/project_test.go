@@ -0,0 +1,112 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeProject 在dir中写入项目配置
+func writeProject(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ProjectFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfileFor(t *testing.T) {
+	dir := t.TempDir()
+	writeProject(t, dir, `{
+  "profiles": {
+    "print": {"format": "pdf", "scale": 2, "theme": "plain", "defines": {"ENV": "prod"}, "security": "sandbox"},
+    "draft": {}
+  },
+  "files": [
+    {"pattern": "docs/print/*.puml", "profile": "print"},
+    {"pattern": "*-draft.puml", "profile": "draft"},
+    {"pattern": "docs/*/*.puml", "profile": "draft"}
+  ]
+}`)
+
+	tests := []struct {
+		path, want string
+	}{
+		{"docs/print/login.puml", "print"},
+		{"src/deep/order-draft.puml", "draft"},
+		{"docs/api/order.puml", "draft"},
+		{"docs/login.puml", ""},
+	}
+	for _, tt := range tests {
+		name, profile, err := ProfileFor(filepath.Join(dir, tt.path))
+		if err != nil {
+			t.Fatalf("ProfileFor(%s): %v", tt.path, err)
+		}
+		if name != tt.want {
+			t.Errorf("ProfileFor(%s) = %q，应为 %q", tt.path, name, tt.want)
+		}
+		if name == "print" && (profile.Theme != "plain" || profile.ScaleFactor() != 2 || profile.Defines["ENV"] != "prod") {
+			t.Errorf("渲染配置不正确: %+v", profile)
+		}
+		if name == "" && profile.ScaleFactor() != 1 {
+			t.Errorf("没有渲染配置时比例应为1，得到 %v", profile.ScaleFactor())
+		}
+	}
+
+	// 子目录中的项目配置优先
+	writeProject(t, filepath.Join(dir, "docs", "print"), `{"profiles": {}, "files": []}`)
+	if name, _, err := ProfileFor(filepath.Join(dir, "docs", "print", "login.puml")); err != nil || name != "" {
+		t.Errorf("应使用最近的项目配置，得到 %q，%v", name, err)
+	}
+}
+
+func TestProfileForWithoutProject(t *testing.T) {
+	name, profile, err := ProfileFor(filepath.Join(t.TempDir(), "a.puml"))
+	if err != nil || name != "" || profile.ScaleFactor() != 1 {
+		t.Errorf("没有项目配置时应返回空的设置，得到 %q，%+v，%v", name, profile, err)
+	}
+}
+
+func TestRedactionFor(t *testing.T) {
+	dir := t.TempDir()
+	writeProject(t, dir, `{"redaction": [{"pattern": "\\d+\\.\\d+\\.\\d+\\.\\d+", "replace": "x.x.x.x"}]}`)
+	rules, err := RedactionFor(filepath.Join(dir, "docs", "net.puml"))
+	if err != nil || len(rules) != 1 || rules[0].Replace != "x.x.x.x" {
+		t.Fatalf("RedactionFor = %+v，%v", rules, err)
+	}
+	if rules, err := RedactionFor(filepath.Join(t.TempDir(), "a.puml")); err != nil || len(rules) != 0 {
+		t.Errorf("没有项目配置时应没有脱敏规则，得到 %+v，%v", rules, err)
+	}
+}
+
+func TestLoadProjectInvalid(t *testing.T) {
+	tests := []struct {
+		content, want string
+	}{
+		{`{"profiles": {"a": {"format": "gif"}}}`, "格式 gif"},
+		{`{"profiles": {"a": {"security": "open"}}}`, "安全配置 open"},
+		{`{"profiles": {"a": {"charset": "EBCDIC"}}}`, "字符编码 EBCDIC"},
+		{`{"profiles": {"a": {"args": ["-Playout=smetana", "-o", "/tmp"]}}}`, "不允许的PlantUML参数 -o"},
+		{`{"profiles": {"a": {"postProcess": ["pngquant", " "]}}}`, "postProcess中有空的名称"},
+		{`{"profiles": {}, "files": [{"pattern": "*.puml", "profile": "missing"}]}`, "missing 不存在"},
+		{`{"profiles": {"a": {}}, "files": [{"pattern": "[", "profile": "a"}]}`, "无效的匹配模式"},
+		{`{"redaction": [{"pattern": "(db", "replace": "host"}]}`, "无效的脱敏规则 (db"},
+		{`{"redaction": [{"replace": "host"}]}`, "pattern不能为空"},
+		{`{"watermark": {"text": "DRAFT", "position": "middle"}}`, "水印位置 middle"},
+		{`{"watermark": {"text": "DRAFT", "color": "red"}}`, "水印颜色 red"},
+		{`{"publish": {"url": "ftp://wiki.example.com"}}`, "发布目标的地址 ftp://wiki.example.com"},
+		{`{"publish": {"type": "confluence", "url": "https://wiki.example.com"}}`, "pageId"},
+		{`{`, "格式错误"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeProject(t, dir, tt.content)
+		if _, err := LoadProject(dir); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("LoadProject(%s) 的错误应包含 %q，得到 %v", tt.content, tt.want, err)
+		}
+	}
+}
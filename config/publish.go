@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 导出后发布的目标类型
+const (
+	PublishWebhook    = "webhook"
+	PublishConfluence = "confluence"
+)
+
+// PublishTypes 是所有发布目标的类型，第一个是默认值
+var PublishTypes = []string{PublishWebhook, PublishConfluence}
+
+// Publish 是导出后把图像上传到的位置：Confluence页面的附件，或者以multipart表单接收文件的webhook，
+// 让文档中的图表随导出自动更新
+type Publish struct {
+	Type string `json:"type,omitempty"` // 见PublishTypes，为空时为webhook
+	// URL 是webhook的地址，或者Confluence的根地址，例如 https://wiki.example.com（Confluence Cloud为 https://example.atlassian.net/wiki）
+	URL    string `json:"url"`
+	PageID string `json:"pageId,omitempty"` // 上传附件的Confluence页面ID，只用于confluence
+	User   string `json:"user,omitempty"`   // Confluence Cloud的用户（邮箱），与令牌一起用于Basic认证；为空时以Bearer方式发送令牌
+	// TokenEnv 是保存访问令牌的环境变量名，令牌不写在配置文件中；为空时不发送认证信息
+	TokenEnv string `json:"tokenEnv,omitempty"`
+	Source   bool   `json:"source,omitempty"` // 是否同时上传源文件
+}
+
+// EffectiveType 返回发布目标的类型，没有设置时为webhook
+func (p Publish) EffectiveType() string {
+	if p.Type == "" {
+		return PublishWebhook
+	}
+	return p.Type
+}
+
+// Token 返回TokenEnv指定的环境变量中的访问令牌，没有设置时为空
+func (p Publish) Token() string {
+	if p.TokenEnv == "" {
+		return ""
+	}
+	return os.Getenv(p.TokenEnv)
+}
+
+// Validate 检查发布目标的类型、地址和Confluence页面ID
+func (p Publish) Validate() error {
+	valid := false
+	for _, t := range PublishTypes {
+		valid = valid || p.EffectiveType() == t
+	}
+	if !valid {
+		return fmt.Errorf("发布目标的类型 %s 无效（可选: %s）", p.Type, strings.Join(PublishTypes, ", "))
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("发布目标的地址 %s 无效，应为http或https地址", p.URL)
+	}
+	if p.EffectiveType() == PublishConfluence {
+		if p.PageID == "" || strings.Trim(p.PageID, "0123456789") != "" {
+			return fmt.Errorf("发布到Confluence需要设置pageId（页面ID，只包含数字）")
+		}
+	}
+	return nil
+}
+
+// BucketUpload 是守护模式中上传更新的导出结果的对象存储位置，通过本机的aws或gcloud命令上传，
+// 使用这些命令已经配置好的凭据。对象名按Key模板生成，同一个图表每次更新都上传到同一个地址
+type BucketUpload struct {
+	URL string `json:"url"` // s3://bucket/前缀 或 gs://bucket/前缀，前缀可以省略
+	// Key 是对象名的模板，接在URL后面：{path}是导出文件相对于导出目录的路径，{dir}是其中的目录部分，
+	// {name}是文件名，{stem}是不带扩展名的文件名，{ext}是不带点的扩展名。为空时为{path}
+	Key          string `json:"key,omitempty"`
+	CacheControl string `json:"cacheControl,omitempty"` // 对象的Cache-Control，例如 max-age=60，为空时使用存储服务的默认值
+}
+
+// bucketKeyPlaceholder 匹配对象名模板中的占位符
+var bucketKeyPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// bucketKeyFields 是对象名模板中可以使用的占位符
+var bucketKeyFields = []string{"{path}", "{dir}", "{name}", "{stem}", "{ext}"}
+
+// Scheme 返回对象存储的类型：s3或gs
+func (u BucketUpload) Scheme() string {
+	if i := strings.Index(u.URL, "://"); i > 0 {
+		return u.URL[:i]
+	}
+	return ""
+}
+
+// Validate 检查对象存储的地址和对象名模板
+func (u BucketUpload) Validate() error {
+	parsed, err := url.Parse(u.URL)
+	if err != nil || (parsed.Scheme != "s3" && parsed.Scheme != "gs") || parsed.Host == "" {
+		return fmt.Errorf("上传地址 %s 无效，应为 s3://bucket/前缀 或 gs://bucket/前缀", u.URL)
+	}
+	for _, field := range bucketKeyPlaceholder.FindAllString(u.Key, -1) {
+		known := false
+		for _, f := range bucketKeyFields {
+			known = known || field == f
+		}
+		if !known {
+			return fmt.Errorf("对象名模板 %s 中的 %s 无效（可选: %s）", u.Key, field, strings.Join(bucketKeyFields, " "))
+		}
+	}
+	return nil
+}
+
+// ObjectURL 返回导出文件rel（相对于导出目录的路径）上传到的对象地址，例如 s3://bucket/diagrams/docs/flow.png
+func (u BucketUpload) ObjectURL(rel string) string {
+	rel = filepath.ToSlash(rel)
+	dir, name := path.Split(rel)
+	ext := path.Ext(name)
+	key := u.Key
+	if key == "" {
+		key = "{path}"
+	}
+	key = strings.NewReplacer(
+		"{path}", rel,
+		"{dir}", strings.TrimSuffix(dir, "/"),
+		"{name}", name,
+		"{stem}", strings.TrimSuffix(name, ext),
+		"{ext}", strings.TrimPrefix(ext, "."),
+	).Replace(key)
+	// {dir}为空时不留下多余的/
+	key = strings.Trim(path.Clean("/"+key), "/")
+	return strings.TrimRight(u.URL, "/") + "/" + key
+}
@@ -0,0 +1,66 @@
+package config
+
+import "testing"
+
+func TestPublish(t *testing.T) {
+	p := Publish{URL: "https://hooks.example.com/diagrams"}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("只设置地址的webhook应有效: %v", err)
+	}
+	if p.EffectiveType() != PublishWebhook {
+		t.Errorf("默认类型应为webhook，得到 %s", p.EffectiveType())
+	}
+	t.Setenv("PLANTUML_PUBLISH_TOKEN", "secret")
+	if got := (Publish{TokenEnv: "PLANTUML_PUBLISH_TOKEN"}).Token(); got != "secret" {
+		t.Errorf("Token = %q", got)
+	}
+
+	invalid := []Publish{
+		{},
+		{URL: "wiki.example.com"},
+		{Type: "ftp", URL: "https://example.com"},
+		{Type: PublishConfluence, URL: "https://wiki.example.com"},
+		{Type: PublishConfluence, URL: "https://wiki.example.com", PageID: "Home"},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%+v 应无效", p)
+		}
+	}
+}
+
+func TestBucketUpload(t *testing.T) {
+	tests := []struct {
+		upload BucketUpload
+		rel    string
+		want   string
+	}{
+		{BucketUpload{URL: "s3://docs-bucket"}, "api/flow.png", "s3://docs-bucket/api/flow.png"},
+		{BucketUpload{URL: "gs://docs-bucket/diagrams/"}, "flow.svg", "gs://docs-bucket/diagrams/flow.svg"},
+		{BucketUpload{URL: "s3://docs-bucket/latest", Key: "{ext}/{dir}/{stem}-latest.{ext}"}, "api/flow.png", "s3://docs-bucket/latest/png/api/flow-latest.png"},
+		{BucketUpload{URL: "s3://docs-bucket", Key: "{dir}/{name}"}, "flow.png", "s3://docs-bucket/flow.png"},
+	}
+	for _, tt := range tests {
+		if err := tt.upload.Validate(); err != nil {
+			t.Errorf("%+v 应有效: %v", tt.upload, err)
+		}
+		if got := tt.upload.ObjectURL(tt.rel); got != tt.want {
+			t.Errorf("%+v.ObjectURL(%q) = %q，应为 %q", tt.upload, tt.rel, got, tt.want)
+		}
+	}
+	if got := (BucketUpload{URL: "gs://b"}).Scheme(); got != "gs" {
+		t.Errorf("Scheme = %q", got)
+	}
+
+	invalid := []BucketUpload{
+		{},
+		{URL: "https://docs-bucket.s3.amazonaws.com"},
+		{URL: "s3://"},
+		{URL: "s3://docs-bucket", Key: "{branch}/{path}"},
+	}
+	for _, u := range invalid {
+		if err := u.Validate(); err == nil {
+			t.Errorf("%+v 应无效", u)
+		}
+	}
+}
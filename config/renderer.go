@@ -0,0 +1,68 @@
+package config
+
+import "time"
+
+// 查看时使用的渲染器
+const (
+	RendererDefault = ""        // 按pipeRenderers和krokiURL选择，都没有设置时与auto相同
+	RendererAuto    = "auto"    // 每次渲染启动新的PlantUML，优先使用plantuml.jar，找不到时使用plantuml命令行工具
+	RendererJar     = "jar"     // 每次渲染用java启动plantuml.jar
+	RendererCommand = "command" // 每次渲染启动PATH中的plantuml命令行工具
+	RendererPipe    = "pipe"    // 常驻的 plantuml -pipe 进程
+	RendererKroki   = "kroki"   // Kroki服务，不需要本地的Java和PlantUML
+)
+
+// Renderers 是所有可以选择的渲染器
+var Renderers = []string{RendererAuto, RendererJar, RendererCommand, RendererPipe, RendererKroki}
+
+// IsRenderer 判断是否为Renderers中的渲染器，空字符串表示按其他设置选择，也是有效的
+func IsRenderer(name string) bool {
+	if name == RendererDefault {
+		return true
+	}
+	for _, r := range Renderers {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveRenderer 返回查看时实际使用的渲染器：renderer为空时，设置了krokiURL使用Kroki，
+// pipeRenderers大于0使用常驻进程，否则为auto
+func (c *Config) EffectiveRenderer() string {
+	switch {
+	case c.Renderer != RendererDefault:
+		return c.Renderer
+	case c.KrokiURL != "":
+		return RendererKroki
+	case c.PipeRenderers > 0:
+		return RendererPipe
+	}
+	return RendererAuto
+}
+
+// DefaultRenderCacheMB 是渲染结果的磁盘缓存默认的最大大小（MB）
+const DefaultRenderCacheMB = 512
+
+// RenderCacheBytes 返回渲染结果的磁盘缓存最大的字节数，为0表示不缓存
+func (c *Config) RenderCacheBytes() int64 {
+	switch {
+	case c.RenderCacheMB < 0:
+		return 0
+	case c.RenderCacheMB == 0:
+		return DefaultRenderCacheMB << 20
+	}
+	return int64(c.RenderCacheMB) << 20
+}
+
+// DefaultRenderTimeout 是没有设置renderTimeout时查看时一次渲染最长的时间
+const DefaultRenderTimeout = 2 * time.Minute
+
+// RenderTimeoutDuration 返回查看时一次渲染最长的时间，没有设置（或小于0）时为DefaultRenderTimeout
+func (c *Config) RenderTimeoutDuration() time.Duration {
+	if c.RenderTimeout <= 0 {
+		return DefaultRenderTimeout
+	}
+	return time.Duration(c.RenderTimeout * float64(time.Second))
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEffectiveRenderer(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{}, RendererAuto},
+		{Config{PipeRenderers: 2}, RendererPipe},
+		{Config{PipeRenderers: 2, KrokiURL: "https://kroki.example.com"}, RendererKroki},
+		{Config{Renderer: RendererCommand, PipeRenderers: 2}, RendererCommand},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.EffectiveRenderer(); got != tt.want {
+			t.Errorf("%+v: EffectiveRenderer = %q，应为 %q", tt.cfg, got, tt.want)
+		}
+	}
+	if !IsRenderer("") || !IsRenderer(RendererPipe) || IsRenderer("server") {
+		t.Error("IsRenderer 判断错误")
+	}
+}
+
+func TestRenderCacheBytes(t *testing.T) {
+	tests := []struct {
+		mb   int
+		want int64
+	}{
+		{0, DefaultRenderCacheMB << 20},
+		{64, 64 << 20},
+		{-1, 0},
+	}
+	for _, tt := range tests {
+		cfg := Config{RenderCacheMB: tt.mb}
+		if got := cfg.RenderCacheBytes(); got != tt.want {
+			t.Errorf("renderCacheMB为%d时 RenderCacheBytes = %d，应为 %d", tt.mb, got, tt.want)
+		}
+	}
+}
+
+func TestRenderTimeoutDuration(t *testing.T) {
+	tests := []struct {
+		seconds float64
+		want    time.Duration
+	}{
+		{0, DefaultRenderTimeout},
+		{-1, DefaultRenderTimeout},
+		{30, 30 * time.Second},
+		{1.5, 1500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		cfg := &Config{RenderTimeout: tt.seconds}
+		if got := cfg.RenderTimeoutDuration(); got != tt.want {
+			t.Errorf("renderTimeout为%g时 RenderTimeoutDuration = %v，应为 %v", tt.seconds, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TabStyle 是用户为文件的标签页设置的显示方式，只影响显示，不修改文件
+type TabStyle struct {
+	Title string `json:"title,omitempty"` // 自定义标题，为空时显示文件名
+	Color string `json:"color,omitempty"` // 颜色标记的名称，为空时不显示颜色
+	Group string `json:"group,omitempty"` // 所属分组的名称，为空时不属于任何分组
+}
+
+// Session 保存工作区中跨越多次运行的状态，例如各文件标签的自定义标题和颜色
+type Session struct {
+	Tabs      map[string]TabStyle `json:"tabs"`                       // 以文件的绝对路径为键
+	Collapsed map[string]bool     `json:"collapsedGroups,omitempty"`  // 在侧边栏中折叠的分组
+	Intervals map[string]int      `json:"refreshIntervals,omitempty"` // 定时刷新的间隔秒数，以文件的绝对路径为键
+	Charsets  map[string]string   `json:"charsets,omitempty"`         // 为文件指定的字符编码，以文件的绝对路径为键
+	Layouts   map[string]string   `json:"layouts,omitempty"`          // 为文件指定的布局引擎（smetana或elk），以文件的绝对路径为键
+	Args      map[string][]string `json:"args,omitempty"`             // 为文件指定的额外PlantUML参数，以文件的绝对路径为键
+	Flags     map[string][]string `json:"flags,omitempty"`            // 为文件打开的预处理开关（!ifdef的变量名），以文件的绝对路径为键
+	Formats   map[string]string   `json:"imageFormats,omitempty"`     // 为文件指定的查看时的图像格式（png或svg），以文件的绝对路径为键
+	Project   string              `json:"project,omitempty"`          // 项目模式监控的目录，为空时没有打开项目
+	Viewed    map[string]string   `json:"viewed,omitempty"`           // 项目中的文件上次看过时内容的摘要，以文件的绝对路径为键
+
+	path string // 保存位置，为空时只保存在内存中
+}
+
+// NewSession 创建只保存在内存中的空工作区状态
+func NewSession() *Session {
+	return &Session{Tabs: make(map[string]TabStyle), Collapsed: make(map[string]bool), Intervals: make(map[string]int), Charsets: make(map[string]string), Layouts: make(map[string]string), Args: make(map[string][]string), Flags: make(map[string][]string), Formats: make(map[string]string), Viewed: make(map[string]string)}
+}
+
+// SessionPath 返回工作区状态文件的路径，与配置文件放在同一目录
+func SessionPath() string {
+	return filepath.Join(Dir(), "session.json")
+}
+
+// LoadSession 读取path中的工作区状态，文件不存在时返回空状态。出错时仍返回可用的空状态，之后会保存到path
+func LoadSession(path string) (*Session, error) {
+	s := NewSession()
+	s.path = path
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("无法读取工作区状态: %v", err)
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		s = NewSession()
+		s.path = path
+		return s, fmt.Errorf("工作区状态格式错误: %v", err)
+	}
+	if s.Tabs == nil {
+		s.Tabs = make(map[string]TabStyle)
+	}
+	if s.Collapsed == nil {
+		s.Collapsed = make(map[string]bool)
+	}
+	if s.Intervals == nil {
+		s.Intervals = make(map[string]int)
+	}
+	if s.Charsets == nil {
+		s.Charsets = make(map[string]string)
+	}
+	if s.Layouts == nil {
+		s.Layouts = make(map[string]string)
+	}
+	if s.Args == nil {
+		s.Args = make(map[string][]string)
+	}
+	if s.Flags == nil {
+		s.Flags = make(map[string][]string)
+	}
+	if s.Formats == nil {
+		s.Formats = make(map[string]string)
+	}
+	if s.Viewed == nil {
+		s.Viewed = make(map[string]string)
+	}
+	return s, nil
+}
+
+// TabStyle 返回文件标签的显示方式，没有设置时返回零值
+func (s *Session) TabStyle(path string) TabStyle {
+	return s.Tabs[path]
+}
+
+// SetTabStyle 设置文件标签的显示方式并保存，零值表示恢复默认
+func (s *Session) SetTabStyle(path string, style TabStyle) error {
+	if style == (TabStyle{}) {
+		delete(s.Tabs, path)
+	} else {
+		s.Tabs[path] = style
+	}
+	return s.Save()
+}
+
+// GroupCollapsed 返回分组是否在侧边栏中折叠
+func (s *Session) GroupCollapsed(group string) bool {
+	return s.Collapsed[group]
+}
+
+// SetGroupCollapsed 设置分组是否折叠并保存
+func (s *Session) SetGroupCollapsed(group string, collapsed bool) error {
+	if collapsed {
+		s.Collapsed[group] = true
+	} else {
+		delete(s.Collapsed, group)
+	}
+	return s.Save()
+}
+
+// RefreshInterval 返回文件的定时刷新间隔，没有设置时返回0
+func (s *Session) RefreshInterval(path string) time.Duration {
+	return time.Duration(s.Intervals[path]) * time.Second
+}
+
+// SetRefreshInterval 设置文件的定时刷新间隔并保存，按秒保存，0表示不定时刷新
+func (s *Session) SetRefreshInterval(path string, interval time.Duration) error {
+	if seconds := int(interval / time.Second); seconds > 0 {
+		s.Intervals[path] = seconds
+	} else {
+		delete(s.Intervals, path)
+	}
+	return s.Save()
+}
+
+// Charset 返回为文件指定的字符编码，没有指定时返回空字符串，表示自动识别
+func (s *Session) Charset(path string) string {
+	return s.Charsets[path]
+}
+
+// SetCharset 为文件指定字符编码并保存，空字符串表示恢复自动识别
+func (s *Session) SetCharset(path, name string) error {
+	if name != "" {
+		s.Charsets[path] = name
+	} else {
+		delete(s.Charsets, path)
+	}
+	return s.Save()
+}
+
+// Layout 返回为文件指定的布局引擎，没有指定时返回空字符串，表示使用Graphviz
+func (s *Session) Layout(path string) string {
+	return s.Layouts[path]
+}
+
+// SetLayout 为文件指定布局引擎并保存，空字符串表示恢复为Graphviz
+func (s *Session) SetLayout(path, engine string) error {
+	if engine != "" {
+		s.Layouts[path] = engine
+	} else {
+		delete(s.Layouts, path)
+	}
+	return s.Save()
+}
+
+// FileArgs 返回为文件指定的额外PlantUML参数，没有指定时返回nil
+func (s *Session) FileArgs(path string) []string {
+	return s.Args[path]
+}
+
+// SetFileArgs 为文件指定额外的PlantUML参数并保存，为空时取消指定
+func (s *Session) SetFileArgs(path string, args []string) error {
+	if len(args) > 0 {
+		s.Args[path] = args
+	} else {
+		delete(s.Args, path)
+	}
+	return s.Save()
+}
+
+// FileFlags 返回为文件打开的预处理开关，没有打开时返回nil
+func (s *Session) FileFlags(path string) []string {
+	return s.Flags[path]
+}
+
+// SetFileFlags 为文件打开预处理开关并保存，为空时全部关闭
+func (s *Session) SetFileFlags(path string, flags []string) error {
+	if len(flags) > 0 {
+		s.Flags[path] = flags
+	} else {
+		delete(s.Flags, path)
+	}
+	return s.Save()
+}
+
+// ImageFormat 返回为文件指定的查看时的图像格式，没有指定时返回空字符串，表示跟随设置
+func (s *Session) ImageFormat(path string) string {
+	return s.Formats[path]
+}
+
+// SetImageFormat 为文件指定查看时的图像格式并保存，空字符串表示恢复为跟随设置
+func (s *Session) SetImageFormat(path, format string) error {
+	if format != "" {
+		s.Formats[path] = format
+	} else {
+		delete(s.Formats, path)
+	}
+	return s.Save()
+}
+
+// SetProject 设置项目模式监控的目录并保存，空字符串表示关闭项目。关闭项目时清除上次看过的记录
+func (s *Session) SetProject(root string) error {
+	s.Project = root
+	if root == "" {
+		s.Viewed = make(map[string]string)
+	}
+	return s.Save()
+}
+
+// ViewedDigest 返回项目中的文件上次看过时内容的摘要，没有看过时返回空字符串
+func (s *Session) ViewedDigest(path string) string {
+	return s.Viewed[path]
+}
+
+// SetViewed 记录文件上次看过时内容的摘要并保存，digests以文件的绝对路径为键，一次记录多个文件
+func (s *Session) SetViewed(digests map[string]string) error {
+	for path, digest := range digests {
+		s.Viewed[path] = digest
+	}
+	return s.Save()
+}
+
+// Save 将工作区状态写入文件，只保存在内存中时不做任何事
+func (s *Session) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("无法创建配置目录: %v", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法序列化工作区状态: %v", err)
+	}
+
+	if err := ioutil.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("无法写入工作区状态: %v", err)
+	}
+	return nil
+}
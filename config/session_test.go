@@ -0,0 +1,117 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "session.json")
+
+	s, err := LoadSession(path)
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	if got := s.TabStyle("/a.puml"); got != (TabStyle{}) {
+		t.Fatalf("新的工作区状态应为空，得到 %+v", got)
+	}
+
+	style := TabStyle{Title: "登录流程", Color: "blue", Group: "billing"}
+	if err := s.SetTabStyle("/a.puml", style); err != nil {
+		t.Fatalf("SetTabStyle: %v", err)
+	}
+	if err := s.SetTabStyle("/b.puml", TabStyle{Color: "red"}); err != nil {
+		t.Fatalf("SetTabStyle: %v", err)
+	}
+	// 恢复默认时删除记录
+	if err := s.SetTabStyle("/b.puml", TabStyle{}); err != nil {
+		t.Fatalf("SetTabStyle: %v", err)
+	}
+	if err := s.SetGroupCollapsed("billing", true); err != nil {
+		t.Fatalf("SetGroupCollapsed: %v", err)
+	}
+	if err := s.SetRefreshInterval("/a.puml", time.Minute); err != nil {
+		t.Fatalf("SetRefreshInterval: %v", err)
+	}
+	if err := s.SetRefreshInterval("/b.puml", 0); err != nil {
+		t.Fatalf("SetRefreshInterval: %v", err)
+	}
+	if err := s.SetCharset("/a.puml", "GBK"); err != nil {
+		t.Fatalf("SetCharset: %v", err)
+	}
+	if err := s.SetLayout("/b.puml", "smetana"); err != nil {
+		t.Fatalf("SetLayout: %v", err)
+	}
+	if err := s.SetFileFlags("/b.puml", []string{"DETAIL"}); err != nil {
+		t.Fatalf("SetFileFlags: %v", err)
+	}
+	if err := s.SetImageFormat("/a.puml", "svg"); err != nil {
+		t.Fatalf("SetImageFormat: %v", err)
+	}
+	if err := s.SetProject("/repo"); err != nil {
+		t.Fatalf("SetProject: %v", err)
+	}
+	if err := s.SetViewed(map[string]string{"/repo/a.puml": "abc"}); err != nil {
+		t.Fatalf("SetViewed: %v", err)
+	}
+
+	loaded, err := LoadSession(path)
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	if got := loaded.TabStyle("/a.puml"); got != style {
+		t.Errorf("TabStyle(/a.puml) = %+v，应为 %+v", got, style)
+	}
+	if _, ok := loaded.Tabs["/b.puml"]; ok || len(loaded.Tabs) != 1 {
+		t.Errorf("恢复默认的标签不应保存，得到 %+v", loaded.Tabs)
+	}
+	if !loaded.GroupCollapsed("billing") || loaded.GroupCollapsed("frontend") {
+		t.Errorf("分组的折叠状态不正确: %+v", loaded.Collapsed)
+	}
+	if got := loaded.RefreshInterval("/a.puml"); got != time.Minute || len(loaded.Intervals) != 1 {
+		t.Errorf("定时刷新间隔不正确: %v，%+v", got, loaded.Intervals)
+	}
+	if loaded.Charset("/a.puml") != "GBK" || loaded.Charset("/b.puml") != "" {
+		t.Errorf("字符编码不正确: %+v", loaded.Charsets)
+	}
+	if loaded.Layout("/b.puml") != "smetana" || loaded.Layout("/a.puml") != "" {
+		t.Errorf("布局引擎不正确: %+v", loaded.Layouts)
+	}
+	if got := loaded.FileFlags("/b.puml"); len(got) != 1 || got[0] != "DETAIL" || len(loaded.FileFlags("/a.puml")) != 0 {
+		t.Errorf("预处理开关不正确: %+v", loaded.Flags)
+	}
+	if loaded.ImageFormat("/a.puml") != "svg" || loaded.ImageFormat("/b.puml") != "" {
+		t.Errorf("图像格式不正确: %+v", loaded.Formats)
+	}
+	if loaded.Project != "/repo" || loaded.ViewedDigest("/repo/a.puml") != "abc" || loaded.ViewedDigest("/repo/b.puml") != "" {
+		t.Errorf("项目模式的状态不正确: %q，%+v", loaded.Project, loaded.Viewed)
+	}
+	// 关闭项目时清除看过的记录
+	if err := loaded.SetProject(""); err != nil || len(loaded.Viewed) != 0 {
+		t.Errorf("关闭项目后应清除看过的记录: %v，%+v", err, loaded.Viewed)
+	}
+}
+
+func TestLoadSessionInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := LoadSession(path)
+	if err == nil {
+		t.Error("格式错误时应返回错误")
+	}
+	if s == nil || len(s.Tabs) != 0 {
+		t.Fatalf("格式错误时应返回空状态，得到 %+v", s)
+	}
+	// 仍可以设置并覆盖损坏的文件
+	if err := s.SetTabStyle("/a.puml", TabStyle{Color: "green"}); err != nil {
+		t.Fatalf("SetTabStyle: %v", err)
+	}
+	if _, err := LoadSession(path); err != nil {
+		t.Errorf("覆盖后应能正常读取: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 水印在导出图像中的位置
+const (
+	WatermarkBottomRight = "bottom-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkTopLeft     = "top-left"
+	WatermarkCenter      = "center"
+)
+
+// WatermarkPositions 是所有可以选择的水印位置，第一个是默认值
+var WatermarkPositions = []string{WatermarkBottomRight, WatermarkBottomLeft, WatermarkTopRight, WatermarkTopLeft, WatermarkCenter}
+
+// DefaultWatermarkOpacity 是没有设置不透明度时水印的不透明度
+const DefaultWatermarkOpacity = 0.4
+
+// Watermark 是导出时叠加在图像上的水印，例如“CONFIDENTIAL – Draft {date} {sha}”，只影响导出的文件，不修改源码
+type Watermark struct {
+	// Text 是水印的文字，{date}替换为导出的日期，{sha}替换为文件所在git仓库当前提交的短哈希，{file}替换为文件名
+	Text     string  `json:"text"`
+	Position string  `json:"position,omitempty"` // 见WatermarkPositions，为空时为右下角
+	Opacity  float64 `json:"opacity,omitempty"`  // 0到1之间，为0时为DefaultWatermarkOpacity
+	Color    string  `json:"color,omitempty"`    // #RRGGBB格式的颜色，为空时为灰色
+	FontFile string  `json:"fontFile,omitempty"` // TrueType或OpenType字体文件，内置字体不能显示中日韩文字时指定，为空时使用内置字体
+}
+
+// EffectivePosition 返回水印的位置，没有设置时为右下角
+func (w Watermark) EffectivePosition() string {
+	if w.Position == "" {
+		return WatermarkBottomRight
+	}
+	return w.Position
+}
+
+// EffectiveOpacity 返回水印的不透明度，没有设置时为DefaultWatermarkOpacity
+func (w Watermark) EffectiveOpacity() float64 {
+	if w.Opacity <= 0 {
+		return DefaultWatermarkOpacity
+	}
+	return w.Opacity
+}
+
+// RGB 返回水印的颜色，没有设置时为灰色
+func (w Watermark) RGB() (r, g, b uint8, err error) {
+	if w.Color == "" {
+		return 0x80, 0x80, 0x80, nil
+	}
+	hex := strings.TrimPrefix(w.Color, "#")
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return 0, 0, 0, fmt.Errorf("水印颜色 %s 无效，应为 #RRGGBB 格式", w.Color)
+	}
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), nil
+}
+
+// Validate 检查水印的位置、不透明度和颜色
+func (w Watermark) Validate() error {
+	if strings.TrimSpace(w.Text) == "" {
+		return fmt.Errorf("水印的text不能为空")
+	}
+	if !isWatermarkPosition(w.EffectivePosition()) {
+		return fmt.Errorf("水印位置 %s 无效（可选: %s）", w.Position, strings.Join(WatermarkPositions, ", "))
+	}
+	if w.Opacity < 0 || w.Opacity > 1 {
+		return fmt.Errorf("水印的不透明度 %g 应在0到1之间", w.Opacity)
+	}
+	_, _, _, err := w.RGB()
+	return err
+}
+
+// isWatermarkPosition 判断是否为WatermarkPositions中的位置
+func isWatermarkPosition(position string) bool {
+	for _, p := range WatermarkPositions {
+		if p == position {
+			return true
+		}
+	}
+	return false
+}
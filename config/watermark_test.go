@@ -0,0 +1,28 @@
+package config
+
+import "testing"
+
+func TestWatermark(t *testing.T) {
+	w := Watermark{Text: "CONFIDENTIAL"}
+	if err := w.Validate(); err != nil {
+		t.Fatalf("只设置文字的水印应有效: %v", err)
+	}
+	if w.EffectivePosition() != WatermarkBottomRight || w.EffectiveOpacity() != DefaultWatermarkOpacity {
+		t.Errorf("默认位置和不透明度不正确: %s, %g", w.EffectivePosition(), w.EffectiveOpacity())
+	}
+	if r, g, b, err := (Watermark{Color: "#C00010"}).RGB(); err != nil || r != 0xC0 || g != 0 || b != 0x10 {
+		t.Errorf("RGB = %d %d %d, %v", r, g, b, err)
+	}
+
+	invalid := []Watermark{
+		{},
+		{Text: "DRAFT", Position: "middle"},
+		{Text: "DRAFT", Opacity: 1.5},
+		{Text: "DRAFT", Color: "#12345"},
+	}
+	for _, w := range invalid {
+		if err := w.Validate(); err == nil {
+			t.Errorf("%+v 应无效", w)
+		}
+	}
+}
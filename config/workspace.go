@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// 其他实例发来的文件按工作区分开的方式，工作区是包含项目配置或git仓库的目录
+const (
+	WorkspacesOff    = ""       // 不按工作区分开，都在主窗口的同一个标签栏中打开
+	WorkspacesGroup  = "group"  // 加入以工作区目录命名的标签分组
+	WorkspacesWindow = "window" // 每个工作区在自己的窗口中打开
+)
+
+// WorkspaceModes 是所有按工作区分开的方式
+var WorkspaceModes = []string{WorkspacesOff, WorkspacesGroup, WorkspacesWindow}
+
+// workspaceMarkers 是标记工作区根目录的文件：项目配置或git仓库（子模块和工作树中.git是文件）
+var workspaceMarkers = []string{ProjectFile, ".git"}
+
+// WorkspaceRoot 从path所在目录开始向上查找最近的工作区根目录，即包含项目配置或.git的目录，找不到时返回空字符串
+func WorkspaceRoot(path string) string {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		for _, marker := range workspaceMarkers {
+			if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+				return dir
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return ""
+		}
+	}
+}
+
+// WorkspaceName 返回工作区的显示名称，即根目录的名称
+func WorkspaceName(root string) string {
+	return filepath.Base(root)
+}
+
+// IsWorkspaceMode 判断是否为WorkspaceModes中的方式
+func IsWorkspaceMode(mode string) bool {
+	for _, m := range WorkspaceModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
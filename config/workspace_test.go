@@ -0,0 +1,41 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspaceRoot(t *testing.T) {
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	service := filepath.Join(repo, "services", "billing")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(service, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(service, ProjectFile), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join(repo, "docs", "overview.puml"), repo},
+		// 最近的项目配置优先于外层的git仓库
+		{filepath.Join(service, "docs", "login.puml"), service},
+		{filepath.Join(dir, "loose.puml"), ""},
+	}
+	for _, tt := range tests {
+		if got := WorkspaceRoot(tt.path); got != tt.want {
+			t.Errorf("WorkspaceRoot(%s) = %q，应为 %q", tt.path, got, tt.want)
+		}
+	}
+	if got := WorkspaceName(service); got != "billing" {
+		t.Errorf("WorkspaceName = %q", got)
+	}
+}
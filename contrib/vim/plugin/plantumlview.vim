@@ -0,0 +1,50 @@
+" PlantUML Viewer 的 Vim/Neovim 集成
+"
+"   :PlantUMLView         在查看器中预览当前缓冲区（不需要保存），不抢走编辑器的焦点
+"   :PlantUMLViewLive     切换实时预览：停止输入或离开插入模式时自动更新
+"   :PlantUMLElement      显示光标所在行对应的图表元素
+"
+" 查看器程序默认为PATH中的 plantumlviewer，可以通过 g:plantumlview_command 修改
+
+if exists('g:loaded_plantumlview')
+  finish
+endif
+let g:loaded_plantumlview = 1
+
+let g:plantumlview_command = get(g:, 'plantumlview_command', 'plantumlviewer')
+
+function! s:Run(args) abort
+  let l:cmd = shellescape(g:plantumlview_command) . ' ' . a:args . ' -stdin-name ' . shellescape(expand('%:p'))
+  return system(l:cmd, getline(1, '$'))
+endfunction
+
+function! s:View() abort
+  call s:Run('-background')
+endfunction
+
+function! s:Element() abort
+  let l:output = s:Run('-element-at ' . line('.'))
+  let l:result = json_decode(l:output)
+  if has_key(l:result, 'id')
+    echo l:result.kind . ' ' . l:result.name . '（第' . l:result.declared . '行声明）'
+  else
+    echo '第' . line('.') . '行没有已声明的元素'
+  endif
+endfunction
+
+function! s:ToggleLive() abort
+  if exists('#plantumlview_live#TextChanged#<buffer>')
+    autocmd! plantumlview_live * <buffer>
+    echo 'PlantUML实时预览已关闭'
+    return
+  endif
+  augroup plantumlview_live
+    autocmd TextChanged,InsertLeave <buffer> call s:View()
+  augroup END
+  call s:View()
+  echo 'PlantUML实时预览已开启'
+endfunction
+
+command! PlantUMLView call s:View()
+command! PlantUMLViewLive call s:ToggleLive()
+command! PlantUMLElement call s:Element()
@@ -0,0 +1,269 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"plantumlmacviewer/config"
+)
+
+// AnimationFormats 是演变动画支持的格式：gif兼容性最好但只有256色，apng是保留完整颜色的动画PNG
+var AnimationFormats = []string{"gif", "apng"}
+
+// DefaultFrameDelay 是动画中每一帧默认显示的时间
+const DefaultFrameDelay = 1500 * time.Millisecond
+
+// Frame 是演变动画的一帧：某个版本渲染的图像和标出版本的标题
+type Frame struct {
+	Image image.Image
+	Label string // 只能使用ASCII字符
+}
+
+// Frames 按从早到晚的顺序渲染时间轴中的所有版本作为动画的帧，已经渲染过的版本使用缓存。
+// 文件不存在或渲染失败的版本跳过，没有任何一帧时返回错误
+func (t *Timeline) Frames() ([]Frame, error) {
+	var frames []Frame
+	var firstErr error
+	for i, rev := range t.Revisions {
+		data, err := t.Render(i)
+		if err == nil {
+			var img image.Image
+			if img, err = png.Decode(bytes.NewReader(data)); err == nil {
+				frames = append(frames, Frame{Image: img, Label: rev.Time.Format("2006-01-02") + " " + rev.Short})
+				continue
+			}
+		}
+		if errors.Is(err, ErrNotInRevision) {
+			continue
+		}
+		log.Printf("跳过无法渲染的版本 %s: %v", rev.Short, err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(frames) == 0 {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, fmt.Errorf("没有可以渲染的版本")
+	}
+	return frames, nil
+}
+
+// WriteAnimation 把时间轴中的所有版本按format（gif或apng）写成动画，每帧显示delay
+func (t *Timeline) WriteAnimation(w io.Writer, format string, delay time.Duration) error {
+	frames, err := t.Frames()
+	if err != nil {
+		return err
+	}
+	return WriteAnimation(w, frames, format, delay)
+}
+
+// WriteEvolution 渲染file在from到to之间的各个版本（见HistoryBetween），把演变动画按format写入out，
+// 用于在演示中展示设计是怎样一步步演变的。format为空时按out的扩展名选择：.gif为GIF，其他为APNG
+func WriteEvolution(file, from, to, out, format string, scale Scale, delay time.Duration) error {
+	if format == "" {
+		format = "apng"
+		if strings.EqualFold(filepath.Ext(out), ".gif") {
+			format = "gif"
+		}
+	}
+	if format != "gif" && format != "apng" {
+		return fmt.Errorf("不支持的动画格式: %s（支持: %s）", format, strings.Join(AnimationFormats, ", "))
+	}
+	revisions, err := HistoryBetween(file, from, to)
+	if err != nil {
+		return err
+	}
+	_, profile, err := config.ProfileFor(file)
+	if err != nil {
+		return err
+	}
+	frames, err := newTimeline(file, revisions, scale.DPI()*profile.ScaleFactor()).Frames()
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("无法创建动画: %v", err)
+	}
+	err = WriteAnimation(f, frames, format, delay)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("无法写入动画: %v", err)
+	}
+	return nil
+}
+
+// WriteAnimation 把frames按format（gif或apng）写成循环播放的动画，每帧显示delay（不大于0时为DefaultFrameDelay），
+// 最后一帧显示两倍的时间。各帧放在同样大小的画布中央，上方的标题栏标出版本
+func WriteAnimation(w io.Writer, frames []Frame, format string, delay time.Duration) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("动画中没有帧")
+	}
+	if delay <= 0 {
+		delay = DefaultFrameDelay
+	}
+	images := composeFrames(frames)
+	delays := make([]time.Duration, len(images))
+	for i := range delays {
+		delays[i] = delay
+	}
+	delays[len(delays)-1] = 2 * delay
+	switch format {
+	case "gif":
+		return writeGIF(w, images, delays)
+	case "apng":
+		return writeAPNG(w, images, delays)
+	}
+	return fmt.Errorf("不支持的动画格式: %s（支持: %s）", format, strings.Join(AnimationFormats, ", "))
+}
+
+// composeFrames 把各帧画在同样大小的白色画布中央，画布为最大的帧加上标题栏的大小
+func composeFrames(frames []Frame) []*image.RGBA {
+	var size image.Point
+	for _, f := range frames {
+		b := f.Image.Bounds().Size()
+		size.X = max(size.X, b.X)
+		size.Y = max(size.Y, b.Y)
+	}
+	images := make([]*image.RGBA, len(frames))
+	for i, f := range frames {
+		dst := image.NewRGBA(image.Rect(0, 0, size.X, diffLabelHeight+size.Y))
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(dst, image.Rect(0, 0, size.X, diffLabelHeight), image.NewUniform(diffGapColor), image.Point{}, draw.Src)
+		b := f.Image.Bounds()
+		at := image.Pt((size.X-b.Dx())/2, diffLabelHeight+(size.Y-b.Dy())/2)
+		draw.Draw(dst, image.Rectangle{Min: at, Max: at.Add(b.Size())}, f.Image, b.Min, draw.Over)
+		drawLabel(dst, diffPadding, f.Label)
+		images[i] = dst
+	}
+	return images
+}
+
+// writeGIF 写入循环播放的GIF，颜色按Plan 9调色板抖动
+func writeGIF(w io.Writer, images []*image.RGBA, delays []time.Duration) error {
+	anim := &gif.GIF{LoopCount: 0}
+	for i, img := range images {
+		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(frame, img.Bounds(), img, image.Point{})
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, int(delays[i]/(10*time.Millisecond)))
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// writeAPNG 写入循环播放的动画PNG：第一帧的IDAT是普通PNG的图像，不支持APNG的程序显示第一帧；
+// 之后各帧的图像数据放在fdAT中。所有帧大小相同，不需要处理透明的叠加
+func writeAPNG(w io.Writer, images []*image.RGBA, delays []time.Duration) error {
+	var header []byte
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	seq := uint32(0)
+	for i, img := range images {
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, img); err != nil {
+			return fmt.Errorf("无法编码第%d帧: %v", i+1, err)
+		}
+		chunks, err := pngChunks(encoded.Bytes())
+		if err != nil {
+			return err
+		}
+		var data [][]byte
+		for _, c := range chunks {
+			switch c.kind {
+			case "IHDR":
+				if header == nil {
+					header = c.data
+					writeChunk(&buf, "IHDR", header)
+					actl := make([]byte, 8)
+					binary.BigEndian.PutUint32(actl[0:], uint32(len(images)))
+					writeChunk(&buf, "acTL", actl) // 播放次数为0，表示无限循环
+				} else if !bytes.Equal(header, c.data) {
+					return fmt.Errorf("第%d帧的格式与第一帧不同", i+1)
+				}
+			case "IDAT":
+				data = append(data, c.data)
+			}
+		}
+
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(img.Bounds().Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(img.Bounds().Dy()))
+		// x和y偏移为0；延迟以毫秒表示，分母为1000；dispose和blend都为0
+		binary.BigEndian.PutUint16(fctl[20:], uint16(min(delays[i].Milliseconds(), 65535)))
+		binary.BigEndian.PutUint16(fctl[22:], 1000)
+		writeChunk(&buf, "fcTL", fctl)
+		seq++
+
+		for _, d := range data {
+			if i == 0 {
+				writeChunk(&buf, "IDAT", d)
+				continue
+			}
+			fdat := make([]byte, 4+len(d))
+			binary.BigEndian.PutUint32(fdat, seq)
+			copy(fdat[4:], d)
+			writeChunk(&buf, "fdAT", fdat)
+			seq++
+		}
+	}
+	writeChunk(&buf, "IEND", nil)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// pngChunk 是PNG文件中的一个数据块
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// pngChunks 拆分PNG文件中的数据块
+func pngChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("不是PNG图像")
+	}
+	data = data[len(pngSignature):]
+	var chunks []pngChunk
+	for len(data) >= 12 {
+		n := binary.BigEndian.Uint32(data)
+		if uint64(n)+12 > uint64(len(data)) {
+			return nil, fmt.Errorf("PNG数据块不完整")
+		}
+		chunks = append(chunks, pngChunk{kind: string(data[4:8]), data: data[8 : 8+n]})
+		data = data[12+n:]
+	}
+	return chunks, nil
+}
+
+// writeChunk 写入一个PNG数据块，包括长度和CRC
+func writeChunk(buf *bytes.Buffer, kind string, data []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+	buf.Write(n[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	buf.WriteString(kind)
+	buf.Write(data)
+	binary.BigEndian.PutUint32(n[:], crc.Sum32())
+	buf.Write(n[:])
+}
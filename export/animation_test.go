@@ -0,0 +1,77 @@
+package export
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestWriteAnimation(t *testing.T) {
+	frames := []Frame{
+		{Image: solidImage(100, 60, color.NRGBA{R: 255, A: 255}), Label: "2024-01-01 abc1234"},
+		{Image: solidImage(120, 80, color.NRGBA{B: 255, A: 255}), Label: "2024-02-01 def5678"},
+		{Image: solidImage(80, 40, color.NRGBA{G: 255, A: 255}), Label: "2024-03-01 0123abc"},
+	}
+	size := image.Pt(120, diffLabelHeight+80)
+
+	var buf bytes.Buffer
+	if err := WriteAnimation(&buf, frames, "gif", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 3 {
+		t.Fatalf("GIF应有3帧，得到%d帧", len(anim.Image))
+	}
+	if got := anim.Image[0].Bounds().Size(); got != size {
+		t.Errorf("各帧应使用最大的帧加标题栏的大小 %v，得到 %v", size, got)
+	}
+	if anim.Delay[0] != 100 || anim.Delay[2] != 200 {
+		t.Errorf("帧延迟 = %v，最后一帧应显示两倍的时间", anim.Delay)
+	}
+
+	buf.Reset()
+	if err := WriteAnimation(&buf, frames, "apng", 0); err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := pngChunks(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, c := range chunks {
+		counts[c.kind]++
+	}
+	if counts["acTL"] != 1 || counts["fcTL"] != 3 || counts["fdAT"] < 2 || counts["IEND"] != 1 {
+		t.Errorf("APNG的数据块不正确: %v", counts)
+	}
+	// 不支持APNG的解码器显示第一帧
+	img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("APNG应能作为普通PNG解码: %v", err)
+	}
+	if got := img.Bounds().Size(); got != size {
+		t.Errorf("APNG的大小应为 %v，得到 %v", size, got)
+	}
+
+	if err := WriteAnimation(&buf, frames, "mp4", 0); err == nil {
+		t.Error("不支持的格式应返回错误")
+	}
+	if err := WriteAnimation(&buf, nil, "gif", 0); err == nil {
+		t.Error("没有帧时应返回错误")
+	}
+}
+
+// solidImage 返回w×h的纯色图像
+func solidImage(w, h int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/plantuml"
+)
+
+// CacheFile 是批量转换时记录源码摘要的缓存文件名，保存在输出目录中
+const CacheFile = render.CacheFile
+
+// Cache 记录输出目录中每个导出文件是由什么内容生成的，源码和导出设置都没有变化时可以跳过重新渲染
+type Cache = render.Cache
+
+// LoadCache 读取输出目录中的缓存，不存在或无法解析时返回空的缓存
+func LoadCache(outDir string) *Cache {
+	return render.LoadCache(outDir)
+}
+
+// Digest 返回按format和scale导出文件时的内容摘要，包括源码、导出设置、文件的渲染配置、水印、后处理、
+// 引用的本地图片和!include的文件，它们更新后缓存随之失效。源码或引用的文件是动态的（见render.Dynamic）时
+// 返回空字符串，这样的文件每次都要重新导出
+func Digest(file, format string, scale Scale) (string, error) {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("无法读取文件: %v", err)
+	}
+	if render.Dynamic(source) {
+		return "", nil
+	}
+	_, profile, err := config.ProfileFor(file)
+	if err != nil {
+		return "", err
+	}
+	settings, err := json.Marshal(profile)
+	if err != nil {
+		return "", fmt.Errorf("无法序列化渲染配置: %v", err)
+	}
+	parts := []string{format, strconv.FormatFloat(scale.Factor, 'g', -1, 64), string(settings)}
+	// 水印按展开后的文字比较，日期或提交变化后重新导出
+	watermark, text, err := watermarkFor(file)
+	if err != nil {
+		return "", err
+	}
+	if watermark != nil {
+		stamp, _ := json.Marshal(watermark)
+		parts = append(parts, string(stamp), text)
+	}
+	// 后处理按命令比较，设置中的命令变化后重新导出
+	processors, names, err := PostProcessorsFor(file)
+	if err != nil {
+		return "", err
+	}
+	for i, p := range processors {
+		parts = append(parts, names[i], fmt.Sprintf("%v", p))
+	}
+	for _, dependency := range plantuml.Dependencies(source, filepath.Dir(file)) {
+		// 文件不存在时为空内容的摘要，之后加上文件时缓存也会失效
+		data, _ := ioutil.ReadFile(dependency)
+		if render.Dynamic(data) {
+			return "", nil
+		}
+		parts = append(parts, dependency, render.Digest(data))
+	}
+	return render.Digest(source, parts...), nil
+}
@@ -0,0 +1,88 @@
+package export
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"plantumlmacviewer/config"
+)
+
+func TestDigest(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.puml")
+	if err := ioutil.WriteFile(source, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := Digest(source, "svg", Presets[0])
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	if again, _ := Digest(source, "svg", Presets[0]); again != digest {
+		t.Error("相同的内容和设置应得到相同的摘要")
+	}
+	if other, _ := Digest(source, "png", Presets[0]); other == digest {
+		t.Error("不同格式的摘要应不同")
+	}
+	if other, _ := Digest(source, "svg", Presets[1]); other == digest {
+		t.Error("不同比例的摘要应不同")
+	}
+
+	// 渲染配置变化时也需要重新导出
+	project := `{"profiles": {"dark": {"theme": "cyborg"}}, "files": [{"pattern": "*.puml", "profile": "dark"}]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, config.ProjectFile), []byte(project), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := Digest(source, "svg", Presets[0]); other == digest {
+		t.Error("渲染配置不同时摘要应不同")
+	}
+
+	// 引用的本地图片变化时也需要重新导出
+	if err := ioutil.WriteFile(source, []byte("@startuml\nA : <img:icon.png>\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	withoutIcon, _ := Digest(source, "svg", Presets[0])
+	if err := ioutil.WriteFile(filepath.Join(dir, "icon.png"), []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	withIcon, _ := Digest(source, "svg", Presets[0])
+	if withIcon == withoutIcon {
+		t.Error("加上引用的图片后摘要应不同")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "icon.png"), []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := Digest(source, "svg", Presets[0]); other == withIcon {
+		t.Error("引用的图片变化后摘要应不同")
+	}
+
+	// 引用的文件以及其中再引用的文件变化时也需要重新导出
+	if err := ioutil.WriteFile(source, []byte("@startuml\n!include common.iuml\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "common.iuml"), []byte("!include style.iuml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "style.iuml"), []byte("skinparam monochrome true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	included, _ := Digest(source, "svg", Presets[0])
+	if err := ioutil.WriteFile(filepath.Join(dir, "style.iuml"), []byte("skinparam monochrome false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := Digest(source, "svg", Presets[0]); other == included {
+		t.Error("引用的文件变化后摘要应不同")
+	}
+
+	// 动态的图表没有摘要，每次都重新导出
+	if err := ioutil.WriteFile(filepath.Join(dir, "style.iuml"), []byte("title %date()\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if digest, err := Digest(source, "svg", Presets[0]); err != nil || digest != "" {
+		t.Errorf("引用了动态内容的图表摘要应为空，得到 %q, %v", digest, err)
+	}
+
+	if _, err := Digest(filepath.Join(dir, "missing.puml"), "svg", Presets[0]); err == nil {
+		t.Error("文件不存在时应返回错误")
+	}
+}
@@ -0,0 +1,284 @@
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/plantuml"
+)
+
+// DiffFormats 是差异报告支持的格式：png为左右并排的图像，html为拖动滑块对比两个版本的网页
+var DiffFormats = []string{"png", "html"}
+
+// WorkingTree 表示工作区中的文件，而不是某个提交中的版本
+const WorkingTree = ""
+
+// ErrNotInRevision 表示文件在指定的版本中不存在，例如新增的图表
+var ErrNotInRevision = errors.New("文件在该版本中不存在")
+
+// 并排图像的版式（像素）
+const (
+	diffLabelHeight = 24 // 图像上方标出版本的标题栏高度
+	diffGap         = 16 // 两个版本之间的间隔
+	diffPadding     = 6  // 标题文字的左边距
+)
+
+// 并排图像的颜色：旧版本的标题栏为红色，新版本为绿色，与常见的代码差异一致
+var (
+	diffBeforeColor = color.NRGBA{R: 254, G: 226, B: 226, A: 255}
+	diffAfterColor  = color.NRGBA{R: 220, G: 252, B: 231, A: 255}
+	diffGapColor    = color.NRGBA{R: 229, G: 231, B: 235, A: 255}
+)
+
+// RevisionLabel 返回版本在报告中显示的名称
+func RevisionLabel(rev string) string {
+	if rev == WorkingTree {
+		return "working tree"
+	}
+	return rev
+}
+
+// ShowRevision 返回file在git版本rev中的内容，rev为WorkingTree时读取工作区中的文件。
+// 版本存在但其中没有该文件时返回ErrNotInRevision
+func ShowRevision(file, rev string) ([]byte, error) {
+	if rev == WorkingTree {
+		data, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			return nil, ErrNotInRevision
+		}
+		if err != nil {
+			return nil, fmt.Errorf("无法读取文件: %v", err)
+		}
+		return data, nil
+	}
+
+	dir, base := filepath.Split(file)
+	if _, err := git(dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}"); err != nil {
+		return nil, fmt.Errorf("找不到版本 %s: %v", rev, err)
+	}
+	// ./表示相对于当前目录的路径，不需要知道仓库的根目录
+	object := rev + ":./" + base
+	if _, err := git(dir, "cat-file", "-e", object); err != nil {
+		return nil, ErrNotInRevision
+	}
+	return git(dir, "show", object)
+}
+
+// git 在dir中执行git命令，返回标准输出；失败时返回的错误包含git的错误输出
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s", msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// RenderRevision 按比例渲染file在版本rev中的第一页，使用文件当前的渲染配置。
+// 文件在该版本中不存在时返回ErrNotInRevision
+func RenderRevision(file, rev string, scale Scale) (image.Image, error) {
+	source, err := ShowRevision(file, rev)
+	if err != nil {
+		return nil, err
+	}
+	_, profile, err := config.ProfileFor(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := plantuml.RenderSourceAs(source, file, scale.DPI()*profile.ScaleFactor())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", RevisionLabel(rev), err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("无法解码 %s 的图像: %v", RevisionLabel(rev), err)
+	}
+	return img, nil
+}
+
+// WriteDiff 渲染file在from和to两个版本中的第一页，把差异报告按format（png或html）写入out。
+// to为WorkingTree时与工作区中的文件比较；只在一个版本中存在的文件，另一侧显示为空白
+func WriteDiff(file, from, to, out, format string, scale Scale) error {
+	if format != "png" && format != "html" {
+		return fmt.Errorf("不支持的差异报告格式: %s（支持: %s）", format, strings.Join(DiffFormats, ", "))
+	}
+	before, err := RenderRevision(file, from, scale)
+	if err != nil && !errors.Is(err, ErrNotInRevision) {
+		return err
+	}
+	after, err := RenderRevision(file, to, scale)
+	if err != nil && !errors.Is(err, ErrNotInRevision) {
+		return err
+	}
+	if before == nil && after == nil {
+		return fmt.Errorf("%s 在 %s 和 %s 中都不存在", filepath.Base(file), RevisionLabel(from), RevisionLabel(to))
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("无法创建差异报告: %v", err)
+	}
+	if format == "png" {
+		err = png.Encode(f, SideBySide(before, after, RevisionLabel(from), RevisionLabel(to)))
+	} else {
+		err = writeDiffHTML(f, filepath.Base(file), before, after, RevisionLabel(from), RevisionLabel(to))
+	}
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("无法写入差异报告: %v", err)
+	}
+	return nil
+}
+
+// SideBySide 把before和after左右并排，上方的标题栏标出版本。为nil的一侧（文件在该版本中不存在）
+// 显示为与另一侧同样大小的空白，标题后加上 (missing)。标题只能使用ASCII字符
+func SideBySide(before, after image.Image, beforeLabel, afterLabel string) *image.RGBA {
+	beforeSize, afterSize := diffSize(before, after), diffSize(after, before)
+	width := beforeSize.X + diffGap + afterSize.X
+	height := diffLabelHeight + beforeSize.Y
+	if afterSize.Y > beforeSize.Y {
+		height = diffLabelHeight + afterSize.Y
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, image.Rect(beforeSize.X, 0, beforeSize.X+diffGap, height), image.NewUniform(diffGapColor), image.Point{}, draw.Src)
+
+	panels := []struct {
+		img   image.Image
+		label string
+		x     int
+		size  image.Point
+		bg    color.Color
+	}{
+		{before, beforeLabel, 0, beforeSize, diffBeforeColor},
+		{after, afterLabel, beforeSize.X + diffGap, afterSize, diffAfterColor},
+	}
+	for _, p := range panels {
+		draw.Draw(dst, image.Rect(p.x, 0, p.x+p.size.X, diffLabelHeight), image.NewUniform(p.bg), image.Point{}, draw.Src)
+		label := p.label
+		if p.img == nil {
+			label += " (missing)"
+		} else {
+			draw.Draw(dst, image.Rect(p.x, diffLabelHeight, p.x+p.size.X, diffLabelHeight+p.size.Y), p.img, p.img.Bounds().Min, draw.Src)
+		}
+		drawLabel(dst, p.x+diffPadding, label)
+	}
+	return dst
+}
+
+// diffSize 返回img在并排图像中占的大小，img为nil时使用other的大小
+func diffSize(img, other image.Image) image.Point {
+	if img == nil {
+		img = other
+	}
+	return img.Bounds().Size()
+}
+
+// drawLabel 在标题栏中x处绘制文字
+func drawLabel(dst *image.RGBA, x int, text string) {
+	face := basicfont.Face7x13
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.Black,
+		Face: face,
+		Dot:  fixed.P(x, (diffLabelHeight+face.Ascent-face.Descent)/2),
+	}
+	d.DrawString(text)
+}
+
+// diffPanel 是差异网页中一个版本的图像
+type diffPanel struct {
+	Label string
+	Image template.URL // data:地址，文件在该版本中不存在时为空
+}
+
+// writeDiffHTML 将差异网页写入w：两个版本的图像重叠显示，拖动滑块在两者之间切换，图像内嵌在网页中
+func writeDiffHTML(w io.Writer, name string, before, after image.Image, beforeLabel, afterLabel string) error {
+	panels := make([]diffPanel, 2)
+	for i, p := range []struct {
+		img   image.Image
+		label string
+	}{{before, beforeLabel}, {after, afterLabel}} {
+		panels[i].Label = p.label
+		if p.img == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, p.img); err != nil {
+			return fmt.Errorf("无法编码图像: %v", err)
+		}
+		panels[i].Image = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+	}
+	return diffTemplate.Execute(w, struct {
+		Name          string
+		Before, After diffPanel
+	}{name, panels[0], panels[1]})
+}
+
+// diffTemplate 是差异网页的模板，样式和脚本内嵌在页面中，可以直接作为CI的产物上传
+var diffTemplate = template.Must(template.New("diff").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}: {{.Before.Label}} → {{.After.Label}}</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", sans-serif; margin: 2em; color: #222; }
+.labels { display: flex; justify-content: space-between; max-width: 100%; }
+.before { color: #b91c1c; }
+.after { color: #15803d; }
+.compare { position: relative; display: inline-block; border: 1px solid #ddd; background: #fff; }
+.compare img { display: block; max-width: 100%; }
+.compare .top { position: absolute; top: 0; left: 0; clip-path: inset(0 50% 0 0); }
+.missing { padding: 4em; color: #888; }
+input[type=range] { width: 100%; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<div class="labels"><span class="before">← {{.Before.Label}}</span><span class="after">{{.After.Label}} →</span></div>
+<input id="slider" type="range" min="0" max="100" value="50" aria-label="在两个版本之间切换">
+<div class="compare">
+{{- if .After.Image}}
+<img src="{{.After.Image}}" alt="{{.After.Label}}">
+{{- else}}
+<div class="missing">{{.After.Label}} 中没有这个文件</div>
+{{- end}}
+{{- if .Before.Image}}
+<img class="top" id="before" src="{{.Before.Image}}" alt="{{.Before.Label}}">
+{{- else}}
+<div class="top missing" id="before">{{.Before.Label}} 中没有这个文件</div>
+{{- end}}
+</div>
+<script>
+var slider = document.getElementById("slider"), before = document.getElementById("before");
+slider.oninput = function () { before.style.clipPath = "inset(0 " + (100 - slider.value) + "% 0 0)"; };
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,112 @@
+package export
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShowRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("没有安装git")
+	}
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	file := filepath.Join(docs, "login.puml")
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", ".")
+	run("commit", "-q", "-m", "init")
+	writeFile(t, file, "@startuml\nA -> B\n@enduml\n")
+	run("add", ".")
+	run("commit", "-q", "-m", "add login")
+	writeFile(t, file, "@startuml\nA -> C\n@enduml\n")
+
+	if got, err := ShowRevision(file, "HEAD"); err != nil || !strings.Contains(string(got), "A -> B") {
+		t.Errorf("ShowRevision(HEAD) = %q, %v", got, err)
+	}
+	if got, err := ShowRevision(file, WorkingTree); err != nil || !strings.Contains(string(got), "A -> C") {
+		t.Errorf("ShowRevision(WorkingTree) = %q, %v", got, err)
+	}
+	if _, err := ShowRevision(file, "HEAD~1"); !errors.Is(err, ErrNotInRevision) {
+		t.Errorf("文件在版本中不存在时应返回ErrNotInRevision，得到 %v", err)
+	}
+	if _, err := ShowRevision(file, "no-such-branch"); err == nil || errors.Is(err, ErrNotInRevision) {
+		t.Errorf("版本不存在时应返回其他错误，得到 %v", err)
+	}
+}
+
+func TestSideBySide(t *testing.T) {
+	before := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	after := image.NewRGBA(image.Rect(0, 0, 120, 80))
+	img := SideBySide(before, after, "main", "HEAD")
+	if got, want := img.Bounds().Size(), image.Pt(100+diffGap+120, diffLabelHeight+80); got != want {
+		t.Errorf("并排图像的大小 = %v，应为 %v", got, want)
+	}
+	if got := img.At(1, 1); color.NRGBAModel.Convert(got) != diffBeforeColor {
+		t.Errorf("旧版本的标题栏颜色 = %v", got)
+	}
+	if got := img.At(100+diffGap+119, 1); color.NRGBAModel.Convert(got) != diffAfterColor {
+		t.Errorf("新版本的标题栏颜色 = %v", got)
+	}
+
+	// 新增的文件：旧版本一侧与新版本同样大小
+	img = SideBySide(nil, after, "main", "HEAD")
+	if got, want := img.Bounds().Size(), image.Pt(120+diffGap+120, diffLabelHeight+80); got != want {
+		t.Errorf("缺少一侧时并排图像的大小 = %v，应为 %v", got, want)
+	}
+}
+
+func TestWriteDiffHTML(t *testing.T) {
+	var buf strings.Builder
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	if err := writeDiffHTML(&buf, "login.puml", nil, img, "origin/main", "<working tree>"); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, want := range []string{
+		"<h1>login.puml</h1>",
+		"origin/main 中没有这个文件",
+		`<img src="data:image/png;base64,`,
+		`alt="&lt;working tree&gt;"`,
+		`type="range"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("差异网页中应包含 %q:\n%s", want, html)
+		}
+	}
+}
+
+func TestWriteDiffRejectsFormat(t *testing.T) {
+	err := WriteDiff("/tmp/a.puml", "HEAD", WorkingTree, filepath.Join(t.TempDir(), "diff.gif"), "gif", Scale{Factor: 1})
+	if err == nil || !strings.Contains(err.Error(), "不支持") {
+		t.Errorf("不支持的格式应返回错误，得到 %v", err)
+	}
+}
+
+// writeFile 创建path所在的目录并写入content
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
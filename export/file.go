@@ -0,0 +1,72 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+// WriteFile 将文件按format导出到outDir（为空时与源文件放在同一目录），文件名与源文件相同，返回生成的文件路径。
+// format为AutoFormat时使用文件的渲染配置中设置的格式。embedSource只对SVG有效，为true时在SVG中嵌入源码
+func WriteFile(file, format, outDir string, scale Scale, embedSource bool) (string, error) {
+	return writeExport(file, format, outDir, "", func(w io.Writer, format string) (int, error) {
+		if format == "svg" {
+			return 1, WriteSVG(w, file, embedSource)
+		}
+		return Write(w, file, format, scale)
+	})
+}
+
+// WriteRedactedFile 与WriteFile相同，但按所在项目的脱敏规则替换源码后再渲染（见WriteRedacted），
+// 文件名加上RedactedSuffix，例如 net-redacted.png
+func WriteRedactedFile(file, format, outDir string, scale Scale, embedSource bool) (string, error) {
+	return writeExport(file, format, outDir, RedactedSuffix, func(w io.Writer, format string) (int, error) {
+		pages, count, err := WriteRedacted(w, file, format, scale, embedSource)
+		if err == nil {
+			log.Printf("已脱敏 %s（替换%d处）", logging.Path(file), count)
+		}
+		return pages, err
+	})
+}
+
+// writeExport 创建outDir中与源文件同名、加上suffix的导出文件并调用write写入，按渲染配置做后处理（见PostProcess），
+// 返回生成的文件路径。写入失败时删除导出文件
+func writeExport(file, format, outDir, suffix string, write func(w io.Writer, format string) (int, error)) (string, error) {
+	if format == AutoFormat {
+		var err error
+		if format, err = ProfileFormat(file); err != nil {
+			return "", err
+		}
+	}
+	if outDir == "" {
+		outDir = filepath.Dir(file)
+	}
+	base := filepath.Base(file)
+	output := filepath.Join(outDir, strings.TrimSuffix(base, filepath.Ext(base))+suffix+"."+format)
+
+	f, err := os.Create(output)
+	if err != nil {
+		return "", fmt.Errorf("无法创建导出文件: %v", err)
+	}
+	var pages int
+	err = PostProcess(f, file, format, func(w io.Writer) error {
+		var err error
+		pages, err = write(w, format)
+		return err
+	})
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("无法写入导出文件: %v", closeErr)
+	}
+	if err != nil {
+		os.Remove(output)
+		return "", err
+	}
+
+	log.Printf("已导出 %s（%d页）: %s", logging.Path(file), pages, logging.Path(output))
+	return output, nil
+}
@@ -0,0 +1,247 @@
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+// GalleryIndex 是图库首页的文件名
+const GalleryIndex = "index.html"
+
+// galleryThumbnailWidth 是图库首页中缩略图的最大宽度
+const galleryThumbnailWidth = 320
+
+// diagramExtensions 是在目录中查找图表时识别的扩展名
+var diagramExtensions = []string{".puml", ".plantuml", ".pu"}
+
+// GalleryItem 是图库中一个图表的导出结果
+type GalleryItem struct {
+	Source string   // 源文件路径
+	Images []string // 各页的完整图像，相对于图库目录
+	Text   string   // 源码副本，相对于图库目录
+	Err    error    // 渲染失败时的错误，首页中显示错误信息而不是缩略图
+}
+
+// galleryEntry 是首页模板中的一个图表
+type galleryEntry struct {
+	Name      string
+	Thumbnail template.URL // 嵌入首页的缩略图，data:地址
+	Images    []string
+	Text      string
+	Error     string
+}
+
+// WriteGallery 按比例渲染files中的所有图表，连同源码副本写入outDir，并生成首页index.html。
+// 首页内嵌各图表第一页的缩略图，点击打开完整图像，目录可以直接发布到内部文档服务器。
+// 单个图表渲染失败不会中断导出，错误记录在返回的结果中并显示在首页上；无法写入目录或首页时返回错误
+func WriteGallery(files []string, outDir, title string, scale Scale) ([]GalleryItem, error) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, fmt.Errorf("无法创建图库目录: %v", err)
+	}
+
+	var items []GalleryItem
+	var entries []galleryEntry
+	used := make(map[string]bool)
+	for _, file := range files {
+		item := GalleryItem{Source: file}
+		entry := galleryEntry{Name: filepath.Base(file)}
+		thumb, err := writeGalleryItem(&item, outDir, uniqueStem(file, used), scale)
+		if err != nil {
+			log.Printf("图库中的 %s 渲染失败: %v", logging.Path(file), err)
+			item.Err = err
+			entry.Error = err.Error()
+		} else {
+			entry.Thumbnail = thumb
+		}
+		entry.Images = item.Images
+		entry.Text = item.Text
+		items = append(items, item)
+		entries = append(entries, entry)
+	}
+
+	index := filepath.Join(outDir, GalleryIndex)
+	f, err := os.Create(index)
+	if err != nil {
+		return items, fmt.Errorf("无法创建图库首页: %v", err)
+	}
+	err = writeGalleryIndex(f, title, entries)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return items, fmt.Errorf("无法写入图库首页: %v", err)
+	}
+
+	log.Printf("已生成图库（%d个图表）: %s", len(files), logging.Path(index))
+	return items, nil
+}
+
+// writeGalleryItem 写入一个图表的源码副本和各页图像，记录到item中，返回第一页缩略图的data:地址。
+// 源码先写入，渲染失败时首页中仍然可以查看源码
+func writeGalleryItem(item *GalleryItem, outDir, stem string, scale Scale) (template.URL, error) {
+	source, err := ioutil.ReadFile(item.Source)
+	if err != nil {
+		return "", fmt.Errorf("无法读取文件: %v", err)
+	}
+	// 加上.txt，浏览器直接以文本显示而不是下载
+	item.Text = stem + filepath.Ext(item.Source) + ".txt"
+	if err := ioutil.WriteFile(filepath.Join(outDir, item.Text), source, 0644); err != nil {
+		return "", fmt.Errorf("无法写入源码: %v", err)
+	}
+
+	pages, err := RenderImages(item.Source, scale)
+	if err != nil {
+		return "", err
+	}
+	for i, page := range pages {
+		name := stem + ".png"
+		if i > 0 {
+			name = fmt.Sprintf("%s-page%d.png", stem, i+1)
+		}
+		if err := writePNG(filepath.Join(outDir, name), page); err != nil {
+			return "", err
+		}
+		item.Images = append(item.Images, name)
+	}
+	return thumbnailURL(pages[0])
+}
+
+// uniqueStem 返回图表在图库中使用的文件名（不含扩展名），不同目录中的同名文件依次加上-2、-3等后缀
+func uniqueStem(file string, used map[string]bool) string {
+	base := filepath.Base(file)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	name := stem
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d", stem, i)
+	}
+	used[name] = true
+	return name
+}
+
+// writePNG 将图像编码为PNG写入path
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("无法创建图像文件: %v", err)
+	}
+	err = png.Encode(f, img)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("无法写入图像 %s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// thumbnail 将图像按比例缩小到不超过width像素宽，较窄的图像保持原样
+func thumbnail(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		return img
+	}
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// thumbnailURL 返回缩略图的data:地址，嵌入首页后不依赖其他文件
+func thumbnailURL(img image.Image) (template.URL, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, thumbnail(img, galleryThumbnailWidth)); err != nil {
+		return "", fmt.Errorf("无法生成缩略图: %v", err)
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// writeGalleryIndex 将图库首页写入w
+func writeGalleryIndex(w io.Writer, title string, entries []galleryEntry) error {
+	return galleryTemplate.Execute(w, struct {
+		Title   string
+		Entries []galleryEntry
+	}{title, entries})
+}
+
+// FindDiagrams 递归查找目录中的PlantUML文件（.puml、.plantuml、.pu），按路径排序，跳过以.开头的目录
+func FindDiagrams(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		for _, ext := range diagramExtensions {
+			if strings.EqualFold(filepath.Ext(path), ext) {
+				files = append(files, path)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("无法查找图表: %v", err)
+	}
+	return files, nil
+}
+
+// galleryTemplate 是图库首页的模板，样式内嵌在页面中
+var galleryTemplate = template.Must(template.New("gallery").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", sans-serif; margin: 2em; color: #222; }
+.gallery { display: grid; grid-template-columns: repeat(auto-fill, minmax(340px, 1fr)); gap: 1.5em; }
+figure { margin: 0; padding: 10px; border: 1px solid #ddd; border-radius: 6px; }
+figure img { display: block; max-width: 100%; max-height: 240px; margin: 0 auto; }
+figcaption { margin-top: 8px; font-size: 14px; }
+figcaption a { margin-right: 0.8em; }
+.error { color: #b00020; white-space: pre-wrap; font-size: 13px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="gallery">
+{{- range .Entries}}
+<figure>
+{{- if .Error}}
+<div class="error">{{.Error}}</div>
+{{- else}}
+<a href="{{index .Images 0}}"><img src="{{.Thumbnail}}" alt="{{.Name}}"></a>
+{{- end}}
+<figcaption><strong>{{.Name}}</strong><br>
+{{- range $i, $image := .Images}}<a href="{{$image}}">{{if eq $i 0}}图像{{else}}第{{inc $i}}页{{end}}</a>{{end}}
+{{- if .Text}}<a href="{{.Text}}">源码</a>{{end}}
+</figcaption>
+</figure>
+{{- end}}
+</div>
+</body>
+</html>
+`))
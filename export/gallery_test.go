@@ -0,0 +1,97 @@
+package export
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGalleryIndex(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+	thumb, err := thumbnailURL(img)
+	if err != nil {
+		t.Fatalf("thumbnailURL: %v", err)
+	}
+	if size := thumbnail(img, galleryThumbnailWidth).Bounds().Size(); size != image.Pt(320, 160) {
+		t.Errorf("缩略图应按比例缩小，得到 %v", size)
+	}
+
+	var buf strings.Builder
+	err = writeGalleryIndex(&buf, "架构图 <v2>", []galleryEntry{
+		{Name: "login.puml", Thumbnail: thumb, Images: []string{"login.png", "login-page2.png"}, Text: "login.puml.txt"},
+		{Name: "broken.puml", Text: "broken.puml.txt", Error: "第3行 <语法错误>"},
+	})
+	if err != nil {
+		t.Fatalf("writeGalleryIndex: %v", err)
+	}
+	html := buf.String()
+	for _, want := range []string{
+		"<title>架构图 &lt;v2&gt;</title>",
+		`<a href="login.png"><img src="data:image/png;base64,`,
+		`<a href="login-page2.png">第2页</a>`,
+		`<a href="login.puml.txt">源码</a>`,
+		`<div class="error">第3行 &lt;语法错误&gt;</div>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("首页中应包含 %q:\n%s", want, html)
+		}
+	}
+}
+
+func TestUniqueStem(t *testing.T) {
+	used := make(map[string]bool)
+	var got []string
+	for _, file := range []string{"/a/login.puml", "/b/login.puml", "/c/login.pu", "/a/order.puml"} {
+		got = append(got, uniqueStem(file, used))
+	}
+	want := []string{"login", "login-2", "login-3", "order"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueStem = %v，应为 %v", got, want)
+	}
+}
+
+func TestFindDiagrams(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.puml", "docs/b.PlantUML", "docs/notes.md", ".git/c.puml", "src/d.pu"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := FindDiagrams(dir)
+	if err != nil {
+		t.Fatalf("FindDiagrams: %v", err)
+	}
+	want := []string{filepath.Join(dir, "a.puml"), filepath.Join(dir, "docs/b.PlantUML"), filepath.Join(dir, "src/d.pu")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("FindDiagrams = %v，应为 %v", files, want)
+	}
+}
+
+func TestWriteGalleryMissingFile(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "gallery")
+	missing := filepath.Join(t.TempDir(), "missing.puml")
+
+	items, err := WriteGallery([]string{missing}, outDir, "图库", Presets[0])
+	if err != nil {
+		t.Fatalf("单个图表失败不应中断导出: %v", err)
+	}
+	if len(items) != 1 || items[0].Err == nil {
+		t.Fatalf("应记录读取失败的错误，得到 %+v", items)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(outDir, GalleryIndex))
+	if err != nil {
+		t.Fatalf("应生成首页: %v", err)
+	}
+	if !strings.Contains(string(data), "missing.puml") || !strings.Contains(string(data), `class="error"`) {
+		t.Errorf("首页中应显示失败的图表:\n%s", data)
+	}
+}
@@ -0,0 +1,223 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+
+	"plantumlmacviewer/plantuml"
+)
+
+// DefaultHistoryLimit 是时间轴默认列出的提交数，很长的历史只看最近的部分
+const DefaultHistoryLimit = 200
+
+// Revision 是修改过文件的一次提交
+type Revision struct {
+	Hash    string
+	Short   string // 缩写的提交哈希
+	Subject string // 提交说明的第一行
+	Author  string
+	Time    time.Time
+}
+
+// Label 返回版本在时间轴上显示的名称，例如 "2024-03-01 a1b2c3d 拆分登录流程"
+func (r Revision) Label() string {
+	return fmt.Sprintf("%s %s %s", r.Time.Format("2006-01-02"), r.Short, r.Subject)
+}
+
+// historyFormat 是git log输出提交时使用的格式，各字段以NUL分隔，由parseHistory解析
+const historyFormat = "--format=%H%x00%h%x00%an%x00%ct%x00%s%x00"
+
+// History 返回修改过file的最近limit个提交（limit不大于0时为DefaultHistoryLimit），按时间从早到晚排列，
+// 文件改名前的提交也会列出。文件不在git仓库中或没有提交过时返回错误
+func History(file string, limit int) ([]Revision, error) {
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	return logRevisions(file, "-n", strconv.Itoa(limit))
+}
+
+// HistoryBetween 返回from（不包括）到to之间修改过file的提交，按时间从早到晚排列，前面加上from本身，
+// 作为文件在这段时间开始时的样子。from为空时从最早的提交开始，to为空时到HEAD为止
+func HistoryBetween(file, from, to string) ([]Revision, error) {
+	if to == "" {
+		to = "HEAD"
+	}
+	if from == "" {
+		return logRevisions(file, to)
+	}
+	// from本身不一定修改过文件，不按文件过滤
+	out, err := git(filepath.Dir(file), "log", "-n", "1", historyFormat, from)
+	if err != nil {
+		return nil, fmt.Errorf("找不到版本 %s: %v", from, err)
+	}
+	dir, base := filepath.Split(file)
+	changes, err := git(dir, "log", "--follow", historyFormat, from+".."+to, "--", base)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取 %s 的提交历史: %v", filepath.Base(file), err)
+	}
+	// 这段时间里没有修改过文件时只有开始时的样子
+	return append(parseHistory(out), parseHistory(changes)...), nil
+}
+
+// logRevisions 按args执行git log，返回修改过file的提交，按时间从早到晚排列，文件改名前的提交也会列出。没有提交时返回错误
+func logRevisions(file string, args ...string) ([]Revision, error) {
+	dir, base := filepath.Split(file)
+	args = append([]string{"log", "--follow", historyFormat}, args...)
+	out, err := git(dir, append(args, "--", base)...)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取 %s 的提交历史: %v", filepath.Base(file), err)
+	}
+	revisions := parseHistory(out)
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("%s 还没有提交过", filepath.Base(file))
+	}
+	return revisions, nil
+}
+
+// parseHistory 解析git log按History的格式输出的提交，返回按时间从早到晚排列的版本
+func parseHistory(out []byte) []Revision {
+	fields := bytes.Split(out, []byte{0})
+	var revisions []Revision
+	for i := 0; i+5 <= len(fields); i += 5 {
+		seconds, err := strconv.ParseInt(string(fields[i+3]), 10, 64)
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, Revision{
+			Hash:    string(bytes.TrimSpace(fields[i])),
+			Short:   string(fields[i+1]),
+			Author:  string(fields[i+2]),
+			Time:    time.Unix(seconds, 0),
+			Subject: string(fields[i+4]),
+		})
+	}
+	// git log从新到旧输出，时间轴从左到右是从早到晚
+	for i, j := 0, len(revisions)-1; i < j; i, j = i+1, j-1 {
+		revisions[i], revisions[j] = revisions[j], revisions[i]
+	}
+	return revisions
+}
+
+// Timeline 按需渲染文件在各个版本中的第一页，并按源码的摘要缓存结果，拖动时间轴来回经过同一版本时不用重新渲染；
+// 源码相同的版本（例如只改了其他文件的合并提交）共用同一张图像。可以在多个goroutine中同时使用
+type Timeline struct {
+	File      string
+	Revisions []Revision
+
+	// render 把某个版本的源码渲染为PNG，测试中可以替换为不依赖Java的实现
+	render func(source []byte, file string) ([]byte, error)
+
+	mu      sync.Mutex
+	digests map[string]string         // 提交哈希 -> 源码的摘要
+	images  map[string]*timelineImage // 源码的摘要 -> 渲染结果
+}
+
+// timelineImage 是一个版本的渲染结果，渲染失败的版本也缓存错误，done在渲染完成后关闭
+type timelineImage struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// NewTimeline 读取file最近limit个提交，创建它的时间轴。渲染使用文件当前的渲染配置
+func NewTimeline(file string, limit int) (*Timeline, error) {
+	revisions, err := History(file, limit)
+	if err != nil {
+		return nil, err
+	}
+	return newTimeline(file, revisions, 0), nil
+}
+
+// newTimeline 创建按revisions渲染file的时间轴，dpi为0时使用PlantUML的默认分辨率
+func newTimeline(file string, revisions []Revision, dpi float64) *Timeline {
+	return &Timeline{
+		File:      file,
+		Revisions: revisions,
+		render: func(source []byte, file string) ([]byte, error) {
+			return plantuml.RenderSourceAs(source, file, dpi)
+		},
+		digests: make(map[string]string),
+		images:  make(map[string]*timelineImage),
+	}
+}
+
+// Render 返回第i个版本的PNG图像，已经渲染过的版本直接返回缓存的结果；同一版本正在渲染时等待它完成。
+// 文件在该版本中不存在时返回ErrNotInRevision
+func (t *Timeline) Render(i int) ([]byte, error) {
+	if i < 0 || i >= len(t.Revisions) {
+		return nil, fmt.Errorf("没有第%d个版本", i+1)
+	}
+	rev := t.Revisions[i]
+
+	t.mu.Lock()
+	digest, ok := t.digests[rev.Hash]
+	t.mu.Unlock()
+	var source []byte
+	if !ok {
+		var err error
+		source, err = ShowRevision(t.File, rev.Hash)
+		if err != nil {
+			return nil, err
+		}
+		digest = render.Digest(source)
+		t.mu.Lock()
+		t.digests[rev.Hash] = digest
+		t.mu.Unlock()
+	}
+
+	t.mu.Lock()
+	img, ok := t.images[digest]
+	if !ok {
+		img = &timelineImage{done: make(chan struct{})}
+		t.images[digest] = img
+	}
+	t.mu.Unlock()
+	if ok {
+		<-img.done
+		return img.data, img.err
+	}
+
+	if source == nil {
+		var err error
+		if source, err = ShowRevision(t.File, rev.Hash); err != nil {
+			img.err = err
+			close(img.done)
+			return nil, err
+		}
+	}
+	img.data, img.err = t.render(source, t.File)
+	if img.err != nil {
+		img.err = fmt.Errorf("%s: %v", rev.Short, img.err)
+	}
+	close(img.done)
+	return img.data, img.err
+}
+
+// Cached 判断第i个版本是否已经渲染完成，拖动时间轴时已经缓存的版本可以直接显示
+func (t *Timeline) Cached(i int) bool {
+	if i < 0 || i >= len(t.Revisions) {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	digest, ok := t.digests[t.Revisions[i].Hash]
+	if !ok {
+		return false
+	}
+	img, ok := t.images[digest]
+	if !ok {
+		return false
+	}
+	select {
+	case <-img.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,116 @@
+package export
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTimeline(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("没有安装git")
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "login.puml")
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	for i, source := range []string{"A -> B", "A -> C", "A -> B"} {
+		writeFile(t, file, "@startuml\n"+source+"\n@enduml\n")
+		run("add", ".")
+		run("commit", "-q", "-m", []string{"add login", "call C", "revert"}[i])
+	}
+
+	if _, err := NewTimeline(filepath.Join(dir, "missing.puml"), 0); err == nil {
+		t.Error("没有提交过的文件应返回错误")
+	}
+	timeline, err := NewTimeline(file, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var subjects []string
+	for _, rev := range timeline.Revisions {
+		subjects = append(subjects, rev.Subject)
+	}
+	if got := strings.Join(subjects, ","); got != "add login,call C,revert" {
+		t.Fatalf("版本应从早到晚排列，得到 %s", got)
+	}
+
+	renders := 0
+	timeline.render = func(source []byte, file string) ([]byte, error) {
+		renders++
+		if strings.Contains(string(source), "A -> C") {
+			return nil, errors.New("语法错误")
+		}
+		return []byte("png"), nil
+	}
+	if timeline.Cached(0) {
+		t.Error("还没有渲染的版本不应已缓存")
+	}
+	if data, err := timeline.Render(0); err != nil || string(data) != "png" {
+		t.Fatalf("Render(0) = %q, %v", data, err)
+	}
+	if _, err := timeline.Render(1); err == nil || !strings.Contains(err.Error(), "语法错误") {
+		t.Errorf("渲染失败的版本应返回错误，得到 %v", err)
+	}
+	// 第三个版本与第一个版本的源码相同，第二个版本的错误也已缓存
+	timeline.Render(2)
+	timeline.Render(1)
+	if renders != 2 || !timeline.Cached(2) {
+		t.Errorf("源码相同的版本应共用缓存，渲染了%d次", renders)
+	}
+	if _, err := timeline.Render(3); err == nil {
+		t.Error("超出范围的版本应返回错误")
+	}
+}
+
+func TestHistoryBetween(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("没有安装git")
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "login.puml")
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	for i, source := range []string{"A -> B", "A -> C", "A -> D"} {
+		writeFile(t, file, "@startuml\n"+source+"\n@enduml\n")
+		run("add", ".")
+		run("commit", "-q", "-m", []string{"add login", "call C", "call D"}[i])
+		if i == 0 {
+			run("tag", "v1")
+		}
+	}
+	subjects := func(revisions []Revision) string {
+		var s []string
+		for _, rev := range revisions {
+			s = append(s, rev.Subject)
+		}
+		return strings.Join(s, ",")
+	}
+
+	// from本身作为第一帧
+	if revisions, err := HistoryBetween(file, "v1", ""); err != nil || subjects(revisions) != "add login,call C,call D" {
+		t.Errorf("HistoryBetween(v1, HEAD) = %s, %v", subjects(revisions), err)
+	}
+	if revisions, err := HistoryBetween(file, "", "HEAD~1"); err != nil || subjects(revisions) != "add login,call C" {
+		t.Errorf("HistoryBetween(, HEAD~1) = %s, %v", subjects(revisions), err)
+	}
+	if _, err := HistoryBetween(file, "no-such-tag", ""); err == nil {
+		t.Error("版本不存在时应返回错误")
+	}
+}
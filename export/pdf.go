@@ -0,0 +1,132 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"io"
+)
+
+// pointsPerInch PDF中每英寸的点数
+const pointsPerInch = 72
+
+// DefaultDPI PlantUML输出PNG的默认分辨率
+const DefaultDPI = 96
+
+// WritePDF 将多张图像按顺序写成一个PDF文件，每张图像占一页。
+// 页面尺寸按dpi从像素换算，因此按100%打印时与屏幕上的实际大小一致
+func WritePDF(w io.Writer, pages []image.Image, dpi float64) error {
+	if len(pages) == 0 {
+		return fmt.Errorf("没有可导出的页面")
+	}
+	if dpi <= 0 {
+		dpi = DefaultDPI
+	}
+
+	pdf := &pdfWriter{}
+	pdf.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	// 对象编号：1为Catalog，2为Pages，之后每页依次占用页面、内容流、图像三个对象
+	kids := &bytes.Buffer{}
+	for i := range pages {
+		fmt.Fprintf(kids, "%d 0 R ", 3+i*3)
+	}
+	pdf.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	pdf.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(pages)))
+
+	for i, img := range pages {
+		pageObj, contentObj, imageObj := 3+i*3, 4+i*3, 5+i*3
+		bounds := img.Bounds()
+		width := float64(bounds.Dx()) * pointsPerInch / dpi
+		height := float64(bounds.Dy()) * pointsPerInch / dpi
+
+		pdf.object(pageObj, fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+			width, height, imageObj, contentObj))
+
+		content := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q", width, height)
+		pdf.stream(contentObj, "", []byte(content))
+
+		data, err := compressRGB(img)
+		if err != nil {
+			return fmt.Errorf("无法压缩第%d页图像: %v", i+1, err)
+		}
+		pdf.stream(imageObj, fmt.Sprintf(
+			"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode",
+			bounds.Dx(), bounds.Dy()), data)
+	}
+
+	pdf.trailer(2 + len(pages)*3)
+	_, err := w.Write(pdf.buf.Bytes())
+	return err
+}
+
+// compressRGB 将图像转换为RGB字节并用zlib压缩，透明部分与白色背景混合
+func compressRGB(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	var out bytes.Buffer
+	zw := zlib.NewWriter(&out)
+	row := make([]byte, bounds.Dx()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			// RGBA返回预乘alpha的值，与白色混合时补上未覆盖的部分
+			white := 0xffff - a
+			i := (x - bounds.Min.X) * 3
+			row[i] = byte((r + white) >> 8)
+			row[i+1] = byte((g + white) >> 8)
+			row[i+2] = byte((b + white) >> 8)
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// pdfWriter 在内存中拼装PDF，并记录每个对象的偏移量用于生成交叉引用表
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+func (p *pdfWriter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&p.buf, format, args...)
+}
+
+// begin 记录对象的起始偏移量并写入对象头
+func (p *pdfWriter) begin(num int) {
+	for len(p.offsets) < num {
+		p.offsets = append(p.offsets, 0)
+	}
+	p.offsets[num-1] = p.buf.Len()
+	p.printf("%d 0 obj\n", num)
+}
+
+// object 写入一个普通对象
+func (p *pdfWriter) object(num int, body string) {
+	p.begin(num)
+	p.printf("%s\nendobj\n", body)
+}
+
+// stream 写入一个流对象，dict为流字典中除/Length以外的条目
+func (p *pdfWriter) stream(num int, dict string, data []byte) {
+	p.begin(num)
+	p.printf("<< %s /Length %d >>\nstream\n", dict, len(data))
+	p.buf.Write(data)
+	p.printf("\nendstream\nendobj\n")
+}
+
+// trailer 写入交叉引用表和文件尾
+func (p *pdfWriter) trailer(count int) {
+	xref := p.buf.Len()
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", count+1)
+	for _, off := range p.offsets {
+		p.printf("%010d 00000 n \n", off)
+	}
+	p.printf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", count+1, xref)
+}
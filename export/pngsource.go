@@ -0,0 +1,120 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+)
+
+// pngSignature 是PNG文件开头的8个字节
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngSourceKeyword 是PlantUML在PNG文本块中保存源码时使用的关键字
+const pngSourceKeyword = "plantuml"
+
+// ExtractPNGSource 取出PlantUML保存在PNG元数据（关键字为plantuml的tEXt、zTXt或iTXt块）中的源码，
+// 去掉PlantUML附加在源码后的版本信息。没有源码或PNG无法解析时返回false
+func ExtractPNGSource(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return "", false
+	}
+	data = data[len(pngSignature):]
+
+	for len(data) >= 12 {
+		length := binary.BigEndian.Uint32(data[:4])
+		kind := string(data[4:8])
+		if uint64(length) > uint64(len(data)-12) {
+			return "", false
+		}
+		chunk := data[8 : 8+length]
+		data = data[12+length:]
+
+		if kind == "IEND" {
+			break
+		}
+		if text, ok := pngChunkText(kind, chunk); ok {
+			return trimSourceTrailer(text), true
+		}
+	}
+	return "", false
+}
+
+// pngChunkText 解析关键字为pngSourceKeyword的文本块，返回其中的文字
+func pngChunkText(kind string, chunk []byte) (string, bool) {
+	sep := bytes.IndexByte(chunk, 0)
+	if sep < 0 || string(chunk[:sep]) != pngSourceKeyword {
+		return "", false
+	}
+	rest := chunk[sep+1:]
+
+	switch kind {
+	case "tEXt":
+		return latin1(rest), true
+	case "zTXt":
+		// 压缩方法（只有0，即zlib）之后是压缩的文字
+		if len(rest) < 1 {
+			return "", false
+		}
+		text, err := inflate(rest[1:])
+		if err != nil {
+			return "", false
+		}
+		return latin1(text), true
+	case "iTXt":
+		// 压缩标志、压缩方法、语言标签和翻译后的关键字之后是UTF-8文字
+		if len(rest) < 2 {
+			return "", false
+		}
+		compressed := rest[0] == 1
+		rest = rest[2:]
+		for i := 0; i < 2; i++ {
+			sep := bytes.IndexByte(rest, 0)
+			if sep < 0 {
+				return "", false
+			}
+			rest = rest[sep+1:]
+		}
+		if !compressed {
+			return string(rest), true
+		}
+		text, err := inflate(rest)
+		if err != nil {
+			return "", false
+		}
+		return string(text), true
+	}
+	return "", false
+}
+
+// inflate 解压zlib格式的数据
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// latin1 把ISO-8859-1编码的文字（tEXt和zTXt块使用的编码）转换为字符串
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// trimSourceTrailer 去掉源码中最后一个@end行之后的内容，PlantUML在那里附加了版本和运行环境信息
+func trimSourceTrailer(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "@end") {
+			return strings.Join(lines[:i+1], "\n") + "\n"
+		}
+	}
+	return text
+}
@@ -0,0 +1,89 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+const testPNGSource = "@startuml\nAlice -> Bob : 登录\n@enduml\n"
+
+// testPNG 生成一个PNG，并在IEND块之前插入类型为kind、内容为data的块
+func testPNG(t *testing.T, kind string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	iend := len(encoded) - 12
+
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk[:4], uint32(len(data)))
+	copy(chunk[4:8], kind)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	result := append([]byte{}, encoded[:iend]...)
+	result = append(result, chunk...)
+	return append(result, encoded[iend:]...)
+}
+
+// compress 用zlib压缩数据
+func compress(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte(data))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractPNGSource(t *testing.T) {
+	// PlantUML在源码后附加版本信息
+	withTrailer := testPNGSource + "\nPlantUML version 1.2024.3\n(GPL source distribution)\n"
+
+	cases := map[string][]byte{
+		"iTXt":   testPNG(t, "iTXt", append([]byte("plantuml\x00\x00\x00\x00\x00"), withTrailer...)),
+		"iTXt压缩": testPNG(t, "iTXt", append([]byte("plantuml\x00\x01\x00\x00\x00"), compress(t, withTrailer)...)),
+	}
+	for name, data := range cases {
+		got, ok := ExtractPNGSource(data)
+		if !ok {
+			t.Errorf("%s: 应能取出源码", name)
+			continue
+		}
+		if got != testPNGSource {
+			t.Errorf("%s: ExtractPNGSource = %q，应为 %q", name, got, testPNGSource)
+		}
+	}
+
+	// tEXt和zTXt使用Latin-1编码
+	latin := "@startuml\nA -> B : caf\xe9\n@enduml\n"
+	for name, data := range map[string][]byte{
+		"tEXt": testPNG(t, "tEXt", append([]byte("plantuml\x00"), latin...)),
+		"zTXt": testPNG(t, "zTXt", append([]byte("plantuml\x00\x00"), compress(t, latin)...)),
+	} {
+		if got, ok := ExtractPNGSource(data); !ok || got != "@startuml\nA -> B : café\n@enduml\n" {
+			t.Errorf("%s: ExtractPNGSource = %q, %v", name, got, ok)
+		}
+	}
+}
+
+func TestExtractPNGSourceWithoutSource(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"没有文本块": testPNG(t, "tEXt", []byte("Software\x00plantuml")),
+		"不是PNG": []byte("GIF89a"),
+		"块长度错误": append(append([]byte{}, pngSignature...), 0xff, 0xff, 0xff, 0xff, 't', 'E', 'X', 't'),
+	} {
+		if _, ok := ExtractPNGSource(data); ok {
+			t.Errorf("%s: 应返回false", name)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/logging"
+)
+
+// PostProcessTimeout 是一次导出的所有后处理最长的时间
+const PostProcessTimeout = 2 * time.Minute
+
+// PostProcessor 对导出的内容做后处理，例如压缩、缩放或加水印，返回处理后的内容。
+// 不处理format格式时原样返回data
+type PostProcessor interface {
+	Process(ctx context.Context, format string, data []byte) ([]byte, error)
+}
+
+// CommandProcessor 是通过外部命令做后处理的PostProcessor，见config.PostProcessor
+type CommandProcessor config.PostProcessor
+
+// Process 运行命令处理data：默认通过标准输入和标准输出传递内容，参数中有config.PostProcessFile时
+// 把内容写到临时文件，命令结束后读回该文件
+func (c CommandProcessor) Process(ctx context.Context, format string, data []byte) ([]byte, error) {
+	if !config.PostProcessor(c).Applies(format) {
+		return data, nil
+	}
+	if err := config.PostProcessor(c).Validate(); err != nil {
+		return nil, err
+	}
+	args := append([]string(nil), c.Command...)
+	var tempPath string
+	for i, arg := range args {
+		if !strings.Contains(arg, config.PostProcessFile) {
+			continue
+		}
+		if tempPath == "" {
+			f, err := ioutil.TempFile("", "plantuml-postprocess-*."+format)
+			if err != nil {
+				return nil, fmt.Errorf("无法创建临时文件: %v", err)
+			}
+			tempPath = f.Name()
+			defer os.Remove(tempPath)
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return nil, fmt.Errorf("无法写入临时文件: %v", err)
+			}
+		}
+		args[i] = strings.ReplaceAll(arg, config.PostProcessFile, tempPath)
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var stdout, stderr bytes.Buffer
+	if tempPath == "" {
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Stdout = &stdout
+	}
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var execErr *exec.Error
+		if errors.As(err, &execErr) {
+			return nil, fmt.Errorf("需要安装 %s 命令: %v", args[0], err)
+		}
+		return nil, fmt.Errorf("%s: %v %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	result := stdout.Bytes()
+	if tempPath != "" {
+		var err error
+		if result, err = ioutil.ReadFile(tempPath); err != nil {
+			return nil, fmt.Errorf("无法读取后处理的结果: %v", err)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%s 没有输出任何内容", args[0])
+	}
+	return result, nil
+}
+
+// postProcessors 是渲染配置可以按名称引用的后处理，见SetPostProcessors
+var postProcessors atomic.Value
+
+// SetPostProcessors 设置渲染配置的postProcess可以引用的后处理，通常由CommandProcessors按用户设置生成
+func SetPostProcessors(processors map[string]PostProcessor) {
+	postProcessors.Store(processors)
+}
+
+// CommandProcessors 把用户设置中的后处理命令转换为SetPostProcessors使用的PostProcessor
+func CommandProcessors(commands map[string]config.PostProcessor) map[string]PostProcessor {
+	processors := make(map[string]PostProcessor, len(commands))
+	for name, command := range commands {
+		processors[name] = CommandProcessor(command)
+	}
+	return processors
+}
+
+// PostProcessorsFor 返回导出文件时按顺序应用的后处理，即文件的渲染配置中postProcess引用的后处理。
+// 引用了没有定义的名称时返回错误
+func PostProcessorsFor(filePath string) ([]PostProcessor, []string, error) {
+	_, profile, err := config.ProfileFor(filePath)
+	if err != nil || len(profile.PostProcess) == 0 {
+		return nil, nil, err
+	}
+	defined, _ := postProcessors.Load().(map[string]PostProcessor)
+	processors := make([]PostProcessor, 0, len(profile.PostProcess))
+	for _, name := range profile.PostProcess {
+		p, ok := defined[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("渲染配置引用的后处理 %s 没有在设置的postProcessors中定义", name)
+		}
+		processors = append(processors, p)
+	}
+	return processors, profile.PostProcess, nil
+}
+
+// PostProcess 调用write生成导出内容，按文件的渲染配置做后处理后写入w。没有设置后处理时write直接写入w
+func PostProcess(w io.Writer, filePath, format string, write func(w io.Writer) error) error {
+	processors, names, err := PostProcessorsFor(filePath)
+	if err != nil {
+		return err
+	}
+	if len(processors) == 0 {
+		return write(w)
+	}
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), PostProcessTimeout)
+	defer cancel()
+	data := buf.Bytes()
+	for i, p := range processors {
+		if data, err = p.Process(ctx, format, data); err != nil {
+			return fmt.Errorf("后处理 %s 失败: %v", names[i], err)
+		}
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("无法写入导出文件: %v", err)
+	}
+	log.Printf("已对 %s 做后处理（%s）: %d → %d字节", logging.Path(filePath), strings.Join(names, ", "), buf.Len(), len(data))
+	return nil
+}
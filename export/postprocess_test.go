@@ -0,0 +1,85 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"plantumlmacviewer/config"
+)
+
+func TestCommandProcessor(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		command []string
+		want    string
+	}{
+		{[]string{"tr", "a-z", "A-Z"}, "<SVG/>"},
+		// 参数中有{file}时就地修改临时文件
+		{[]string{"sh", "-c", `printf '<!-- min -->' >> "$0"`, "{file}"}, "<svg/><!-- min -->"},
+	}
+	for _, tt := range tests {
+		got, err := CommandProcessor{Command: tt.command}.Process(ctx, "svg", []byte("<svg/>"))
+		if err != nil || string(got) != tt.want {
+			t.Errorf("%v 的结果为 %q, %v，应为 %q", tt.command, got, err, tt.want)
+		}
+	}
+
+	pngOnly := CommandProcessor{Command: []string{"false"}, Formats: []string{"png"}}
+	if got, err := pngOnly.Process(ctx, "svg", []byte("<svg/>")); err != nil || string(got) != "<svg/>" {
+		t.Errorf("不处理的格式应原样返回，得到 %q, %v", got, err)
+	}
+
+	failing := []struct {
+		command []string
+		want    string
+	}{
+		{[]string{"sh", "-c", "echo 'bad input' >&2; exit 3"}, "bad input"},
+		{[]string{"true"}, "没有输出任何内容"},
+		{[]string{"plantuml-postprocess-missing"}, "需要安装 plantuml-postprocess-missing"},
+	}
+	for _, tt := range failing {
+		if _, err := (CommandProcessor{Command: tt.command}).Process(ctx, "png", []byte("png")); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v 的错误应包含 %q，得到 %v", tt.command, tt.want, err)
+		}
+	}
+}
+
+// suffixProcessor 在内容后面加上后缀，用于检查后处理的顺序
+type suffixProcessor string
+
+func (s suffixProcessor) Process(ctx context.Context, format string, data []byte) ([]byte, error) {
+	return append(data, "+"+string(s)...), nil
+}
+
+func TestPostProcess(t *testing.T) {
+	defer SetPostProcessors(nil)
+	dir := t.TempDir()
+	project := `{"profiles": {"web": {"postProcess": ["a", "b"]}}, "files": [{"pattern": "web-*.puml", "profile": "web"}]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, config.ProjectFile), []byte(project), 0644); err != nil {
+		t.Fatal(err)
+	}
+	write := func(w io.Writer) error {
+		_, err := w.Write([]byte("img"))
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := PostProcess(&buf, filepath.Join(dir, "web-a.puml"), "png", write); err == nil || !strings.Contains(err.Error(), "后处理 a 没有在设置的postProcessors中定义") {
+		t.Errorf("引用没有定义的后处理时应返回错误，得到 %v", err)
+	}
+
+	SetPostProcessors(map[string]PostProcessor{"a": suffixProcessor("a"), "b": suffixProcessor("b")})
+	buf.Reset()
+	if err := PostProcess(&buf, filepath.Join(dir, "web-a.puml"), "png", write); err != nil || buf.String() != "img+a+b" {
+		t.Errorf("应按顺序做后处理，得到 %q, %v", buf.String(), err)
+	}
+	buf.Reset()
+	if err := PostProcess(&buf, filepath.Join(dir, "other.puml"), "png", write); err != nil || buf.String() != "img" {
+		t.Errorf("没有设置后处理的文件应原样写入，得到 %q, %v", buf.String(), err)
+	}
+}
@@ -0,0 +1,144 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"path/filepath"
+	"regexp"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/outline"
+	"plantumlmacviewer/plantuml"
+)
+
+// RedactedSuffix 是脱敏副本的文件名在扩展名前加上的后缀，避免覆盖普通的导出文件
+const RedactedSuffix = "-redacted"
+
+// Redact 按顺序对源码应用脱敏规则，返回替换后的源码和替换的次数
+func Redact(source string, rules []config.RedactionRule) (string, int, error) {
+	count := 0
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return "", 0, fmt.Errorf("无效的脱敏规则 %s: %v", rule.Pattern, err)
+		}
+		count += len(re.FindAllStringIndex(source, -1))
+		source = re.ReplaceAllString(source, rule.Replace)
+	}
+	return source, count, nil
+}
+
+// urlIncludePattern 匹配从网址引用内容的预处理指令，例如 !includeurl 和 !include https://...
+var urlIncludePattern = regexp.MustCompile(`(?mi)^\s*!include(?:url\b|\w*\s+<?https?://)`)
+
+// CheckRedactable 检查文件能否导出脱敏副本。脱敏规则只替换图表自己的源码，通过!include引用的本地文件或网址的内容
+// 会原样渲染出来，这样的图表返回错误，不导出脱敏副本；标准库（如<C4/C4_Container>）是公开的内容，不受影响
+func CheckRedactable(filePath string) error {
+	source, err := plantuml.ReadSource(filePath)
+	if err != nil {
+		return fmt.Errorf("无法读取源文件: %v", err)
+	}
+	return checkRedactable(source, filePath)
+}
+
+// checkRedactable 检查文件filePath的源码source是否引用了不会被脱敏的内容
+func checkRedactable(source, filePath string) error {
+	if files := outline.Includes(source, filepath.Dir(filePath)); len(files) > 0 {
+		return fmt.Errorf("%s 通过 !include 引用了 %s 等%d个文件，引用的内容不会被脱敏，不能导出脱敏副本；请把需要的内容复制到图表中再导出",
+			filePath, filepath.Base(files[0]), len(files))
+	}
+	if urlIncludePattern.MatchString(source) {
+		return fmt.Errorf("%s 引用了网址上的内容，引用的内容不会被脱敏，不能导出脱敏副本", filePath)
+	}
+	return nil
+}
+
+// redactedSource 读取文件并按所在项目的脱敏规则替换源码。项目没有设置脱敏规则或者图表引用了其他文件时返回错误，
+// 避免把未脱敏的图表当作副本发出去
+func redactedSource(filePath string) (string, int, error) {
+	rules, err := config.RedactionFor(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(rules) == 0 {
+		return "", 0, fmt.Errorf("%s 所在项目的 %s 中没有设置脱敏规则（redaction）", filePath, config.ProjectFile)
+	}
+	source, err := plantuml.ReadSource(filePath)
+	if err != nil {
+		return "", 0, fmt.Errorf("无法读取源文件: %v", err)
+	}
+	if err := checkRedactable(source, filePath); err != nil {
+		return "", 0, err
+	}
+	return Redact(source, rules)
+}
+
+// WriteRedacted 按所在项目的脱敏规则替换源码中的主机名、IP等内容后渲染，以format格式写入w，返回导出的页数和替换的次数。
+// 只在内存中替换，源文件不变。页面、比例和embedSource的含义与Write、WriteSVG相同，嵌入的是脱敏后的源码
+func WriteRedacted(w io.Writer, filePath, format string, scale Scale, embedSource bool) (int, int, error) {
+	source, count, err := redactedSource(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, profile, err := config.ProfileFor(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch format {
+	case "svg":
+		pages, err := plantuml.RenderSourcePages(source, filePath, "svg", 0)
+		if err != nil {
+			return 0, 0, err
+		}
+		svg, err := watermarkSVG(filePath, pages[0])
+		if err != nil {
+			return 0, 0, err
+		}
+		if embedSource {
+			if svg, err = EmbedSource(svg, source); err != nil {
+				return 0, 0, err
+			}
+		}
+		if _, err := w.Write(svg); err != nil {
+			return 0, 0, fmt.Errorf("无法写入SVG: %v", err)
+		}
+		return 1, count, nil
+	case "png", "pdf":
+	default:
+		return 0, 0, fmt.Errorf("不支持的导出格式: %s", format)
+	}
+
+	dpi := scale.DPI() * profile.ScaleFactor()
+	data, err := plantuml.RenderSourcePages(source, filePath, "png", dpi)
+	if err != nil {
+		return 0, 0, err
+	}
+	if format == "png" {
+		data = data[:1]
+	}
+	pages := make([]image.Image, 0, len(data))
+	for i, page := range data {
+		img, err := png.Decode(bytes.NewReader(page))
+		if err != nil {
+			return 0, 0, fmt.Errorf("无法解码第%d页: %v", i+1, err)
+		}
+		pages = append(pages, img)
+	}
+	if pages, err = watermarkPages(filePath, pages); err != nil {
+		return 0, 0, err
+	}
+	if format == "png" {
+		if err := png.Encode(w, pages[0]); err != nil {
+			return 0, 0, fmt.Errorf("无法写入PNG: %v", err)
+		}
+		return 1, count, nil
+	}
+	if err := WritePDF(w, pages, dpi); err != nil {
+		return 0, 0, err
+	}
+	return len(pages), count, nil
+}
@@ -0,0 +1,46 @@
+package export
+
+import (
+	"testing"
+
+	"plantumlmacviewer/config"
+)
+
+func TestRedact(t *testing.T) {
+	rules := []config.RedactionRule{
+		{Pattern: `\b(\w+)\.corp\.example\.com\b`, Replace: "host-$1"},
+		{Pattern: `\b\d{1,3}(\.\d{1,3}){3}\b`, Replace: "x.x.x.x"},
+		{Pattern: `\b\d{12}\b`, Replace: "<account>"},
+	}
+	source := "@startuml\nnode \"db01.corp.example.com\" as db\nnote right of db: 10.0.3.17, AWS 123456789012\n@enduml\n"
+	got, count, err := Redact(source, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "@startuml\nnode \"host-db01\" as db\nnote right of db: x.x.x.x, AWS <account>\n@enduml\n"
+	if got != want || count != 3 {
+		t.Errorf("Redact = %q（%d处），应为 %q（3处）", got, count, want)
+	}
+
+	if _, _, err := Redact(source, []config.RedactionRule{{Pattern: "("}}); err == nil {
+		t.Error("无效的正则表达式应返回错误")
+	}
+}
+
+func TestCheckRedactable(t *testing.T) {
+	for _, c := range []struct {
+		source string
+		ok     bool
+	}{
+		{"@startuml\nA -> B\n@enduml\n", true},
+		{"@startuml\n!include <C4/C4_Container>\n@enduml\n", true},
+		{"@startuml\n!include common.iuml\n@enduml\n", false},
+		{"@startuml\n!includesub parts.iuml!BASIC\n@enduml\n", false},
+		{"@startuml\n!includeurl https://example.com/a.iuml\n@enduml\n", false},
+		{"@startuml\n  !include https://example.com/a.iuml\n@enduml\n", false},
+	} {
+		if err := checkRedactable(c.source, "/tmp/net.puml"); (err == nil) != c.ok {
+			t.Errorf("checkRedactable(%q) = %v", c.source, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package export
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/plantuml"
+)
+
+// Formats 是支持的导出格式
+var Formats = []string{"png", "pdf", "svg"}
+
+// Write 按指定比例重新渲染文件，并以format格式（png、pdf或svg）写入w，返回导出的页数。
+// PDF包含所有页面，PNG和SVG只包含第一页。SVG是矢量图，不受比例影响，也不嵌入源码（见WriteSVG）。
+// 设置了水印时（见WatermarkFor）叠加在每一页上
+func Write(w io.Writer, filePath, format string, scale Scale) (int, error) {
+	switch format {
+	case "png", "pdf":
+	case "svg":
+		if err := WriteSVG(w, filePath, false); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	default:
+		return 0, fmt.Errorf("不支持的导出格式: %s", format)
+	}
+
+	pages, err := RenderImages(filePath, scale)
+	if err != nil {
+		return 0, err
+	}
+	if pages, err = watermarkPages(filePath, pages); err != nil {
+		return 0, err
+	}
+
+	if format == "png" {
+		if err := png.Encode(w, pages[0]); err != nil {
+			return 0, fmt.Errorf("无法写入PNG: %v", err)
+		}
+		return 1, nil
+	}
+
+	// 按比例提高DPI，页面的物理尺寸保持不变，只是更清晰
+	_, profile, _ := config.ProfileFor(filePath)
+	if err := WritePDF(w, pages, scale.DPI()*profile.ScaleFactor()); err != nil {
+		return 0, err
+	}
+	return len(pages), nil
+}
+
+// AutoFormat 是按文件的渲染配置选择导出格式时使用的格式名
+const AutoFormat = "auto"
+
+// ProfileFormat 返回文件的渲染配置中设置的导出格式，没有设置时为png
+func ProfileFormat(filePath string) (string, error) {
+	_, profile, err := config.ProfileFor(filePath)
+	if err != nil {
+		return "", err
+	}
+	if profile.Format == "" {
+		return "png", nil
+	}
+	return profile.Format, nil
+}
+
+// RenderImages 按指定比例重新渲染文件的所有页面，文件的渲染配置设置了比例时再乘以该比例
+func RenderImages(filePath string, scale Scale) ([]image.Image, error) {
+	_, profile, err := config.ProfileFor(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	tempDir, err := render.MakeTempDir("plantuml-export")
+	if err != nil {
+		return nil, fmt.Errorf("无法创建临时目录: %v", err)
+	}
+	defer render.RemoveTempDir(tempDir)
+
+	files, err := plantuml.RenderPages(filePath, tempDir, "png", scale.DPI()*profile.ScaleFactor())
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]image.Image, 0, len(files))
+	for _, file := range files {
+		img, err := decodePNG(file)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, img)
+	}
+	return pages, nil
+}
+
+// decodePNG 读取并解码PNG文件
+func decodePNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取生成的图像: %v", err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("无法解码图像 %s: %v", filepath.Base(path), err)
+	}
+	return img, nil
+}
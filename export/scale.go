@@ -0,0 +1,45 @@
+package export
+
+import (
+	"fmt"
+	"math"
+)
+
+// Scale 是导出时相对PlantUML默认输出的缩放比例。
+// 导出时按该比例重新渲染，而不是放大屏幕上的图像，因此放大后依然清晰
+type Scale struct {
+	Label  string  // 显示给用户的名称
+	Factor float64 // 缩放倍数
+}
+
+// Presets 是常用的导出比例
+var Presets = []Scale{
+	{Label: "1x（原始大小）", Factor: 1},
+	{Label: "2x", Factor: 2},
+	{Label: "4x", Factor: 4},
+}
+
+// DPI 返回按该比例重新渲染时使用的分辨率
+func (s Scale) DPI() float64 {
+	if s.Factor <= 0 {
+		return DefaultDPI
+	}
+	return DefaultDPI * s.Factor
+}
+
+// ScaleForWidth 返回将原始宽度为baseWidth像素的图像渲染为targetWidth像素宽所需的比例
+func ScaleForWidth(targetWidth, baseWidth int) (Scale, error) {
+	if baseWidth <= 0 {
+		return Scale{}, fmt.Errorf("图表尚未渲染，无法按宽度导出")
+	}
+	if targetWidth <= 0 {
+		return Scale{}, fmt.Errorf("宽度必须大于0: %d", targetWidth)
+	}
+	factor := float64(targetWidth) / float64(baseWidth)
+	// PlantUML只接受整数DPI，换算后的宽度可能与目标相差一两个像素
+	factor = math.Round(factor*DefaultDPI) / DefaultDPI
+	if factor <= 0 {
+		return Scale{}, fmt.Errorf("宽度太小: %d", targetWidth)
+	}
+	return Scale{Label: fmt.Sprintf("%d px宽", targetWidth), Factor: factor}, nil
+}
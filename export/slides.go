@@ -0,0 +1,172 @@
+package export
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+// 幻灯片的大小：16:9，1920×1080像素，按SlideDPI换算为13.33×7.5英寸，与Keynote和PowerPoint的宽屏幻灯片相同
+const (
+	SlideWidth  = 1920
+	SlideHeight = 1080
+	SlideDPI    = 144
+)
+
+// 幻灯片的版式（像素）
+const (
+	slideMargin     = 60  // 图表与幻灯片边缘的距离
+	slideTitleSize  = 48  // 标题的字号
+	slideTitleSpace = 100 // 标题占用的高度，包括与图表之间的距离
+	slideMaxUpscale = 2   // 图表较小时最多放大的倍数，避免位图放大后模糊
+)
+
+// slideTitleColor 是幻灯片标题的颜色
+var slideTitleColor = color.RGBA{0x33, 0x33, 0x33, 0xff}
+
+// SlideScale 是渲染幻灯片中的图表时使用的比例，以2倍分辨率渲染后再缩放到幻灯片中
+var SlideScale = Scale{Label: "2x", Factor: 2}
+
+// SlideOptions 是导出幻灯片的选项
+type SlideOptions struct {
+	Titles   bool   // 是否在每张幻灯片顶部显示标题（文件名，多页图表加上页码）
+	FontFile string // 标题使用的TrueType或OpenType字体文件，内置字体不能显示中日韩文字时指定，为空时使用内置字体
+}
+
+// Slide 是一张幻灯片的内容
+type Slide struct {
+	Title string
+	Image image.Image
+}
+
+// RenderSlides 按SlideScale渲染files中每个图表的所有页面，每页一张幻灯片，按文件的水印设置叠加水印。
+// 标题为去掉扩展名的文件名，多页图表加上“(页码/页数)”。任何一个图表渲染失败时返回错误
+func RenderSlides(files []string) ([]Slide, error) {
+	var slides []Slide
+	for _, file := range files {
+		pages, err := RenderImages(file, SlideScale)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Base(file), err)
+		}
+		if pages, err = watermarkPages(file, pages); err != nil {
+			return nil, err
+		}
+		base := filepath.Base(file)
+		title := strings.TrimSuffix(base, filepath.Ext(base))
+		for i, page := range pages {
+			slide := Slide{Title: title, Image: page}
+			if len(pages) > 1 {
+				slide.Title = fmt.Sprintf("%s (%d/%d)", title, i+1, len(pages))
+			}
+			slides = append(slides, slide)
+		}
+	}
+	return slides, nil
+}
+
+// ComposeSlide 把图表缩放后居中放在白色的16:9幻灯片上，opts.Titles为true时在顶部显示标题。
+// 图表按比例缩小到放得下，较小的图表最多放大slideMaxUpscale倍
+func ComposeSlide(slide Slide, opts SlideOptions) (*image.RGBA, error) {
+	dst := image.NewRGBA(image.Rect(0, 0, SlideWidth, SlideHeight))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+
+	area := image.Rect(slideMargin, slideMargin, SlideWidth-slideMargin, SlideHeight-slideMargin)
+	if opts.Titles && slide.Title != "" {
+		if err := drawSlideTitle(dst, slide.Title, opts.FontFile); err != nil {
+			return nil, err
+		}
+		area.Min.Y += slideTitleSpace
+	}
+
+	bounds := slide.Image.Bounds()
+	factor := float64(area.Dx()) / float64(bounds.Dx())
+	if f := float64(area.Dy()) / float64(bounds.Dy()); f < factor {
+		factor = f
+	}
+	if factor > slideMaxUpscale {
+		factor = slideMaxUpscale
+	}
+	width, height := int(float64(bounds.Dx())*factor), int(float64(bounds.Dy())*factor)
+	x := area.Min.X + (area.Dx()-width)/2
+	y := area.Min.Y + (area.Dy()-height)/2
+	draw.CatmullRom.Scale(dst, image.Rect(x, y, x+width, y+height), slide.Image, bounds, draw.Over, nil)
+	return dst, nil
+}
+
+// drawSlideTitle 在幻灯片左上角绘制标题，标题太长时截断并加上省略号
+func drawSlideTitle(dst *image.RGBA, title, fontFile string) error {
+	f, err := loadFont(fontFile)
+	if err != nil {
+		return err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: slideTitleSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return fmt.Errorf("无法创建标题字体: %v", err)
+	}
+	defer face.Close()
+
+	maxWidth := fixed.I(SlideWidth - 2*slideMargin)
+	if font.MeasureString(face, title) > maxWidth {
+		runes := []rune(title)
+		for len(runes) > 0 && font.MeasureString(face, string(runes)+"…") > maxWidth {
+			runes = runes[:len(runes)-1]
+		}
+		title = string(runes) + "…"
+	}
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(slideTitleColor),
+		Face: face,
+		Dot:  fixed.P(slideMargin, slideMargin+slideTitleSize),
+	}
+	d.DrawString(title)
+	return nil
+}
+
+// WriteSlidesPDF 把幻灯片写成一个PDF，每张幻灯片一页，页面为13.33×7.5英寸，可以直接导入Keynote或PowerPoint
+func WriteSlidesPDF(w io.Writer, slides []Slide, opts SlideOptions) error {
+	pages := make([]image.Image, 0, len(slides))
+	for _, slide := range slides {
+		page, err := ComposeSlide(slide, opts)
+		if err != nil {
+			return err
+		}
+		pages = append(pages, page)
+	}
+	return WritePDF(w, pages, SlideDPI)
+}
+
+// WriteSlidesPNG 把每张幻灯片写成outDir中的一个1920×1080的PNG，文件名以序号开头（例如 01-login.png），
+// 按文件名排序就是幻灯片的顺序，返回生成的文件路径
+func WriteSlidesPNG(outDir string, slides []Slide, opts SlideOptions) ([]string, error) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, fmt.Errorf("无法创建目录: %v", err)
+	}
+	var outputs []string
+	for i, slide := range slides {
+		page, err := ComposeSlide(slide, opts)
+		if err != nil {
+			return outputs, err
+		}
+		name := strings.NewReplacer("/", "-", " ", "", "(", "-", ")", "").Replace(slide.Title)
+		output := filepath.Join(outDir, fmt.Sprintf("%02d-%s.png", i+1, name))
+		if err := writePNG(output, page); err != nil {
+			return outputs, err
+		}
+		outputs = append(outputs, output)
+	}
+	log.Printf("已导出%d张幻灯片: %s", len(outputs), logging.Path(outDir))
+	return outputs, nil
+}
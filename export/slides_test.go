@@ -0,0 +1,92 @@
+package export
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"testing"
+)
+
+func TestComposeSlide(t *testing.T) {
+	// diagram 返回宽为width、高为height的纯红色图像
+	diagram := func(width, height int) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{0xff, 0, 0, 0xff}), image.Point{}, draw.Src)
+		return img
+	}
+	// redBounds 返回幻灯片中红色像素所在的范围
+	redBounds := func(img *image.RGBA) image.Rectangle {
+		var r image.Rectangle
+		for y := 0; y < img.Bounds().Dy(); y++ {
+			for x := 0; x < img.Bounds().Dx(); x++ {
+				if c := img.RGBAAt(x, y); c.R > 0xf0 && c.G < 0x10 {
+					r = r.Union(image.Rect(x, y, x+1, y+1))
+				}
+			}
+		}
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		width  int
+		height int
+		titles bool
+		want   image.Rectangle
+	}{
+		// 宽图表按宽度缩小，垂直居中
+		{"宽图表", 3600, 900, false, image.Rect(60, 315, 1860, 765)},
+		// 高图表按高度缩小，水平居中
+		{"高图表", 1000, 1920, false, image.Rect(710, 60, 1210, 1020)},
+		// 小图表最多放大2倍
+		{"小图表", 200, 100, false, image.Rect(760, 440, 1160, 640)},
+		// 显示标题时图表放在标题下面
+		{"标题", 1000, 1920, true, image.Rect(736, 160, 1183, 1020)},
+	}
+	for _, tt := range tests {
+		slide, err := ComposeSlide(Slide{Title: "flow", Image: diagram(tt.width, tt.height)}, SlideOptions{Titles: tt.titles})
+		if err != nil {
+			t.Fatalf("%s: ComposeSlide: %v", tt.name, err)
+		}
+		if got := slide.Bounds(); got != image.Rect(0, 0, SlideWidth, SlideHeight) {
+			t.Errorf("%s: 幻灯片的大小为 %v", tt.name, got)
+		}
+		if got := redBounds(slide); got != tt.want {
+			t.Errorf("%s: 图表的位置为 %v，期望 %v", tt.name, got, tt.want)
+		}
+		if c := slide.RGBAAt(SlideWidth-1, SlideHeight-1); c != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+			t.Errorf("%s: 背景应为白色，得到 %v", tt.name, c)
+		}
+	}
+
+	if _, err := ComposeSlide(Slide{Title: "x", Image: diagram(10, 10)}, SlideOptions{Titles: true, FontFile: filepath.Join(t.TempDir(), "missing.ttf")}); err == nil {
+		t.Error("字体文件不存在时应返回错误")
+	}
+}
+
+func TestWriteSlides(t *testing.T) {
+	slides := []Slide{
+		{Title: "login (1/2)", Image: image.NewRGBA(image.Rect(0, 0, 100, 50))},
+		{Title: "login (2/2)", Image: image.NewRGBA(image.Rect(0, 0, 100, 50))},
+	}
+	dir := t.TempDir()
+	outputs, err := WriteSlidesPNG(dir, slides, SlideOptions{})
+	if err != nil {
+		t.Fatalf("WriteSlidesPNG: %v", err)
+	}
+	want := []string{filepath.Join(dir, "01-login-1-2.png"), filepath.Join(dir, "02-login-2-2.png")}
+	if len(outputs) != len(want) || outputs[0] != want[0] || outputs[1] != want[1] {
+		t.Errorf("WriteSlidesPNG = %v，期望 %v", outputs, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSlidesPDF(&buf, slides, SlideOptions{}); err != nil {
+		t.Fatalf("WriteSlidesPDF: %v", err)
+	}
+	// 1920×1080像素按144DPI换算为960×540点
+	if !bytes.Contains(buf.Bytes(), []byte("/Count 2")) || !bytes.Contains(buf.Bytes(), []byte("/MediaBox [0 0 960.00 540.00]")) {
+		t.Error("PDF应有两页16:9的页面")
+	}
+}
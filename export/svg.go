@@ -0,0 +1,131 @@
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+
+	"plantumlmacviewer/plantuml"
+)
+
+// sourceMetadataID 是SVG中嵌入PlantUML源码的metadata元素的id
+const sourceMetadataID = "plantuml-source"
+
+// WriteSVG 重新渲染文件并以SVG格式写入w，多页图表只导出第一页。
+// embedSource为true时把文件的PlantUML源码嵌入SVG，之后可以从导出的SVG中取回源码。设置了水印时叠加在图表上方
+func WriteSVG(w io.Writer, filePath string, embedSource bool) error {
+	tempDir, err := render.MakeTempDir("plantuml-export")
+	if err != nil {
+		return fmt.Errorf("无法创建临时目录: %v", err)
+	}
+	defer render.RemoveTempDir(tempDir)
+
+	files, err := plantuml.RenderPages(filePath, tempDir, "svg", 0)
+	if err != nil {
+		return err
+	}
+	svg, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		return fmt.Errorf("无法读取生成的SVG: %v", err)
+	}
+	if svg, err = watermarkSVG(filePath, svg); err != nil {
+		return err
+	}
+
+	if embedSource {
+		source, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("无法读取源文件: %v", err)
+		}
+		if svg, err = EmbedSource(svg, string(source)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.Write(svg); err != nil {
+		return fmt.Errorf("无法写入SVG: %v", err)
+	}
+	return nil
+}
+
+// EmbedSource 把PlantUML源码作为metadata元素插入到SVG根元素的开头，返回新的SVG
+func EmbedSource(svg []byte, source string) ([]byte, error) {
+	start := bytes.Index(svg, []byte("<svg"))
+	if start < 0 {
+		return nil, fmt.Errorf("无效的SVG：找不到svg元素")
+	}
+	end := bytes.IndexByte(svg[start:], '>')
+	if end < 0 || svg[start+end-1] == '/' {
+		return nil, fmt.Errorf("无效的SVG：svg元素不完整")
+	}
+	end += start + 1
+
+	// EscapeText同时转义换行，源码在SVG中只占一行，取回时原样还原
+	var escaped bytes.Buffer
+	if err := xml.EscapeText(&escaped, []byte(source)); err != nil {
+		return nil, fmt.Errorf("无法转义源码: %v", err)
+	}
+	var metadata bytes.Buffer
+	fmt.Fprintf(&metadata, `<metadata id="%s">`, sourceMetadataID)
+	// PlantUML生成的SVG声明encoding="us-ascii"，非ASCII字符写成字符引用
+	for _, r := range escaped.String() {
+		if r < utf8.RuneSelf {
+			metadata.WriteRune(r)
+		} else {
+			fmt.Fprintf(&metadata, "&#x%X;", r)
+		}
+	}
+	metadata.WriteString("</metadata>")
+
+	result := make([]byte, 0, len(svg)+metadata.Len())
+	result = append(result, svg[:end]...)
+	result = append(result, metadata.Bytes()...)
+	return append(result, svg[end:]...), nil
+}
+
+// ExtractSource 取出由EmbedSource嵌入SVG中的PlantUML源码，没有嵌入源码或SVG无法解析时返回false
+func ExtractSource(svg []byte) (string, bool) {
+	decoder := xml.NewDecoder(bytes.NewReader(svg))
+	// PlantUML生成的SVG声明encoding="us-ascii"，非ASCII字符都写成了字符引用，可以按UTF-8读取
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	inSource := false
+	var source strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", false
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "metadata" && hasSourceID(t.Attr) {
+				inSource = true
+			}
+		case xml.CharData:
+			if inSource {
+				source.Write(t)
+			}
+		case xml.EndElement:
+			if inSource && t.Name.Local == "metadata" {
+				return source.String(), true
+			}
+		}
+	}
+}
+
+// hasSourceID 判断元素的id是否为sourceMetadataID
+func hasSourceID(attrs []xml.Attr) bool {
+	for _, attr := range attrs {
+		if attr.Name.Local == "id" && attr.Value == sourceMetadataID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package export
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSVG = `<?xml version="1.0" encoding="us-ascii" standalone="no"?><svg xmlns="http://www.w3.org/2000/svg" width="100" height="50"><g><text x="10" y="20">Alice</text></g></svg>`
+
+func TestEmbedSourceRoundTrip(t *testing.T) {
+	source := "@startuml\nAlice -> Bob : 登录 a < b && \"c\" ]]>\n@enduml\n"
+
+	svg, err := EmbedSource([]byte(testSVG), source)
+	if err != nil {
+		t.Fatalf("EmbedSource: %v", err)
+	}
+	if !strings.HasSuffix(string(svg), `<g><text x="10" y="20">Alice</text></g></svg>`) {
+		t.Errorf("嵌入源码不应改变原有内容，得到 %s", svg)
+	}
+
+	if strings.Contains(string(svg), "登录") {
+		t.Error("非ASCII字符应写成字符引用")
+	}
+
+	got, ok := ExtractSource(svg)
+	if !ok {
+		t.Fatal("应能取出嵌入的源码")
+	}
+	if got != source {
+		t.Errorf("ExtractSource = %q，应为 %q", got, source)
+	}
+}
+
+func TestExtractSourceWithoutSource(t *testing.T) {
+	if _, ok := ExtractSource([]byte(testSVG)); ok {
+		t.Error("没有嵌入源码时应返回false")
+	}
+	if _, ok := ExtractSource([]byte("not svg")); ok {
+		t.Error("无法解析时应返回false")
+	}
+}
+
+func TestEmbedSourceInvalidSVG(t *testing.T) {
+	for _, svg := range []string{"", "<html></html>", "<svg", "<svg/>"} {
+		if _, err := EmbedSource([]byte(svg), "@startuml\n@enduml\n"); err == nil {
+			t.Errorf("EmbedSource(%q) 应返回错误", svg)
+		}
+	}
+}
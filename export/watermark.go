@@ -0,0 +1,267 @@
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"plantumlmacviewer/config"
+)
+
+// defaultWatermark 是用户设置中的水印，文件所在项目没有设置水印时使用
+var defaultWatermark atomic.Value
+
+// SetWatermark 设置导出时默认叠加的水印（用户设置中的watermark），为nil时不加水印
+func SetWatermark(w *config.Watermark) {
+	defaultWatermark.Store(w)
+}
+
+// WatermarkFor 返回导出文件时叠加的水印：文件所在项目的watermark优先，其次是SetWatermark设置的水印，都没有时为nil
+func WatermarkFor(filePath string) (*config.Watermark, error) {
+	w, err := config.WatermarkFor(filePath)
+	if err != nil || w != nil {
+		return w, err
+	}
+	w, _ = defaultWatermark.Load().(*config.Watermark)
+	return w, nil
+}
+
+// WatermarkText 展开水印文字中的{date}、{sha}和{file}。文件不在git仓库中时{sha}为空
+func WatermarkText(text, filePath string, now time.Time) string {
+	replacements := []string{"{date}", now.Format("2006-01-02"), "{file}", filepath.Base(filePath)}
+	if strings.Contains(text, "{sha}") {
+		sha, _ := git(filepath.Dir(filePath), "rev-parse", "--short", "HEAD")
+		replacements = append(replacements, "{sha}", strings.TrimSpace(string(sha)))
+	}
+	return strings.Join(strings.Fields(strings.NewReplacer(replacements...).Replace(text)), " ")
+}
+
+// watermarkFor 返回文件的水印设置和展开后的文字，没有设置水印时返回nil
+func watermarkFor(filePath string) (*config.Watermark, string, error) {
+	w, err := WatermarkFor(filePath)
+	if err != nil || w == nil {
+		return nil, "", err
+	}
+	if err := w.Validate(); err != nil {
+		return nil, "", err
+	}
+	return w, WatermarkText(w.Text, filePath, time.Now()), nil
+}
+
+// watermarkPages 按文件的水印设置在每一页上叠加水印，没有设置水印时原样返回
+func watermarkPages(filePath string, pages []image.Image) ([]image.Image, error) {
+	w, text, err := watermarkFor(filePath)
+	if err != nil || w == nil {
+		return pages, err
+	}
+	stamped := make([]image.Image, len(pages))
+	for i, page := range pages {
+		if stamped[i], err = DrawWatermark(page, *w, text); err != nil {
+			return nil, err
+		}
+	}
+	return stamped, nil
+}
+
+// watermarkSVG 按文件的水印设置在SVG上叠加水印，没有设置水印时原样返回
+func watermarkSVG(filePath string, svg []byte) ([]byte, error) {
+	w, text, err := watermarkFor(filePath)
+	if err != nil || w == nil {
+		return svg, err
+	}
+	return WatermarkSVG(svg, *w, text)
+}
+
+// watermarkMargin 返回水印与图像边缘的距离，与字号成比例
+func watermarkMargin(size float64) float64 {
+	return size * 0.6
+}
+
+// watermarkSize 返回宽为width、高为height的图像上水印的字号（像素）：角落的水印按图像宽度，
+// 居中的水印按文字宽度textWidth（字号为1时的宽度）放大到约占图像宽度的六成，不超过图像高度的四分之一
+func watermarkSize(w config.Watermark, width, height, textWidth float64) float64 {
+	if w.EffectivePosition() != config.WatermarkCenter {
+		size := width / 50
+		if size < 12 {
+			size = 12
+		}
+		return size
+	}
+	size := height / 4
+	if textWidth > 0 && width*0.6/textWidth < size {
+		size = width * 0.6 / textWidth
+	}
+	return size
+}
+
+// watermarkOrigin 返回字号为size、宽为textWidth的水印在图像中的基线起点
+func watermarkOrigin(position string, width, height, size, textWidth float64) (x, y float64) {
+	margin := watermarkMargin(size)
+	switch position {
+	case config.WatermarkCenter:
+		return (width - textWidth) / 2, (height + size*0.7) / 2
+	case config.WatermarkTopLeft:
+		return margin, margin + size*0.8
+	case config.WatermarkTopRight:
+		return width - margin - textWidth, margin + size*0.8
+	case config.WatermarkBottomLeft:
+		return margin, height - margin
+	}
+	return width - margin - textWidth, height - margin
+}
+
+// loadFont 读取字体文件fontFile，为空时使用内置的Go字体（只包含拉丁、希腊和西里尔字母）
+func loadFont(fontFile string) (*opentype.Font, error) {
+	data := goregular.TTF
+	if fontFile != "" {
+		var err error
+		if data, err = ioutil.ReadFile(config.ExpandPath(fontFile)); err != nil {
+			return nil, fmt.Errorf("无法读取字体: %v", err)
+		}
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析字体 %s: %v", fontFile, err)
+	}
+	return f, nil
+}
+
+// DrawWatermark 把文字text按w的位置、颜色和不透明度叠加在img上，返回新的图像，img不变
+func DrawWatermark(img image.Image, w config.Watermark, text string) (*image.RGBA, error) {
+	r, g, b, err := w.RGB()
+	if err != nil {
+		return nil, err
+	}
+	f, err := loadFont(w.FontFile)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	// 先按100像素的字号测量文字宽度，再按图像大小确定字号
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+	measure, err := opentype.NewFace(f, &opentype.FaceOptions{Size: 100, DPI: 72})
+	if err != nil {
+		return nil, fmt.Errorf("无法创建水印字体: %v", err)
+	}
+	unitWidth := float64(font.MeasureString(measure, text)) / 64 / 100
+	measure.Close()
+	size := watermarkSize(w, width, height, unitWidth)
+
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, fmt.Errorf("无法创建水印字体: %v", err)
+	}
+	defer face.Close()
+	textWidth := float64(font.MeasureString(face, text)) / 64
+	x, y := watermarkOrigin(w.EffectivePosition(), width, height, size, textWidth)
+
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(color.NRGBA{R: r, G: g, B: b, A: uint8(w.EffectiveOpacity() * 255)}),
+		Face: face,
+		Dot:  fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(y * 64)},
+	}
+	d.DrawString(text)
+	return dst, nil
+}
+
+// svgViewBoxPattern 匹配SVG根元素的viewBox，svgSizePattern 匹配width或height属性
+var (
+	svgViewBoxPattern = regexp.MustCompile(`viewBox="\s*[-\d.]+[\s,]+[-\d.]+[\s,]+([\d.]+)[\s,]+([\d.]+)\s*"`)
+	svgSizePattern    = regexp.MustCompile(`\b(width|height)="([\d.]+)(?:px)?"`)
+)
+
+// svgSize 返回SVG根元素的宽和高（用户坐标），优先使用viewBox
+func svgSize(root []byte) (float64, float64, error) {
+	if m := svgViewBoxPattern.FindSubmatch(root); m != nil {
+		width, _ := strconv.ParseFloat(string(m[1]), 64)
+		height, _ := strconv.ParseFloat(string(m[2]), 64)
+		if width > 0 && height > 0 {
+			return width, height, nil
+		}
+	}
+	var width, height float64
+	for _, m := range svgSizePattern.FindAllSubmatch(root, -1) {
+		v, _ := strconv.ParseFloat(string(m[2]), 64)
+		if string(m[1]) == "width" {
+			width = v
+		} else {
+			height = v
+		}
+	}
+	if width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("无效的SVG：无法确定图像的大小")
+	}
+	return width, height, nil
+}
+
+// WatermarkSVG 在SVG的最后加上显示text的text元素，叠加在图表上方，返回新的SVG。
+// 文字由查看SVG的程序按sans-serif字体绘制，字体文件的设置不起作用
+func WatermarkSVG(svg []byte, w config.Watermark, text string) ([]byte, error) {
+	r, g, b, err := w.RGB()
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.Index(svg, []byte("<svg"))
+	end := bytes.LastIndex(svg, []byte("</svg>"))
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("无效的SVG：找不到svg元素")
+	}
+	rootEnd := bytes.IndexByte(svg[start:], '>')
+	width, height, err := svgSize(svg[start : start+rootEnd])
+	if err != nil {
+		return nil, err
+	}
+
+	// SVG中不测量文字，按平均字宽为字号的0.55倍估计宽度，只用于确定居中水印的字号
+	position := w.EffectivePosition()
+	size := watermarkSize(w, width, height, 0.55*float64(len([]rune(text))))
+	anchor, x := "end", width-watermarkMargin(size)
+	switch position {
+	case config.WatermarkCenter:
+		anchor, x = "middle", width/2
+	case config.WatermarkTopLeft, config.WatermarkBottomLeft:
+		anchor, x = "start", watermarkMargin(size)
+	}
+	_, y := watermarkOrigin(position, width, height, size, 0)
+
+	var escaped bytes.Buffer
+	if err := xml.EscapeText(&escaped, []byte(text)); err != nil {
+		return nil, fmt.Errorf("无法转义水印文字: %v", err)
+	}
+	var element bytes.Buffer
+	fmt.Fprintf(&element, `<text x="%.1f" y="%.1f" font-family="sans-serif" font-size="%.1f" text-anchor="%s" fill="#%02X%02X%02X" fill-opacity="%.2f" pointer-events="none">`,
+		x, y, size, anchor, r, g, b, w.EffectiveOpacity())
+	// PlantUML生成的SVG声明encoding="us-ascii"，非ASCII字符写成字符引用
+	for _, c := range escaped.String() {
+		if c < 0x80 {
+			element.WriteRune(c)
+		} else {
+			fmt.Fprintf(&element, "&#x%X;", c)
+		}
+	}
+	element.WriteString("</text>")
+
+	result := make([]byte, 0, len(svg)+element.Len())
+	result = append(result, svg[:end]...)
+	result = append(result, element.Bytes()...)
+	return append(result, svg[end:]...), nil
+}
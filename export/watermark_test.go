@@ -0,0 +1,111 @@
+package export
+
+import (
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"plantumlmacviewer/config"
+)
+
+func TestWatermarkText(t *testing.T) {
+	now := time.Date(2024, 3, 9, 10, 0, 0, 0, time.UTC)
+	file := filepath.Join(t.TempDir(), "flow.puml")
+	if got := WatermarkText("CONFIDENTIAL – {file} {date}", file, now); got != "CONFIDENTIAL – flow.puml 2024-03-09" {
+		t.Errorf("WatermarkText = %q", got)
+	}
+	// 不在git仓库中时{sha}为空，多余的空格合并
+	if got := WatermarkText("Draft {sha} {date}", file, now); got != "Draft 2024-03-09" {
+		t.Errorf("不在git仓库中时 WatermarkText = %q", got)
+	}
+}
+
+func TestWatermarkFor(t *testing.T) {
+	defer SetWatermark(nil)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.puml")
+	if w, err := WatermarkFor(file); err != nil || w != nil {
+		t.Errorf("没有设置水印时应为nil，得到 %+v, %v", w, err)
+	}
+	SetWatermark(&config.Watermark{Text: "USER"})
+	if w, _ := WatermarkFor(file); w == nil || w.Text != "USER" {
+		t.Errorf("应使用用户设置的水印，得到 %+v", w)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, config.ProjectFile), []byte(`{"watermark": {"text": "PROJECT"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := WatermarkFor(file); w == nil || w.Text != "PROJECT" {
+		t.Errorf("项目的水印应优先，得到 %+v", w)
+	}
+}
+
+func TestDrawWatermark(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 600, 300))
+	draw.Draw(src, src.Bounds(), image.White, image.Point{}, draw.Src)
+
+	// changed 返回rect中与白色不同的像素数
+	changed := func(img image.Image, rect image.Rectangle) int {
+		n := 0
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if r, g, b, _ := img.At(x, y).RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+					n++
+				}
+			}
+		}
+		return n
+	}
+
+	stamped, err := DrawWatermark(src, config.Watermark{Text: "CONFIDENTIAL", Color: "#C00000", Opacity: 1}, "CONFIDENTIAL")
+	if err != nil {
+		t.Fatalf("DrawWatermark: %v", err)
+	}
+	if changed(src, src.Bounds()) != 0 {
+		t.Error("不应修改原来的图像")
+	}
+	if changed(stamped, image.Rect(300, 250, 600, 300)) == 0 {
+		t.Error("右下角应有水印")
+	}
+	if changed(stamped, image.Rect(0, 0, 300, 250)) != 0 {
+		t.Error("水印之外的区域不应变化")
+	}
+	var red bool
+	for x := 300; x < 600 && !red; x++ {
+		for y := 250; y < 300; y++ {
+			if c := stamped.RGBAAt(x, y); c.R > c.G+0x40 && c.G == c.B {
+				red = true
+				break
+			}
+		}
+	}
+	if !red {
+		t.Error("水印应使用设置的颜色")
+	}
+
+	if _, err := DrawWatermark(src, config.Watermark{Text: "X", FontFile: filepath.Join(t.TempDir(), "missing.ttf")}, "X"); err == nil {
+		t.Error("字体文件不存在时应返回错误")
+	}
+}
+
+func TestWatermarkSVG(t *testing.T) {
+	svg := []byte(`<?xml version="1.0" encoding="us-ascii"?><svg xmlns="http://www.w3.org/2000/svg" width="400px" height="200px" viewBox="0 0 400 200"><g/></svg>`)
+	got, err := WatermarkSVG(svg, config.Watermark{Text: "x", Position: config.WatermarkTopLeft}, "机密 <draft>")
+	if err != nil {
+		t.Fatalf("WatermarkSVG: %v", err)
+	}
+	text := string(got)
+	if !strings.HasSuffix(text, "&#x673A;&#x5BC6; &lt;draft&gt;</text></svg>") {
+		t.Errorf("水印应在svg元素的最后，非ASCII字符写成字符引用: %s", text)
+	}
+	if !strings.Contains(text, `x="7.2" y="16.8"`) || !strings.Contains(text, `text-anchor="start"`) || !strings.Contains(text, `fill="#808080" fill-opacity="0.40"`) {
+		t.Errorf("水印的位置或样式不正确: %s", text)
+	}
+
+	if _, err := WatermarkSVG([]byte(`<svg><g/></svg>`), config.Watermark{Text: "x"}, "x"); err == nil {
+		t.Error("无法确定大小时应返回错误")
+	}
+}
@@ -0,0 +1,480 @@
+// Package formatter 按统一的风格整理PlantUML源码：嵌套的块按层级缩进，连续的消息对齐箭头和冒号，
+// 行首的关键字改为小写，去掉行尾的空白。只改变空白和关键字的大小写，不改变图表的含义
+package formatter
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/width"
+)
+
+// Indent 是每一级缩进
+const Indent = "  "
+
+// block 是一种嵌套块，打开后由对应的结束行关闭
+type block int
+
+const (
+	braceBlock  block = iota // { ... }
+	groupBlock               // 时序图的 alt、loop、group、box 等，以 end 结束
+	ifBlock                  // 活动图的 if ... endif
+	whileBlock               // while ... endwhile
+	repeatBlock              // repeat ... repeat while
+	forkBlock                // fork ... end fork
+	splitBlock               // split ... end split
+	switchBlock              // switch ... endswitch
+	ppIfBlock                // 预处理的 !if ... !endif
+	ppLoopBlock              // !while ... !endwhile、!foreach ... !endfor
+	ppDefBlock               // !procedure、!function ... !end...
+	ppSubBlock               // !startsub ... !endsub
+)
+
+// rule 按行首识别打开、结束或分隔块的行
+type rule struct {
+	pattern *regexp.Regexp
+	blocks  []block // 打开的块，或者结束、分隔时要求当前所在的块
+}
+
+// openers 是打开嵌套块的行；以 { 结尾的行也打开块
+var openers = []rule{
+	{regexp.MustCompile(`^(alt|opt|loop|par|par2|break|critical|group|box)(\s|$)`), []block{groupBlock}},
+	{regexp.MustCompile(`^if\s*\(`), []block{ifBlock}},
+	{regexp.MustCompile(`^while\s*\(`), []block{whileBlock}},
+	{regexp.MustCompile(`^repeat(\s*$|\s*:|\s+[^w])`), []block{repeatBlock}},
+	{regexp.MustCompile(`^fork$`), []block{forkBlock}},
+	{regexp.MustCompile(`^split$`), []block{splitBlock}},
+	{regexp.MustCompile(`^switch\s*\(`), []block{switchBlock}},
+	{regexp.MustCompile(`^!(if|ifdef|ifndef)(\s|\(|$)`), []block{ppIfBlock}},
+	{regexp.MustCompile(`^!(while|foreach)(\s|$)`), []block{ppLoopBlock}},
+	{regexp.MustCompile(`^!((unquoted|final)\s+)*(procedure|function|definelong)\s`), []block{ppDefBlock}},
+	{regexp.MustCompile(`^!startsub\s`), []block{ppSubBlock}},
+}
+
+// closers 是结束嵌套块的行
+var closers = []rule{
+	{regexp.MustCompile(`^\}`), []block{braceBlock}},
+	{regexp.MustCompile(`^end\s*if(\s|$)`), []block{ifBlock}},
+	{regexp.MustCompile(`^end\s*while(\s|\(|$)`), []block{whileBlock}},
+	{regexp.MustCompile(`^repeat\s*while(\s|\(|$)`), []block{repeatBlock}},
+	{regexp.MustCompile(`^end\s*(fork|merge)(\s|$)`), []block{forkBlock}},
+	{regexp.MustCompile(`^end\s*split(\s|$)`), []block{splitBlock}},
+	{regexp.MustCompile(`^end\s*switch(\s|$)`), []block{switchBlock}},
+	{regexp.MustCompile(`^end(\s|$)`), []block{groupBlock}},
+	{regexp.MustCompile(`^!endif(\s|$)`), []block{ppIfBlock}},
+	{regexp.MustCompile(`^!(endwhile|endfor)(\s|$)`), []block{ppLoopBlock}},
+	{regexp.MustCompile(`^!(endprocedure|endfunction|enddefinelong|end\s+procedure|end\s+function)(\s|$)`), []block{ppDefBlock}},
+	{regexp.MustCompile(`^!endsub(\s|$)`), []block{ppSubBlock}},
+}
+
+// separators 是块中分隔两个部分的行，与打开块的行对齐
+var separators = []rule{
+	{regexp.MustCompile(`^else(\s|\(|$)|^elseif\s*\(`), []block{groupBlock, ifBlock}},
+	{regexp.MustCompile(`^fork\s+again$`), []block{forkBlock}},
+	{regexp.MustCompile(`^split\s+again$`), []block{splitBlock}},
+	{regexp.MustCompile(`^case\s*\(`), []block{switchBlock}},
+	{regexp.MustCompile(`^!(else|elseif)(\s|\(|$)`), []block{ppIfBlock}},
+}
+
+// textBlocks 是多行的注释、图例、页眉页脚、引用和标题：其中是文字，逐行保持原样，直到对应的结束行
+var textBlocks = []struct {
+	start *regexp.Regexp
+	end   *regexp.Regexp
+}{
+	{regexp.MustCompile(`^[rh]?note(\s[^:"]*)?$`), regexp.MustCompile(`^end\s*[rh]?note$`)},
+	{regexp.MustCompile(`^legend(\s+(left|right|center|top|bottom))*$`), regexp.MustCompile(`^end\s*legend$`)},
+	{regexp.MustCompile(`^header(\s+(left|right|center))*$`), regexp.MustCompile(`^end\s*header$`)},
+	{regexp.MustCompile(`^footer(\s+(left|right|center))*$`), regexp.MustCompile(`^end\s*footer$`)},
+	{regexp.MustCompile(`^ref\s+over\s[^:]*$`), regexp.MustCompile(`^end\s*ref$`)},
+	{regexp.MustCompile(`^title$`), regexp.MustCompile(`^end\s*title$`)},
+}
+
+// keywords 是行首改为小写的关键字。PlantUML的关键字不区分大小写，统一为小写后更容易阅读
+var keywords = map[string]bool{}
+
+func init() {
+	for _, k := range strings.Fields(`
+		@startuml @enduml participant actor boundary control entity database collections queue
+		class interface enum abstract annotation package namespace note rnote hnote end else elseif endif
+		alt opt loop par break critical group box ref activate deactivate destroy create return autonumber
+		skinparam title legend endlegend header endheader footer endfooter caption hide show remove newpage
+		if while endwhile repeat fork split switch case endswitch start stop kill detach partition state
+		component node folder frame cloud rectangle usecase artifact card file storage stack agent person
+		together scale left right top bottom
+		!include !includeurl !include_many !include_once !includesub !import !define !definelong !enddefinelong
+		!undef !theme !pragma !if !ifdef !ifndef !else !elseif !endif !while !endwhile !foreach !endfor
+		!procedure !endprocedure !function !endfunction !return !log !assert !startsub !endsub
+		!unquoted !final !local !global`) {
+		keywords[k] = true
+	}
+}
+
+// arrowPattern 匹配箭头，例如 ->、-->>、<-、..>、-[#red]->、-up->、<|--、*--、o--
+var arrowPattern = regexp.MustCompile(`^(<<|<\||[<*o#x}+^\\/])?(?:[-.=~]+(?:\[[^\]]*\]|up|down|left|right|u|d|l|r)?)+(>>|\|>|[>*o#x{+^\\/])?$`)
+
+// actionEnd 匹配活动图中动作的结束符号，没有结束符号的动作在下一行继续
+var actionEnd = regexp.MustCompile(`[;|<>/\\\]}]$`)
+
+// Format 返回整理后的源码：@startuml和@enduml之间（没有@start行时为全部）的嵌套块按层级缩进，
+// 连续的消息对齐箭头和冒号，行首的关键字改为小写。其他类型的图表（@startjson、@startmindmap等）、
+// 块注释、多行的注释和图例以及跨行的活动保持原样，只去掉行尾的空白。源码使用CRLF换行时保持不变
+func Format(source string) string {
+	newline := "\n"
+	if strings.Contains(source, "\r\n") {
+		newline = "\r\n"
+	}
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	f := &formatter{uml: !hasStart(lines)}
+	for _, line := range lines {
+		f.line(line)
+	}
+	alignArrows(f.out)
+
+	var b strings.Builder
+	for _, l := range f.out {
+		b.WriteString(l.indent + l.text)
+		b.WriteString(newline)
+	}
+	return b.String()
+}
+
+// hasStart 判断源码中是否有@start行，没有时是被!include的片段，整理全部内容
+func hasStart(lines []string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "@start") {
+			return true
+		}
+	}
+	return false
+}
+
+// outLine 是整理后的一行：缩进和去掉缩进后的内容。verbatim为true的行保持原样，不参与对齐
+type outLine struct {
+	indent   string
+	text     string
+	verbatim bool
+}
+
+// formatter 逐行整理源码
+type formatter struct {
+	out   []outLine
+	uml   bool    // 是否在@startuml和@enduml之间
+	other string  // 在其他类型的图表中时为它的结束行，例如 @endjson
+	stack []block // 打开的嵌套块
+
+	comment  bool           // 是否在块注释中
+	text     *regexp.Regexp // 在多行文字块中时为它的结束行
+	inAction bool           // 是否在跨行的活动中
+}
+
+// line 整理一行
+func (f *formatter) line(raw string) {
+	raw = strings.TrimRight(raw, " \t")
+	trimmed := strings.TrimSpace(raw)
+	lower := strings.ToLower(trimmed)
+
+	switch {
+	case f.other != "":
+		if lower == f.other {
+			f.other = ""
+		}
+		f.verbatim(raw)
+		return
+	case f.comment:
+		f.comment = !strings.Contains(trimmed, "'/")
+		f.verbatim(raw)
+		return
+	case f.inAction:
+		f.inAction = !actionEnd.MatchString(trimmed)
+		f.verbatim(raw)
+		return
+	case f.text != nil:
+		if f.text.MatchString(lower) {
+			f.text = nil
+			f.emit(normalizeKeyword(trimmed))
+			return
+		}
+		f.verbatim(raw)
+		return
+	}
+
+	if strings.HasPrefix(lower, "@start") {
+		if lower == "@startuml" || strings.HasPrefix(lower, "@startuml ") || strings.HasPrefix(lower, "@startuml(") {
+			f.uml, f.stack = true, nil
+			f.out = append(f.out, outLine{text: normalizeKeyword(trimmed)})
+			return
+		}
+		f.other = "@end" + strings.Fields(lower)[0][len("@start"):]
+		f.verbatim(raw)
+		return
+	}
+	if !f.uml {
+		f.verbatim(raw)
+		return
+	}
+	if strings.HasPrefix(lower, "@enduml") {
+		f.uml, f.stack = false, nil
+		f.out = append(f.out, outLine{text: normalizeKeyword(trimmed)})
+		return
+	}
+
+	switch {
+	case trimmed == "":
+		f.out = append(f.out, outLine{})
+		return
+	case strings.HasPrefix(trimmed, "/'"):
+		f.comment = !strings.Contains(trimmed[2:], "'/")
+		f.emit(trimmed)
+		return
+	case strings.HasPrefix(trimmed, "'"):
+		f.emit(trimmed)
+		return
+	}
+
+	text := normalizeKeyword(trimmed)
+	if f.closes(lower) {
+		f.stack = f.stack[:len(f.stack)-1]
+		f.emit(text)
+		return
+	}
+	if f.separates(lower) {
+		// 与打开块的行对齐，之后仍在块中
+		top := f.stack[len(f.stack)-1]
+		f.stack = f.stack[:len(f.stack)-1]
+		f.emit(text)
+		f.stack = append(f.stack, top)
+		return
+	}
+	f.emit(text)
+	for _, t := range textBlocks {
+		if t.start.MatchString(lower) {
+			f.text = t.end
+			return
+		}
+	}
+	if strings.HasPrefix(trimmed, ":") && !actionEnd.MatchString(trimmed) {
+		f.inAction = true
+		return
+	}
+	if b, ok := opens(lower); ok {
+		f.stack = append(f.stack, b)
+	}
+}
+
+// emit 按当前的层级缩进输出一行
+func (f *formatter) emit(text string) {
+	f.out = append(f.out, outLine{indent: strings.Repeat(Indent, len(f.stack)), text: text})
+}
+
+// verbatim 原样输出一行
+func (f *formatter) verbatim(raw string) {
+	f.out = append(f.out, outLine{text: raw, verbatim: true})
+}
+
+// closes 判断行是否结束当前所在的块
+func (f *formatter) closes(lower string) bool {
+	return len(f.stack) > 0 && matchRule(closers, lower, f.stack[len(f.stack)-1])
+}
+
+// separates 判断行是否分隔当前所在的块
+func (f *formatter) separates(lower string) bool {
+	return len(f.stack) > 0 && matchRule(separators, lower, f.stack[len(f.stack)-1])
+}
+
+// matchRule 判断行是否匹配rules中要求当前所在的块为current的规则
+func matchRule(rules []rule, lower string, current block) bool {
+	for _, r := range rules {
+		if !r.pattern.MatchString(lower) {
+			continue
+		}
+		for _, b := range r.blocks {
+			if b == current {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// opens 返回行打开的块
+func opens(lower string) (block, bool) {
+	if strings.HasSuffix(lower, "{") && !strings.HasPrefix(lower, "}") {
+		return braceBlock, true
+	}
+	for _, r := range openers {
+		if r.pattern.MatchString(lower) {
+			// 单行定义的函数，例如 !function $double($a) !return $a + $a
+			if r.blocks[0] == ppDefBlock && strings.Contains(lower, "!return") {
+				return 0, false
+			}
+			return r.blocks[0], true
+		}
+	}
+	return 0, false
+}
+
+// normalizeKeyword 把行首的关键字改为小写。行首的词后面是箭头时它是参与者的名称，例如 Start -> End，保持不变
+func normalizeKeyword(text string) string {
+	end := strings.IndexAny(text, " \t({")
+	if end < 0 {
+		end = len(text)
+	}
+	word := text[:end]
+	lower := strings.ToLower(word)
+	if word == lower || !keywords[lower] {
+		return text
+	}
+	if fields := strings.Fields(text[end:]); len(fields) > 0 && arrowPattern.MatchString(fields[0]) {
+		return text
+	}
+	return lower + text[end:]
+}
+
+// message 是可以对齐的一行消息或关系：左侧、箭头、右侧和冒号后的文字
+type message struct {
+	left, arrow, right, label string
+	hasLabel                  bool
+}
+
+// parseMessage 解析 A -> B : 文字 形式的行，箭头两侧都需要有空格；不是这种形式时返回false
+func parseMessage(text string) (message, bool) {
+	var m message
+	rest := text
+	if strings.HasPrefix(rest, `"`) {
+		end := strings.Index(rest[1:], `"`)
+		if end < 0 {
+			return m, false
+		}
+		m.left, rest = rest[:end+2], rest[end+2:]
+	} else {
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			return m, false
+		}
+		m.left, rest = rest[:end], rest[end:]
+	}
+	if !strings.HasPrefix(rest, " ") && !strings.HasPrefix(rest, "\t") {
+		return m, false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) < 2 || !arrowPattern.MatchString(fields[0]) {
+		return m, false
+	}
+	m.arrow = fields[0]
+	rest = strings.TrimSpace(rest)[len(m.arrow):]
+	if !strings.HasPrefix(rest, " ") && !strings.HasPrefix(rest, "\t") {
+		return m, false
+	}
+
+	// 冒号前是右侧，引号中的冒号不算
+	quoted := false
+	colon := -1
+	for i, r := range rest {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	m.right = strings.TrimSpace(rest)
+	if colon >= 0 {
+		m.right = strings.TrimSpace(rest[:colon])
+		m.label = strings.TrimSpace(rest[colon+1:])
+		m.hasLabel = true
+	}
+	if m.right == "" {
+		return m, false
+	}
+	return m, true
+}
+
+// alignArrows 对齐缩进相同的连续消息：箭头从同一列开始，箭头后的右侧从同一列开始，有文字的消息冒号在同一列
+func alignArrows(lines []outLine) {
+	for start := 0; start < len(lines); {
+		if _, ok := alignable(lines[start]); !ok {
+			start++
+			continue
+		}
+		end := start + 1
+		for end < len(lines) && lines[end].indent == lines[start].indent {
+			if _, ok := alignable(lines[end]); !ok {
+				break
+			}
+			end++
+		}
+		if end-start > 1 {
+			alignRun(lines[start:end])
+		}
+		start = end
+	}
+}
+
+// alignable 返回可以对齐的行解析出的消息
+func alignable(l outLine) (message, bool) {
+	if l.verbatim || l.text == "" {
+		return message{}, false
+	}
+	return parseMessage(l.text)
+}
+
+// alignRun 对齐一组连续的消息
+func alignRun(run []outLine) {
+	messages := make([]message, len(run))
+	leftWidth, arrowWidth, rightWidth := 0, 0, 0
+	for i, l := range run {
+		m, _ := parseMessage(l.text)
+		messages[i] = m
+		leftWidth = max(leftWidth, displayWidth(m.left))
+		arrowWidth = max(arrowWidth, displayWidth(m.arrow))
+		if m.hasLabel {
+			rightWidth = max(rightWidth, displayWidth(m.right))
+		}
+	}
+	for i, m := range messages {
+		text := pad(m.left, leftWidth) + " " + pad(m.arrow, arrowWidth) + " "
+		if m.hasLabel {
+			text += pad(m.right, rightWidth) + " :"
+			if m.label != "" {
+				text += " " + m.label
+			}
+		} else {
+			text += m.right
+		}
+		run[i].text = text
+	}
+}
+
+// pad 在s后补空格，直到显示宽度为w
+func pad(s string, w int) string {
+	return s + strings.Repeat(" ", w-displayWidth(s))
+}
+
+// displayWidth 返回s在等宽字体中的显示宽度，中日韩文字等全角字符占两列
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		switch width.LookupRune(r).Kind() {
+		case width.EastAsianWide, width.EastAsianFullwidth:
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// max 返回较大的数
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,74 @@
+package formatter
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name, source, want string
+	}{
+		{
+			"嵌套块按层级缩进",
+			"@startuml\nalt ok\nA -> B\n    else failed\nloop 3 times\nB -> A\nend\nend\n@enduml\n",
+			"@startuml\nalt ok\n  A -> B\nelse failed\n  loop 3 times\n    B -> A\n  end\nend\n@enduml\n",
+		},
+		{
+			"连续的消息对齐箭头和冒号",
+			"@startuml\nAlice -> Bob: hello\nBob --> Alice :ok\nAlice -> Bob\n@enduml\n",
+			"@startuml\nAlice ->  Bob   : hello\nBob   --> Alice : ok\nAlice ->  Bob\n@enduml\n",
+		},
+		{
+			"中文按两列宽度对齐",
+			"@startuml\n用户 -> A : 登录\nBob -> A : x\n@enduml\n",
+			"@startuml\n用户 -> A : 登录\nBob  -> A : x\n@enduml\n",
+		},
+		{
+			"关键字改为小写，参与者名称不变",
+			"@StartUML\nPARTICIPANT Alice\nStart -> End\nTitle 标题\n@EndUML\n",
+			"@startuml\nparticipant Alice\nStart -> End\ntitle 标题\n@enduml\n",
+		},
+		{
+			"活动图",
+			"@startuml\nstart\nif (ok?) then (yes)\n:a;\nelse (no)\nwhile (more?)\n:b;\nendwhile\nendif\nfork\n:c;\nfork again\n:d;\nend fork\nstop\n@enduml\n",
+			"@startuml\nstart\nif (ok?) then (yes)\n  :a;\nelse (no)\n  while (more?)\n    :b;\n  endwhile\nendif\nfork\n  :c;\nfork again\n  :d;\nend fork\nstop\n@enduml\n",
+		},
+		{
+			"活动图中的end不结束块",
+			"@startuml\nif (x) then\nend\nendif\n@enduml\n",
+			"@startuml\nif (x) then\n  end\nendif\n@enduml\n",
+		},
+		{
+			"花括号和预处理",
+			"@startuml\n!procedure $p($x)\npackage P {\nclass $x\n}\n!endprocedure\n!function $d($a) !return $a + $a\n!if %true()\n$p(A)\n!else\n$p(B)\n!endif\n@enduml\n",
+			"@startuml\n!procedure $p($x)\n  package P {\n    class $x\n  }\n!endprocedure\n!function $d($a) !return $a + $a\n!if %true()\n  $p(A)\n!else\n  $p(B)\n!endif\n@enduml\n",
+		},
+		{
+			"注释、多行注释和跨行的动作保持原样",
+			"@startuml\n  ' 注释\nnote left of A\n   *  列表\nend note\n/'\n   块注释\n'/\n:第一行\n   第二行;\n@enduml\n",
+			"@startuml\n' 注释\nnote left of A\n   *  列表\nend note\n/'\n   块注释\n'/\n:第一行\n   第二行;\n@enduml\n",
+		},
+		{
+			"其他类型的图表保持原样，去掉行尾空白和多余的空行",
+			"@startjson\n{\n   \"a\": 1   \n}\n@endjson\n\n\n",
+			"@startjson\n{\n   \"a\": 1\n}\n@endjson\n",
+		},
+		{
+			"没有@start行的片段整理全部内容",
+			"group G\nA -> B\nend",
+			"group G\n  A -> B\nend\n",
+		},
+		{
+			"保持CRLF换行",
+			"@startuml\r\nbox B\r\nparticipant A\r\nend box\r\n@enduml\r\n",
+			"@startuml\r\nbox B\r\n  participant A\r\nend box\r\n@enduml\r\n",
+		},
+	}
+	for _, tt := range tests {
+		got := Format(tt.source)
+		if got != tt.want {
+			t.Errorf("%s:\n得到\n%s\n应为\n%s", tt.name, got, tt.want)
+		}
+		if again := Format(got); again != got {
+			t.Errorf("%s: 整理后的源码再次整理应不变，得到\n%s", tt.name, again)
+		}
+	}
+}
@@ -2,14 +2,19 @@ module plantumlmacviewer
 
 go 1.21
 
-require fyne.io/fyne/v2 v2.6.0
+require (
+	fyne.io/fyne/v2 v2.6.0
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/huangyingw/plantumlmacviewer_go/render v0.0.0
+	golang.org/x/image v0.24.0
+	golang.org/x/text v0.22.0
+)
 
 require (
 	fyne.io/systray v1.11.0 // indirect
 	github.com/BurntSushi/toml v1.4.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fredbi/uri v1.1.0 // indirect
-	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/fyne-io/gl-js v0.1.0 // indirect
 	github.com/fyne-io/glfw-js v0.2.0 // indirect
 	github.com/fyne-io/image v0.1.1 // indirect
@@ -32,9 +37,9 @@ require (
 	github.com/srwiley/rasterx v0.0.0-20220730225603-2ab79fcdd4ef // indirect
 	github.com/stretchr/testify v1.10.0 // indirect
 	github.com/yuin/goldmark v1.7.8 // indirect
-	golang.org/x/image v0.24.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
-	golang.org/x/text v0.22.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/huangyingw/plantumlmacviewer_go/render => ./render
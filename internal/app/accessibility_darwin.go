@@ -0,0 +1,63 @@
+//go:build darwin
+
+package app
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Cocoa
+#include <stdlib.h>
+#import <Cocoa/Cocoa.h>
+
+static NSWindow *viewerWindow(void) {
+	NSWindow *window = [NSApp mainWindow];
+	if (window == nil) {
+		window = [[NSApp windows] firstObject];
+	}
+	return window;
+}
+
+static void setContentAccessibilityLabel(const char *label) {
+	NSView *view = [viewerWindow() contentView];
+	if (view == nil) {
+		return;
+	}
+	[view setAccessibilityElement:YES];
+	[view setAccessibilityRole:NSAccessibilityImageRole];
+	[view setAccessibilityLabel:[NSString stringWithUTF8String:label]];
+}
+
+static void postAnnouncement(const char *message) {
+	NSDictionary *info = @{
+		NSAccessibilityAnnouncementKey: [NSString stringWithUTF8String:message],
+		NSAccessibilityPriorityKey: @(NSAccessibilityPriorityHigh),
+	};
+	NSAccessibilityPostNotificationWithUserInfo(NSApp, NSAccessibilityAnnouncementRequestedNotification, info);
+}
+
+static int shouldReduceMotion(void) {
+	return [[NSWorkspace sharedWorkspace] accessibilityDisplayShouldReduceMotion] ? 1 : 0;
+}
+*/
+import "C"
+
+import "unsafe"
+
+// setAccessibilityLabel 把窗口内容作为图像提供给VoiceOver，label是它的替代文本。
+// Fyne自己绘制界面，没有辅助功能信息，读屏软件只能读到这里设置的描述。需要在主线程中调用
+func setAccessibilityLabel(label string) {
+	cLabel := C.CString(label)
+	defer C.free(unsafe.Pointer(cLabel))
+	C.setContentAccessibilityLabel(cLabel)
+}
+
+// announce 让VoiceOver读出消息，不需要移动焦点。需要在主线程中调用
+func announce(message string) {
+	cMessage := C.CString(message)
+	defer C.free(unsafe.Pointer(cMessage))
+	C.postAnnouncement(cMessage)
+}
+
+// systemReduceMotion 返回系统设置中的“减弱动态效果”是否开启
+func systemReduceMotion() bool {
+	return C.shouldReduceMotion() != 0
+}
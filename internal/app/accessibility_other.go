@@ -0,0 +1,14 @@
+//go:build !darwin
+
+package app
+
+// setAccessibilityLabel 目前只支持macOS的VoiceOver，其他平台不做任何事
+func setAccessibilityLabel(label string) {}
+
+// announce 目前只支持macOS的VoiceOver，其他平台不做任何事
+func announce(message string) {}
+
+// systemReduceMotion 目前只能检测macOS的“减弱动态效果”，其他平台返回false
+func systemReduceMotion() bool {
+	return false
+}
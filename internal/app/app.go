@@ -0,0 +1,342 @@
+// Package app 组装PlantUML Viewer的主窗口：标签页、菜单、快捷键，以及打开其他进程发来的文件。
+package app
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/internal/instance"
+	"plantumlmacviewer/internal/ipc"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/plantuml"
+	"plantumlmacviewer/ui"
+)
+
+// openTimeout 等待UI线程打开IPC收到的文件的最长时间
+const openTimeout = 5 * time.Second
+
+// App 是运行中的应用实例
+type App struct {
+	fyneApp  fyne.App
+	window   fyne.Window
+	mainUI   *ui.MainUI
+	settings *config.Config
+	session  *config.Session   // 工作区状态，导出和导入设置时使用
+	lock     *instance.Lock    // 单实例锁，关闭窗口时释放，可以为nil
+	renderer plantuml.Renderer // 渲染图表，为nil时使用plantuml.DefaultRenderer
+	events   *event.Bus        // 打开、关闭文件和渲染的事件
+
+	startupVirtual []ipc.VirtualFile // 启动时打开的虚拟文件
+
+	mainRoot   string                      // 主窗口显示的工作区根目录，window模式下使用
+	workspaces map[string]*workspaceWindow // window模式下其他工作区的根目录对应的窗口
+
+	viewportLockItem *fyne.MenuItem // “锁定缩放与滚动位置”菜单项，切换时需要同步勾选状态
+	pauseWatchItem   *fyne.MenuItem // “暂停监控文件变化”菜单项，通过快捷键或IPC切换时需要同步勾选状态
+}
+
+// New 创建应用，fyneApp、settings、lock和renderer由调用方创建后传入
+func New(fyneApp fyne.App, settings *config.Config, lock *instance.Lock, renderer plantuml.Renderer) *App {
+	fyneApp.Settings().SetTheme(theme.LightTheme())
+	return &App{
+		fyneApp:  fyneApp,
+		settings: settings,
+		lock:     lock,
+		renderer: renderer,
+		events:   event.NewBus(),
+	}
+}
+
+// quit 停止所有文件监控，释放单实例锁并关闭窗口
+func (a *App) quit() {
+	// 关闭窗口时，停止所有窗口中的文件监控，删除已确认丢弃的草稿
+	for _, mainUI := range a.allUIs() {
+		mainUI.StopAllMonitoring()
+		mainUI.DiscardDrafts()
+	}
+
+	// 移除锁文件并退出
+	a.lock.Release()
+	a.window.Close()
+}
+
+// Events 返回应用的事件总线，用于订阅打开、关闭文件和渲染等事件
+func (a *App) Events() *event.Bus {
+	return a.events
+}
+
+// Run 创建主窗口并打开files，阻塞直到应用退出
+// follow不为空时另外打开一个跟随标签，始终显示匹配该模式的最新文件
+func (a *App) Run(files []string, follow string) {
+	// 打开服务器上的文件时，检查远程文件的变化
+	a.watchRemote()
+
+	// 窗口重新获得焦点时，按设置检查并刷新已变化的文件
+	a.fyneApp.Lifecycle().SetOnEnteredForeground(func() {
+		// 系统的“减弱动态效果”可能在切换到其他程序时修改过
+		a.applyReduceMotion()
+		if a.settings.RefreshOnFocus {
+			log.Println("窗口获得焦点，检查已打开的文件是否有变化")
+			for _, mainUI := range a.allUIs() {
+				mainUI.RefreshChangedFiles()
+			}
+		}
+	})
+
+	// 按设置和系统的“减弱动态效果”关闭动画
+	a.applyReduceMotion()
+
+	// 创建主窗口
+	a.window = a.fyneApp.NewWindow("PlantUML Viewer")
+
+	if len(files) > 0 {
+		a.mainRoot = config.WorkspaceRoot(files[0])
+	}
+
+	// 设置窗口标题
+	if len(files) == 0 {
+		log.Println("没有指定要打开的文件，请通过命令行参数提供PUML文件路径")
+		a.window.SetTitle("PlantUML Viewer - 未加载文件")
+	} else {
+		a.window.SetTitle("PlantUML Viewer - 正在加载...")
+	}
+
+	// 居中显示窗口
+	a.window.CenterOnScreen()
+
+	// 设置窗口关闭事件
+	// Cmd+Q和关闭窗口都会经过这里，打开的标签较多时按设置先确认
+	a.window.SetCloseIntercept(func() {
+		if a.mainUI != nil {
+			if message := a.mainUI.QuitConfirmation(); message != "" {
+				dialog.ShowConfirm("退出", message, func(ok bool) {
+					if ok {
+						a.quit()
+					}
+				}, a.window)
+				return
+			}
+		}
+		a.quit()
+	})
+
+	// 初始化UI并设置到窗口
+	a.mainUI, _ = ui.NewMainUI(a.window, files, a.settings, a.renderer, a.events)
+	session, err := config.LoadSession(config.SessionPath())
+	if err != nil {
+		log.Printf("警告：%v，不恢复标签的标题和颜色", err)
+	}
+	a.mainUI.SetSession(session)
+	a.session = session
+	// 在Dock图标上显示渲染出错的标签数，一眼就能看出最近一次保存是否弄坏了图表
+	a.mainUI.SetOnStatusChanged(func(errors, pending int) {
+		setDockBadge(dockBadge(errors, pending))
+	})
+	// 图表的标题和说明作为窗口内容的替代文本，切换标签和当前标签渲染出错时由读屏软件读出
+	a.mainUI.SetOnDescriptionChanged(setAccessibilityLabel)
+	a.mainUI.SetOnAnnounce(announce)
+	content := a.mainUI.GetContent()
+	a.window.SetContent(content)
+
+	if follow != "" {
+		if err := a.mainUI.FollowGlob(follow); err != nil {
+			log.Printf("无法跟随 %s: %v", logging.Path(follow), err)
+		}
+	}
+
+	for _, file := range a.startupVirtual {
+		if err := a.mainUI.OpenVirtual(file.Name, file.Text, ui.OpenOptions{Page: file.Options.Page}); err != nil {
+			log.Printf("虚拟文件 %s 渲染失败: %v", logging.Path(file.Name), err)
+		}
+	}
+
+	// 上次没有正常退出时，恢复未保存的草稿
+	a.mainUI.RecoverDrafts()
+
+	// 恢复上次打开的项目，列出关闭期间有变化的图表
+	a.mainUI.RestoreProject()
+
+	// 添加键盘快捷键
+	a.setupShortcuts()
+
+	// 设置主菜单
+	a.setupMainMenu()
+
+	// 设置窗口为主窗口
+	a.window.SetMaster()
+
+	// 显示窗口
+	log.Println("显示窗口")
+	a.window.Show()
+
+	// 设置窗口为全屏模式
+	log.Println("设置窗口为全屏模式")
+	a.window.SetFullScreen(true)
+
+	// 使用goroutine在窗口显示全屏模式后显示提示
+	go func() {
+		// 延迟一秒，确保全屏模式已经完全生效
+		time.Sleep(1 * time.Second)
+		fyne.Do(func() {
+			// 临时显示提示信息
+			if a.mainUI != nil {
+				// 使用临时状态提示
+				a.window.SetTitle("PlantUML Viewer - 按ESC或F11可退出全屏模式")
+
+				// 5秒后恢复原标题
+				go func() {
+					time.Sleep(5 * time.Second)
+					fyne.Do(a.mainUI.UpdateTitle)
+				}()
+			}
+		})
+	}()
+
+	// 运行应用程序
+	log.Println("开始运行应用")
+	a.fyneApp.Run()
+}
+
+// OpenVirtualOnStart 在Run创建窗口后打开虚拟文件，用于启动时从标准输入读取的内容
+func (a *App) OpenVirtualOnStart(file ipc.VirtualFile) {
+	a.startupVirtual = append(a.startupVirtual, file)
+}
+
+// OpenVirtual 在UI线程中打开或更新其他进程发来的虚拟文件，返回结果，可以用作ipc.Server.HandleVirtual的处理函数
+func (a *App) OpenVirtual(file ipc.VirtualFile) ipc.Result {
+	opts := backgroundOptions(file.Options, a.settings.OpenInBackground)
+	var err error
+	if uiErr := a.onMainUI(func() {
+		if !opts.NoFocus {
+			a.window.RequestFocus()
+		}
+		err = a.mainUI.OpenVirtual(file.Name, file.Text, ui.OpenOptions{Page: opts.Page, NoSelect: opts.NoSelect})
+	}); uiErr != nil {
+		err = uiErr
+	}
+	return NewResult(file.Name, err)
+}
+
+// backgroundOptions 在设置了后台打开时让文件不获取焦点也不切换标签，页码等其他选项保持不变
+func backgroundOptions(opts ipc.OpenOptions, background bool) ipc.OpenOptions {
+	if background {
+		opts.NoFocus = true
+		opts.NoSelect = true
+	}
+	return opts
+}
+
+// OpenFiles 在UI线程中打开其他进程发来的文件，按顺序返回每个文件的结果，可以用作ipc.Handler。
+// options与paths一一对应，为nil时都使用默认选项。只有所有文件都要求不获取焦点时才不激活窗口，
+// 设置了在后台打开时所有文件都不获取焦点也不切换标签。设置了按工作区分开时，文件在所在工作区的分组或窗口中打开
+func (a *App) OpenFiles(paths []string, options []ipc.OpenOptions) []ipc.Result {
+	// 逐个检查文件，记录每个文件的结果
+	var results []ipc.Result
+	var validFiles []string
+	var validOptions []ipc.OpenOptions
+	var validIndexes []int
+	focus := false
+	for i, file := range paths {
+		if file == "" {
+			continue
+		}
+		absPath, err := ValidateFile(file)
+		if err != nil {
+			results = append(results, NewResult(file, err))
+			continue
+		}
+		var opts ipc.OpenOptions
+		if i < len(options) {
+			opts = options[i]
+		}
+		opts = backgroundOptions(opts, a.settings.OpenInBackground)
+		focus = focus || !opts.NoFocus
+		validIndexes = append(validIndexes, len(results))
+		validFiles = append(validFiles, absPath)
+		validOptions = append(validOptions, opts)
+		results = append(results, ipc.Result{File: absPath})
+	}
+	log.Printf("有效文件列表: %q", logging.Paths(validFiles))
+
+	if len(validFiles) == 0 {
+		return results
+	}
+
+	// 使用通道来协调文件处理完成，并传回每个文件的结果
+	done := make(chan []ipc.Result, 1)
+
+	go func() {
+		// 使用UI线程处理
+		fyne.Do(func() {
+			// 打开所有文件，记录打开了文件的窗口
+			opened := make([]ipc.Result, len(validFiles))
+			var windows []fyne.Window
+			for i, file := range validFiles {
+				log.Printf("尝试打开文件: %s", logging.Path(file))
+				var err error
+				if a.mainUI != nil {
+					target, window, opts := a.routeFile(file, ui.OpenOptions{
+						Page:     validOptions[i].Page,
+						NoSelect: validOptions[i].NoSelect,
+					})
+					err = target.OpenFileWith(file, opts)
+					if len(windows) == 0 || windows[len(windows)-1] != window {
+						windows = append(windows, window)
+					}
+				}
+				opened[i] = NewResult(file, err)
+			}
+
+			// 保持窗口获取焦点，最后一个文件所在的窗口在最前面
+			if focus {
+				for _, window := range windows {
+					window.RequestFocus()
+				}
+			}
+
+			log.Println("所有文件已处理完成")
+			done <- opened
+		})
+	}()
+
+	// 等待文件处理完成或超时
+	select {
+	case opened := <-done:
+		log.Println("文件处理已完成")
+		for i, index := range validIndexes {
+			results[index] = opened[i]
+		}
+	case <-time.After(openTimeout):
+		log.Println("警告: 文件处理超时")
+		for i, index := range validIndexes {
+			results[index] = NewResult(validFiles[i], fmt.Errorf("文件处理超时"))
+		}
+	}
+	return results
+}
+
+// 应用程序图标资源（需要添加实际的图标数据）
+func resourceIconPng() fyne.Resource {
+	// 在实际应用中，这里应该返回一个真正的图标资源
+	// 简化处理，返回空资源
+	return fyne.NewStaticResource("icon.png", []byte{})
+}
+
+// dockBadge 返回Dock角标的文字：有渲染错误时为出错的标签数，只有待更新的标签时为“…”，否则为空
+func dockBadge(errors, pending int) string {
+	switch {
+	case errors > 0:
+		return strconv.Itoa(errors)
+	case pending > 0:
+		return "…"
+	}
+	return ""
+}
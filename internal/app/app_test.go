@@ -0,0 +1,927 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/test"
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/export"
+	"plantumlmacviewer/internal/ipc"
+	"plantumlmacviewer/internal/publish"
+	"plantumlmacviewer/plantuml"
+	"plantumlmacviewer/plantuml/plantumltest"
+	"plantumlmacviewer/ui"
+)
+
+func TestValidateFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.puml")
+	if err := ioutil.WriteFile(file, []byte("@startuml\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 相对路径应转换为绝对路径
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ValidateFile("a.puml")
+	if err != nil {
+		t.Fatalf("ValidateFile: %v", err)
+	}
+	if !filepath.IsAbs(got) || filepath.Base(got) != "a.puml" {
+		t.Fatalf("应返回绝对路径，得到 %s", got)
+	}
+
+	if _, err := ValidateFile(filepath.Join(dir, "missing.puml")); err == nil {
+		t.Fatal("不存在的文件应返回错误")
+	}
+	if _, err := ValidateFile(dir); err == nil {
+		t.Fatal("目录应返回错误")
+	}
+}
+
+func TestValidateFilesSkipsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.puml")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := ValidateFiles([]string{filepath.Join(dir, "missing.puml"), file, dir})
+	if len(got) != 1 || got[0] != file {
+		t.Fatalf("只应保留有效文件，得到 %q", got)
+	}
+}
+
+func TestNewResultIncludesErrorLine(t *testing.T) {
+	if r := NewResult("/a.puml", nil); !r.OK || r.Error != "" {
+		t.Fatalf("成功的结果不正确: %+v", r)
+	}
+
+	r := NewResult("/a.puml", &plantuml.RenderError{Line: 7, Err: errors.New("exit status 200")})
+	if r.OK || r.Line != 7 || r.Error == "" {
+		t.Fatalf("渲染错误的结果应带行号: %+v", r)
+	}
+
+	if r := NewResult("/a.puml", errors.New("其他错误")); r.OK || r.Line != 0 {
+		t.Fatalf("普通错误不应带行号: %+v", r)
+	}
+}
+
+func TestReportResults(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := ReportResults(&stdout, &stderr, []ipc.Result{
+		{File: "/a.puml", OK: true},
+		{File: "/b.puml", Error: "语法错误", Line: 3},
+	})
+	if code == 0 {
+		t.Fatal("有失败的文件时应返回非0退出码")
+	}
+
+	var response ipc.Response
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		t.Fatalf("标准输出应为JSON: %v", err)
+	}
+	if len(response.Results) != 2 {
+		t.Fatalf("期望2个结果，得到 %d 个", len(response.Results))
+	}
+	if !strings.Contains(stderr.String(), "/b.puml:3: 语法错误") {
+		t.Fatalf("标准错误应包含失败的文件和行号: %q", stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := ReportResults(&stdout, &stderr, []ipc.Result{{File: "/a.puml", OK: true}}); code != 0 {
+		t.Fatalf("全部成功时退出码应为0，得到 %d", code)
+	}
+	if stderr.Len() != 0 {
+		t.Fatalf("全部成功时不应输出到标准错误: %q", stderr.String())
+	}
+}
+
+func TestReportResultsAsGitHubAnnotations(t *testing.T) {
+	workspace := t.TempDir()
+	t.Setenv("GITHUB_WORKSPACE", workspace)
+	if err := SetReportFormat("xml"); err == nil {
+		t.Error("不支持的格式应返回错误")
+	}
+	if err := SetReportFormat(ReportGitHub); err != nil {
+		t.Fatal(err)
+	}
+	defer SetReportFormat(ReportJSON)
+
+	var stdout, stderr bytes.Buffer
+	code := ReportResults(&stdout, &stderr, []ipc.Result{
+		{File: filepath.Join(workspace, "docs", "a.puml"), OK: true},
+		{File: filepath.Join(workspace, "docs", "b,c.puml"), Error: "语法错误\n100%", Line: 3},
+		{File: "/elsewhere/d.puml", Error: "无法读取文件"},
+	})
+	if code == 0 {
+		t.Fatal("有失败的文件时应返回非0退出码")
+	}
+	want := "::error file=docs/b%2Cc.puml,line=3,title=PlantUML::语法错误%0A100%25\n" +
+		"::error file=/elsewhere/d.puml,title=PlantUML::无法读取文件\n"
+	if stdout.String() != want {
+		t.Errorf("标准输出应为工作流命令\n得到: %q\n期望: %q", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "b,c.puml:3: 语法错误") {
+		t.Errorf("标准错误仍应包含失败的文件: %q", stderr.String())
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	workspace := t.TempDir()
+	t.Setenv("GITHUB_WORKSPACE", workspace)
+	var buf bytes.Buffer
+	err := WriteJUnit(&buf, []ipc.Result{
+		{File: filepath.Join(workspace, "a.puml"), OK: true, Output: "/out/a.png", Duration: 1.25},
+		{File: filepath.Join(workspace, "docs", "api", "b.puml"), Error: "执行 plantuml 失败（第3行）\nSyntax Error?", Line: 3, Duration: 0.5},
+		{File: filepath.Join(workspace, "c.puml"), OK: true, UpToDate: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var suites struct {
+		Suites []struct {
+			Tests    int     `xml:"tests,attr"`
+			Failures int     `xml:"failures,attr"`
+			Skipped  int     `xml:"skipped,attr"`
+			Time     float64 `xml:"time,attr"`
+			Cases    []struct {
+				Name      string  `xml:"name,attr"`
+				ClassName string  `xml:"classname,attr"`
+				Time      float64 `xml:"time,attr"`
+				Failure   *struct {
+					Message string `xml:"message,attr"`
+					Text    string `xml:",chardata"`
+				} `xml:"failure"`
+				Skipped *struct{} `xml:"skipped"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("应输出有效的XML: %v\n%s", err, buf.String())
+	}
+	if len(suites.Suites) != 1 {
+		t.Fatalf("应有一个测试套件: %s", buf.String())
+	}
+	suite := suites.Suites[0]
+	if suite.Tests != 3 || suite.Failures != 1 || suite.Skipped != 1 || suite.Time != 1.75 {
+		t.Errorf("测试套件的统计不正确: %+v", suite)
+	}
+	failed := suite.Cases[1]
+	if failed.Name != "docs/api/b.puml" || failed.ClassName != "plantumlviewer.docs.api" || failed.Time != 0.5 {
+		t.Errorf("测试用例应为相对路径并按目录分组: %+v", failed)
+	}
+	if failed.Failure == nil || failed.Failure.Message != "执行 plantuml 失败（第3行）" || !strings.HasPrefix(failed.Failure.Text, "docs/api/b.puml:3: ") {
+		t.Errorf("失败的用例应带上错误和出错行: %+v", failed.Failure)
+	}
+	if suite.Cases[0].ClassName != "plantumlviewer" || suite.Cases[0].Failure != nil || suite.Cases[2].Skipped == nil {
+		t.Errorf("成功的用例不应失败，已是最新的用例应跳过: %+v", suite.Cases)
+	}
+}
+
+func TestExportFilesRejectsBadArguments(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := ExportFiles(nil, "gif", "", 1, false, false, false, &stdout, &stderr); code != 2 {
+		t.Fatalf("不支持的格式应返回退出码2，得到 %d", code)
+	}
+	if code := ExportFiles(nil, "png", "", 0, false, false, false, &stdout, &stderr); code != 2 {
+		t.Fatalf("无效的比例应返回退出码2，得到 %d", code)
+	}
+}
+
+func TestExportDiffRejectsBadArguments(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	for _, tt := range []struct {
+		from, out, format string
+		scale             float64
+	}{
+		{"", "diff.png", "", 1},
+		{"HEAD", "", "", 1},
+		{"HEAD", "diff.gif", "gif", 1},
+		{"HEAD", "diff.html", "", 0},
+	} {
+		if code := ExportDiff("a.puml", tt.from, "", tt.out, tt.format, tt.scale, &stdout, &stderr); code != 2 {
+			t.Errorf("ExportDiff(%+v) 应返回退出码2，得到 %d", tt, code)
+		}
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("参数错误时不应输出结果，得到 %s", stdout.String())
+	}
+}
+
+func TestExportGalleryReportsMissingFiles(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := ExportGallery(nil, t.TempDir(), "图库", 0, &stdout, &stderr); code != 2 {
+		t.Fatalf("无效的比例应返回退出码2，得到 %d", code)
+	}
+
+	outDir := filepath.Join(t.TempDir(), "gallery")
+	missing := filepath.Join(t.TempDir(), "missing.puml")
+	if code := ExportGallery([]string{missing}, outDir, "图库", 1, &stdout, &stderr); code != 1 {
+		t.Fatalf("有失败的文件时应返回退出码1，得到 %d", code)
+	}
+	var response ipc.Response
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		t.Fatalf("标准输出应为JSON: %v", err)
+	}
+	if len(response.Results) != 1 || response.Results[0].OK {
+		t.Fatalf("不存在的文件应失败: %+v", response.Results)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "index.html")); err != nil {
+		t.Errorf("仍应生成图库首页: %v", err)
+	}
+}
+
+func TestConvertSkipsUpToDateOutputs(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := Convert(t.TempDir(), "", "svg", 1, 1, &stdout, &stderr); code != 2 {
+		t.Fatalf("没有输出目录时应返回退出码2，得到 %d", code)
+	}
+
+	srcDir := t.TempDir()
+	source := filepath.Join(srcDir, "sub", "a.puml")
+	if err := os.MkdirAll(filepath.Dir(source), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(source, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 输出和缓存都已是最新时不需要调用PlantUML
+	outDir := t.TempDir()
+	output := filepath.Join(outDir, "sub", "a.svg")
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(output, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := export.Digest(source, "svg", export.Scale{Factor: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := export.LoadCache(outDir)
+	cache.Set(output, digest)
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := Convert(srcDir, outDir, "svg", 1, 2, &stdout, &stderr); code != 0 {
+		t.Fatalf("应成功，退出码 %d，%s", code, stderr.String())
+	}
+	var response ipc.Response
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		t.Fatalf("标准输出应为JSON: %v", err)
+	}
+	if len(response.Results) != 1 || !response.Results[0].UpToDate || response.Results[0].Output != output {
+		t.Fatalf("应跳过已是最新的输出: %+v", response.Results)
+	}
+	if !strings.Contains(stderr.String(), "1个已是最新") {
+		t.Errorf("应输出汇总，得到 %q", stderr.String())
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "docs", "drafts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	good := writePuml(t, filepath.Join(dir, "docs", "good.puml"))
+	bad := writePuml(t, filepath.Join(dir, "docs", "bad.puml"))
+	writePuml(t, filepath.Join(dir, "docs", "drafts", "wip.puml"))
+	readme := filepath.Join(dir, "README.md")
+	if err := ioutil.WriteFile(readme, []byte("# docs\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(saved func(string, []string) error) { checkFile = saved }(checkFile)
+	var mu sync.Mutex
+	var checked []string
+	checkFile = func(file string, includePaths []string) error {
+		mu.Lock()
+		checked = append(checked, file)
+		mu.Unlock()
+		if !reflect.DeepEqual(includePaths, []string{"/shared"}) {
+			t.Errorf("应传入include目录，得到 %v", includePaths)
+		}
+		if file == bad {
+			return &render.Error{Line: 2, Output: "Syntax Error?", Err: errors.New("exit status 200")}
+		}
+		return nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := Check([]string{filepath.Join(dir, "docs"), good}, []string{"drafts"}, []string{"/shared"}, 2, &stdout, &stderr)
+	if code != 1 {
+		t.Fatalf("有语法错误时退出码应为1，得到 %d", code)
+	}
+	sort.Strings(checked)
+	if want := []string{bad, good}; !reflect.DeepEqual(checked, want) {
+		t.Errorf("应只检查一次没有被忽略的图表，检查了 %v", checked)
+	}
+	if !strings.Contains(stderr.String(), bad+":2: ") || !strings.Contains(stderr.String(), "共检查2个图表：1个有错误") {
+		t.Errorf("标准错误应列出有错误的文件和汇总: %q", stderr.String())
+	}
+
+	// 直接给出的文件不检查扩展名，不存在的文件作为失败的结果
+	checked = nil
+	stdout.Reset()
+	stderr.Reset()
+	if code := Check([]string{good, readme, filepath.Join(dir, "missing.puml")}, nil, []string{"/shared"}, 1, &stdout, &stderr); code != 1 {
+		t.Fatalf("有不存在的文件时退出码应为1，得到 %d", code)
+	}
+	if len(checked) != 2 {
+		t.Errorf("应检查直接给出的两个文件，检查了 %v", checked)
+	}
+
+	if code := Check(nil, []string{"["}, nil, 1, &stdout, &stderr); code != 2 {
+		t.Errorf("忽略模式无效时退出码应为2，得到 %d", code)
+	}
+}
+
+func TestFmt(t *testing.T) {
+	dir := t.TempDir()
+	good := writePuml(t, filepath.Join(dir, "good.puml"))
+	messy := filepath.Join(dir, "messy.puml")
+	source := "@startuml\nalt ok\nA -> B\nend\n@enduml\n"
+	if err := ioutil.WriteFile(messy, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只检查时不改写，格式不同的文件失败，出错行为第一处不同的行
+	var stdout, stderr bytes.Buffer
+	if code := Fmt([]string{dir}, nil, true, nil, &stdout, &stderr); code != 1 {
+		t.Fatalf("有格式不同的文件时退出码应为1，得到 %d", code)
+	}
+	if data, _ := ioutil.ReadFile(messy); string(data) != source {
+		t.Error("只检查时不应改写文件")
+	}
+	if !strings.Contains(stderr.String(), messy+":3: ") || !strings.Contains(stderr.String(), "共检查2个图表：1个需要整理格式") {
+		t.Errorf("标准错误应列出格式不同的文件和汇总: %q", stderr.String())
+	}
+
+	// 整理时改写格式不同的文件，之后再检查没有问题
+	stdout.Reset()
+	stderr.Reset()
+	if code := Fmt([]string{dir}, nil, false, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("整理后退出码应为0，得到 %d: %s", code, stderr.String())
+	}
+	var response ipc.Response
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range response.Results {
+		if (r.File == good) != r.UpToDate || (r.File == messy) != (r.Output == messy) {
+			t.Errorf("结果应标出改写的文件，得到 %+v", r)
+		}
+	}
+	if code := Fmt([]string{good, messy}, nil, true, nil, &stdout, &stderr); code != 0 {
+		t.Errorf("整理后再检查应没有问题，得到 %d", code)
+	}
+
+	// 从标准输入读取时整理后写入标准输出
+	stdout.Reset()
+	if code := Fmt([]string{StdinPath}, nil, false, strings.NewReader(source), &stdout, &stderr); code != 0 || stdout.String() != "@startuml\nalt ok\n  A -> B\nend\n@enduml\n" {
+		t.Errorf("应输出整理后的源码，得到 %d %q", code, stdout.String())
+	}
+	if code := Fmt([]string{StdinPath}, nil, true, strings.NewReader(source), &stdout, &stderr); code != 1 {
+		t.Errorf("标准输入的格式不同时退出码应为1，得到 %d", code)
+	}
+}
+
+func TestSendFilesWithoutRunningInstance(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.puml")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := SendFiles(filepath.Join(dir, "missing.sock"), []string{file, filepath.Join(dir, "missing.puml")}, ipc.OpenOptions{}, &stdout, &stderr)
+	if code == 0 {
+		t.Fatal("无法连接时应返回非0退出码")
+	}
+
+	var response ipc.Response
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		t.Fatalf("标准输出应为JSON: %v", err)
+	}
+	if len(response.Results) != 2 || response.Results[0].OK || response.Results[1].OK {
+		t.Fatalf("两个文件都应失败: %+v", response.Results)
+	}
+	if response.Results[0].File != file {
+		t.Fatalf("结果应保持原来的顺序: %+v", response.Results)
+	}
+}
+
+func TestDockBadge(t *testing.T) {
+	cases := []struct {
+		errors, pending int
+		want            string
+	}{
+		{0, 0, ""},
+		{0, 2, "…"},
+		{3, 2, "3"},
+	}
+	for _, c := range cases {
+		if got := dockBadge(c.errors, c.pending); got != c.want {
+			t.Errorf("dockBadge(%d, %d) = %q，应为 %q", c.errors, c.pending, got, c.want)
+		}
+	}
+}
+
+func TestShortcutHelp(t *testing.T) {
+	menu := fyne.NewMainMenu(
+		fyne.NewMenu("文件", menuItem("新建草稿", cmdShortcut(fyne.KeyN, false), nil), fyne.NewMenuItem("从剪贴板新建草稿", nil)),
+		fyne.NewMenu("标签", menuItem("重新打开关闭的标签", cmdShortcut(fyne.KeyT, true), nil)),
+	)
+	lines := shortcutHelp(menu)
+	want := []string{"Cmd+N: 文件 ▸ 新建草稿", "Cmd+Shift+T: 标签 ▸ 重新打开关闭的标签"}
+	if len(lines) != len(want)+len(extraShortcuts) {
+		t.Fatalf("应只列出带快捷键的菜单项和额外按键，得到 %v", lines)
+	}
+	for i, w := range want {
+		if lines[i] != w {
+			t.Errorf("第%d行为 %q，应为 %q", i, lines[i], w)
+		}
+	}
+}
+
+func TestSetFyneAnimationsDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fyne", "settings.json")
+	old := FyneSettingsFile
+	FyneSettingsFile = path
+	defer func() { FyneSettingsFile = old }()
+
+	read := func() map[string]interface{} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var settings map[string]interface{}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			t.Fatal(err)
+		}
+		return settings
+	}
+	if err := setFyneAnimationsDisabled(true); err != nil {
+		t.Fatal(err)
+	}
+	if read()["no_animations"] != true {
+		t.Fatal("没有设置文件时应创建并关闭动画")
+	}
+	if err := ioutil.WriteFile(path, []byte(`{"scale": 1.5, "no_animations": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := setFyneAnimationsDisabled(false); err != nil {
+		t.Fatal(err)
+	}
+	if settings := read(); settings["no_animations"] != false || settings["scale"] != 1.5 {
+		t.Errorf("应重新打开动画并保留其他设置，得到 %v", settings)
+	}
+}
+
+func TestBackgroundOptions(t *testing.T) {
+	opts := ipc.OpenOptions{Page: 2}
+	if got := backgroundOptions(opts, false); got != opts {
+		t.Errorf("没有设置后台打开时不应改变选项: %+v", got)
+	}
+	want := ipc.OpenOptions{Page: 2, NoFocus: true, NoSelect: true}
+	if got := backgroundOptions(opts, true); got != want {
+		t.Errorf("backgroundOptions() = %+v，应为 %+v", got, want)
+	}
+}
+
+func TestReportElementAt(t *testing.T) {
+	source := "@startuml\nparticipant Alice\nactor Bob\nBob -> Alice\n@enduml\n"
+
+	var stdout, stderr bytes.Buffer
+	if code := ReportElementAt(source, 4, &stdout, &stderr); code != 0 {
+		t.Fatalf("退出码为 %d，stderr: %s", code, stderr.String())
+	}
+	want := `{"line":4,"kind":"participant","name":"Bob","id":"Bob","declared":3}` + "\n"
+	if stdout.String() != want {
+		t.Errorf("输出为 %s，应为 %s", stdout.String(), want)
+	}
+
+	stdout.Reset()
+	if code := ReportElementAt(source, 1, &stdout, &stderr); code == 0 {
+		t.Error("没有元素时应返回非0的退出码")
+	}
+	if stdout.String() != `{"line":1}`+"\n" {
+		t.Errorf("没有元素时输出为 %s", stdout.String())
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	d := diagnostics("/a.puml", nil)
+	if d.File != "/a.puml" || d.Diagnostics == nil || len(d.Diagnostics) != 0 {
+		t.Errorf("渲染成功时应返回空的诊断信息: %+v", d)
+	}
+
+	d = diagnostics("/a.puml", &plantuml.RenderError{Line: 5, Output: "Syntax Error?"})
+	if len(d.Diagnostics) != 1 || d.Diagnostics[0].Line != 5 || d.Diagnostics[0].Message == "" {
+		t.Errorf("渲染失败时应返回出错的行和原因: %+v", d)
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		rel      string
+		want     bool
+	}{
+		{[]string{"drafts"}, "drafts/a.puml", true},
+		{[]string{"drafts"}, "docs/drafts/a.puml", true},
+		{[]string{"*-wip.puml"}, "docs/a-wip.puml", true},
+		{[]string{"docs/gen"}, "docs/gen/a.puml", true},
+		{[]string{"docs/gen"}, "src/docs/gen/a.puml", false},
+		{[]string{"docs/*.puml"}, "docs/a.puml", true},
+		{[]string{"docs/*.puml"}, "docs/api/a.puml", false},
+		{nil, "a.puml", false},
+	}
+	for _, tt := range tests {
+		if got := ignored(tt.patterns, tt.rel); got != tt.want {
+			t.Errorf("ignored(%v, %s) = %v，应为 %v", tt.patterns, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	if _, err := NewDaemon(nil); err == nil {
+		t.Error("没有目录时应返回错误")
+	}
+	if _, err := NewDaemon([]config.DaemonTarget{{Source: t.TempDir()}}); err == nil {
+		t.Error("没有输出目录时应返回错误")
+	}
+
+	srcDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+	source := filepath.Join(srcDir, "a.puml")
+	for _, file := range []string{source, filepath.Join(srcDir, "drafts", "b.puml")} {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 输出已是最新时不需要调用PlantUML
+	output := filepath.Join(outDir, "a.svg")
+	if err := ioutil.WriteFile(output, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := export.Digest(source, "svg", export.Scale{Factor: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := export.LoadCache(outDir)
+	cache.Set(output, digest)
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDaemon([]config.DaemonTarget{{Source: srcDir, Out: outDir, Format: "svg", Ignore: []string{"drafts"}}})
+	if err != nil {
+		t.Fatalf("NewDaemon: %v", err)
+	}
+	results := d.poll()
+	if len(results) != 1 || results[0].File != source || !results[0].UpToDate {
+		t.Fatalf("第一次检查应处理所有没有忽略的文件，得到 %+v", results)
+	}
+	if results := d.poll(); len(results) != 0 {
+		t.Fatalf("文件没有变化时不应处理，得到 %+v", results)
+	}
+
+	// 暂停期间不检查，恢复后处理期间有变化的文件
+	d.Pause()
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(source, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if results := d.poll(); len(results) != 0 {
+		t.Fatalf("暂停期间不应处理，得到 %+v", results)
+	}
+	d.Resume()
+	if results := d.poll(); len(results) != 1 || !results[0].UpToDate {
+		t.Fatalf("恢复后应处理有变化的文件，内容没变时跳过渲染，得到 %+v", results)
+	}
+
+	// 通过IPC发来的文件在下次检查时处理，不在监控目录中或被忽略的文件返回错误
+	sent := d.Export([]string{source, filepath.Join(srcDir, "drafts", "b.puml"), filepath.Join(outDir, "c.puml")}, nil)
+	if !sent[0].OK || sent[1].OK || sent[2].OK {
+		t.Fatalf("Export 的结果不正确: %+v", sent)
+	}
+	if results := d.poll(); len(results) != 1 || results[0].File != source {
+		t.Fatalf("应处理发来的文件，得到 %+v", results)
+	}
+	if status := d.Status(); len(status) != 1 || status[0].File != source || status[0].Time.IsZero() || !status[0].Result.OK {
+		t.Fatalf("应记录最近一次导出的结果，得到 %+v", status)
+	}
+
+	// 强制重新导出时不使用缓存
+	d.Rerender([]string{source})
+	if results := d.poll(); len(results) != 1 || results[0].UpToDate {
+		t.Fatalf("强制重新导出时不应跳过渲染，得到 %+v", results)
+	}
+}
+
+func TestUploadResults(t *testing.T) {
+	if _, err := NewDaemon([]config.DaemonTarget{{Source: t.TempDir(), Out: t.TempDir(), Upload: &config.BucketUpload{URL: "https://example.com"}}}); err == nil {
+		t.Error("上传地址无效时应返回错误")
+	}
+
+	// 把aws替换为记录上传的对象、对象名包含fail时失败的脚本
+	dir := t.TempDir()
+	log := filepath.Join(dir, "uploads")
+	script := filepath.Join(dir, "aws")
+	body := "#!/bin/sh\nfor last; do :; done\ncase \"$last\" in *fail*) echo denied >&2; exit 1;; esac\necho \"$last\" >> " + log + "\n"
+	if err := ioutil.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := publish.AWS
+	publish.AWS = script
+	defer func() { publish.AWS = old }()
+
+	outDir := filepath.Join(dir, "out")
+	batch := []ipc.Result{
+		{File: "a.puml", OK: true, Output: filepath.Join(outDir, "api", "a.png")},
+		{File: "b.puml", OK: true, Output: filepath.Join(outDir, "b.png"), UpToDate: true},
+		{File: "c.puml", Error: "Syntax Error?"},
+		{File: "fail.puml", OK: true, Output: filepath.Join(outDir, "fail.png")},
+	}
+	uploadResults(config.BucketUpload{URL: "s3://docs/diagrams"}, outDir, batch)
+	data, _ := ioutil.ReadFile(log)
+	if got := string(data); got != "s3://docs/diagrams/api/a.png\n" {
+		t.Errorf("应只上传重新导出的文件，上传了 %q", got)
+	}
+	if !batch[0].OK || !batch[1].OK || batch[3].OK || !strings.Contains(batch[3].Error, "denied") {
+		t.Errorf("上传失败的文件应记为失败: %+v", batch)
+	}
+}
+
+func TestDaemonDependencies(t *testing.T) {
+	srcDir := t.TempDir()
+	d, err := NewDaemon([]config.DaemonTarget{{Source: srcDir, Out: t.TempDir()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := d.targets[0]
+	source := filepath.Join(srcDir, "a.puml")
+	common, style := filepath.Join(srcDir, "common.iuml"), filepath.Join(srcDir, "style.iuml")
+	for file, content := range map[string]string{
+		source: "@startuml\n!include common.iuml\nA -> B\n@enduml\n",
+		common: "skinparam monochrome true\n",
+	} {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := []string{source}
+	if changed := d.changedFiles(target, files); len(changed) != 1 {
+		t.Fatalf("第一次检查应导出文件，得到 %v", changed)
+	}
+
+	// 只有引用的文件变化时也重新导出
+	later := time.Now().Add(time.Minute)
+	if err := ioutil.WriteFile(common, []byte("!include style.iuml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(common, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if changed := d.changedFiles(target, files); len(changed) != 1 {
+		t.Fatalf("引用的文件变化后应重新导出，得到 %v", changed)
+	}
+	if changed := d.changedFiles(target, files); len(changed) != 0 {
+		t.Fatalf("没有变化时不应导出，得到 %v", changed)
+	}
+
+	// 引用的文件中新加的引用也在监控范围内
+	if err := ioutil.WriteFile(style, []byte("skinparam monochrome false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed := d.changedFiles(target, files); len(changed) != 1 {
+		t.Fatalf("再引用的文件出现后应重新导出，得到 %v", changed)
+	}
+}
+
+func TestDaemonStatus(t *testing.T) {
+	srcDir := t.TempDir()
+	d, err := NewDaemon([]config.DaemonTarget{{Source: srcDir, Out: t.TempDir()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := filepath.Join(srcDir, "a.puml"), filepath.Join(srcDir, "docs", "b.puml")
+	d.stamps[a] = fileStamp{}
+	d.record([]ipc.Result{{File: b, Error: "执行 plantuml 失败（第3行）\nSyntax Error?", Line: 3}})
+
+	var opened string
+	s := &daemonStatus{d: d, open: func(file string) error {
+		opened = file
+		return nil
+	}}
+	var out bytes.Buffer
+	s.draw(&out)
+	screen := out.String()
+	for _, want := range []string{"1个目录，2个文件，1个错误", "  1 · --:--:--  a.puml\n", "docs/b.puml:3  执行 plantuml 失败（第3行）\n"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("状态界面应包含 %q:\n%s", want, screen)
+		}
+	}
+
+	// 屏幕上还没有显示新增的文件，编号仍按显示的列表
+	d.stamps[filepath.Join(srcDir, "0.puml")] = fileStamp{}
+	if msg := s.handle("o 2"); opened != b || !strings.Contains(msg, "b.puml") {
+		t.Errorf("o 2 应打开第二个文件，打开了 %q，%s", opened, msg)
+	}
+	out.Reset()
+	s.draw(&out)
+	if !strings.Contains(out.String(), "0.puml") {
+		t.Errorf("文件变化后应重画状态界面:\n%s", out.String())
+	}
+	out.Reset()
+	s.draw(&out)
+	if out.Len() != 0 {
+		t.Error("状态没有变化时不应重画")
+	}
+	if msg := s.handle("o 4"); !strings.Contains(msg, "没有编号") {
+		t.Errorf("编号超出范围时应提示，得到 %s", msg)
+	}
+	s.handle("p")
+	if !d.Paused() {
+		t.Error("p 应暂停监控")
+	}
+	s.handle("r 2")
+	if !d.forced[a] {
+		t.Error("r 2 应强制重新导出第二个文件")
+	}
+	s.handle("q")
+	select {
+	case <-d.Done():
+	default:
+		t.Error("q 应停止守护模式")
+	}
+}
+
+func TestDaemonMetrics(t *testing.T) {
+	srcDir := t.TempDir()
+	d, err := NewDaemon([]config.DaemonTarget{{Source: srcDir, Out: t.TempDir()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := filepath.Join(srcDir, "a.puml"), filepath.Join(srcDir, "b.puml")
+	d.stamps[a] = fileStamp{}
+	d.record([]ipc.Result{
+		{File: a, OK: true, Duration: 0.8},
+		{File: b, Error: "Syntax Error?", Duration: 3},
+		{File: a, OK: true, UpToDate: true},
+	})
+
+	server, err := ListenMetrics(d, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	defer server.Close()
+	resp, err := http.Get("http://" + server.Addr() + MetricsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/openmetrics-text") {
+		t.Errorf("应以OpenMetrics格式返回，得到 %s", resp.Header.Get("Content-Type"))
+	}
+	metrics := string(data)
+	for _, want := range []string{
+		"plantumlviewer_daemon_renders_total 2\n",
+		"plantumlviewer_daemon_render_failures_total 1\n",
+		"plantumlviewer_daemon_cache_hits_total 1\n",
+		"plantumlviewer_daemon_cache_hit_ratio 0.3333333333333333\n",
+		"plantumlviewer_daemon_render_duration_seconds_bucket{le=\"1\"} 1\n",
+		"plantumlviewer_daemon_render_duration_seconds_bucket{le=\"5\"} 2\n",
+		"plantumlviewer_daemon_render_duration_seconds_sum 3.8\n",
+		"plantumlviewer_daemon_watched_files 2\n",
+		"plantumlviewer_daemon_failing_files 1\n",
+		"plantumlviewer_daemon_paused 0\n",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("指标应包含 %q:\n%s", want, metrics)
+		}
+	}
+	if !strings.HasSuffix(metrics, "# EOF\n") {
+		t.Error("OpenMetrics应以 # EOF 结尾")
+	}
+
+	if resp, err := http.Get("http://" + server.Addr() + "/other"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("其他路径应返回404，得到 %v %v", resp, err)
+	}
+}
+
+func TestRouteFileByWorkspace(t *testing.T) {
+	fyneApp := test.NewTempApp(t)
+	dir := t.TempDir()
+	var alpha, beta []string
+	for _, repo := range []string{"alpha", "beta"} {
+		if err := os.MkdirAll(filepath.Join(dir, repo, ".git"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a.puml", "b.puml"} {
+		alpha = append(alpha, writePuml(t, filepath.Join(dir, "alpha", name)))
+		beta = append(beta, writePuml(t, filepath.Join(dir, "beta", name)))
+	}
+	loose := writePuml(t, filepath.Join(dir, "loose.puml"))
+
+	settings := config.Default()
+	settings.WatchFiles = false
+	a := New(fyneApp, settings, nil, plantumltest.NewRenderer())
+	a.window = fyneApp.NewWindow("PlantUML Viewer")
+	a.mainUI, _ = ui.NewMainUI(a.window, nil, settings, a.renderer, a.events)
+	a.window.SetContent(a.mainUI.GetContent())
+	a.session = config.NewSession()
+	t.Cleanup(func() {
+		for _, mainUI := range a.allUIs() {
+			mainUI.StopAllMonitoring()
+		}
+	})
+
+	// 默认都在主窗口中打开，不加入分组
+	if target, _, opts := a.routeFile(alpha[0], ui.OpenOptions{}); target != a.mainUI || opts.Group != "" {
+		t.Errorf("不按工作区分开时应在主窗口中打开，得到分组 %q", opts.Group)
+	}
+
+	settings.Workspaces = config.WorkspacesGroup
+	if _, _, opts := a.routeFile(alpha[0], ui.OpenOptions{Page: 2}); opts.Group != "alpha" || opts.Page != 2 {
+		t.Errorf("应加入以工作区命名的分组，得到 %+v", opts)
+	}
+	if _, _, opts := a.routeFile(loose, ui.OpenOptions{}); opts.Group != "" {
+		t.Errorf("不属于工作区的文件不应加入分组，得到 %q", opts.Group)
+	}
+
+	settings.Workspaces = config.WorkspacesWindow
+	open := func(file string) *ui.MainUI {
+		target, _, opts := a.routeFile(file, ui.OpenOptions{})
+		if err := target.OpenFileWith(file, opts); err != nil {
+			t.Fatalf("OpenFileWith(%s): %v", file, err)
+		}
+		return target
+	}
+	// 主窗口没有打开文件时显示第一个发来的工作区
+	if open(alpha[0]) != a.mainUI {
+		t.Error("第一个工作区应在主窗口中打开")
+	}
+	betaUI := open(beta[0])
+	if betaUI == a.mainUI || len(a.workspaces) != 1 {
+		t.Fatalf("其他工作区应在新窗口中打开，有 %d 个工作区窗口", len(a.workspaces))
+	}
+	if open(beta[1]) != betaUI || open(alpha[1]) != a.mainUI || open(loose) != a.mainUI {
+		t.Error("文件应在所在工作区的窗口中打开，不属于工作区的文件在主窗口中打开")
+	}
+	if got := betaUI.OpenedFiles(); !reflect.DeepEqual(got, beta) {
+		t.Errorf("工作区窗口应打开 %v，得到 %v", beta, got)
+	}
+	if mainUI, _ := a.uiForFile(beta[1]); mainUI != betaUI {
+		t.Error("uiForFile应返回打开了文件的工作区窗口")
+	}
+	if len(a.allUIs()) != 2 {
+		t.Errorf("allUIs应包含主窗口和工作区窗口，得到 %d 个", len(a.allUIs()))
+	}
+}
+
+// writePuml 在path上写入一个简单的PlantUML文件，返回path
+func writePuml(t *testing.T, path string) string {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
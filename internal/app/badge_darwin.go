@@ -0,0 +1,25 @@
+//go:build darwin
+
+package app
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Cocoa
+#include <stdlib.h>
+#import <Cocoa/Cocoa.h>
+
+static void setDockBadgeLabel(const char *label) {
+	NSString *text = label[0] == '\0' ? nil : [NSString stringWithUTF8String:label];
+	[[NSApp dockTile] setBadgeLabel:text];
+}
+*/
+import "C"
+
+import "unsafe"
+
+// setDockBadge 设置Dock图标上的角标，label为空时清除。需要在主线程中调用
+func setDockBadge(label string) {
+	cLabel := C.CString(label)
+	defer C.free(unsafe.Pointer(cLabel))
+	C.setDockBadgeLabel(cLabel)
+}
@@ -0,0 +1,6 @@
+//go:build !darwin
+
+package app
+
+// setDockBadge 只有macOS有Dock角标，其他平台不做任何事
+func setDockBadge(label string) {}
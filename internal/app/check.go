@@ -0,0 +1,116 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"plantumlmacviewer/export"
+	"plantumlmacviewer/internal/ipc"
+	"plantumlmacviewer/plantuml"
+)
+
+// checkFile 只检查文件的语法，测试中可以替换，不需要安装PlantUML
+var checkFile = plantuml.CheckFile
+
+// Check 不打开窗口也不生成图像，只检查paths中的图表文件和目录中所有图表的语法（paths为空时为当前目录），
+// 跳过匹配ignore中的模式的文件，includePaths是!include查找文件的目录。用jobs个并发任务检查（不大于0时为CPU核数），
+// 每个文件的结果写入stdout，有错误的文件和汇总写入stderr，返回退出码
+func Check(paths, ignore, includePaths []string, jobs int, stdout, stderr io.Writer) int {
+	for _, pattern := range ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			fmt.Fprintf(stderr, "忽略模式 %s 无效: %v\n", pattern, err)
+			return 2
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	start := time.Now()
+	files, results := checkTargets(paths, ignore)
+	checked := make([]ipc.Result, len(files))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				checked[index] = timed(func() ipc.Result {
+					return NewResult(files[index], checkFile(files[index], includePaths))
+				})
+			}
+		}()
+	}
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	results = append(results, checked...)
+
+	code := ReportResults(stdout, stderr, results)
+	fmt.Fprintln(stderr, checkSummary(results, time.Since(start)))
+	return code
+}
+
+// checkTargets 返回paths中需要检查的图表文件的绝对路径：目录展开为其中的所有图表，文件不检查扩展名，
+// 这样提交前的检查可以直接传入改动的文件。忽略模式的规则与守护模式相同，目录中的文件按相对于目录的路径匹配，
+// 直接给出的文件按给出的路径匹配。无法访问的路径作为失败的结果返回
+func checkTargets(paths, ignore []string) ([]string, []ipc.Result) {
+	var files []string
+	var failed []ipc.Result
+	seen := make(map[string]bool)
+	add := func(file string) {
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
+		}
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			failed = append(failed, NewResult(path, fmt.Errorf("无法访问文件: %v", err)))
+			continue
+		}
+		if !info.IsDir() {
+			if !ignored(ignore, filepath.Clean(path)) {
+				add(path)
+			}
+			continue
+		}
+		diagrams, err := export.FindDiagrams(path)
+		if err != nil {
+			failed = append(failed, NewResult(path, err))
+			continue
+		}
+		for _, file := range diagrams {
+			if rel, err := filepath.Rel(path, file); err == nil && !ignored(ignore, rel) {
+				add(file)
+			}
+		}
+	}
+	return files, failed
+}
+
+// checkSummary 返回语法检查的汇总
+func checkSummary(results []ipc.Result, elapsed time.Duration) string {
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	return fmt.Sprintf("共检查%d个图表：%d个有错误，用时%.1f秒", len(results), failed, elapsed.Seconds())
+}
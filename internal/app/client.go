@@ -0,0 +1,71 @@
+package app
+
+import (
+	"fmt"
+	"io"
+
+	"plantumlmacviewer/internal/ipc"
+)
+
+// SendFiles 将文件列表发送到addr上运行中的实例，所有文件使用相同的选项opts，
+// 把每个文件的处理结果写入stdout和stderr并返回退出码
+func SendFiles(addr string, files []string, opts ipc.OpenOptions, stdout, stderr io.Writer) int {
+	if len(files) == 0 {
+		return 0
+	}
+
+	// 本地无法访问的文件直接记为失败，只发送有效的绝对路径
+	results := make([]ipc.Result, len(files))
+	var paths []string
+	var options []ipc.OpenOptions
+	var indexes []int
+	for i, file := range files {
+		absPath, err := ValidateFile(file)
+		if err != nil {
+			results[i] = NewResult(file, err)
+			continue
+		}
+		paths = append(paths, absPath)
+		options = append(options, opts)
+		indexes = append(indexes, i)
+	}
+
+	if len(paths) > 0 {
+		// 运行中的实例最多等待openTimeout处理文件，这里多留一些余量
+		remote, err := ipc.Send(addr, paths, options, 2*openTimeout)
+		for j, i := range indexes {
+			switch {
+			case err != nil:
+				results[i] = NewResult(paths[j], err)
+			case j < len(remote):
+				results[i] = remote[j]
+			default:
+				results[i] = NewResult(paths[j], fmt.Errorf("运行中的实例没有返回该文件的结果"))
+			}
+		}
+	}
+
+	return ReportResults(stdout, stderr, results)
+}
+
+// SendVirtual 将虚拟文件发送到addr上运行中的实例，把处理结果写入stdout和stderr并返回退出码
+func SendVirtual(addr string, file ipc.VirtualFile, stdout, stderr io.Writer) int {
+	result, err := ipc.SendVirtual(addr, file, 2*openTimeout)
+	if err != nil {
+		result = NewResult(file.Name, err)
+	}
+	return ReportResults(stdout, stderr, []ipc.Result{result})
+}
+
+// SendCommand 让addr上运行中的实例执行命令，失败时把原因写入stderr并返回非0的退出码
+func SendCommand(addr, command string, stderr io.Writer) int {
+	result, err := ipc.SendCommand(addr, command, openTimeout)
+	if err == nil && !result.OK {
+		err = fmt.Errorf("%s", result.Error)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "执行命令 %s 失败: %v\n", command, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"plantumlmacviewer/export"
+	"plantumlmacviewer/internal/companion"
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/internal/ipc"
+	"plantumlmacviewer/plantuml"
+)
+
+// ServeCompanion 在server上注册编辑器扩展可以调用的方法，并在每次渲染完成或关闭标签后推送文件的诊断信息，
+// 在查看器中按住Cmd点击元素时推送定义它的行。
+// 套接字接口和HTTP接口都用它注册
+func (a *App) ServeCompanion(server companion.Endpoint) {
+	server.Handle(companion.MethodOpen, a.companionOpen)
+	server.Handle(companion.MethodReveal, a.companionReveal)
+	server.Handle(companion.MethodErrors, a.companionErrors)
+	server.Handle(companion.MethodExport, a.companionExport)
+	server.Handle(companion.MethodUpdate, a.companionUpdate)
+
+	a.events.Subscribe(func(e event.Event) {
+		server.Notify(companion.NotifyDiagnostics, diagnostics(e.Path, e.Err))
+	}, event.RenderFinished, event.RenderFailed, event.TabClosed)
+	a.events.Subscribe(func(e event.Event) {
+		server.Notify(companion.NotifyGoto, companion.Location{File: e.Path, Line: e.Line})
+	}, event.SourceRequested)
+}
+
+// diagnostics 把渲染错误转换为编辑器的诊断信息，err为nil时没有诊断信息
+func diagnostics(file string, err error) companion.Diagnostics {
+	d := companion.Diagnostics{File: file, Diagnostics: []companion.Diagnostic{}}
+	if err != nil {
+		d.Diagnostics = append(d.Diagnostics, companion.Diagnostic{Line: plantuml.ErrorLine(err), Message: err.Error()})
+	}
+	return d
+}
+
+// companionOpen 打开文件，返回渲染后的诊断信息。无法访问文件时返回错误
+func (a *App) companionOpen(params json.RawMessage) (interface{}, error) {
+	var p companion.OpenParams
+	if err := companion.DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	absPath, err := ValidateFile(p.File)
+	if err != nil {
+		return nil, err
+	}
+	opts := ipc.OpenOptions{Page: p.Page, NoFocus: p.NoFocus, NoSelect: p.NoSelect}
+	return resultDiagnostics(a.OpenFiles([]string{absPath}, []ipc.OpenOptions{opts})[0]), nil
+}
+
+// resultDiagnostics 把打开文件的结果转换为诊断信息
+func resultDiagnostics(result ipc.Result) companion.Diagnostics {
+	d := companion.Diagnostics{File: result.File, Diagnostics: []companion.Diagnostic{}}
+	if !result.OK {
+		d.Diagnostics = append(d.Diagnostics, companion.Diagnostic{Line: result.Line, Message: result.Error})
+	}
+	return d
+}
+
+// companionReveal 切换到已打开文件的标签并激活窗口
+func (a *App) companionReveal(params json.RawMessage) (interface{}, error) {
+	var p companion.FileParams
+	if err := companion.DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	var err error
+	if uiErr := a.onMainUI(func() {
+		mainUI, window := a.uiForFile(p.File)
+		if err = mainUI.RevealFile(p.File); err == nil {
+			window.RequestFocus()
+		}
+	}); uiErr != nil {
+		return nil, uiErr
+	}
+	return nil, err
+}
+
+// companionErrors 返回已打开文件最近一次渲染的诊断信息
+func (a *App) companionErrors(params json.RawMessage) (interface{}, error) {
+	var p companion.FileParams
+	if err := companion.DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	var open bool
+	var renderErr error
+	if err := a.onMainUI(func() {
+		mainUI, _ := a.uiForFile(p.File)
+		open, renderErr = mainUI.FileRenderError(p.File)
+	}); err != nil {
+		return nil, err
+	}
+	if !open {
+		return nil, fmt.Errorf("文件没有打开: %s", p.File)
+	}
+	return diagnostics(p.File, renderErr), nil
+}
+
+// companionExport 导出文件，返回生成的文件
+func (a *App) companionExport(params json.RawMessage) (interface{}, error) {
+	var p companion.ExportParams
+	if err := companion.DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if !isExportFormat(p.Format) {
+		return nil, fmt.Errorf("不支持的导出格式: %s（支持: %s）", p.Format, strings.Join(export.Formats, ", "))
+	}
+	absPath, err := ValidateFile(p.File)
+	if err != nil {
+		return nil, err
+	}
+	output, err := export.WriteFile(absPath, p.Format, p.OutDir, export.Scale{Label: "1x", Factor: 1}, false)
+	if err != nil {
+		return nil, err
+	}
+	return companion.ExportResult{Output: output}, nil
+}
+
+// companionUpdate 用编辑器发来的未保存内容更新该文件的虚拟文件标签，在后台渲染，不抢走焦点
+func (a *App) companionUpdate(params json.RawMessage) (interface{}, error) {
+	var p companion.UpdateParams
+	if err := companion.DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.File == "" {
+		return nil, fmt.Errorf("没有指定文件")
+	}
+	file := ipc.VirtualFile{Name: p.File, Text: p.Text, Options: ipc.OpenOptions{NoFocus: true, NoSelect: true}}
+	return resultDiagnostics(a.OpenVirtual(file)), nil
+}
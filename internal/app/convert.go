@@ -0,0 +1,150 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"plantumlmacviewer/export"
+	"plantumlmacviewer/internal/ipc"
+)
+
+// Convert 不打开窗口，将srcDir中的所有图表按format批量导出到outDir，保持原来的目录结构。
+// 用jobs个并发任务渲染（不大于0时为CPU核数），源码和设置都没有变化的图表根据输出目录中的缓存跳过。
+// 每个文件的结果以JSON写入stdout，汇总写入stderr，返回退出码
+func Convert(srcDir, outDir, format string, factor float64, jobs int, stdout, stderr io.Writer) int {
+	if !isExportFormat(format) {
+		fmt.Fprintf(stderr, "不支持的导出格式: %s（支持: %s，或%s表示按渲染配置）\n", format, strings.Join(export.Formats, ", "), export.AutoFormat)
+		return 2
+	}
+	if factor <= 0 {
+		fmt.Fprintf(stderr, "导出比例必须大于0: %g\n", factor)
+		return 2
+	}
+	if outDir == "" {
+		fmt.Fprintln(stderr, "需要用 -out 指定输出目录")
+		return 2
+	}
+	if info, err := os.Stat(srcDir); err != nil || !info.IsDir() {
+		fmt.Fprintf(stderr, "%s 不是目录\n", srcDir)
+		return 2
+	}
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	scale := export.Scale{Label: fmt.Sprintf("%gx", factor), Factor: factor}
+
+	files, err := export.FindDiagrams(srcDir)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		fmt.Fprintf(stderr, "无法创建输出目录: %v\n", err)
+		return 1
+	}
+	cache := export.LoadCache(outDir)
+
+	start := time.Now()
+	results := convertFiles(files, srcDir, outDir, format, scale, cache, jobs)
+	if err := cache.Save(); err != nil {
+		fmt.Fprintf(stderr, "警告：%v\n", err)
+	}
+	code := ReportResults(stdout, stderr, results)
+	fmt.Fprintln(stderr, convertSummary(results, time.Since(start)))
+	return code
+}
+
+// convertFiles 用jobs个并发任务把srcDir中的files导出到outDir，按files的顺序返回结果
+func convertFiles(files []string, srcDir, outDir, format string, scale export.Scale, cache *export.Cache, jobs int) []ipc.Result {
+	if jobs <= 0 {
+		jobs = 1
+	}
+	results := make([]ipc.Result, len(files))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = timed(func() ipc.Result {
+					return convertFile(files[index], srcDir, outDir, format, scale, cache)
+				})
+			}
+		}()
+	}
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// convertOutput 返回srcDir中的文件按format导出到outDir中对应的子目录时的路径，format为auto时按渲染配置选择
+func convertOutput(file, srcDir, outDir, format string) (string, error) {
+	rel, err := filepath.Rel(srcDir, file)
+	if err != nil {
+		return "", err
+	}
+	if format == export.AutoFormat {
+		if format, err = export.ProfileFormat(file); err != nil {
+			return "", err
+		}
+	}
+	base := filepath.Base(file)
+	return filepath.Join(outDir, filepath.Dir(rel), strings.TrimSuffix(base, filepath.Ext(base))+"."+format), nil
+}
+
+// convertFile 将srcDir中的文件导出到outDir中对应的子目录，输出已是最新时跳过
+func convertFile(file, srcDir, outDir, format string, scale export.Scale, cache *export.Cache) ipc.Result {
+	output, err := convertOutput(file, srcDir, outDir, format)
+	if err != nil {
+		return NewResult(file, err)
+	}
+	dir := filepath.Dir(output)
+	format = strings.TrimPrefix(filepath.Ext(output), ".")
+
+	digest, err := export.Digest(file, format, scale)
+	if err != nil {
+		return NewResult(file, err)
+	}
+	// 动态的图表没有摘要，每次都重新导出
+	if digest != "" && cache.UpToDate(output, digest) {
+		return ipc.Result{File: file, OK: true, Output: output, UpToDate: true}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return NewResult(file, fmt.Errorf("无法创建输出目录: %v", err))
+	}
+	if _, err := export.WriteFile(file, format, dir, scale, false); err != nil {
+		return NewResult(file, err)
+	}
+	if digest != "" {
+		cache.Set(output, digest)
+	}
+	return ipc.Result{File: file, OK: true, Output: output}
+}
+
+// convertSummary 返回批量转换的汇总
+func convertSummary(results []ipc.Result, elapsed time.Duration) string {
+	var converted, upToDate, failed int
+	for _, r := range results {
+		switch {
+		case !r.OK:
+			failed++
+		case r.UpToDate:
+			upToDate++
+		default:
+			converted++
+		}
+	}
+	return fmt.Sprintf("共%d个图表：转换%d个，%d个已是最新，%d个失败，用时%.1f秒",
+		len(results), converted, upToDate, failed, elapsed.Seconds())
+}
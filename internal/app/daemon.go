@@ -0,0 +1,436 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/export"
+	"plantumlmacviewer/internal/ipc"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/internal/publish"
+	"plantumlmacviewer/plantuml"
+)
+
+// DaemonInterval 是守护模式检查目录变化的默认间隔
+const DaemonInterval = 2 * time.Second
+
+// fileStamp 是文件的大小和修改时间，以及它引用的图片和!include的文件的状态，用来快速判断上次检查后文件是否可能变化
+type fileStamp struct {
+	size         int64
+	modTime      time.Time
+	dependencies string // 引用的各文件的路径、大小和修改时间，见dependenciesStamp
+}
+
+// Daemon 在不打开窗口的情况下监控目录中的图表，变化后自动导出，让导出结果始终与源码一致。
+// 所有导出都经过同一个渲染队列：同一时间只处理一批文件，每批最多Jobs个文件并行渲染
+type Daemon struct {
+	Interval time.Duration // 检查间隔
+	Jobs     int           // 并行渲染的文件数
+
+	targets []config.DaemonTarget
+	caches  []*export.Cache // 与targets一一对应
+
+	render sync.Mutex // 渲染队列，保证同一时间只有一批导出
+
+	mu           sync.Mutex
+	stamps       map[string]fileStamp  // 上次检查时各文件的状态，没有记录的文件在下次检查时导出
+	dependencies map[string][]string   // 各文件引用的本地图片和!include的文件，文件或它们变化时重新查找
+	forced       map[string]bool       // 下次导出时不使用缓存、强制重新渲染的文件
+	status       map[string]FileStatus // 各文件最近一次导出的结果
+	metrics      daemonMetrics         // 启动以来的统计，见WriteMetrics
+	paused       bool
+	trigger      chan struct{} // 请求立即检查一次
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// FileStatus 是守护模式中一个文件最近一次导出的结果，还没有导出时Time为零值
+type FileStatus struct {
+	File   string
+	Time   time.Time
+	Result ipc.Result
+}
+
+// NewDaemon 检查并创建守护模式，targets中的相对路径按当前目录解析
+func NewDaemon(targets []config.DaemonTarget) (*Daemon, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("没有需要监控的目录，请在配置文件的daemon中设置，或在命令行中指定目录和 -out")
+	}
+	d := &Daemon{
+		Interval:     DaemonInterval,
+		Jobs:         runtime.NumCPU(),
+		stamps:       make(map[string]fileStamp),
+		dependencies: make(map[string][]string),
+		forced:       make(map[string]bool),
+		status:       make(map[string]FileStatus),
+		trigger:      make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+	}
+	for _, t := range targets {
+		if err := normalizeTarget(&t); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(t.Out, 0755); err != nil {
+			return nil, fmt.Errorf("无法创建输出目录: %v", err)
+		}
+		d.targets = append(d.targets, t)
+		d.caches = append(d.caches, export.LoadCache(t.Out))
+	}
+	return d, nil
+}
+
+// normalizeTarget 检查目录设置，转换为绝对路径并填上默认值
+func normalizeTarget(t *config.DaemonTarget) error {
+	if t.Format == "" {
+		t.Format = "png"
+	}
+	if t.Scale == 0 {
+		t.Scale = 1
+	}
+	switch {
+	case t.Out == "":
+		return fmt.Errorf("%s 没有设置输出目录", t.Source)
+	case !isExportFormat(t.Format):
+		return fmt.Errorf("%s 的导出格式 %s 不支持", t.Source, t.Format)
+	case t.Scale < 0:
+		return fmt.Errorf("%s 的导出比例不能小于0", t.Source)
+	}
+	for _, pattern := range t.Ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("无效的忽略模式 %s: %v", pattern, err)
+		}
+	}
+	if t.Upload != nil {
+		if err := t.Upload.Validate(); err != nil {
+			return fmt.Errorf("%s 的%v", t.Source, err)
+		}
+	}
+
+	var err error
+	if t.Source, err = filepath.Abs(t.Source); err != nil {
+		return err
+	}
+	if t.Out, err = filepath.Abs(t.Out); err != nil {
+		return err
+	}
+	if info, err := os.Stat(t.Source); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s 不是目录", t.Source)
+	}
+	return nil
+}
+
+// Run 立即导出一次有变化的文件，之后每隔Interval检查一次，直到调用Stop为止
+func (d *Daemon) Run() {
+	log.Printf("守护模式已启动，监控%d个目录", len(d.targets))
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		d.poll()
+		select {
+		case <-ticker.C:
+		case <-d.trigger:
+		case <-d.stop:
+			log.Println("守护模式已停止")
+			return
+		}
+	}
+}
+
+// Stop 停止Run，可以安全地多次调用
+func (d *Daemon) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+}
+
+// Done 返回Stop之后关闭的通道
+func (d *Daemon) Done() <-chan struct{} {
+	return d.stop
+}
+
+// Pause 暂停检查目录，用作IPC命令的处理函数。暂停期间的变化在恢复后导出
+func (d *Daemon) Pause() error {
+	d.setPaused(true)
+	return nil
+}
+
+// Resume 恢复检查目录并立即导出暂停期间有变化的文件，用作IPC命令的处理函数
+func (d *Daemon) Resume() error {
+	d.setPaused(false)
+	d.requestPoll()
+	return nil
+}
+
+// setPaused 暂停或恢复检查
+func (d *Daemon) setPaused(paused bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paused = paused
+	log.Printf("守护模式暂停: %v", paused)
+}
+
+// Paused 返回是否已暂停检查
+func (d *Daemon) Paused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.paused
+}
+
+// Status 返回监控的所有文件（没有被忽略的）按路径排序的状态
+func (d *Daemon) Status() []FileStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	files := make(map[string]bool, len(d.stamps))
+	for file := range d.stamps {
+		files[file] = true
+	}
+	for file := range d.status {
+		files[file] = true
+	}
+	list := make([]FileStatus, 0, len(files))
+	for file := range files {
+		st, ok := d.status[file]
+		if !ok {
+			st = FileStatus{File: file}
+		}
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].File < list[j].File })
+	return list
+}
+
+// Rerender 与Export相同，但不使用缓存，即使内容没有变化也重新渲染，例如!include引用的文件变化后
+func (d *Daemon) Rerender(paths []string) []ipc.Result {
+	d.mu.Lock()
+	for _, path := range paths {
+		d.forced[path] = true
+	}
+	d.mu.Unlock()
+	return d.Export(paths, nil)
+}
+
+// requestPoll 让Run立即检查一次，已有未处理的请求时不重复
+func (d *Daemon) requestPoll() {
+	select {
+	case d.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Export 让守护模式重新导出paths中的文件，用作IPC的文件处理函数。
+// 文件加入渲染队列后立即返回，不在任何监控目录中或被忽略的文件返回错误
+func (d *Daemon) Export(paths []string, options []ipc.OpenOptions) []ipc.Result {
+	results := make([]ipc.Result, 0, len(paths))
+	queued := false
+	d.mu.Lock()
+	for _, path := range paths {
+		if _, ok := d.targetFor(path); !ok {
+			results = append(results, ipc.Result{File: path, Error: "不在守护模式监控的目录中"})
+			continue
+		}
+		// 删除记录后，下次检查时按有变化处理；缓存中的内容摘要没有变化时仍会跳过
+		delete(d.stamps, path)
+		queued = true
+		results = append(results, ipc.Result{File: path, OK: true})
+	}
+	d.mu.Unlock()
+	if queued {
+		d.requestPoll()
+	}
+	return results
+}
+
+// targetFor 返回path所在的监控目录的序号，不在任何目录中或被忽略时返回false
+func (d *Daemon) targetFor(path string) (int, bool) {
+	for i, t := range d.targets {
+		rel, err := filepath.Rel(t.Source, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if !ignored(t.Ignore, rel) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// poll 没有暂停时检查所有目录，导出有变化的文件，返回处理的结果
+func (d *Daemon) poll() []ipc.Result {
+	d.mu.Lock()
+	paused := d.paused
+	d.mu.Unlock()
+	if paused {
+		return nil
+	}
+
+	d.render.Lock()
+	defer d.render.Unlock()
+	var results []ipc.Result
+	for i, t := range d.targets {
+		files, err := export.FindDiagrams(t.Source)
+		if err != nil {
+			log.Printf("守护模式无法检查目录 %s: %v", logging.Path(t.Source), err)
+			continue
+		}
+		changed := d.changedFiles(t, files)
+		if len(changed) == 0 {
+			continue
+		}
+		d.forget(t, d.caches[i], changed)
+		scale := export.Scale{Label: fmt.Sprintf("%gx", t.Scale), Factor: t.Scale}
+		batch := convertFiles(changed, t.Source, t.Out, t.Format, scale, d.caches[i], d.Jobs)
+		if err := d.caches[i].Save(); err != nil {
+			log.Printf("警告：%v", err)
+		}
+		if t.Upload != nil {
+			uploadResults(*t.Upload, t.Out, batch)
+		}
+		d.record(batch)
+		for _, r := range batch {
+			switch {
+			case !r.OK:
+				log.Printf("守护模式导出 %s 失败: %s", logging.Path(r.File), r.Error)
+			case !r.UpToDate:
+				log.Printf("守护模式已导出 %s: %s", logging.Path(r.File), logging.Path(r.Output))
+			}
+		}
+		results = append(results, batch...)
+	}
+	return results
+}
+
+// uploadResults 把一批结果中重新导出的文件上传到对象存储，导出结果已是最新的文件不上传。
+// 上传失败的文件记为失败，内容再次变化或强制重新导出时重新上传
+func uploadResults(upload config.BucketUpload, outDir string, batch []ipc.Result) {
+	for i, r := range batch {
+		if !r.OK || r.UpToDate {
+			continue
+		}
+		rel, err := filepath.Rel(outDir, r.Output)
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), publish.Timeout)
+		object, err := publish.UploadObject(ctx, upload, r.Output, rel)
+		cancel()
+		if err != nil {
+			batch[i].OK = false
+			batch[i].Error = fmt.Sprintf("已导出到 %s，但%v", r.Output, err)
+			continue
+		}
+		log.Printf("守护模式已上传 %s: %s", logging.Path(r.Output), object)
+	}
+}
+
+// forget 从缓存中删除files中要求强制重新渲染的文件的记录
+func (d *Daemon) forget(t config.DaemonTarget, cache *export.Cache, files []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, file := range files {
+		if !d.forced[file] {
+			continue
+		}
+		delete(d.forced, file)
+		if output, err := convertOutput(file, t.Source, t.Out, t.Format); err == nil {
+			cache.Forget(output)
+		}
+	}
+}
+
+// record 记录一批导出的结果，供Status和WriteMetrics使用
+func (d *Daemon) record(results []ipc.Result) {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.metrics.add(results)
+	for _, r := range results {
+		d.status[r.File] = FileStatus{File: r.File, Time: now, Result: r}
+	}
+}
+
+// changedFiles 返回目录中上次检查后大小或修改时间有变化、且没有被忽略的文件，并记录它们当前的状态
+func (d *Daemon) changedFiles(t config.DaemonTarget, files []string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var changed []string
+	for _, file := range files {
+		rel, err := filepath.Rel(t.Source, file)
+		if err != nil || ignored(t.Ignore, rel) {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		stamp := fileStamp{size: info.Size(), modTime: info.ModTime()}
+		old, ok := d.stamps[file]
+		if !ok || old.size != stamp.size || !old.modTime.Equal(stamp.modTime) {
+			d.dependencies[file] = diagramDependencies(file)
+		}
+		// 只有图片或引用的文件变化时也重新导出，更新后的图标和公共样式不需要修改图表就能出现在导出结果中
+		stamp.dependencies = dependenciesStamp(d.dependencies[file])
+		if ok && stamp.dependencies != old.dependencies {
+			// 引用的文件中可能加上或去掉了其他引用
+			d.dependencies[file] = diagramDependencies(file)
+			stamp.dependencies = dependenciesStamp(d.dependencies[file])
+		}
+		if ok && old == stamp {
+			continue
+		}
+		d.stamps[file] = stamp
+		changed = append(changed, file)
+	}
+	return changed
+}
+
+// diagramDependencies 返回图表引用的本地图片和!include的文件（见plantuml.Dependencies），无法读取时返回nil
+func diagramDependencies(file string) []string {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	return plantuml.Dependencies(source, filepath.Dir(file))
+}
+
+// dependenciesStamp 返回文件的路径、大小和修改时间，不存在的文件也记录下来，出现后随之变化
+func dependenciesStamp(files []string) string {
+	var b strings.Builder
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(&b, "%s:-;", file)
+		}
+	}
+	return b.String()
+}
+
+// ignored 判断相对路径rel是否匹配某个忽略模式。包含/的模式匹配rel或它所在的上级目录，
+// 不包含/的模式匹配路径中的任何一级名称，例如 drafts 忽略所有drafts目录中的文件
+func ignored(patterns []string, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	parts := strings.Split(rel, "/")
+	for _, pattern := range patterns {
+		for i := range parts {
+			name := parts[i]
+			if strings.Contains(pattern, "/") {
+				name = strings.Join(parts[:i+1], "/")
+			}
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
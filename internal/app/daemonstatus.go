@@ -0,0 +1,180 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"plantumlmacviewer/config"
+)
+
+// daemonStatusInterval 是状态界面的刷新间隔
+const daemonStatusInterval = time.Second
+
+// daemonStatusHelp 是状态界面底部的命令说明
+const daemonStatusHelp = "命令（输入后按回车）: r 重新导出全部  r 编号 重新导出该文件  o 编号 在查看器窗口中打开  p 暂停/恢复  q 退出"
+
+// daemonStatus 是守护模式在终端中的状态界面：列出监控的文件、最近一次导出的时间和错误，从输入中逐行读取命令
+type daemonStatus struct {
+	d       *Daemon
+	open    func(file string) error
+	files   []string // 屏幕上显示的文件，命令中的编号从1开始
+	screen  string   // 屏幕上显示的内容
+	message string   // 上一条命令的结果
+}
+
+// RunDaemonStatus 在out中显示d的状态，每秒刷新一次，并从in中逐行读取命令，直到d停止。
+// open让查看器窗口打开文件。终端不支持原始模式时也能使用，因此命令需要按回车确认
+func RunDaemonStatus(d *Daemon, in io.Reader, out io.Writer, open func(file string) error) {
+	s := &daemonStatus{d: d, open: open}
+	lines := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+				return
+			}
+		}
+		// 标准输入关闭后只显示状态，不再读取命令
+	}()
+
+	ticker := time.NewTicker(daemonStatusInterval)
+	defer ticker.Stop()
+	for {
+		s.draw(out)
+		select {
+		case line := <-lines:
+			s.message = s.handle(line)
+		case <-ticker.C:
+		case <-d.Done():
+			return
+		}
+	}
+}
+
+// draw 在状态变化时清除屏幕并显示当前的状态。内容没有变化时不重画，命令中的编号始终对应屏幕上显示的列表，
+// 不会因为定时刷新时增减了文件而指向另一个文件
+func (s *daemonStatus) draw(out io.Writer) {
+	list := s.d.Status()
+	screen := formatDaemonStatus(list, s.d.targets, s.d.Paused(), s.message)
+	if screen == s.screen {
+		return
+	}
+	files := make([]string, len(list))
+	for i, st := range list {
+		files[i] = st.File
+	}
+	s.files, s.screen = files, screen
+	fmt.Fprint(out, "\x1b[H\x1b[2J")
+	fmt.Fprint(out, screen)
+}
+
+// handle 执行一条命令，返回显示给用户的结果
+func (s *daemonStatus) handle(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	var file string
+	if len(fields) > 1 {
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 1 || n > len(s.files) {
+			return fmt.Sprintf("没有编号为 %s 的文件", fields[1])
+		}
+		file = s.files[n-1]
+	}
+
+	switch fields[0] {
+	case "r":
+		if file != "" {
+			s.d.Rerender([]string{file})
+			return "已请求重新导出 " + filepath.Base(file)
+		}
+		s.d.Rerender(append([]string(nil), s.files...))
+		return fmt.Sprintf("已请求重新导出%d个文件", len(s.files))
+	case "o":
+		if file == "" {
+			return "需要指定文件的编号，例如 o 1"
+		}
+		if err := s.open(file); err != nil {
+			return fmt.Sprintf("无法在查看器中打开 %s: %v", filepath.Base(file), err)
+		}
+		return "已在查看器中打开 " + filepath.Base(file)
+	case "p":
+		if s.d.Paused() {
+			s.d.Resume()
+			return "已恢复监控"
+		}
+		s.d.Pause()
+		return "已暂停监控"
+	case "q":
+		s.d.Stop()
+		return "正在退出"
+	}
+	return "未知的命令: " + fields[0]
+}
+
+// formatDaemonStatus 返回状态界面的内容：标题、每个文件一行（编号、结果、最近一次导出的时间、相对于监控目录的路径和错误）、
+// 命令说明和上一条命令的结果
+func formatDaemonStatus(list []FileStatus, targets []config.DaemonTarget, paused bool, message string) string {
+	var b strings.Builder
+	failed := 0
+	for _, st := range list {
+		if !st.Time.IsZero() && !st.Result.OK {
+			failed++
+		}
+	}
+	state := "监控中"
+	if paused {
+		state = "已暂停"
+	}
+	fmt.Fprintf(&b, "PlantUML Viewer 守护模式（%s）：%d个目录，%d个文件，%d个错误\n\n", state, len(targets), len(list), failed)
+
+	for i, st := range list {
+		mark, when := "·", "--:--:--"
+		if !st.Time.IsZero() {
+			when = st.Time.Format("15:04:05")
+			mark = "✓"
+			if !st.Result.OK {
+				mark = "✗"
+			}
+		}
+		fmt.Fprintf(&b, "%3d %s %s  %s", i+1, mark, when, displayPath(targets, st.File))
+		if !st.Time.IsZero() && !st.Result.OK {
+			if st.Result.Line > 0 {
+				fmt.Fprintf(&b, ":%d", st.Result.Line)
+			}
+			fmt.Fprintf(&b, "  %s", firstLine(st.Result.Error))
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "\n%s\n", daemonStatusHelp)
+	if message != "" {
+		fmt.Fprintf(&b, "%s\n", message)
+	}
+	return b.String()
+}
+
+// displayPath 返回file相对于所在监控目录的路径，有多个目录时带上目录名
+func displayPath(targets []config.DaemonTarget, file string) string {
+	for _, t := range targets {
+		rel, err := filepath.Rel(t.Source, file)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(targets) > 1 {
+			rel = filepath.Join(filepath.Base(t.Source), rel)
+		}
+		return rel
+	}
+	return file
+}
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"plantumlmacviewer/outline"
+)
+
+// elementResult 是 -element-at 输出的JSON，该行没有元素时只有Line
+type elementResult struct {
+	Line     int          `json:"line"`
+	Kind     outline.Kind `json:"kind,omitempty"`
+	Name     string       `json:"name,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Declared int          `json:"declared,omitempty"` // 元素声明所在的行
+}
+
+// ReportElementAt 将源码第line行对应的元素以JSON写入stdout，供编辑器插件把光标所在行映射到图表中的元素。
+// 该行没有已声明的元素时同样输出JSON，并返回非0的退出码
+func ReportElementAt(source string, line int, stdout, stderr io.Writer) int {
+	result := elementResult{Line: line}
+	e, ok := outline.ElementAt(source, line)
+	if ok {
+		result.Kind, result.Name, result.ID, result.Declared = e.Kind, e.Name, e.ID, e.Line
+	}
+	if err := json.NewEncoder(stdout).Encode(result); err != nil {
+		fmt.Fprintf(stderr, "无法输出结果: %v\n", err)
+		return 1
+	}
+	if !ok {
+		fmt.Fprintf(stderr, "第%d行没有已声明的元素\n", line)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"plantumlmacviewer/export"
+	"plantumlmacviewer/internal/ipc"
+	"plantumlmacviewer/internal/publish"
+)
+
+// ExportFiles 不打开窗口，直接将文件按format导出到outDir（为空时与源文件放在同一目录），
+// 把每个文件的结果写入stdout和stderr并返回退出码。embedSource只对SVG有效，为true时在SVG中嵌入源码；
+// redact为true时导出按项目的脱敏规则替换源码后的副本（见export.WriteRedactedFile）；
+// upload为true时把导出的文件上传到项目配置中的发布目标（见publish.Upload），上传失败也算作这个文件失败
+func ExportFiles(files []string, format, outDir string, factor float64, embedSource, redact, upload bool, stdout, stderr io.Writer) int {
+	if !isExportFormat(format) {
+		fmt.Fprintf(stderr, "不支持的导出格式: %s（支持: %s，或%s表示按渲染配置）\n", format, strings.Join(export.Formats, ", "), export.AutoFormat)
+		return 2
+	}
+	if factor <= 0 {
+		fmt.Fprintf(stderr, "导出比例必须大于0: %g\n", factor)
+		return 2
+	}
+	scale := export.Scale{Label: fmt.Sprintf("%gx", factor), Factor: factor}
+	writeFile := export.WriteFile
+	if redact {
+		writeFile = export.WriteRedactedFile
+	}
+
+	var results []ipc.Result
+	for _, file := range files {
+		absPath, err := ValidateFile(file)
+		if err != nil {
+			results = append(results, NewResult(file, err))
+			continue
+		}
+
+		results = append(results, timed(func() ipc.Result {
+			output, err := writeFile(absPath, format, outDir, scale, embedSource)
+			if err == nil && upload {
+				ctx, cancel := context.WithTimeout(context.Background(), publish.Timeout)
+				if err = publish.Upload(ctx, absPath, output); err != nil {
+					err = fmt.Errorf("已导出到 %s，但%v", output, err)
+				}
+				cancel()
+			}
+			result := NewResult(absPath, err)
+			if err == nil {
+				result.Output = output
+			}
+			return result
+		}))
+	}
+	return ReportResults(stdout, stderr, results)
+}
+
+// ExportGallery 不打开窗口，将文件和目录中的所有图表导出为HTML图库到outDir，
+// 每个图表的结果（Output为第一页图像）写入stdout和stderr并返回退出码
+func ExportGallery(paths []string, outDir, title string, factor float64, stdout, stderr io.Writer) int {
+	if factor <= 0 {
+		fmt.Fprintf(stderr, "导出比例必须大于0: %g\n", factor)
+		return 2
+	}
+	scale := export.Scale{Label: fmt.Sprintf("%gx", factor), Factor: factor}
+
+	var files []string
+	var results []ipc.Result
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			found, err := export.FindDiagrams(path)
+			if err != nil {
+				results = append(results, NewResult(path, err))
+			}
+			for _, file := range found {
+				if absPath, err := filepath.Abs(file); err == nil {
+					file = absPath
+				}
+				files = append(files, file)
+			}
+			continue
+		}
+		absPath, err := ValidateFile(path)
+		if err != nil {
+			results = append(results, NewResult(path, err))
+			continue
+		}
+		files = append(files, absPath)
+	}
+
+	items, err := export.WriteGallery(files, outDir, title, scale)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	for _, item := range items {
+		result := NewResult(item.Source, item.Err)
+		if item.Err == nil {
+			result.Output = filepath.Join(outDir, item.Images[0])
+		}
+		results = append(results, result)
+	}
+	return ReportResults(stdout, stderr, results)
+}
+
+// ExportDiff 不打开窗口，渲染file在from和to（为空时为工作区中的文件）两个git版本中的第一页，
+// 把差异报告写入out。format为空时按out的扩展名选择：.html为拖动滑块对比的网页，其他为左右并排的PNG。
+// 结果（Output为报告文件）写入stdout和stderr并返回退出码
+func ExportDiff(file, from, to, out, format string, factor float64, stdout, stderr io.Writer) int {
+	if from == "" {
+		fmt.Fprintln(stderr, "需要用 -from 指定比较的版本，例如 origin/main")
+		return 2
+	}
+	if out == "" {
+		fmt.Fprintln(stderr, "需要用 -out 指定差异报告的路径")
+		return 2
+	}
+	if format == "" {
+		format = "png"
+		if strings.EqualFold(filepath.Ext(out), ".html") {
+			format = "html"
+		}
+	}
+	if format != "png" && format != "html" {
+		fmt.Fprintf(stderr, "不支持的差异报告格式: %s（支持: %s）\n", format, strings.Join(export.DiffFormats, ", "))
+		return 2
+	}
+	if factor <= 0 {
+		fmt.Fprintf(stderr, "导出比例必须大于0: %g\n", factor)
+		return 2
+	}
+	scale := export.Scale{Label: fmt.Sprintf("%gx", factor), Factor: factor}
+
+	// 工作区中已经删除的文件也可以与之前的版本比较，因此不要求文件存在
+	absPath, err := filepath.Abs(file)
+	if err != nil {
+		return ReportResults(stdout, stderr, []ipc.Result{NewResult(file, err)})
+	}
+	err = export.WriteDiff(absPath, from, to, out, format, scale)
+	result := NewResult(absPath, err)
+	if err == nil {
+		result.Output = out
+	}
+	return ReportResults(stdout, stderr, []ipc.Result{result})
+}
+
+// ExportEvolution 不打开窗口，渲染file在from到to之间（见export.HistoryBetween）修改过它的各个git版本，
+// 把演变动画写入out，每帧显示delay秒。format为空时按out的扩展名选择：.gif为GIF，其他为APNG。
+// 结果（Output为动画文件）写入stdout和stderr并返回退出码
+func ExportEvolution(file, from, to, out, format string, factor, delay float64, stdout, stderr io.Writer) int {
+	if out == "" {
+		fmt.Fprintln(stderr, "需要用 -out 指定动画的路径")
+		return 2
+	}
+	if format == "" {
+		format = "apng"
+		if strings.EqualFold(filepath.Ext(out), ".gif") {
+			format = "gif"
+		}
+	}
+	if format != "gif" && format != "apng" {
+		fmt.Fprintf(stderr, "不支持的动画格式: %s（支持: %s）\n", format, strings.Join(export.AnimationFormats, ", "))
+		return 2
+	}
+	if factor <= 0 {
+		fmt.Fprintf(stderr, "导出比例必须大于0: %g\n", factor)
+		return 2
+	}
+	if delay <= 0 {
+		fmt.Fprintf(stderr, "每帧的时间必须大于0: %g\n", delay)
+		return 2
+	}
+	scale := export.Scale{Label: fmt.Sprintf("%gx", factor), Factor: factor}
+
+	absPath, err := filepath.Abs(file)
+	if err != nil {
+		return ReportResults(stdout, stderr, []ipc.Result{NewResult(file, err)})
+	}
+	err = export.WriteEvolution(absPath, from, to, out, format, scale, time.Duration(delay*float64(time.Second)))
+	result := NewResult(absPath, err)
+	if err == nil {
+		result.Output = out
+	}
+	return ReportResults(stdout, stderr, []ipc.Result{result})
+}
+
+// isExportFormat 判断format是否为支持的导出格式或AutoFormat
+func isExportFormat(format string) bool {
+	if format == export.AutoFormat {
+		return true
+	}
+	for _, f := range export.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
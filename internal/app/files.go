@@ -0,0 +1,52 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+// ValidateFiles 验证文件路径是否存在且是否为PlantUML文件，返回有效文件的绝对路径
+func ValidateFiles(files []string) []string {
+	var validFiles []string
+	for _, file := range files {
+		absPath, err := ValidateFile(file)
+		if err != nil {
+			log.Printf("警告：%v\n", err)
+			continue
+		}
+		validFiles = append(validFiles, absPath)
+	}
+	return validFiles
+}
+
+// ValidateFile 验证单个文件是否存在且不是目录，返回绝对路径
+func ValidateFile(file string) (string, error) {
+	// 检查文件是否存在
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", fmt.Errorf("无法访问文件 %s: %v", file, err)
+	}
+
+	// 检查是否为目录
+	if info.IsDir() {
+		return "", fmt.Errorf("%s 是一个目录，不是文件", file)
+	}
+
+	// 检查文件扩展名
+	ext := filepath.Ext(file)
+	if ext != ".puml" && ext != ".plantuml" && ext != ".pu" {
+		log.Printf("警告：%s 可能不是PlantUML文件（扩展名不是.puml、.plantuml或.pu）\n", logging.Path(file))
+		// 继续处理，因为有些文件可能没有标准扩展名但仍然包含有效的PlantUML内容
+	}
+
+	// 转换为绝对路径
+	absPath, err := filepath.Abs(file)
+	if err == nil {
+		file = absPath
+	}
+	return file, nil
+}
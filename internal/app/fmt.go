@@ -0,0 +1,107 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"plantumlmacviewer/formatter"
+	"plantumlmacviewer/internal/ipc"
+)
+
+// StdinPath 表示从标准输入读取源码，整理后写入标准输出，供编辑器的格式化命令调用
+const StdinPath = "-"
+
+// Fmt 整理paths中的图表文件和目录中所有图表的源码格式（paths为空时为当前目录），跳过匹配ignore中的模式的文件。
+// check为false时改写格式不同的文件；为true时只检查，不改写，格式不同的文件作为失败的结果，适合在CI中使用。
+// paths为 - 时从stdin读取源码，整理后写入stdout。返回退出码
+func Fmt(paths, ignore []string, check bool, stdin io.Reader, stdout, stderr io.Writer) int {
+	for _, pattern := range ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			fmt.Fprintf(stderr, "忽略模式 %s 无效: %v\n", pattern, err)
+			return 2
+		}
+	}
+	if len(paths) == 1 && paths[0] == StdinPath {
+		return fmtStdin(check, stdin, stdout, stderr)
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, results := checkTargets(paths, ignore)
+	changed := 0
+	for _, file := range files {
+		r, different := fmtFile(file, check)
+		if different {
+			changed++
+		}
+		results = append(results, r)
+	}
+	code := ReportResults(stdout, stderr, results)
+	if check {
+		fmt.Fprintf(stderr, "共检查%d个图表：%d个需要整理格式\n", len(files), changed)
+	} else {
+		fmt.Fprintf(stderr, "共整理%d个图表：改写了%d个\n", len(files), changed)
+	}
+	return code
+}
+
+// fmtFile 整理一个文件，返回结果和格式是否与整理后的不同。改写的文件在结果中Output为该文件，
+// 格式已经正确的UpToDate为true；只检查时格式不同的文件为失败的结果，Line为第一处不同的行
+func fmtFile(file string, check bool) (ipc.Result, bool) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return NewResult(file, fmt.Errorf("无法读取文件: %v", err)), false
+	}
+	source := string(data)
+	formatted := formatter.Format(source)
+	if formatted == source {
+		return ipc.Result{File: file, OK: true, UpToDate: true}, false
+	}
+	if check {
+		return ipc.Result{File: file, Error: "格式与 plantumlviewer fmt 不一致，运行 plantumlviewer fmt 整理", Line: firstDifference(source, formatted)}, true
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return NewResult(file, fmt.Errorf("无法访问文件: %v", err)), true
+	}
+	if err := ioutil.WriteFile(file, []byte(formatted), info.Mode().Perm()); err != nil {
+		return NewResult(file, fmt.Errorf("无法写入文件: %v", err)), true
+	}
+	return ipc.Result{File: file, OK: true, Output: file}, true
+}
+
+// fmtStdin 整理标准输入中的源码并写入标准输出。只检查时不输出源码，格式不同时返回1
+func fmtStdin(check bool, stdin io.Reader, stdout, stderr io.Writer) int {
+	data, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "无法读取标准输入: %v\n", err)
+		return 2
+	}
+	formatted := formatter.Format(string(data))
+	if check {
+		if formatted != string(data) {
+			fmt.Fprintf(stderr, "第%d行: 格式与 plantumlviewer fmt 不一致\n", firstDifference(string(data), formatted))
+			return 1
+		}
+		return 0
+	}
+	io.WriteString(stdout, formatted)
+	return 0
+}
+
+// firstDifference 返回两段源码第一处不同的行，从1开始
+func firstDifference(a, b string) int {
+	al := strings.Split(strings.ReplaceAll(a, "\r\n", "\n"), "\n")
+	bl := strings.Split(strings.ReplaceAll(b, "\r\n", "\n"), "\n")
+	for i := range al {
+		if i >= len(bl) || al[i] != bl[i] {
+			return i + 1
+		}
+	}
+	return len(al)
+}
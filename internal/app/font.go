@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/internal/charset"
+	"plantumlmacviewer/plantuml"
+)
+
+// showFontDialog 弹出对话框设置图表使用的字体和Java的默认编码。对话框中用PlantUML渲染包含中日韩文字和
+// 从右向左书写的文字的预览图，确认前就能看出所选字体能否显示这些文字，而不是显示为方框
+func (a *App) showFontDialog() {
+	fontEntry := widget.NewSelectEntry(plantuml.SuggestedFonts)
+	fontEntry.SetText(a.settings.FontName)
+	fontEntry.SetPlaceHolder("PlantUML的默认字体")
+	encodingEntry := widget.NewSelectEntry(charset.Names)
+	encodingEntry.SetText(a.settings.JavaEncoding)
+	encodingEntry.SetPlaceHolder("Java的默认编码")
+
+	preview := canvas.NewImageFromResource(nil)
+	preview.FillMode = canvas.ImageFillContain
+	preview.SetMinSize(fyne.NewSize(420, 180))
+	status := widget.NewLabel("")
+
+	// 只显示最后一次预览的结果，之前没有完成的预览结果被丢弃
+	generation := 0
+	renderPreview := func() {
+		generation++
+		current := generation
+		name, encoding := strings.TrimSpace(fontEntry.Text), strings.TrimSpace(encodingEntry.Text)
+		status.SetText("正在渲染预览...")
+		go func() {
+			data, err := plantuml.RenderFontPreview(context.Background(), name, encoding)
+			fyne.Do(func() {
+				if current != generation {
+					return
+				}
+				if err != nil {
+					status.SetText(fmt.Sprintf("无法渲染预览: %v", err))
+					return
+				}
+				status.SetText("")
+				preview.Resource = fyne.NewStaticResource("font-preview.png", data)
+				preview.Refresh()
+			})
+		}()
+	}
+
+	form := widget.NewForm(
+		widget.NewFormItem("字体", fontEntry),
+		widget.NewFormItem("Java编码", encodingEntry),
+	)
+	content := container.NewVBox(
+		form,
+		widget.NewLabel("字体以 skinparam defaultFontName 注入，图表中自己设置的字体优先；查看和导出都会使用"),
+		container.NewHBox(widget.NewButton("预览", renderPreview), status),
+		preview,
+	)
+	dialog.ShowCustomConfirm("图表字体", "确定", "取消", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		encoding := strings.TrimSpace(encodingEntry.Text)
+		if err := plantuml.ValidateJavaEncoding(encoding); err != nil {
+			dialog.ShowError(err, a.window)
+			return
+		}
+		for _, mainUI := range a.allUIs() {
+			mainUI.SetFont(strings.TrimSpace(fontEntry.Text), encoding)
+		}
+		a.saveSettings()
+	}, a.window)
+	renderPreview()
+}
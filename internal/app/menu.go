@@ -0,0 +1,589 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/c4"
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/charset"
+	"plantumlmacviewer/internal/samples"
+	"plantumlmacviewer/plantuml"
+	"plantumlmacviewer/ui"
+)
+
+// setupMainMenu 设置主菜单
+func (a *App) setupMainMenu() {
+	a.viewportLockItem = fyne.NewMenuItem("锁定各标签的缩放与滚动位置", a.toggleViewportLock)
+	a.viewportLockItem.Shortcut = cmdShortcut(fyne.KeyL, true)
+
+	watchItem := fyne.NewMenuItem("后台监控文件变化", nil)
+	watchItem.Checked = a.settings.WatchFiles
+	watchItem.Action = func() {
+		a.settings.WatchFiles = !a.settings.WatchFiles
+		watchItem.Checked = a.settings.WatchFiles
+		for _, mainUI := range a.allUIs() {
+			mainUI.SetWatchFiles(a.settings.WatchFiles)
+		}
+		a.saveSettings()
+	}
+
+	a.pauseWatchItem = fyne.NewMenuItem("暂停监控文件变化", a.toggleWatchingPaused)
+	a.pauseWatchItem.Shortcut = cmdShortcut(fyne.KeyP, true)
+
+	refreshOnFocusItem := fyne.NewMenuItem("窗口获得焦点时刷新", nil)
+	refreshOnFocusItem.Checked = a.settings.RefreshOnFocus
+	refreshOnFocusItem.Action = func() {
+		a.settings.RefreshOnFocus = !a.settings.RefreshOnFocus
+		refreshOnFocusItem.Checked = a.settings.RefreshOnFocus
+		a.saveSettings()
+	}
+
+	backgroundItem := fyne.NewMenuItem("在后台打开其他实例发来的文件", nil)
+	backgroundItem.Checked = a.settings.OpenInBackground
+	backgroundItem.Action = func() {
+		a.settings.OpenInBackground = !a.settings.OpenInBackground
+		backgroundItem.Checked = a.settings.OpenInBackground
+		a.saveSettings()
+	}
+
+	workspaceItem := fyne.NewMenuItem("按工作区打开其他实例发来的文件", nil)
+	workspaceItem.ChildMenu = a.newWorkspaceMenu()
+
+	reduceMotionItem := fyne.NewMenuItem("减少动态效果", nil)
+	reduceMotionItem.Checked = a.settings.ReduceMotion
+	reduceMotionItem.Action = func() {
+		a.setReduceMotion(!a.settings.ReduceMotion)
+		reduceMotionItem.Checked = a.settings.ReduceMotion
+		a.saveSettings()
+	}
+
+	highContrastItem := fyne.NewMenuItem("高对比度（用于投影）", nil)
+	highContrastItem.Checked = a.settings.HighContrast
+	highContrastItem.Action = func() {
+		highContrastItem.Checked = !a.settings.HighContrast
+		for _, mainUI := range a.allUIs() {
+			mainUI.SetHighContrast(highContrastItem.Checked)
+		}
+		a.saveSettings()
+	}
+
+	colorBlindItem := fyne.NewMenuItem("色盲友好的颜色", nil)
+	colorBlindItem.Checked = a.settings.ColorBlindSafe
+	colorBlindItem.Action = func() {
+		colorBlindItem.Checked = !a.settings.ColorBlindSafe
+		for _, mainUI := range a.allUIs() {
+			mainUI.SetColorBlindSafe(colorBlindItem.Checked)
+		}
+		a.saveSettings()
+	}
+
+	svgItem := fyne.NewMenuItem("以SVG显示（无损缩放）", nil)
+	svgItem.Checked = a.settings.SVGMode
+	svgItem.Action = func() {
+		svgItem.Checked = !a.settings.SVGMode
+		for _, mainUI := range a.allUIs() {
+			mainUI.SetSVGMode(svgItem.Checked)
+		}
+		a.saveSettings()
+	}
+
+	outlineItem := fyne.NewMenuItem("显示大纲", nil)
+	outlineItem.Checked = a.settings.ShowOutline
+	outlineItem.Action = func() {
+		a.settings.ShowOutline = !a.settings.ShowOutline
+		outlineItem.Checked = a.settings.ShowOutline
+		a.mainUI.SetOutlineVisible(a.settings.ShowOutline)
+		a.saveSettings()
+	}
+
+	snapshotItem := fyne.NewMenuItem("复制当前标签为快照", func() { a.mainUI.DuplicateAsSnapshot() })
+
+	followItem := fyne.NewMenuItem("跟随最新文件...", func() { a.mainUI.ChooseFollowPattern() })
+	c4Item := fyne.NewMenuItem("C4层级", nil)
+	c4Item.ChildMenu = a.newC4LevelMenu()
+	renameItem := fyne.NewMenuItem("重命名当前标签...", func() { a.mainUI.RenameCurrentTab() })
+	colorItem := fyne.NewMenuItem("标签颜色", nil)
+	colorItem.ChildMenu = a.newTabColorMenu()
+	groupItem := fyne.NewMenuItem("标签分组", nil)
+	groupItem.ChildMenu = a.newTabGroupMenu()
+	scheduleItem := fyne.NewMenuItem("定时刷新", nil)
+	scheduleItem.ChildMenu = a.newRefreshIntervalMenu()
+	charsetItem := fyne.NewMenuItem("文件编码", nil)
+	charsetItem.ChildMenu = a.newCharsetMenu()
+	layoutItem := fyne.NewMenuItem("布局引擎", nil)
+	layoutItem.ChildMenu = a.newLayoutMenu()
+	formatItem := fyne.NewMenuItem("图像格式", nil)
+	formatItem.ChildMenu = a.newImageFormatMenu()
+	confirmQuitItem := fyne.NewMenuItem("退出前确认...", a.showConfirmQuitDialog)
+	renderTimeoutItem := fyne.NewMenuItem("渲染超时...", a.showRenderTimeoutDialog)
+	fontItem := fyne.NewMenuItem("图表字体...", a.showFontDialog)
+	viewMenu := fyne.NewMenu("视图",
+		menuItem("放大", cmdShortcut(fyne.KeyEqual, false), func() { a.mainUI.ZoomIn() }),
+		menuItem("缩小", cmdShortcut(fyne.KeyMinus, false), func() { a.mainUI.ZoomOut() }),
+		menuItem("实际大小", cmdShortcut(fyne.Key0, false), func() { a.mainUI.ActualSize() }),
+		menuItem("适应窗口", cmdShortcut(fyne.Key9, false), func() { a.mainUI.ZoomToFit() }),
+		fyne.NewMenuItemSeparator(),
+		a.viewportLockItem, outlineItem, highContrastItem, colorBlindItem, svgItem, fontItem, snapshotItem, followItem, c4Item, fyne.NewMenuItemSeparator(),
+		watchItem, a.pauseWatchItem, refreshOnFocusItem, backgroundItem, workspaceItem, reduceMotionItem, confirmQuitItem, renderTimeoutItem)
+	tabMenu := fyne.NewMenu("标签",
+		menuItem("下一个标签", cmdShortcut(fyne.KeyRightBracket, true), func() { a.mainUI.NextTab() }),
+		menuItem("上一个标签", cmdShortcut(fyne.KeyLeftBracket, true), func() { a.mainUI.PrevTab() }),
+		fyne.NewMenuItemSeparator(),
+		menuItem("刷新当前标签", cmdShortcut(fyne.KeyR, false), func() { a.mainUI.RefreshCurrentTab() }),
+		renameItem, colorItem, groupItem, scheduleItem, charsetItem, layoutItem, formatItem,
+		fyne.NewMenuItem("额外的PlantUML参数...", func() { a.mainUI.EditCurrentArgs() }),
+		fyne.NewMenuItem("复制渲染命令", func() { a.mainUI.CopyRenderCommand() }),
+		fyne.NewMenuItem("渲染错误历史...", func() { a.mainUI.ShowErrorHistory() }),
+		fyne.NewMenuItem("历史时间轴...", func() { a.mainUI.ShowTimeline() }),
+		fyne.NewMenuItemSeparator(),
+		menuItem("关闭当前标签", cmdShortcut(fyne.KeyW, false), func() { a.mainUI.CloseCurrentTab() }),
+		fyne.NewMenuItem("关闭其他标签", func() { a.mainUI.CloseOtherTabs() }),
+		fyne.NewMenuItem("关闭所有标签", func() { a.mainUI.CloseAllTabs() }),
+		menuItem("重新打开关闭的标签", cmdShortcut(fyne.KeyT, true), func() { a.mainUI.ReopenClosedTabs() }),
+	)
+	annotateMenu := a.newAnnotateMenu()
+	exportMenu := fyne.NewMenu("导出",
+		fyne.NewMenuItem("导出为PNG...", func() { a.mainUI.ExportPNG() }),
+		fyne.NewMenuItem("导出为PDF（包含所有页面）...", func() { a.mainUI.ExportPDF() }),
+		fyne.NewMenuItem("导出为SVG...", func() { a.mainUI.ExportSVG() }),
+		fyne.NewMenuItem("按渲染配置导出...", func() { a.mainUI.ExportWithProfile() }),
+		fyne.NewMenuItem("导出脱敏副本...", func() { a.mainUI.ExportRedacted() }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("导出图库...", func() { a.mainUI.ExportGallery() }),
+		fyne.NewMenuItem("导出幻灯片...", func() { a.mainUI.ExportSlides() }),
+	)
+	fileMenu := fyne.NewMenu("文件",
+		menuItem("新建草稿", cmdShortcut(fyne.KeyN, false), a.newScratchTab),
+		fyne.NewMenuItem("从剪贴板新建草稿", a.newScratchFromClipboard),
+		fyne.NewMenuItemSeparator(),
+		menuItem("保存草稿", cmdShortcut(fyne.KeyS, false), func() { a.mainUI.SaveScratch() }),
+		menuItem("草稿另存为...", cmdShortcut(fyne.KeyS, true), func() { a.mainUI.SaveScratchAs() }),
+		fyne.NewMenuItem("编辑当前文件", a.editCurrentFile),
+		menuItem("整理源码格式", cmdShortcut(fyne.KeyF, true), func() { a.mainUI.FormatScratch() }),
+		fyne.NewMenuItem("重命名元素...", func() { a.mainUI.RenameSymbol() }),
+		fyne.NewMenuItem("提取到引用的文件...", func() { a.mainUI.ExtractToInclude() }),
+		// 编辑区获得焦点时Cmd+Z和Cmd+Shift+Z也使用同一个撤销历史；不设置在菜单项上，以免对话框中的输入框不能撤销
+		fyne.NewMenuItem("撤销编辑", func() { a.mainUI.UndoEdit() }),
+		fyne.NewMenuItem("重做编辑", func() { a.mainUI.RedoEdit() }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("打开项目...", func() { a.mainUI.ChooseProject() }),
+		fyne.NewMenuItem("全部标为已看", func() { a.mainUI.MarkAllViewed() }),
+		fyne.NewMenuItem("关闭项目", func() { a.mainUI.CloseProject() }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("清除解密凭据", func() { a.mainUI.ForgetKeys() }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("导出设置...", a.exportSettings),
+		fyne.NewMenuItem("导入设置...", a.importSettings),
+	)
+	sampleItem := fyne.NewMenuItem("打开样例", nil)
+	sampleItem.ChildMenu = a.newSampleMenu()
+	helpMenu := fyne.NewMenu("帮助", sampleItem, fyne.NewMenuItem("键盘快捷键...", a.showShortcutsDialog))
+	a.window.SetMainMenu(fyne.NewMainMenu(fileMenu, viewMenu, tabMenu, annotateMenu, exportMenu, helpMenu))
+}
+
+// menuItem 创建带快捷键的菜单项。快捷键设置在菜单项上，控件有焦点时也有效，并显示在菜单中
+func menuItem(label string, shortcut fyne.Shortcut, action func()) *fyne.MenuItem {
+	item := fyne.NewMenuItem(label, action)
+	item.Shortcut = shortcut
+	return item
+}
+
+// cmdShortcut 返回Cmd加key的快捷键，shift为true时再加Shift
+func cmdShortcut(key fyne.KeyName, shift bool) fyne.Shortcut {
+	modifier := desktop.SuperModifier
+	if shift {
+		modifier |= fyne.KeyModifierShift
+	}
+	return &desktop.CustomShortcut{KeyName: key, Modifier: modifier}
+}
+
+// extraShortcuts 是没有对应菜单项的按键，只在没有控件获得焦点时有效
+var extraShortcuts = []string{
+	"←/→: 上一个/下一个标签页",
+	"F10: 最大化窗口",
+	"F11: 切换全屏，Esc退出全屏",
+	"Tab / Shift+Tab: 在按钮、输入框等控件之间移动焦点，空格键按下按钮",
+}
+
+// shortcutHelp 按菜单顺序列出菜单中所有带快捷键的菜单项，之后是没有菜单项的按键
+func shortcutHelp(menu *fyne.MainMenu) []string {
+	var lines []string
+	for _, m := range menu.Items {
+		for _, item := range m.Items {
+			if item.Shortcut != nil {
+				lines = append(lines, fmt.Sprintf("%s: %s ▸ %s", shortcutLabel(item.Shortcut), m.Label, item.Label))
+			}
+		}
+	}
+	return append(lines, extraShortcuts...)
+}
+
+// shortcutLabel 返回快捷键的显示文字，例如 Cmd+Shift+T
+func shortcutLabel(shortcut fyne.Shortcut) string {
+	s, ok := shortcut.(*desktop.CustomShortcut)
+	if !ok {
+		return shortcut.ShortcutName()
+	}
+	var parts []string
+	for _, m := range []struct {
+		modifier fyne.KeyModifier
+		label    string
+	}{
+		{fyne.KeyModifierControl, "Ctrl"},
+		{fyne.KeyModifierAlt, "Alt"},
+		{desktop.SuperModifier, "Cmd"},
+		{fyne.KeyModifierShift, "Shift"},
+	} {
+		if s.Modifier&m.modifier != 0 {
+			parts = append(parts, m.label)
+		}
+	}
+	return strings.Join(append(parts, string(s.KeyName)), "+")
+}
+
+// showShortcutsDialog 显示所有键盘快捷键
+func (a *App) showShortcutsDialog() {
+	label := widget.NewLabel(strings.Join(shortcutHelp(a.window.MainMenu()), "\n"))
+	dialog.ShowCustom("键盘快捷键", "关闭", container.NewVScroll(label), a.window)
+}
+
+// newSampleMenu 创建打开内置样例的子菜单，样例在草稿标签中打开
+func (a *App) newSampleMenu() *fyne.Menu {
+	var items []*fyne.MenuItem
+	for _, sample := range samples.All {
+		sample := sample
+		items = append(items, fyne.NewMenuItem(sample.Title, func() {
+			if err := a.mainUI.OpenSample(sample); err != nil {
+				dialog.ShowError(fmt.Errorf("无法打开样例: %v", err), a.window)
+			}
+		}))
+	}
+	return fyne.NewMenu("打开样例", items...)
+}
+
+// newScratchTab 新建空白的草稿标签
+func (a *App) newScratchTab() {
+	if err := a.mainUI.NewScratchTab(); err != nil {
+		dialog.ShowError(fmt.Errorf("无法新建草稿: %v", err), a.window)
+	}
+}
+
+// newScratchFromClipboard 用剪贴板中的代码新建草稿标签
+func (a *App) newScratchFromClipboard() {
+	if err := a.mainUI.NewScratchFromClipboard(); err != nil {
+		dialog.ShowError(fmt.Errorf("无法新建草稿: %v", err), a.window)
+	}
+}
+
+// editCurrentFile 在草稿标签中编辑当前标签的文件
+func (a *App) editCurrentFile() {
+	if err := a.mainUI.EditCurrentFile(); err != nil {
+		dialog.ShowError(fmt.Errorf("无法编辑文件: %v", err), a.window)
+	}
+}
+
+// newTabColorMenu 创建“标签颜色”子菜单：为当前标签选择颜色标记或清除
+func (a *App) newTabColorMenu() *fyne.Menu {
+	var items []*fyne.MenuItem
+	for _, c := range ui.TabColors {
+		name := c.Name
+		items = append(items, fyne.NewMenuItem(c.Label, func() { a.mainUI.SetCurrentTabColor(name) }))
+	}
+	items = append(items, fyne.NewMenuItemSeparator(), fyne.NewMenuItem("无", func() { a.mainUI.SetCurrentTabColor("") }))
+	return fyne.NewMenu("标签颜色", items...)
+}
+
+// newRefreshIntervalMenu 创建“定时刷新”子菜单，设置当前标签按固定间隔重新渲染
+func (a *App) newRefreshIntervalMenu() *fyne.Menu {
+	var items []*fyne.MenuItem
+	for _, interval := range ui.RefreshIntervals {
+		interval := interval
+		items = append(items, fyne.NewMenuItem(ui.RefreshIntervalLabel(interval), func() { a.mainUI.SetCurrentRefreshInterval(interval) }))
+	}
+	return fyne.NewMenu("定时刷新", items...)
+}
+
+// newCharsetMenu 创建“文件编码”子菜单，为当前标签的文件指定字符编码或恢复自动识别
+func (a *App) newCharsetMenu() *fyne.Menu {
+	items := []*fyne.MenuItem{fyne.NewMenuItem(ui.CharsetLabel(""), func() { a.mainUI.SetCurrentCharset("") }), fyne.NewMenuItemSeparator()}
+	for _, name := range charset.Names {
+		name := name
+		items = append(items, fyne.NewMenuItem(ui.CharsetLabel(name), func() { a.mainUI.SetCurrentCharset(name) }))
+	}
+	return fyne.NewMenu("文件编码", items...)
+}
+
+// newLayoutMenu 创建“布局引擎”子菜单，为当前标签的文件换用Smetana或ELK布局，或恢复为Graphviz。
+// 本机的plantuml.jar不带ELK时不列出ELK
+func (a *App) newLayoutMenu() *fyne.Menu {
+	items := []*fyne.MenuItem{fyne.NewMenuItem(plantuml.LayoutLabel("")+"（默认）", func() { a.mainUI.SetCurrentLayout("") }), fyne.NewMenuItemSeparator()}
+	for _, engine := range plantuml.AvailableLayouts() {
+		engine := engine
+		items = append(items, fyne.NewMenuItem(plantuml.LayoutLabel(engine), func() { a.mainUI.SetCurrentLayout(engine) }))
+	}
+	return fyne.NewMenu("布局引擎", items...)
+}
+
+// newImageFormatMenu 创建“图像格式”子菜单，为当前标签的文件指定以PNG或SVG显示，或恢复为跟随“视图”菜单中的设置
+func (a *App) newImageFormatMenu() *fyne.Menu {
+	var items []*fyne.MenuItem
+	for _, format := range []string{"", plantuml.ImageFormatPNG, plantuml.ImageFormatSVG} {
+		format := format
+		items = append(items, fyne.NewMenuItem(plantuml.ImageFormatLabel(format), func() { a.mainUI.SetCurrentImageFormat(format) }))
+	}
+	return fyne.NewMenu("图像格式", items...)
+}
+
+// workspaceModeLabels 是各种按工作区分开的方式在菜单中的名称
+var workspaceModeLabels = map[string]string{
+	config.WorkspacesOff:    "不分开",
+	config.WorkspacesGroup:  "每个工作区一个标签分组",
+	config.WorkspacesWindow: "每个工作区一个窗口",
+}
+
+// newWorkspaceMenu 创建“按工作区打开其他实例发来的文件”子菜单，勾选当前的方式
+func (a *App) newWorkspaceMenu() *fyne.Menu {
+	var items []*fyne.MenuItem
+	for _, mode := range config.WorkspaceModes {
+		mode := mode
+		item := fyne.NewMenuItem(workspaceModeLabels[mode], nil)
+		item.Checked = a.settings.Workspaces == mode
+		item.Action = func() {
+			a.settings.Workspaces = mode
+			for _, other := range items {
+				other.Checked = other == item
+			}
+			a.saveSettings()
+		}
+		items = append(items, item)
+	}
+	return fyne.NewMenu("按工作区打开其他实例发来的文件", items...)
+}
+
+// newC4LevelMenu 创建“C4层级”子菜单，切换到当前C4图表在各层级的配套文件
+func (a *App) newC4LevelMenu() *fyne.Menu {
+	var items []*fyne.MenuItem
+	for _, level := range c4.Levels {
+		level := level
+		items = append(items, fyne.NewMenuItem(level.Label(), func() {
+			if err := a.mainUI.SwitchC4Level(level); err != nil {
+				dialog.ShowError(err, a.window)
+			}
+		}))
+	}
+	return fyne.NewMenu("C4层级", items...)
+}
+
+// newTabGroupMenu 创建“标签分组”子菜单：设置当前标签的分组，以及对当前标签所在分组的操作
+func (a *App) newTabGroupMenu() *fyne.Menu {
+	return fyne.NewMenu("标签分组",
+		fyne.NewMenuItem("设置当前标签的分组...", func() { a.mainUI.ChooseTabGroup() }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("刷新当前分组", func() { a.mainUI.RefreshGroup(a.mainUI.CurrentGroup()) }),
+		fyne.NewMenuItem("导出当前分组为PNG...", func() { a.mainUI.ExportGroup(a.mainUI.CurrentGroup()) }),
+		fyne.NewMenuItem("关闭当前分组的所有标签", func() { a.mainUI.CloseGroup(a.mainUI.CurrentGroup()) }),
+	)
+}
+
+// newAnnotateMenu 创建“标注”菜单：选择标注工具、撤销、清除和导出带标注的图像
+func (a *App) newAnnotateMenu() *fyne.Menu {
+	tools := []struct {
+		label string
+		tool  plantuml.AnnotationTool
+	}{
+		{"浏览（退出标注模式）", plantuml.AnnotationOff},
+		{"箭头", plantuml.AnnotationArrow},
+		{"方框", plantuml.AnnotationBox},
+		{"文字说明", plantuml.AnnotationNote},
+		{"测量", plantuml.AnnotationMeasure},
+	}
+
+	var toolItems []*fyne.MenuItem
+	for _, t := range tools {
+		tool := t.tool
+		item := fyne.NewMenuItem(t.label, nil)
+		item.Checked = tool == plantuml.AnnotationOff
+		item.Action = func() {
+			a.mainUI.SetAnnotationTool(tool)
+			for i, other := range toolItems {
+				other.Checked = tools[i].tool == tool
+			}
+			a.window.MainMenu().Refresh()
+		}
+		toolItems = append(toolItems, item)
+	}
+
+	items := append(toolItems,
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("撤销上一个标注", func() { a.mainUI.UndoAnnotation() }),
+		fyne.NewMenuItem("清除全部标注", func() { a.mainUI.ClearAnnotations() }),
+		fyne.NewMenuItem("设置测量DPI...", a.showMeasureDPIDialog),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("导出带标注的PNG...", func() { a.mainUI.ExportAnnotatedPNG() }),
+	)
+	return fyne.NewMenu("标注", items...)
+}
+
+// showConfirmQuitDialog 弹出对话框设置打开多少个以上的标签页时退出前先确认
+func (a *App) showConfirmQuitDialog() {
+	entry := widget.NewEntry()
+	entry.SetText(strconv.Itoa(a.settings.ConfirmQuitTabs))
+	dialog.ShowForm("退出前确认", "确定", "取消", []*widget.FormItem{
+		widget.NewFormItem("标签页超过", entry),
+		widget.NewFormItem("", widget.NewLabel("0表示退出时不确认")),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(entry.Text))
+		if err != nil || limit < 0 {
+			dialog.ShowError(fmt.Errorf("无效的标签页数量: %s", entry.Text), a.window)
+			return
+		}
+		a.settings.ConfirmQuitTabs = limit
+		a.saveSettings()
+	}, a.window)
+}
+
+// showRenderTimeoutDialog 弹出对话框设置查看时一次渲染最长的时间，超过后结束PlantUML进程并显示超时错误。
+// 之后开始的渲染使用新的设置
+func (a *App) showRenderTimeoutDialog() {
+	entry := widget.NewEntry()
+	entry.SetText(strconv.FormatFloat(plantuml.RenderTimeout().Seconds(), 'f', -1, 64))
+	dialog.ShowForm("渲染超时", "确定", "取消", []*widget.FormItem{
+		widget.NewFormItem("秒", entry),
+		widget.NewFormItem("", widget.NewLabel(fmt.Sprintf("0表示默认的%g秒", config.DefaultRenderTimeout.Seconds()))),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		seconds, err := strconv.ParseFloat(strings.TrimSpace(entry.Text), 64)
+		if err != nil || seconds < 0 {
+			dialog.ShowError(fmt.Errorf("无效的时间: %s", entry.Text), a.window)
+			return
+		}
+		a.settings.RenderTimeout = seconds
+		plantuml.SetRenderTimeout(a.settings.RenderTimeoutDuration())
+		a.saveSettings()
+	}, a.window)
+}
+
+// showMeasureDPIDialog 弹出对话框设置测量工具所用的DPI
+func (a *App) showMeasureDPIDialog() {
+	entry := widget.NewEntry()
+	entry.SetText(strconv.FormatFloat(a.settings.MeasureDPI, 'f', -1, 64))
+	dialog.ShowForm("测量DPI", "确定", "取消", []*widget.FormItem{
+		widget.NewFormItem("DPI", entry),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		dpi, err := strconv.ParseFloat(strings.TrimSpace(entry.Text), 64)
+		if err != nil || dpi <= 0 {
+			dialog.ShowError(fmt.Errorf("无效的DPI: %s", entry.Text), a.window)
+			return
+		}
+		a.mainUI.SetMeasureDPI(dpi)
+		a.saveSettings()
+	}, a.window)
+}
+
+// saveSettings 保存用户设置并刷新菜单的勾选状态
+func (a *App) saveSettings() {
+	if err := a.settings.Save(); err != nil {
+		log.Printf("保存设置失败: %v", err)
+	}
+	a.window.MainMenu().Refresh()
+}
+
+// toggleViewportLock 切换各标签之间的缩放与滚动位置同步
+func (a *App) toggleViewportLock() {
+	if a.mainUI == nil {
+		return
+	}
+	locked := !a.mainUI.ViewportLocked()
+	a.mainUI.SetViewportLocked(locked)
+
+	if a.viewportLockItem != nil {
+		a.viewportLockItem.Checked = locked
+		a.window.MainMenu().Refresh()
+	}
+}
+
+// toggleWatchingPaused 暂停或恢复所有文件的后台监控
+func (a *App) toggleWatchingPaused() {
+	if a.mainUI == nil {
+		return
+	}
+	a.setWatchingPaused(!a.mainUI.WatchingPaused())
+}
+
+// setWatchingPaused 暂停或恢复后台监控并同步菜单的勾选状态，需要在UI线程中调用
+func (a *App) setWatchingPaused(paused bool) error {
+	if a.mainUI == nil {
+		return fmt.Errorf("窗口尚未打开")
+	}
+	for _, mainUI := range a.allUIs() {
+		if paused {
+			mainUI.PauseWatching()
+		} else {
+			mainUI.ResumeWatching()
+		}
+	}
+
+	if a.pauseWatchItem != nil {
+		a.pauseWatchItem.Checked = paused
+		a.window.MainMenu().Refresh()
+	}
+	return nil
+}
+
+// PauseWatching 在UI线程中暂停所有文件的后台监控，用作IPC命令的处理函数
+func (a *App) PauseWatching() error {
+	var err error
+	fyne.DoAndWait(func() {
+		err = a.setWatchingPaused(true)
+	})
+	return err
+}
+
+// ResumeWatching 在UI线程中恢复后台监控并重新渲染有变化的文件，用作IPC命令的处理函数
+func (a *App) ResumeWatching() error {
+	var err error
+	fyne.DoAndWait(func() {
+		err = a.setWatchingPaused(false)
+	})
+	return err
+}
+
+// CloseAllTabs 在UI线程中关闭所有标签页，用作IPC命令的处理函数。需要确认时在窗口中弹出确认框后立即返回
+func (a *App) CloseAllTabs() error {
+	return a.onMainUI(func() { a.mainUI.CloseAllTabs() })
+}
+
+// CloseOtherTabs 在UI线程中关闭当前标签以外的所有标签页，用作IPC命令的处理函数
+func (a *App) CloseOtherTabs() error {
+	return a.onMainUI(func() { a.mainUI.CloseOtherTabs() })
+}
+
+// onMainUI 在UI线程中执行fn并等待完成，窗口尚未打开时返回错误
+func (a *App) onMainUI(fn func()) error {
+	var err error
+	fyne.DoAndWait(func() {
+		if a.mainUI == nil {
+			err = fmt.Errorf("窗口尚未打开")
+			return
+		}
+		fn()
+	})
+	return err
+}
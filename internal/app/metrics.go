@@ -0,0 +1,183 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"plantumlmacviewer/internal/ipc"
+)
+
+// MetricsPath 是守护模式提供指标的HTTP路径，Prometheus默认抓取这个路径
+const MetricsPath = "/metrics"
+
+// metricsContentType 是OpenMetrics文本格式的类型，Prometheus和兼容的采集器都能解析
+const metricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// metricsBuckets 是渲染用时直方图的上限（秒），PlantUML渲染一张图通常在1到10秒之间
+var metricsBuckets = []float64{0.5, 1, 2, 5, 10, 30, 60, 120}
+
+// daemonMetrics 是守护模式启动以来的累计统计，由Daemon.mu保护
+type daemonMetrics struct {
+	renders     uint64   // 实际渲染的次数，包括失败的
+	failures    uint64   // 渲染或写入失败的次数
+	cacheHits   uint64   // 内容没有变化、跳过渲染的次数
+	buckets     []uint64 // 与metricsBuckets一一对应，用时不超过该上限的渲染次数
+	durationSum float64  // 所有渲染用时的总和（秒）
+}
+
+// add 记录一批导出的结果
+func (m *daemonMetrics) add(results []ipc.Result) {
+	if m.buckets == nil {
+		m.buckets = make([]uint64, len(metricsBuckets))
+	}
+	for _, r := range results {
+		if r.UpToDate {
+			m.cacheHits++
+			continue
+		}
+		m.renders++
+		if !r.OK {
+			m.failures++
+		}
+		m.durationSum += r.Duration
+		for i, le := range metricsBuckets {
+			if r.Duration <= le {
+				m.buckets[i]++
+			}
+		}
+	}
+}
+
+// WriteMetrics 以OpenMetrics文本格式写入守护模式的指标：渲染次数、失败次数、渲染用时、缓存命中率、
+// 监控的文件数和最近一次导出失败的文件数。指标不按文件区分，文件很多时也不会让监控系统的数据量膨胀
+func (d *Daemon) WriteMetrics(w io.Writer) error {
+	list := d.Status()
+	failing := 0
+	for _, st := range list {
+		if !st.Time.IsZero() && !st.Result.OK {
+			failing++
+		}
+	}
+	d.mu.Lock()
+	m := d.metrics
+	m.buckets = append([]uint64(nil), d.metrics.buckets...)
+	paused := d.paused
+	d.mu.Unlock()
+	if m.buckets == nil {
+		m.buckets = make([]uint64, len(metricsBuckets))
+	}
+
+	var b strings.Builder
+	family := func(name, typ, help string) {
+		fmt.Fprintf(&b, "# TYPE %s %s\n# HELP %s %s\n", name, typ, name, help)
+	}
+	family("plantumlviewer_daemon_renders", "counter", "实际渲染的次数，包括失败的")
+	fmt.Fprintf(&b, "plantumlviewer_daemon_renders_total %d\n", m.renders)
+	family("plantumlviewer_daemon_render_failures", "counter", "渲染失败的次数")
+	fmt.Fprintf(&b, "plantumlviewer_daemon_render_failures_total %d\n", m.failures)
+	family("plantumlviewer_daemon_cache_hits", "counter", "导出结果已是最新、跳过渲染的次数")
+	fmt.Fprintf(&b, "plantumlviewer_daemon_cache_hits_total %d\n", m.cacheHits)
+
+	ratio := 0.0
+	if total := m.cacheHits + m.renders; total > 0 {
+		ratio = float64(m.cacheHits) / float64(total)
+	}
+	family("plantumlviewer_daemon_cache_hit_ratio", "gauge", "命中缓存的导出占所有导出的比例")
+	fmt.Fprintf(&b, "plantumlviewer_daemon_cache_hit_ratio %s\n", formatMetric(ratio))
+
+	family("plantumlviewer_daemon_render_duration_seconds", "histogram", "渲染一个图表用的秒数")
+	for i, le := range metricsBuckets {
+		fmt.Fprintf(&b, "plantumlviewer_daemon_render_duration_seconds_bucket{le=\"%s\"} %d\n", formatMetric(le), m.buckets[i])
+	}
+	fmt.Fprintf(&b, "plantumlviewer_daemon_render_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.renders)
+	fmt.Fprintf(&b, "plantumlviewer_daemon_render_duration_seconds_sum %s\n", formatMetric(m.durationSum))
+	fmt.Fprintf(&b, "plantumlviewer_daemon_render_duration_seconds_count %d\n", m.renders)
+
+	family("plantumlviewer_daemon_watched_files", "gauge", "监控的目录中的图表数")
+	fmt.Fprintf(&b, "plantumlviewer_daemon_watched_files %d\n", len(list))
+	family("plantumlviewer_daemon_failing_files", "gauge", "最近一次导出失败的图表数")
+	fmt.Fprintf(&b, "plantumlviewer_daemon_failing_files %d\n", failing)
+	family("plantumlviewer_daemon_paused", "gauge", "是否已暂停监控（1为暂停）")
+	fmt.Fprintf(&b, "plantumlviewer_daemon_paused %d\n", boolMetric(paused))
+	b.WriteString("# EOF\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatMetric 以最短的形式写出浮点数
+func formatMetric(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// boolMetric 把true写为1，false写为0
+func boolMetric(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// metricsTimeout 是读取请求和写入指标的超时
+const metricsTimeout = 10 * time.Second
+
+// MetricsServer 以HTTP在MetricsPath上提供守护模式的指标，供Prometheus等监控系统抓取
+type MetricsServer struct {
+	d        *Daemon
+	listener net.Listener
+	server   *http.Server
+}
+
+// ListenMetrics 在TCP地址addr（例如 127.0.0.1:9464 或 :9464）上监听指标的请求。
+// 指标只包含计数，不包含文件路径，可以监听其他主机也能访问的地址
+func ListenMetrics(d *Daemon, addr string) (*MetricsServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("无法启动指标接口: %v", err)
+	}
+	log.Printf("指标接口已启动，监听地址: %s%s", listener.Addr(), MetricsPath)
+	s := &MetricsServer{d: d, listener: listener}
+	s.server = &http.Server{Handler: s, ReadTimeout: metricsTimeout, WriteTimeout: metricsTimeout}
+	return s, nil
+}
+
+// Addr 返回实际监听的地址，端口为0时可以得到系统分配的端口
+func (s *MetricsServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Serve 处理请求，直到调用Close为止
+func (s *MetricsServer) Serve() {
+	if err := s.server.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("指标接口出错：%v", err)
+	}
+}
+
+// Close 关闭服务器
+func (s *MetricsServer) Close() error {
+	return s.server.Close()
+}
+
+// ServeHTTP 对MetricsPath的GET请求返回当前的指标
+func (s *MetricsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != MetricsPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "只支持GET请求", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", metricsContentType)
+	if err := s.d.WriteMetrics(w); err != nil {
+		log.Printf("无法写入指标: %v", err)
+	}
+}
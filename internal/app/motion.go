@@ -0,0 +1,77 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+// reduceMotion 返回是否减少动态效果：设置中开启了reduceMotion，或者系统设置中开启了“减弱动态效果”
+func (a *App) reduceMotion() bool {
+	return a.settings.ReduceMotion || systemReduceMotion()
+}
+
+// applyReduceMotion 需要减少动态效果时关闭Fyne控件的动画：切换标签时指示条的滑动、按下按钮的波纹、
+// 展开下拉框和输入框光标的闪烁。只关闭不打开，不会改掉用户在Fyne设置中关闭的动画
+func (a *App) applyReduceMotion() {
+	if !a.reduceMotion() {
+		return
+	}
+	if err := setFyneAnimationsDisabled(true); err != nil {
+		log.Printf("警告：无法关闭Fyne的动画: %v", err)
+	}
+}
+
+// setReduceMotion 修改设置中的reduceMotion：开启时关闭Fyne的动画，关闭时如果系统也没有要求减弱动态效果，重新打开动画
+func (a *App) setReduceMotion(reduce bool) {
+	a.settings.ReduceMotion = reduce
+	if err := setFyneAnimationsDisabled(a.reduceMotion()); err != nil {
+		log.Printf("警告：无法修改Fyne的动画设置: %v", err)
+	}
+}
+
+// FyneSettingsFile 是Fyne全局设置文件的路径，由main设置为Fyne的SettingsSchema.StoragePath()，为空时不修改Fyne的动画设置
+var FyneSettingsFile string
+
+// setFyneAnimationsDisabled 修改Fyne全局设置文件中的no_animations，其他设置保持不变，已经是要求的值时不写入。
+// Fyne没有关闭动画的接口，只能通过这个设置文件（即fyne_settings修改的文件）关闭；Fyne监控该文件，修改后立即生效，
+// 同时对本机的其他Fyne程序生效
+func setFyneAnimationsDisabled(disabled bool) error {
+	path := FyneSettingsFile
+	if path == "" {
+		return nil
+	}
+	settings := make(map[string]json.RawMessage)
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return fmt.Errorf("无法解析Fyne的设置 %s: %v", logging.Path(path), err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("无法读取Fyne的设置: %v", err)
+	}
+
+	var current bool
+	if raw, ok := settings["no_animations"]; ok {
+		json.Unmarshal(raw, &current)
+	}
+	if current == disabled {
+		return nil
+	}
+	settings["no_animations"], _ = json.Marshal(disabled)
+	if data, err = json.MarshalIndent(settings, "", "  "); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("无法创建Fyne的设置目录: %v", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("无法写入Fyne的设置: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/internal/remote"
+)
+
+// remoteWatchers 是打开的远程文件的监控，同一个文件在多个窗口中打开时只监控一次
+type remoteWatchers struct {
+	mu       sync.Mutex
+	watchers map[string]*remote.Watcher
+	refs     map[string]int // 每个本地副本打开的标签数
+}
+
+// FetchRemote 把参数中 user@host:/path 形式的远程文件复制到本机，返回替换为本地副本路径的参数。
+// 本机存在同名文件时按本机文件处理；复制失败的参数被去掉，错误写入日志
+func FetchRemote(args []string) []string {
+	var files []string
+	for _, arg := range args {
+		spec, ok := remote.Parse(arg)
+		if _, err := os.Stat(arg); err == nil || !ok {
+			files = append(files, arg)
+			continue
+		}
+		local, err := spec.Fetch()
+		if err != nil {
+			log.Printf("无法打开远程文件 %s: %v", logging.Path(spec.String()), err)
+			continue
+		}
+		log.Printf("已复制远程文件 %s 到 %s", logging.Path(spec.String()), logging.Path(local))
+		files = append(files, local)
+	}
+	return files
+}
+
+// watchRemote 在打开远程文件的本地副本时开始检查远程文件的变化，关闭最后一个标签时停止。
+// 远程文件变化后重新复制，由标签页的文件监控重新渲染
+func (a *App) watchRemote() {
+	w := &remoteWatchers{watchers: make(map[string]*remote.Watcher), refs: make(map[string]int)}
+	a.events.Subscribe(func(e event.Event) {
+		spec, ok := remote.FromLocal(e.Path)
+		if !ok {
+			return
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if e.Type == event.FileOpened {
+			w.refs[e.Path]++
+			if w.watchers[e.Path] == nil {
+				log.Printf("开始检查远程文件 %s 的变化", logging.Path(spec.String()))
+				w.watchers[e.Path] = remote.Watch(spec, remote.PollInterval)
+			}
+			return
+		}
+		if w.refs[e.Path]--; w.refs[e.Path] > 0 {
+			return
+		}
+		delete(w.refs, e.Path)
+		if watcher := w.watchers[e.Path]; watcher != nil {
+			watcher.Stop()
+			delete(w.watchers, e.Path)
+			log.Printf("停止检查远程文件 %s 的变化", logging.Path(spec.String()))
+		}
+	}, event.FileOpened, event.TabClosed)
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"plantumlmacviewer/internal/ipc"
+	"plantumlmacviewer/plantuml"
+)
+
+// 不打开窗口导出、转换和检查时结果的输出格式
+const (
+	// ReportJSON 以JSON输出每个文件的结果，见ipc.Response
+	ReportJSON = "json"
+	// ReportGitHub 把失败的文件输出为GitHub Actions的工作流命令，CI在源码的出错行旁显示错误
+	ReportGitHub = "github"
+	// ReportJUnit 输出JUnit XML，每个文件一个测试用例，CI可以据此统计图表构建的健康情况
+	ReportJUnit = "junit"
+)
+
+// ReportFormats 是所有结果的输出格式
+var ReportFormats = []string{ReportJSON, ReportGitHub, ReportJUnit}
+
+// reportFormat 是ReportResults使用的输出格式
+var reportFormat = ReportJSON
+
+// SetReportFormat 设置之后ReportResults在标准输出中使用的格式，不支持的格式返回错误
+func SetReportFormat(format string) error {
+	for _, f := range ReportFormats {
+		if f == format {
+			reportFormat = format
+			return nil
+		}
+	}
+	return fmt.Errorf("不支持的结果格式: %s（支持: %s）", format, strings.Join(ReportFormats, ", "))
+}
+
+// NewResult 根据处理文件时返回的错误创建结果，PlantUML报告的错误会带上出错行号
+func NewResult(file string, err error) ipc.Result {
+	if err == nil {
+		return ipc.Result{File: file, OK: true}
+	}
+	return ipc.Result{File: file, Error: err.Error(), Line: plantuml.ErrorLine(err)}
+}
+
+// ReportResults 将结果按SetReportFormat设置的格式（默认为JSON）写入stdout，失败的文件同时写入stderr，
+// 有失败时返回非0的退出码
+func ReportResults(stdout, stderr io.Writer, results []ipc.Result) int {
+	var err error
+	switch reportFormat {
+	case ReportGitHub:
+		WriteAnnotations(stdout, results)
+	case ReportJUnit:
+		err = WriteJUnit(stdout, results)
+	default:
+		err = ipc.WriteResults(stdout, results)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "无法输出结果: %v\n", err)
+	}
+
+	code := 0
+	for _, r := range results {
+		if r.OK {
+			continue
+		}
+		code = 1
+		if r.Line > 0 {
+			fmt.Fprintf(stderr, "%s:%d: %s\n", r.File, r.Line, r.Error)
+		} else {
+			fmt.Fprintf(stderr, "%s: %s\n", r.File, r.Error)
+		}
+	}
+	return code
+}
+
+// timed 执行fn，在返回的结果中记录用时（秒，精确到毫秒）
+func timed(fn func() ipc.Result) ipc.Result {
+	start := time.Now()
+	r := fn()
+	r.Duration = math.Round(time.Since(start).Seconds()*1000) / 1000
+	return r
+}
+
+// junitSuites 是JUnit XML的根元素
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit 把结果写成JUnit XML：每个文件一个测试用例，用时为Duration，失败的文件带上错误和出错行，
+// 输出已是最新（命中缓存）的文件标为跳过。文件名与WriteAnnotations一样相对于GitHub工作区或当前目录
+func WriteJUnit(w io.Writer, results []ipc.Result) error {
+	suite := junitSuite{Name: "plantumlviewer", Tests: len(results)}
+	for _, r := range results {
+		name := annotationPath(r.File)
+		// 按目录分组，与Java的包名一样以.分隔
+		class := "plantumlviewer"
+		if dir := path.Dir(name); dir != "." && !path.IsAbs(dir) {
+			class += "." + strings.ReplaceAll(dir, "/", ".")
+		}
+		c := junitCase{Name: name, ClassName: class, Time: r.Duration, SystemOut: r.Output}
+		switch {
+		case !r.OK:
+			suite.Failures++
+			text := r.Error
+			if r.Line > 0 {
+				text = fmt.Sprintf("%s:%d: %s", name, r.Line, r.Error)
+			}
+			c.Failure = &junitFailure{Message: firstLine(r.Error), Type: "PlantUML", Text: text}
+		case r.UpToDate:
+			suite.Skipped++
+			c.Skipped = &junitSkipped{Message: "输出已是最新，没有重新渲染"}
+		}
+		suite.Time += r.Duration
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = math.Round(suite.Time*1000) / 1000
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// firstLine 返回s的第一行
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// WriteAnnotations 把失败的文件写成GitHub Actions的 ::error 工作流命令，带上文件和PlantUML报告的出错行。
+// 文件路径相对于GITHUB_WORKSPACE（没有设置时相对于当前目录），GitHub才能找到对应的源码
+func WriteAnnotations(w io.Writer, results []ipc.Result) {
+	for _, r := range results {
+		if r.OK {
+			continue
+		}
+		props := "file=" + escapeProperty(annotationPath(r.File))
+		if r.Line > 0 {
+			props += fmt.Sprintf(",line=%d", r.Line)
+		}
+		props += ",title=PlantUML"
+		fmt.Fprintf(w, "::error %s::%s\n", props, escapeData(r.Error))
+	}
+}
+
+// annotationPath 返回file相对于GitHub工作区的路径，不在工作区中时保持原样
+func annotationPath(file string) string {
+	base := os.Getenv("GITHUB_WORKSPACE")
+	if base == "" {
+		base, _ = os.Getwd()
+	}
+	if base != "" && filepath.IsAbs(file) {
+		if rel, err := filepath.Rel(base, file); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(file)
+}
+
+// escapeData 转义工作流命令的消息，多行的错误输出保持为一条命令
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(strings.TrimRight(s, "\n"))
+}
+
+// escapeProperty 转义工作流命令的属性值，除了消息中需要转义的字符，还有分隔属性的:和,
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
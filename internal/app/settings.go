@@ -0,0 +1,78 @@
+package app
+
+import (
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/logging"
+)
+
+// exportSettings 把用户设置和工作区状态导出为一个设置文件，团队成员导入后使用相同的查看器设置。
+// 默认不包含本机的路径（守护模式的目录和各文件的标签设置），只在自己的几台电脑之间同步时才需要
+func (a *App) exportSettings() {
+	includePaths := widget.NewCheck("包含本机路径（守护模式的目录、各文件的标签标题、颜色、定时刷新和编码）", nil)
+	dialog.ShowForm("导出设置", "下一步", "取消", []*widget.FormItem{
+		widget.NewFormItem("", includePaths),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		bundle := config.NewBundle(a.settings, a.session, includePaths.Checked)
+		save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, a.window)
+				return
+			}
+			if writer == nil {
+				return // 用户取消
+			}
+			defer writer.Close()
+			if err := bundle.Encode(writer); err != nil {
+				dialog.ShowError(err, a.window)
+				return
+			}
+			log.Printf("已导出设置: %s", logging.Path(writer.URI().Path()))
+		}, a.window)
+		save.SetFileName("plantumlviewer" + config.BundleExt)
+		save.Show()
+	}, a.window)
+}
+
+// importSettings 导入设置文件：替换当前的用户设置，把其中的工作区状态合并到当前的工作区状态。
+// 高对比度、字体等大部分设置在重新启动后生效
+func (a *App) importSettings() {
+	open := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, a.window)
+			return
+		}
+		if reader == nil {
+			return // 用户取消
+		}
+		defer reader.Close()
+		bundle, err := config.ReadBundle(reader, a.settings)
+		if err != nil {
+			dialog.ShowError(err, a.window)
+			return
+		}
+		dialog.ShowConfirm("导入设置", "导入后将替换当前的设置，确定导入吗？", func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := bundle.Apply(a.settings, a.session); err != nil {
+				dialog.ShowError(fmt.Errorf("无法保存工作区状态: %v", err), a.window)
+			}
+			a.saveSettings()
+			log.Printf("已导入设置: %s", logging.Path(reader.URI().Path()))
+			dialog.ShowInformation("导入设置", "设置已导入，重新启动后全部生效", a.window)
+		}, a.window)
+	}, a.window)
+	open.SetFilter(storage.NewExtensionFileFilter([]string{".json"}))
+	open.Show()
+}
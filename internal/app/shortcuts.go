@@ -0,0 +1,104 @@
+package app
+
+import (
+	"log"
+	"time"
+
+	"fyne.io/fyne/v2"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+// keyLog 限制按键日志的频率，按住方向键时不会刷屏。按键只在调试级别记录
+var keyLog = logging.Limiter{Interval: 200 * time.Millisecond}
+
+// setupShortcuts 设置键盘快捷键
+func (a *App) setupShortcuts() {
+	// 完全重新实现键盘事件处理，确保Tab键后方向键仍然有效
+	canvas := a.window.Canvas()
+
+	// Cmd+W、Cmd+N等带修饰键的快捷键设置在对应的菜单项上（见setupMainMenu），
+	// 编辑草稿等控件有焦点时也有效，并且可以通过菜单栏用键盘和读屏软件找到。
+	// 下面只处理没有控件获得焦点时的单个按键
+
+	// 设置一个键盘事件处理函数
+	canvas.SetOnTypedKey(func(ke *fyne.KeyEvent) {
+		keyLog.Debugf("接收到键盘事件: %v", ke.Name)
+
+		// 确保mainUI已初始化
+		if a.mainUI == nil {
+			return
+		}
+
+		// 处理按键
+		// Tab和Shift+Tab由Fyne用于在控件之间移动焦点，不会传到这里
+		switch ke.Name {
+		case fyne.KeyLeft:
+			log.Println("处理左方向键: 上一标签页")
+			a.mainUI.PrevTab()
+		case fyne.KeyRight:
+			log.Println("处理右方向键: 下一标签页")
+			a.mainUI.NextTab()
+		case fyne.KeyEscape:
+			// ESC键退出全屏
+			if a.window.FullScreen() {
+				a.window.SetFullScreen(false)
+			}
+		case fyne.KeyF11:
+			// F11切换全屏模式
+			log.Println("处理F11键: 切换全屏模式")
+			currentFullScreen := a.window.FullScreen()
+			a.window.SetFullScreen(!currentFullScreen)
+
+			// 如果退出全屏模式，尝试恢复到最大化尺寸
+			if currentFullScreen {
+				// 给UI一点时间更新
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					fyne.Do(func() {
+						// 获取当前Canvas尺寸
+						canvasSize := a.window.Canvas().Size()
+						// 调整为接近最大尺寸
+						a.window.Resize(fyne.NewSize(canvasSize.Width*0.99, canvasSize.Height*0.99))
+					})
+				}()
+			}
+		case fyne.KeyF10:
+			// F10进入窗口最大化模式（非全屏）
+			log.Println("处理F10键: 最大化窗口")
+
+			// 确保不是全屏模式
+			if a.window.FullScreen() {
+				a.window.SetFullScreen(false)
+			}
+
+			// 获取当前Canvas尺寸
+			canvasSize := a.window.Canvas().Size()
+			if canvasSize.Width > 100 {
+				// 获取到有效尺寸，设置为接近最大尺寸（不是完全最大，避免遮挡系统UI）
+				effectiveWidth := canvasSize.Width * 0.95
+				effectiveHeight := canvasSize.Height * 0.95
+				log.Printf("设置窗口尺寸为: %.2f x %.2f", effectiveWidth, effectiveHeight)
+				a.window.Resize(fyne.NewSize(effectiveWidth, effectiveHeight))
+			} else {
+				// 使用固定大尺寸
+				log.Println("使用默认大尺寸 1200x800")
+				a.window.Resize(fyne.NewSize(1200, 800))
+			}
+		}
+	})
+
+	// 设置窗口获取焦点事件
+	a.window.SetOnClosed(func() {
+		a.lock.Release()
+	})
+
+	// 确保窗口始终获取焦点
+	a.window.RequestFocus()
+
+	// 修复Tab键后焦点问题 - 监听窗口获取焦点的事件
+	a.window.Canvas().SetOnTypedRune(func(r rune) {
+		// 在任何字符输入后重新请求焦点，这有助于保持键盘事件的响应
+		a.window.RequestFocus()
+	})
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"log"
+	"sort"
+
+	"fyne.io/fyne/v2"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/ui"
+)
+
+// workspaceWindow 是window模式下显示一个工作区中文件的窗口。菜单只在主窗口中并作用于主窗口，
+// 工作区窗口可以用方向键切换标签，关闭窗口时停止其中所有文件的监控
+type workspaceWindow struct {
+	root   string
+	window fyne.Window
+	mainUI *ui.MainUI
+}
+
+// routeFile 按设置的工作区方式决定在哪里打开其他实例发来的文件，返回打开文件的界面和窗口以及打开时的选项。
+// 不属于任何工作区的文件在主窗口中打开
+func (a *App) routeFile(file string, opts ui.OpenOptions) (*ui.MainUI, fyne.Window, ui.OpenOptions) {
+	mode := a.settings.Workspaces
+	if mode == config.WorkspacesOff || !config.IsWorkspaceMode(mode) {
+		return a.mainUI, a.window, opts
+	}
+	root := config.WorkspaceRoot(file)
+	if root == "" {
+		return a.mainUI, a.window, opts
+	}
+	if mode == config.WorkspacesGroup {
+		opts.Group = config.WorkspaceName(root)
+		return a.mainUI, a.window, opts
+	}
+	if w := a.workspaceWindowFor(file, root); w != nil {
+		return w.mainUI, w.window, opts
+	}
+	return a.mainUI, a.window, opts
+}
+
+// workspaceWindowFor 返回打开file的工作区窗口，需要时创建；应在主窗口中打开时返回nil。
+// 已经打开的文件留在原来的窗口中。主窗口显示启动时打开的文件所在的工作区，启动时没有打开文件的主窗口显示第一个发来的工作区
+func (a *App) workspaceWindowFor(file, root string) *workspaceWindow {
+	if open, _ := a.mainUI.FileRenderError(file); open {
+		return nil
+	}
+	for _, w := range a.workspaces {
+		if open, _ := w.mainUI.FileRenderError(file); open {
+			return w
+		}
+	}
+	if a.mainRoot == "" && len(a.mainUI.OpenedFiles()) == 0 {
+		a.mainRoot = root
+	}
+	if root == a.mainRoot {
+		return nil
+	}
+	if w := a.workspaces[root]; w != nil {
+		return w
+	}
+	return a.newWorkspaceWindow(root)
+}
+
+// newWorkspaceWindow 为root创建工作区窗口并显示
+func (a *App) newWorkspaceWindow(root string) *workspaceWindow {
+	log.Printf("为工作区 %s 创建窗口", logging.Path(root))
+	window := a.fyneApp.NewWindow("PlantUML Viewer - " + config.WorkspaceName(root))
+	mainUI, _ := ui.NewMainUI(window, nil, a.settings, a.renderer, a.events)
+	mainUI.SetSession(a.session)
+	if a.mainUI.WatchingPaused() {
+		mainUI.PauseWatching()
+	}
+	window.SetContent(mainUI.GetContent())
+
+	w := &workspaceWindow{root: root, window: window, mainUI: mainUI}
+	window.Canvas().SetOnTypedKey(func(ke *fyne.KeyEvent) {
+		switch ke.Name {
+		case fyne.KeyLeft:
+			mainUI.PrevTab()
+		case fyne.KeyRight:
+			mainUI.NextTab()
+		}
+	})
+	window.SetCloseIntercept(func() {
+		mainUI.StopAllMonitoring()
+		delete(a.workspaces, root)
+		window.Close()
+	})
+	if a.workspaces == nil {
+		a.workspaces = make(map[string]*workspaceWindow)
+	}
+	a.workspaces[root] = w
+	window.Resize(fyne.NewSize(1024, 768))
+	window.Show()
+	return w
+}
+
+// allUIs 返回主窗口和所有工作区窗口的界面，用于修改所有窗口都要生效的设置
+func (a *App) allUIs() []*ui.MainUI {
+	var uis []*ui.MainUI
+	if a.mainUI != nil {
+		uis = append(uis, a.mainUI)
+	}
+	roots := make([]string, 0, len(a.workspaces))
+	for root := range a.workspaces {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		uis = append(uis, a.workspaces[root].mainUI)
+	}
+	return uis
+}
+
+// uiForFile 返回打开了path的界面和窗口，没有窗口打开它时返回主窗口
+func (a *App) uiForFile(path string) (*ui.MainUI, fyne.Window) {
+	for _, w := range a.workspaces {
+		if open, _ := w.mainUI.FileRenderError(path); open {
+			return w.mainUI, w.window
+		}
+	}
+	return a.mainUI, a.window
+}
@@ -0,0 +1,118 @@
+// Package charset 识别和转换PlantUML源文件的字符编码。较早的图表可能以GBK、Shift_JIS或Latin-1保存，
+// 渲染时需要通过 -charset 告诉PlantUML，显示源码时需要转换为UTF-8。
+package charset
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 支持的编码，名称与Java的字符集名称相同，可以直接传给PlantUML的 -charset
+const (
+	UTF8     = "UTF-8"
+	GBK      = "GBK"
+	ShiftJIS = "Shift_JIS"
+	Latin1   = "ISO-8859-1"
+)
+
+// Names 按菜单中的顺序列出支持的编码
+var Names = []string{UTF8, GBK, ShiftJIS, Latin1}
+
+// aliases 是各编码常见的其他写法，按小写查找
+var aliases = map[string]string{
+	"utf-8":      UTF8,
+	"utf8":       UTF8,
+	"gbk":        GBK,
+	"gb2312":     GBK,
+	"cp936":      GBK,
+	"shift_jis":  ShiftJIS,
+	"shift-jis":  ShiftJIS,
+	"sjis":       ShiftJIS,
+	"cp932":      ShiftJIS,
+	"iso-8859-1": Latin1,
+	"latin1":     Latin1,
+	"latin-1":    Latin1,
+}
+
+// encodings 是各编码对应的转换器，UTF-8不需要转换
+var encodings = map[string]encoding.Encoding{
+	GBK:      simplifiedchinese.GBK,
+	ShiftJIS: japanese.ShiftJIS,
+	Latin1:   charmap.ISO8859_1,
+}
+
+// Normalize 把编码名称转换为Names中的名称。空字符串和auto表示自动识别，返回空字符串
+func Normalize(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "auto" {
+		return "", nil
+	}
+	if canonical, ok := aliases[name]; ok {
+		return canonical, nil
+	}
+	return "", fmt.Errorf("不支持的字符编码: %s（支持 %s）", name, strings.Join(Names, "、"))
+}
+
+// utf8BOM 是UTF-8文件开头可能带有的字节顺序标记
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Detect 尽量识别data的编码：合法的UTF-8视为UTF-8；否则能按Shift_JIS解码并且含有假名时为Shift_JIS，
+// 能按GBK解码时为GBK，都不行时为Latin-1（任何字节都是合法的Latin-1）
+func Detect(data []byte) string {
+	if bytes.HasPrefix(data, utf8BOM) || utf8.Valid(data) {
+		return UTF8
+	}
+	if text, ok := decodeStrict(data, ShiftJIS); ok && containsKana(text) {
+		return ShiftJIS
+	}
+	if _, ok := decodeStrict(data, GBK); ok {
+		return GBK
+	}
+	return Latin1
+}
+
+// decodeStrict 按编码name解码，遇到无法解码的字节时返回false
+func decodeStrict(data []byte, name string) (string, bool) {
+	decoded, err := encodings[name].NewDecoder().Bytes(data)
+	if err != nil || bytes.ContainsRune(decoded, utf8.RuneError) {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// containsKana 判断文本中是否有全角的平假名或片假名，用于区分日文和中文。
+// GBK的双字节文本按Shift_JIS解码时常常变成半角片假名，所以不计半角片假名
+func containsKana(text string) bool {
+	for _, r := range text {
+		if r >= 0x3040 && r <= 0x30FF {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode 把编码为name的data转换为UTF-8文本，name为空时先用Detect识别
+func Decode(data []byte, name string) (string, error) {
+	if name == "" {
+		name = Detect(data)
+	}
+	if name == UTF8 {
+		return string(bytes.TrimPrefix(data, utf8BOM)), nil
+	}
+	enc, ok := encodings[name]
+	if !ok {
+		return "", fmt.Errorf("不支持的字符编码: %s", name)
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", fmt.Errorf("无法按%s解码: %v", name, err)
+	}
+	return string(decoded), nil
+}
@@ -0,0 +1,68 @@
+package charset
+
+import "testing"
+
+var (
+	gbkSource      = []byte("@startuml\n\xd3\xc3\xbb\xa7 -> \xcf\xb5\xcd\xb3: \xb5\xc7\xc2\xbc\n@enduml\n")
+	shiftJISSource = []byte("@startuml\n\x83\x86\x81[\x83U\x81[ -> \x83V\x83X\x83e\x83\x80: \x83\x8d\x83O\x83C\x83\x93\n@enduml\n")
+	latin1Source   = []byte("@startuml\nBenutzer -> Gr\xf6\xdfe: caf\xe9\n@enduml\n")
+)
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"":           "",
+		"auto":       "",
+		"utf8":       UTF8,
+		"GB2312":     GBK,
+		" sjis ":     ShiftJIS,
+		"Shift_JIS":  ShiftJIS,
+		"latin-1":    Latin1,
+		"ISO-8859-1": Latin1,
+	}
+	for name, want := range tests {
+		if got, err := Normalize(name); err != nil || got != want {
+			t.Errorf("Normalize(%q) = %q, %v，应为 %q", name, got, err, want)
+		}
+	}
+	if _, err := Normalize("EBCDIC"); err == nil {
+		t.Error("不支持的编码应返回错误")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"UTF-8", []byte("@startuml\n用户 -> 系统\n@enduml\n"), UTF8},
+		{"BOM", []byte("\xef\xbb\xbf@startuml\n@enduml\n"), UTF8},
+		{"GBK", gbkSource, GBK},
+		{"Shift_JIS", shiftJISSource, ShiftJIS},
+		{"Latin-1", latin1Source, Latin1},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.data); got != tt.want {
+			t.Errorf("%s: Detect = %q，应为 %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		charset string
+		want    string
+	}{
+		{gbkSource, "", "@startuml\n用户 -> 系统: 登录\n@enduml\n"},
+		{shiftJISSource, ShiftJIS, "@startuml\nユーザー -> システム: ログイン\n@enduml\n"},
+		{latin1Source, "", "@startuml\nBenutzer -> Größe: café\n@enduml\n"},
+		{[]byte("\xef\xbb\xbf@startuml"), UTF8, "@startuml"},
+	}
+	for _, tt := range tests {
+		got, err := Decode(tt.data, tt.charset)
+		if err != nil || got != tt.want {
+			t.Errorf("Decode(%q, %q) = %q, %v，应为 %q", tt.data, tt.charset, got, err, tt.want)
+		}
+	}
+}
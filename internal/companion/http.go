@@ -0,0 +1,205 @@
+package companion
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"plantumlmacviewer/config"
+)
+
+// HTTP接口提供与套接字接口相同的方法，供不能使用UNIX套接字的工具调用，例如浏览器扩展，
+// 或通过SSH端口转发连接的Windows上的编辑器：
+//
+//	POST /v1/open
+//	Authorization: Bearer <令牌>
+//	{"file":"/a.puml"}
+//
+// 请求体为方法的参数，成功时返回200和 {"result":...}，失败时返回 {"error":"..."}。
+// HTTP没有推送，需要诊断信息时调用errors方法
+
+// HTTPPrefix 是HTTP接口的路径前缀，后面是方法名
+const HTTPPrefix = "/v1/"
+
+// 读取HTTP请求和写入响应的超时，写入的超时包括处理的时间，打开文件时需要等待渲染完成
+const (
+	httpReadTimeout  = 10 * time.Second
+	httpWriteTimeout = time.Minute
+)
+
+// HTTPServer 在本机的TCP端口上以HTTP提供编辑器接口的方法，每个请求都需要令牌
+type HTTPServer struct {
+	token    string
+	listener net.Listener
+	server   *http.Server
+	methods  map[string]Method
+}
+
+// HTTPTokenPath 返回HTTP接口的令牌文件，位于只有当前用户能读取的配置目录中
+func HTTPTokenPath() string {
+	return filepath.Join(config.Dir(), "http.token")
+}
+
+// LoadHTTPToken 读取HTTP接口的令牌，没有时生成一个随机令牌并保存，权限为0600。
+// 令牌在重新启动后保持不变，浏览器扩展等工具只需要配置一次
+func LoadHTTPToken() (string, error) {
+	path := HTTPTokenPath()
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	}
+	var buf [32]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("无法生成HTTP接口的令牌: %v", err)
+	}
+	token := hex.EncodeToString(buf[:])
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("无法创建配置目录: %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("无法保存HTTP接口的令牌: %v", err)
+	}
+	return token, nil
+}
+
+// ListenHTTP 在本机TCP地址addr（例如 127.0.0.1:17396）上监听HTTP请求，请求需要带上token
+func ListenHTTP(addr, token string) (*HTTPServer, error) {
+	if token == "" {
+		return nil, fmt.Errorf("HTTP接口需要令牌")
+	}
+	if !IsTCPAddr(addr) {
+		return nil, fmt.Errorf("HTTP接口的地址应为本机TCP地址，例如 127.0.0.1:17396: %s", addr)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的地址 %s: %v", addr, err)
+	}
+	if !isLoopbackHost(host) {
+		return nil, fmt.Errorf("只能监听本机地址: %s", addr)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("无法启动HTTP接口: %v", err)
+	}
+	log.Printf("HTTP接口已启动，监听地址: %s", listener.Addr())
+	s := &HTTPServer{token: token, listener: listener, methods: make(map[string]Method)}
+	s.server = &http.Server{Handler: s, ReadTimeout: httpReadTimeout, WriteTimeout: httpWriteTimeout}
+	return s, nil
+}
+
+// Addr 返回实际监听的地址，端口为0时可以得到系统分配的端口
+func (s *HTTPServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Handle 注册方法的处理函数，需要在Serve之前调用
+func (s *HTTPServer) Handle(method string, fn Method) {
+	s.methods[method] = fn
+}
+
+// Notify 什么也不做：HTTP接口没有推送，客户端通过errors方法查询诊断信息
+func (s *HTTPServer) Notify(method string, params interface{}) {}
+
+// Serve 处理请求，直到调用Close为止
+func (s *HTTPServer) Serve() {
+	if err := s.server.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("HTTP接口出错：%v", err)
+	}
+}
+
+// Close 关闭服务器
+func (s *HTTPServer) Close() error {
+	return s.server.Close()
+}
+
+// ServeHTTP 检查Host和令牌，把请求体作为参数调用路径中的方法
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 只接受以本机地址访问的请求，网页不能通过DNS重新绑定把自己的域名指向本机来调用接口
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if !isLoopbackHost(host) {
+		writeHTTP(w, http.StatusForbidden, Message{Error: "只接受以本机地址访问的请求"})
+		return
+	}
+	if !s.authorized(r) {
+		writeHTTP(w, http.StatusUnauthorized, Message{Error: "认证失败"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeHTTP(w, http.StatusMethodNotAllowed, Message{Error: "只支持POST请求"})
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, HTTPPrefix)
+	fn, ok := s.methods[name]
+	if !strings.HasPrefix(r.URL.Path, HTTPPrefix) || !ok {
+		writeHTTP(w, http.StatusNotFound, Message{Error: fmt.Sprintf("不支持的方法: %s", name)})
+		return
+	}
+
+	params, err := ioutil.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+	if err != nil {
+		writeHTTP(w, http.StatusBadRequest, Message{Error: fmt.Sprintf("无法读取请求: %v", err)})
+		return
+	}
+	if len(params) > maxMessageSize {
+		writeHTTP(w, http.StatusRequestEntityTooLarge, Message{Error: "请求太大"})
+		return
+	}
+	log.Printf("HTTP接口调用: %s", name)
+	result, err := fn(json.RawMessage(params))
+	if err != nil {
+		writeHTTP(w, http.StatusUnprocessableEntity, Message{Error: err.Error()})
+		return
+	}
+	if result == nil {
+		result = struct{}{}
+	}
+	writeHTTP(w, http.StatusOK, Message{Result: result})
+}
+
+// authorized 判断请求是否带有正确的令牌：Authorization: Bearer <令牌>
+func (s *HTTPServer) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	got := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	return subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) == 1
+}
+
+// isLoopbackHost 判断主机名是否为localhost或本机IP地址
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// writeHTTP 以JSON写入响应
+func writeHTTP(w http.ResponseWriter, status int, m Message) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(Message{Error: fmt.Sprintf("无法编码结果: %v", err)})
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,113 @@
+package companion
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHTTPServer(t *testing.T) {
+	if _, err := ListenHTTP("0.0.0.0:0", "secret"); err == nil {
+		t.Error("不应监听非本机地址")
+	}
+	if _, err := ListenHTTP("127.0.0.1:0", ""); err == nil {
+		t.Error("没有令牌时应返回错误")
+	}
+	server, err := ListenHTTP("127.0.0.1:0", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.Handle(MethodErrors, func(params json.RawMessage) (interface{}, error) {
+		var p FileParams
+		if err := DecodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if p.File == "" {
+			return nil, fmt.Errorf("没有指定文件")
+		}
+		return Diagnostics{File: p.File, Diagnostics: []Diagnostic{{Line: 3, Message: "语法错误"}}}, nil
+	})
+	go server.Serve()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		host   string
+		token  string
+		body   string
+		status int
+		want   string
+	}{
+		{"成功", "POST", "/v1/errors", "", "secret", `{"file":"/a.puml"}`, 200, `"line":3`},
+		{"方法返回错误", "POST", "/v1/errors", "", "secret", `{}`, 422, "没有指定文件"},
+		{"没有令牌", "POST", "/v1/errors", "", "", `{"file":"/a.puml"}`, 401, "认证失败"},
+		{"令牌错误", "POST", "/v1/errors", "", "wrong", `{"file":"/a.puml"}`, 401, "认证失败"},
+		{"不支持的方法", "POST", "/v1/missing", "", "secret", `{}`, 404, "不支持的方法"},
+		{"GET", "GET", "/v1/errors", "", "secret", "", 405, "只支持POST"},
+		{"其他域名", "POST", "/v1/errors", "evil.example:80", "secret", `{"file":"/a.puml"}`, 403, "本机地址"},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, "http://"+server.Addr()+tt.path, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || !strings.Contains(string(body), tt.want) {
+			t.Errorf("%s: 状态 %d，响应 %s；应为 %d，包含 %q", tt.name, resp.StatusCode, body, tt.status, tt.want)
+		}
+	}
+}
+
+func TestServeHTTPRejectsLargeRequests(t *testing.T) {
+	server := &HTTPServer{token: "secret", methods: map[string]Method{
+		MethodUpdate: func(json.RawMessage) (interface{}, error) { return nil, nil },
+	}}
+	req := httptest.NewRequest("POST", "/v1/update", strings.NewReader(strings.Repeat("x", maxMessageSize+1)))
+	req.Host = "localhost:17396"
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("请求太大时应返回413，得到 %d", w.Code)
+	}
+}
+
+func TestLoadHTTPToken(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	token, err := LoadHTTPToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 64 {
+		t.Errorf("令牌应为32字节的十六进制，得到 %q", token)
+	}
+	info, err := os.Stat(HTTPTokenPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("令牌文件的权限应为0600，得到 %v", info.Mode().Perm())
+	}
+	if again, err := LoadHTTPToken(); err != nil || again != token {
+		t.Errorf("再次读取应得到相同的令牌，得到 %q，%v", again, err)
+	}
+}
@@ -0,0 +1,92 @@
+// Package companion 实现供编辑器扩展（例如VS Code扩展）使用的本地接口。
+//
+// 连接是本机的UNIX套接字或只监听127.0.0.1的TCP端口，双方每行发送一个JSON对象：
+//
+//	请求 {"id":1,"method":"open","params":{"file":"/a.puml"}}
+//	响应 {"id":1,"result":{...}} 或 {"id":1,"error":"..."}
+//	通知 {"method":"diagnostics","params":{"file":"/a.puml","diagnostics":[...]}}
+//
+// 响应的id与请求相同，同一连接上的请求按顺序处理。通知由查看器主动推送，没有id。
+// 方法名、参数和结果的字段名都是协议的一部分，只增加新字段，不修改已有字段的含义。
+package companion
+
+import "encoding/json"
+
+// 编辑器扩展可以调用的方法
+const (
+	// MethodOpen 打开文件并渲染，参数为OpenParams，结果为Diagnostics
+	MethodOpen = "open"
+	// MethodReveal 切换到已打开文件的标签并激活窗口，参数为FileParams
+	MethodReveal = "reveal"
+	// MethodErrors 查询文件最近一次渲染的错误，参数为FileParams，结果为Diagnostics
+	MethodErrors = "errors"
+	// MethodExport 导出文件，参数为ExportParams，结果为ExportResult
+	MethodExport = "export"
+	// MethodUpdate 用编辑器中未保存的内容更新预览，参数为UpdateParams，结果为Diagnostics
+	MethodUpdate = "update"
+)
+
+// NotifyDiagnostics 是查看器在文件每次渲染完成或关闭后推送的通知，参数为Diagnostics
+const NotifyDiagnostics = "diagnostics"
+
+// NotifyGoto 是在查看器中按住Cmd点击图像中的元素时推送的通知，参数为Location，编辑器跳到该行
+const NotifyGoto = "goto"
+
+// Message 是连接上传输的一行消息，请求、响应和通知共用同一个结构
+type Message struct {
+	ID     *int64          `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result interface{}     `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// FileParams 是只需要文件路径的方法的参数
+type FileParams struct {
+	File string `json:"file"` // 文件的绝对路径；update过的未保存内容使用同一个路径
+}
+
+// OpenParams 是open方法的参数，选项的含义与命令行的 -page、-no-focus、-no-select 相同
+type OpenParams struct {
+	File     string `json:"file"`
+	Page     int    `json:"page,omitempty"`
+	NoFocus  bool   `json:"noFocus,omitempty"`
+	NoSelect bool   `json:"noSelect,omitempty"`
+}
+
+// ExportParams 是export方法的参数
+type ExportParams struct {
+	File   string `json:"file"`
+	Format string `json:"format"`           // png、pdf或svg
+	OutDir string `json:"outDir,omitempty"` // 默认与源文件相同
+}
+
+// ExportResult 是export方法的结果
+type ExportResult struct {
+	Output string `json:"output"` // 生成的文件
+}
+
+// UpdateParams 是update方法的参数。查看器渲染Text而不是磁盘上的文件，
+// 编辑器可以在每次修改后发送，不需要先保存
+type UpdateParams struct {
+	File string `json:"file"`
+	Text string `json:"text"`
+}
+
+// Location 是源码中的一行
+type Location struct {
+	File string `json:"file"`
+	Line int    `json:"line"` // 从1开始
+}
+
+// Diagnostic 是一条渲染错误，对应编辑器中的一条诊断信息
+type Diagnostic struct {
+	Line    int    `json:"line,omitempty"` // 出错的行，从1开始，无法确定时省略
+	Message string `json:"message"`
+}
+
+// Diagnostics 是文件当前的全部诊断信息，渲染成功时Diagnostics为空数组
+type Diagnostics struct {
+	File        string       `json:"file"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
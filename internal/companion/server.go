@@ -0,0 +1,269 @@
+package companion
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxMessageSize 单行消息的最大长度，update会携带整个文件的内容
+const maxMessageSize = 16 << 20
+
+// writeTimeout 写入一行消息的超时，扩展停止读取时不会一直阻塞
+const writeTimeout = 2 * time.Second
+
+// queueSize 每个连接等待写入的消息数，通知积压超过这个数时丢弃新的通知
+const queueSize = 64
+
+// Method 处理一个方法的请求，返回的结果编码为响应的result
+type Method func(params json.RawMessage) (interface{}, error)
+
+// Endpoint 是提供编辑器接口的方法的服务器，Server和HTTPServer都实现它
+type Endpoint interface {
+	// Handle 注册方法的处理函数
+	Handle(method string, fn Method)
+	// Notify 向所有连接推送通知，不支持推送时什么也不做
+	Notify(method string, params interface{})
+}
+
+// Server 接受编辑器扩展的连接，处理请求并向所有连接推送通知
+type Server struct {
+	network  string
+	addr     string
+	listener net.Listener
+	methods  map[string]Method
+
+	mu      sync.Mutex
+	clients map[*client]bool
+}
+
+// client 是一个扩展的连接，响应和通知都经过out按顺序写入
+type client struct {
+	conn net.Conn
+	out  chan []byte   // 写入nil表示写完之前的消息后断开连接
+	done chan struct{} // 连接断开后关闭
+	once sync.Once
+}
+
+// IsTCPAddr 判断addr是否为TCP地址：不含“/”并且含有“:”，否则为UNIX套接字的路径
+func IsTCPAddr(addr string) bool {
+	return !strings.Contains(addr, "/") && strings.Contains(addr, ":")
+}
+
+// Listen 在addr上监听：含有“/”的地址为UNIX套接字，否则为TCP地址，例如 127.0.0.1:17395。
+// TCP地址只能是本机地址
+func Listen(addr string) (*Server, error) {
+	network := "unix"
+	if IsTCPAddr(addr) {
+		network = "tcp"
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("无效的地址 %s: %v", addr, err)
+		}
+		if !isLoopbackHost(host) {
+			return nil, fmt.Errorf("只能监听本机地址: %s", addr)
+		}
+	} else {
+		os.Remove(addr)
+	}
+
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("无法启动编辑器接口: %v", err)
+	}
+	log.Printf("编辑器接口已启动，监听地址: %s", listener.Addr())
+	return &Server{
+		network:  network,
+		addr:     addr,
+		listener: listener,
+		methods:  make(map[string]Method),
+		clients:  make(map[*client]bool),
+	}, nil
+}
+
+// Addr 返回实际监听的地址，TCP端口为0时可以得到系统分配的端口
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Handle 注册方法的处理函数，需要在Serve之前调用
+func (s *Server) Handle(method string, fn Method) {
+	s.methods[method] = fn
+}
+
+// Serve 接受并处理连接，直到调用Close为止
+func (s *Server) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Printf("编辑器接口接受连接出错：%v", err)
+			continue
+		}
+
+		c := &client{conn: conn, out: make(chan []byte, queueSize), done: make(chan struct{})}
+		s.mu.Lock()
+		s.clients[c] = true
+		s.mu.Unlock()
+		log.Println("编辑器扩展已连接")
+		go c.writeLoop()
+		go s.handle(c)
+	}
+}
+
+// Close 关闭服务器和所有连接，UNIX套接字同时删除套接字文件
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	if s.network == "unix" {
+		os.Remove(s.addr)
+	}
+	s.mu.Lock()
+	for c := range s.clients {
+		c.close()
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// Notify 向所有连接推送通知。不会阻塞：连接的写入队列已满时丢弃该连接的这条通知
+func (s *Server) Notify(method string, params interface{}) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		log.Printf("编码通知 %s 失败: %v", method, err)
+		return
+	}
+	line, err := encode(Message{Method: method, Params: data})
+	if err != nil {
+		log.Printf("编码通知 %s 失败: %v", method, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		select {
+		case c.out <- line:
+		default:
+			log.Printf("编辑器扩展没有及时读取，丢弃通知 %s", method)
+		}
+	}
+}
+
+// handle 逐行读取请求并按顺序处理。扩展关闭连接后不再推送通知，写完已有的响应后断开
+func (s *Server) handle(c *client) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		select {
+		case c.out <- nil:
+		case <-c.done:
+		}
+		log.Println("编辑器扩展已断开")
+	}()
+
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxMessageSize)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		response := s.call(scanner.Bytes())
+		line, err := encode(response)
+		if err != nil {
+			log.Printf("编码响应失败: %v", err)
+			line, _ = encode(Message{ID: response.ID, Error: fmt.Sprintf("无法编码结果: %v", err)})
+		}
+		select {
+		case c.out <- line:
+		case <-c.done:
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("读取编辑器扩展的请求出错: %v", err)
+	}
+}
+
+// call 解码一行请求并调用对应的方法，返回响应
+func (s *Server) call(data []byte) Message {
+	var req Message
+	if err := json.Unmarshal(data, &req); err != nil {
+		return Message{Error: fmt.Sprintf("无法解析请求: %v", err)}
+	}
+	response := Message{ID: req.ID}
+	fn, ok := s.methods[req.Method]
+	if !ok {
+		response.Error = fmt.Sprintf("不支持的方法: %s", req.Method)
+		return response
+	}
+	log.Printf("编辑器扩展调用: %s", req.Method)
+	result, err := fn(req.Params)
+	if err != nil {
+		response.Error = err.Error()
+		return response
+	}
+	if result == nil {
+		result = struct{}{}
+	}
+	response.Result = result
+	return response
+}
+
+// writeLoop 按顺序写入响应和通知，写入失败时断开连接
+func (c *client) writeLoop() {
+	for {
+		select {
+		case line := <-c.out:
+			if line == nil {
+				c.close()
+				return
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if _, err := c.conn.Write(line); err != nil {
+				log.Printf("写入编辑器扩展的连接失败: %v", err)
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// close 关闭连接，可以多次调用
+func (c *client) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// encode 把消息编码为一行JSON
+func encode(m Message) ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// DecodeParams 把请求的参数解码到v中，缺少参数或格式错误时返回错误
+func DecodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return fmt.Errorf("缺少参数")
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return fmt.Errorf("参数格式错误: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package companion
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServer 在临时目录中的UNIX套接字上启动服务器，测试结束时关闭
+func startServer(t *testing.T) *Server {
+	t.Helper()
+	// UNIX套接字路径长度有限，不使用可能很长的t.TempDir
+	dir, err := ioutil.TempDir("", "companion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := Listen(filepath.Join(dir, "test.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Handle(MethodErrors, func(params json.RawMessage) (interface{}, error) {
+		var p FileParams
+		if err := DecodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if p.File == "" {
+			return nil, fmt.Errorf("没有指定文件")
+		}
+		return Diagnostics{File: p.File, Diagnostics: []Diagnostic{{Line: 3, Message: "语法错误"}}}, nil
+	})
+	go server.Serve()
+	t.Cleanup(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+	return server
+}
+
+// dial 连接到服务器，返回连接和逐行读取消息的函数
+func dial(t *testing.T, server *Server) (net.Conn, func() Message) {
+	t.Helper()
+	conn, err := net.Dial("unix", server.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	reader := bufio.NewReader(conn)
+	return conn, func() Message {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("读取消息失败: %v", err)
+		}
+		var m Message
+		if err := json.Unmarshal(line, &m); err != nil {
+			t.Fatalf("无法解析消息 %s: %v", line, err)
+		}
+		return m
+	}
+}
+
+func TestRequestsAreAnsweredInOrder(t *testing.T) {
+	server := startServer(t)
+	conn, read := dial(t, server)
+
+	fmt.Fprint(conn, `{"id":1,"method":"errors","params":{"file":"/a.puml"}}`+"\n"+
+		`{"id":2,"method":"errors","params":{}}`+"\n"+
+		`{"id":3,"method":"unknown"}`+"\n")
+
+	first := read()
+	if first.ID == nil || *first.ID != 1 || first.Error != "" {
+		t.Fatalf("第一个响应不正确: %+v", first)
+	}
+	data, _ := json.Marshal(first.Result)
+	var result Diagnostics
+	if err := json.Unmarshal(data, &result); err != nil || result.File != "/a.puml" || len(result.Diagnostics) != 1 || result.Diagnostics[0].Line != 3 {
+		t.Errorf("结果不正确: %s (%v)", data, err)
+	}
+	if second := read(); second.ID == nil || *second.ID != 2 || second.Error != "没有指定文件" {
+		t.Errorf("第二个响应应返回处理函数的错误: %+v", second)
+	}
+	if third := read(); third.ID == nil || *third.ID != 3 || !strings.Contains(third.Error, "不支持的方法") {
+		t.Errorf("第三个响应应报告不支持的方法: %+v", third)
+	}
+}
+
+func TestNotifyReachesAllClients(t *testing.T) {
+	server := startServer(t)
+	conn1, read1 := dial(t, server)
+	conn2, read2 := dial(t, server)
+
+	// 先完成一次请求，确保两个连接都已被服务器接受
+	for _, conn := range []net.Conn{conn1, conn2} {
+		fmt.Fprint(conn, `{"id":1,"method":"errors","params":{"file":"/a.puml"}}`+"\n")
+	}
+	read1()
+	read2()
+
+	server.Notify(NotifyDiagnostics, Diagnostics{File: "/b.puml", Diagnostics: []Diagnostic{}})
+	for i, read := range []func() Message{read1, read2} {
+		m := read()
+		if m.ID != nil || m.Method != NotifyDiagnostics {
+			t.Fatalf("第%d个连接收到的不是通知: %+v", i+1, m)
+		}
+		var params Diagnostics
+		if err := json.Unmarshal(m.Params, &params); err != nil || params.File != "/b.puml" || params.Diagnostics == nil {
+			t.Errorf("第%d个连接收到的通知参数不正确: %s (%v)", i+1, m.Params, err)
+		}
+	}
+}
+
+func TestListenRejectsRemoteAddress(t *testing.T) {
+	if _, err := Listen("0.0.0.0:0"); err == nil {
+		t.Error("不应允许监听非本机地址")
+	}
+	server, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	server.Close()
+}
@@ -0,0 +1,403 @@
+// Package doctor 检查PlantUML Viewer运行所需的环境：Java、PlantUML、Graphviz、
+// 单实例锁和IPC地址、临时目录和配置目录以及配置文件，对发现的问题给出修复方法。
+package doctor
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/instance"
+	"plantumlmacviewer/internal/ipc"
+	"plantumlmacviewer/plantuml"
+)
+
+// Status 是单项检查的结果
+type Status int
+
+const (
+	Pass Status = iota // 正常
+	Warn               // 可以使用，但部分功能受影响
+	Fail               // 无法正常使用
+)
+
+// String 返回输出中使用的名称
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return "通过"
+	case Warn:
+		return "警告"
+	default:
+		return "失败"
+	}
+}
+
+// Check 是单项检查的结果，Fix是状态不为Pass时的修复方法
+type Check struct {
+	Name   string
+	Status Status
+	Detail string
+	Fix    string
+}
+
+// Paths 是需要检查的文件和目录
+type Paths struct {
+	LockFile    string // 单实例锁文件
+	IPCAddr     string // IPC服务器的UNIX套接字
+	TempDir     string // 渲染时存放中间文件的临时目录
+	ConfigFile  string // 用户设置文件
+	ManagedFile string // 管理员下发的系统级设置文件，为空时不检查
+	ProjectDir  string // 从这个目录开始向上查找项目配置，为空时不检查
+}
+
+// 可以在测试中替换的查找和执行命令的函数
+var (
+	lookPath = exec.LookPath
+	output   = func(name string, args ...string) ([]byte, error) {
+		return exec.Command(name, args...).CombinedOutput()
+	}
+	findJar = plantuml.FindJar
+	version = plantuml.Version
+)
+
+// Run 执行所有检查并输出结果，返回进程退出码
+func Run(w io.Writer, paths Paths) int {
+	return Report(w, Checks(paths))
+}
+
+// Checks 按顺序执行所有检查
+func Checks(paths Paths) []Check {
+	checks := []Check{
+		checkJava(),
+		checkPlantUML(),
+		checkGraphviz(),
+		checkLock(paths.LockFile),
+		checkSocket(paths.IPCAddr, paths.LockFile),
+		checkTempDir(paths.TempDir),
+		checkConfig(paths.ConfigFile),
+	}
+	if paths.ManagedFile != "" {
+		checks = append(checks, checkManaged(paths.ManagedFile))
+	}
+	if paths.ProjectDir != "" {
+		checks = append(checks, checkProject(paths.ProjectDir))
+	}
+	return checks
+}
+
+// Report 输出每项检查的结果和修复方法，有失败的检查时返回1，否则返回0
+func Report(w io.Writer, checks []Check) int {
+	var failed, warned int
+	for _, c := range checks {
+		fmt.Fprintf(w, "%s %s: %s\n", c.Status, c.Name, c.Detail)
+		if c.Status != Pass && c.Fix != "" {
+			fmt.Fprintf(w, "     修复: %s\n", c.Fix)
+		}
+		switch c.Status {
+		case Warn:
+			warned++
+		case Fail:
+			failed++
+		}
+	}
+	fmt.Fprintf(w, "共%d项检查，%d项失败，%d项警告\n", len(checks), failed, warned)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkJava 检查java命令是否可以运行，plantuml.jar和Homebrew的plantuml命令都需要它
+func checkJava() Check {
+	c := Check{Name: "Java", Fix: "安装Java 8或更高版本（例如 brew install openjdk），并确认 java 在PATH中"}
+	path, err := lookPath("java")
+	if err != nil {
+		c.Status, c.Detail = Fail, "找不到 java 命令"
+		return c
+	}
+	out, err := output(path, "-version")
+	if err != nil {
+		// macOS自带的/usr/bin/java在没有安装JDK时只会提示安装
+		c.Status, c.Detail = Fail, fmt.Sprintf("%s 无法运行: %s", path, firstLine(out, err))
+		return c
+	}
+	c.Detail = firstLine(out, nil)
+	return c
+}
+
+// checkPlantUML 检查能否找到plantuml.jar或plantuml命令行工具，并能取得版本号
+func checkPlantUML() Check {
+	c := Check{Name: "PlantUML"}
+	jar := findJar()
+	if jar != "" {
+		c.Detail = jar
+	} else if path, err := lookPath("plantuml"); err == nil {
+		c.Detail = "命令行工具 " + path
+	} else {
+		c.Status, c.Detail = Fail, "找不到 plantuml.jar 或 plantuml 命令行工具"
+		c.Fix = "brew install plantuml，或下载 plantuml.jar 放到 ~/plantuml.jar"
+		return c
+	}
+
+	v, err := version()
+	if err != nil {
+		c.Status, c.Detail = Fail, fmt.Sprintf("%s 无法运行: %v", c.Detail, err)
+		c.Fix = "先解决Java的问题；Java正常时重新下载 plantuml.jar，文件可能已损坏"
+		return c
+	}
+	c.Detail = fmt.Sprintf("%s（版本 %s）", c.Detail, v)
+	return c
+}
+
+// checkGraphviz 检查PlantUML使用的Graphviz：优先使用环境变量GRAPHVIZ_DOT指定的程序，否则使用PATH中的dot
+func checkGraphviz() Check {
+	c := Check{Name: "Graphviz", Fix: "brew install graphviz，或用环境变量 GRAPHVIZ_DOT 指定 dot 程序的路径"}
+	path := os.Getenv("GRAPHVIZ_DOT")
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			c.Status, c.Detail = Warn, fmt.Sprintf("GRAPHVIZ_DOT 指定的 %s 不存在，类图、组件图等需要Graphviz的图表无法渲染", path)
+			return c
+		}
+	} else {
+		var err error
+		if path, err = lookPath("dot"); err != nil {
+			c.Status, c.Detail = Warn, "找不到 dot 命令，时序图等可以正常渲染，类图、组件图等需要Graphviz的图表无法渲染"
+			return c
+		}
+	}
+	out, err := output(path, "-V")
+	if err != nil {
+		c.Status, c.Detail = Warn, fmt.Sprintf("%s 无法运行: %s", path, firstLine(out, err))
+		return c
+	}
+	c.Detail = firstLine(out, nil)
+	return c
+}
+
+// checkLock 检查单实例锁文件。属于其他用户的锁文件会让新实例无法判断是否已在运行
+func checkLock(path string) Check {
+	c := Check{Name: "单实例锁"}
+	locked, err := instance.Locked(path)
+	switch {
+	case err != nil:
+		c.Status, c.Detail = Fail, fmt.Sprintf("%s: %v", path, err)
+		c.Fix = fmt.Sprintf("删除锁文件（可能由其他用户创建）: sudo rm %s", path)
+	case locked:
+		c.Detail = "有实例正在运行"
+		if data, err := ioutil.ReadFile(path); err == nil && len(data) > 0 {
+			c.Detail += fmt.Sprintf("（进程ID %s）", strings.TrimSpace(string(data)))
+		}
+	case exists(path):
+		c.Status, c.Detail = Warn, fmt.Sprintf("%s 是上次没有正常退出时留下的锁文件，下次启动时会自动删除", path)
+		c.Fix = "rm " + path
+	default:
+		c = checkWritableDir(c, filepath.Dir(path))
+		if c.Status == Pass {
+			c.Detail = "没有运行中的实例"
+		}
+	}
+	return c
+}
+
+// checkSocket 检查IPC地址：有实例在运行时确认可以连接，否则确认启动时能在这里创建套接字
+func checkSocket(addr, lockFile string) Check {
+	c := Check{Name: "IPC地址"}
+	if locked, _ := instance.Locked(lockFile); locked {
+		conn, err := net.DialTimeout("unix", addr, time.Second)
+		if err != nil {
+			c.Status, c.Detail = Fail, fmt.Sprintf("有实例在运行，但无法连接 %s: %v，命令行发送的文件不会在窗口中打开", addr, err)
+			c.Fix = fmt.Sprintf("退出PlantUML Viewer（无法退出时结束锁文件 %s 中的进程），然后重新启动", lockFile)
+			return c
+		}
+		conn.Close()
+		if _, err := ioutil.ReadFile(ipc.TokenPath(addr)); err != nil {
+			c.Status, c.Detail = Fail, fmt.Sprintf("无法读取运行中的实例的令牌: %v，命令行发送的文件会被拒绝", err)
+			c.Fix = "确认运行中的实例是由当前用户启动的；否则退出PlantUML Viewer后重新启动，生成新的令牌"
+			return c
+		}
+		c.Detail = "可以连接运行中的实例"
+		return c
+	}
+
+	if info, err := os.Lstat(addr); err == nil {
+		// 启动时会删除旧的套接字，属于其他用户的文件在/tmp中无法删除
+		if ownedByOther(info) {
+			c.Status, c.Detail = Fail, fmt.Sprintf("%s 属于其他用户，启动时无法创建IPC服务器", addr)
+			c.Fix = "sudo rm " + addr
+			return c
+		}
+	}
+	c = checkWritableDir(c, filepath.Dir(addr))
+	if c.Status == Pass {
+		c.Detail = addr + "（启动时创建）"
+	}
+	return c
+}
+
+// checkTempDir 检查渲染时存放中间文件的临时目录是否可写
+func checkTempDir(dir string) Check {
+	c := checkWritableDir(Check{Name: "临时目录"}, dir)
+	if c.Status != Pass {
+		c.Fix = "用环境变量 TMPDIR 指定一个可写的目录，或修正该目录的权限"
+	}
+	return c
+}
+
+// checkConfig 检查用户设置文件能否解析，以及其中的守护模式目录是否存在
+func checkConfig(path string) Check {
+	c := Check{Name: "配置文件", Detail: path}
+	if !exists(path) {
+		c.Detail = path + "（不存在，使用默认设置）"
+		return c
+	}
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		c.Status, c.Detail = Fail, fmt.Sprintf("%s: %v", path, err)
+		c.Fix = fmt.Sprintf("修正 %s 的格式，或删除它恢复默认设置", path)
+		return c
+	}
+	if !config.IsWorkspaceMode(cfg.Workspaces) {
+		c.Status, c.Detail = Warn, fmt.Sprintf("workspaces 的值 %s 无效，其他实例发来的文件不会按工作区分开", cfg.Workspaces)
+		c.Fix = fmt.Sprintf("在 %s 中把workspaces改为group、window或删除它", path)
+		return c
+	}
+	if !config.IsRenderer(cfg.Renderer) {
+		c.Status, c.Detail = Warn, fmt.Sprintf("renderer 的值 %s 无效，使用默认的渲染器", cfg.Renderer)
+		c.Fix = fmt.Sprintf("在 %s 中把renderer改为%s或删除它", path, strings.Join(config.Renderers, "、"))
+		return c
+	}
+	if cfg.RenderTimeout < 0 {
+		c.Status, c.Detail = Warn, fmt.Sprintf("renderTimeout 的值 %g 无效，使用默认的%g秒", cfg.RenderTimeout, config.DefaultRenderTimeout.Seconds())
+		c.Fix = fmt.Sprintf("在 %s 中把renderTimeout改为正数（秒）或删除它", path)
+		return c
+	}
+	if cfg.MaxRenders < 0 {
+		c.Status, c.Detail = Warn, fmt.Sprintf("maxRenders 的值 %d 无效，同一时间最多运行CPU核数一半的PlantUML", cfg.MaxRenders)
+		c.Fix = fmt.Sprintf("在 %s 中把maxRenders改为正数或删除它", path)
+		return c
+	}
+	if cfg.Watermark != nil {
+		if err := cfg.Watermark.Validate(); err != nil {
+			c.Status, c.Detail = Warn, fmt.Sprintf("%v，导出时不能加水印", err)
+			c.Fix = fmt.Sprintf("在 %s 中修正或删除watermark", path)
+			return c
+		}
+	}
+	if err := config.ValidatePostProcessors(cfg.PostProcessors); err != nil {
+		c.Status, c.Detail = Warn, fmt.Sprintf("%v，导出时不做后处理", err)
+		c.Fix = fmt.Sprintf("在 %s 中修正或删除postProcessors", path)
+		return c
+	}
+	for _, t := range cfg.Daemon {
+		if info, err := os.Stat(t.Source); err != nil || !info.IsDir() {
+			c.Status, c.Detail = Warn, fmt.Sprintf("守护模式监控的目录 %s 不存在", t.Source)
+			c.Fix = fmt.Sprintf("在 %s 的daemon中修正或删除该目录", path)
+			return c
+		}
+		if t.Out == "" {
+			c.Status, c.Detail = Warn, fmt.Sprintf("守护模式监控的目录 %s 没有设置输出目录", t.Source)
+			c.Fix = fmt.Sprintf("在 %s 的daemon中为该目录设置out", path)
+			return c
+		}
+		if t.Upload != nil {
+			if err := t.Upload.Validate(); err != nil {
+				c.Status, c.Detail = Warn, fmt.Sprintf("守护模式监控的目录 %s 的%v", t.Source, err)
+				c.Fix = fmt.Sprintf("在 %s 的daemon中修正或删除该目录的upload", path)
+				return c
+			}
+		}
+	}
+	return c
+}
+
+// checkManaged 检查管理员设置能否解析，并列出其中的限制
+func checkManaged(path string) Check {
+	c := Check{Name: "管理员设置"}
+	managed, err := config.LoadManaged(path)
+	switch {
+	case err != nil:
+		c.Status, c.Detail = Fail, err.Error()
+		c.Fix = "请联系管理员修正该文件，修正前查看器无法启动"
+	case !managed.Active():
+		c.Detail = "没有管理员设置"
+	default:
+		var limits []string
+		if managed.Security != "" {
+			limits = append(limits, "安全配置 "+strings.ToUpper(managed.Security))
+		}
+		if len(managed.Backends) > 0 {
+			limits = append(limits, "只允许 "+strings.Join(managed.Backends, "、"))
+		}
+		if managed.DisableNetwork {
+			limits = append(limits, "禁止访问网络")
+		}
+		c.Detail = fmt.Sprintf("%s（%s）", path, strings.Join(limits, "，"))
+	}
+	return c
+}
+
+// checkProject 检查从dir开始向上找到的项目配置是否有效
+func checkProject(dir string) Check {
+	c := Check{Name: "项目配置"}
+	// FindProject从文件所在的目录开始查找，这里传入dir中的文件
+	project, err := config.FindProject(filepath.Join(dir, config.ProjectFile))
+	switch {
+	case err != nil:
+		c.Status, c.Detail = Fail, err.Error()
+		c.Fix = "按README中“渲染配置”一节修正项目配置，修正前匹配的文件无法渲染"
+	case project == nil:
+		c.Detail = "没有项目配置"
+	default:
+		c.Detail = fmt.Sprintf("%s（%d个渲染配置，%d条规则）", filepath.Join(project.Dir, config.ProjectFile), len(project.Profiles), len(project.Files))
+	}
+	return c
+}
+
+// checkWritableDir 检查能否在dir中创建文件，不能时把c设为失败
+func checkWritableDir(c Check, dir string) Check {
+	f, err := ioutil.TempFile(dir, ".plantumlviewer-doctor")
+	if err != nil {
+		c.Status, c.Detail = Fail, fmt.Sprintf("无法在 %s 中创建文件: %v", dir, err)
+		if c.Fix == "" {
+			c.Fix = fmt.Sprintf("修正 %s 的权限，确认当前用户可以写入", dir)
+		}
+		return c
+	}
+	f.Close()
+	os.Remove(f.Name())
+	c.Detail = dir
+	return c
+}
+
+// exists 判断文件是否存在
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// ownedByOther 判断文件是否属于其他用户
+func ownedByOther(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) != os.Getuid()
+}
+
+// firstLine 返回命令输出的第一行，没有输出时返回err
+func firstLine(out []byte, err error) string {
+	text := strings.TrimSpace(string(out))
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	if text == "" && err != nil {
+		return err.Error()
+	}
+	return text
+}
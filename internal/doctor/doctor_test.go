@@ -0,0 +1,246 @@
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/instance"
+	"plantumlmacviewer/internal/ipc"
+)
+
+// fakeTools 把查找和执行命令的函数替换为只认识tools中的命令，测试结束后恢复
+func fakeTools(t *testing.T, tools map[string]string, jar string) {
+	t.Helper()
+	oldLookPath, oldOutput, oldFindJar, oldVersion := lookPath, output, findJar, version
+	t.Cleanup(func() {
+		lookPath, output, findJar, version = oldLookPath, oldOutput, oldFindJar, oldVersion
+	})
+
+	lookPath = func(file string) (string, error) {
+		if _, ok := tools[file]; ok {
+			return "/usr/bin/" + file, nil
+		}
+		return "", exec.ErrNotFound
+	}
+	output = func(name string, args ...string) ([]byte, error) {
+		out, ok := tools[filepath.Base(name)]
+		if !ok || out == "" {
+			return nil, errors.New("exit status 1")
+		}
+		return []byte(out), nil
+	}
+	findJar = func() string { return jar }
+	version = func() (string, error) {
+		if _, ok := tools["java"]; !ok {
+			return "", errors.New("exec: \"java\": executable file not found in $PATH")
+		}
+		return "1.2024.3", nil
+	}
+}
+
+func TestCheckTools(t *testing.T) {
+	t.Setenv("GRAPHVIZ_DOT", "")
+	fakeTools(t, map[string]string{
+		"java": "openjdk version \"17.0.2\" 2022-01-18\nOpenJDK Runtime Environment",
+		"dot":  "dot - graphviz version 9.0.0 (20230911.1827)\n",
+	}, "/opt/plantuml/plantuml.jar")
+
+	if c := checkJava(); c.Status != Pass || c.Detail != `openjdk version "17.0.2" 2022-01-18` {
+		t.Errorf("checkJava = %+v", c)
+	}
+	if c := checkPlantUML(); c.Status != Pass || c.Detail != "/opt/plantuml/plantuml.jar（版本 1.2024.3）" {
+		t.Errorf("checkPlantUML = %+v", c)
+	}
+	if c := checkGraphviz(); c.Status != Pass || !strings.Contains(c.Detail, "graphviz version 9.0.0") {
+		t.Errorf("checkGraphviz = %+v", c)
+	}
+}
+
+func TestCheckMissingTools(t *testing.T) {
+	t.Setenv("GRAPHVIZ_DOT", "")
+	// macOS自带的java在没有安装JDK时存在但无法运行
+	fakeTools(t, map[string]string{"java": "", "plantuml": "plantuml"}, "")
+
+	if c := checkJava(); c.Status != Fail || c.Fix == "" {
+		t.Errorf("java无法运行时应失败并给出修复方法，得到 %+v", c)
+	}
+	if c := checkGraphviz(); c.Status != Warn || c.Fix == "" {
+		t.Errorf("没有Graphviz时应为警告，得到 %+v", c)
+	}
+
+	fakeTools(t, map[string]string{"plantuml": "plantuml"}, "")
+	if c := checkPlantUML(); c.Status != Fail || !strings.Contains(c.Detail, "命令行工具 /usr/bin/plantuml") {
+		t.Errorf("PlantUML无法运行时应失败，得到 %+v", c)
+	}
+	fakeTools(t, nil, "")
+	if c := checkPlantUML(); c.Status != Fail || !strings.Contains(c.Fix, "brew install plantuml") {
+		t.Errorf("找不到PlantUML时应失败并给出安装方法，得到 %+v", c)
+	}
+
+	t.Setenv("GRAPHVIZ_DOT", filepath.Join(t.TempDir(), "dot"))
+	if c := checkGraphviz(); c.Status != Warn || !strings.Contains(c.Detail, "GRAPHVIZ_DOT") {
+		t.Errorf("GRAPHVIZ_DOT指定的程序不存在时应为警告，得到 %+v", c)
+	}
+}
+
+func TestCheckLockAndSocket(t *testing.T) {
+	dir := t.TempDir()
+	lockFile := filepath.Join(dir, "app.lock")
+	addr := filepath.Join(dir, "app.sock")
+
+	if c := checkLock(lockFile); c.Status != Pass || c.Detail != "没有运行中的实例" {
+		t.Errorf("没有锁文件时 checkLock = %+v", c)
+	}
+	if c := checkSocket(addr, lockFile); c.Status != Pass {
+		t.Errorf("没有实例运行时 checkSocket = %+v", c)
+	}
+
+	lock, err := instance.Acquire(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release()
+	if c := checkLock(lockFile); c.Status != Pass || !strings.Contains(c.Detail, "进程ID") {
+		t.Errorf("有实例运行时 checkLock = %+v", c)
+	}
+	if c := checkSocket(addr, lockFile); c.Status != Fail || c.Fix == "" {
+		t.Errorf("实例在运行但没有IPC服务器时应失败，得到 %+v", c)
+	}
+
+	listener, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, ".config"))
+	if c := checkSocket(addr, lockFile); c.Status != Fail || !strings.Contains(c.Detail, "令牌") {
+		t.Errorf("无法读取令牌时应失败，得到 %+v", c)
+	}
+	if err := os.MkdirAll(filepath.Dir(ipc.TokenPath(addr)), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(ipc.TokenPath(addr), []byte("token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if c := checkSocket(addr, lockFile); c.Status != Pass {
+		t.Errorf("可以连接IPC服务器时 checkSocket = %+v", c)
+	}
+
+	lock.Release()
+	if err := ioutil.WriteFile(lockFile, []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c := checkLock(lockFile); c.Status != Warn || c.Fix != "rm "+lockFile {
+		t.Errorf("过时的锁文件应为警告，得到 %+v", c)
+	}
+}
+
+func TestCheckTempDir(t *testing.T) {
+	dir := t.TempDir()
+	if c := checkTempDir(dir); c.Status != Pass {
+		t.Errorf("checkTempDir = %+v", c)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("检查后不应留下文件，得到 %d 个", len(entries))
+	}
+	if c := checkTempDir(filepath.Join(dir, "missing")); c.Status != Fail || !strings.Contains(c.Fix, "TMPDIR") {
+		t.Errorf("目录不存在时应失败，得到 %+v", c)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if c := checkConfig(path); c.Status != Pass {
+		t.Errorf("配置文件不存在时 checkConfig = %+v", c)
+	}
+
+	for _, tt := range []struct {
+		data   string
+		status Status
+	}{
+		{`{"watchFiles": true}`, Pass},
+		{`{"watchFiles": tru`, Fail},
+		{`{"renderer": "pipe"}`, Pass},
+		{`{"renderer": "server"}`, Warn},
+		{`{"watermark": {"text": "DRAFT {date}"}}`, Pass},
+		{`{"watermark": {"text": "DRAFT", "opacity": 2}}`, Warn},
+		{`{"renderTimeout": 300}`, Pass},
+		{`{"renderTimeout": -1}`, Warn},
+		{`{"maxRenders": 2}`, Pass},
+		{`{"maxRenders": -1}`, Warn},
+		{`{"postProcessors": {"pngquant": {"command": ["pngquant", "-"], "formats": ["png"]}}}`, Pass},
+		{`{"postProcessors": {"svgo": {"command": []}}}`, Warn},
+		{fmt.Sprintf(`{"daemon": [{"source": %q, "out": "out"}]}`, filepath.Join(dir, "missing")), Warn},
+		{fmt.Sprintf(`{"daemon": [{"source": %q}]}`, dir), Warn},
+		{fmt.Sprintf(`{"daemon": [{"source": %q, "out": "out", "upload": {"url": "https://example.com"}}]}`, dir), Warn},
+		{fmt.Sprintf(`{"daemon": [{"source": %q, "out": "out", "upload": {"url": "s3://docs", "key": "{stem}.{ext}"}}]}`, dir), Pass},
+	} {
+		if err := ioutil.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if c := checkConfig(path); c.Status != tt.status {
+			t.Errorf("%s: checkConfig = %+v，状态应为%s", tt.data, c, tt.status)
+		}
+	}
+}
+
+func TestCheckManaged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "managed.json")
+	if c := checkManaged(path); c.Status != Pass || c.Detail != "没有管理员设置" {
+		t.Errorf("没有管理员设置时 checkManaged = %+v", c)
+	}
+	if err := ioutil.WriteFile(path, []byte(`{"backends": ["jar"], "disableNetwork": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c := checkManaged(path); c.Status != Pass || !strings.Contains(c.Detail, "只允许 jar，禁止访问网络") {
+		t.Errorf("checkManaged = %+v", c)
+	}
+	if err := ioutil.WriteFile(path, []byte(`{"security": "open"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c := checkManaged(path); c.Status != Fail {
+		t.Errorf("无效的管理员设置 checkManaged = %+v，状态应为%s", c, Fail)
+	}
+}
+
+func TestCheckProject(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "docs")
+	if c := checkProject(dir); c.Status != Pass || c.Detail != "没有项目配置" {
+		t.Errorf("没有项目配置时 checkProject = %+v", c)
+	}
+
+	project := `{"profiles": {"print": {"theme": "plain"}}, "files": [{"pattern": "*.puml", "profile": "missing"}]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, config.ProjectFile), []byte(project), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c := checkProject(sub); c.Status != Fail || !strings.Contains(c.Detail, "missing") {
+		t.Errorf("子目录应找到上级目录中无效的项目配置，得到 %+v", c)
+	}
+}
+
+func TestReport(t *testing.T) {
+	var buf strings.Builder
+	code := Report(&buf, []Check{
+		{Name: "Java", Detail: "openjdk 17"},
+		{Name: "Graphviz", Status: Warn, Detail: "找不到 dot 命令", Fix: "brew install graphviz"},
+	})
+	want := "通过 Java: openjdk 17\n警告 Graphviz: 找不到 dot 命令\n     修复: brew install graphviz\n共2项检查，0项失败，1项警告\n"
+	if code != 0 || buf.String() != want {
+		t.Errorf("Report = %d\n%s", code, buf.String())
+	}
+
+	if Report(&buf, []Check{{Name: "PlantUML", Status: Fail}}) != 1 {
+		t.Error("有失败的检查时应返回1")
+	}
+}
@@ -0,0 +1,138 @@
+// Package event 提供应用内的事件总线。查看器和标签页发布文件与渲染相关的事件，
+// 界面和其他集成（IPC等）通过订阅事件得到通知，不需要在各组件之间设置回调。
+package event
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Type 是事件类型
+type Type int
+
+const (
+	// FileOpened 在标签页中打开了文件
+	FileOpened Type = iota
+	// FileChanged 后台监控发现文件内容有变化，随后会重新渲染
+	FileChanged
+	// RenderStarted 开始渲染文件
+	RenderStarted
+	// RenderFinished 渲染成功并显示了新的图像
+	RenderFinished
+	// RenderFailed 渲染失败，Event.Err为失败原因
+	RenderFailed
+	// TabClosed 关闭了文件的标签页
+	TabClosed
+	// SyncConflict 同步文件夹中文件的冲突副本有变化，查看器的Conflicts返回当前的冲突副本
+	SyncConflict
+	// SourceRequested 按住Cmd点击了图像中的元素，Event.Line为定义该元素的源码行
+	SourceRequested
+)
+
+// String 返回事件类型的名称
+func (t Type) String() string {
+	switch t {
+	case FileOpened:
+		return "FileOpened"
+	case FileChanged:
+		return "FileChanged"
+	case RenderStarted:
+		return "RenderStarted"
+	case RenderFinished:
+		return "RenderFinished"
+	case RenderFailed:
+		return "RenderFailed"
+	case TabClosed:
+		return "TabClosed"
+	case SyncConflict:
+		return "SyncConflict"
+	case SourceRequested:
+		return "SourceRequested"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Event 是一次事件
+type Event struct {
+	Type Type
+	Path string // 相关文件的绝对路径
+	Err  error  // RenderFailed时的错误
+	Line int    // SourceRequested时的源码行，从1开始
+	Time time.Time
+}
+
+// Handler 处理事件。事件在发布者的goroutine中同步分发，
+// 查看器和标签页都在UI线程中发布事件，处理函数不应长时间阻塞
+type Handler func(Event)
+
+// Bus 是事件总线，可以在多个goroutine中使用。nil的*Bus可以发布事件，但不会分发给任何处理函数
+type Bus struct {
+	mu     sync.Mutex
+	nextID int
+	subs   []subscription // 按订阅顺序排列
+}
+
+// subscription 是一个订阅
+type subscription struct {
+	id      int
+	handler Handler
+	types   map[Type]bool // 为空时订阅所有类型
+}
+
+// NewBus 创建事件总线
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe 订阅指定类型的事件，不指定类型时订阅所有事件。返回取消订阅的函数，可以多次调用
+func (b *Bus) Subscribe(handler Handler, types ...Type) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := subscription{id: b.nextID, handler: handler}
+	b.nextID++
+	if len(types) > 0 {
+		sub.types = make(map[Type]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.subs = append(b.subs, sub)
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, s := range b.subs {
+			if s.id == sub.id {
+				b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish 按订阅顺序把事件分发给订阅了该类型的处理函数，e.Time为零时使用当前时间
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	// 复制订阅列表后再调用，处理函数中可以订阅或取消订阅
+	b.mu.Lock()
+	var handlers []Handler
+	for _, sub := range b.subs {
+		if sub.types == nil || sub.types[e.Type] {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(e)
+	}
+}
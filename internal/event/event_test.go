@@ -0,0 +1,73 @@
+package event
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPublishToSubscribers(t *testing.T) {
+	bus := NewBus()
+
+	var all, renders []Type
+	bus.Subscribe(func(e Event) { all = append(all, e.Type) })
+	bus.Subscribe(func(e Event) { renders = append(renders, e.Type) }, RenderFinished, RenderFailed)
+
+	bus.Publish(Event{Type: FileOpened, Path: "/a.puml"})
+	bus.Publish(Event{Type: RenderFinished, Path: "/a.puml"})
+	bus.Publish(Event{Type: RenderFailed, Path: "/a.puml", Err: errors.New("失败")})
+
+	if want := []Type{FileOpened, RenderFinished, RenderFailed}; !reflect.DeepEqual(all, want) {
+		t.Errorf("订阅所有事件时收到 %v，期望 %v", all, want)
+	}
+	if want := []Type{RenderFinished, RenderFailed}; !reflect.DeepEqual(renders, want) {
+		t.Errorf("只订阅渲染结果时收到 %v，期望 %v", renders, want)
+	}
+}
+
+func TestPublishSetsTime(t *testing.T) {
+	bus := NewBus()
+	var got Event
+	bus.Subscribe(func(e Event) { got = e })
+	bus.Publish(Event{Type: TabClosed, Path: "/a.puml"})
+	if got.Time.IsZero() {
+		t.Error("发布时应设置事件时间")
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	bus := NewBus()
+	var order []string
+	unsubscribeFirst := bus.Subscribe(func(Event) { order = append(order, "first") })
+	bus.Subscribe(func(Event) { order = append(order, "second") })
+
+	unsubscribeFirst()
+	unsubscribeFirst() // 多次调用应当安全
+	bus.Publish(Event{Type: FileChanged})
+
+	if want := []string{"second"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("取消订阅后收到 %v，期望 %v", order, want)
+	}
+}
+
+func TestSubscribeFromHandler(t *testing.T) {
+	bus := NewBus()
+	calls := 0
+	bus.Subscribe(func(Event) {
+		// 处理函数中订阅不应死锁，新的订阅从下一个事件开始生效
+		bus.Subscribe(func(Event) { calls++ })
+	})
+	bus.Publish(Event{Type: FileOpened})
+	if calls != 0 {
+		t.Errorf("新订阅不应收到当前事件，收到 %d 次", calls)
+	}
+	bus.Publish(Event{Type: FileOpened})
+	if calls != 1 {
+		t.Errorf("新订阅应收到下一个事件，收到 %d 次", calls)
+	}
+}
+
+func TestNilBusPublish(t *testing.T) {
+	var bus *Bus
+	bus.Publish(Event{Type: FileOpened})
+}
@@ -0,0 +1,114 @@
+// Package instance 通过带文件锁的锁文件保证同一时间只运行一个应用实例。
+package instance
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"syscall"
+)
+
+// Lock 是当前实例持有的锁文件
+type Lock struct {
+	path string
+	file *os.File
+}
+
+// IsRunning 检查是否已有实例持有path上的锁文件。
+// 锁文件存在但没有被锁定时，说明之前的程序没有正常退出，会删除这个过时的锁文件
+func IsRunning(path string) bool {
+	log.Println("检查应用程序是否已在运行...")
+
+	// 尝试打开锁文件
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 锁文件不存在，说明程序未运行
+			log.Println("锁文件不存在，程序未运行")
+			return false
+		}
+		// 其他错误，打印错误信息并假设程序未运行
+		log.Printf("打开锁文件出错: %v，假设程序未运行", err)
+		return false
+	}
+
+	// 尝试获取文件锁
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		// 无法获取锁，说明文件已被锁定，程序已在运行
+		log.Println("无法获取文件锁，程序已在运行")
+		file.Close()
+		return true
+	}
+
+	// 能够获取锁，但这意味着程序没有正确退出
+	// 解锁并删除这个过时的锁文件
+	log.Println("获取到锁，但之前程序可能未正常退出，删除旧锁文件")
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	file.Close()
+	os.Remove(path)
+	return false
+}
+
+// Locked 检查path上的锁文件是否被某个实例锁定，与IsRunning不同，不会删除过时的锁文件。
+// 锁文件不存在时返回false，无法打开锁文件（例如属于其他用户）时返回错误
+func Locked(path string) (bool, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("无法打开锁文件: %v", err)
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return true, nil
+	}
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	return false, nil
+}
+
+// Acquire 创建并锁定path上的锁文件，写入当前进程ID
+func Acquire(path string) (*Lock, error) {
+	log.Println("创建锁文件...")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("无法创建锁文件: %v", err)
+	}
+
+	// 获取排他锁
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("无法锁定文件: %v", err)
+	}
+
+	// 写入当前进程ID
+	_, err = fmt.Fprintf(file, "%d", os.Getpid())
+	if err != nil {
+		log.Printf("警告：无法写入进程ID：%v", err)
+	}
+
+	log.Println("锁文件创建成功，进程ID已写入")
+	return &Lock{path: path, file: file}, nil
+}
+
+// Release 解锁并删除锁文件，可以安全地多次调用，l为nil时什么也不做
+func (l *Lock) Release() {
+	log.Println("尝试移除锁文件...")
+	// 先检查文件句柄是否存在
+	if l == nil || l.file == nil {
+		log.Println("锁文件句柄为空，无需移除")
+		return
+	}
+
+	// 解锁文件
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	// 关闭文件
+	l.file.Close()
+	// 删除文件
+	os.Remove(l.path)
+	l.file = nil
+	log.Println("锁文件已成功移除")
+}
@@ -0,0 +1,95 @@
+package instance
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestIsRunningWithoutLockFile(t *testing.T) {
+	if IsRunning(filepath.Join(t.TempDir(), "app.lock")) {
+		t.Fatal("锁文件不存在时不应认为程序在运行")
+	}
+}
+
+func TestAcquireAndRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.lock")
+
+	lock, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("锁文件应包含进程ID，实际为 %q", data)
+	}
+
+	// flock锁属于打开的文件，同一进程中再次打开也无法获得锁
+	if !IsRunning(path) {
+		t.Fatal("持有锁时应认为程序在运行")
+	}
+	if _, err := Acquire(path); err == nil {
+		t.Fatal("已被锁定时再次Acquire应返回错误")
+	}
+
+	lock.Release()
+	lock.Release() // 多次调用应当安全
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Release后锁文件应被删除: %v", err)
+	}
+	if IsRunning(path) {
+		t.Fatal("Release后不应认为程序在运行")
+	}
+}
+
+func TestIsRunningRemovesStaleLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.lock")
+	if err := ioutil.WriteFile(path, []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if IsRunning(path) {
+		t.Fatal("没有被锁定的锁文件不应认为程序在运行")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("过时的锁文件应被删除: %v", err)
+	}
+}
+
+func TestReleaseNilLock(t *testing.T) {
+	var lock *Lock
+	lock.Release()
+}
+
+func TestLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.lock")
+	if locked, err := Locked(path); locked || err != nil {
+		t.Fatalf("锁文件不存在时应返回false，得到 %v，%v", locked, err)
+	}
+
+	lock, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if locked, err := Locked(path); !locked || err != nil {
+		t.Fatalf("持有锁时应返回true，得到 %v，%v", locked, err)
+	}
+	lock.Release()
+
+	// 过时的锁文件不会被删除
+	if err := ioutil.WriteFile(path, []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if locked, err := Locked(path); locked || err != nil {
+		t.Fatalf("没有被锁定的锁文件应返回false，得到 %v，%v", locked, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Locked不应删除锁文件: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package ipc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"plantumlmacviewer/config"
+)
+
+// 连接建立后客户端先发送一个帧携带令牌，令牌正确时才读取请求。令牌保存在只有当前用户能读取的配置目录中，
+// 因此其他本地用户即使能连接到套接字也无法让查看器打开文件
+
+// maxTokenFrameSize 是令牌帧的最大长度。令牌是64个十六进制字符，认证之前的数据不可信，
+// 不能让任何能连接到套接字的进程让服务器分配MaxFrameSize的内存
+const maxTokenFrameSize = 1 << 10
+
+// TokenPath 返回addr上服务器的令牌文件，位于用户配置目录下，每个套接字地址对应一个文件
+func TokenPath(addr string) string {
+	sum := sha256.Sum256([]byte(addr))
+	return filepath.Join(config.Dir(), fmt.Sprintf("ipc-%x.token", sum[:6]))
+}
+
+// newToken 生成随机令牌，写入addr对应的令牌文件，权限为0600
+func newToken(addr string) (string, error) {
+	var buf [32]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("无法生成IPC令牌: %v", err)
+	}
+	token := hex.EncodeToString(buf[:])
+
+	path := TokenPath(addr)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("无法创建IPC令牌目录: %v", err)
+	}
+	// 先写入临时文件再重命名，客户端不会读到写了一半的令牌
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".ipc-token-")
+	if err != nil {
+		return "", fmt.Errorf("无法写入IPC令牌: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("无法设置IPC令牌的权限: %v", err)
+	}
+	if _, err := tmp.WriteString(token); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("无法写入IPC令牌: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("无法写入IPC令牌: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("无法写入IPC令牌: %v", err)
+	}
+	return token, nil
+}
+
+// readToken 读取addr上服务器的令牌
+func readToken(addr string) (string, error) {
+	data, err := ioutil.ReadFile(TokenPath(addr))
+	if err != nil {
+		return "", fmt.Errorf("无法读取运行中的实例的令牌（实例是否由其他用户启动？）: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// validToken 以固定时间比较令牌，避免通过响应时间逐字节猜出令牌
+func validToken(got []byte, want string) bool {
+	return subtle.ConstantTimeCompare(got, []byte(want)) == 1
+}
+
+// 限流的默认值：持续每秒最多处理的请求数、允许的突发请求数和同时处理的连接数
+const (
+	requestsPerSecond = 10
+	requestBurst      = 30
+	maxConnections    = 8
+)
+
+// rateLimiter 是令牌桶限流器：桶中最多burst个令牌，每秒补充rate个，每个请求消耗一个
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter 创建装满令牌的限流器
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Allow 返回现在能否处理一个请求，能处理时消耗一个令牌
+func (l *rateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
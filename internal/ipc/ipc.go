@@ -0,0 +1,316 @@
+// Package ipc 实现运行中的实例与命令行之间传递文件列表和处理结果的消息格式。
+//
+// 每条消息是一个帧：4字节大端序的内容长度，后面紧跟内容，因此不受单次读取大小的限制。
+// 文件列表的内容是每行一个用Go语法转义后的路径，换行、非UTF-8字节等任意路径都能原样还原。
+// 路径后面可以用空格分隔附加打开该文件的选项，例如 "/a.puml" page=2 nofocus noselect。
+// 请求还可以在第一行以“@命令名”的形式携带命令，例如暂停监控文件变化；
+// 或者以“=”加转义后的名称携带虚拟文件，之后的全部内容为图表源码。
+package ipc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxFrameSize 单个帧内容的最大长度，防止异常数据导致分配过多内存
+const MaxFrameSize = 16 << 20
+
+// WriteFrame 写入一个帧
+func WriteFrame(w io.Writer, payload []byte) error {
+	if len(payload) > MaxFrameSize {
+		return fmt.Errorf("消息太大: %d 字节", len(payload))
+	}
+
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return fmt.Errorf("写入消息头失败: %v", err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		return fmt.Errorf("写入消息内容失败: %v", err)
+	}
+	return nil
+}
+
+// ReadFrame 读取一个帧，返回帧的内容
+func ReadFrame(r io.Reader) ([]byte, error) {
+	return readFrame(r, MaxFrameSize)
+}
+
+// readFrame 与ReadFrame相同，但内容超过limit字节时不分配内存，直接返回错误
+func readFrame(r io.Reader, limit uint32) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("读取消息头失败: %v", err)
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > limit {
+		return nil, fmt.Errorf("消息太大: %d 字节", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("读取消息内容失败: %v", err)
+	}
+	return payload, nil
+}
+
+// 运行中的实例支持的命令
+const (
+	// CommandPauseWatching 暂停所有文件的后台监控
+	CommandPauseWatching = "pause-watching"
+	// CommandResumeWatching 恢复后台监控，并重新渲染暂停期间有变化的文件
+	CommandResumeWatching = "resume-watching"
+	// CommandCloseAll 关闭所有标签页
+	CommandCloseAll = "close-all"
+	// CommandCloseOthers 关闭当前标签以外的所有标签页
+	CommandCloseOthers = "close-others"
+)
+
+// commandPrefix 命令行的前缀。转义后的路径总是以双引号开头，不会与命令混淆
+const commandPrefix = "@"
+
+// virtualPrefix 虚拟文件名称行的前缀
+const virtualPrefix = "="
+
+// OpenOptions 是打开单个文件时的选项，零值为默认行为：让窗口获得焦点并选中文件的标签
+type OpenOptions struct {
+	Page     int  // 显示第几页（从1开始），0表示不改变，新打开的文件显示第一页
+	NoFocus  bool // 不让窗口获得焦点，编辑器插件刷新后台的图表时不抢走编辑器的焦点
+	NoSelect bool // 不选中文件的标签，不打断正在查看的标签
+}
+
+// encode 把选项编码为附加在路径后面的文字，默认选项编码为空字符串
+func (o OpenOptions) encode() string {
+	var parts []string
+	if o.Page > 0 {
+		parts = append(parts, "page="+strconv.Itoa(o.Page))
+	}
+	if o.NoFocus {
+		parts = append(parts, "nofocus")
+	}
+	if o.NoSelect {
+		parts = append(parts, "noselect")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " " + strings.Join(parts, " ")
+}
+
+// parseOptions 解析路径后面的选项
+func parseOptions(fields []string) (OpenOptions, error) {
+	var o OpenOptions
+	for _, field := range fields {
+		switch {
+		case field == "nofocus":
+			o.NoFocus = true
+		case field == "noselect":
+			o.NoSelect = true
+		case strings.HasPrefix(field, "page="):
+			page, err := strconv.Atoi(strings.TrimPrefix(field, "page="))
+			if err != nil || page < 1 {
+				return OpenOptions{}, fmt.Errorf("无效的页码: %s", field)
+			}
+			o.Page = page
+		default:
+			return OpenOptions{}, fmt.Errorf("未知的选项: %s", field)
+		}
+	}
+	return o, nil
+}
+
+// VirtualFile 是直接提供内容的虚拟文件，编辑器不需要保存或写临时文件就能预览。
+// 同一个Name的虚拟文件显示在同一个标签中，由之后发来的内容而不是文件系统更新
+type VirtualFile struct {
+	Name    string // 编辑器中的文件路径，用作标签的标识和标题，不需要存在
+	Text    string
+	Options OpenOptions
+}
+
+// Request 是发给运行中实例的请求。Virtual不为nil时打开虚拟文件，Command不为空时执行命令，否则打开Paths中的文件
+type Request struct {
+	Command string
+	Paths   []string
+	Options []OpenOptions // 每个文件的选项，与Paths一一对应；为nil时都使用默认选项
+	Virtual *VirtualFile
+}
+
+// FileOptions 返回第i个文件的选项，没有指定时返回默认选项
+func (r Request) FileOptions(i int) OpenOptions {
+	if i < len(r.Options) {
+		return r.Options[i]
+	}
+	return OpenOptions{}
+}
+
+// WriteRequest 将请求编码后作为一个帧写入
+func WriteRequest(w io.Writer, req Request) error {
+	return WriteFrame(w, EncodeRequest(req))
+}
+
+// ReadRequest 读取一个帧并解码出请求
+func ReadRequest(r io.Reader) (Request, error) {
+	payload, err := ReadFrame(r)
+	if err != nil {
+		return Request{}, err
+	}
+	return DecodeRequest(payload)
+}
+
+// EncodeRequest 编码请求：有命令时第一行为命令，其余每行一个转义后的路径和它的选项；
+// 虚拟文件的第一行为名称和选项，其余为内容
+func EncodeRequest(req Request) []byte {
+	if v := req.Virtual; v != nil {
+		return []byte(virtualPrefix + strconv.Quote(v.Name) + v.Options.encode() + "\n" + v.Text)
+	}
+	files := encodeFiles(req.Paths, req.Options)
+	if req.Command == "" {
+		return files
+	}
+	return append([]byte(commandPrefix+req.Command+"\n"), files...)
+}
+
+// DecodeRequest 解码EncodeRequest生成的内容
+func DecodeRequest(data []byte) (Request, error) {
+	var req Request
+	if bytes.HasPrefix(data, []byte(virtualPrefix)) {
+		v, err := decodeVirtual(data[len(virtualPrefix):])
+		if err != nil {
+			return Request{}, err
+		}
+		req.Virtual = &v
+		return req, nil
+	}
+	if bytes.HasPrefix(data, []byte(commandPrefix)) {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		req.Command = string(line[len(commandPrefix):])
+		if req.Command == "" {
+			return Request{}, fmt.Errorf("命令名为空")
+		}
+	}
+
+	paths, options, err := decodeFiles(data)
+	if err != nil {
+		return Request{}, err
+	}
+	req.Paths = paths
+	req.Options = options
+	return req, nil
+}
+
+// decodeVirtual 解码虚拟文件：第一行为转义后的名称和选项，其余为内容
+func decodeVirtual(data []byte) (VirtualFile, error) {
+	header, text := string(data), ""
+	if i := strings.IndexByte(header, '\n'); i >= 0 {
+		header, text = header[:i], header[i+1:]
+	}
+	quoted, err := strconv.QuotedPrefix(header)
+	if err != nil {
+		return VirtualFile{}, fmt.Errorf("虚拟文件名称格式错误: %v", err)
+	}
+	name, err := strconv.Unquote(quoted)
+	if err != nil {
+		return VirtualFile{}, fmt.Errorf("虚拟文件名称格式错误: %v", err)
+	}
+	if name == "" {
+		return VirtualFile{}, fmt.Errorf("虚拟文件名称为空")
+	}
+	rest := header[len(quoted):]
+	if rest != "" && rest[0] != ' ' {
+		return VirtualFile{}, fmt.Errorf("虚拟文件名称格式错误: 名称后面缺少空格")
+	}
+	opts, err := parseOptions(strings.Fields(rest))
+	if err != nil {
+		return VirtualFile{}, fmt.Errorf("虚拟文件的选项错误: %v", err)
+	}
+	return VirtualFile{Name: name, Text: text, Options: opts}, nil
+}
+
+// WritePaths 将文件路径列表编码后作为一个帧写入
+func WritePaths(w io.Writer, paths []string) error {
+	return WriteRequest(w, Request{Paths: paths})
+}
+
+// ReadPaths 读取一个帧并解码出文件路径列表
+func ReadPaths(r io.Reader) ([]string, error) {
+	payload, err := ReadFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	return DecodePaths(payload)
+}
+
+// EncodePaths 将文件路径列表编码为每行一个转义后的路径
+func EncodePaths(paths []string) []byte {
+	return encodeFiles(paths, nil)
+}
+
+// DecodePaths 解码EncodePaths生成的内容，忽略路径后面的选项
+func DecodePaths(data []byte) ([]string, error) {
+	paths, _, err := decodeFiles(data)
+	return paths, err
+}
+
+// encodeFiles 将文件路径列表编码为每行一个转义后的路径，路径后面附加不是默认值的选项
+func encodeFiles(paths []string, options []OpenOptions) []byte {
+	var buf bytes.Buffer
+	for i, path := range paths {
+		buf.WriteString(strconv.Quote(path))
+		if i < len(options) {
+			buf.WriteString(options[i].encode())
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// decodeFiles 解码encodeFiles生成的内容。所有文件都使用默认选项时返回的选项为nil
+func decodeFiles(data []byte) ([]string, []OpenOptions, error) {
+	var paths []string
+	var options []OpenOptions
+	hasOptions := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 4096), MaxFrameSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		quoted, err := strconv.QuotedPrefix(text)
+		if err != nil {
+			return nil, nil, fmt.Errorf("第%d个路径格式错误: %v", line, err)
+		}
+		path, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, nil, fmt.Errorf("第%d个路径格式错误: %v", line, err)
+		}
+
+		rest := text[len(quoted):]
+		if rest != "" && rest[0] != ' ' {
+			return nil, nil, fmt.Errorf("第%d个路径格式错误: 路径后面缺少空格", line)
+		}
+		opts, err := parseOptions(strings.Fields(rest))
+		if err != nil {
+			return nil, nil, fmt.Errorf("第%d个文件的选项错误: %v", line, err)
+		}
+		hasOptions = hasOptions || opts != OpenOptions{}
+		paths = append(paths, path)
+		options = append(options, opts)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("解析路径列表失败: %v", err)
+	}
+	if !hasOptions {
+		options = nil
+	}
+	return paths, options, nil
+}
@@ -0,0 +1,183 @@
+package ipc
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testPaths 生成包含各种特殊字符的路径，总长度远超过4KB
+func testPaths(n int) []string {
+	specials := []string{
+		"/tmp/普通的中文路径/图表.puml",
+		"/tmp/带\n换行的/文件.puml",
+		"/tmp/回车\r和制表符\t.puml",
+		"/tmp/引号\"和反斜杠\\.puml",
+		"/tmp/emoji😀/🧪.puml",
+		"/tmp/非UTF-8\xff\xfe字节.puml",
+		"/tmp/NUL\x00字节.puml",
+		"/tmp/空格 和 ' 单引号.puml",
+		"",
+	}
+	paths := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		paths = append(paths, fmt.Sprintf("%s-%d-%s", specials[i%len(specials)], i, strings.Repeat("长", i%50)))
+	}
+	return paths
+}
+
+func TestPathsRoundTrip(t *testing.T) {
+	paths := testPaths(500)
+	if size := len(EncodePaths(paths)); size <= 4096 {
+		t.Fatalf("测试数据应超过4KB，实际 %d 字节", size)
+	}
+
+	var buf bytes.Buffer
+	if err := WritePaths(&buf, paths); err != nil {
+		t.Fatalf("WritePaths: %v", err)
+	}
+	got, err := ReadPaths(&buf)
+	if err != nil {
+		t.Fatalf("ReadPaths: %v", err)
+	}
+	if !reflect.DeepEqual(got, paths) {
+		t.Fatalf("路径往返后不一致: 得到 %d 个，期望 %d 个", len(got), len(paths))
+	}
+}
+
+func TestPathsRoundTripOverConnection(t *testing.T) {
+	paths := testPaths(300)
+	client, server := net.Pipe()
+	defer server.Close()
+
+	// net.Pipe没有缓冲，写入和读取必须并发进行，可以覆盖分多次读取的情况
+	go func() {
+		defer client.Close()
+		if err := WritePaths(client, paths); err != nil {
+			t.Errorf("WritePaths: %v", err)
+		}
+	}()
+
+	got, err := ReadPaths(server)
+	if err != nil {
+		t.Fatalf("ReadPaths: %v", err)
+	}
+	if !reflect.DeepEqual(got, paths) {
+		t.Fatalf("路径往返后不一致: 得到 %d 个，期望 %d 个", len(got), len(paths))
+	}
+}
+
+func TestEmptyPathList(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePaths(&buf, nil); err != nil {
+		t.Fatalf("WritePaths: %v", err)
+	}
+	got, err := ReadPaths(&buf)
+	if err != nil {
+		t.Fatalf("ReadPaths: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("期望空列表，得到 %q", got)
+	}
+}
+
+func TestReadFrameTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, []byte("完整的内容")); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	truncated := buf.Bytes()[:buf.Len()-3]
+	if _, err := ReadFrame(bytes.NewReader(truncated)); err == nil {
+		t.Fatal("截断的帧应返回错误")
+	}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	header := []byte{0xff, 0xff, 0xff, 0xff}
+	if _, err := ReadFrame(bytes.NewReader(header)); err == nil {
+		t.Fatal("超过MaxFrameSize的帧应返回错误")
+	}
+}
+
+func TestDecodePathsRejectsUnescaped(t *testing.T) {
+	if _, err := DecodePaths([]byte("/tmp/没有转义.puml\n")); err == nil {
+		t.Fatal("未转义的路径应返回错误")
+	}
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	requests := []Request{
+		{Paths: []string{"/a.puml", "@b.puml"}},
+		{Command: CommandPauseWatching},
+		{Command: CommandResumeWatching, Paths: []string{"/a.puml"}},
+		{Paths: []string{"/a b.puml", "/c.puml"}, Options: []OpenOptions{{Page: 3, NoFocus: true, NoSelect: true}, {}}},
+	}
+	for _, want := range requests {
+		var buf bytes.Buffer
+		if err := WriteRequest(&buf, want); err != nil {
+			t.Fatalf("WriteRequest: %v", err)
+		}
+		got, err := ReadRequest(&buf)
+		if err != nil {
+			t.Fatalf("ReadRequest: %v", err)
+		}
+		if got.Command != want.Command || !reflect.DeepEqual(got.Paths, want.Paths) || !reflect.DeepEqual(got.Options, want.Options) {
+			t.Errorf("得到 %+v，期望 %+v", got, want)
+		}
+	}
+}
+
+func TestDecodeRequestRejectsBadOptions(t *testing.T) {
+	for _, data := range []string{
+		`"/a.puml" page=0` + "\n",
+		`"/a.puml" page=x` + "\n",
+		`"/a.puml" focus` + "\n",
+		`"/a.puml"nofocus` + "\n",
+	} {
+		if _, err := DecodeRequest([]byte(data)); err == nil {
+			t.Errorf("DecodeRequest(%q) 应返回错误", data)
+		}
+	}
+
+	// 旧版本的请求没有选项
+	req, err := DecodeRequest([]byte(`"/a.puml"` + "\n"))
+	if err != nil || req.Options != nil || req.FileOptions(0) != (OpenOptions{}) {
+		t.Errorf("没有选项时应使用默认选项，得到 %+v, %v", req, err)
+	}
+}
+
+func TestDecodeRequestEmptyCommand(t *testing.T) {
+	if _, err := DecodeRequest([]byte("@\n")); err == nil {
+		t.Fatal("命令名为空时应返回错误")
+	}
+}
+
+func TestVirtualFileRoundTrip(t *testing.T) {
+	files := []VirtualFile{
+		{Name: "/a b.puml", Text: "@startuml\nA -> B\n@enduml\n"},
+		{Name: "/new\nline.puml", Text: "", Options: OpenOptions{Page: 2, NoFocus: true}},
+	}
+	for _, want := range files {
+		want := want
+		var buf bytes.Buffer
+		if err := WriteRequest(&buf, Request{Virtual: &want}); err != nil {
+			t.Fatalf("WriteRequest: %v", err)
+		}
+		got, err := ReadRequest(&buf)
+		if err != nil {
+			t.Fatalf("ReadRequest: %v", err)
+		}
+		if got.Virtual == nil || *got.Virtual != want || got.Command != "" || got.Paths != nil {
+			t.Errorf("得到 %+v，期望虚拟文件 %+v", got, want)
+		}
+	}
+
+	for _, data := range []string{"=\n", `=""` + "\n", `="/a.puml" page=x` + "\n"} {
+		if _, err := DecodeRequest([]byte(data)); err == nil {
+			t.Errorf("DecodeRequest(%q) 应返回错误", data)
+		}
+	}
+}
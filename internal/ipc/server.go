@@ -0,0 +1,333 @@
+package ipc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+// Result 是处理单个文件的结果，编辑器插件和脚本可以据此向用户显示失败原因
+type Result struct {
+	File     string  `json:"file"`
+	OK       bool    `json:"ok"`
+	Error    string  `json:"error,omitempty"`
+	Line     int     `json:"line,omitempty"`     // PlantUML报告的出错行号，无法确定时省略
+	Output   string  `json:"output,omitempty"`   // 导出时生成的文件
+	UpToDate bool    `json:"upToDate,omitempty"` // 批量转换时输出已是最新，没有重新渲染
+	Duration float64 `json:"duration,omitempty"` // 批量导出和检查时处理该文件用的秒数
+}
+
+// Response 是处理结果的JSON格式，IPC响应和命令行输出都使用它
+type Response struct {
+	Results []Result `json:"results"`
+}
+
+// Handler 处理收到的文件列表，按顺序返回每个文件的结果。options与paths一一对应，没有指定选项的文件为默认选项
+type Handler func(paths []string, options []OpenOptions) []Result
+
+// 读写超时
+const (
+	readTimeout  = 5 * time.Second
+	writeTimeout = 2 * time.Second
+)
+
+// errorPrefix 是服务器无法处理请求时返回的错误信息的前缀，正常的处理结果是JSON，不会以它开头
+const errorPrefix = "ERROR: "
+
+// Server 通过UNIX套接字接收其他进程发来的文件列表
+type Server struct {
+	addr     string
+	handler  Handler
+	commands map[string]func() error  // 命令名对应的处理函数
+	virtual  func(VirtualFile) Result // 处理虚拟文件，没有设置时不支持虚拟文件
+	listener net.Listener
+	token    string        // 客户端需要先发送的令牌
+	limiter  *rateLimiter  // 限制请求的频率，包括令牌错误的请求
+	slots    chan struct{} // 限制同时处理的连接数
+}
+
+// listenMu 保证修改umask期间不会同时创建另一个套接字，否则恢复的umask可能不对
+var listenMu sync.Mutex
+
+// Listen 在addr上创建只有当前用户能连接的UNIX套接字，收到的文件列表交给handler处理。
+// 同时生成新的令牌写入TokenPath(addr)，之前的客户端读到的令牌失效
+func Listen(addr string, handler Handler) (*Server, error) {
+	token, err := newToken(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 确保套接字文件不存在
+	os.Remove(addr)
+
+	// 套接字在创建时就只有当前用户能连接，不留下之后修改权限之前的空档
+	listenMu.Lock()
+	umask := syscall.Umask(0077)
+	listener, err := net.Listen("unix", addr)
+	syscall.Umask(umask)
+	listenMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("无法启动IPC服务器: %v", err)
+	}
+	if err := os.Chmod(addr, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("无法设置IPC套接字的权限: %v", err)
+	}
+
+	log.Printf("IPC服务器已启动，监听地址: %s", addr)
+	return &Server{
+		addr:     addr,
+		handler:  handler,
+		commands: make(map[string]func() error),
+		listener: listener,
+		token:    token,
+		limiter:  newRateLimiter(requestsPerSecond, requestBurst),
+		slots:    make(chan struct{}, maxConnections),
+	}, nil
+}
+
+// HandleCommand 注册命令的处理函数，需要在Serve之前调用
+func (s *Server) HandleCommand(name string, fn func() error) {
+	s.commands[name] = fn
+}
+
+// HandleVirtual 设置虚拟文件的处理函数，需要在Serve之前调用
+func (s *Server) HandleVirtual(fn func(VirtualFile) Result) {
+	s.virtual = fn
+}
+
+// Serve 接受并处理连接，直到调用Close为止
+func (s *Server) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Printf("接受连接出错：%v", err)
+			continue
+		}
+
+		logging.Debugf("收到新的IPC连接")
+		// 超过同时处理的连接数或请求太频繁时直接拒绝，不让大量连接占满查看器
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			go reject(conn, "正在处理的请求太多，请稍后再试")
+			continue
+		}
+		if !s.limiter.Allow() {
+			<-s.slots
+			go reject(conn, "请求太频繁，请稍后再试")
+			continue
+		}
+		go func() {
+			defer func() { <-s.slots }()
+			s.handle(conn)
+		}()
+	}
+}
+
+// Close 关闭服务器并删除套接字文件和令牌文件
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	os.Remove(s.addr)
+	os.Remove(TokenPath(s.addr))
+	return err
+}
+
+// reject 向客户端返回拒绝的原因并关闭连接
+func reject(conn net.Conn, reason string) {
+	defer conn.Close()
+	log.Printf("拒绝IPC连接: %s", reason)
+	if err := conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		log.Printf("设置写入超时失败: %v", err)
+	}
+	WriteFrame(conn, []byte(errorPrefix+reason))
+}
+
+// handle 处理一个连接：读取文件列表，交给handler处理，然后返回每个文件的结果
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	logging.Debugf("处理IPC连接...")
+
+	// 使用带超时的读取
+	if err := conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		log.Printf("设置读取超时失败: %v", err)
+	}
+
+	// 第一个帧是令牌，不正确时不读取请求
+	token, err := readFrame(conn, maxTokenFrameSize)
+	if err != nil {
+		log.Printf("读取令牌出错：%v", err)
+		WriteFrame(conn, []byte(errorPrefix+"读取数据失败"))
+		return
+	}
+	if !validToken(token, s.token) {
+		log.Printf("拒绝IPC连接: 令牌不正确")
+		WriteFrame(conn, []byte(errorPrefix+"认证失败"))
+		return
+	}
+
+	// 读取请求，使用带长度的帧传输，路径经过转义，可以包含换行等任意字符
+	req, err := ReadRequest(conn)
+	if err != nil {
+		log.Printf("读取数据出错：%v", err)
+		// 尝试发送错误信息
+		WriteFrame(conn, []byte(errorPrefix+"读取数据失败"))
+		return
+	}
+
+	var results []Result
+	if req.Virtual != nil {
+		log.Printf("收到虚拟文件: %s（%d 字节）", logging.Path(req.Virtual.Name), len(req.Virtual.Text))
+		if s.virtual == nil {
+			results = []Result{{File: req.Virtual.Name, Error: "不支持虚拟文件"}}
+		} else {
+			results = []Result{s.virtual(*req.Virtual)}
+		}
+	} else if req.Command != "" {
+		log.Printf("收到命令: %s", req.Command)
+		results = []Result{s.runCommand(req.Command)}
+	} else {
+		log.Printf("解析文件列表: %q", logging.Paths(req.Paths))
+		options := make([]OpenOptions, len(req.Paths))
+		for i := range options {
+			options[i] = req.FileOptions(i)
+		}
+		results = s.handler(req.Paths, options)
+	}
+
+	// 发送每个文件的处理结果
+	if err := conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		log.Printf("设置写入超时失败: %v", err)
+	}
+
+	var response bytes.Buffer
+	if err := WriteResults(&response, results); err != nil {
+		log.Printf("编码处理结果失败: %v", err)
+		return
+	}
+	if err := WriteFrame(conn, response.Bytes()); err != nil {
+		log.Printf("发送处理结果失败: %v", err)
+	}
+}
+
+// runCommand 执行命令并返回结果
+func (s *Server) runCommand(name string) Result {
+	fn, ok := s.commands[name]
+	if !ok {
+		return Result{Error: fmt.Sprintf("不支持的命令: %s", name)}
+	}
+	if err := fn(); err != nil {
+		return Result{Error: err.Error()}
+	}
+	return Result{OK: true}
+}
+
+// Send 连接到addr上的服务器，发送文件列表并等待每个文件的处理结果。
+// options与paths一一对应，为nil时都使用默认选项；timeout是等待服务器处理完所有文件的最长时间
+func Send(addr string, paths []string, options []OpenOptions, timeout time.Duration) ([]Result, error) {
+	log.Printf("发送文件列表到运行中的实例: %q", logging.Paths(paths))
+	return send(addr, Request{Paths: paths, Options: options}, timeout)
+}
+
+// SendCommand 连接到addr上的服务器，执行命令并等待结果
+func SendCommand(addr, command string, timeout time.Duration) (Result, error) {
+	log.Printf("发送命令到运行中的实例: %s", command)
+	results, err := send(addr, Request{Command: command}, timeout)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(results) != 1 {
+		return Result{}, fmt.Errorf("运行中的实例返回了 %d 个结果", len(results))
+	}
+	return results[0], nil
+}
+
+// SendVirtual 连接到addr上的服务器，发送虚拟文件并等待处理结果
+func SendVirtual(addr string, file VirtualFile, timeout time.Duration) (Result, error) {
+	log.Printf("发送虚拟文件到运行中的实例: %s", logging.Path(file.Name))
+	results, err := send(addr, Request{Virtual: &file}, timeout)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(results) != 1 {
+		return Result{}, fmt.Errorf("运行中的实例返回了 %d 个结果", len(results))
+	}
+	return results[0], nil
+}
+
+// send 先发送令牌，再发送请求并等待处理结果
+func send(addr string, req Request, timeout time.Duration) ([]Result, error) {
+	// 连接到IPC服务器，添加超时
+	conn, err := net.DialTimeout("unix", addr, 3*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("无法连接到运行中的实例: %v", err)
+	}
+	defer conn.Close()
+
+	token, err := readToken(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 设置写入超时
+	if err := conn.SetWriteDeadline(time.Now().Add(3 * time.Second)); err != nil {
+		log.Printf("设置写入超时失败: %v", err)
+	}
+
+	// 发送令牌和请求。服务器拒绝连接时可能不读取它们就关闭连接，写入失败时仍然读取拒绝的原因
+	if err := WriteFrame(conn, []byte(token)); err == nil {
+		err = WriteRequest(conn, req)
+	}
+	if err != nil {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if data, readErr := ReadFrame(conn); readErr == nil && bytes.HasPrefix(data, []byte(errorPrefix)) {
+			return nil, fmt.Errorf("运行中的实例拒绝了请求: %s", bytes.TrimPrefix(data, []byte(errorPrefix)))
+		}
+		return nil, fmt.Errorf("发送请求失败: %v", err)
+	}
+
+	log.Println("请求已发送")
+
+	// 设置读取超时
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		log.Printf("设置读取超时失败: %v", err)
+	}
+
+	// 等待处理结果
+	data, err := ReadFrame(conn)
+	if err != nil {
+		return nil, fmt.Errorf("读取处理结果失败: %v", err)
+	}
+
+	// 结果中包含文件路径和错误输出，只在调试级别记录
+	logging.Debugf("收到处理结果: %s", string(data))
+
+	if bytes.HasPrefix(data, []byte(errorPrefix)) {
+		return nil, fmt.Errorf("运行中的实例拒绝了请求: %s", bytes.TrimPrefix(data, []byte(errorPrefix)))
+	}
+
+	var response Response
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("无法解析运行中的实例返回的结果: %s", strings.TrimSpace(string(data)))
+	}
+	return response.Results, nil
+}
+
+// WriteResults 以JSON格式输出结果
+func WriteResults(w io.Writer, results []Result) error {
+	return json.NewEncoder(w).Encode(Response{Results: results})
+}
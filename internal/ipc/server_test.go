@@ -0,0 +1,372 @@
+package ipc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolateConfig 让令牌文件写入临时的配置目录，而不是用户真正的配置目录
+func isolateConfig(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+}
+
+// startServer 在临时目录中启动服务器，测试结束时关闭
+func startServer(t *testing.T, handler Handler) string {
+	t.Helper()
+	isolateConfig(t)
+	// UNIX套接字路径长度有限，不使用可能很长的t.TempDir
+	dir, err := ioutil.TempDir("", "ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := filepath.Join(dir, "test.sock")
+
+	server, err := Listen(addr, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	t.Cleanup(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+	return addr
+}
+
+func TestSendReceivesResultsInOrder(t *testing.T) {
+	received := make(chan []string, 1)
+	addr := startServer(t, func(paths []string, options []OpenOptions) []Result {
+		if len(options) != len(paths) {
+			t.Errorf("选项应与路径一一对应，得到 %d 个选项", len(options))
+		}
+		received <- paths
+		results := make([]Result, len(paths))
+		for i, path := range paths {
+			if i%2 == 0 {
+				results[i] = Result{File: path, OK: true}
+			} else {
+				results[i] = Result{File: path, Error: "渲染失败", Line: i}
+			}
+		}
+		return results
+	})
+
+	paths := testPaths(300)
+	results, err := Send(addr, paths, nil, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := <-received; !reflect.DeepEqual(got, paths) {
+		t.Fatalf("服务器收到的路径不一致: 得到 %d 个，期望 %d 个", len(got), len(paths))
+	}
+	if len(results) != len(paths) {
+		t.Fatalf("期望 %d 个结果，得到 %d 个", len(paths), len(results))
+	}
+	for i, r := range results {
+		if r.OK != (i%2 == 0) {
+			t.Fatalf("第%d个结果的OK不正确: %+v", i, r)
+		}
+		if !r.OK && r.Line != i {
+			t.Fatalf("第%d个结果的行号不正确: %+v", i, r)
+		}
+	}
+}
+
+func TestSendPassesOptions(t *testing.T) {
+	received := make(chan []OpenOptions, 1)
+	addr := startServer(t, func(paths []string, options []OpenOptions) []Result {
+		received <- options
+		results := make([]Result, len(paths))
+		for i, path := range paths {
+			results[i] = Result{File: path, OK: true}
+		}
+		return results
+	})
+
+	paths := []string{"/tmp/a.puml", "/tmp/b.puml", "/tmp/c.puml"}
+	options := []OpenOptions{{Page: 2, NoFocus: true}, {}}
+	if _, err := Send(addr, paths, options, 5*time.Second); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	// 没有指定选项的文件使用默认选项
+	want := []OpenOptions{{Page: 2, NoFocus: true}, {}, {}}
+	if got := <-received; !reflect.DeepEqual(got, want) {
+		t.Errorf("服务器收到的选项为 %+v，期望 %+v", got, want)
+	}
+}
+
+func TestSendWithoutServer(t *testing.T) {
+	addr := filepath.Join(os.TempDir(), fmt.Sprintf("ipc-missing-%d.sock", os.Getpid()))
+	if _, err := Send(addr, []string{"/tmp/a.puml"}, nil, time.Second); err == nil {
+		t.Fatal("没有服务器时应返回错误")
+	}
+}
+
+func TestCloseStopsServe(t *testing.T) {
+	isolateConfig(t)
+	dir, err := ioutil.TempDir("", "ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server, err := Listen(filepath.Join(dir, "test.sock"), func([]string, []OpenOptions) []Result { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		server.Serve()
+		close(done)
+	}()
+
+	server.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close后Serve没有返回")
+	}
+}
+
+func TestSendCommand(t *testing.T) {
+	isolateConfig(t)
+	dir, err := ioutil.TempDir("", "ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "test.sock")
+
+	server, err := Listen(addr, func([]string, []OpenOptions) []Result {
+		t.Error("命令不应交给打开文件的处理函数")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paused := make(chan struct{}, 1)
+	server.HandleCommand(CommandPauseWatching, func() error {
+		paused <- struct{}{}
+		return nil
+	})
+	server.HandleCommand(CommandResumeWatching, func() error {
+		return fmt.Errorf("窗口尚未打开")
+	})
+	go server.Serve()
+	defer server.Close()
+
+	result, err := SendCommand(addr, CommandPauseWatching, 5*time.Second)
+	if err != nil || !result.OK {
+		t.Fatalf("SendCommand: %+v, %v", result, err)
+	}
+	select {
+	case <-paused:
+	default:
+		t.Fatal("命令的处理函数没有被调用")
+	}
+
+	result, err = SendCommand(addr, CommandResumeWatching, 5*time.Second)
+	if err != nil || result.OK || result.Error != "窗口尚未打开" {
+		t.Fatalf("处理函数出错时应返回错误结果，得到 %+v, %v", result, err)
+	}
+
+	result, err = SendCommand(addr, "unknown", 5*time.Second)
+	if err != nil || result.OK || !strings.Contains(result.Error, "不支持的命令") {
+		t.Fatalf("未知命令应返回错误结果，得到 %+v, %v", result, err)
+	}
+}
+
+func TestSendVirtual(t *testing.T) {
+	received := make(chan VirtualFile, 1)
+	addr := startServer(t, func([]string, []OpenOptions) []Result {
+		t.Error("虚拟文件不应交给打开文件的处理函数")
+		return nil
+	})
+
+	// 没有设置处理函数时不支持虚拟文件
+	result, err := SendVirtual(addr, VirtualFile{Name: "/a.puml"}, 5*time.Second)
+	if err != nil || result.OK || result.Error == "" {
+		t.Fatalf("不支持虚拟文件时应返回错误结果，得到 %+v, %v", result, err)
+	}
+
+	dir, err := ioutil.TempDir("", "ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr = filepath.Join(dir, "test.sock")
+	server, err := Listen(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.HandleVirtual(func(file VirtualFile) Result {
+		received <- file
+		return Result{File: file.Name, OK: true}
+	})
+	go server.Serve()
+	defer server.Close()
+
+	want := VirtualFile{Name: "/a.puml", Text: "@startuml\n@enduml\n", Options: OpenOptions{NoSelect: true}}
+	result, err = SendVirtual(addr, want, 5*time.Second)
+	if err != nil || !result.OK || result.File != want.Name {
+		t.Fatalf("SendVirtual: %+v, %v", result, err)
+	}
+	if got := <-received; got != want {
+		t.Errorf("服务器收到 %+v，期望 %+v", got, want)
+	}
+}
+
+// rawRequest 直接连接到服务器，依次发送frames中的帧，返回服务器的响应
+func rawRequest(t *testing.T, addr string, frames ...[]byte) string {
+	t.Helper()
+	conn, err := net.Dial("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	for _, frame := range frames {
+		if err := WriteFrame(conn, frame); err != nil {
+			break // 服务器可能已经拒绝了连接
+		}
+	}
+	data, err := ReadFrame(conn)
+	if err != nil {
+		t.Fatalf("读取响应失败: %v", err)
+	}
+	return string(data)
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	addr := startServer(t, func([]string, []OpenOptions) []Result {
+		t.Error("没有正确的令牌时不应处理请求")
+		return nil
+	})
+
+	if info, err := os.Stat(addr); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("套接字的权限应为0600，得到 %v, %v", info.Mode().Perm(), err)
+	}
+	if info, err := os.Stat(TokenPath(addr)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("令牌文件的权限应为0600，得到 %v, %v", info.Mode().Perm(), err)
+	}
+
+	request := EncodeRequest(Request{Paths: []string{"/etc/passwd"}})
+	// 旧的客户端直接发送请求，请求被当作令牌
+	if got := rawRequest(t, addr, request); got != errorPrefix+"认证失败" {
+		t.Errorf("没有令牌时应认证失败，得到 %q", got)
+	}
+	if got := rawRequest(t, addr, []byte("0123456789abcdef"), request); got != errorPrefix+"认证失败" {
+		t.Errorf("令牌错误时应认证失败，得到 %q", got)
+	}
+
+	// 认证之前不接受大的帧
+	if got := rawRequest(t, addr, make([]byte, maxTokenFrameSize+1)); got != errorPrefix+"读取数据失败" {
+		t.Errorf("令牌帧太大时应拒绝，得到 %q", got)
+	}
+
+	// 令牌文件被替换（例如另一个实例重新启动）后客户端的令牌不正确
+	if err := ioutil.WriteFile(TokenPath(addr), []byte("stale"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Send(addr, []string{"/tmp/a.puml"}, nil, 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "认证失败") {
+		t.Errorf("令牌错误时Send应返回认证失败，得到 %v", err)
+	}
+
+	os.Remove(TokenPath(addr))
+	if _, err := Send(addr, []string{"/tmp/a.puml"}, nil, 5*time.Second); err == nil {
+		t.Error("读取不到令牌时Send应返回错误")
+	}
+}
+
+func TestServerRateLimit(t *testing.T) {
+	isolateConfig(t)
+	dir, err := ioutil.TempDir("", "ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "test.sock")
+
+	server, err := Listen(addr, func(paths []string, _ []OpenOptions) []Result {
+		return []Result{{File: paths[0], OK: true}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不补充令牌，只允许两个请求
+	server.limiter = newRateLimiter(0, 2)
+	go server.Serve()
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := Send(addr, []string{"/tmp/a.puml"}, nil, 5*time.Second); err != nil {
+			t.Fatalf("第%d个请求: %v", i+1, err)
+		}
+	}
+	_, err = Send(addr, []string{"/tmp/a.puml"}, nil, 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "请求太频繁") {
+		t.Errorf("超过频率限制时应拒绝请求，得到 %v", err)
+	}
+	// 在验证令牌之前限流，令牌错误的连接也不能用来消耗查看器的资源
+	if got := rawRequest(t, addr, []byte("wrong")); !strings.Contains(got, "请求太频繁") {
+		t.Errorf("超过频率限制时应在验证令牌前拒绝连接，得到 %q", got)
+	}
+}
+
+func TestServerLimitsConnections(t *testing.T) {
+	isolateConfig(t)
+	dir, err := ioutil.TempDir("", "ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "test.sock")
+
+	server, err := Listen(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.slots = make(chan struct{}, 1)
+	go server.Serve()
+	defer server.Close()
+
+	// 第一个连接不发送任何内容，一直占用唯一的处理位置
+	idle, err := net.Dial("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(server.slots) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := rawRequest(t, addr, []byte("token")); !strings.Contains(got, "正在处理的请求太多") {
+		t.Errorf("超过同时处理的连接数时应拒绝连接，得到 %q", got)
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	l := newRateLimiter(1000, 1)
+	if !l.Allow() {
+		t.Fatal("新的限流器应允许请求")
+	}
+	if l.Allow() {
+		t.Fatal("令牌用完后应拒绝请求")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if !l.Allow() {
+		t.Fatal("经过一段时间后应补充令牌")
+	}
+}
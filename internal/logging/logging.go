@@ -0,0 +1,161 @@
+// Package logging 提供不泄露隐私的日志：普通级别下文件路径只记录哈希，按键、IPC请求内容等细节只在调试级别记录，
+// 频繁的日志限制频率，日志文件只有当前用户可读并且大小有上限。
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// debug 是否记录调试级别的日志，各个goroutine都会读取
+var debug atomic.Bool
+
+// SetDebug 设置是否记录调试级别的日志。调试级别下路径不做哈希，并记录按键、IPC请求内容等细节
+func SetDebug(on bool) {
+	debug.Store(on)
+}
+
+// Debug 返回是否记录调试级别的日志
+func Debug() bool {
+	return debug.Load()
+}
+
+// Debugf 只在调试级别下记录日志，参数与log.Printf相同
+func Debugf(format string, args ...interface{}) {
+	if debug.Load() {
+		log.Output(2, fmt.Sprintf(format, args...))
+	}
+}
+
+// Path 返回可以写入日志的路径：调试级别下为完整路径，否则为路径的哈希加扩展名，例如“#3f2a9c1e.puml”，
+// 同一路径的哈希相同，仍然可以在日志中跟踪同一个文件
+func Path(path string) string {
+	if debug.Load() || path == "" {
+		return path
+	}
+	sum := sha256.Sum256([]byte(path))
+	return "#" + hex.EncodeToString(sum[:4]) + filepath.Ext(path)
+}
+
+// Paths 对每个路径调用Path
+func Paths(paths []string) []string {
+	result := make([]string, len(paths))
+	for i, p := range paths {
+		result[i] = Path(p)
+	}
+	return result
+}
+
+// Limiter 限制同一类日志的频率：距上一条不足Interval时不记录，只计数，下一条记录时附上省略的条数
+type Limiter struct {
+	Interval time.Duration
+
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+// Printf 在频率允许时记录日志
+func (l *Limiter) Printf(format string, args ...interface{}) {
+	if msg, ok := l.allow(format, args); ok {
+		log.Output(2, msg)
+	}
+}
+
+// Debugf 在调试级别下并且频率允许时记录日志
+func (l *Limiter) Debugf(format string, args ...interface{}) {
+	if !debug.Load() {
+		return
+	}
+	if msg, ok := l.allow(format, args); ok {
+		log.Output(2, msg)
+	}
+}
+
+// allow 判断现在能否记录日志，能记录时返回附上省略条数的消息
+func (l *Limiter) allow(format string, args []interface{}) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if !l.last.IsZero() && now.Sub(l.last) < l.Interval {
+		l.suppressed++
+		return "", false
+	}
+	msg := fmt.Sprintf(format, args...)
+	if l.suppressed > 0 {
+		msg += fmt.Sprintf("（之前省略了%d条）", l.suppressed)
+	}
+	l.last = now
+	l.suppressed = 0
+	return msg, true
+}
+
+// DefaultMaxSize 日志文件默认的大小上限
+const DefaultMaxSize = 5 << 20
+
+// File 是大小有上限的日志文件：超过上限时把当前文件改名为“文件名.1”（覆盖之前的），再写入新文件，
+// 最多占用两倍上限的空间。文件只有当前用户可以读写
+type File struct {
+	path    string
+	maxSize int64
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenFile 创建或截断日志文件，已经存在的文件也改为只有当前用户可以读写
+func OpenFile(path string, maxSize int64) (*File, error) {
+	lf := &File{path: path, maxSize: maxSize}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+// open 创建或截断日志文件
+func (lf *File) open() error {
+	f, err := os.OpenFile(lf.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// 之前的版本以0644创建日志文件，OpenFile不会改变已有文件的权限
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	lf.f = f
+	lf.size = 0
+	return nil
+}
+
+// Write 写入日志，超过大小上限时先轮换文件
+func (lf *File) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.size > 0 && lf.size+int64(len(p)) > lf.maxSize {
+		lf.f.Close()
+		// 改名失败时直接截断，日志文件仍然不会超过上限
+		os.Rename(lf.path, lf.path+".1")
+		if err := lf.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// Close 关闭日志文件
+func (lf *File) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.f.Close()
+}
@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLog 把标准日志输出到缓冲区，测试结束时恢复
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestPath(t *testing.T) {
+	defer SetDebug(false)
+	path := "/Users/alice/secret/billing.puml"
+	hashed := Path(path)
+	if strings.Contains(hashed, "alice") || strings.Contains(hashed, "billing") {
+		t.Errorf("普通级别下路径应只记录哈希，得到 %q", hashed)
+	}
+	if !strings.HasPrefix(hashed, "#") || !strings.HasSuffix(hashed, ".puml") {
+		t.Errorf("哈希应以#开头并保留扩展名，得到 %q", hashed)
+	}
+	if Path(path) != hashed || Path("/other.puml") == hashed {
+		t.Error("同一路径的哈希应相同，不同路径的哈希应不同")
+	}
+
+	SetDebug(true)
+	if got := Path(path); got != path {
+		t.Errorf("调试级别下应记录完整路径，得到 %q", got)
+	}
+}
+
+func TestDebugf(t *testing.T) {
+	defer SetDebug(false)
+	buf := captureLog(t)
+	Debugf("按键 %s", "A")
+	if buf.Len() != 0 {
+		t.Errorf("普通级别下不应记录调试日志，得到 %q", buf.String())
+	}
+	SetDebug(true)
+	Debugf("按键 %s", "A")
+	if !strings.Contains(buf.String(), "按键 A") {
+		t.Errorf("调试级别下应记录日志，得到 %q", buf.String())
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	buf := captureLog(t)
+	l := Limiter{Interval: 50 * time.Millisecond}
+	for i := 0; i < 5; i++ {
+		l.Printf("事件 %d", i)
+	}
+	if got := strings.Count(buf.String(), "事件"); got != 1 {
+		t.Fatalf("间隔内应只记录1条，得到 %d 条: %q", got, buf.String())
+	}
+	time.Sleep(60 * time.Millisecond)
+	l.Printf("事件 %d", 5)
+	if !strings.Contains(buf.String(), "事件 5（之前省略了4条）") {
+		t.Errorf("下一条日志应附上省略的条数，得到 %q", buf.String())
+	}
+}
+
+func TestFileRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "viewer.log")
+	if err := ioutil.WriteFile(path, []byte("旧的日志"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenFile(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("日志文件应只有当前用户可读写，权限为 %v", info.Mode().Perm())
+	}
+
+	f.Write([]byte("12345678\n"))
+	f.Write([]byte("abcdefgh\n"))
+	current, _ := ioutil.ReadFile(path)
+	previous, _ := ioutil.ReadFile(path + ".1")
+	if string(current) != "abcdefgh\n" || string(previous) != "12345678\n" {
+		t.Errorf("超过上限时应轮换文件，当前 %q，之前 %q", current, previous)
+	}
+}
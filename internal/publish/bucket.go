@@ -0,0 +1,52 @@
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"plantumlmacviewer/config"
+)
+
+// AWS 和 GCloud 是上传到S3和GCS使用的命令，测试中可以替换。上传使用这些命令已经配置好的凭据
+var (
+	AWS    = "aws"
+	GCloud = "gcloud"
+)
+
+// bucketCommand 返回把文件file上传到对象地址object的命令和参数
+func bucketCommand(u config.BucketUpload, file, object string) []string {
+	if u.Scheme() == "gs" {
+		args := []string{GCloud, "storage", "cp", "--quiet"}
+		if u.CacheControl != "" {
+			args = append(args, "--cache-control="+u.CacheControl)
+		}
+		return append(args, file, object)
+	}
+	args := []string{AWS, "s3", "cp", "--only-show-errors"}
+	if u.CacheControl != "" {
+		args = append(args, "--cache-control", u.CacheControl)
+	}
+	return append(args, file, object)
+}
+
+// UploadObject 把导出的文件file上传到u中rel（file相对于导出目录的路径）对应的对象，返回对象地址。
+// 同名对象已经存在时覆盖，地址保持不变
+func UploadObject(ctx context.Context, u config.BucketUpload, file, rel string) (string, error) {
+	if err := u.Validate(); err != nil {
+		return "", err
+	}
+	object := u.ObjectURL(rel)
+	args := bucketCommand(u, file, object)
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		var execErr *exec.Error
+		if errors.As(err, &execErr) {
+			return object, fmt.Errorf("上传到 %s 需要安装并配置 %s 命令: %v", u.Scheme(), args[0], err)
+		}
+		return object, fmt.Errorf("上传到 %s 失败: %v %s", object, err, strings.TrimSpace(string(output)))
+	}
+	return object, nil
+}
@@ -0,0 +1,56 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"plantumlmacviewer/config"
+)
+
+// fakeBucketCommand 把aws和gcloud替换为把参数写入文件的脚本，返回该文件的路径
+func fakeBucketCommand(t *testing.T, exitCode int) string {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "cli")
+	body := fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\necho denied >&2\nexit %d\n", args, exitCode)
+	if err := ioutil.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	oldAWS, oldGCloud := AWS, GCloud
+	AWS, GCloud = script, script
+	t.Cleanup(func() { AWS, GCloud = oldAWS, oldGCloud })
+	return args
+}
+
+func TestUploadObject(t *testing.T) {
+	args := fakeBucketCommand(t, 0)
+	tests := []struct {
+		upload     config.BucketUpload
+		wantObject string
+		wantArgs   string
+	}{
+		{config.BucketUpload{URL: "s3://docs/diagrams", CacheControl: "max-age=60"}, "s3://docs/diagrams/api/flow.png",
+			"s3 cp --only-show-errors --cache-control max-age=60 /out/api/flow.png s3://docs/diagrams/api/flow.png"},
+		{config.BucketUpload{URL: "gs://docs", Key: "{stem}.{ext}"}, "gs://docs/flow.png",
+			"storage cp --quiet /out/api/flow.png gs://docs/flow.png"},
+	}
+	for _, tt := range tests {
+		object, err := UploadObject(context.Background(), tt.upload, "/out/api/flow.png", filepath.Join("api", "flow.png"))
+		if err != nil || object != tt.wantObject {
+			t.Errorf("UploadObject = %q, %v，应为 %q", object, err, tt.wantObject)
+		}
+		data, _ := ioutil.ReadFile(args)
+		if got := strings.TrimSpace(string(data)); got != tt.wantArgs {
+			t.Errorf("命令参数为 %q，应为 %q", got, tt.wantArgs)
+		}
+	}
+
+	fakeBucketCommand(t, 1)
+	if _, err := UploadObject(context.Background(), config.BucketUpload{URL: "s3://docs"}, "/out/flow.png", "flow.png"); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("上传失败时错误应包含命令的输出，得到 %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+// Package publish 在导出后把图像上传到文档系统：Confluence页面的附件，或者以multipart表单接收文件的webhook，
+// 发布目标按文件所在项目的配置（.plantumlviewer.json中的publish）确定，文档中的图表随导出自动更新。
+// 守护模式还可以把更新的导出结果上传到S3或GCS（见UploadObject），图表始终可以通过固定的地址访问
+package publish
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"plantumlmacviewer/config"
+)
+
+// Timeout 是一次上传最长的时间
+const Timeout = 2 * time.Minute
+
+// maxErrorBody 是上传失败时从响应中读取、显示在错误信息中的最大字节数
+const maxErrorBody = 512
+
+// Client 是上传使用的HTTP客户端，测试中可以替换
+var Client = &http.Client{Timeout: Timeout}
+
+// ErrNoTarget 表示文件所在项目的配置中没有设置发布目标
+var ErrNoTarget = errors.New("项目配置 " + config.ProjectFile + " 中没有设置发布目标（publish）")
+
+// File 是一个要上传的文件
+type File struct {
+	Name string // 文件名，Confluence中作为附件名，已有同名附件时上传为新版本
+	Data []byte
+}
+
+// Publish 把导出的图像上传到target，target.Source为true时同时上传sourcePath指向的源文件。
+// webhook收到的表单中，file是图像，source是源文件，name是源文件名
+func Publish(ctx context.Context, target config.Publish, image File, sourcePath string) error {
+	if err := target.Validate(); err != nil {
+		return err
+	}
+	files := []File{image}
+	if target.Source {
+		data, err := ioutil.ReadFile(sourcePath)
+		if err != nil {
+			return fmt.Errorf("无法读取源文件: %v", err)
+		}
+		files = append(files, File{Name: filepath.Base(sourcePath), Data: data})
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	var method, endpoint string
+	if target.EffectiveType() == config.PublishConfluence {
+		// 上传附件的接口在已有同名附件时上传为新版本，页面中引用附件的图片随之更新
+		method = http.MethodPut
+		endpoint = strings.TrimRight(target.URL, "/") + "/rest/api/content/" + target.PageID + "/child/attachment"
+		for _, f := range files {
+			if err := writePart(form, "file", f); err != nil {
+				return err
+			}
+		}
+		form.WriteField("minorEdit", "true")
+	} else {
+		method, endpoint = http.MethodPost, target.URL
+		fields := []string{"file", "source"}
+		for i, f := range files {
+			if err := writePart(form, fields[i], f); err != nil {
+				return err
+			}
+		}
+		form.WriteField("name", filepath.Base(sourcePath))
+	}
+	if err := form.Close(); err != nil {
+		return fmt.Errorf("无法生成上传内容: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, &body)
+	if err != nil {
+		return fmt.Errorf("无效的发布地址: %v", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if target.EffectiveType() == config.PublishConfluence {
+		// Confluence要求上传附件的请求带上这个头，否则按XSRF拒绝
+		req.Header.Set("X-Atlassian-Token", "no-check")
+	}
+	if token := target.Token(); token != "" {
+		if target.User != "" {
+			req.SetBasicAuth(target.User, token)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	resp, err := Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("上传失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("上传失败: %s %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Upload 把从sourcePath导出的文件output上传到sourcePath所在项目的发布目标，没有设置发布目标时返回ErrNoTarget
+func Upload(ctx context.Context, sourcePath, output string) error {
+	target, err := config.PublishFor(sourcePath)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return ErrNoTarget
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		return fmt.Errorf("无法读取导出的文件: %v", err)
+	}
+	return Publish(ctx, *target, File{Name: filepath.Base(output), Data: data}, sourcePath)
+}
+
+// writePart 把文件f作为名为field的表单字段写入form，Content-Type按扩展名确定
+func writePart(form *multipart.Writer, field string, f File) error {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, field, strings.NewReplacer(`"`, "", "\\", "").Replace(f.Name)))
+	contentType := mime.TypeByExtension(filepath.Ext(f.Name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("无法生成上传内容: %v", err)
+	}
+	_, err = part.Write(f.Data)
+	return err
+}
@@ -0,0 +1,100 @@
+package publish
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"plantumlmacviewer/config"
+)
+
+func TestPublishWebhook(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "flow.puml")
+	if err := ioutil.WriteFile(source, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		method, auth, name, file, source, fileType string
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.method, got.auth = r.Method, r.Header.Get("Authorization")
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("ParseMultipartForm: %v", err)
+			return
+		}
+		got.name = r.FormValue("name")
+		for field, dst := range map[string]*string{"file": &got.file, "source": &got.source} {
+			f, header, err := r.FormFile(field)
+			if err != nil {
+				t.Errorf("缺少 %s: %v", field, err)
+				continue
+			}
+			data, _ := ioutil.ReadAll(f)
+			*dst = header.Filename + ":" + string(data)
+			if field == "file" {
+				got.fileType = header.Header.Get("Content-Type")
+			}
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("TEST_PUBLISH_TOKEN", "abc")
+	target := config.Publish{URL: server.URL, TokenEnv: "TEST_PUBLISH_TOKEN", Source: true}
+	if err := Publish(context.Background(), target, File{Name: "flow.png", Data: []byte("PNG")}, source); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got.method != http.MethodPost || got.auth != "Bearer abc" || got.name != "flow.puml" {
+		t.Errorf("请求不正确: %+v", got)
+	}
+	if got.file != "flow.png:PNG" || got.fileType != "image/png" || got.source != "flow.puml:@startuml\nA -> B\n@enduml\n" {
+		t.Errorf("上传的文件不正确: %+v", got)
+	}
+}
+
+func TestPublishConfluence(t *testing.T) {
+	var path, xsrf string
+	var files int
+	var user, password string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, xsrf = r.Method+" "+r.URL.Path, r.Header.Get("X-Atlassian-Token")
+		user, password, _ = r.BasicAuth()
+		if err := r.ParseMultipartForm(1 << 20); err == nil {
+			files = len(r.MultipartForm.File["file"])
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("TEST_PUBLISH_TOKEN", "abc")
+	target := config.Publish{Type: config.PublishConfluence, URL: server.URL + "/wiki/", PageID: "12345", User: "me@example.com", TokenEnv: "TEST_PUBLISH_TOKEN"}
+	if err := Publish(context.Background(), target, File{Name: "flow.svg", Data: []byte("<svg/>")}, "flow.puml"); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if path != "PUT /wiki/rest/api/content/12345/child/attachment" || xsrf != "no-check" || files != 1 {
+		t.Errorf("请求不正确: %s, X-Atlassian-Token=%q, %d个文件", path, xsrf, files)
+	}
+	if user != "me@example.com" || password != "abc" {
+		t.Errorf("应使用Basic认证，得到 %q %q", user, password)
+	}
+}
+
+func TestPublishError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "page not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	err := Publish(context.Background(), config.Publish{URL: server.URL}, File{Name: "a.png"}, "a.puml")
+	if err == nil || err.Error() != "上传失败: 404 Not Found page not found" {
+		t.Errorf("应返回包含状态和响应内容的错误，得到 %v", err)
+	}
+	dir := t.TempDir()
+	if err := Upload(context.Background(), filepath.Join(dir, "a.puml"), filepath.Join(dir, "a.png")); err != ErrNoTarget {
+		t.Errorf("没有设置发布目标时应返回ErrNoTarget，得到 %v", err)
+	}
+	if err := Publish(context.Background(), config.Publish{URL: server.URL, Source: true}, File{Name: "a.png"}, filepath.Join(t.TempDir(), "missing.puml")); err == nil {
+		t.Error("源文件不存在时应返回错误")
+	}
+}
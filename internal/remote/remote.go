@@ -0,0 +1,252 @@
+// Package remote 打开开发服务器上的图表：通过ssh把 user@host:/path 形式的远程文件复制到本机的镜像目录，
+// 以只读方式打开，并定时检查远程文件的修改时间，变化后重新复制，查看器随本地文件的变化自动刷新。
+// 镜像目录中的路径包含主机和远程路径，任何实例都可以从本地路径还原出远程文件
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/logging"
+)
+
+// PollInterval 是检查远程文件修改时间的间隔
+const PollInterval = 5 * time.Second
+
+// SSH 是执行远程命令使用的ssh程序，测试中可以替换
+var SSH = "ssh"
+
+// sshOptions 让ssh不询问密码或主机密钥，连不上时尽快失败，不会让查看器一直等待。
+// 需要事先配置好密钥或ssh-agent
+var sshOptions = []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10"}
+
+// Spec 是一个远程文件
+type Spec struct {
+	Host string // ssh的目标，可以带用户名，例如 dev@build01
+	Path string // 远程文件的路径，以/或~开头
+}
+
+// String 返回 host:path 形式的名称
+func (s Spec) String() string {
+	return s.Host + ":" + s.Path
+}
+
+// Parse 解析 [user@]host:/path 或 [user@]host:~/path 形式的参数。主机名中不能有/，
+// 不能以-开头（避免被ssh当作选项），不能是.或..（镜像目录中的路径会跑到镜像目录之外），
+// 本机的Windows路径（C:/...这样单个字母的盘符）或相对路径不会被当作远程文件
+func Parse(arg string) (Spec, bool) {
+	i := strings.Index(arg, ":")
+	if i <= 0 {
+		return Spec{}, false
+	}
+	host, p := arg[:i], arg[i+1:]
+	if strings.ContainsAny(host, "/\\ ") || strings.HasPrefix(host, "-") || strings.HasSuffix(host, "@") {
+		return Spec{}, false
+	}
+	if name := host[strings.LastIndex(host, "@")+1:]; name == "." || name == ".." || isDriveLetter(host) {
+		return Spec{}, false
+	}
+	if !strings.HasPrefix(p, "/") && p != "~" && !strings.HasPrefix(p, "~/") {
+		return Spec{}, false
+	}
+	if strings.HasPrefix(p, "/") {
+		p = path.Clean(p)
+	} else {
+		p = path.Join("~", path.Clean("/" + strings.TrimPrefix(p, "~"))[1:])
+	}
+	spec := Spec{Host: host, Path: p}
+	if !inCacheDir(spec.LocalPath()) {
+		return Spec{}, false
+	}
+	return spec, true
+}
+
+// isDriveLetter 判断host是否是Windows路径的盘符，例如 C:/docs/flow.puml 中的C
+func isDriveLetter(host string) bool {
+	return len(host) == 1 && (host[0] >= 'a' && host[0] <= 'z' || host[0] >= 'A' && host[0] <= 'Z')
+}
+
+// inCacheDir 判断local是否在镜像目录之中
+func inCacheDir(local string) bool {
+	rel, err := filepath.Rel(CacheDir(), local)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// CacheDir 返回远程文件的镜像目录
+func CacheDir() string {
+	return filepath.Join(config.Dir(), "remote")
+}
+
+// LocalPath 返回远程文件在镜像目录中的路径：CacheDir/主机/远程路径
+func (s Spec) LocalPath() string {
+	return filepath.Join(CacheDir(), s.Host, filepath.FromSlash(strings.TrimPrefix(s.Path, "/")))
+}
+
+// FromLocal 从镜像目录中的本地路径还原远程文件，不在镜像目录中时返回false
+func FromLocal(local string) (Spec, bool) {
+	rel, err := filepath.Rel(CacheDir(), local)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return Spec{}, false
+	}
+	parts := strings.SplitN(filepath.ToSlash(rel), "/", 2)
+	if len(parts) != 2 {
+		return Spec{}, false
+	}
+	p := parts[1]
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		p = "/" + p
+	}
+	return Spec{Host: parts[0], Path: p}, true
+}
+
+// quote 把路径放在单引号中交给远程shell，~开头的路径保留~让远程shell展开
+func quote(p string) string {
+	q := func(s string) string { return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'" }
+	if p == "~" {
+		return "~"
+	}
+	if strings.HasPrefix(p, "~/") {
+		return "~/" + q(p[2:])
+	}
+	return q(p)
+}
+
+// run 在远程主机上执行命令，返回标准输出；失败时返回的错误包含ssh的错误输出
+func (s Spec) run(command string) ([]byte, error) {
+	args := append(append([]string(nil), sshOptions...), "--", s.Host, command)
+	cmd := exec.Command(SSH, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("ssh %s 失败: %s", s.Host, msg)
+		}
+		return nil, fmt.Errorf("ssh %s 失败: %v", s.Host, err)
+	}
+	return out, nil
+}
+
+// ModTime 返回远程文件的修改时间（Unix时间，秒），同时支持GNU和BSD的stat
+func (s Spec) ModTime() (int64, error) {
+	p := quote(s.Path)
+	out, err := s.run(fmt.Sprintf("stat -c %%Y %s 2>/dev/null || stat -f %%m %s", p, p))
+	if err != nil {
+		return 0, err
+	}
+	mtime, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无法解析 %s 的修改时间: %q", s, out)
+	}
+	return mtime, nil
+}
+
+// Fetch 把远程文件复制到镜像目录，返回本地路径。本地文件是只读的，内容没有变化时不重写，
+// 避免查看器无谓地重新渲染
+func (s Spec) Fetch() (string, error) {
+	local := s.LocalPath()
+	if !inCacheDir(local) {
+		return "", fmt.Errorf("远程文件 %s 的副本不在镜像目录中", logging.Path(s.String()))
+	}
+	data, err := s.run("cat " + quote(s.Path))
+	if err != nil {
+		return "", err
+	}
+	if old, err := ioutil.ReadFile(local); err == nil && bytes.Equal(old, data) {
+		return local, nil
+	}
+	dir := filepath.Dir(local)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("无法创建远程文件的镜像目录: %v", err)
+	}
+	// 先写入临时文件再重命名，查看器不会读到写了一半的文件；重命名可以替换只读的旧文件
+	tmp, err := ioutil.TempFile(dir, ".remote-")
+	if err != nil {
+		return "", fmt.Errorf("无法写入远程文件的副本: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0444)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), local)
+	}
+	if err != nil {
+		return "", fmt.Errorf("无法写入远程文件的副本: %v", err)
+	}
+	return local, nil
+}
+
+// Watcher 定时检查远程文件的修改时间，变化后重新复制到镜像目录
+type Watcher struct {
+	spec     Spec
+	interval time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// Watch 开始每隔interval检查一次远程文件，直到调用Stop为止
+func Watch(spec Spec, interval time.Duration) *Watcher {
+	w := &Watcher{spec: spec, interval: interval, stop: make(chan struct{})}
+	go w.run()
+	return w
+}
+
+// Stop 停止检查，可以多次调用
+func (w *Watcher) Stop() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+func (w *Watcher) run() {
+	last, err := w.spec.ModTime()
+	failing := err != nil
+	if failing {
+		log.Printf("无法检查远程文件 %s: %v", logging.Path(w.spec.String()), err)
+	}
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		mtime, err := w.spec.ModTime()
+		if err != nil {
+			// 连接断开时只记录一次，恢复后再次记录
+			if !failing {
+				log.Printf("无法检查远程文件 %s: %v", logging.Path(w.spec.String()), err)
+			}
+			failing = true
+			continue
+		}
+		if failing {
+			log.Printf("已恢复检查远程文件 %s", logging.Path(w.spec.String()))
+			failing = false
+		}
+		if mtime == last {
+			continue
+		}
+		if _, err := w.spec.Fetch(); err != nil {
+			log.Printf("无法复制远程文件 %s: %v", logging.Path(w.spec.String()), err)
+			continue
+		}
+		log.Printf("远程文件 %s 有变化，已重新复制", logging.Path(w.spec.String()))
+		last = mtime
+	}
+}
@@ -0,0 +1,111 @@
+package remote
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want Spec
+		ok   bool
+	}{
+		{"dev@build01:/srv/docs/flow.puml", Spec{"dev@build01", "/srv/docs/flow.puml"}, true},
+		{"build01:~/docs/flow.puml", Spec{"build01", "~/docs/flow.puml"}, true},
+		{"build01:/srv/../etc/a.puml", Spec{"build01", "/etc/a.puml"}, true},
+		{"docs/flow.puml", Spec{}, false},
+		{"C:\\docs\\flow.puml", Spec{}, false},
+		{"build01:docs/flow.puml", Spec{}, false},
+		{"-oProxyCommand=x:/a.puml", Spec{}, false},
+		{"dir/sub:/a.puml", Spec{}, false},
+		{":/a.puml", Spec{}, false},
+		{"..:/x", Spec{}, false},
+		{"dev@..:/x", Spec{}, false},
+		{".:/x", Spec{}, false},
+		{"C:/docs/flow.puml", Spec{}, false},
+		{"c:/docs/flow.puml", Spec{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := Parse(tt.arg)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Parse(%q) = %v, %v，应为 %v, %v", tt.arg, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLocalPathRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for _, spec := range []Spec{{"dev@build01", "/srv/docs/flow.puml"}, {"build01", "~/flow.puml"}} {
+		got, ok := FromLocal(spec.LocalPath())
+		if !ok || got != spec {
+			t.Errorf("FromLocal(LocalPath(%v)) = %v, %v", spec, got, ok)
+		}
+	}
+	if _, ok := FromLocal(filepath.Join(t.TempDir(), "flow.puml")); ok {
+		t.Error("镜像目录之外的文件不应被当作远程文件")
+	}
+	if _, err := (Spec{"..", "/x"}).Fetch(); err == nil || !strings.Contains(err.Error(), "镜像目录") {
+		t.Error("副本在镜像目录之外的远程文件不应复制")
+	}
+}
+
+// fakeSSH 把ssh替换为在本机执行远程命令的脚本
+func fakeSSH(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "ssh")
+	body := "#!/bin/sh\nwhile [ \"$1\" != \"--\" ]; do shift; done\nshift 2\nexec sh -c \"$1\"\n"
+	if err := ioutil.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := SSH
+	SSH = script
+	t.Cleanup(func() { SSH = old })
+}
+
+func TestFetch(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	fakeSSH(t)
+	source := filepath.Join(t.TempDir(), "it's a flow.puml")
+	if err := ioutil.WriteFile(source, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	spec := Spec{Host: "dev@build01", Path: source}
+
+	local, err := spec.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local != spec.LocalPath() {
+		t.Errorf("本地副本为 %s，应为 %s", local, spec.LocalPath())
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0444 {
+		t.Errorf("本地副本的权限为 %v，应为只读", info.Mode().Perm())
+	}
+
+	// 远程文件变化后再次复制，替换只读的旧副本
+	if err := ioutil.WriteFile(source, []byte("@startuml\nA -> C\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := spec.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(local); string(data) != "@startuml\nA -> C\n@enduml\n" {
+		t.Errorf("本地副本没有更新: %q", data)
+	}
+
+	if mtime, err := spec.ModTime(); err != nil || mtime == 0 {
+		t.Errorf("ModTime() = %d, %v", mtime, err)
+	}
+	if _, err := (Spec{Host: "build01", Path: "/no/such/file.puml"}).Fetch(); err == nil {
+		t.Error("远程文件不存在时应返回错误")
+	}
+}
@@ -0,0 +1,52 @@
+// Package samples 是内置的样例图表，覆盖时序图、类图、C4、JSON和甘特图等常见类型。
+// 新用户可以从“帮助 ▸ 打开样例”中打开它们，它们同时是自检（-selftest）渲染的样例。
+package samples
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+//go:embed *.puml
+var files embed.FS
+
+// Sample 是一个样例，Name是文件名，Title是菜单中显示的名称
+type Sample struct {
+	Name  string
+	Title string
+}
+
+// All 是“打开样例”菜单中列出的样例，按显示的顺序排列
+var All = []Sample{
+	{Name: "sequence.puml", Title: "时序图"},
+	{Name: "class.puml", Title: "类图"},
+	{Name: "c4.puml", Title: "C4容器图"},
+	{Name: "json.puml", Title: "JSON数据"},
+	{Name: "gantt.puml", Title: "甘特图"},
+	{Name: "multipage.puml", Title: "多页图表"},
+}
+
+// Names 返回所有样例的文件名，按名称排序
+func Names() []string {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Source 返回样例name的源码
+func Source(name string) ([]byte, error) {
+	data, err := files.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("没有样例 %s", name)
+	}
+	return data, nil
+}
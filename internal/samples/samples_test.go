@@ -0,0 +1,39 @@
+package samples
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+)
+
+func TestSamples(t *testing.T) {
+	var listed []string
+	for _, s := range All {
+		source, err := Source(s.Name)
+		if err != nil {
+			t.Errorf("%s: %v", s.Title, err)
+			continue
+		}
+		if !bytes.HasPrefix(source, []byte("@start")) {
+			t.Errorf("%s 应以@start开头", s.Name)
+		}
+		listed = append(listed, s.Name)
+	}
+
+	// 每个内置的样例都应出现在菜单中
+	sort.Strings(listed)
+	names := Names()
+	if len(names) != len(listed) {
+		t.Fatalf("Names = %v，菜单中列出 %v", names, listed)
+	}
+	for i := range names {
+		if names[i] != listed[i] {
+			t.Errorf("Names = %v，菜单中列出 %v", names, listed)
+			break
+		}
+	}
+
+	if _, err := Source("missing.puml"); err == nil {
+		t.Error("不存在的样例应返回错误")
+	}
+}
@@ -0,0 +1,127 @@
+// Package secret 解密以age或GPG加密保存的图表，供团队把敏感的网络拓扑等图表加密后放在仓库中。
+// 通过本机的age或gpg命令解密，明文只从命令的标准输出读入内存，不写入磁盘
+package secret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// 加密文件的格式
+const (
+	KindAge = "age"
+	KindGPG = "gpg"
+)
+
+// Age 和 GPG 是解密使用的命令，测试中可以替换
+var (
+	Age = "age"
+	GPG = "gpg"
+)
+
+// ErrKeyNeeded 表示需要（另外）提供密钥文件或口令才能解密：没有提供、口令错误或密钥不对
+var ErrKeyNeeded = errors.New("需要密钥或口令")
+
+// Key 是解密使用的凭据，只保存在内存中
+type Key struct {
+	Identity   string // age的密钥文件（age-keygen生成的文件或SSH私钥）
+	Passphrase string // GPG的口令，用于对称加密的文件或受口令保护的私钥；为空时使用gpg-agent中缓存的口令
+}
+
+// Detect 按内容判断文件是否加密，返回KindAge、KindGPG，没有加密时返回空字符串。
+// 二进制的GPG文件没有固定的文件头，只在扩展名为.gpg或.pgp时按第一个数据包识别
+func Detect(path string, data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("age-encryption.org/v1\n")),
+		bytes.HasPrefix(data, []byte("-----BEGIN AGE ENCRYPTED FILE-----")):
+		return KindAge
+	case bytes.HasPrefix(data, []byte("-----BEGIN PGP MESSAGE-----")):
+		return KindGPG
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if (ext == ".gpg" || ext == ".pgp") && len(data) > 0 && isPacketHeader(data[0]) {
+		return KindGPG
+	}
+	return ""
+}
+
+// isPacketHeader 判断b是否是以公钥或口令加密的会话密钥数据包开头的OpenPGP消息，新旧两种包头格式都支持
+func isPacketHeader(b byte) bool {
+	if b&0x80 == 0 {
+		return false
+	}
+	tag := b & 0x3f
+	if b&0x40 == 0 {
+		tag = (b >> 2) & 0x0f // 旧格式的包头中标签只有4位
+	}
+	return tag == 1 || tag == 3
+}
+
+// NeedsPassphrase 判断age文件是否以口令加密。age命令只从终端读取口令，查看器无法提供，
+// 这类文件需要改用密钥文件加密
+func NeedsPassphrase(data []byte) bool {
+	header, _, _ := bytes.Cut(data, []byte("\n---"))
+	return bytes.Contains(header, []byte("\n-> scrypt "))
+}
+
+// Decrypt 解密加密的文件path，返回明文。kind为KindAge时需要key.Identity，为KindGPG时口令通过标准输入交给gpg。
+// 凭据不对时返回的错误包含ErrKeyNeeded，可以用errors.Is判断后重新询问
+func Decrypt(ctx context.Context, path, kind string, key Key) ([]byte, error) {
+	var cmd *exec.Cmd
+	switch kind {
+	case KindAge:
+		if key.Identity == "" {
+			return nil, fmt.Errorf("%w：没有指定age的密钥文件", ErrKeyNeeded)
+		}
+		cmd = exec.CommandContext(ctx, Age, "--decrypt", "--identity", key.Identity, "--", path)
+	case KindGPG:
+		cmd = exec.CommandContext(ctx, GPG, "--batch", "--quiet", "--yes", "--no-tty",
+			"--pinentry-mode", "loopback", "--passphrase-fd", "0", "--decrypt", "--", path)
+		cmd.Stdin = strings.NewReader(key.Passphrase + "\n")
+	default:
+		return nil, fmt.Errorf("不支持的加密格式: %s", kind)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("找不到 %s 命令，请先安装后再打开加密的图表", cmd.Path)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		if keyRejected(kind, msg) {
+			return nil, fmt.Errorf("%w：%s", ErrKeyNeeded, msg)
+		}
+		return nil, fmt.Errorf("解密失败: %s", msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// keyRejected 按命令的错误输出判断是否因为密钥或口令不对而无法解密
+func keyRejected(kind, msg string) bool {
+	msg = strings.ToLower(msg)
+	var hints []string
+	if kind == KindAge {
+		hints = []string{"no identity matched", "incorrect passphrase", "failed to read", "failed to open"}
+	} else {
+		hints = []string{"bad session key", "bad passphrase", "no secret key", "no passphrase given"}
+	}
+	for _, hint := range hints {
+		if strings.Contains(msg, hint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		path string
+		data string
+		want string
+	}{
+		{"net.puml.age", "age-encryption.org/v1\n-> X25519 abc\n--- def\n", KindAge},
+		{"net.puml", "-----BEGIN AGE ENCRYPTED FILE-----\nYWdl\n", KindAge},
+		{"net.puml.asc", "-----BEGIN PGP MESSAGE-----\n\nhQEM\n", KindGPG},
+		{"net.puml.gpg", "\x8c\x0d\x04\x09", KindGPG},
+		{"net.puml.gpg", "\xc1\x4c\x03", KindGPG},
+		{"net.puml", "\x8c\x0d\x04\x09", ""},
+		{"net.puml.gpg", "@startuml\n", ""},
+		{"net.puml", "@startuml\nA -> B\n@enduml\n", ""},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.path, []byte(tt.data)); got != tt.want {
+			t.Errorf("Detect(%q, %q) = %q，应为 %q", tt.path, tt.data, got, tt.want)
+		}
+	}
+
+	if !NeedsPassphrase([]byte("age-encryption.org/v1\n-> scrypt salt 18\nbody\n--- mac\n")) {
+		t.Error("以口令加密的age文件应识别出来")
+	}
+	if NeedsPassphrase([]byte("age-encryption.org/v1\n-> X25519 abc\nbody\n--- mac\n")) {
+		t.Error("以密钥加密的age文件不需要口令")
+	}
+}
+
+func TestDecryptGPG(t *testing.T) {
+	if _, err := exec.LookPath(GPG); err != nil {
+		t.Skip("没有安装gpg")
+	}
+	home := t.TempDir()
+	t.Setenv("GNUPGHOME", home)
+	t.Cleanup(func() { exec.Command("gpgconf", "--kill", "gpg-agent").Run() })
+
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "net.puml")
+	source := "@startuml\nnode 数据库\n@enduml\n"
+	if err := ioutil.WriteFile(plain, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	encrypt := exec.Command(GPG, "--batch", "--pinentry-mode", "loopback", "--passphrase", "secret", "--symmetric", plain)
+	if out, err := encrypt.CombinedOutput(); err != nil {
+		t.Skipf("无法用gpg加密: %v\n%s", err, out)
+	}
+	encrypted := plain + ".gpg"
+	data, _ := ioutil.ReadFile(encrypted)
+	if kind := Detect(encrypted, data); kind != KindGPG {
+		t.Fatalf("Detect = %q，应为gpg", kind)
+	}
+
+	if _, err := Decrypt(context.Background(), encrypted, KindGPG, Key{Passphrase: "wrong"}); !errors.Is(err, ErrKeyNeeded) {
+		t.Errorf("口令错误时应返回ErrKeyNeeded，得到 %v", err)
+	}
+	got, err := Decrypt(context.Background(), encrypted, KindGPG, Key{Passphrase: "secret"})
+	if err != nil || string(got) != source {
+		t.Errorf("Decrypt = %q, %v，应为 %q", got, err, source)
+	}
+	if _, err := Decrypt(context.Background(), encrypted, KindAge, Key{}); !errors.Is(err, ErrKeyNeeded) {
+		t.Errorf("没有密钥文件时应返回ErrKeyNeeded，得到 %v", err)
+	}
+}
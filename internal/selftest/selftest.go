@@ -0,0 +1,201 @@
+// Package selftest 渲染内置的样例图表，与各PlantUML版本的基准数据比较页数、尺寸和内容，
+// 用于发现渲染流程（包括多页图表）的回归。
+package selftest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"plantumlmacviewer/internal/samples"
+	"plantumlmacviewer/plantuml"
+)
+
+//go:embed golden
+var goldenFS embed.FS
+
+// Page 是渲染出的一页的尺寸和PNG数据的SHA-256
+type Page struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	SHA256 string `json:"sha256"`
+}
+
+// Golden 是某个PlantUML版本下各样例的基准数据，Samples的键为样例文件名
+type Golden struct {
+	Version string            `json:"version"`
+	Samples map[string][]Page `json:"samples"`
+}
+
+// Result 是检查单个样例的结果，Err为nil表示与基准一致
+type Result struct {
+	Sample string
+	Err    error
+}
+
+// RenderFunc 将filePath渲染为PNG放到outDir中，返回按页码排序的文件
+type RenderFunc func(filePath, outDir string) ([]string, error)
+
+// RenderPNG 使用本机的PlantUML渲染
+func RenderPNG(filePath, outDir string) ([]string, error) {
+	return plantuml.RenderPages(filePath, outDir, "png", 0)
+}
+
+// Samples 返回内置样例的文件名，按名称排序
+func Samples() []string {
+	return samples.Names()
+}
+
+// GoldenFile 返回version的基准数据文件相对于本包目录的路径
+func GoldenFile(version string) string {
+	return path.Join("golden", version+".json")
+}
+
+// LoadGolden 读取内置的version的基准数据
+func LoadGolden(version string) (*Golden, error) {
+	data, err := goldenFS.ReadFile(GoldenFile(version))
+	if err != nil {
+		return nil, fmt.Errorf("没有 PlantUML %s 的基准数据，请参考 internal/selftest/golden/README.md 生成", version)
+	}
+	var golden Golden
+	if err := json.Unmarshal(data, &golden); err != nil {
+		return nil, fmt.Errorf("无法解析 PlantUML %s 的基准数据: %v", version, err)
+	}
+	return &golden, nil
+}
+
+// Snapshot 渲染所有样例，返回version的基准数据
+func Snapshot(render RenderFunc, version string) (*Golden, error) {
+	dir, err := ioutil.TempDir("", "plantuml-selftest")
+	if err != nil {
+		return nil, fmt.Errorf("无法创建临时目录: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	golden := &Golden{Version: version, Samples: make(map[string][]Page)}
+	for _, name := range Samples() {
+		pages, err := renderSample(render, dir, name)
+		if err != nil {
+			return nil, fmt.Errorf("样例 %s: %v", name, err)
+		}
+		golden.Samples[name] = pages
+	}
+	return golden, nil
+}
+
+// Check 渲染所有样例并与golden比较，按样例名称顺序返回结果
+func Check(render RenderFunc, golden *Golden) []Result {
+	dir, err := ioutil.TempDir("", "plantuml-selftest")
+	if err != nil {
+		return []Result{{Err: fmt.Errorf("无法创建临时目录: %v", err)}}
+	}
+	defer os.RemoveAll(dir)
+
+	var results []Result
+	for _, name := range Samples() {
+		result := Result{Sample: name}
+		want, ok := golden.Samples[name]
+		if !ok {
+			result.Err = fmt.Errorf("没有基准数据")
+		} else if got, err := renderSample(render, dir, name); err != nil {
+			result.Err = err
+		} else {
+			result.Err = comparePages(want, got)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Report 输出每个样例的结果，全部通过时返回0，否则返回1
+func Report(w io.Writer, results []Result) int {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(w, "失败 %s: %v\n", result.Sample, result.Err)
+		} else {
+			fmt.Fprintf(w, "通过 %s\n", result.Sample)
+		}
+	}
+	fmt.Fprintf(w, "共%d个样例，%d个失败\n", len(results), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Run 使用render渲染所有样例，与内置的version的基准数据比较并输出结果，返回进程退出码
+func Run(w io.Writer, render RenderFunc, version string) int {
+	fmt.Fprintf(w, "PlantUML 版本: %s\n", version)
+	golden, err := LoadGolden(version)
+	if err != nil {
+		fmt.Fprintf(w, "%v\n", err)
+		return 1
+	}
+	return Report(w, Check(render, golden))
+}
+
+// renderSample 在dir下的单独目录中渲染样例name，返回各页的数据
+func renderSample(render RenderFunc, dir, name string) ([]Page, error) {
+	source, err := samples.Source(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sampleDir := filepath.Join(dir, strings.TrimSuffix(name, filepath.Ext(name)))
+	outDir := filepath.Join(sampleDir, "out")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, fmt.Errorf("无法创建输出目录: %v", err)
+	}
+	filePath := filepath.Join(sampleDir, name)
+	if err := ioutil.WriteFile(filePath, source, 0644); err != nil {
+		return nil, fmt.Errorf("无法写入样例: %v", err)
+	}
+
+	files, err := render(filePath, outDir)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]Page, 0, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("无法读取生成的图像: %v", err)
+		}
+		config, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("无法解析生成的图像 %s: %v", filepath.Base(file), err)
+		}
+		sum := sha256.Sum256(data)
+		pages = append(pages, Page{Width: config.Width, Height: config.Height, SHA256: hex.EncodeToString(sum[:])})
+	}
+	return pages, nil
+}
+
+// comparePages 比较渲染结果与基准，返回第一个差异
+func comparePages(want, got []Page) error {
+	if len(got) != len(want) {
+		return fmt.Errorf("页数为%d，基准为%d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Width != want[i].Width || got[i].Height != want[i].Height {
+			return fmt.Errorf("第%d页尺寸为%dx%d，基准为%dx%d", i+1, got[i].Width, got[i].Height, want[i].Width, want[i].Height)
+		}
+		if got[i].SHA256 != want[i].SHA256 {
+			return fmt.Errorf("第%d页内容与基准不同", i+1)
+		}
+	}
+	return nil
+}
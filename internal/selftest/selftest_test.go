@@ -0,0 +1,166 @@
+package selftest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"plantumlmacviewer/plantuml"
+)
+
+var update = flag.Bool("update", false, "重新生成本机PlantUML版本的基准数据")
+
+// fakeRender 按newpage分页，第n页生成宽为10*n的PNG，模拟PlantUML的多页输出文件名
+func fakeRender(filePath, outDir string) ([]string, error) {
+	source, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	pageCount := strings.Count(string(source), "newpage") + 1
+
+	var files []string
+	for i := 0; i < pageCount; i++ {
+		name := base + ".png"
+		if i > 0 {
+			name = fmt.Sprintf("%s_%03d.png", base, i)
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 10*(i+1), 5))); err != nil {
+			return nil, err
+		}
+		file := filepath.Join(outDir, name)
+		if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func TestSamplesIncludeMultipage(t *testing.T) {
+	golden, err := Snapshot(fakeRender, "test")
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if len(golden.Samples) != len(Samples()) || len(Samples()) == 0 {
+		t.Fatalf("应包含所有样例，得到 %v", golden.Samples)
+	}
+	if pages := golden.Samples["multipage.puml"]; len(pages) != 3 {
+		t.Fatalf("multipage.puml 应有3页，得到 %d 页", len(pages))
+	}
+}
+
+func TestCheckMatchingGolden(t *testing.T) {
+	golden, err := Snapshot(fakeRender, "test")
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	for _, result := range Check(fakeRender, golden) {
+		if result.Err != nil {
+			t.Errorf("%s: %v", result.Sample, result.Err)
+		}
+	}
+}
+
+func TestCheckReportsDifferences(t *testing.T) {
+	golden, err := Snapshot(fakeRender, "test")
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	golden.Samples["multipage.puml"] = golden.Samples["multipage.puml"][:2]
+	golden.Samples["sequence.puml"][0].Width++
+	golden.Samples["class.puml"][0].SHA256 = "0"
+
+	want := map[string]string{
+		"multipage.puml": "页数为3，基准为2",
+		"sequence.puml":  "第1页尺寸",
+		"class.puml":     "第1页内容与基准不同",
+	}
+	results := Check(fakeRender, golden)
+	for _, result := range results {
+		expected, changed := want[result.Sample]
+		if !changed {
+			// 其他样例与基准一致
+			if result.Err != nil {
+				t.Errorf("%s: %v", result.Sample, result.Err)
+			}
+		} else if result.Err == nil || !strings.Contains(result.Err.Error(), expected) {
+			t.Errorf("%s: 错误 = %v，应包含 %q", result.Sample, result.Err, expected)
+		}
+	}
+
+	var out bytes.Buffer
+	if code := Report(&out, results); code != 1 {
+		t.Errorf("有失败的样例时退出码应为1，得到 %d", code)
+	}
+	if !strings.Contains(out.String(), "3个失败") {
+		t.Errorf("输出应包含失败数量:\n%s", out.String())
+	}
+}
+
+func TestCheckReportsRenderError(t *testing.T) {
+	golden, err := Snapshot(fakeRender, "test")
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	failing := func(filePath, outDir string) ([]string, error) {
+		return nil, &plantuml.RenderError{Line: 2, Output: "Error line 2 in file"}
+	}
+	for _, result := range Check(failing, golden) {
+		if plantuml.ErrorLine(result.Err) != 2 {
+			t.Errorf("%s: 应返回渲染错误，得到 %v", result.Sample, result.Err)
+		}
+	}
+}
+
+func TestRunWithoutGolden(t *testing.T) {
+	var out bytes.Buffer
+	if code := Run(&out, fakeRender, "0.0.0"); code != 1 {
+		t.Errorf("没有基准数据时退出码应为1，得到 %d", code)
+	}
+	if !strings.Contains(out.String(), "没有 PlantUML 0.0.0 的基准数据") {
+		t.Errorf("输出应说明缺少基准数据:\n%s", out.String())
+	}
+}
+
+// TestGolden 使用本机的PlantUML渲染样例并与基准比较，加上-update时重新生成基准数据
+func TestGolden(t *testing.T) {
+	version, err := plantuml.Version()
+	if err != nil {
+		t.Skipf("没有安装PlantUML: %v", err)
+	}
+
+	if *update {
+		golden, err := Snapshot(RenderPNG, version)
+		if err != nil {
+			t.Fatalf("Snapshot: %v", err)
+		}
+		data, err := json.MarshalIndent(golden, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(GoldenFile(version), append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("已更新 %s", GoldenFile(version))
+		return
+	}
+
+	golden, err := LoadGolden(version)
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, result := range Check(RenderPNG, golden) {
+		if result.Err != nil {
+			t.Errorf("%s: %v", result.Sample, result.Err)
+		}
+	}
+}
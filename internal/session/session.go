@@ -0,0 +1,239 @@
+// Package session 记录运行中的实例启动的渲染进程和创建的临时目录。render在每个PlantUML进程自己的进程组中运行它，
+// 进程ID就是进程组ID。正常退出时结束所有仍在运行的进程组；程序崩溃时这些进程、临时目录和套接字不会被清理，
+// 下次启动时根据上一次遗留的会话文件清理它们。只清理会话文件中记录的临时目录，同时运行的守护模式或命令行导出的目录不受影响
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+)
+
+// TempDirPrefix 是渲染和导出时创建的临时目录的名称前缀，包括 plantuml 和 plantuml-export。
+// 清理时只删除名称以它开头的目录，会话文件被改坏时也不会删除其他目录
+const TempDirPrefix = "plantuml"
+
+// Session 是当前实例的会话文件：存在说明实例正在运行，正常退出时删除。
+// 文件的修改时间是会话开始的时间，每行记录一个正在运行的渲染进程ID或者一个仍在使用的临时目录（绝对路径）
+type Session struct {
+	path    string
+	started time.Time
+
+	mu   sync.Mutex
+	pids map[int]bool
+	dirs map[string]bool
+}
+
+// Start 创建path上的会话文件，已经存在的文件会被覆盖，调用前应先用Crashed检查上一次会话
+func Start(path string) (*Session, error) {
+	s := &Session{path: path, started: time.Now(), pids: make(map[int]bool), dirs: make(map[string]bool)}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Run 启动命令并记录它的进程ID，命令结束后删除记录，可以用作render.RunCommand
+func (s *Session) Run(cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	s.track(cmd.Process.Pid, true)
+	defer s.track(cmd.Process.Pid, false)
+	return cmd.Wait()
+}
+
+// track 添加或删除进程ID的记录，并写入会话文件
+func (s *Session) track(pid int, running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pids == nil {
+		// 会话已经结束
+		return
+	}
+	if running {
+		s.pids[pid] = true
+	} else {
+		delete(s.pids, pid)
+	}
+	if err := s.save(); err != nil {
+		log.Printf("无法更新会话文件: %v", err)
+	}
+}
+
+// MakeTempDir 创建临时目录并记录在会话文件中，可以用作render.MakeTempDir
+func (s *Session) MakeTempDir(prefix string) (string, error) {
+	dir, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		return "", err
+	}
+	s.trackDir(dir, true)
+	return dir, nil
+}
+
+// RemoveTempDir 删除临时目录并删除记录，可以用作render.RemoveTempDir
+func (s *Session) RemoveTempDir(dir string) error {
+	err := os.RemoveAll(dir)
+	s.trackDir(dir, false)
+	return err
+}
+
+// trackDir 添加或删除临时目录的记录，并写入会话文件
+func (s *Session) trackDir(dir string, inUse bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pids == nil {
+		// 会话已经结束
+		return
+	}
+	if inUse {
+		s.dirs[dir] = true
+	} else {
+		delete(s.dirs, dir)
+	}
+	if err := s.save(); err != nil {
+		log.Printf("无法更新会话文件: %v", err)
+	}
+}
+
+// save 写入会话文件，保持文件的修改时间为会话开始的时间。调用方需要持有锁（Start时除外）
+func (s *Session) save() error {
+	pids := make([]int, 0, len(s.pids))
+	for pid := range s.pids {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	dirs := make([]string, 0, len(s.dirs))
+	for dir := range s.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	var b strings.Builder
+	for _, pid := range pids {
+		fmt.Fprintf(&b, "%d\n", pid)
+	}
+	for _, dir := range dirs {
+		fmt.Fprintf(&b, "%s\n", dir)
+	}
+	if err := ioutil.WriteFile(s.path, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("无法写入会话文件: %v", err)
+	}
+	return os.Chtimes(s.path, s.started, s.started)
+}
+
+// End 结束仍在运行的渲染进程组并删除会话文件，表示正常退出，可以安全地多次调用，s为nil时什么也不做
+func (s *Session) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pids == nil {
+		return
+	}
+	for pid := range s.pids {
+		log.Printf("结束仍在运行的渲染进程组 %d", pid)
+		render.KillProcessGroup(pid)
+	}
+	s.pids = nil
+	s.dirs = nil
+	os.Remove(s.path)
+}
+
+// Previous 是上一次没有正常退出的会话遗留的信息
+type Previous struct {
+	Started  time.Time // 会话开始的时间
+	PIDs     []int     // 崩溃时正在运行的渲染进程组
+	TempDirs []string  // 崩溃时仍在使用的临时目录
+}
+
+// Crashed 读取上一次会话遗留的会话文件，文件不存在时返回false。
+// 调用方需要先确认没有实例持有锁文件，否则会话文件属于正在运行的实例
+func Crashed(path string) (*Previous, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false
+	}
+
+	prev := &Previous{Started: info.ModTime()}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if pid, err := strconv.Atoi(line); err == nil && pid > 0 {
+			prev.PIDs = append(prev.PIDs, pid)
+		} else if filepath.IsAbs(line) {
+			prev.TempDirs = append(prev.TempDirs, line)
+		}
+	}
+	return prev, true
+}
+
+// Cleanup 清理上一次会话遗留的资源：结束仍在运行的渲染进程组，删除会话文件中记录的临时目录，
+// 删除sockets中的套接字文件。返回清理的项目，用于记录日志
+func (p *Previous) Cleanup(sockets []string) []string {
+	var cleaned []string
+	groups := renderGroups()
+	for _, pid := range p.PIDs {
+		if groups[pid] && render.KillProcessGroup(pid) == nil {
+			cleaned = append(cleaned, fmt.Sprintf("渲染进程组 %d", pid))
+		}
+	}
+
+	for _, dir := range p.TempDirs {
+		if !strings.HasPrefix(filepath.Base(dir), TempDirPrefix) {
+			continue
+		}
+		if info, err := os.Lstat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("无法删除临时目录: %v", err)
+			continue
+		}
+		cleaned = append(cleaned, "临时目录 "+filepath.Base(dir))
+	}
+
+	for _, socket := range sockets {
+		if info, err := os.Lstat(socket); err == nil && info.Mode()&os.ModeSocket != 0 && os.Remove(socket) == nil {
+			cleaned = append(cleaned, "套接字 "+filepath.Base(socket))
+		}
+	}
+	return cleaned
+}
+
+// renderGroups 返回包含PlantUML进程的进程组。进程组的组长（例如plantuml脚本）可能已经结束，只剩下java进程，
+// 只结束仍然包含PlantUML进程的组，避免进程ID被其他程序重新使用时误杀
+func renderGroups() map[int]bool {
+	groups := make(map[int]bool)
+	output, err := exec.Command("ps", "-axo", "pgid=,command=").Output()
+	if err != nil {
+		log.Printf("无法列出进程: %v", err)
+		return groups
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.Contains(strings.ToLower(line), "plantuml") {
+			continue
+		}
+		if pgid, err := strconv.Atoi(fields[0]); err == nil {
+			groups[pgid] = true
+		}
+	}
+	return groups
+}
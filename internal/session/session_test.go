@@ -0,0 +1,170 @@
+package session
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSessionTracksRunningProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "viewer.session")
+	s, err := Start(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("sh", "-c", "sleep 0.3")
+	done := make(chan error)
+	go func() { done <- s.Run(cmd) }()
+
+	var recorded []int
+	deadline := time.Now().Add(2 * time.Second)
+	for len(recorded) == 0 && time.Now().Before(deadline) {
+		if prev, ok := Crashed(path); ok {
+			recorded = prev.PIDs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != 1 || recorded[0] != cmd.Process.Pid {
+		t.Fatalf("会话文件应记录正在运行的渲染进程 %d，得到 %v", cmd.Process.Pid, recorded)
+	}
+	if prev, ok := Crashed(path); !ok || len(prev.PIDs) != 0 {
+		t.Errorf("进程结束后应删除记录，得到 %+v", prev)
+	}
+
+	s.End()
+	if _, ok := Crashed(path); ok {
+		t.Error("正常结束后不应留下会话文件")
+	}
+	s.End()
+}
+
+func TestSessionTracksTempDirs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "viewer.session")
+	s, err := Start(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.End()
+
+	dir, err := s.MakeTempDir(TempDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev, ok := Crashed(path); !ok || !reflect.DeepEqual(prev.TempDirs, []string{dir}) {
+		t.Fatalf("会话文件应记录创建的临时目录 %s，得到 %+v", dir, prev)
+	}
+	if err := s.RemoveTempDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("RemoveTempDir应删除临时目录")
+	}
+	if prev, ok := Crashed(path); !ok || len(prev.TempDirs) != 0 {
+		t.Errorf("删除后应删除记录，得到 %+v", prev)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	tempDir := t.TempDir()
+	mkdir := func(name string) string {
+		dir := filepath.Join(tempDir, name)
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	leftover := mkdir("plantuml123")
+	// 同时运行的守护模式或命令行导出创建的目录，没有记录在会话文件中
+	concurrent := mkdir("plantuml-export456")
+	other := mkdir("other")
+
+	socket := filepath.Join(tempDir, "viewer.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟崩溃：套接字文件留在磁盘上
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	orphan := exec.Command("sh", "-c", "sleep 30; : plantuml")
+	orphan.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := orphan.Start(); err != nil {
+		t.Fatal(err)
+	}
+	unrelated := exec.Command("sleep", "30")
+	if err := unrelated.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer unrelated.Process.Kill()
+	time.Sleep(50 * time.Millisecond)
+
+	prev := &Previous{
+		Started:  time.Now().Add(-time.Hour),
+		PIDs:     []int{orphan.Process.Pid, unrelated.Process.Pid},
+		TempDirs: []string{leftover, other, filepath.Join(tempDir, "plantuml-missing")},
+	}
+	cleaned := prev.Cleanup([]string{socket, filepath.Join(tempDir, "missing.sock")})
+	want := []string{"渲染进程组 " + strconv.Itoa(orphan.Process.Pid), "临时目录 plantuml123", "套接字 viewer.sock"}
+	if !reflect.DeepEqual(cleaned, want) {
+		t.Errorf("Cleanup = %q，应为 %q", cleaned, want)
+	}
+
+	if err := orphan.Wait(); err == nil {
+		t.Error("遗留的PlantUML进程应被结束")
+	}
+	for _, dir := range []string{concurrent, other} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("%s 不应被删除", filepath.Base(dir))
+		}
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Error("上一次会话记录的临时目录应被删除")
+	}
+}
+
+func TestEndKillsRunningGroups(t *testing.T) {
+	s, err := Start(filepath.Join(t.TempDir(), "viewer.session"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("sleep", "30")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	done := make(chan error)
+	go func() { done <- s.Run(cmd) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.Lock()
+		running := len(s.pids)
+		s.mu.Unlock()
+		if running == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("渲染进程没有被记录")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.End()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("退出时仍在运行的渲染进程应被结束")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("退出时应结束仍在运行的渲染进程")
+	}
+}
@@ -0,0 +1,158 @@
+// Package undo 保存编辑区的多级撤销历史。每个文件的历史是一串完整的文本版本，
+// 以JSON保存在数据目录中，重新启动后仍然可以撤销之前在查看器中所做的修改
+package undo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// MaxSteps 是每个文件最多保留的版本数，超过时丢弃最早的版本
+const MaxSteps = 200
+
+// MaxBytes 是每个文件的历史中所有版本的最大总大小，超过时丢弃最早的版本，至少保留当前版本
+const MaxBytes = 4 << 20
+
+// History 是一个文件的撤销历史：Steps中按时间顺序保存各个版本，Current是当前版本的位置，
+// 它之后的版本可以重做。历史保存在dir中以文件路径的摘要命名的文件里
+type History struct {
+	Path    string   `json:"path"`
+	Steps   []string `json:"steps"`
+	Current int      `json:"current"`
+
+	dir string
+}
+
+// Load 读取path在dir中保存的撤销历史，没有保存过或无法读取时返回空的历史
+func Load(dir, path string) *History {
+	h := &History{Path: path, dir: dir}
+	data, err := ioutil.ReadFile(h.file())
+	if err != nil {
+		return h
+	}
+	var saved History
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Path != path || len(saved.Steps) == 0 ||
+		saved.Current < 0 || saved.Current >= len(saved.Steps) {
+		return h
+	}
+	h.Steps, h.Current = saved.Steps, saved.Current
+	return h
+}
+
+// file 返回保存历史的文件，以路径的摘要命名，路径中的字符不会影响文件名
+func (h *History) file() string {
+	sum := sha256.Sum256([]byte(h.Path))
+	return filepath.Join(h.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// Record 把text记录为新的当前版本，丢弃可以重做的版本；与当前版本相同时不记录，返回false
+func (h *History) Record(text string) bool {
+	if len(h.Steps) > 0 && h.Steps[h.Current] == text {
+		return false
+	}
+	if len(h.Steps) > 0 {
+		h.Steps = h.Steps[:h.Current+1]
+	}
+	h.Steps = append(h.Steps, text)
+	h.trim()
+	h.Current = len(h.Steps) - 1
+	return true
+}
+
+// trim 丢弃最早的版本，直到版本数和总大小都不超过限制
+func (h *History) trim() {
+	size := 0
+	for _, step := range h.Steps {
+		size += len(step)
+	}
+	drop := 0
+	for drop < len(h.Steps)-1 && (len(h.Steps)-drop > MaxSteps || size > MaxBytes) {
+		size -= len(h.Steps[drop])
+		drop++
+	}
+	h.Steps = append([]string(nil), h.Steps[drop:]...)
+}
+
+// CanUndo 返回是否有更早的版本
+func (h *History) CanUndo() bool {
+	return h.Current > 0
+}
+
+// CanRedo 返回是否有撤销后可以重做的版本
+func (h *History) CanRedo() bool {
+	return h.Current < len(h.Steps)-1
+}
+
+// Undo 回到上一个版本并返回它的内容，没有更早的版本时返回false
+func (h *History) Undo() (string, bool) {
+	if !h.CanUndo() {
+		return "", false
+	}
+	h.Current--
+	return h.Steps[h.Current], true
+}
+
+// Redo 前进到撤销前的下一个版本并返回它的内容，没有可以重做的版本时返回false
+func (h *History) Redo() (string, bool) {
+	if !h.CanRedo() {
+		return "", false
+	}
+	h.Current++
+	return h.Steps[h.Current], true
+}
+
+// Save 把历史写入数据目录，先写入临时文件再改名，写到一半时崩溃不会损坏原来的历史
+func (h *History) Save() error {
+	if err := os.MkdirAll(h.dir, 0700); err != nil {
+		return fmt.Errorf("无法创建撤销历史目录: %v", err)
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("无法序列化撤销历史: %v", err)
+	}
+	tmp, err := ioutil.TempFile(h.dir, "history-*.tmp")
+	if err != nil {
+		return fmt.Errorf("无法保存撤销历史: %v", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), h.file())
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("无法保存撤销历史: %v", err)
+	}
+	return nil
+}
+
+// Rename 把历史改为属于path，例如草稿另存为文件后，删除原来路径的历史
+func (h *History) Rename(path string) error {
+	if path == h.Path {
+		return h.Save()
+	}
+	old := h.file()
+	h.Path = path
+	if err := h.Save(); err != nil {
+		return err
+	}
+	if err := os.Remove(old); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("无法删除撤销历史: %v", err)
+	}
+	return nil
+}
+
+// Remove 删除保存的历史，例如关闭不再需要的草稿时
+func (h *History) Remove() error {
+	if err := os.Remove(h.file()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("无法删除撤销历史: %v", err)
+	}
+	return nil
+}
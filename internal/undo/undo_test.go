@@ -0,0 +1,80 @@
+package undo
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	h := Load(dir, "/docs/a.puml")
+	if h.CanUndo() || h.CanRedo() {
+		t.Fatal("新的历史不应可以撤销或重做")
+	}
+	for _, text := range []string{"v1", "v2", "v2", "v3"} {
+		h.Record(text)
+	}
+	if len(h.Steps) != 3 {
+		t.Fatalf("与当前版本相同的内容不应记录，得到 %q", h.Steps)
+	}
+
+	if text, ok := h.Undo(); !ok || text != "v2" {
+		t.Fatalf("撤销应回到 v2，得到 %q %v", text, ok)
+	}
+	if text, ok := h.Redo(); !ok || text != "v3" {
+		t.Fatalf("重做应回到 v3，得到 %q %v", text, ok)
+	}
+	if _, ok := h.Redo(); ok {
+		t.Error("没有可以重做的版本时应返回false")
+	}
+
+	// 撤销后记录新版本时丢弃可以重做的版本
+	h.Undo()
+	h.Record("v2b")
+	if h.CanRedo() || strings.Join(h.Steps, ",") != "v1,v2,v2b" {
+		t.Errorf("撤销后编辑应丢弃重做的版本，得到 %q", h.Steps)
+	}
+
+	// 保存后重新读取，撤销的位置不变
+	h.Undo()
+	if err := h.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded := Load(dir, "/docs/a.puml")
+	if loaded.Current != 1 || !loaded.CanRedo() || len(loaded.Steps) != 3 {
+		t.Errorf("重新读取的历史应与保存时相同，得到 %+v", loaded)
+	}
+	if other := Load(dir, "/docs/b.puml"); len(other.Steps) != 0 {
+		t.Error("其他文件不应读到这个文件的历史")
+	}
+
+	// 改名后历史属于新路径，原路径的历史被删除
+	if err := loaded.Rename("/docs/c.puml"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if len(Load(dir, "/docs/a.puml").Steps) != 0 || len(Load(dir, "/docs/c.puml").Steps) != 3 {
+		t.Error("改名后历史应只属于新路径")
+	}
+	if err := loaded.Remove(); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Errorf("删除后不应留下文件，得到 %v", files)
+	}
+}
+
+func TestHistoryLimits(t *testing.T) {
+	h := Load(t.TempDir(), "/a.puml")
+	for i := 0; i < MaxSteps+10; i++ {
+		h.Record(strings.Repeat("x", i+1))
+	}
+	if len(h.Steps) != MaxSteps || h.Steps[len(h.Steps)-1] != strings.Repeat("x", MaxSteps+10) {
+		t.Errorf("应只保留最新的 %d 个版本，得到 %d 个", MaxSteps, len(h.Steps))
+	}
+
+	h.Record(strings.Repeat("y", MaxBytes))
+	if len(h.Steps) != 1 || h.Current != 0 {
+		t.Errorf("超过总大小时应丢弃较早的版本，只保留当前版本，得到 %d 个", len(h.Steps))
+	}
+}
@@ -0,0 +1,134 @@
+package watch
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+// Glob 监控匹配模式的所有文件，修改时间最新的文件变化时通知调用方，
+// 用于跟随不断生成带时间戳的新文件的流程
+type Glob struct {
+	Interval time.Duration // 检查间隔
+
+	pattern string
+
+	mu      sync.Mutex
+	current string // 最近一次找到的最新文件
+	paused  bool   // 暂停时Run不检查
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewGlob 创建监控，pattern使用filepath.Match的语法
+func NewGlob(pattern string) *Glob {
+	return &Glob{
+		Interval: DefaultInterval,
+		pattern:  pattern,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Pattern 返回监控的匹配模式
+func (g *Glob) Pattern() string {
+	return g.pattern
+}
+
+// Current 返回最近一次找到的最新文件，还没有找到时返回空字符串
+func (g *Glob) Current() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.current
+}
+
+// SetPaused 暂停或恢复Run中的检查
+func (g *Glob) SetPaused(paused bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.paused = paused
+}
+
+// Check 立即查找一次最新的匹配文件，与上次不同时返回它和true
+func (g *Glob) Check() (string, bool, error) {
+	newest, err := Newest(g.pattern)
+	if err != nil {
+		return "", false, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if newest == g.current {
+		return "", false, nil
+	}
+	g.current = newest
+	return newest, true, nil
+}
+
+// Run 每隔Interval查找一次最新的匹配文件，变化时调用onChange，直到调用Stop为止
+func (g *Glob) Run(onChange func(path string)) {
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+
+	log.Printf("开始跟随匹配 %s 的最新文件", logging.Path(g.pattern))
+
+	for {
+		select {
+		case <-ticker.C:
+			g.mu.Lock()
+			paused := g.paused
+			g.mu.Unlock()
+			if paused {
+				continue
+			}
+
+			newest, changed, err := g.Check()
+			if err != nil || !changed {
+				continue
+			}
+			log.Printf("匹配 %s 的最新文件变为: %s", logging.Path(g.pattern), logging.Path(newest))
+			onChange(newest)
+		case <-g.stop:
+			log.Printf("停止跟随匹配 %s 的文件", logging.Path(g.pattern))
+			return
+		}
+	}
+}
+
+// Stop 停止Run，可以安全地多次调用
+func (g *Glob) Stop() {
+	g.stopOnce.Do(func() {
+		close(g.stop)
+	})
+}
+
+// Newest 返回匹配pattern的文件中修改时间最新的一个，修改时间相同时取文件名较大的
+func Newest(pattern string) (string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", fmt.Errorf("匹配模式格式错误: %v", err)
+	}
+
+	var newest string
+	var newestTime time.Time
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) ||
+			(info.ModTime().Equal(newestTime) && match > newest) {
+			newest = match
+			newestTime = info.ModTime()
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("没有匹配 %s 的文件", pattern)
+	}
+	return newest, nil
+}
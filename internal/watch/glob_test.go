@@ -0,0 +1,75 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewest(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, filepath.Join(dir, "latest-1.puml"), "1", start)
+	writeFile(t, filepath.Join(dir, "latest-2.puml"), "2", start.Add(time.Minute))
+	writeFile(t, filepath.Join(dir, "other.puml"), "x", start.Add(time.Hour))
+	if err := os.Mkdir(filepath.Join(dir, "latest-dir.puml"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Newest(filepath.Join(dir, "latest-*.puml"))
+	if err != nil {
+		t.Fatalf("Newest: %v", err)
+	}
+	if want := filepath.Join(dir, "latest-2.puml"); got != want {
+		t.Fatalf("Newest = %s，期望 %s", got, want)
+	}
+
+	// 修改时间相同时取文件名较大的
+	writeFile(t, filepath.Join(dir, "latest-3.puml"), "3", start.Add(time.Minute))
+	got, _ = Newest(filepath.Join(dir, "latest-*.puml"))
+	if want := filepath.Join(dir, "latest-3.puml"); got != want {
+		t.Fatalf("Newest = %s，期望 %s", got, want)
+	}
+
+	if _, err := Newest(filepath.Join(dir, "missing-*.puml")); err == nil {
+		t.Fatal("没有匹配的文件时应返回错误")
+	}
+	if _, err := Newest(filepath.Join(dir, "[")); err == nil {
+		t.Fatal("匹配模式格式错误时应返回错误")
+	}
+}
+
+func TestGlobRunFollowsNewest(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	first := filepath.Join(dir, "latest-1.puml")
+	writeFile(t, first, "1", start)
+
+	g := NewGlob(filepath.Join(dir, "latest-*.puml"))
+	g.Interval = 5 * time.Millisecond
+	if newest, changed, err := g.Check(); err != nil || !changed || newest != first {
+		t.Fatalf("第一次Check = %s, %v, %v", newest, changed, err)
+	}
+	if _, changed, _ := g.Check(); changed {
+		t.Fatal("没有新文件时不应报告变化")
+	}
+
+	changes := make(chan string, 1)
+	go g.Run(func(path string) { changes <- path })
+	defer g.Stop()
+
+	second := filepath.Join(dir, "latest-2.puml")
+	writeFile(t, second, "2", start.Add(time.Minute))
+	select {
+	case path := <-changes:
+		if path != second {
+			t.Fatalf("应切换到 %s，得到 %s", second, path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("出现更新的文件后没有收到通知")
+	}
+	if g.Current() != second {
+		t.Fatalf("Current() = %s，期望 %s", g.Current(), second)
+	}
+}
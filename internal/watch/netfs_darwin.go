@@ -0,0 +1,30 @@
+package watch
+
+import "syscall"
+
+// networkFSTypes 是macOS上网络文件系统的名称（statfs的f_fstypename）
+var networkFSTypes = map[string]bool{
+	"nfs":     true,
+	"smbfs":   true,
+	"afpfs":   true,
+	"webdav":  true,
+	"cifs":    true,
+	"osxfuse": true,
+	"macfuse": true,
+}
+
+// IsNetworkPath 判断path是否位于NFS、SMB等网络文件系统上，无法判断时返回false
+func IsNetworkPath(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	name := make([]byte, 0, len(st.Fstypename))
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return networkFSTypes[string(name)]
+}
@@ -0,0 +1,22 @@
+package watch
+
+import "syscall"
+
+// networkFSTypes 是网络文件系统的statfs类型（f_type），见statfs(2)
+var networkFSTypes = map[uint32]bool{
+	0x6969:     true, // NFS
+	0x517B:     true, // SMB
+	0xFF534D42: true, // CIFS
+	0xFE534D42: true, // SMB2
+	0x5346414F: true, // AFS
+	0x65735546: true, // FUSE（sshfs等）
+}
+
+// IsNetworkPath 判断path是否位于NFS、SMB等网络文件系统上，无法判断时返回false
+func IsNetworkPath(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	return networkFSTypes[uint32(st.Type)]
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package watch
+
+// IsNetworkPath 目前只支持Linux和macOS，其他平台返回false
+func IsNetworkPath(path string) bool {
+	return false
+}
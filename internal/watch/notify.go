@@ -0,0 +1,139 @@
+package watch
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+// notifier 是所有File共用的fsnotify监控。监控的是文件所在的目录而不是文件本身：编辑器通常先写入临时文件再改名，
+// 直接监控文件会在第一次保存后失效。目录按引用计数监控，同一目录中的多个文件只占用一个监控
+type notifier struct {
+	w *fsnotify.Watcher
+
+	mu    sync.Mutex
+	dirs  map[string]int                // 监控的目录和监控其中文件的File数
+	files map[string]map[*File]struct{} // 文件路径和关心它的File
+	subs  map[*File][]string            // 每个File关心的文件路径（文件本身和引用的文件）
+}
+
+var (
+	sharedOnce     sync.Once
+	sharedNotifier *notifier
+)
+
+// shared 返回共用的fsnotify监控，第一次调用时创建。系统不支持或无法创建时返回nil，调用方改为轮询
+func shared() *notifier {
+	sharedOnce.Do(func() {
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Printf("无法使用文件系统通知，改为轮询检查文件: %v", err)
+			return
+		}
+		sharedNotifier = &notifier{
+			w:     w,
+			dirs:  make(map[string]int),
+			files: make(map[string]map[*File]struct{}),
+			subs:  make(map[*File][]string),
+		}
+		go sharedNotifier.run()
+	})
+	return sharedNotifier
+}
+
+// run 把fsnotify的事件转发给关心该文件的File，不会返回
+func (n *notifier) run() {
+	for {
+		select {
+		case e, ok := <-n.w.Events:
+			if !ok {
+				return
+			}
+			n.mu.Lock()
+			for f := range n.files[filepath.Clean(e.Name)] {
+				f.notify()
+			}
+			n.mu.Unlock()
+		case err, ok := <-n.w.Errors:
+			if !ok {
+				return
+			}
+			// 事件队列溢出等错误可能丢失事件，通知所有文件重新检查一次
+			log.Printf("文件系统通知出错: %v", err)
+			n.mu.Lock()
+			for f := range n.subs {
+				f.notify()
+			}
+			n.mu.Unlock()
+		}
+	}
+}
+
+// subscribe 让f接收paths中文件的变化，替换f之前关心的文件。paths[0]是f监控的文件，无法监控它所在的目录时返回错误，
+// f之前关心的文件保持不变，调用方应改为轮询；其余为引用的文件，所在的目录不存在等无法监控时跳过，它们的变化在文件本身变化时才被发现
+func (n *notifier) subscribe(f *File, paths []string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var watched []string
+	for i, path := range paths {
+		path = filepath.Clean(path)
+		dir := filepath.Dir(path)
+		if n.dirs[dir] == 0 {
+			if err := n.w.Add(dir); err != nil {
+				if i > 0 {
+					continue
+				}
+				return err
+			}
+		}
+		n.dirs[dir]++
+		watched = append(watched, path)
+	}
+	n.remove(f)
+	for _, path := range watched {
+		if n.files[path] == nil {
+			n.files[path] = make(map[*File]struct{})
+		}
+		n.files[path][f] = struct{}{}
+	}
+	n.subs[f] = watched
+	return nil
+}
+
+// unsubscribe 不再向f转发变化，不再需要的目录停止监控
+func (n *notifier) unsubscribe(f *File) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.remove(f)
+}
+
+// remove 删除f关心的文件，需要持有n.mu
+func (n *notifier) remove(f *File) {
+	for _, path := range n.subs[f] {
+		delete(n.files[path], f)
+		if len(n.files[path]) == 0 {
+			delete(n.files, path)
+		}
+		n.release(filepath.Dir(path))
+	}
+	delete(n.subs, f)
+}
+
+// release 减少目录的引用计数，没有文件需要时停止监控该目录，需要持有n.mu
+func (n *notifier) release(dir string) {
+	n.dirs[dir]--
+	if n.dirs[dir] > 0 {
+		return
+	}
+	delete(n.dirs, dir)
+	// 目录被删除时fsnotify已经自动停止监控
+	if err := n.w.Remove(dir); err != nil && !errors.Is(err, fsnotify.ErrNonExistentWatch) {
+		log.Printf("无法停止监控目录 %s: %v", logging.Path(dir), err)
+	}
+}
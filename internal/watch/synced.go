@@ -0,0 +1,89 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultSyncInterval 是同步文件夹中的文件默认的检查间隔。同步工具通常几秒内同步一次，
+// 检查过于频繁只会读到更多中间状态
+const DefaultSyncInterval = 3 * time.Second
+
+// SyncProvider 返回path所在的同步文件夹的同步工具（Dropbox、Syncthing、iCloud、OneDrive、GoogleDrive等），
+// 不在同步文件夹中时返回空字符串。按macOS上的同步目录和各工具在同步文件夹根目录中留下的标记文件判断
+func SyncProvider(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	slash := filepath.ToSlash(abs)
+	if strings.Contains(slash, "/Library/Mobile Documents/") {
+		return "iCloud"
+	}
+	// macOS的文件提供程序目录：~/Library/CloudStorage/Dropbox、OneDrive-公司名、GoogleDrive-帐号等
+	if i := strings.Index(slash, "/Library/CloudStorage/"); i >= 0 {
+		name := strings.SplitN(slash[i+len("/Library/CloudStorage/"):], "/", 2)[0]
+		return strings.SplitN(name, "-", 2)[0]
+	}
+	markers := []struct{ name, provider string }{
+		{".stfolder", "Syncthing"},
+		{".dropbox", "Dropbox"},
+		{".dropbox.cache", "Dropbox"},
+	}
+	for dir := filepath.Dir(abs); ; {
+		for _, m := range markers {
+			if _, err := os.Lstat(filepath.Join(dir, m.name)); err == nil {
+				return m.provider
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Conflicts 返回同步工具为path生成的冲突副本，按文件名排序：Dropbox的
+// “flow (某人's conflicted copy 2024-05-01).puml”和Syncthing的“flow.sync-conflict-20240501-120000-设备.puml”
+func Conflicts(path string) []string {
+	dir, base := filepath.Split(path)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	var copies []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || name == base || !strings.HasPrefix(name, stem) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		middle := strings.TrimSuffix(strings.TrimPrefix(name, stem), ext)
+		dropbox := strings.HasPrefix(middle, " (") && strings.HasSuffix(middle, ")") && strings.Contains(middle, "conflicted copy")
+		syncthing := strings.HasPrefix(middle, ".sync-conflict-")
+		if dropbox || syncthing {
+			copies = append(copies, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(copies)
+	return copies
+}
+
+// equalStrings 判断两个字符串切片是否相同
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChecksumDetectsChangeWithOldModTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.puml")
+	old := time.Now().Add(-time.Hour)
+	writeFile(t, path, "@startuml\nA -> B\n@enduml\n", old)
+	f := New(path, "@startuml\nA -> B\n@enduml\n")
+
+	// 同步工具写入其他电脑上的内容，保留了原来的修改时间，大小也相同
+	writeFile(t, path, "@startuml\nA -> C\n@enduml\n", old)
+	if _, changed, _ := f.Check(); changed {
+		t.Fatal("不比较内容时，大小和修改时间没变就不应报告变化")
+	}
+	f.Checksum = true
+	if content, changed, err := f.Check(); err != nil || !changed || content != "@startuml\nA -> C\n@enduml\n" {
+		t.Fatalf("Check() = %q, %v, %v", content, changed, err)
+	}
+}
+
+func TestConfirmWaitsForStableContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.puml")
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, path, "v1", start)
+	f := New(path, "v1")
+	f.UseSyncPolling(time.Second)
+
+	writeFile(t, path, "v2", start.Add(time.Minute))
+	if _, changed, _ := f.Check(); changed {
+		t.Fatal("第一次读到新内容时不应报告变化")
+	}
+	// 同步工具紧接着写入了更新的版本，重新等待确认
+	writeFile(t, path, "v3", start.Add(2*time.Minute))
+	if _, changed, _ := f.Check(); changed {
+		t.Fatal("内容再次变化时不应报告变化")
+	}
+	if content, changed, _ := f.Check(); !changed || content != "v3" {
+		t.Fatalf("内容稳定后应报告变化，得到 %q, %v", content, changed)
+	}
+	if _, changed, _ := f.Check(); changed {
+		t.Fatal("报告过的内容不应再次报告")
+	}
+}
+
+func TestSyncProvider(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "team", "docs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "flow.puml")
+	if got := SyncProvider(file); got != "" {
+		t.Fatalf("普通目录中的文件不应在同步文件夹中，得到 %s", got)
+	}
+	if err := os.Mkdir(filepath.Join(root, ".stfolder"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := SyncProvider(file); got != "Syncthing" {
+		t.Fatalf("SyncProvider() = %q，期望 Syncthing", got)
+	}
+	if got := SyncProvider("/Users/a/Library/CloudStorage/OneDrive-Contoso/docs/flow.puml"); got != "OneDrive" {
+		t.Fatalf("SyncProvider() = %q，期望 OneDrive", got)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for _, name := range []string{
+		"flow.puml",
+		"flow (Alice's conflicted copy 2024-05-01).puml",
+		"flow.sync-conflict-20240501-120000-ABCDEFG.puml",
+		"flow-v2.puml",
+		"flowchart.sync-conflict-20240501-120000-ABCDEFG.puml",
+	} {
+		writeFile(t, filepath.Join(dir, name), "x", now)
+	}
+	want := []string{
+		filepath.Join(dir, "flow (Alice's conflicted copy 2024-05-01).puml"),
+		filepath.Join(dir, "flow.sync-conflict-20240501-120000-ABCDEFG.puml"),
+	}
+	if got := Conflicts(filepath.Join(dir, "flow.puml")); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Conflicts() = %v，期望 %v", got, want)
+	}
+}
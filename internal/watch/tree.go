@@ -0,0 +1,192 @@
+package watch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+// DefaultTreeInterval 是监控整个目录时默认的检查间隔。每次检查都要遍历目录，比单个文件的检查间隔长
+const DefaultTreeInterval = 2 * time.Second
+
+// DiagramExtensions 是在目录中查找图表时识别的扩展名
+var DiagramExtensions = []string{".puml", ".plantuml", ".pu"}
+
+// Tree 监控目录（例如整个仓库）中的所有图表文件，不只是打开的文件。文件出现、消失或内容变化时通知调用方，
+// 只报告每个文件当前内容的摘要，由调用方与上次看过时的摘要比较
+type Tree struct {
+	Interval time.Duration // 检查间隔
+
+	root string
+
+	mu     sync.Mutex
+	files  map[string]treeFile // 最近一次检查时找到的文件，以路径为键
+	paused bool                // 暂停时Run不检查
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// treeFile 是最近一次检查时文件的状态，大小和修改时间都没变时不重新读取内容
+type treeFile struct {
+	size    int64
+	modTime time.Time
+	digest  string
+}
+
+// NewTree 创建监控root中所有图表文件的监控
+func NewTree(root string) *Tree {
+	return &Tree{
+		Interval: DefaultTreeInterval,
+		root:     root,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Root 返回监控的目录
+func (t *Tree) Root() string {
+	return t.root
+}
+
+// SetPaused 暂停或恢复Run中的检查
+func (t *Tree) SetPaused(paused bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.paused = paused
+}
+
+// Digests 返回最近一次检查时每个文件内容的摘要，以路径为键，还没有检查过时返回nil
+func (t *Tree) Digests() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return digestsOf(t.files)
+}
+
+// Check 立即遍历一次目录，返回每个文件内容的摘要，以及与上次检查相比是否有文件出现、消失或变化。
+// 第一次检查总是返回true。跳过以.开头的目录，例如.git
+func (t *Tree) Check() (map[string]string, bool, error) {
+	t.mu.Lock()
+	old := t.files
+	t.mu.Unlock()
+
+	files := make(map[string]treeFile, len(old))
+	changed := old == nil
+	err := filepath.Walk(t.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// 遍历期间删除的文件和没有权限的目录跳过，不影响其他文件
+			if path == t.root {
+				return err
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if path != t.root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !IsDiagram(path) {
+			return nil
+		}
+		f, ok := old[path]
+		if !ok || f.size != info.Size() || !f.modTime.Equal(info.ModTime()) {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			digest := Digest(data)
+			changed = changed || !ok || digest != f.digest
+			f = treeFile{size: info.Size(), modTime: info.ModTime(), digest: digest}
+		}
+		files[path] = f
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("无法遍历目录 %s: %v", t.root, err)
+	}
+	if len(files) != len(old) {
+		changed = true
+	}
+
+	t.mu.Lock()
+	t.files = files
+	t.mu.Unlock()
+	return digestsOf(files), changed, nil
+}
+
+// Run 每隔Interval检查一次目录，有文件出现、消失或变化时用所有文件的摘要调用onChange，直到调用Stop为止
+func (t *Tree) Run(onChange func(digests map[string]string)) {
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+
+	log.Printf("开始监控 %s 中的所有图表", logging.Path(t.root))
+
+	for {
+		select {
+		case <-ticker.C:
+			t.mu.Lock()
+			paused := t.paused
+			t.mu.Unlock()
+			if paused {
+				continue
+			}
+
+			digests, changed, err := t.Check()
+			if err != nil {
+				log.Printf("检查目录失败: %v", err)
+				continue
+			}
+			if changed {
+				onChange(digests)
+			}
+		case <-t.stop:
+			log.Printf("停止监控 %s 中的图表", logging.Path(t.root))
+			return
+		}
+	}
+}
+
+// Stop 停止Run，可以安全地多次调用
+func (t *Tree) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+}
+
+// IsDiagram 判断path的扩展名是否为图表文件（见DiagramExtensions），不区分大小写
+func IsDiagram(path string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range DiagramExtensions {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Digest 返回文件内容的摘要，用于判断文件自上次看过后是否变化
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// digestsOf 返回files中每个文件的摘要
+func digestsOf(files map[string]treeFile) map[string]string {
+	if files == nil {
+		return nil
+	}
+	digests := make(map[string]string, len(files))
+	for path, f := range files {
+		digests[path] = f.digest
+	}
+	return digests
+}
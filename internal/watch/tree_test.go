@@ -0,0 +1,61 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTreeCheck(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	login := filepath.Join(dir, "docs", "login.puml")
+	if err := os.MkdirAll(filepath.Dir(login), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, login, "A -> B", start)
+	writeFile(t, filepath.Join(dir, "README.md"), "readme", start)
+	writeFile(t, filepath.Join(dir, ".git", "stash.puml"), "x", start)
+
+	tree := NewTree(dir)
+	digests, changed, err := tree.Check()
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if !changed || len(digests) != 1 || digests[login] != Digest([]byte("A -> B")) {
+		t.Fatalf("第一次检查应找到docs/login.puml，得到 %v, %v", digests, changed)
+	}
+	if _, changed, _ := tree.Check(); changed {
+		t.Error("没有变化时不应报告变化")
+	}
+
+	// 只改修改时间、内容不变时不算变化
+	writeFile(t, login, "A -> B", start.Add(time.Minute))
+	if _, changed, _ := tree.Check(); changed {
+		t.Error("内容没有变化时不应报告变化")
+	}
+	writeFile(t, login, "A -> C", start.Add(2*time.Minute))
+	if digests, changed, _ := tree.Check(); !changed || digests[login] != Digest([]byte("A -> C")) {
+		t.Errorf("内容变化后应报告新的摘要，得到 %v, %v", digests, changed)
+	}
+
+	billing := filepath.Join(dir, "billing.PU")
+	writeFile(t, billing, "B -> C", start)
+	if digests, changed, _ := tree.Check(); !changed || len(digests) != 2 {
+		t.Errorf("新增文件后应报告变化，得到 %v, %v", digests, changed)
+	}
+	if err := os.Remove(billing); err != nil {
+		t.Fatal(err)
+	}
+	if digests, changed, _ := tree.Check(); !changed || len(digests) != 1 {
+		t.Errorf("删除文件后应报告变化，得到 %v, %v", digests, changed)
+	}
+
+	if _, _, err := NewTree(filepath.Join(dir, "missing")).Check(); err == nil {
+		t.Error("目录不存在时应返回错误")
+	}
+}
@@ -0,0 +1,439 @@
+// Package watch 监控文件的变化，只有文件内容真正改变时才通知调用方。优先使用文件系统通知（fsnotify），
+// 无法使用时以及网络文件系统、同步文件夹中的文件改为轮询。
+package watch
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+const (
+	// DefaultInterval 默认的检查间隔，为了减少CPU使用不宜过于频繁
+	DefaultInterval = 500 * time.Millisecond
+	// DefaultCooldown 默认的刷新冷却时间，即两次通知之间最短的时间间隔
+	DefaultCooldown = 1 * time.Second
+	// DefaultSettleTimeout 默认最多等待正在写入的文件写完的时间
+	DefaultSettleTimeout = 3 * time.Second
+	// NetworkInterval 网络文件系统上的文件的检查间隔，每次检查都要经过网络，不宜过于频繁
+	NetworkInterval = 2 * time.Second
+	// NetworkMaxInterval 网络文件系统上的文件长时间没有变化时，检查间隔最多延长到的时间
+	NetworkMaxInterval = 15 * time.Second
+	// DefaultDebounce 默认收到文件系统通知后等待的时间，编辑器保存一次通常产生多个事件，合并为一次检查
+	DefaultDebounce = 100 * time.Millisecond
+	// DefaultFallbackInterval 使用文件系统通知时默认的兜底检查间隔，防止通知丢失时一直不刷新
+	DefaultFallbackInterval = 5 * time.Second
+)
+
+// File 监控单个文件。先用文件大小和修改时间快速判断，再读取内容确认是否真的变化
+type File struct {
+	Interval time.Duration // 检查间隔
+	Cooldown time.Duration // 两次通知之间最短的时间间隔
+	// MaxInterval 大于Interval时自适应轮询：文件没有变化时检查间隔逐次加倍，最多到MaxInterval，发现变化后恢复为Interval
+	MaxInterval time.Duration
+
+	// Notify 使用文件系统通知代替轮询，系统不支持或无法监控文件所在的目录时自动改为轮询
+	Notify bool
+	// Debounce 收到通知后等待的时间，期间的其他通知合并为一次检查
+	Debounce time.Duration
+	// FallbackInterval 使用通知时兜底检查的间隔
+	FallbackInterval time.Duration
+
+	// Complete 判断读到的内容是否已经写完，返回false时认为文件正在写入，暂不报告变化。为nil时只检查文件大小是否稳定
+	Complete func(content string) bool
+	// SettleTimeout 文件一直没有写完时最多等待的时间，超过后照常报告变化，文件可能本来就不完整
+	SettleTimeout time.Duration
+
+	// Checksum 不用文件大小和修改时间快速判断，每次都读取内容比较校验和。同步工具写入的文件可能保留其他电脑上的修改时间，
+	// 内容变了而大小和修改时间看起来都没变
+	Checksum bool
+	// Confirm 内容变化后要在下一次检查时读到同样的内容才报告，同步工具分几次同步同一个文件时不会每次都刷新
+	Confirm bool
+	// OnConflicts 不为nil时每次检查后查找同步工具生成的冲突副本（见Conflicts），冲突副本变化时调用
+	OnConflicts func(copies []string)
+
+	path string
+
+	mu         sync.Mutex
+	content    string              // 最近一次读到的内容
+	size       int64               // 最近一次检查时的文件大小
+	modTime    time.Time           // 最近一次检查时的修改时间
+	lastChange time.Time           // 最近一次通知的时间
+	paused     bool                // 暂停时Run不检查文件
+	writing    time.Time           // 第一次发现文件正在写入的时间，没有在写入时为零
+	pending    [sha256.Size]byte   // Confirm时等待确认的新内容的校验和
+	deps       map[string]depStamp // 文件引用的其他文件（例如图片）在最近一次检查时的状态
+	conflicts  []string            // 最近一次找到的冲突副本
+	notifier   *notifier           // Run使用文件系统通知时为共用的监控，轮询时为nil
+
+	events   chan struct{} // 文件系统通知，有容量为1的缓冲，未处理的通知只保留一个
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// New 创建文件监控，content是调用方已经读到的文件内容
+func New(path, content string) *File {
+	f := &File{
+		Interval:         DefaultInterval,
+		Cooldown:         DefaultCooldown,
+		SettleTimeout:    DefaultSettleTimeout,
+		Notify:           true,
+		Debounce:         DefaultDebounce,
+		FallbackInterval: DefaultFallbackInterval,
+		path:             path,
+		content:          content,
+		lastChange:       time.Now(),
+		events:           make(chan struct{}, 1),
+		stop:             make(chan struct{}),
+	}
+	if info, err := os.Stat(path); err == nil {
+		f.size = info.Size()
+		f.modTime = info.ModTime()
+	}
+	return f
+}
+
+// UseNetworkPolling 改为适合网络文件系统的自适应轮询，需要在Run之前调用。网络文件系统上其他电脑的修改不会产生通知
+func (f *File) UseNetworkPolling() {
+	f.Notify = false
+	f.Interval = NetworkInterval
+	f.MaxInterval = NetworkMaxInterval
+}
+
+// UseSyncPolling 改为适合同步文件夹的轮询：每隔interval比较一次内容的校验和，新内容在两次检查中一致后才报告，
+// 需要在Run之前调用。同步工具会分几次写入，按固定间隔确认内容比逐个处理通知更可靠
+func (f *File) UseSyncPolling(interval time.Duration) {
+	f.Notify = false
+	f.Interval = interval
+	f.MaxInterval = 0
+	f.Checksum = true
+	f.Confirm = true
+}
+
+// nextInterval 返回下一次检查前等待的时间，current是这一次等待的时间
+func (f *File) nextInterval(current time.Duration, changed bool) time.Duration {
+	if changed || f.MaxInterval <= f.Interval {
+		return f.Interval
+	}
+	if next := current * 2; next < f.MaxInterval {
+		return next
+	}
+	return f.MaxInterval
+}
+
+// depStamp 是引用的文件的状态，文件不存在时exists为false
+type depStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// statDep 返回引用的文件当前的状态
+func statDep(path string) depStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return depStamp{}
+	}
+	return depStamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// SetDependencies 设置文件引用的其他文件，例如图表中的图片。它们出现、消失或变化时Check也报告变化，
+// 返回的内容为文件当前的内容，调用方随之重新渲染。每次重新读取文件后用新的引用调用
+func (f *File) SetDependencies(paths []string) {
+	deps := make(map[string]depStamp, len(paths))
+	for _, path := range paths {
+		deps[path] = statDep(path)
+	}
+	f.mu.Lock()
+	f.deps = deps
+	n := f.notifier
+	f.mu.Unlock()
+	// 同时监控引用的文件，它们变化时也能立即发现
+	if n != nil {
+		if err := n.subscribe(f, f.watchPaths(paths)); err != nil {
+			log.Printf("无法监控文件 %s 引用的文件: %v", logging.Path(f.path), err)
+		}
+	}
+}
+
+// watchPaths 返回使用文件系统通知时需要监控的文件：文件本身和引用的文件
+func (f *File) watchPaths(deps []string) []string {
+	return append([]string{f.path}, deps...)
+}
+
+// depPaths 返回引用的文件的路径
+func (f *File) depPaths() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	paths := make([]string, 0, len(f.deps))
+	for path := range f.deps {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// depsChanged 检查引用的文件是否有变化，并记录它们当前的状态。需要持有f.mu
+func (f *File) depsChanged() bool {
+	changed := false
+	for path, old := range f.deps {
+		if now := statDep(path); now != old {
+			log.Printf("文件 %s 引用的 %s 有变化", logging.Path(f.path), logging.Path(path))
+			f.deps[path] = now
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Path 返回监控的文件路径
+func (f *File) Path() string {
+	return f.path
+}
+
+// SetContent 记录调用方重新读到的文件内容，之后只有与它不同的内容才算变化
+func (f *File) SetContent(content string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.content = content
+}
+
+// SetPaused 暂停或恢复Run中的检查。暂停期间的变化不会丢失，恢复后第一次检查时合并为一次通知
+func (f *File) SetPaused(paused bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paused = paused
+}
+
+// Check 立即检查一次文件，内容有变化时返回新内容和true
+func (f *File) Check() (string, bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", false, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// 引用的图片等变化时，即使文件本身没变也需要重新渲染
+	deps := f.depsChanged()
+
+	// 快速检查：如果文件大小和修改时间都没变，通常内容也没变
+	touched := info.Size() != f.size || info.ModTime().After(f.modTime)
+	if !touched && !f.Checksum {
+		if deps {
+			return f.content, true, nil
+		}
+		return "", false, nil
+	}
+
+	// 文件可能已修改，读取内容确认
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return "", false, err
+	}
+	content := string(data)
+	if content != f.content && !f.settled(info, content) {
+		// 不记录这次的大小和修改时间，下次检查时重新读取
+		return "", false, nil
+	}
+	f.writing = time.Time{}
+	f.size = info.Size()
+	f.modTime = info.ModTime()
+
+	if content == f.content {
+		f.pending = [sha256.Size]byte{}
+		if deps {
+			return content, true, nil
+		}
+		if touched {
+			log.Printf("文件 %s 的修改时间或大小变化，但内容未变，不需刷新", logging.Path(f.path))
+		}
+		return "", false, nil
+	}
+	if f.Confirm {
+		if sum := sha256.Sum256(data); sum != f.pending {
+			log.Printf("文件 %s 的内容有变化，下次检查确认后再刷新", logging.Path(f.path))
+			f.pending = sum
+			return "", false, nil
+		}
+		f.pending = [sha256.Size]byte{}
+	}
+	f.content = content
+	return content, true, nil
+}
+
+// settled 判断文件是否已经写完：读取前后文件大小不变且与读到的内容一致，并且Complete认为内容完整。
+// 编辑器分多次写入较大的文件时，中间状态会被PlantUML当作语法错误。一直没有写完超过SettleTimeout时也视为写完
+func (f *File) settled(before os.FileInfo, content string) bool {
+	after, err := os.Stat(f.path)
+	writing := err == nil && (after.Size() != before.Size() || after.Size() != int64(len(content)))
+	if !writing && (f.Complete == nil || f.Complete(content)) {
+		return true
+	}
+	now := time.Now()
+	if f.writing.IsZero() {
+		log.Printf("文件 %s 可能正在写入，等待写完后再刷新", logging.Path(f.path))
+		f.writing = now
+	}
+	return now.Sub(f.writing) >= f.SettleTimeout
+}
+
+// Run 监控文件，内容变化时调用onChange，直到调用Stop为止。Notify时收到文件系统通知后等待Debounce再检查，
+// 并每隔FallbackInterval兜底检查一次；否则每隔Interval（自适应轮询时见MaxInterval）检查一次。
+// 暂停期间或距上次通知不足Cooldown时暂不检查，变化会在恢复或冷却结束后被发现
+func (f *File) Run(onChange func(content string)) {
+	events := f.subscribe()
+	defer f.unsubscribe()
+
+	// 使用通知时也先按Interval检查一次，发现New之后、开始接收通知之前的变化
+	interval := f.Interval
+	dirty := events != nil // 收到了通知，还没有检查
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	log.Printf("开始监控文件: %s", logging.Path(f.path))
+
+	for {
+		select {
+		case <-timer.C:
+			if events == nil {
+				interval = f.nextInterval(interval, f.poll(onChange))
+				timer.Reset(interval)
+				continue
+			}
+			if dirty && f.waiting() {
+				// 暂停或冷却期间按Interval重试，恢复或冷却结束后尽快处理这次变化
+				timer.Reset(f.Interval)
+				continue
+			}
+			f.poll(onChange)
+			// 文件还没有写完时不会再有通知，按Interval继续检查直到写完
+			if dirty = f.settling(); dirty {
+				timer.Reset(f.Interval)
+			} else {
+				timer.Reset(f.FallbackInterval)
+			}
+		case <-events:
+			dirty = true
+			resetTimer(timer, f.Debounce)
+		case <-f.stop:
+			// 收到停止监控的信号
+			log.Printf("停止监控文件: %s", logging.Path(f.path))
+			return
+		}
+	}
+}
+
+// subscribe 在Notify时开始接收文件和引用的文件的通知，返回通知的通道。不使用或无法使用通知时返回nil，Run改为轮询
+func (f *File) subscribe() <-chan struct{} {
+	if !f.Notify {
+		return nil
+	}
+	n := shared()
+	if n == nil {
+		return nil
+	}
+	if err := n.subscribe(f, f.watchPaths(f.depPaths())); err != nil {
+		log.Printf("无法监控文件 %s 的变化，改为轮询: %v", logging.Path(f.path), err)
+		return nil
+	}
+	f.mu.Lock()
+	f.notifier = n
+	f.mu.Unlock()
+	return f.events
+}
+
+// unsubscribe 停止接收通知
+func (f *File) unsubscribe() {
+	f.mu.Lock()
+	n := f.notifier
+	f.notifier = nil
+	f.mu.Unlock()
+	if n != nil {
+		n.unsubscribe(f)
+	}
+}
+
+// notify 报告文件可能有变化，由共用的监控调用，不能阻塞
+func (f *File) notify() {
+	select {
+	case f.events <- struct{}{}:
+	default:
+	}
+}
+
+// resetTimer 停止timer并丢弃已经到期而未读取的值，再重新计时d
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
+
+// waiting 返回是否因为暂停或冷却暂不检查
+func (f *File) waiting() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.paused || time.Since(f.lastChange) <= f.Cooldown
+}
+
+// settling 返回是否在等待正在写入的文件写完
+func (f *File) settling() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.writing.IsZero()
+}
+
+// poll 在没有暂停和冷却时检查一次文件，内容变化时调用onChange，返回是否有变化
+func (f *File) poll(onChange func(content string)) bool {
+	if f.waiting() {
+		return false
+	}
+	if f.OnConflicts != nil {
+		f.checkConflicts()
+	}
+
+	content, changed, err := f.Check()
+	if err != nil {
+		log.Printf("监控文件时出错: %v", err)
+		return false
+	}
+	if !changed {
+		return false
+	}
+
+	log.Printf("文件 %s 内容确实有变化，准备刷新显示", logging.Path(f.path))
+	f.mu.Lock()
+	f.lastChange = time.Now()
+	f.mu.Unlock()
+	onChange(content)
+	return true
+}
+
+// checkConflicts 查找冲突副本，与上次不同时调用OnConflicts
+func (f *File) checkConflicts() {
+	copies := Conflicts(f.path)
+	if equalStrings(copies, f.conflicts) {
+		return
+	}
+	f.conflicts = copies
+	if len(copies) > 0 {
+		log.Printf("文件 %s 有%d个同步冲突副本", logging.Path(f.path), len(copies))
+	}
+	f.OnConflicts(copies)
+}
+
+// Stop 停止Run，可以安全地多次调用
+func (f *File) Stop() {
+	f.stopOnce.Do(func() {
+		close(f.stop)
+	})
+}
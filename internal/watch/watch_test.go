@@ -0,0 +1,280 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile 写入文件并把修改时间设为指定时间，避免依赖文件系统的时间精度
+func writeFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckReportsContentChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.puml")
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, path, "@startuml\nA -> B\n@enduml\n", start)
+
+	f := New(path, "@startuml\nA -> B\n@enduml\n")
+	if _, changed, err := f.Check(); err != nil || changed {
+		t.Fatalf("未修改的文件不应报告变化: changed=%v err=%v", changed, err)
+	}
+
+	writeFile(t, path, "@startuml\nA -> C\n@enduml\n", start.Add(time.Minute))
+	content, changed, err := f.Check()
+	if err != nil || !changed {
+		t.Fatalf("内容修改后应报告变化: changed=%v err=%v", changed, err)
+	}
+	if content != "@startuml\nA -> C\n@enduml\n" {
+		t.Fatalf("返回的内容不正确: %q", content)
+	}
+
+	if _, changed, _ := f.Check(); changed {
+		t.Fatal("同一次修改不应重复报告")
+	}
+}
+
+func TestCheckIgnoresTouchWithoutContentChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.puml")
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, path, "same", start)
+
+	f := New(path, "same")
+	writeFile(t, path, "same", start.Add(time.Minute))
+	if _, changed, err := f.Check(); err != nil || changed {
+		t.Fatalf("只修改时间不应报告变化: changed=%v err=%v", changed, err)
+	}
+}
+
+func TestSetContentSuppressesKnownContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.puml")
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, path, "old", start)
+
+	f := New(path, "old")
+	writeFile(t, path, "new", start.Add(time.Minute))
+	// 调用方已经自己读到了新内容
+	f.SetContent("new")
+	if _, changed, _ := f.Check(); changed {
+		t.Fatal("已通过SetContent记录的内容不应报告变化")
+	}
+}
+
+func TestCheckMissingFile(t *testing.T) {
+	f := New(filepath.Join(t.TempDir(), "missing.puml"), "")
+	if _, _, err := f.Check(); err == nil {
+		t.Fatal("文件不存在时应返回错误")
+	}
+}
+
+func TestCheckWaitsForIncompleteContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.puml")
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, path, "@startuml\nA -> B\n@enduml\n", start)
+
+	f := New(path, "@startuml\nA -> B\n@enduml\n")
+	f.Complete = func(content string) bool { return strings.Contains(content, "@enduml") }
+	f.SettleTimeout = time.Hour
+
+	writeFile(t, path, "@startuml\nA -> C\n", start.Add(time.Minute))
+	if _, changed, err := f.Check(); err != nil || changed {
+		t.Fatalf("文件没有写完时不应报告变化: changed=%v err=%v", changed, err)
+	}
+
+	// 写完后即使修改时间不变也应重新读取
+	writeFile(t, path, "@startuml\nA -> C\n@enduml\n", start.Add(time.Minute))
+	content, changed, err := f.Check()
+	if err != nil || !changed || content != "@startuml\nA -> C\n@enduml\n" {
+		t.Fatalf("文件写完后应报告变化: content=%q changed=%v err=%v", content, changed, err)
+	}
+}
+
+func TestCheckReportsIncompleteContentAfterTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.puml")
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, path, "old", start)
+
+	f := New(path, "old")
+	f.Complete = func(string) bool { return false }
+	f.SettleTimeout = 20 * time.Millisecond
+
+	writeFile(t, path, "new", start.Add(time.Minute))
+	if _, changed, _ := f.Check(); changed {
+		t.Fatal("刚发现文件没有写完时不应报告变化")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if content, changed, err := f.Check(); err != nil || !changed || content != "new" {
+		t.Fatalf("等待超过SettleTimeout后应照常报告变化: content=%q changed=%v err=%v", content, changed, err)
+	}
+}
+
+func TestRunNotifiesAndStops(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.puml")
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, path, "old", start)
+
+	f := New(path, "old")
+	f.Interval = 5 * time.Millisecond
+	f.Cooldown = 0
+
+	changes := make(chan string, 1)
+	done := make(chan struct{})
+	go func() {
+		f.Run(func(content string) { changes <- content })
+		close(done)
+	}()
+
+	writeFile(t, path, "new", start.Add(time.Minute))
+	select {
+	case content := <-changes:
+		if content != "new" {
+			t.Fatalf("通知的内容不正确: %q", content)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("文件变化后没有收到通知")
+	}
+
+	f.Stop()
+	f.Stop() // 多次调用应当安全
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop后Run没有返回")
+	}
+}
+
+func TestRunUsesNotifications(t *testing.T) {
+	if shared() == nil {
+		t.Skip("系统不支持文件系统通知")
+	}
+	path := filepath.Join(t.TempDir(), "a.puml")
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, path, "old", start)
+
+	// 轮询和兜底检查的间隔都很长，只有通知才能及时发现变化
+	f := New(path, "old")
+	f.Interval = time.Hour
+	f.FallbackInterval = time.Hour
+	f.Debounce = 10 * time.Millisecond
+	f.Cooldown = 0
+
+	changes := make(chan string, 1)
+	go f.Run(func(content string) { changes <- content })
+	defer f.Stop()
+
+	// 等待Run开始接收通知
+	time.Sleep(50 * time.Millisecond)
+	writeFile(t, path, "new", start.Add(time.Minute))
+	select {
+	case content := <-changes:
+		if content != "new" {
+			t.Fatalf("通知的内容不正确: %q", content)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("文件变化后没有收到通知")
+	}
+}
+
+func TestRunPausedCoalescesChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.puml")
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, path, "old", start)
+
+	f := New(path, "old")
+	f.Interval = 5 * time.Millisecond
+	f.Cooldown = 0
+	f.SetPaused(true)
+
+	changes := make(chan string, 10)
+	go f.Run(func(content string) { changes <- content })
+	defer f.Stop()
+
+	// 暂停期间的多次修改不应触发通知
+	writeFile(t, path, "v1", start.Add(time.Minute))
+	time.Sleep(30 * time.Millisecond)
+	writeFile(t, path, "v2", start.Add(2*time.Minute))
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case content := <-changes:
+		t.Fatalf("暂停期间不应通知，收到 %q", content)
+	default:
+	}
+
+	// 恢复后合并为一次通知，内容为最新的内容
+	f.SetPaused(false)
+	select {
+	case content := <-changes:
+		if content != "v2" {
+			t.Fatalf("恢复后应通知最新内容，收到 %q", content)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("恢复后没有收到通知")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if len(changes) != 0 {
+		t.Fatalf("恢复后应只通知一次，多收到 %d 次", len(changes))
+	}
+}
+
+func TestNextIntervalAdapts(t *testing.T) {
+	f := New(filepath.Join(t.TempDir(), "a.puml"), "")
+	if got := f.nextInterval(f.Interval, false); got != f.Interval {
+		t.Errorf("没有启用自适应轮询时间隔应保持不变，得到 %v", got)
+	}
+
+	f.UseNetworkPolling()
+	interval := f.Interval
+	for _, want := range []time.Duration{4 * time.Second, 8 * time.Second, NetworkMaxInterval, NetworkMaxInterval} {
+		interval = f.nextInterval(interval, false)
+		if interval != want {
+			t.Fatalf("文件没有变化时间隔应逐次加倍到上限，得到 %v，应为 %v", interval, want)
+		}
+	}
+	if got := f.nextInterval(interval, true); got != NetworkInterval {
+		t.Errorf("发现变化后应恢复为初始间隔，得到 %v", got)
+	}
+}
+
+func TestIsNetworkPathLocalFile(t *testing.T) {
+	if IsNetworkPath(t.TempDir()) {
+		t.Error("本地临时目录不应被识别为网络文件系统")
+	}
+}
+
+func TestCheckReportsDependencyChange(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	path := filepath.Join(dir, "a.puml")
+	icon := filepath.Join(dir, "icon.png")
+	writeFile(t, path, "@startuml\nA -> B : <img:icon.png>\n@enduml\n", start)
+	writeFile(t, icon, "v1", start)
+	f := New(path, "@startuml\nA -> B : <img:icon.png>\n@enduml\n")
+	f.SetDependencies([]string{icon})
+
+	if _, changed, _ := f.Check(); changed {
+		t.Fatal("图片没有变化时不应报告变化")
+	}
+	writeFile(t, icon, "v2-larger", start.Add(time.Minute))
+	if content, changed, err := f.Check(); err != nil || !changed || content != "@startuml\nA -> B : <img:icon.png>\n@enduml\n" {
+		t.Fatalf("图片变化后应报告变化并返回文件当前的内容，得到 %q, %v, %v", content, changed, err)
+	}
+	if _, changed, _ := f.Check(); changed {
+		t.Fatal("报告过的图片变化不应再次报告")
+	}
+	if err := os.Remove(icon); err != nil {
+		t.Fatal(err)
+	}
+	if _, changed, _ := f.Check(); !changed {
+		t.Fatal("图片被删除时应报告变化")
+	}
+}
@@ -0,0 +1,90 @@
+package outline
+
+import "strings"
+
+// Conflict 是从带有git合并冲突标记的源码中拆出的两个版本
+type Conflict struct {
+	Ours        string // 每处冲突都取 <<<<<<< 与 ======= 之间的内容（当前分支）
+	Theirs      string // 每处冲突都取 ======= 与 >>>>>>> 之间的内容（合并进来的分支）
+	OursLabel   string // 第一处冲突 <<<<<<< 后的名称，例如 HEAD，没有时为空
+	TheirsLabel string // 第一处冲突 >>>>>>> 后的名称，例如分支名或提交，没有时为空
+	Count       int    // 冲突的处数
+	Line        int    // 第一处冲突开始的行（从1开始）
+}
+
+// 冲突标记，之后是行尾或空格加名称
+const (
+	conflictStart = "<<<<<<<"
+	conflictBase  = "|||||||" // diff3风格的共同祖先部分，两个版本都不包含
+	conflictSep   = "======="
+	conflictEnd   = ">>>>>>>"
+)
+
+// isMarker 判断line是否以冲突标记marker开头，返回标记后的名称
+func isMarker(line, marker string) (string, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, marker) {
+		return "", false
+	}
+	rest := line[len(marker):]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// ParseConflict 查找源码中的git合并冲突标记，把冲突两边的内容分别与冲突以外的内容拼成两个完整的版本。
+// 支持diff3风格的共同祖先部分。没有冲突或冲突标记不完整时返回false
+func ParseConflict(source string) (Conflict, bool) {
+	const (
+		outside = iota
+		inOurs
+		inBase
+		inTheirs
+	)
+	var c Conflict
+	var ours, theirs strings.Builder
+	state := outside
+	for i, line := range strings.SplitAfter(source, "\n") {
+		switch state {
+		case outside:
+			if label, ok := isMarker(line, conflictStart); ok {
+				state = inOurs
+				c.Count++
+				if c.Count == 1 {
+					c.OursLabel = label
+					c.Line = i + 1
+				}
+				continue
+			}
+			ours.WriteString(line)
+			theirs.WriteString(line)
+		case inOurs, inBase:
+			if _, ok := isMarker(line, conflictBase); ok && state == inOurs {
+				state = inBase
+				continue
+			}
+			if _, ok := isMarker(line, conflictSep); ok {
+				state = inTheirs
+				continue
+			}
+			if state == inOurs {
+				ours.WriteString(line)
+			}
+		case inTheirs:
+			if label, ok := isMarker(line, conflictEnd); ok {
+				state = outside
+				if c.Count == 1 {
+					c.TheirsLabel = label
+				}
+				continue
+			}
+			theirs.WriteString(line)
+		}
+	}
+	if c.Count == 0 || state != outside {
+		return Conflict{}, false
+	}
+	c.Ours, c.Theirs = ours.String(), theirs.String()
+	return c, true
+}
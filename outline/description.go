@@ -0,0 +1,63 @@
+package outline
+
+import (
+	"regexp"
+	"strings"
+)
+
+// titlePattern 匹配单行的标题和说明，例如 title 登录流程、caption 图1
+var titlePattern = regexp.MustCompile(`^(?i)(title|caption)(?:\s+(.*))?$`)
+
+// markupPattern 匹配标题中的HTML标签和Creole格式标记，生成描述时去掉
+var markupPattern = regexp.MustCompile(`<[^>]+>|\*\*|//|__|""|~~`)
+
+// Description 返回图表的文字描述，用作读屏软件等辅助技术读出的替代文本。
+// 由源码中的title和caption组成（支持 title ... end title 多行标题），都没有时返回name
+func Description(source, name string) string {
+	var title, caption []string
+	var block *[]string // 多行标题或说明
+	for _, line := range sourceLines(source) {
+		if block != nil {
+			// end title、endtitle、end caption等结束多行标题或说明
+			if end := strings.ToLower(strings.Join(strings.Fields(line), "")); end == "endtitle" || end == "endcaption" {
+				block = nil
+			} else if text := plainText(line); text != "" {
+				*block = append(*block, text)
+			}
+			continue
+		}
+		m := titlePattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		target := &title
+		if strings.EqualFold(m[1], "caption") {
+			target = &caption
+		}
+		if strings.TrimSpace(m[2]) == "" {
+			*target = nil
+			block = target
+		} else if len(*target) == 0 {
+			*target = []string{plainText(m[2])}
+		}
+	}
+
+	var parts []string
+	for _, p := range [][]string{title, caption} {
+		if text := strings.Join(p, " "); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	if len(parts) == 0 {
+		return name
+	}
+	return strings.Join(parts, "。")
+}
+
+// plainText 去掉格式标记、引号和转义的换行，返回标题中的文字
+func plainText(text string) string {
+	text = strings.ReplaceAll(text, `\n`, " ")
+	text = markupPattern.ReplaceAllString(text, "")
+	text = strings.Trim(strings.TrimSpace(text), `"`)
+	return strings.Join(strings.Fields(text), " ")
+}
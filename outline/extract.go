@@ -0,0 +1,102 @@
+package outline
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Extract 把源码中第first到last行（从1开始）提取到target文件中，原来的位置改为引用它的 !include，
+// 返回修改后的源码和target文件的内容。dir是图表所在的目录，!include 中的路径相对于它；
+// 提取的行去掉共同的缩进，其中引用本地文件的相对路径改为相对于target所在的目录，!include 保留原来的缩进。
+// 提取的行中不能有 @startuml 和 @enduml
+func Extract(source string, first, last int, dir, target string) (string, string, error) {
+	newline := "\n"
+	if strings.Contains(source, "\r\n") {
+		newline = "\r\n"
+	}
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	if first < 1 || last < first || last > len(lines) {
+		return "", "", fmt.Errorf("要提取的行 %d-%d 超出范围", first, last)
+	}
+	block := append([]string(nil), lines[first-1:last]...)
+	for _, line := range block {
+		if trimmed := strings.ToLower(strings.TrimSpace(line)); strings.HasPrefix(trimmed, "@start") || strings.HasPrefix(trimmed, "@end") {
+			return "", "", fmt.Errorf("不能提取 %s，只能提取图表中间的行", strings.TrimSpace(line))
+		}
+	}
+	for len(block) > 0 && strings.TrimSpace(block[len(block)-1]) == "" {
+		block = block[:len(block)-1]
+	}
+	if len(block) == 0 {
+		return "", "", fmt.Errorf("选中的只有空行")
+	}
+
+	indent := commonIndent(block)
+	targetDir := filepath.Dir(target)
+	for i, line := range block {
+		line = strings.TrimPrefix(line, indent)
+		block[i] = rebaseInclude(line, dir, targetDir)
+	}
+
+	ref, err := filepath.Rel(dir, target)
+	if err != nil {
+		ref = target
+	}
+	replaced := append([]string(nil), lines[:first-1]...)
+	replaced = append(replaced, indent+"!include "+filepath.ToSlash(ref))
+	replaced = append(replaced, lines[last:]...)
+	return strings.Join(replaced, newline), strings.Join(block, newline) + newline, nil
+}
+
+// commonIndent 返回非空行共同的前导空白
+func commonIndent(lines []string) string {
+	indent := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			indent, first = lead, false
+			continue
+		}
+		for !strings.HasPrefix(lead, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	return indent
+}
+
+// rebaseInclude 把 !include 等指令中相对于from的本地路径改为相对于to，其他行不变
+func rebaseInclude(line, from, to string) string {
+	m := includePattern.FindStringSubmatchIndex(strings.TrimSpace(line))
+	if m == nil || from == to {
+		return line
+	}
+	lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	trimmed := strings.TrimSpace(line)
+	ref := trimmed[m[2]:m[3]]
+	if strings.HasPrefix(ref, "<") || strings.Contains(ref, "://") {
+		return line
+	}
+	suffix := ""
+	if i := strings.Index(ref, "!"); i >= 0 {
+		ref, suffix = ref[:i], ref[i:]
+	}
+	quoted := strings.HasPrefix(ref, `"`)
+	path := strings.Trim(strings.TrimSpace(ref), `"`)
+	if path == "" || filepath.IsAbs(path) {
+		return line
+	}
+	rel, err := filepath.Rel(to, filepath.Join(from, path))
+	if err != nil {
+		return line
+	}
+	rel = filepath.ToSlash(rel)
+	if quoted {
+		rel = `"` + rel + `"`
+	}
+	return lead + trimmed[:m[2]] + rel + suffix
+}
@@ -0,0 +1,41 @@
+package outline
+
+import "regexp"
+
+// flagPatterns 匹配以预处理变量是否定义为条件的行：!ifdef、!ifndef 和 %defined("名称")
+var flagPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^!ifn?def\s+\$?([A-Za-z_][A-Za-z0-9_]*)\b`),
+	regexp.MustCompile(`%defined\(\s*"?\$?([A-Za-z_][A-Za-z0-9_]*)"?\s*\)`),
+}
+
+// definePattern 匹配在源码中直接定义变量的行
+var definePattern = regexp.MustCompile(`^!define\s+\$?([A-Za-z_][A-Za-z0-9_]*)\b`)
+
+// Flags 按第一次出现的顺序列出源码中用作开关的预处理变量：在 !ifdef、!ifndef 或 %defined() 中检查，
+// 并且没有在源码中用 !define 定义的变量。渲染时以 -D名称 定义这些变量即可显示它们保护的细节
+func Flags(source string) []string {
+	lines := sourceLines(source)
+	defined := make(map[string]bool)
+	for _, line := range lines {
+		if match := definePattern.FindStringSubmatch(line); match != nil {
+			defined[match[1]] = true
+		}
+	}
+	var flags []string
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		if len(line) == 0 || line[0] != '!' {
+			continue
+		}
+		for _, pattern := range flagPatterns {
+			for _, match := range pattern.FindAllStringSubmatch(line, -1) {
+				name := match[1]
+				if !seen[name] && !defined[name] {
+					seen[name] = true
+					flags = append(flags, name)
+				}
+			}
+		}
+	}
+	return flags
+}
@@ -0,0 +1,257 @@
+package outline
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind 表示大纲中元素的类型
+type Kind string
+
+const (
+	// Participant 时序图中的参与者（participant、actor、database等）
+	Participant Kind = "participant"
+	// Class 类图中的类、接口和枚举
+	Class Kind = "class"
+	// Package 包和命名空间
+	Package Kind = "package"
+	// State 状态图中的状态
+	State Kind = "state"
+)
+
+// Label 返回元素类型在界面上显示的名称
+func (k Kind) Label() string {
+	switch k {
+	case Participant:
+		return "参与者"
+	case Class:
+		return "类"
+	case Package:
+		return "包"
+	case State:
+		return "状态"
+	}
+	return string(k)
+}
+
+// Element 是源码中声明的一个元素
+type Element struct {
+	Kind Kind
+	Name string // 显示的名称，有引号标签时为标签
+	ID   string // 源码中引用该元素时使用的名称（别名或标识符）
+	Line int    // 声明所在的行，从1开始
+}
+
+// Position 是元素在源码中出现的位置
+type Position struct {
+	Line   int // 行，从1开始
+	Column int // 列，从0开始按字符计算
+	Length int // 长度，按字符计算
+}
+
+// declarations 按声明关键字识别元素类型
+var declarations = []struct {
+	kind    Kind
+	pattern *regexp.Regexp
+}{
+	{Participant, regexp.MustCompile(`^(?:participant|actor|boundary|control|entity|database|collections|queue)\s+(.+)$`)},
+	{Class, regexp.MustCompile(`^(?:abstract\s+class|abstract|class|interface|enum|annotation)\s+(.+)$`)},
+	{Package, regexp.MustCompile(`^(?:package|namespace)\s+(.+)$`)},
+	{State, regexp.MustCompile(`^state\s+(.+)$`)},
+}
+
+// aliasPattern 匹配名称后面的别名，例如 as A 或 as "Long Name"
+var aliasPattern = regexp.MustCompile(`^\s+as\s+("[^"]*"|[^\s{<#]+)`)
+
+// Parse 按出现的顺序列出源码中声明的参与者、类、包和状态，同一元素重复声明时只保留第一次。
+// 没有显式声明、只在箭头中出现的元素不列出
+func Parse(source string) []Element {
+	var elements []Element
+	seen := make(map[string]bool)
+	for i, line := range sourceLines(source) {
+		if line == "" {
+			continue
+		}
+		for _, d := range declarations {
+			match := d.pattern.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			name, id := parseName(match[1])
+			if id != "" && !seen[string(d.kind)+"\x00"+id] {
+				seen[string(d.kind)+"\x00"+id] = true
+				elements = append(elements, Element{Kind: d.kind, Name: name, ID: id, Line: i + 1})
+			}
+			break
+		}
+	}
+	return elements
+}
+
+// parseName 解析声明关键字后面的部分，返回显示的名称和引用时使用的名称
+func parseName(rest string) (name, id string) {
+	if strings.HasPrefix(rest, `"`) {
+		end := strings.Index(rest[1:], `"`)
+		if end < 0 {
+			return "", ""
+		}
+		name = rest[1 : end+1]
+		id = name
+		if alias := aliasPattern.FindStringSubmatch(rest[end+2:]); alias != nil {
+			id = strings.Trim(alias[1], `"`)
+		}
+		return name, id
+	}
+
+	end := strings.IndexFunc(rest, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`{<#":`, r)
+	})
+	if end < 0 {
+		end = len(rest)
+	}
+	id = rest[:end]
+	name = id
+	if alias := aliasPattern.FindStringSubmatch(rest[end:]); alias != nil {
+		if strings.HasPrefix(alias[1], `"`) {
+			// Alice as "Long Name"：引用时使用前面的标识符
+			name = strings.Trim(alias[1], `"`)
+		} else {
+			// Alice as A：引用时使用别名
+			id = alias[1]
+		}
+	}
+	return name, id
+}
+
+// Occurrences 返回id在源码中出现的所有位置，只匹配完整的名称，忽略注释、块注释和多行文字块中的文字
+func Occurrences(source, id string) []Position {
+	if id == "" {
+		return nil
+	}
+	var positions []Position
+	length := utf8.RuneCountInString(id)
+	for i, line := range codeLines(source) {
+		for offset := 0; ; {
+			index := strings.Index(line[offset:], id)
+			if index < 0 {
+				break
+			}
+			start := offset + index
+			end := start + len(id)
+			offset = end
+			if isIdentifierByte(line, start-1) || isIdentifierByte(line, end) {
+				continue
+			}
+			positions = append(positions, Position{Line: i + 1, Column: utf8.RuneCountInString(line[:start]), Length: length})
+		}
+	}
+	return positions
+}
+
+// ElementAt 返回源码第line行（从1开始）对应的元素：优先返回在该行声明的元素，
+// 否则返回该行中最靠前出现的已声明元素，例如箭头左侧的参与者。该行没有已声明的元素时返回false
+func ElementAt(source string, line int) (Element, bool) {
+	elements := Parse(source)
+	for _, e := range elements {
+		if e.Line == line {
+			return e, true
+		}
+	}
+
+	var found Element
+	column := -1
+	for _, e := range elements {
+		for _, pos := range Occurrences(source, e.ID) {
+			if pos.Line == line && (column < 0 || pos.Column < column) {
+				found, column = e, pos.Column
+			}
+		}
+	}
+	return found, column >= 0
+}
+
+// sourceLines 按行拆分源码并去掉首尾空白，注释行和块注释中的行替换为空行，保持行号不变
+func sourceLines(source string) []string {
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	inBlock := false
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case inBlock:
+			inBlock = !strings.Contains(line, "'/")
+			line = ""
+		case strings.HasPrefix(line, "/'"):
+			inBlock = !strings.Contains(line[2:], "'/")
+			line = ""
+		case isComment(line):
+			line = ""
+		}
+		lines[i] = line
+	}
+	return lines
+}
+
+// textBlocks 是多行的注释、图例、页眉页脚、引用和标题，与formatter识别的相同：start和end匹配去掉首尾空白并转为小写的行
+var textBlocks = []struct {
+	start *regexp.Regexp
+	end   *regexp.Regexp
+}{
+	{regexp.MustCompile(`^[rh]?note(\s[^:"]*)?$`), regexp.MustCompile(`^end\s*[rh]?note$`)},
+	{regexp.MustCompile(`^legend(\s+(left|right|center|top|bottom))*$`), regexp.MustCompile(`^end\s*legend$`)},
+	{regexp.MustCompile(`^header(\s+(left|right|center))*$`), regexp.MustCompile(`^end\s*header$`)},
+	{regexp.MustCompile(`^footer(\s+(left|right|center))*$`), regexp.MustCompile(`^end\s*footer$`)},
+	{regexp.MustCompile(`^ref\s+over\s[^:]*$`), regexp.MustCompile(`^end\s*ref$`)},
+	{regexp.MustCompile(`^title$`), regexp.MustCompile(`^end\s*title$`)},
+}
+
+// codeLines 按行拆分源码，保留行首的空白；注释、块注释和多行文字块中的行替换为空行，保持行号不变。
+// 文字块的开始行（例如 note over Bob）和结束行仍是源码
+func codeLines(source string) []string {
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	inComment := false
+	var text *regexp.Regexp // 在多行文字块中时为它的结束行
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		lower := strings.ToLower(trimmed)
+		switch {
+		case inComment:
+			inComment = !strings.Contains(trimmed, "'/")
+			lines[i] = ""
+		case text != nil:
+			if text.MatchString(lower) {
+				text = nil
+			} else {
+				lines[i] = ""
+			}
+		case strings.HasPrefix(trimmed, "/'"):
+			inComment = !strings.Contains(trimmed[2:], "'/")
+			lines[i] = ""
+		case isComment(trimmed):
+			lines[i] = ""
+		default:
+			for _, t := range textBlocks {
+				if t.start.MatchString(lower) {
+					text = t.end
+					break
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// isComment 判断是否为单行注释
+func isComment(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "'")
+}
+
+// isIdentifierByte 判断line中位置i的字符是否属于标识符，超出范围时返回false
+func isIdentifierByte(line string, i int) bool {
+	if i < 0 || i >= len(line) {
+		return false
+	}
+	c := line[i]
+	return c == '_' || c == '.' || c >= 0x80 || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
@@ -0,0 +1,357 @@
+package outline
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	source := `@startuml
+participant Alice
+actor "Bob the Builder" as Bob
+database DB as "Orders DB"
+' participant Ignored
+/' class Hidden
+'/
+package billing.core {
+  abstract class Invoice<T> {
+  }
+  interface Payable
+  enum Status
+}
+state Idle : waiting
+state "Long Running" as Running {
+}
+participant Alice
+Alice -> Bob : hello
+@enduml`
+
+	want := []Element{
+		{Participant, "Alice", "Alice", 2},
+		{Participant, "Bob the Builder", "Bob", 3},
+		{Participant, "Orders DB", "DB", 4},
+		{Package, "billing.core", "billing.core", 8},
+		{Class, "Invoice", "Invoice", 9},
+		{Class, "Payable", "Payable", 11},
+		{Class, "Status", "Status", 12},
+		{State, "Idle", "Idle", 14},
+		{State, "Long Running", "Running", 15},
+	}
+	if got := Parse(source); !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse =\n%+v\n应为\n%+v", got, want)
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	source := "participant Alice\nparticipant Alicia\n' Alice 在注释中\n用户 -> Alice : Alice_1 Alice\n"
+
+	want := []Position{
+		{Line: 1, Column: 12, Length: 5},
+		{Line: 4, Column: 6, Length: 5},
+		{Line: 4, Column: 22, Length: 5},
+	}
+	if got := Occurrences(source, "Alice"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Occurrences = %+v，应为 %+v", got, want)
+	}
+	if got := Occurrences(source, ""); got != nil {
+		t.Errorf("空名称不应有匹配，得到 %+v", got)
+	}
+}
+
+func TestElementAt(t *testing.T) {
+	source := `@startuml
+participant Alice
+actor Bob
+Bob -> Alice : hello
+' Alice -> Bob
+note over Alice : hi
+@enduml`
+
+	cases := []struct {
+		line int
+		want string
+		ok   bool
+	}{
+		{2, "Alice", true},
+		{3, "Bob", true},
+		{4, "Bob", true},
+		{5, "", false},
+		{6, "Alice", true},
+		{7, "", false},
+	}
+	for _, c := range cases {
+		e, ok := ElementAt(source, c.line)
+		if ok != c.ok || e.ID != c.want {
+			t.Errorf("ElementAt(%d) = %q, %v，应为 %q, %v", c.line, e.ID, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestDescription(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"@startuml\ntitle 登录流程\nAlice -> Bob\n@enduml", "登录流程"},
+		{"@startuml\ntitle <b>订单</b> **处理**\\n第二版\ncaption 图1 下单\n@enduml", "订单 处理 第二版。图1 下单"},
+		{"@startuml\ntitle\n  多行\n  标题\nend title\nA -> B\n@enduml", "多行 标题"},
+		{"@startuml\n' title 注释中的标题\nA -> B\n@enduml", "a.puml"},
+		{"@startuml\nTitle \"引号中的标题\"\n@enduml", "引号中的标题"},
+	}
+	for _, tt := range tests {
+		if got := Description(tt.source, "a.puml"); got != tt.want {
+			t.Errorf("Description(%q) = %q，应为 %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	source := "@startuml\r\nparticipant \"Bob the Builder\" as Bob\r\n' Bob 在注释中\r\nBob -> Bobby : Bob 说你好\r\nnote over Bob, Bobby : hi\r\n\"Bob\" -> Bob\r\n@enduml"
+
+	got, changes := Rename(source, "Bob", "Builder")
+	want := "@startuml\r\nparticipant \"Bob the Builder\" as Builder\r\n' Bob 在注释中\r\nBuilder -> Bobby : Bob 说你好\r\nnote over Builder, Bobby : hi\r\n\"Builder\" -> Builder\r\n@enduml"
+	if got != want {
+		t.Errorf("Rename =\n%q\n应为\n%q", got, want)
+	}
+	wantChanges := []Change{
+		{2, `participant "Bob the Builder" as Bob`, `participant "Bob the Builder" as Builder`},
+		{4, "Bob -> Bobby : Bob 说你好", "Builder -> Bobby : Bob 说你好"},
+		{5, "note over Bob, Bobby : hi", "note over Builder, Bobby : hi"},
+		{6, `"Bob" -> Bob`, `"Builder" -> Builder`},
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("修改的行 =\n%+v\n应为\n%+v", changes, wantChanges)
+	}
+
+	// 多行文字块和块注释中的文字不是引用，只修改块的开始行
+	blocks := map[string]string{
+		"注释":  "note over Bob\nBob is the server\nend note",
+		"右注释": "rnote left of Bob\nBob\nendrnote",
+		"标题":  "title\nBob 的流程\nend title",
+		"图例":  "legend right\nBob: 服务器\nendlegend",
+		"页眉":  "header\nBob\nend header",
+		"页脚":  "footer center\nBob\nend footer",
+		"引用":  "ref over Bob\nBob 登录\nend ref",
+		"块注释": "/' Bob old\nBob -> Alice\n'/\n/' Bob '/",
+	}
+	for name, block := range blocks {
+		source := "participant Bob\n" + block + "\nBob -> Alice"
+		got, _ := Rename(source, "Bob", "Server")
+		first, rest, _ := strings.Cut(block, "\n")
+		if !strings.HasPrefix(first, "/'") {
+			first = strings.ReplaceAll(first, "Bob", "Server")
+		}
+		if want := "participant Server\n" + first + "\n" + rest + "\nServer -> Alice"; got != want {
+			t.Errorf("%s：Rename =\n%q\n应为\n%q", name, got, want)
+		}
+	}
+
+	if got, changes := Rename(source, "Carol", "Dave"); got != source || changes != nil {
+		t.Errorf("没有出现的名称不应修改，得到 %q %+v", got, changes)
+	}
+	for name, want := range map[string]bool{"Builder": true, "billing.core": true, "用户_2": true, "": false, "Bob Builder": false, "A->B": false} {
+		if got := ValidID(name); got != want {
+			t.Errorf("ValidID(%q) = %v，应为 %v", name, got, want)
+		}
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	source := `@startuml
+!include common.iuml
+!include_once "styles/theme.iuml"
+!includesub parts.iuml!BASIC
+!include <C4/C4_Container>
+!include https://example.com/x.iuml
+' !include ignored.iuml
+!include common.iuml
+!include /abs/shared.iuml
+@enduml`
+
+	want := []string{
+		filepath.Join("/docs", "common.iuml"),
+		filepath.Join("/docs", "styles", "theme.iuml"),
+		filepath.Join("/docs", "parts.iuml"),
+		filepath.Clean("/abs/shared.iuml"),
+	}
+	if got := Includes(source, "/docs"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Includes = %v，应为 %v", got, want)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	source := "@startuml\r\npackage core {\r\n  class A\r\n  !include ../shared/base.iuml\r\n    class B\r\n\r\n}\r\n@enduml"
+	dir := filepath.FromSlash("/docs/diagrams")
+	target := filepath.FromSlash("/docs/diagrams/parts/core.iuml")
+
+	got, extracted, err := Extract(source, 3, 6, dir, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "@startuml\r\npackage core {\r\n  !include parts/core.iuml\r\n}\r\n@enduml"; got != want {
+		t.Errorf("Extract 后的源码 = %q，应为 %q", got, want)
+	}
+	if want := "class A\r\n!include ../../shared/base.iuml\r\n  class B\r\n"; extracted != want {
+		t.Errorf("提取的内容 = %q，应为 %q", extracted, want)
+	}
+
+	if _, _, err := Extract(source, 1, 3, dir, target); err == nil {
+		t.Error("提取 @startuml 应返回错误")
+	}
+	if _, _, err := Extract(source, 6, 6, dir, target); err == nil {
+		t.Error("只选中空行应返回错误")
+	}
+	if _, _, err := Extract(source, 3, 20, dir, target); err == nil {
+		t.Error("超出范围的行应返回错误")
+	}
+}
+
+func TestSVGRegions(t *testing.T) {
+	svg := `<?xml version="1.0" encoding="us-ascii" standalone="no"?><svg xmlns="http://www.w3.org/2000/svg" width="300px" height="200px" viewBox="0 0 300 200"><defs/><g>
+<g class="cluster" data-qualified-name="billing" id="cluster_billing"><rect height="150" width="200" x="10" y="10"/><text font-size="14" textLength="40" x="20" y="30">billing</text></g>
+<g class="entity" data-qualified-name="billing.Invoice" id="ent0002"><rect height="40" width="80" x="30" y="50"/><text font-size="14" textLength="50" x="40" y="75">Invoice</text></g>
+<g id="link_A_B" data-source-line="9"><polygon points="220,20,240,30,220,40"/><text font-size="13" textLength="30" x="230" y="60">hello</text></g>
+</g></svg>`
+	regions, width, height, err := SVGRegions([]byte(svg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != 300 || height != 200 {
+		t.Errorf("图像尺寸应为300x200，得到 %vx%v", width, height)
+	}
+	if len(regions) != 3 {
+		t.Fatalf("应找到3个元素，得到 %+v", regions)
+	}
+
+	if r, ok := RegionAt(regions, 50, 60); !ok || r.Name != "billing.Invoice" {
+		t.Errorf("点击包中的类应选中最内层的类，得到 %+v", r)
+	}
+	if r, ok := RegionAt(regions, 15, 140); !ok || r.Name != "billing" {
+		t.Errorf("点击包中的空白处应选中包，得到 %+v", r)
+	}
+	if r, ok := RegionAt(regions, 230, 35); !ok || r.Name != "hello" || r.Line != 9 {
+		t.Errorf("没有名称属性时应使用其中的文字和记录的源码行，得到 %+v", r)
+	}
+	if _, ok := RegionAt(regions, 290, 190); ok {
+		t.Error("空白处不应选中元素")
+	}
+}
+
+func TestSourceLine(t *testing.T) {
+	source := `@startuml
+' Alice 注释中的名称不算
+participant "Alice Smith" as Alice
+Bob -> Alice : hello
+@enduml`
+	tests := []struct {
+		region Region
+		want   int
+	}{
+		{Region{Name: "Alice"}, 3},
+		{Region{Name: "Alice Smith"}, 3},
+		{Region{Name: "Bob"}, 4},
+		{Region{Name: "hello"}, 4},
+		{Region{Name: "Alice", Line: 7}, 7},
+		{Region{Name: "Carol"}, 0},
+	}
+	for _, tt := range tests {
+		if got := SourceLine(source, tt.region); got != tt.want {
+			t.Errorf("SourceLine(%+v) = %d，应为 %d", tt.region, got, tt.want)
+		}
+	}
+}
+
+func TestTooltipAt(t *testing.T) {
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="200px" height="100px"><title>图表标题</title><g>
+<g class="entity" data-qualified-name="Api" id="ent0001"><title>对外接口</title><desc>只读</desc><rect height="40" width="80" x="10" y="10"/><text font-size="14" textLength="30" x="20" y="35">Api</text></g>
+<a href="https://example.com" title="打开文档" xlink:title="打开文档"><g id="ent0002" data-qualified-name="Docs"><rect height="40" width="80" x="110" y="10"/></g></a>
+<g id="ent0003" data-qualified-name="Db"><rect height="20" width="80" x="10" y="70"/></g>
+</g></svg>`
+	regions, _, _, err := SVGRegions([]byte(svg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tip, ok := TooltipAt(regions, 30, 30); !ok || tip != "对外接口\n只读" {
+		t.Errorf("应显示元素中的<title>和<desc>，得到 %q", tip)
+	}
+	if tip, ok := TooltipAt(regions, 130, 30); !ok || tip != "打开文档" {
+		t.Errorf("应显示链接的提示，得到 %q", tip)
+	}
+	if r, ok := RegionAt(regions, 130, 30); !ok || r.Name != "Docs" {
+		t.Errorf("链接的区域不应影响查找元素，得到 %+v", r)
+	}
+	if tip, ok := TooltipAt(regions, 30, 80); ok {
+		t.Errorf("没有提示的元素不应显示提示，得到 %q", tip)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	source := `@startuml
+!define SHOWN
+!ifdef DETAIL
+A -> B : 内部调用
+!endif
+!ifndef $COMPACT
+note over A : 说明
+!endif
+' !ifdef COMMENTED
+!if %defined("DB") || %defined(CACHE)
+B -> Db
+!endif
+!ifdef SHOWN
+B -> C
+!endif
+!ifdef DETAIL
+C -> D
+!endif
+@enduml`
+	got := Flags(source)
+	want := []string{"DETAIL", "COMPACT", "DB", "CACHE"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Flags = %q，期望 %q", got, want)
+	}
+}
+
+func TestParseConflict(t *testing.T) {
+	source := "@startuml\n" +
+		"<<<<<<< HEAD\n" +
+		"A -> B : login\n" +
+		"||||||| merged common ancestors\n" +
+		"A -> B\n" +
+		"=======\n" +
+		"A -> C : login\n" +
+		">>>>>>> feature/sso\n" +
+		"B --> A\n" +
+		"<<<<<<< HEAD\n" +
+		"=======\n" +
+		"C --> A\n" +
+		">>>>>>> feature/sso\n" +
+		"@enduml\n"
+	c, ok := ParseConflict(source)
+	if !ok {
+		t.Fatal("应找到冲突")
+	}
+	if want := "@startuml\nA -> B : login\nB --> A\n@enduml\n"; c.Ours != want {
+		t.Errorf("Ours = %q，应为 %q", c.Ours, want)
+	}
+	if want := "@startuml\nA -> C : login\nB --> A\nC --> A\n@enduml\n"; c.Theirs != want {
+		t.Errorf("Theirs = %q，应为 %q", c.Theirs, want)
+	}
+	if c.OursLabel != "HEAD" || c.TheirsLabel != "feature/sso" || c.Count != 2 || c.Line != 2 {
+		t.Errorf("冲突信息不正确: %+v", c)
+	}
+
+	for _, source := range []string{
+		"@startuml\nA -> B\n@enduml\n",
+		// 不完整的冲突
+		"@startuml\n<<<<<<< HEAD\nA -> B\n=======\n@enduml\n",
+		// 标记后面没有空格的不是冲突标记
+		"@startuml\n<<<<<<<<< HEAD\nA -> B\n@enduml\n",
+	} {
+		if _, ok := ParseConflict(source); ok {
+			t.Errorf("%q 不应识别为冲突", source)
+		}
+	}
+}
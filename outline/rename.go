@@ -0,0 +1,129 @@
+package outline
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Change 是重命名修改的一行
+type Change struct {
+	Line   int    // 行，从1开始
+	Before string // 修改前的内容
+	After  string // 修改后的内容
+}
+
+// ValidID 判断name能否作为引用元素的名称：不为空，只包含字母、数字、下划线、点和非ASCII字符，
+// 这样重命名后的名称在箭头和声明中不需要加引号
+func ValidID(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isIdentifierByte(name, i) {
+			return false
+		}
+	}
+	return true
+}
+
+// Rename 把源码中引用id的地方（与Occurrences的规则相同，只匹配完整的名称，忽略注释）改为newID，
+// 返回修改后的源码和修改的行，供确认前预览。引号中的标签和冒号后面的消息文字不是引用，
+// 除非引号中正好是id，例如 "Long Name" -> Bob。保留原来的换行符
+func Rename(source, id, newID string) (string, []Change) {
+	positions := Occurrences(source, id)
+	if len(positions) == 0 || id == newID {
+		return source, nil
+	}
+	newline := "\n"
+	if strings.Contains(source, "\r\n") {
+		newline = "\r\n"
+	}
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+
+	var changes []Change
+	for i := len(positions) - 1; i >= 0; i-- {
+		pos := positions[i]
+		line := lines[pos.Line-1]
+		start := runeOffset(line, pos.Column)
+		if !isReference(line, start, start+len(id)) {
+			continue
+		}
+		lines[pos.Line-1] = line[:start] + newID + line[start+len(id):]
+		// 从后往前替换，同一行中第一次替换前的内容就是原来的内容
+		if len(changes) == 0 || changes[0].Line != pos.Line {
+			changes = append([]Change{{Line: pos.Line, Before: line}}, changes...)
+		}
+	}
+	for i := range changes {
+		changes[i].After = lines[changes[i].Line-1]
+	}
+	return strings.Join(lines, newline), changes
+}
+
+// isReference 判断line中[start, end)处的名称是否为引用：不在引号中的标签里，也不在冒号后面的文字里
+func isReference(line string, start, end int) bool {
+	quoted := false
+	for i := 0; i < start; i++ {
+		switch {
+		case line[i] == '"':
+			quoted = !quoted
+		case line[i] == ':' && !quoted:
+			// A::B 是命名空间中的名称，不是标签的开始
+			if !(i+1 < len(line) && line[i+1] == ':') && !(i > 0 && line[i-1] == ':') {
+				return false
+			}
+		}
+	}
+	if quoted {
+		return start > 0 && line[start-1] == '"' && end < len(line) && line[end] == '"'
+	}
+	return true
+}
+
+// runeOffset 返回line中第column个字符（从0开始）的字节位置
+func runeOffset(line string, column int) int {
+	offset := 0
+	for i := 0; i < column && offset < len(line); i++ {
+		_, size := utf8.DecodeRuneInString(line[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// includePattern 匹配引用其他文件的预处理指令，例如 !include common.iuml 和 !includesub parts.iuml!BASIC
+var includePattern = regexp.MustCompile(`(?i)^!(?:include|include_once|include_many|includesub)\s+(.+)$`)
+
+// Includes 返回源码用 !include 等指令引用的本地文件的绝对路径，按出现的顺序，不重复。相对路径相对于dir（图表所在的目录）；
+// 网址、标准库（<C4/C4_Container>）和 !includeurl 不是本地文件，不包括在内，!includesub 中 ! 后面的部分名称去掉
+func Includes(source, dir string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, line := range sourceLines(source) {
+		m := includePattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		ref := strings.TrimSpace(m[1])
+		if strings.HasPrefix(ref, "<") || strings.Contains(ref, "://") {
+			continue
+		}
+		if i := strings.Index(ref, "!"); i >= 0 {
+			ref = ref[:i]
+		}
+		ref = strings.Trim(strings.TrimSpace(ref), `"`)
+		if ref == "" {
+			continue
+		}
+		if !filepath.IsAbs(ref) {
+			ref = filepath.Join(dir, ref)
+		}
+		ref = filepath.Clean(ref)
+		if !seen[ref] {
+			seen[ref] = true
+			files = append(files, ref)
+		}
+	}
+	return files
+}
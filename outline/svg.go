@@ -0,0 +1,265 @@
+package outline
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Region 是PlantUML输出的SVG中一个元素或链接所占的矩形区域，坐标为SVG的像素坐标
+type Region struct {
+	Name    string // 元素的名称（data-qualified-name等属性），没有时为其中的第一段文字；链接的区域为空
+	Line    int    // SVG中记录的源码行（data-source-line），没有时为0
+	Tooltip string // 提示文字：元素中的<title>和<desc>，或者链接的title属性，没有时为空
+	X, Y    float64
+	W, H    float64
+}
+
+// contains 判断点(x, y)是否在区域中
+func (r Region) contains(x, y float64) bool {
+	return x >= r.X && x <= r.X+r.W && y >= r.Y && y <= r.Y+r.H
+}
+
+// svgGroup 是解析时打开的一个<g>或<a>，记录其中图形的外接矩形
+type svgGroup struct {
+	named  bool // 带有id或名称属性，是一个元素
+	region Region
+	empty  bool // 还没有遇到图形
+}
+
+// extend 把矩形(x, y, w, h)并入组的外接矩形
+func (g *svgGroup) extend(x, y, w, h float64) {
+	if g.empty {
+		g.region.X, g.region.Y, g.region.W, g.region.H = x, y, w, h
+		g.empty = false
+		return
+	}
+	right := math.Max(g.region.X+g.region.W, x+w)
+	bottom := math.Max(g.region.Y+g.region.H, y+h)
+	g.region.X = math.Min(g.region.X, x)
+	g.region.Y = math.Min(g.region.Y, y)
+	g.region.W, g.region.H = right-g.region.X, bottom-g.region.Y
+}
+
+// SVGRegions 解析PlantUML输出的SVG，返回每个带id或名称属性的<g>和每个带title的链接<a>中图形的外接矩形，
+// 以及图像的宽和高。只计算矩形、椭圆、多边形和文字，连线的路径不计入
+func SVGRegions(svg []byte) (regions []Region, width, height float64, err error) {
+	dec := xml.NewDecoder(bytes.NewReader(svg))
+	dec.Strict = false
+	// PlantUML声明us-ascii编码，非ASCII字符都写为字符引用，按原样读取即可
+	dec.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	var stack []*svgGroup
+	var text *strings.Builder // 正在读取的<text>、<title>或<desc>的内容
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("无法解析SVG: %v", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			attrs := make(map[string]string, len(t.Attr))
+			for _, a := range t.Attr {
+				attrs[a.Name.Local] = a.Value
+			}
+			switch t.Name.Local {
+			case "svg":
+				if width == 0 {
+					width, height = svgSize(attrs)
+				}
+			case "g":
+				stack = append(stack, newSVGGroup(attrs))
+			case "a":
+				// 链接的title属性是PlantUML的 [[url{提示}]] 生成的提示
+				stack = append(stack, &svgGroup{empty: true, region: Region{Tooltip: strings.TrimSpace(attrs["title"])}})
+			case "title", "desc":
+				text = &strings.Builder{}
+			case "text":
+				text = &strings.Builder{}
+				// 文字的y是基线，向上延伸一个字号
+				size := attrFloat(attrs, "font-size")
+				if size == 0 {
+					size = 14
+				}
+				w := attrFloat(attrs, "textLength")
+				extendAll(stack, attrFloat(attrs, "x"), attrFloat(attrs, "y")-size, w, size)
+			default:
+				if x, y, w, h, ok := shapeBounds(t.Name.Local, attrs); ok {
+					extendAll(stack, x, y, w, h)
+				}
+			}
+		case xml.CharData:
+			if text != nil {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "text":
+				if text == nil {
+					continue
+				}
+				if s := strings.TrimSpace(text.String()); s != "" {
+					for _, g := range stack {
+						if g.named && g.region.Name == "" {
+							g.region.Name = s
+						}
+					}
+				}
+				text = nil
+			case "title", "desc":
+				if text == nil {
+					continue
+				}
+				// 提示属于最内层的元素，图表本身的<title>不在任何元素中，忽略
+				if s := strings.TrimSpace(text.String()); s != "" && len(stack) > 0 {
+					g := stack[len(stack)-1]
+					if g.region.Tooltip == "" {
+						g.region.Tooltip = s
+					} else if !strings.Contains(g.region.Tooltip, s) {
+						g.region.Tooltip += "\n" + s
+					}
+				}
+				text = nil
+			case "g", "a":
+				if len(stack) == 0 {
+					continue
+				}
+				g := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if g.empty {
+					continue
+				}
+				if g.named && g.region.Name != "" || !g.named && g.region.Tooltip != "" {
+					regions = append(regions, g.region)
+				}
+			}
+		}
+	}
+	return regions, width, height, nil
+}
+
+// newSVGGroup 按<g>的属性创建组。PlantUML在不同版本中用不同的属性记录元素的名称
+func newSVGGroup(attrs map[string]string) *svgGroup {
+	g := &svgGroup{empty: true}
+	for _, name := range []string{"data-qualified-name", "data-entity", "data-participant"} {
+		if v := attrs[name]; v != "" {
+			g.region.Name = v
+			break
+		}
+	}
+	g.region.Line, _ = strconv.Atoi(attrs["data-source-line"])
+	g.named = g.region.Name != "" || attrs["id"] != "" || g.region.Line > 0
+	return g
+}
+
+// extendAll 把矩形并入所有打开的组
+func extendAll(stack []*svgGroup, x, y, w, h float64) {
+	for _, g := range stack {
+		g.extend(x, y, w, h)
+	}
+}
+
+// shapeBounds 返回图形的外接矩形，不是计入的图形时返回false
+func shapeBounds(name string, attrs map[string]string) (x, y, w, h float64, ok bool) {
+	switch name {
+	case "rect":
+		return attrFloat(attrs, "x"), attrFloat(attrs, "y"), attrFloat(attrs, "width"), attrFloat(attrs, "height"), true
+	case "ellipse", "circle":
+		rx, ry := attrFloat(attrs, "rx"), attrFloat(attrs, "ry")
+		if name == "circle" {
+			rx, ry = attrFloat(attrs, "r"), attrFloat(attrs, "r")
+		}
+		return attrFloat(attrs, "cx") - rx, attrFloat(attrs, "cy") - ry, 2 * rx, 2 * ry, true
+	case "polygon":
+		fields := strings.FieldsFunc(attrs["points"], func(r rune) bool { return r == ',' || r == ' ' })
+		if len(fields) < 4 {
+			return 0, 0, 0, 0, false
+		}
+		minX, minY := math.Inf(1), math.Inf(1)
+		maxX, maxY := math.Inf(-1), math.Inf(-1)
+		for i := 0; i+1 < len(fields); i += 2 {
+			px, err1 := strconv.ParseFloat(fields[i], 64)
+			py, err2 := strconv.ParseFloat(fields[i+1], 64)
+			if err1 != nil || err2 != nil {
+				return 0, 0, 0, 0, false
+			}
+			minX, maxX = math.Min(minX, px), math.Max(maxX, px)
+			minY, maxY = math.Min(minY, py), math.Max(maxY, py)
+		}
+		return minX, minY, maxX - minX, maxY - minY, true
+	}
+	return 0, 0, 0, 0, false
+}
+
+// svgSize 返回<svg>的宽和高，优先使用width和height属性，没有时使用viewBox
+func svgSize(attrs map[string]string) (float64, float64) {
+	if w, h := attrFloat(attrs, "width"), attrFloat(attrs, "height"); w > 0 && h > 0 {
+		return w, h
+	}
+	if box := strings.Fields(strings.ReplaceAll(attrs["viewBox"], ",", " ")); len(box) == 4 {
+		w, _ := strconv.ParseFloat(box[2], 64)
+		h, _ := strconv.ParseFloat(box[3], 64)
+		return w, h
+	}
+	return 0, 0
+}
+
+// attrFloat 返回属性的数值，去掉px等单位，没有或无法解析时返回0
+func attrFloat(attrs map[string]string, name string) float64 {
+	v := strings.TrimRight(strings.TrimSpace(attrs[name]), "pxt%")
+	f, _ := strconv.ParseFloat(v, 64)
+	return f
+}
+
+// RegionAt 返回包含点(x, y)的面积最小的元素区域，即最内层的元素，例如包中的类。没有元素包含该点时返回false
+func RegionAt(regions []Region, x, y float64) (Region, bool) {
+	return smallestAt(regions, x, y, func(r Region) bool { return r.Name != "" })
+}
+
+// TooltipAt 返回包含点(x, y)并且有提示的面积最小的区域的提示，没有时返回false
+func TooltipAt(regions []Region, x, y float64) (string, bool) {
+	r, ok := smallestAt(regions, x, y, func(r Region) bool { return r.Tooltip != "" })
+	return r.Tooltip, ok
+}
+
+// smallestAt 返回包含点(x, y)并且满足match的面积最小的区域
+func smallestAt(regions []Region, x, y float64, match func(Region) bool) (Region, bool) {
+	var found Region
+	ok := false
+	for _, r := range regions {
+		if match(r) && r.contains(x, y) && (!ok || r.W*r.H < found.W*found.H) {
+			found, ok = r, true
+		}
+	}
+	return found, ok
+}
+
+// SourceLine 返回区域对应的元素在源码中定义的行（从1开始）：SVG中记录了源码行时直接使用，
+// 否则为按名称或别名声明该元素的行，没有声明时为名称（例如消息文字）第一次出现的行。找不到时返回0
+func SourceLine(source string, r Region) int {
+	if r.Line > 0 {
+		return r.Line
+	}
+	for _, e := range Parse(source) {
+		if e.ID == r.Name || e.Name == r.Name {
+			return e.Line
+		}
+	}
+	if positions := Occurrences(source, r.Name); len(positions) > 0 {
+		return positions[0].Line
+	}
+	for i, line := range sourceLines(source) {
+		if strings.Contains(line, r.Name) {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,384 @@
+package plantuml
+
+import (
+	"image/color"
+	"io"
+	"log"
+	"math"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/annotate"
+)
+
+// AnnotationTool 表示当前使用的标注工具
+type AnnotationTool int
+
+const (
+	// AnnotationOff 关闭标注模式，标注层不响应鼠标
+	AnnotationOff AnnotationTool = iota
+	// AnnotationArrow 拖动绘制箭头
+	AnnotationArrow
+	// AnnotationBox 拖动绘制方框
+	AnnotationBox
+	// AnnotationNote 点击添加文字说明
+	AnnotationNote
+	// AnnotationMeasure 拖动测量距离和外接矩形，测量结果不保存
+	AnnotationMeasure
+)
+
+// measureColor 测量线的颜色，与标注区分开
+var measureColor = color.NRGBA{R: 37, G: 99, B: 235, A: 255}
+
+// annotationLayer 是叠加在渲染图像上的标注层
+// 标注以图像像素坐标保存，显示时按图像当前的缩放和位置换算
+type annotationLayer struct {
+	widget.BaseWidget
+
+	viewer    *Viewer
+	dragStart fyne.Position
+	dragEnd   fyne.Position
+	dragging  bool
+	modifier  fyne.KeyModifier // 最近一次按下鼠标时按住的修饰键
+
+	// 最近一次测量的起点和终点（图像像素坐标）
+	measureFrom, measureTo [2]float32
+	hasMeasurement         bool
+}
+
+// newAnnotationLayer 创建标注层
+func newAnnotationLayer(v *Viewer) *annotationLayer {
+	l := &annotationLayer{viewer: v}
+	l.ExtendBaseWidget(l)
+	return l
+}
+
+// CreateRenderer 创建标注层的渲染器
+func (l *annotationLayer) CreateRenderer() fyne.WidgetRenderer {
+	return &annotationLayerRenderer{layer: l}
+}
+
+// MouseDown 记录按下鼠标时按住的修饰键，Tapped中据此区分按住Cmd的点击
+func (l *annotationLayer) MouseDown(ev *desktop.MouseEvent) {
+	l.modifier = ev.Modifier
+}
+
+// MouseUp 实现desktop.Mouseable
+func (l *annotationLayer) MouseUp(*desktop.MouseEvent) {}
+
+// MouseIn 实现desktop.Hoverable
+func (l *annotationLayer) MouseIn(ev *desktop.MouseEvent) {
+	l.MouseMoved(ev)
+}
+
+// MouseMoved 鼠标停留在元素上时显示它的提示
+func (l *annotationLayer) MouseMoved(ev *desktop.MouseEvent) {
+	x, y, ok := l.toImage(ev.Position)
+	if !ok {
+		l.viewer.hideTooltip()
+		return
+	}
+	l.viewer.hover(x, y, ev.AbsolutePosition, fyne.CurrentApp().Driver().CanvasForObject(l))
+}
+
+// MouseOut 离开图像时隐藏提示
+func (l *annotationLayer) MouseOut() {
+	l.viewer.hideTooltip()
+}
+
+// Tapped 文字工具下点击添加文字说明；没有使用标注工具时，按住Cmd点击跳到元素在源码中定义的行
+func (l *annotationLayer) Tapped(ev *fyne.PointEvent) {
+	v := l.viewer
+	x, y, ok := l.toImage(ev.Position)
+	if !ok {
+		return
+	}
+	if v.annotationTool == AnnotationOff && l.modifier&fyne.KeyModifierShortcutDefault != 0 {
+		v.jumpToSource(x, y)
+		return
+	}
+	if v.annotationTool != AnnotationNote || v.onNoteRequested == nil {
+		return
+	}
+	v.onNoteRequested(func(text string) {
+		if text == "" {
+			return
+		}
+		v.addAnnotation(annotate.Annotation{Kind: annotate.Note, X1: x, Y1: y, Text: text})
+	})
+}
+
+// Dragged 箭头和方框工具下拖动绘制，没有使用标注工具时拖动放大的图像
+func (l *annotationLayer) Dragged(ev *fyne.DragEvent) {
+	tool := l.viewer.annotationTool
+	if tool == AnnotationOff {
+		l.viewer.pan(ev.Dragged)
+		return
+	}
+	if tool != AnnotationArrow && tool != AnnotationBox && tool != AnnotationMeasure {
+		return
+	}
+	if !l.dragging {
+		l.dragging = true
+		l.dragStart = ev.Position.Subtract(ev.Dragged)
+	}
+	l.dragEnd = ev.Position
+	l.Refresh()
+}
+
+// DragEnd 拖动结束时保存标注
+func (l *annotationLayer) DragEnd() {
+	if !l.dragging {
+		return
+	}
+	l.dragging = false
+
+	x1, y1, ok1 := l.toImage(l.dragStart)
+	x2, y2, ok2 := l.toImage(l.dragEnd)
+	if !ok1 || !ok2 {
+		l.Refresh()
+		return
+	}
+
+	if l.viewer.annotationTool == AnnotationMeasure {
+		l.finishMeasure(x1, y1, x2, y2)
+		return
+	}
+
+	kind := annotate.Arrow
+	if l.viewer.annotationTool == AnnotationBox {
+		kind = annotate.Box
+	}
+	l.viewer.addAnnotation(annotate.Annotation{Kind: kind, X1: x1, Y1: y1, X2: x2, Y2: y2})
+}
+
+// finishMeasure 保存测量结果并通知回调
+func (l *annotationLayer) finishMeasure(x1, y1, x2, y2 float32) {
+	l.measureFrom = [2]float32{x1, y1}
+	l.measureTo = [2]float32{x2, y2}
+	l.hasMeasurement = true
+	l.Refresh()
+
+	text := annotate.Measure(x1, y1, x2, y2).Format(l.viewer.measureDPI)
+	log.Printf("测量结果: %s", text)
+	if l.viewer.onMeasured != nil {
+		l.viewer.onMeasured(text)
+	}
+}
+
+// imageRect 计算图像按“适应”模式显示时的缩放比例和左上角位置
+func (l *annotationLayer) imageRect() (scale float32, origin fyne.Position, ok bool) {
+	img := l.viewer.imageSize
+	size := l.Size()
+	if img.IsZero() || size.IsZero() {
+		return 0, fyne.Position{}, false
+	}
+	scale = float32(math.Min(float64(size.Width/img.Width), float64(size.Height/img.Height)))
+	origin = fyne.NewPos((size.Width-img.Width*scale)/2, (size.Height-img.Height*scale)/2)
+	return scale, origin, true
+}
+
+// toImage 将标注层坐标换算为图像像素坐标
+func (l *annotationLayer) toImage(p fyne.Position) (float32, float32, bool) {
+	scale, origin, ok := l.imageRect()
+	if !ok {
+		return 0, 0, false
+	}
+	return (p.X - origin.X) / scale, (p.Y - origin.Y) / scale, true
+}
+
+// annotationLayerRenderer 将标注绘制为Fyne的图形对象
+type annotationLayerRenderer struct {
+	layer   *annotationLayer
+	objects []fyne.CanvasObject
+}
+
+func (r *annotationLayerRenderer) Layout(fyne.Size) {
+	r.rebuild()
+}
+
+func (r *annotationLayerRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(0, 0)
+}
+
+func (r *annotationLayerRenderer) Refresh() {
+	r.rebuild()
+	canvas.Refresh(r.layer)
+}
+
+func (r *annotationLayerRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *annotationLayerRenderer) Destroy() {
+}
+
+// rebuild 根据当前标注和图像位置重新生成图形对象
+func (r *annotationLayerRenderer) rebuild() {
+	r.objects = nil
+	l := r.layer
+	scale, origin, ok := l.imageRect()
+	if !ok {
+		return
+	}
+	toLayer := func(x, y float32) fyne.Position {
+		return fyne.NewPos(origin.X+x*scale, origin.Y+y*scale)
+	}
+
+	for _, a := range l.viewer.annotations.Items {
+		switch a.Kind {
+		case annotate.Arrow:
+			r.addArrow(toLayer(a.X1, a.Y1), toLayer(a.X2, a.Y2))
+		case annotate.Box:
+			r.addBox(toLayer(a.X1, a.Y1), toLayer(a.X2, a.Y2))
+		case annotate.Note:
+			r.addNote(toLayer(a.X1, a.Y1), a.Text)
+		}
+	}
+
+	// 正在拖动时显示预览
+	if l.dragging {
+		switch l.viewer.annotationTool {
+		case AnnotationBox:
+			r.addBox(l.dragStart, l.dragEnd)
+		case AnnotationMeasure:
+			if x1, y1, ok := l.toImage(l.dragStart); ok {
+				x2, y2, _ := l.toImage(l.dragEnd)
+				r.addMeasure(l.dragStart, l.dragEnd, annotate.Measure(x1, y1, x2, y2).Format(l.viewer.measureDPI))
+			}
+		default:
+			r.addArrow(l.dragStart, l.dragEnd)
+		}
+	} else if l.hasMeasurement && l.viewer.annotationTool == AnnotationMeasure {
+		from, to := l.measureFrom, l.measureTo
+		text := annotate.Measure(from[0], from[1], to[0], to[1]).Format(l.viewer.measureDPI)
+		r.addMeasure(toLayer(from[0], from[1]), toLayer(to[0], to[1]), text)
+	}
+}
+
+// addMeasure 绘制测量线、外接矩形和测量结果
+func (r *annotationLayerRenderer) addMeasure(from, to fyne.Position, text string) {
+	box := canvas.NewRectangle(color.Transparent)
+	box.StrokeColor = measureColor
+	box.StrokeWidth = 1
+	box.Move(fyne.NewPos(float32(math.Min(float64(from.X), float64(to.X))), float32(math.Min(float64(from.Y), float64(to.Y)))))
+	box.Resize(fyne.NewSize(float32(math.Abs(float64(to.X-from.X))), float32(math.Abs(float64(to.Y-from.Y)))))
+
+	line := canvas.NewLine(measureColor)
+	line.StrokeWidth = 2
+	line.Position1 = from
+	line.Position2 = to
+
+	r.objects = append(r.objects, box, line)
+	r.addNote(to.Add(fyne.NewPos(8, 8)), text)
+}
+
+func (r *annotationLayerRenderer) addLine(from, to fyne.Position) {
+	line := canvas.NewLine(annotate.StrokeColor)
+	line.StrokeWidth = annotate.StrokeWidth
+	line.Position1 = from
+	line.Position2 = to
+	r.objects = append(r.objects, line)
+}
+
+func (r *annotationLayerRenderer) addArrow(from, to fyne.Position) {
+	r.addLine(from, to)
+	angle := math.Atan2(float64(to.Y-from.Y), float64(to.X-from.X))
+	for _, side := range []float64{-1, 1} {
+		a := angle + math.Pi - side*math.Pi/7
+		r.addLine(to, to.Add(fyne.NewPos(float32(annotate.ArrowHeadLength*math.Cos(a)), float32(annotate.ArrowHeadLength*math.Sin(a)))))
+	}
+}
+
+func (r *annotationLayerRenderer) addBox(from, to fyne.Position) {
+	rect := canvas.NewRectangle(color.Transparent)
+	rect.StrokeColor = annotate.StrokeColor
+	rect.StrokeWidth = annotate.StrokeWidth
+	rect.Move(fyne.NewPos(float32(math.Min(float64(from.X), float64(to.X))), float32(math.Min(float64(from.Y), float64(to.Y)))))
+	rect.Resize(fyne.NewSize(float32(math.Abs(float64(to.X-from.X))), float32(math.Abs(float64(to.Y-from.Y)))))
+	r.objects = append(r.objects, rect)
+}
+
+func (r *annotationLayerRenderer) addNote(pos fyne.Position, text string) {
+	label := canvas.NewText(text, annotate.NoteTextColor)
+	size := label.MinSize()
+	background := canvas.NewRectangle(annotate.NoteBackground)
+	background.Move(pos)
+	background.Resize(size.Add(fyne.NewSize(8, 8)))
+	label.Move(pos.Add(fyne.NewPos(4, 4)))
+	label.Resize(size)
+	r.objects = append(r.objects, background, label)
+}
+
+// addAnnotation 添加标注并保存到标注文件
+func (v *Viewer) addAnnotation(a annotate.Annotation) {
+	v.annotations.Add(a)
+	v.saveAnnotations()
+}
+
+// saveAnnotations 保存标注并刷新标注层，快照和虚拟文件的标注不保存
+func (v *Viewer) saveAnnotations() {
+	if v.frozen || v.virtual {
+		v.annotationLayer.Refresh()
+		return
+	}
+	if err := v.annotations.Save(v.filePath); err != nil {
+		log.Printf("保存标注失败: %v", err)
+	}
+	v.annotationLayer.Refresh()
+}
+
+// SetAnnotationTool 设置当前使用的标注工具
+func (v *Viewer) SetAnnotationTool(tool AnnotationTool) {
+	v.annotationTool = tool
+	if tool != AnnotationMeasure && v.annotationLayer.hasMeasurement {
+		v.annotationLayer.hasMeasurement = false
+		v.annotationLayer.Refresh()
+	}
+}
+
+// SetMeasureDPI 设置测量时将像素换算为毫米所用的DPI
+func (v *Viewer) SetMeasureDPI(dpi float64) {
+	v.measureDPI = dpi
+	v.annotationLayer.Refresh()
+}
+
+// SetOnMeasured 设置完成一次测量时的回调函数，参数为测量结果的文字描述
+func (v *Viewer) SetOnMeasured(callback func(string)) {
+	v.onMeasured = callback
+}
+
+// AnnotationTool 返回当前使用的标注工具
+func (v *Viewer) AnnotationTool() AnnotationTool {
+	return v.annotationTool
+}
+
+// SetOnNoteRequested 设置添加文字说明时用于输入文字的回调，输入完成后调用done
+func (v *Viewer) SetOnNoteRequested(callback func(done func(text string))) {
+	v.onNoteRequested = callback
+}
+
+// UndoAnnotation 撤销最后一条标注
+func (v *Viewer) UndoAnnotation() {
+	if v.annotations.Undo() {
+		v.saveAnnotations()
+	}
+}
+
+// ClearAnnotations 删除全部标注
+func (v *Viewer) ClearAnnotations() {
+	v.annotations.Clear()
+	v.saveAnnotations()
+}
+
+// ExportAnnotatedPNG 导出绘制了标注的PNG图像
+func (v *Viewer) ExportAnnotatedPNG(w io.Writer) error {
+	data, err := v.PNGImage()
+	if err != nil {
+		return err
+	}
+	return annotate.FlattenPNG(data, v.annotations, w)
+}
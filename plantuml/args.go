@@ -0,0 +1,28 @@
+package plantuml
+
+import "sync"
+
+// fileArgs 是为单个文件指定的额外PlantUML参数，按文件路径索引
+var (
+	fileArgsMu sync.Mutex
+	fileArgs   = make(map[string][]string)
+)
+
+// SetFileArgs 为文件指定查看时额外传给PlantUML的参数，调用方需要先用config.ValidateArgs检查；为空时取消指定。
+// 已经显示的图表需要重新渲染才会改变
+func SetFileArgs(filePath string, args []string) {
+	fileArgsMu.Lock()
+	defer fileArgsMu.Unlock()
+	if len(args) == 0 {
+		delete(fileArgs, filePath)
+	} else {
+		fileArgs[filePath] = append([]string(nil), args...)
+	}
+}
+
+// FileArgs 返回为文件指定的额外PlantUML参数，没有指定时为nil
+func FileArgs(filePath string) []string {
+	fileArgsMu.Lock()
+	defer fileArgsMu.Unlock()
+	return append([]string(nil), fileArgs[filePath]...)
+}
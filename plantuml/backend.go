@@ -0,0 +1,188 @@
+package plantuml
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/outline"
+)
+
+// BackendRenderer 通过render.Renderer渲染查看的图表：本地的PlantUML、常驻进程或Kroki服务，按设置在启动时选择（见NewRenderer）。
+// 查看时的渲染选项都在这里准备，具体怎样运行PlantUML由Backend决定。没有指定Backend时渲染经过渲染队列，每次渲染最长RenderTimeout
+type BackendRenderer struct {
+	Backend render.Renderer // 为nil时每次渲染启动新的PlantUML进程（render.Local{}）；NewRenderer创建的Backend已经经过渲染队列
+	ctx     context.Context // 为nil时只受RenderTimeout限制
+}
+
+// WithContext 实现ContextRenderer
+func (r BackendRenderer) WithContext(ctx context.Context) Renderer {
+	return BackendRenderer{Backend: r.Backend, ctx: ctx}
+}
+
+// context 返回一次渲染使用的ctx。RenderTimeout在渲染队列中开始运行时才计算，排队的时间不算在内
+func (r BackendRenderer) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// backend 返回渲染使用的render.Renderer
+func (r BackendRenderer) backend() render.Renderer {
+	if r.Backend == nil {
+		return queued{render.Local{}}
+	}
+	return r.Backend
+}
+
+// Formats 返回渲染器可以输出的格式
+func (r BackendRenderer) Formats() []string {
+	return r.backend().Formats()
+}
+
+// Render 实现Renderer，多页图表只渲染第一页
+func (r BackendRenderer) Render(filePath string) ([]byte, error) {
+	return r.RenderPage(filePath, 1)
+}
+
+// RenderPage 实现PageRenderer
+func (r BackendRenderer) RenderPage(filePath string, page int) ([]byte, error) {
+	opts, err := viewOptions(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return r.backend().RenderFile(r.context(), filePath, page, opts)
+}
+
+// RenderSVG 实现SVGRenderer，使用与查看时相同的渲染选项，但不按比例放大，坐标为PlantUML默认的像素坐标
+func (r BackendRenderer) RenderSVG(filePath string, page int) ([]byte, error) {
+	opts, err := viewOptions(filePath)
+	if err != nil {
+		return nil, err
+	}
+	opts.Format = "svg"
+	opts.DPI = 0
+	return r.backend().RenderFile(r.context(), filePath, page, opts)
+}
+
+// RenderSource 实现SourceRenderer，通过标准输入把源码交给PlantUML，不需要写入文件
+func (r BackendRenderer) RenderSource(source []byte, dir string, page int) ([]byte, error) {
+	opts := render.Options{Args: viewArgs()}
+	applyFont(&opts)
+	applyManaged(&opts)
+	return r.backend().RenderBytes(r.context(), source, dir, page, opts)
+}
+
+// NewRenderer 按设置中的renderer（见config.Renderers）创建查看时使用的渲染器，返回的close在退出时调用，
+// 结束常驻的PlantUML进程。管理员不允许的PlantUML和禁止访问网络时的Kroki返回错误。
+// 没有关闭磁盘缓存（renderCacheMB）时，渲染结果保存在用户缓存目录中，重新打开没有变化的文件时不用再运行PlantUML；
+// 没有命中缓存的渲染经过渲染队列，同一时间最多运行MaxRenders个
+func NewRenderer(settings *config.Config) (Renderer, func(), error) {
+	backend, closeBackend, key, err := newBackend(settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	return BackendRenderer{Backend: cached(queued{backend}, key, settings)}, closeBackend, nil
+}
+
+// newBackend 按设置创建渲染器，同时返回它在磁盘缓存中的标识：渲染器的类型、Kroki的地址或本机PlantUML的安装
+func newBackend(settings *config.Config) (render.Renderer, func(), string, error) {
+	name := settings.EffectiveRenderer()
+	m := managed.Load()
+	switch name {
+	case config.RendererAuto:
+		return render.Local{}, func() {}, name + " " + installKey(), nil
+	case config.RendererJar, config.RendererCommand:
+		if m != nil && !m.AllowsBackend(name) {
+			return nil, nil, "", fmt.Errorf("管理员不允许使用 PlantUML %s", name)
+		}
+		return render.Local{Backend: render.Backend(name)}, func() {}, name + " " + installKey(), nil
+	case config.RendererPipe:
+		pool := render.NewPool(settings.PipeRenderers, time.Duration(settings.PipeIdleTimeout*float64(time.Second)))
+		log.Printf("使用%d个常驻的PlantUML进程渲染", max(settings.PipeRenderers, 1))
+		return pool, pool.Close, name + " " + installKey(), nil
+	case config.RendererKroki:
+		if m != nil && m.DisableNetwork {
+			return nil, nil, "", fmt.Errorf("管理员禁止访问网络，不能通过Kroki服务渲染")
+		}
+		url := settings.KrokiURL
+		if url == "" {
+			url = render.DefaultKrokiURL
+		}
+		log.Printf("通过Kroki服务 %s 渲染", url)
+		return render.Kroki{URL: url}, func() {}, name + " " + url, nil
+	}
+	return nil, nil, "", fmt.Errorf("未知的渲染器 %s（可选: %v）", name, config.Renderers)
+}
+
+// cached 按设置把backend包装为保存在用户缓存目录中的render.Cached，并在后台删除超出大小的最久没有使用的缓存
+func cached(backend render.Renderer, key string, settings *config.Config) render.Renderer {
+	limit := settings.RenderCacheBytes()
+	if limit == 0 {
+		return backend
+	}
+	dir, err := render.DefaultCacheDir()
+	if err != nil {
+		log.Printf("不使用渲染缓存: %v", err)
+		return backend
+	}
+	go func() {
+		removed, err := render.PruneCache(dir, limit)
+		if err != nil {
+			log.Printf("无法清理渲染缓存: %v", err)
+		} else if removed > 0 {
+			log.Printf("已从渲染缓存中删除%d个最久没有使用的文件", removed)
+		}
+	}()
+	return render.Cached{Renderer: backend, Dir: dir, Key: key, Dependencies: Dependencies}
+}
+
+// installKey 返回本机plantuml.jar和plantuml命令行工具的路径和修改时间，升级PlantUML后缓存随之失效
+func installKey() string {
+	var parts []string
+	paths := []string{render.FindJar()}
+	if command, err := exec.LookPath("plantuml"); err == nil {
+		paths = append(paths, command)
+	}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			parts = append(parts, fmt.Sprintf("%s@%d", path, info.ModTime().UnixNano()))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Dependencies 返回影响渲染结果的其他本地文件：引用的图片和!include的文件，包括被引用的文件中再引用的文件。
+// 渲染缓存、批量转换的缓存和守护进程都按这些文件的内容判断结果是否过期
+func Dependencies(source []byte, dir string) []string {
+	files := render.ImageFiles(source, dir)
+	seen := make(map[string]bool)
+	queue := outline.Includes(string(source), dir)
+	for len(queue) > 0 && len(seen) < maxDependencies {
+		file := queue[0]
+		queue = queue[1:]
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		files = append(files, file)
+		if data, err := ioutil.ReadFile(file); err == nil {
+			files = append(files, render.ImageFiles(data, filepath.Dir(file))...)
+			queue = append(queue, outline.Includes(string(data), filepath.Dir(file))...)
+		}
+	}
+	return files
+}
+
+// maxDependencies 是计算缓存摘要时最多读取的!include文件数，避免很大的引用树拖慢打开
+const maxDependencies = 200
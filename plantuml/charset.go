@@ -0,0 +1,79 @@
+package plantuml
+
+import (
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/charset"
+)
+
+// defaultCharset 是没有为文件指定编码时使用的编码，为空时自动识别
+var defaultCharset atomic.Value
+
+// SetDefaultCharset 设置没有为文件单独指定编码时使用的编码（charset.Names中的名称），为空时自动识别
+func SetDefaultCharset(name string) {
+	defaultCharset.Store(name)
+}
+
+// fileCharsets 是为单个文件指定的编码，按文件路径索引
+var (
+	fileCharsetsMu sync.Mutex
+	fileCharsets   = make(map[string]string)
+)
+
+// SetFileCharset 为文件指定编码，name为空时取消指定，恢复为项目配置、默认编码或自动识别。
+// 已经显示的图表需要重新渲染才会改变
+func SetFileCharset(filePath, name string) {
+	fileCharsetsMu.Lock()
+	defer fileCharsetsMu.Unlock()
+	if name == "" {
+		delete(fileCharsets, filePath)
+	} else {
+		fileCharsets[filePath] = name
+	}
+}
+
+// FileCharset 返回为文件单独指定的编码，没有指定时为空字符串
+func FileCharset(filePath string) string {
+	fileCharsetsMu.Lock()
+	defer fileCharsetsMu.Unlock()
+	return fileCharsets[filePath]
+}
+
+// Charset 返回文件使用的编码，依次取为文件指定的编码、项目渲染配置中的编码和默认编码，
+// 都没有设置时根据文件内容自动识别。文件无法读取时返回空字符串
+func Charset(filePath string) string {
+	if name := configuredCharset(filePath); name != "" {
+		return name
+	}
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return ""
+	}
+	return charset.Detect(data)
+}
+
+// configuredCharset 返回为文件设置的编码，没有设置时为空字符串，表示自动识别
+func configuredCharset(filePath string) string {
+	if name := FileCharset(filePath); name != "" {
+		return name
+	}
+	if _, profile, err := config.ProfileFor(filePath); err == nil && profile.Charset != "" {
+		if name, err := charset.Normalize(profile.Charset); err == nil && name != "" {
+			return name
+		}
+	}
+	name, _ := defaultCharset.Load().(string)
+	return name
+}
+
+// ReadSource 读取文件的源码并按文件使用的编码转换为UTF-8，用于显示大纲、错误所在的行等
+func ReadSource(filePath string) (string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	return charset.Decode(data, configuredCharset(filePath))
+}
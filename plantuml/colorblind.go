@@ -0,0 +1,154 @@
+package plantuml
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+)
+
+// colorBlindSafe 是否把查看的图像中红绿色盲难以区分的颜色重新映射，后台渲染时也会读取
+var colorBlindSafe atomic.Bool
+
+// SetColorBlindSafe 设置之后查看的图像是否经过RemapColorBlind处理，只影响查看，导出的文件不变。
+// 已经显示的图表需要重新渲染才会改变
+func SetColorBlindSafe(on bool) {
+	colorBlindSafe.Store(on)
+}
+
+// ColorBlindSafe 返回查看的图像是否经过色盲友好的颜色映射
+func ColorBlindSafe() bool {
+	return colorBlindSafe.Load()
+}
+
+const (
+	// colorBlindMinSaturation 饱和度低于该值的颜色接近黑白灰，不做映射
+	colorBlindMinSaturation = 0.15
+	// colorBlindMinValue 明度低于该值的颜色接近黑色，不做映射
+	colorBlindMinValue = 0.15
+)
+
+// hueStops 是色相的分段线性映射，单位为度。红、橙、黄保持不变，绿色移到天蓝，
+// 原来的青色和蓝色向紫色方向压缩，避免与移过来的绿色重合。
+// 这样状态图、时序图中用红绿区分的元素变为红蓝，红绿色盲也能区分
+var hueStops = [][2]float64{
+	{0, 0},
+	{60, 60},
+	{90, 175},
+	{150, 205},
+	{270, 270},
+	{360, 360},
+}
+
+// RemapColorBlind 按hueStops重新映射PNG图像中的彩色像素，保持饱和度、明度和透明度，返回新的PNG
+func RemapColorBlind(data []byte) ([]byte, error) {
+	src, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("无法解码图像: %v", err)
+	}
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+			dst.SetNRGBA(x, y, remapColor(c))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, fmt.Errorf("无法编码图像: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// svgColorPattern 匹配SVG中以#RRGGBB表示的颜色，PlantUML输出的SVG中颜色都是这种形式
+var svgColorPattern = regexp.MustCompile(`#[0-9A-Fa-f]{6}\b`)
+
+// RemapColorBlindSVG 按hueStops重新映射SVG中的颜色，与RemapColorBlind对PNG像素的映射相同
+func RemapColorBlindSVG(data []byte) []byte {
+	return svgColorPattern.ReplaceAllFunc(data, func(hex []byte) []byte {
+		v, err := strconv.ParseUint(string(hex[1:]), 16, 32)
+		if err != nil {
+			return hex
+		}
+		c := remapColor(color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff})
+		return []byte(fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B))
+	})
+}
+
+// remapColor 映射单个颜色的色相，灰色和接近黑色的颜色不变
+func remapColor(c color.NRGBA) color.NRGBA {
+	h, s, v := rgbToHSV(c.R, c.G, c.B)
+	if s < colorBlindMinSaturation || v < colorBlindMinValue {
+		return c
+	}
+	r, g, b := hsvToRGB(mapHue(h), s, v)
+	return color.NRGBA{R: r, G: g, B: b, A: c.A}
+}
+
+// mapHue 按hueStops映射色相h（0到360度）
+func mapHue(h float64) float64 {
+	for i := 1; i < len(hueStops); i++ {
+		from, to := hueStops[i-1], hueStops[i]
+		if h <= to[0] {
+			return from[1] + (h-from[0])*(to[1]-from[1])/(to[0]-from[0])
+		}
+	}
+	return h
+}
+
+// rgbToHSV 返回颜色的色相（0到360度）、饱和度和明度（0到1）
+func rgbToHSV(r8, g8, b8 uint8) (h, s, v float64) {
+	r, g, b := float64(r8)/255, float64(g8)/255, float64(b8)/255
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	v = max
+	d := max - min
+	if max == 0 || d == 0 {
+		return 0, 0, v
+	}
+	s = d / max
+	switch max {
+	case r:
+		h = math.Mod((g-b)/d, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return h, s, v
+}
+
+// hsvToRGB 是rgbToHSV的逆变换
+func hsvToRGB(h, s, v float64) (r, g, b uint8) {
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+	var rf, gf, bf float64
+	switch {
+	case h < 60:
+		rf, gf, bf = c, x, 0
+	case h < 120:
+		rf, gf, bf = x, c, 0
+	case h < 180:
+		rf, gf, bf = 0, c, x
+	case h < 240:
+		rf, gf, bf = 0, x, c
+	case h < 300:
+		rf, gf, bf = x, 0, c
+	default:
+		rf, gf, bf = c, 0, x
+	}
+	to8 := func(f float64) uint8 { return uint8(math.Round((f + m) * 255)) }
+	return to8(rf), to8(gf), to8(bf)
+}
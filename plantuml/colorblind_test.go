@@ -0,0 +1,69 @@
+package plantuml
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestRemapColorBlind(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{R: 0, G: 200, B: 0, A: 255})     // 绿色
+	src.SetNRGBA(1, 0, color.NRGBA{R: 220, G: 0, B: 0, A: 255})     // 红色
+	src.SetNRGBA(2, 0, color.NRGBA{R: 254, G: 254, B: 206, A: 128}) // PlantUML默认的浅黄背景
+	src.SetNRGBA(3, 0, color.NRGBA{R: 128, G: 128, B: 128, A: 255}) // 灰色
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := RemapColorBlind(buf.Bytes())
+	if err != nil {
+		t.Fatalf("RemapColorBlind: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(x int) color.NRGBA { return color.NRGBAModel.Convert(img.At(x, 0)).(color.NRGBA) }
+
+	if green := at(0); green.B <= green.G || green.R != 0 {
+		t.Errorf("绿色应映射为蓝色，得到 %v", green)
+	}
+	for x := 1; x < 4; x++ {
+		if got := at(x); got != src.NRGBAAt(x, 0) {
+			t.Errorf("第%d个像素不应改变，得到 %v，原来为 %v", x, got, src.NRGBAAt(x, 0))
+		}
+	}
+
+	if _, err := RemapColorBlind([]byte("not a png")); err == nil {
+		t.Error("不是PNG时应返回错误")
+	}
+}
+
+func TestMapHue(t *testing.T) {
+	tests := []struct{ hue, want float64 }{
+		{0, 0}, {60, 60}, {120, 190}, {150, 205}, {240, 253.75}, {300, 300},
+	}
+	for _, tt := range tests {
+		if got := mapHue(tt.hue); got-tt.want > 1e-9 || tt.want-got > 1e-9 {
+			t.Errorf("mapHue(%v) = %v，应为 %v", tt.hue, got, tt.want)
+		}
+	}
+}
+
+func TestRemapColorBlindSVG(t *testing.T) {
+	svg := `<rect fill="#00C800" stroke="#181818"/><text fill="#DC0000">A</text><path d="M#00C80"/>`
+	got := string(RemapColorBlindSVG([]byte(svg)))
+	if strings.Contains(got, "#00C800") {
+		t.Errorf("绿色应被映射，得到 %s", got)
+	}
+	for _, unchanged := range []string{`stroke="#181818"`, `fill="#DC0000"`, `d="M#00C80"`} {
+		if !strings.Contains(got, unchanged) {
+			t.Errorf("%s 不应改变，得到 %s", unchanged, got)
+		}
+	}
+}
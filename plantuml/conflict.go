@@ -0,0 +1,86 @@
+package plantuml
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/outline"
+)
+
+// conflictSideSize 是并排显示冲突两边的版本时，每一边图像最大的初始尺寸
+const conflictSideSize = 480
+
+// ConflictError 表示文件中有git合并冲突标记。带标记的源码交给PlantUML只会得到令人困惑的语法错误，
+// 因此查看器把冲突两边的版本分别渲染，并排显示
+type ConflictError struct {
+	outline.Conflict
+	Ours, Theirs       []byte // 两个版本渲染的PNG，渲染失败时为nil
+	OursErr, TheirsErr error
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("文件中有%d处合并冲突（从第%d行开始）", e.Count, e.Line)
+}
+
+// renderConflict 分别渲染冲突两边的版本，!include等相对路径相对于文件所在的目录。返回的总是*ConflictError
+func (v *Viewer) renderConflict(renderer Renderer, c outline.Conflict) error {
+	log.Printf("文件 %s 中有%d处合并冲突，分别渲染两边的版本", logging.Path(v.filePath), c.Count)
+	e := &ConflictError{Conflict: c}
+	sourceRenderer, ok := renderer.(SourceRenderer)
+	if !ok {
+		e.OursErr = fmt.Errorf("渲染器不支持直接渲染源码")
+		e.TheirsErr = e.OursErr
+		return e
+	}
+	dir := filepath.Dir(v.filePath)
+	e.Ours, e.OursErr = sourceRenderer.RenderSource([]byte(c.Ours), dir, v.Page())
+	e.Theirs, e.TheirsErr = sourceRenderer.RenderSource([]byte(c.Theirs), dir, v.Page())
+	return e
+}
+
+// conflictView 返回合并冲突状态的内容：上方说明冲突的位置，下方左右并排显示冲突两边的版本
+func conflictView(e *ConflictError) fyne.CanvasObject {
+	title := widget.NewLabel(fmt.Sprintf("合并冲突：文件中有%d处冲突标记（从第%d行开始），左右分别为冲突两边的版本，解决冲突并保存后自动刷新", e.Count, e.Line))
+	title.Alignment = fyne.TextAlignCenter
+	title.Wrapping = fyne.TextWrapWord
+	sides := container.NewGridWithColumns(2,
+		conflictSide(conflictLabel("当前版本", e.OursLabel), "conflict_ours.png", e.Ours, e.OursErr),
+		conflictSide(conflictLabel("合并进来的版本", e.TheirsLabel), "conflict_theirs.png", e.Theirs, e.TheirsErr),
+	)
+	return container.NewBorder(title, nil, nil, nil, sides)
+}
+
+// conflictLabel 返回冲突一边的标题，冲突标记中有名称（例如分支名）时附在后面
+func conflictLabel(side, name string) string {
+	if name == "" {
+		return side
+	}
+	return fmt.Sprintf("%s（%s）", side, name)
+}
+
+// conflictSide 返回冲突一边的标题和图像，渲染失败时显示错误
+func conflictSide(label, name string, data []byte, err error) fyne.CanvasObject {
+	header := widget.NewLabelWithStyle(label, fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
+	if err != nil {
+		message := widget.NewLabel(fmt.Sprintf("无法渲染: %v", err))
+		message.Wrapping = fyne.TextWrapWord
+		return container.NewBorder(header, nil, nil, nil, message)
+	}
+	res := fyne.NewStaticResource(name, data)
+	img := canvas.NewImageFromResource(res)
+	img.FillMode = canvas.ImageFillContain
+	// 按原来的比例缩小到不超过conflictSideSize，窗口更大时随之放大
+	size := imageSizeOf(res)
+	if scale := conflictSideSize / fyne.Max(size.Width, size.Height); scale < 1 {
+		size = fyne.NewSize(size.Width*scale, size.Height*scale)
+	}
+	img.SetMinSize(size)
+	return container.NewBorder(header, nil, nil, nil, img)
+}
@@ -0,0 +1,150 @@
+package plantuml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/internal/secret"
+)
+
+// ageIdentity 是解密age文件默认使用的密钥文件
+var ageIdentity atomic.Value
+
+// SetAgeIdentity 设置解密age文件默认使用的密钥文件，为空时打开age文件需要先选择密钥文件
+func SetAgeIdentity(path string) {
+	ageIdentity.Store(path)
+}
+
+// AgeIdentity 返回解密age文件默认使用的密钥文件
+func AgeIdentity() string {
+	path, _ := ageIdentity.Load().(string)
+	return path
+}
+
+// rememberedKeys 是本次运行中解密成功过的凭据，以加密格式为键，打开同一格式的其他文件时先试用，不用再次输入。
+// 只保存在内存中，退出或调用ForgetKeys后清除
+var rememberedKeys sync.Map
+
+// ForgetKeys 清除内存中记住的所有解密凭据，已经打开的加密文件之后重新渲染时需要再次输入
+func ForgetKeys() {
+	rememberedKeys.Range(func(kind, _ any) bool {
+		rememberedKeys.Delete(kind)
+		return true
+	})
+	log.Printf("已清除内存中的解密凭据")
+}
+
+// LockedError 表示文件已加密，需要密钥文件或口令才能显示
+type LockedError struct {
+	Kind string // secret.KindAge或secret.KindGPG
+	Err  error  // 解密失败的原因
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("文件以%s加密，%v", e.Kind, e.Err)
+}
+
+func (e *LockedError) Unwrap() error {
+	return e.Err
+}
+
+// Encrypted 返回文件的加密格式（secret.KindAge或secret.KindGPG），没有加密时返回空字符串
+func (v *Viewer) Encrypted() string {
+	kind, _ := v.encrypted.Load().(string)
+	return kind
+}
+
+// SetKey 设置解密这个文件使用的凭据并在后台重新渲染，凭据只保存在内存中
+func (v *Viewer) SetKey(key secret.Key) {
+	v.keyMu.Lock()
+	v.key = key
+	v.keyMu.Unlock()
+	go v.renderPlantUML()
+}
+
+// SetOnUnlockRequested 设置打开加密文件缺少凭据时点击解锁的回调，输入凭据后调用done
+func (v *Viewer) SetOnUnlockRequested(callback func(kind string, done func(secret.Key))) {
+	v.onUnlockRequested = callback
+}
+
+// decryptionKey 返回解密使用的凭据：优先使用为这个文件设置的凭据，其次是本次运行中记住的凭据，
+// age文件最后使用默认的密钥文件
+func (v *Viewer) decryptionKey(kind string) (secret.Key, bool) {
+	v.keyMu.Lock()
+	key := v.key
+	v.keyMu.Unlock()
+	if key != (secret.Key{}) {
+		return key, true
+	}
+	if remembered, ok := rememberedKeys.Load(kind); ok {
+		return remembered.(secret.Key), false
+	}
+	if kind == secret.KindAge {
+		key.Identity = AgeIdentity()
+	}
+	return key, false
+}
+
+// renderEncrypted 在内存中解密文件后通过标准输入交给渲染器，明文不写入磁盘。缺少凭据或凭据不对时返回*LockedError
+func (v *Viewer) renderEncrypted(ctx context.Context, renderer Renderer, kind string, data []byte) ([]byte, error) {
+	sourceRenderer, ok := renderer.(SourceRenderer)
+	if !ok {
+		return nil, fmt.Errorf("渲染器不支持渲染加密的图表")
+	}
+	if kind == secret.KindAge && secret.NeedsPassphrase(data) {
+		return nil, fmt.Errorf("以口令加密的age文件只能在终端中解密，请改用密钥文件加密（age -r 或 -R）")
+	}
+
+	key, own := v.decryptionKey(kind)
+	// 解密不经过渲染队列，单独限制最长RenderTimeout
+	ctx, cancel := context.WithTimeout(ctx, RenderTimeout())
+	defer cancel()
+	plain, err := secret.Decrypt(ctx, v.filePath, kind, key)
+	if errors.Is(err, secret.ErrKeyNeeded) {
+		if own {
+			// 输入的凭据不对，清除后重新询问
+			v.keyMu.Lock()
+			v.key = secret.Key{}
+			v.keyMu.Unlock()
+		}
+		return nil, &LockedError{Kind: kind, Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	rememberedKeys.Store(kind, key)
+	log.Printf("已在内存中解密 %s（%s）", logging.Path(v.filePath), kind)
+	return sourceRenderer.RenderSource(plain, filepath.Dir(v.filePath), v.Page())
+}
+
+// showLocked 显示加密文件缺少凭据的提示和解锁按钮，点击后通过回调请求输入凭据
+func (v *Viewer) showLocked(e *LockedError) {
+	what := "口令"
+	if e.Kind == secret.KindAge {
+		what = "密钥文件"
+	}
+	message := widget.NewLabel(fmt.Sprintf("这个图表以%s加密，需要%s才能显示。解密后的内容只保存在内存中\n%v", e.Kind, what, e.Err))
+	message.Alignment = fyne.TextAlignCenter
+	unlock := widget.NewButtonWithIcon("解锁...", theme.AccountIcon(), func() {
+		// 首次打开时的错误在设置回调之前显示，点击时再读取回调
+		if v.onUnlockRequested != nil {
+			v.onUnlockRequested(e.Kind, v.SetKey)
+		}
+	})
+	unlock.Importance = widget.HighImportance
+	fyne.Do(func() {
+		v.container.Objects = []fyne.CanvasObject{container.NewCenter(container.NewVBox(message, container.NewCenter(unlock)))}
+		v.container.Refresh()
+	})
+}
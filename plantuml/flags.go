@@ -0,0 +1,50 @@
+package plantuml
+
+import (
+	"sync"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+)
+
+// fileFlags 是为单个文件打开的预处理开关，按文件路径索引
+var (
+	fileFlagsMu sync.Mutex
+	fileFlags   = make(map[string][]string)
+)
+
+// SetFileFlags 为文件打开预处理开关：查看时以 -D名称 定义这些变量，显示 !ifdef 保护的细节；为空时全部关闭。
+// 已经显示的图表需要重新渲染才会改变
+func SetFileFlags(filePath string, flags []string) {
+	fileFlagsMu.Lock()
+	defer fileFlagsMu.Unlock()
+	if len(flags) == 0 {
+		delete(fileFlags, filePath)
+	} else {
+		fileFlags[filePath] = append([]string(nil), flags...)
+	}
+}
+
+// FileFlags 返回为文件打开的预处理开关，没有打开时为nil
+func FileFlags(filePath string) []string {
+	fileFlagsMu.Lock()
+	defer fileFlagsMu.Unlock()
+	return append([]string(nil), fileFlags[filePath]...)
+}
+
+// applyFlags 把为文件打开的预处理开关加入opts的预处理变量，渲染配置中已经定义的变量保持原来的值
+func applyFlags(opts *render.Options, filePath string) {
+	flags := FileFlags(filePath)
+	if len(flags) == 0 {
+		return
+	}
+	defines := make(map[string]string, len(opts.Defines)+len(flags))
+	for name, value := range opts.Defines {
+		defines[name] = value
+	}
+	for _, name := range flags {
+		if _, ok := defines[name]; !ok {
+			defines[name] = "true"
+		}
+	}
+	opts.Defines = defines
+}
@@ -0,0 +1,91 @@
+package plantuml
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+)
+
+// 图表使用的字体和Java的默认编码，查看和导出都会使用，后台渲染时也会读取
+var (
+	fontName     atomic.Value
+	javaEncoding atomic.Value
+)
+
+// SuggestedFonts 是设置图表字体时建议的字体，能显示中日韩文字以及阿拉伯文、希伯来文等从右向左书写的文字
+var SuggestedFonts = []string{
+	"PingFang SC",
+	"Hiragino Sans",
+	"Apple SD Gothic Neo",
+	"Noto Sans CJK SC",
+	"Arial Unicode MS",
+	"Geeza Pro",
+	"Arial Hebrew",
+}
+
+// FontPreviewSource 是预览字体时渲染的图表，包含中日韩文字和从右向左书写的文字
+const FontPreviewSource = `@startuml
+participant "用户 ユーザー 사용자" as A
+participant "مستخدم משתמש" as B
+A -> B: 登录 ログイン 로그인
+B --> A: مرحبا שלום
+@enduml
+`
+
+// SetFont 设置图表使用的字体和Java的默认编码（file.encoding），为空时使用PlantUML和Java的默认值。
+// 字体以 skinparam defaultFontName 注入，图表中自己设置的字体优先。已经显示的图表需要重新渲染才会改变
+func SetFont(name, encoding string) {
+	fontName.Store(name)
+	javaEncoding.Store(encoding)
+}
+
+// Font 返回图表使用的字体和Java的默认编码，没有设置时为空字符串
+func Font() (name, encoding string) {
+	name, _ = fontName.Load().(string)
+	encoding, _ = javaEncoding.Load().(string)
+	return name, encoding
+}
+
+// ValidateJavaEncoding 检查Java的默认编码能否通过JAVA_TOOL_OPTIONS传递
+func ValidateJavaEncoding(encoding string) error {
+	if strings.ContainsAny(encoding, " \t\r\n") {
+		return fmt.Errorf("无效的Java编码: %q", encoding)
+	}
+	return nil
+}
+
+// fontOptions 返回使用字体name和Java的默认编码encoding的渲染选项
+func fontOptions(name, encoding string) render.Options {
+	var opts render.Options
+	if name != "" {
+		opts.Args = []string{"-SdefaultFontName=" + name}
+	}
+	if encoding != "" {
+		opts.JavaOptions = []string{"-Dfile.encoding=" + encoding}
+	}
+	return opts
+}
+
+// applyFont 在渲染选项中加上设置的字体和Java的默认编码
+func applyFont(opts *render.Options) {
+	font := fontOptions(Font())
+	opts.Args = append(opts.Args, font.Args...)
+	opts.JavaOptions = append(opts.JavaOptions, font.JavaOptions...)
+}
+
+// RenderFontPreview 以字体name和Java的默认编码encoding渲染FontPreviewSource，用于在设置中预览，
+// 不改变当前的设置。字体不存在时PlantUML会使用默认字体，无法显示的文字显示为方框
+func RenderFontPreview(ctx context.Context, name, encoding string) ([]byte, error) {
+	if err := ValidateJavaEncoding(encoding); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, RenderTimeout())
+	defer cancel()
+	opts := fontOptions(name, encoding)
+	applyManaged(&opts)
+	return render.RenderSourceContext(ctx, []byte(FontPreviewSource), os.TempDir(), 1, opts)
+}
@@ -0,0 +1,119 @@
+package plantuml
+
+import (
+	"archive/zip"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 布局引擎：为空时使用PlantUML默认的Graphviz
+const (
+	LayoutSmetana = "smetana" // PlantUML内置的纯Java布局引擎，不需要Graphviz，大图也不会卡住
+	LayoutELK     = "elk"     // Eclipse Layout Kernel，需要带ELK的plantuml.jar
+)
+
+// LayoutEngines 是可以为文件指定的布局引擎
+var LayoutEngines = []string{LayoutSmetana, LayoutELK}
+
+// fileLayouts 是为单个文件指定的布局引擎，按文件路径索引
+var (
+	fileLayoutsMu sync.Mutex
+	fileLayouts   = make(map[string]string)
+)
+
+// SetFileLayout 为文件指定查看时使用的布局引擎，engine为空时恢复为Graphviz。
+// 已经显示的图表需要重新渲染才会改变
+func SetFileLayout(filePath, engine string) {
+	fileLayoutsMu.Lock()
+	defer fileLayoutsMu.Unlock()
+	if engine == "" {
+		delete(fileLayouts, filePath)
+	} else {
+		fileLayouts[filePath] = engine
+	}
+}
+
+// FileLayout 返回为文件指定的布局引擎，没有指定时为空字符串
+func FileLayout(filePath string) string {
+	fileLayoutsMu.Lock()
+	defer fileLayoutsMu.Unlock()
+	return fileLayouts[filePath]
+}
+
+// layoutArgs 返回文件的布局引擎对应的PlantUML参数，使用Graphviz时为nil
+func layoutArgs(filePath string) []string {
+	if engine := FileLayout(filePath); engine != "" {
+		return []string{"-Playout=" + engine}
+	}
+	return nil
+}
+
+// graphvizErrorPattern 匹配Graphviz不可用或执行失败时PlantUML的错误输出
+var graphvizErrorPattern = regexp.MustCompile(`(?i)graphviz|dot executable|cannot run program "?dot`)
+
+// NeedsOtherLayout 判断渲染错误是否可能换一个布局引擎就能解决：超时（大图在Graphviz中布局太慢）
+// 或者Graphviz不可用、执行失败
+func NeedsOtherLayout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if IsTimeout(err) {
+		return true
+	}
+	var renderErr *RenderError
+	if errors.As(err, &renderErr) && graphvizErrorPattern.MatchString(renderErr.Output) {
+		return true
+	}
+	return graphvizErrorPattern.MatchString(err.Error())
+}
+
+// elkAvailable 缓存ELKAvailable的结果，检查需要读取plantuml.jar的目录
+var (
+	elkOnce      sync.Once
+	elkAvailable bool
+)
+
+// ELKAvailable 返回本机的plantuml.jar是否带有ELK布局引擎。只使用plantuml命令行工具时无法判断，返回false
+func ELKAvailable() bool {
+	elkOnce.Do(func() {
+		jar := FindJar()
+		if jar == "" {
+			return
+		}
+		r, err := zip.OpenReader(jar)
+		if err != nil {
+			return
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if strings.HasPrefix(f.Name, "org/eclipse/elk/") {
+				elkAvailable = true
+				return
+			}
+		}
+	})
+	return elkAvailable
+}
+
+// AvailableLayouts 返回本机可以使用的布局引擎，ELK不可用时只有Smetana
+func AvailableLayouts() []string {
+	if ELKAvailable() {
+		return LayoutEngines
+	}
+	return []string{LayoutSmetana}
+}
+
+// LayoutLabel 返回布局引擎在界面中显示的名称，空字符串表示Graphviz
+func LayoutLabel(engine string) string {
+	switch engine {
+	case "":
+		return "Graphviz"
+	case LayoutSmetana:
+		return "Smetana"
+	case LayoutELK:
+		return "ELK"
+	}
+	return engine
+}
@@ -0,0 +1,44 @@
+package plantuml
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNeedsOtherLayout(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&RenderError{Err: context.DeadlineExceeded}, true},
+		{&RenderError{Output: "Dot Executable: /opt/local/bin/dot\nFile does not exist\nCannot find Graphviz.", Err: errors.New("exit status 200")}, true},
+		{&RenderError{Line: 3, Output: "Error line 3 in file", Err: errors.New("exit status 200")}, false},
+		{&RenderError{Err: context.Canceled}, false},
+	}
+	for _, tt := range tests {
+		if got := NeedsOtherLayout(tt.err); got != tt.want {
+			t.Errorf("NeedsOtherLayout(%v) = %v，应为 %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestFileLayout(t *testing.T) {
+	defer SetFileLayout("/a.puml", "")
+	if args := layoutArgs("/a.puml"); args != nil {
+		t.Fatalf("没有指定布局引擎时不应加参数，得到 %v", args)
+	}
+	SetFileLayout("/a.puml", LayoutSmetana)
+	if args := layoutArgs("/a.puml"); !reflect.DeepEqual(args, []string{"-Playout=smetana"}) {
+		t.Fatalf("layoutArgs = %v", args)
+	}
+	if args := layoutArgs("/b.puml"); args != nil {
+		t.Fatalf("布局引擎只对指定的文件生效，得到 %v", args)
+	}
+	SetFileLayout("/a.puml", "")
+	if FileLayout("/a.puml") != "" {
+		t.Fatal("恢复为Graphviz后不应再有布局引擎")
+	}
+}
@@ -0,0 +1,143 @@
+package plantuml
+
+import (
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2"
+
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/outline"
+)
+
+// SVGRenderer 是可以把图表渲染为SVG的Renderer。SVG中记录了各元素的名称和位置，
+// 用于把图像上点击的位置对应到定义该元素的源码行
+type SVGRenderer interface {
+	Renderer
+	// RenderSVG 把第page页（从1开始）渲染为SVG
+	RenderSVG(filePath string, page int) ([]byte, error)
+}
+
+// sourceMap 是为当前图像渲染的SVG中各元素的区域，图像更新后失效
+type sourceMap struct {
+	image         fyne.Resource // 渲染SVG时显示的图像
+	regions       []outline.Region
+	width, height float64 // SVG的尺寸，与图像的像素尺寸之比即为坐标的换算比例
+}
+
+// SetOnSourceRequested 设置按住Cmd点击图像中的元素时的回调，参数为定义该元素的源码行（从1开始）。
+// 同时发布SourceRequested事件，编辑器扩展据此跳到该行
+func (v *Viewer) SetOnSourceRequested(callback func(line int)) {
+	v.onSourceRequested = callback
+}
+
+// jumpToSource 找到图像坐标(x, y)处的元素在源码中定义的行，发布SourceRequested事件并调用onSourceRequested，需要在UI线程中调用
+func (v *Viewer) jumpToSource(x, y float32) {
+	if v.frozen || v.virtual {
+		return
+	}
+	v.withSourceMap(func(m *sourceMap) {
+		v.jumpIn(m, x, y)
+	})
+}
+
+// withSourceMap 用当前图像的sourceMap调用fn，需要在UI线程中调用。第一次使用时在后台把当前页渲染为SVG，
+// 之后直到图像更新都使用同一份SVG；正在渲染时只保留最后一次调用的fn。渲染失败时记录空的sourceMap，同一张图像不再重试
+func (v *Viewer) withSourceMap(fn func(m *sourceMap)) {
+	img := v.Image()
+	if img == nil {
+		return
+	}
+	if m := v.sourceMap; m != nil && m.image == img {
+		fn(m)
+		return
+	}
+	v.sourceMapWaiting = fn
+	if v.sourceMapLoading {
+		return
+	}
+
+	renderer := v.renderer
+	if r, ok := renderer.(ContextRenderer); ok {
+		renderer = r.WithContext(v.ctx)
+	}
+	svgRenderer, ok := renderer.(SVGRenderer)
+	if !ok {
+		log.Printf("渲染器不支持SVG，无法找到图像中的元素")
+		v.sourceMap = &sourceMap{image: img}
+		return
+	}
+	v.sourceMapLoading = true
+	page := v.Page()
+	go func() {
+		m, err := loadSourceMap(svgRenderer, v.filePath, page)
+		fyne.Do(func() {
+			v.sourceMapLoading = false
+			fn := v.sourceMapWaiting
+			v.sourceMapWaiting = nil
+			if v.Image() != img {
+				// 渲染SVG期间图像已经更新，坐标可能对不上
+				return
+			}
+			if err != nil {
+				log.Printf("无法找到图像中的元素: %v", err)
+				m = &sourceMap{}
+			}
+			m.image = img
+			v.sourceMap = m
+			fn(m)
+		})
+	}()
+}
+
+// loadSourceMap 把文件的第page页渲染为SVG并解析其中的元素区域
+func loadSourceMap(r SVGRenderer, filePath string, page int) (*sourceMap, error) {
+	svg, err := r.RenderSVG(filePath, page)
+	if err != nil {
+		return nil, err
+	}
+	regions, width, height, err := outline.SVGRegions(svg)
+	if err != nil {
+		return nil, err
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("SVG中没有图像尺寸")
+	}
+	return &sourceMap{regions: regions, width: width, height: height}, nil
+}
+
+// jumpIn 按m找到图像坐标(x, y)处的元素，读取源码找到定义它的行，发布事件并调用onSourceRequested
+func (v *Viewer) jumpIn(m *sourceMap, x, y float32) {
+	sx, sy, ok := v.toSVG(m, x, y)
+	if !ok {
+		return
+	}
+	region, ok := outline.RegionAt(m.regions, sx, sy)
+	if !ok {
+		return
+	}
+	source, err := ReadSource(v.filePath)
+	if err != nil {
+		log.Printf("无法读取源码: %v", err)
+		return
+	}
+	line := outline.SourceLine(source, region)
+	if line == 0 {
+		log.Printf("在 %s 中找不到点击的元素的定义", logging.Path(v.filePath))
+		return
+	}
+	log.Printf("点击的元素定义在第%d行", line)
+	v.events.Publish(event.Event{Type: event.SourceRequested, Path: v.filePath, Line: line})
+	if v.onSourceRequested != nil {
+		v.onSourceRequested(line)
+	}
+}
+
+// toSVG 把图像坐标换算为m中的SVG坐标，m为空或图像尺寸未知时返回false
+func (v *Viewer) toSVG(m *sourceMap, x, y float32) (float64, float64, bool) {
+	if m.width <= 0 || v.imageSize.IsZero() {
+		return 0, 0, false
+	}
+	return float64(x) * m.width / float64(v.imageSize.Width), float64(y) * m.height / float64(v.imageSize.Height), true
+}
@@ -0,0 +1,33 @@
+package plantuml
+
+import (
+	"sync/atomic"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+
+	"plantumlmacviewer/config"
+)
+
+// managed 是管理员下发的系统级设置，为nil时没有限制，后台渲染时也会读取
+var managed atomic.Pointer[config.Managed]
+
+// SetManaged 设置管理员下发的系统级设置：之后所有渲染（查看、导出和预览）的安全配置按它调整，
+// 并且只使用它允许的PlantUML。m为nil时取消限制
+func SetManaged(m *config.Managed) {
+	managed.Store(m)
+	backends := []render.Backend{render.BackendJar, render.BackendCommand}
+	if m != nil && len(m.Backends) > 0 {
+		backends = nil
+		for _, name := range m.Backends {
+			backends = append(backends, render.Backend(name))
+		}
+	}
+	render.Backends = backends
+}
+
+// applyManaged 按管理员的设置调整渲染选项的安全配置
+func applyManaged(opts *render.Options) {
+	if m := managed.Load(); m != nil {
+		opts.Security = m.EffectiveSecurity(opts.Security)
+	}
+}
@@ -0,0 +1,139 @@
+// Package plantumltest 提供用于测试的plantuml.Renderer实现，立即返回预设的图像或错误，不需要安装Java。
+package plantumltest
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"plantumlmacviewer/plantuml"
+)
+
+// Renderer 是返回预设结果的plantuml.Renderer，可以在多个goroutine中使用
+type Renderer struct {
+	mu     sync.Mutex
+	images map[string][]byte
+	errors map[string]error
+	calls  map[string]int
+	pages  map[string]int
+}
+
+// NewRenderer 创建Renderer，没有预设结果的文件渲染为一张小的空白PNG图像
+func NewRenderer() *Renderer {
+	return &Renderer{
+		images: make(map[string][]byte),
+		errors: make(map[string]error),
+		calls:  make(map[string]int),
+		pages:  make(map[string]int),
+	}
+}
+
+// SetImage 设置渲染filePath时返回的图像数据，并清除之前设置的错误
+func (r *Renderer) SetImage(filePath string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	filePath = absPath(filePath)
+	r.images[filePath] = data
+	delete(r.errors, filePath)
+}
+
+// SetError 设置渲染filePath时返回的错误，err为nil时恢复正常渲染
+func (r *Renderer) SetError(filePath string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	filePath = absPath(filePath)
+	if err == nil {
+		delete(r.errors, filePath)
+		return
+	}
+	r.errors[filePath] = err
+}
+
+// SetPages 设置filePath的页数，没有设置时为1页
+func (r *Renderer) SetPages(filePath string, pages int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pages[absPath(filePath)] = pages
+}
+
+// Calls 返回filePath被渲染的次数
+func (r *Renderer) Calls(filePath string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[absPath(filePath)]
+}
+
+// Render 实现plantuml.Renderer
+func (r *Renderer) Render(filePath string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	filePath = absPath(filePath)
+	r.calls[filePath]++
+	if err, ok := r.errors[filePath]; ok {
+		return nil, err
+	}
+	if data, ok := r.images[filePath]; ok {
+		return data, nil
+	}
+	return PNG(4, 3), nil
+}
+
+// RenderPage 实现plantuml.PageRenderer。第一页与Render相同，之后各页为宽度为页码4倍的空白图像，
+// 便于测试根据图像尺寸判断显示的是哪一页
+func (r *Renderer) RenderPage(filePath string, page int) ([]byte, error) {
+	r.mu.Lock()
+	pages := r.pages[absPath(filePath)]
+	r.mu.Unlock()
+	if pages == 0 {
+		pages = 1
+	}
+	if page < 1 || page > pages {
+		return nil, fmt.Errorf("图表只有%d页，无法显示第%d页", pages, page)
+	}
+	data, err := r.Render(filePath)
+	if err != nil || page == 1 {
+		return data, err
+	}
+	return PNG(4*page, 3), nil
+}
+
+// RenderSource 实现plantuml.SourceRenderer。源码中有含“syntax error”的行时返回指向该行的RenderError，
+// 否则返回宽度为页码4倍、高度为源码行数的空白图像，便于测试根据图像尺寸判断渲染的内容
+func (r *Renderer) RenderSource(source []byte, dir string, page int) ([]byte, error) {
+	lines := strings.Split(strings.TrimRight(string(source), "\n"), "\n")
+	for i, line := range lines {
+		if strings.Contains(line, "syntax error") {
+			return nil, &plantuml.RenderError{Line: i + 1, Output: fmt.Sprintf("Error line %d in file", i+1)}
+		}
+	}
+	if page < 1 {
+		page = 1
+	}
+	return PNG(4*page, len(lines)), nil
+}
+
+// PNG 生成指定大小的白色PNG图像数据
+func PNG(width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// absPath 统一使用绝对路径作为键，与查看器使用的路径一致
+func absPath(filePath string) string {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		return abs
+	}
+	return filePath
+}
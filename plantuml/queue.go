@@ -0,0 +1,201 @@
+package plantuml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+)
+
+// RenderDebounce 是文件变化后开始渲染前等待的时间。编辑器快速连续保存时，期间的变化合并为一次渲染，
+// 不会为每次保存都启动PlantUML
+const RenderDebounce = 200 * time.Millisecond
+
+// 查看时的渲染都经过同一个渲染队列：
+//   - 每个标签的渲染请求按RenderDebounce合并，等待期间的请求只渲染一次
+//   - 同一个文件（内容和修改时间相同）、同样选项的渲染同时只运行一次，结果共享给所有等待的标签，例如分屏显示同一个文件
+//   - 同一时间最多运行MaxRenders个PlantUML，其余的渲染排队等待，RenderTimeout从开始运行时计算
+type renderQueue struct {
+	mu      sync.Mutex
+	pending map[interface{}]*time.Timer // 每个标签等待开始的渲染
+	calls   map[string]*renderCall      // 正在运行、可以共享结果的渲染
+	running int                         // 正在运行的PlantUML数
+	wake    chan struct{}               // 有渲染结束时关闭并替换，唤醒排队的渲染
+}
+
+// renderCall 是一次正在运行的渲染，done关闭后data和err有效
+type renderCall struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// renders 是查看时使用的渲染队列
+var renders = newRenderQueue()
+
+// newRenderQueue 创建空的渲染队列
+func newRenderQueue() *renderQueue {
+	return &renderQueue{
+		pending: make(map[interface{}]*time.Timer),
+		calls:   make(map[string]*renderCall),
+		wake:    make(chan struct{}),
+	}
+}
+
+// maxRenders 是同一时间最多运行的PlantUML数，0表示DefaultMaxRenders
+var maxRenders atomic.Int64
+
+// DefaultMaxRenders 返回没有设置时同一时间最多运行的PlantUML数：CPU核数的一半，至少1个
+func DefaultMaxRenders() int {
+	return max(runtime.NumCPU()/2, 1)
+}
+
+// SetMaxRenders 设置查看时同一时间最多运行的PlantUML数，打开很多标签或快速连续保存时不会同时启动大量Java进程。
+// 不大于0时使用DefaultMaxRenders，正在排队的渲染立即按新的设置开始
+func SetMaxRenders(n int) {
+	if n < 0 {
+		n = 0
+	}
+	maxRenders.Store(int64(n))
+	renders.mu.Lock()
+	renders.wakeLocked()
+	renders.mu.Unlock()
+}
+
+// MaxRenders 返回查看时同一时间最多运行的PlantUML数
+func MaxRenders() int {
+	if n := int(maxRenders.Load()); n > 0 {
+		return n
+	}
+	return DefaultMaxRenders()
+}
+
+// schedule 在delay后调用fn。同一个key已经有等待开始的请求时合并为一次，重新开始计时
+func (q *renderQueue) schedule(key interface{}, delay time.Duration, fn func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if pending, ok := q.pending[key]; ok {
+		pending.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		q.mu.Lock()
+		// 已经被之后的请求取代或取消，计时器停止前已经触发时会走到这里
+		current := q.pending[key] == timer
+		if current {
+			delete(q.pending, key)
+		}
+		q.mu.Unlock()
+		if current {
+			fn()
+		}
+	})
+	q.pending[key] = timer
+}
+
+// cancel 取消key等待开始的渲染，已经开始的渲染不受影响
+func (q *renderQueue) cancel(key interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if pending, ok := q.pending[key]; ok {
+		pending.Stop()
+		delete(q.pending, key)
+	}
+}
+
+// do 在队列中运行fn。key不为空时，key相同的渲染正在运行则等待并共享它的结果；
+// 发起那次渲染的标签关闭或渲染被取代时结果不能共享，这时重新排队
+func (q *renderQueue) do(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	if key == "" {
+		return q.run(ctx, fn)
+	}
+	for {
+		q.mu.Lock()
+		if c, ok := q.calls[key]; ok {
+			q.mu.Unlock()
+			select {
+			case <-c.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if errors.Is(c.err, context.Canceled) && ctx.Err() == nil {
+				continue
+			}
+			return append([]byte(nil), c.data...), c.err
+		}
+		c := &renderCall{done: make(chan struct{})}
+		q.calls[key] = c
+		q.mu.Unlock()
+
+		c.data, c.err = q.run(ctx, fn)
+		q.mu.Lock()
+		delete(q.calls, key)
+		q.mu.Unlock()
+		close(c.done)
+		return c.data, c.err
+	}
+}
+
+// run 等到正在运行的PlantUML少于MaxRenders时运行fn，最长RenderTimeout。ctx结束时不再等待
+func (q *renderQueue) run(ctx context.Context, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	for {
+		q.mu.Lock()
+		if q.running < MaxRenders() {
+			q.running++
+			q.mu.Unlock()
+			break
+		}
+		wake := q.wake
+		q.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	defer func() {
+		q.mu.Lock()
+		q.running--
+		q.wakeLocked()
+		q.mu.Unlock()
+	}()
+	ctx, cancel := context.WithTimeout(ctx, RenderTimeout())
+	defer cancel()
+	return fn(ctx)
+}
+
+// wakeLocked 唤醒所有排队的渲染重新检查名额，需要持有mu
+func (q *renderQueue) wakeLocked() {
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+// queued 让backend的渲染经过渲染队列，放在磁盘缓存下面，命中缓存时不用排队
+type queued struct {
+	render.Renderer
+}
+
+// RenderFile 实现render.Renderer，同一个文件同样的渲染同时只运行一次
+func (q queued) RenderFile(ctx context.Context, filePath string, page int, opts render.Options) ([]byte, error) {
+	key := ""
+	if info, err := os.Stat(filePath); err == nil {
+		// 按大小和修改时间区分文件的内容，保存后的渲染不会拿到保存前的结果
+		key = fmt.Sprintf("%s\x00%d\x00%d\x00%d\x00%+v", filePath, info.Size(), info.ModTime().UnixNano(), page, opts)
+	}
+	return renders.do(ctx, key, func(ctx context.Context) ([]byte, error) {
+		return q.Renderer.RenderFile(ctx, filePath, page, opts)
+	})
+}
+
+// RenderBytes 实现render.Renderer
+func (q queued) RenderBytes(ctx context.Context, source []byte, dir string, page int, opts render.Options) ([]byte, error) {
+	return renders.do(ctx, "", func(ctx context.Context) ([]byte, error) {
+		return q.Renderer.RenderBytes(ctx, source, dir, page, opts)
+	})
+}
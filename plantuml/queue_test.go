@@ -0,0 +1,108 @@
+package plantuml
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRenderQueueSchedule(t *testing.T) {
+	q := newRenderQueue()
+	var calls atomic.Int32
+	done := make(chan struct{}, 10)
+	render := func() {
+		calls.Add(1)
+		done <- struct{}{}
+	}
+	// 快速连续保存时只渲染一次
+	for i := 0; i < 5; i++ {
+		q.schedule("a", 30*time.Millisecond, render)
+		time.Sleep(5 * time.Millisecond)
+	}
+	q.schedule("b", 30*time.Millisecond, render)
+	q.cancel("b")
+	<-done
+	time.Sleep(60 * time.Millisecond)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("合并后应只渲染1次，实际 %d 次", n)
+	}
+}
+
+func TestRenderQueueLimit(t *testing.T) {
+	defer SetMaxRenders(0)
+	SetMaxRenders(2)
+	q := newRenderQueue()
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.run(context.Background(), func(ctx context.Context) ([]byte, error) {
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				running.Add(-1)
+				return nil, nil
+			})
+		}()
+	}
+	wg.Wait()
+	if p := peak.Load(); p != 2 {
+		t.Errorf("同时运行的渲染最多应为2个，实际 %d 个", p)
+	}
+
+	// 排队时ctx结束不再等待
+	SetMaxRenders(1)
+	release := make(chan struct{})
+	go q.run(context.Background(), func(ctx context.Context) ([]byte, error) {
+		<-release
+		return nil, nil
+	})
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := q.run(ctx, func(ctx context.Context) ([]byte, error) { return nil, nil }); err != context.DeadlineExceeded {
+		t.Errorf("排队超时应返回 DeadlineExceeded，得到 %v", err)
+	}
+	close(release)
+}
+
+func TestRenderQueueShares(t *testing.T) {
+	q := newRenderQueue()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) ([]byte, error) {
+		calls.Add(1)
+		<-release
+		return []byte("png"), nil
+	}
+	var wg sync.WaitGroup
+	results := make([]string, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, _ := q.do(context.Background(), "flow.puml", fn)
+			results[i] = string(data)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("同样的渲染应只运行1次，实际 %d 次", n)
+	}
+	for i, r := range results {
+		if r != "png" {
+			t.Errorf("第%d个请求的结果为 %q", i, r)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package plantuml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/charset"
+	"plantumlmacviewer/internal/logging"
+)
+
+// Renderer 将PlantUML文件渲染为PNG图像，多页图表只返回第一页。
+// Viewer通过它渲染图表，测试中可以替换为返回固定结果的实现，不需要安装Java
+type Renderer interface {
+	Render(filePath string) ([]byte, error)
+}
+
+// PageRenderer 是可以渲染多页图表（使用newpage分页）中指定页的Renderer
+type PageRenderer interface {
+	Renderer
+	// RenderPage 渲染第page页（从1开始），页码超出图表的页数时返回错误
+	RenderPage(filePath string, page int) ([]byte, error)
+}
+
+// SourceRenderer 是可以直接渲染源码（例如编辑器中未保存的内容）的Renderer
+type SourceRenderer interface {
+	Renderer
+	// RenderSource 渲染source的第page页（从1开始），源码中的相对路径（如!include）相对于dir解析
+	RenderSource(source []byte, dir string, page int) ([]byte, error)
+}
+
+// ContextRenderer 是可以取消的Renderer，WithContext返回的渲染器在ctx结束时结束正在运行的PlantUML进程，
+// 用于关闭标签时不再等待没有用的渲染
+type ContextRenderer interface {
+	Renderer
+	WithContext(ctx context.Context) Renderer
+}
+
+// renderTimeout 是查看时一次渲染最长的时间，0表示config.DefaultRenderTimeout，后台渲染时也会读取
+var renderTimeout atomic.Int64
+
+// SetRenderTimeout 设置查看时一次渲染最长的时间，超过后结束PlantUML进程并显示超时错误，避免卡住的PlantUML一直运行。
+// 不大于0时使用config.DefaultRenderTimeout，之后开始的渲染使用新的设置
+func SetRenderTimeout(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	renderTimeout.Store(int64(d))
+}
+
+// RenderTimeout 返回查看时一次渲染最长的时间
+func RenderTimeout() time.Duration {
+	if d := time.Duration(renderTimeout.Load()); d > 0 {
+		return d
+	}
+	return config.DefaultRenderTimeout
+}
+
+// IsTimeout 判断渲染错误是否因为超过RenderTimeout而结束了PlantUML进程
+func IsTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// viewOptions 返回查看文件时的渲染选项：渲染配置、编码和字体，再加上只在查看时使用的比例、预处理开关、高对比度、布局引擎和额外参数
+func viewOptions(filePath string) (render.Options, error) {
+	opts, err := renderOptions(filePath)
+	if err != nil {
+		return opts, err
+	}
+	// 项目的渲染配置设置了比例时，查看时也按该比例渲染
+	if _, profile, err := config.ProfileFor(filePath); err == nil && profile.ScaleFactor() != 1 {
+		opts.DPI = render.DefaultDPI * profile.ScaleFactor()
+	}
+	applyFlags(&opts, filePath)
+	opts.Args = append(opts.Args, viewArgs()...)
+	opts.Args = append(opts.Args, layoutArgs(filePath)...)
+	opts.Args = append(opts.Args, FileArgs(filePath)...)
+	return opts, nil
+}
+
+// CommandLine 返回查看文件时执行的PlantUML的等价shell命令，包括预处理变量、安全配置和Java选项，
+// 用于在终端或CI中重现渲染问题
+func CommandLine(filePath string) (string, error) {
+	opts, err := viewOptions(filePath)
+	if err != nil {
+		return "", err
+	}
+	return render.CommandLine(filePath, opts)
+}
+
+// HighContrastSkinparams 是高对比度模式注入的skinparam：线条和文字改为黑色并加粗，去掉阴影，
+// 适合在褪色的投影仪上演示。图表中自己设置的skinparam优先
+var HighContrastSkinparams = []string{
+	"BackgroundColor=#FFFFFF",
+	"DefaultFontColor=#000000",
+	"DefaultFontSize=14",
+	"DefaultFontStyle=bold",
+	"ArrowColor=#000000",
+	"ArrowThickness=2",
+	"SequenceLifeLineBorderColor=#000000",
+	"Shadowing=false",
+}
+
+// highContrast 是否以高对比度渲染查看的图表，后台渲染时也会读取
+var highContrast atomic.Bool
+
+// SetHighContrast 设置之后查看的图表是否注入HighContrastSkinparams，只影响查看，导出的文件不变。
+// 已经显示的图表需要重新渲染才会改变
+func SetHighContrast(on bool) {
+	highContrast.Store(on)
+}
+
+// HighContrast 返回查看的图表是否以高对比度渲染
+func HighContrast() bool {
+	return highContrast.Load()
+}
+
+// viewArgs 返回只在查看时加上的PlantUML参数
+func viewArgs() []string {
+	if !HighContrast() {
+		return nil
+	}
+	args := make([]string, len(HighContrastSkinparams))
+	for i, param := range HighContrastSkinparams {
+		args[i] = "-S" + param
+	}
+	return args
+}
+
+// DefaultRenderer 是没有指定渲染器时使用的渲染器，每次渲染启动新的PlantUML进程
+var DefaultRenderer Renderer = BackendRenderer{}
+
+// RenderError 是PlantUML执行失败时的错误，包含从错误输出中解析出的出错行号
+type RenderError = render.Error
+
+// ErrorLine 返回渲染错误对应的行号，不是RenderError或无法确定时返回0
+func ErrorLine(err error) int {
+	return render.ErrorLine(err)
+}
+
+// FindJar 查找本地的plantuml.jar，找不到时返回空字符串
+func FindJar() string {
+	return render.FindJar()
+}
+
+// Version 返回本机PlantUML的版本号，例如 "1.2023.10"
+func Version() (string, error) {
+	return render.Version()
+}
+
+// RenderPages 将PlantUML文件按指定格式（如png、svg）渲染到outDir，
+// 返回按页码排序的输出文件路径。包含newpage的多页图表会得到多个文件。
+// dpi是位图的分辨率，为0时使用PlantUML的默认值。
+// 文件所在项目为它配置了渲染配置时，自动加上其中的主题、预处理变量和安全配置；也会加上设置的字体，文件不是UTF-8编码时加上它的编码
+func RenderPages(filePath, outDir, format string, dpi float64) ([]string, error) {
+	opts, err := renderOptions(filePath)
+	if err != nil {
+		return nil, err
+	}
+	opts.Format = format
+	opts.DPI = dpi
+	return render.RenderFile(filePath, outDir, opts)
+}
+
+// RenderSourceAs 按filePath的渲染配置、编码和设置的字体把source的第一页渲染为PNG，dpi为0时使用PlantUML的默认值。
+// 用于渲染文件在其他版本中的内容，!include等相对路径相对于filePath所在的目录
+func RenderSourceAs(source []byte, filePath string, dpi float64) ([]byte, error) {
+	opts, err := renderOptions(filePath)
+	if err != nil {
+		return nil, err
+	}
+	opts.DPI = dpi
+	return render.RenderSource(source, filepath.Dir(filePath), 1, opts)
+}
+
+// RenderSourcePages 按filePath的渲染配置和设置的字体把UTF-8编码的source的所有页面（按newpage分页）渲染为format格式，
+// 返回按页码排序的图像，dpi为0时使用PlantUML的默认值。用于渲染修改过的源码（例如脱敏后的副本），
+// !include等相对路径相对于filePath所在的目录
+func RenderSourcePages(source, filePath, format string, dpi float64) ([][]byte, error) {
+	opts, err := renderOptions(filePath)
+	if err != nil {
+		return nil, err
+	}
+	opts.Charset = charset.UTF8 // source已经解码为UTF-8，不再按文件的编码读取
+	opts.Format = format
+	opts.DPI = dpi
+	var pages [][]byte
+	for page := 1; page <= SourcePageCount(source); page++ {
+		data, err := render.RenderSource([]byte(source), filepath.Dir(filePath), page, opts)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, data)
+	}
+	return pages, nil
+}
+
+// SourcePageCount 按第一个图表中单独一行的newpage估计源码的页数，至少为1
+func SourcePageCount(source string) int {
+	pages := 1
+	for _, line := range strings.Split(source, "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if strings.HasPrefix(line, "@end") {
+			break
+		}
+		if line == "newpage" || strings.HasPrefix(line, "newpage ") {
+			pages++
+		}
+	}
+	return pages
+}
+
+// CheckFile 按文件的渲染配置和编码只检查语法，不生成图像。includePaths是!include查找文件的目录
+// （plantuml.include.path），为空时只按相对于文件的路径查找
+func CheckFile(filePath string, includePaths []string) error {
+	opts, err := renderOptions(filePath)
+	if err != nil {
+		return err
+	}
+	if len(includePaths) > 0 {
+		path := strings.Join(includePaths, string(filepath.ListSeparator))
+		// Java选项通过以空格分隔的JAVA_TOOL_OPTIONS传递
+		if strings.ContainsAny(path, " \t") {
+			return fmt.Errorf("include目录中不能有空格: %s", path)
+		}
+		opts.JavaOptions = append(opts.JavaOptions, "-Dplantuml.include.path="+path)
+	}
+	return render.CheckFile(filePath, opts)
+}
+
+// renderOptions 返回文件所在项目的渲染配置对应的渲染选项（包括其中的额外参数），加上设置的字体，文件不是UTF-8编码时加上它的编码，
+// 最后按管理员的设置调整。没有渲染配置、没有设置字体和管理员设置并且是UTF-8编码时为零值
+func renderOptions(filePath string) (render.Options, error) {
+	var opts render.Options
+	applyFont(&opts)
+	if name := Charset(filePath); name != "" && name != charset.UTF8 {
+		opts.Charset = name
+	}
+	name, profile, err := config.ProfileFor(filePath)
+	if err == nil && name != "" {
+		log.Printf("%s 使用渲染配置 %s", logging.Path(filePath), name)
+		opts.Theme, opts.Defines, opts.Security = profile.Theme, profile.Defines, profile.Security
+		opts.Args = append(opts.Args, profile.Args...)
+	}
+	// 管理员的设置最后应用，项目的渲染配置不能放宽它的限制
+	applyManaged(&opts)
+	return opts, err
+}
@@ -0,0 +1,161 @@
+package plantuml
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/charset"
+)
+
+func TestRenderOptions(t *testing.T) {
+	dir := t.TempDir()
+	project := `{
+  "profiles": {"print": {"theme": "plain", "defines": {"ENV": "prod", "A": "1"}, "security": "sandbox"}},
+  "files": [{"pattern": "print-*.puml", "profile": "print"}]
+}`
+	if err := ioutil.WriteFile(filepath.Join(dir, config.ProjectFile), []byte(project), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := renderOptions(filepath.Join(dir, "print-login.puml"))
+	if err != nil {
+		t.Fatalf("renderOptions: %v", err)
+	}
+	want := render.Options{Theme: "plain", Defines: map[string]string{"ENV": "prod", "A": "1"}, Security: "sandbox"}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("renderOptions = %+v，应为 %+v", opts, want)
+	}
+
+	if opts, err := renderOptions(filepath.Join(dir, "login.puml")); err != nil || !reflect.DeepEqual(opts, render.Options{}) {
+		t.Errorf("没有匹配的渲染配置时选项应为零值，得到 %+v，%v", opts, err)
+	}
+}
+
+func TestViewArgs(t *testing.T) {
+	defer SetHighContrast(false)
+	if args := viewArgs(); args != nil {
+		t.Errorf("没有开启高对比度时不应有额外参数，得到 %q", args)
+	}
+	SetHighContrast(true)
+	args := viewArgs()
+	if len(args) != len(HighContrastSkinparams) || args[0] != "-S"+HighContrastSkinparams[0] {
+		t.Errorf("高对比度应以-S参数注入skinparam，得到 %q", args)
+	}
+}
+
+func TestCharsetResolution(t *testing.T) {
+	dir := t.TempDir()
+	project := `{"profiles": {"legacy": {"charset": "sjis"}}, "files": [{"pattern": "legacy-*.puml", "profile": "legacy"}]}`
+	gbk := []byte("@startuml\n\xd3\xc3\xbb\xa7 -> \xcf\xb5\xcd\xb3\n@enduml\n")
+	files := map[string][]byte{config.ProjectFile: []byte(project), "gbk.puml": gbk, "legacy-a.puml": gbk, "utf8.puml": []byte("@startuml\n用户 -> 系统\n@enduml\n")}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	if opts, _ := renderOptions(path("utf8.puml")); opts.Charset != "" {
+		t.Errorf("UTF-8文件不应指定编码，得到 %q", opts.Charset)
+	}
+	if opts, _ := renderOptions(path("gbk.puml")); opts.Charset != charset.GBK {
+		t.Errorf("应自动识别GBK，得到 %q", opts.Charset)
+	}
+	if source, err := ReadSource(path("gbk.puml")); err != nil || source != "@startuml\n用户 -> 系统\n@enduml\n" {
+		t.Errorf("ReadSource = %q, %v", source, err)
+	}
+	if got := Charset(path("legacy-a.puml")); got != charset.ShiftJIS {
+		t.Errorf("渲染配置中的编码应优先于自动识别，得到 %q", got)
+	}
+
+	SetDefaultCharset(charset.Latin1)
+	defer SetDefaultCharset("")
+	if got := Charset(path("gbk.puml")); got != charset.Latin1 {
+		t.Errorf("设置了默认编码时不应自动识别，得到 %q", got)
+	}
+	SetFileCharset(path("legacy-a.puml"), charset.GBK)
+	defer SetFileCharset(path("legacy-a.puml"), "")
+	if got := Charset(path("legacy-a.puml")); got != charset.GBK {
+		t.Errorf("为文件指定的编码应最优先，得到 %q", got)
+	}
+}
+
+func TestRenderOptionsFont(t *testing.T) {
+	SetFont("Noto Sans CJK SC", "UTF-8")
+	defer SetFont("", "")
+	opts, err := renderOptions(filepath.Join(t.TempDir(), "a.puml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := render.Options{Args: []string{"-SdefaultFontName=Noto Sans CJK SC"}, JavaOptions: []string{"-Dfile.encoding=UTF-8"}}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("renderOptions = %+v，应为 %+v", opts, want)
+	}
+	if err := ValidateJavaEncoding("UTF-8 -Xmx1g"); err == nil {
+		t.Error("含有空格的编码应无效")
+	}
+}
+
+func TestRenderOptionsManaged(t *testing.T) {
+	dir := t.TempDir()
+	project := `{"profiles": {"web": {"security": "internet"}}, "files": [{"pattern": "*.puml", "profile": "web"}]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, config.ProjectFile), []byte(project), 0644); err != nil {
+		t.Fatal(err)
+	}
+	SetManaged(&config.Managed{DisableNetwork: true, Backends: []string{"command"}})
+	defer SetManaged(nil)
+
+	opts, err := renderOptions(filepath.Join(dir, "a.puml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Security != "SANDBOX" {
+		t.Errorf("禁止访问网络时项目配置不能放宽安全配置，得到 %q", opts.Security)
+	}
+	if !reflect.DeepEqual(render.Backends, []render.Backend{render.BackendCommand}) {
+		t.Errorf("应只允许管理员设置的PlantUML，得到 %v", render.Backends)
+	}
+}
+
+func TestSourcePageCount(t *testing.T) {
+	tests := []struct {
+		source string
+		want   int
+	}{
+		{"@startuml\nA -> B\n@enduml\n", 1},
+		{"@startuml\nA -> B\nnewpage\nB -> C\n  NewPage 第三页\nC -> D\n@enduml\n", 3},
+		{"@startuml\nA -> B : newpage\n@enduml\n@startuml\nnewpage\n@enduml\n", 1},
+	}
+	for _, tt := range tests {
+		if got := SourcePageCount(tt.source); got != tt.want {
+			t.Errorf("SourcePageCount(%q) = %d，应为 %d", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestRenderTimeout(t *testing.T) {
+	defer SetRenderTimeout(0)
+	if got := RenderTimeout(); got != config.DefaultRenderTimeout {
+		t.Errorf("没有设置时 RenderTimeout = %v，应为 %v", got, config.DefaultRenderTimeout)
+	}
+	SetRenderTimeout(5 * time.Second)
+	if got := RenderTimeout(); got != 5*time.Second {
+		t.Errorf("RenderTimeout = %v，应为 5s", got)
+	}
+
+	timeout := &RenderError{Err: context.DeadlineExceeded}
+	if !IsTimeout(fmt.Errorf("a.puml: %w", timeout)) {
+		t.Error("因超时结束的渲染应识别为超时")
+	}
+	if IsTimeout(&RenderError{Err: context.Canceled}) || IsTimeout(fmt.Errorf("语法错误")) {
+		t.Error("取消和其他错误不是超时")
+	}
+}
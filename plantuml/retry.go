@@ -0,0 +1,70 @@
+package plantuml
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRenderRetries 是没有设置时遇到暂时性错误最多重试的次数
+const DefaultRenderRetries = 3
+
+// RetryDelay 是第一次重试前等待的时间，之后每次重试加倍
+var RetryDelay = 500 * time.Millisecond
+
+// renderRetries 遇到暂时性错误时最多重试的次数，后台渲染时也会读取
+var renderRetries atomic.Int32
+
+func init() {
+	renderRetries.Store(DefaultRenderRetries)
+}
+
+// SetRenderRetries 设置遇到暂时性错误时最多重试的次数，0表示不重试，立即显示错误
+func SetRenderRetries(n int) {
+	if n < 0 {
+		n = 0
+	}
+	renderRetries.Store(int32(n))
+}
+
+// RenderRetries 返回遇到暂时性错误时最多重试的次数
+func RenderRetries() int {
+	return int(renderRetries.Load())
+}
+
+// retryDelay 返回第attempt次（从1开始）重试前等待的时间
+func retryDelay(attempt int) time.Duration {
+	return RetryDelay << (attempt - 1)
+}
+
+// transientOutputPattern 匹配PlantUML错误输出中与图表无关的错误：刚安装时找不到jar或Java类，
+// 临时目录被占用或磁盘已满等
+var transientOutputPattern = regexp.MustCompile(`(?i)unable to access jarfile|could not find or load main class|` +
+	`no space left on device|resource temporarily unavailable|too many open files|permission denied`)
+
+// transientErrorPattern 匹配没有执行PlantUML或没有得到输出时的错误：找不到PlantUML、临时目录无法创建、
+// 输出文件没有生成等，这些错误的文字来自render模块
+var transientErrorPattern = regexp.MustCompile(`找不到 plantuml\.jar|无法创建临时目录|无法找到生成的图像文件|无法读取生成的图像|PlantUML没有输出图像`)
+
+// IsTransient 判断渲染错误是否可能是暂时性的：例如刚安装完还找不到java或PlantUML、临时目录被锁定，
+// 稍后重试可能成功。PlantUML报告了出错行的图表错误不是暂时性的，重试也不会成功
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var renderErr *RenderError
+	if errors.As(err, &renderErr) {
+		if renderErr.Line > 0 {
+			return false
+		}
+		// java或plantuml命令不在PATH中
+		var execErr *exec.Error
+		if errors.As(renderErr.Err, &execErr) {
+			return true
+		}
+		return transientOutputPattern.MatchString(renderErr.Output)
+	}
+	return transientErrorPattern.MatchString(err.Error())
+}
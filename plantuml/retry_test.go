@@ -0,0 +1,40 @@
+package plantuml
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&RenderError{Line: 3, Output: "Error line 3 in file", Err: errors.New("exit status 200")}, false},
+		{&RenderError{Output: "Some diagram description contains errors", Err: errors.New("exit status 200")}, false},
+		{&RenderError{Err: &exec.Error{Name: "java", Err: exec.ErrNotFound}}, true},
+		{&RenderError{Output: "Error: Unable to access jarfile /usr/local/bin/plantuml.jar", Err: errors.New("exit status 1")}, true},
+		{fmt.Errorf("找不到 plantuml.jar 或命令行工具，请确保已安装 PlantUML"), true},
+		{fmt.Errorf("无法创建临时目录: permission denied"), true},
+		{fmt.Errorf("图表只有2页，无法显示第3页"), false},
+	}
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("IsTransient(%v) = %v，应为 %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	defer SetRenderRetries(DefaultRenderRetries)
+	if got := retryDelay(3); got != 4*RetryDelay {
+		t.Errorf("第3次重试应等待 %v，得到 %v", 4*RetryDelay, got)
+	}
+	SetRenderRetries(-1)
+	if RenderRetries() != 0 {
+		t.Errorf("负数应视为不重试，得到 %d", RenderRetries())
+	}
+}
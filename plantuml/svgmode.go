@@ -0,0 +1,130 @@
+package plantuml
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"fyne.io/fyne/v2"
+
+	"plantumlmacviewer/outline"
+)
+
+// 查看时渲染的图像格式：PNG放大后会模糊，SVG在任何缩放比例下都保持清晰
+const (
+	ImageFormatPNG = "png"
+	ImageFormatSVG = "svg"
+)
+
+// svgImageName 是SVG图像资源的名称，Fyne按扩展名识别SVG，显示时按实际尺寸栅格化
+const svgImageName = "plantuml_image.svg"
+
+// svgMode 是否默认以SVG渲染查看的图表，后台渲染时也会读取
+var svgMode atomic.Bool
+
+// SetSVGMode 设置没有为文件单独指定格式时是否以SVG渲染查看的图表，只影响查看，导出的文件不变。
+// 已经显示的图表需要重新渲染才会改变
+func SetSVGMode(on bool) {
+	svgMode.Store(on)
+}
+
+// SVGMode 返回是否默认以SVG渲染查看的图表
+func SVGMode() bool {
+	return svgMode.Load()
+}
+
+// fileImageFormats 是为单个文件指定的图像格式，按文件路径索引
+var (
+	fileImageFormatsMu sync.Mutex
+	fileImageFormats   = make(map[string]string)
+)
+
+// SetFileImageFormat 为文件指定查看时渲染的图像格式（ImageFormatPNG或ImageFormatSVG），为空时跟随SetSVGMode的设置。
+// 已经显示的图表需要重新渲染才会改变
+func SetFileImageFormat(filePath, format string) {
+	fileImageFormatsMu.Lock()
+	defer fileImageFormatsMu.Unlock()
+	if format == "" {
+		delete(fileImageFormats, filePath)
+	} else {
+		fileImageFormats[filePath] = format
+	}
+}
+
+// FileImageFormat 返回为文件指定的图像格式，没有指定时为空字符串
+func FileImageFormat(filePath string) string {
+	fileImageFormatsMu.Lock()
+	defer fileImageFormatsMu.Unlock()
+	return fileImageFormats[filePath]
+}
+
+// ImageFormatLabel 返回图像格式在界面中显示的名称，空字符串表示跟随设置
+func ImageFormatLabel(format string) string {
+	switch format {
+	case "":
+		return "跟随设置"
+	case ImageFormatPNG:
+		return "PNG"
+	case ImageFormatSVG:
+		return "SVG（无损缩放）"
+	}
+	return format
+}
+
+// useSVG 返回查看文件时是否以SVG渲染
+func useSVG(filePath string) bool {
+	switch FileImageFormat(filePath) {
+	case ImageFormatSVG:
+		return true
+	case ImageFormatPNG:
+		return false
+	}
+	return SVGMode()
+}
+
+// isSVGImage 判断图像资源是否是以SVG渲染的
+func isSVGImage(res fyne.Resource) bool {
+	return res != nil && strings.HasSuffix(res.Name(), ".svg")
+}
+
+// renderSVGImage 把当前页渲染为SVG图像资源，按设置映射色盲难以区分的颜色
+func (v *Viewer) renderSVGImage(renderer SVGRenderer) (fyne.Resource, error) {
+	data, err := renderer.RenderSVG(v.filePath, v.Page())
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("成功读取SVG图像，大小: %d 字节", len(data))
+	if ColorBlindSafe() {
+		data = RemapColorBlindSVG(data)
+	}
+	return fyne.NewStaticResource(svgImageName, data), nil
+}
+
+// svgSourceMap 解析SVG图像中的元素区域和尺寸。SVG图像本身就是跳到源码和显示提示需要的SVG，不用再渲染一次
+func svgSourceMap(res fyne.Resource) (*sourceMap, error) {
+	regions, width, height, err := outline.SVGRegions(res.Content())
+	if err != nil {
+		return nil, err
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("SVG中没有图像尺寸")
+	}
+	return &sourceMap{image: res, regions: regions, width: width, height: height}, nil
+}
+
+// PNGImage 返回当前图像的PNG数据，用于绘制标注后导出。以SVG显示时按PNG重新渲染当前页，虚拟文件总是以PNG显示
+func (v *Viewer) PNGImage() ([]byte, error) {
+	img := v.Image()
+	if img == nil {
+		return nil, fmt.Errorf("图表尚未渲染成功")
+	}
+	if !isSVGImage(img) {
+		return img.Content(), nil
+	}
+	if pageRenderer, ok := v.renderer.(PageRenderer); ok {
+		return pageRenderer.RenderPage(v.filePath, v.Page())
+	}
+	return v.renderer.Render(v.filePath)
+}
@@ -0,0 +1,155 @@
+package plantuml
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+)
+
+const (
+	// swipeThreshold 触发一次切换所需累计的水平滚动距离
+	swipeThreshold float32 = 80
+	// swipeGestureGap 两次滚动事件间隔超过该时间，视为新的手势
+	swipeGestureGap = 300 * time.Millisecond
+)
+
+// SwipeDirection 表示触控板水平轻扫的方向
+type SwipeDirection int
+
+const (
+	// SwipeNext 手指向左轻扫，切换到下一个标签页
+	SwipeNext SwipeDirection = iota
+	// SwipePrev 手指向右轻扫，切换到上一个标签页
+	SwipePrev
+)
+
+// naturalScrolling 记录系统是否开启了“自然滚动”，决定滚动增量的符号与手指方向的对应关系
+var naturalScrolling = detectNaturalScrolling()
+
+// detectNaturalScrolling 检测系统的滚动方向设置
+// Fyne只提供滚动事件而没有真正的手势事件，滚动增量的符号会随该设置翻转，
+// 因此需要据此校正，保证手指方向与Safari一致
+func detectNaturalScrolling() bool {
+	if runtime.GOOS != "darwin" {
+		return true
+	}
+	out, err := exec.Command("defaults", "read", "-g", "com.apple.swipescrolldirection").Output()
+	if err != nil {
+		// 未设置该键时macOS默认开启自然滚动
+		return true
+	}
+	return strings.TrimSpace(string(out)) != "0"
+}
+
+// swipeTracker 是轻扫手势的识别状态机，与UI无关，便于单独测试
+type swipeTracker struct {
+	accumX    float32
+	lastEvent time.Time
+	triggered bool // 当前手势已经触发过一次，避免一次轻扫（含惯性滚动）切换多个标签
+}
+
+// feed 处理一次滚动事件，dx为已按手指方向校正的水平增量（负值表示手指向左）
+// canScroll表示内容在该方向上还能继续滚动；
+// 返回值swiped表示触发了轻扫，passThrough表示事件应交给滚动容器正常处理
+func (t *swipeTracker) feed(dx, dy float32, now time.Time, canScroll bool) (dir SwipeDirection, swiped, passThrough bool) {
+	if now.Sub(t.lastEvent) > swipeGestureGap {
+		// 新的手势开始，重置累计状态
+		t.accumX = 0
+		t.triggered = false
+	}
+	t.lastEvent = now
+
+	// 以水平方向为主且内容无法继续水平滚动时才视为轻扫
+	if abs32(dx) <= 2*abs32(dy) || canScroll {
+		return 0, false, true
+	}
+	if t.triggered {
+		return 0, false, false
+	}
+
+	t.accumX += dx
+	if abs32(t.accumX) < swipeThreshold {
+		return 0, false, false
+	}
+
+	t.triggered = true
+	dir = SwipePrev
+	if t.accumX < 0 {
+		dir = SwipeNext
+	}
+	t.accumX = 0
+	return dir, true, false
+}
+
+// swipeScroll 是能够识别触控板水平轻扫的滚动容器
+// 注意：Fyne无法区分三指轻扫与双指水平滚动，这里识别的是双指水平滚动到达内容边缘后的继续滑动
+type swipeScroll struct {
+	container.Scroll
+
+	onSwipe func(SwipeDirection)
+	tracker swipeTracker
+
+	onZoom func(at fyne.Position, dy float32) // 按住Cmd滚动时的回调，at为鼠标在视口中的位置
+}
+
+// newSwipeScroll 创建支持轻扫手势的滚动容器
+func newSwipeScroll(content fyne.CanvasObject) *swipeScroll {
+	s := &swipeScroll{}
+	s.Content = content
+	s.Direction = container.ScrollBoth
+	s.ExtendBaseWidget(s)
+	return s
+}
+
+// Scrolled 处理滚动事件，按住Cmd时用于缩放；否则优先用于内容滚动，到达边缘后识别为轻扫手势
+func (s *swipeScroll) Scrolled(ev *fyne.ScrollEvent) {
+	if s.onZoom != nil && ev.Scrolled.DY != 0 && zoomModifierHeld() {
+		s.onZoom(ev.Position, ev.Scrolled.DY)
+		return
+	}
+	if s.onSwipe == nil {
+		s.Scroll.Scrolled(ev)
+		return
+	}
+
+	dx := ev.Scrolled.DX
+	if !naturalScrolling {
+		dx = -dx
+	}
+
+	dir, swiped, passThrough := s.tracker.feed(dx, ev.Scrolled.DY, time.Now(), s.canScrollHorizontally(ev.Scrolled.DX))
+	if passThrough {
+		s.Scroll.Scrolled(ev)
+		return
+	}
+	if swiped {
+		s.onSwipe(dir)
+	}
+}
+
+// canScrollHorizontally 判断内容在dx方向上是否还能继续滚动
+func (s *swipeScroll) canScrollHorizontally(dx float32) bool {
+	if s.Content == nil {
+		return false
+	}
+	overflow := s.Content.MinSize().Width - s.Size().Width
+	if overflow <= 0 {
+		return false
+	}
+	if dx > 0 {
+		return s.Offset.X > 0
+	}
+	return s.Offset.X < overflow
+}
+
+// abs32 返回float32的绝对值
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,115 @@
+package plantuml
+
+import (
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/test"
+)
+
+func TestSwipeTrackerTriggersOncePerGesture(t *testing.T) {
+	var tr swipeTracker
+	now := time.Now()
+
+	swipes := 0
+	// 一次轻扫加上随后的惯性滚动，事件间隔都小于swipeGestureGap
+	for i := 0; i < 20; i++ {
+		now = now.Add(20 * time.Millisecond)
+		dir, swiped, passThrough := tr.feed(-30, 0, now, false)
+		if passThrough {
+			t.Fatalf("第%d个事件不应交给滚动容器处理", i)
+		}
+		if swiped {
+			swipes++
+			if dir != SwipeNext {
+				t.Errorf("方向 = %v，期望 SwipeNext", dir)
+			}
+		}
+	}
+	if swipes != 1 {
+		t.Errorf("一次手势触发了%d次，期望1次", swipes)
+	}
+}
+
+func TestSwipeTrackerRearmsAfterGap(t *testing.T) {
+	var tr swipeTracker
+	now := time.Now()
+
+	feedGesture := func(dx float32) (SwipeDirection, bool) {
+		var dir SwipeDirection
+		swiped := false
+		for i := 0; i < 5; i++ {
+			now = now.Add(20 * time.Millisecond)
+			if d, ok, _ := tr.feed(dx, 0, now, false); ok {
+				dir, swiped = d, true
+			}
+		}
+		return dir, swiped
+	}
+
+	if dir, ok := feedGesture(-30); !ok || dir != SwipeNext {
+		t.Fatalf("第一次手势: swiped=%v dir=%v，期望触发 SwipeNext", ok, dir)
+	}
+
+	now = now.Add(swipeGestureGap + time.Millisecond)
+	if dir, ok := feedGesture(30); !ok || dir != SwipePrev {
+		t.Fatalf("间隔后的手势: swiped=%v dir=%v，期望触发 SwipePrev", ok, dir)
+	}
+}
+
+func TestSwipeTrackerBelowThreshold(t *testing.T) {
+	var tr swipeTracker
+	now := time.Now()
+
+	if _, swiped, _ := tr.feed(-(swipeThreshold - 1), 0, now, false); swiped {
+		t.Error("未达到阈值不应触发")
+	}
+}
+
+func TestSwipeTrackerPassesVerticalThrough(t *testing.T) {
+	var tr swipeTracker
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		now = now.Add(20 * time.Millisecond)
+		_, swiped, passThrough := tr.feed(-30, 40, now, false)
+		if swiped || !passThrough {
+			t.Fatalf("垂直方向为主的事件: swiped=%v passThrough=%v，期望交给滚动容器", swiped, passThrough)
+		}
+	}
+}
+
+func TestSwipeTrackerIgnoresWhileContentScrolls(t *testing.T) {
+	var tr swipeTracker
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		now = now.Add(20 * time.Millisecond)
+		_, swiped, passThrough := tr.feed(-30, 0, now, true)
+		if swiped || !passThrough {
+			t.Fatalf("内容可水平滚动时: swiped=%v passThrough=%v，期望交给滚动容器", swiped, passThrough)
+		}
+	}
+}
+
+func TestSwipeScrollPassesVerticalToScroll(t *testing.T) {
+	test.NewTempApp(t)
+
+	content := canvas.NewRectangle(nil)
+	content.SetMinSize(fyne.NewSize(100, 1000))
+	s := newSwipeScroll(content)
+	s.Resize(fyne.NewSize(100, 100))
+
+	swiped := false
+	s.onSwipe = func(SwipeDirection) { swiped = true }
+
+	s.Scrolled(&fyne.ScrollEvent{Scrolled: fyne.NewDelta(0, -50)})
+	if s.Offset.Y != 50 {
+		t.Errorf("Offset.Y = %v，期望垂直滚动50", s.Offset.Y)
+	}
+	if swiped {
+		t.Error("垂直滚动不应触发轻扫")
+	}
+}
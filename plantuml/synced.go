@@ -0,0 +1,28 @@
+package plantuml
+
+import (
+	"sync/atomic"
+	"time"
+
+	"plantumlmacviewer/internal/watch"
+)
+
+// syncInterval 是同步文件夹中的文件的检查间隔，打开文件时读取
+var syncInterval atomic.Int64
+
+func init() {
+	syncInterval.Store(int64(watch.DefaultSyncInterval))
+}
+
+// SetSyncInterval 设置同步文件夹中的文件的检查间隔，不大于0时使用watch.DefaultSyncInterval。只影响之后打开的文件
+func SetSyncInterval(d time.Duration) {
+	if d <= 0 {
+		d = watch.DefaultSyncInterval
+	}
+	syncInterval.Store(int64(d))
+}
+
+// SyncInterval 返回同步文件夹中的文件的检查间隔
+func SyncInterval() time.Duration {
+	return time.Duration(syncInterval.Load())
+}
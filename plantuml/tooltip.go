@@ -0,0 +1,78 @@
+package plantuml
+
+import (
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/outline"
+)
+
+// tooltipDelay 鼠标停留这么久没有移动才显示提示，只是划过图像时不渲染SVG
+const tooltipDelay = 600 * time.Millisecond
+
+// tooltipOffset 提示显示在鼠标右下方的距离，不挡住指向的元素
+var tooltipOffset = fyne.NewPos(12, 16)
+
+// tooltip 是鼠标停留在元素上时显示的提示，内容来自SVG中元素的<title>、<desc>和链接的提示，只在UI线程中访问
+type tooltip struct {
+	timer *time.Timer
+	seq   int // 每次移动鼠标加一，等待中的提示发现不一致时不再显示
+	popup *widget.PopUp
+	label *widget.Label
+}
+
+// hover 鼠标移动到图像坐标(x, y)，at是鼠标在窗口中的位置。隐藏已经显示的提示，停留tooltipDelay后显示新的提示。
+// 使用标注工具时不显示提示
+func (v *Viewer) hover(x, y float32, at fyne.Position, c fyne.Canvas) {
+	v.hideTooltip()
+	if v.frozen || v.virtual || v.annotationTool != AnnotationOff || c == nil {
+		return
+	}
+	seq := v.tooltip.seq
+	v.tooltip.timer = time.AfterFunc(tooltipDelay, func() {
+		fyne.Do(func() {
+			if v.tooltip.seq != seq {
+				return
+			}
+			v.withSourceMap(func(m *sourceMap) {
+				if v.tooltip.seq == seq {
+					v.showTooltip(m, x, y, at, c)
+				}
+			})
+		})
+	})
+}
+
+// showTooltip 在at附近显示m中图像坐标(x, y)处的提示，没有提示时什么也不做
+func (v *Viewer) showTooltip(m *sourceMap, x, y float32, at fyne.Position, c fyne.Canvas) {
+	sx, sy, ok := v.toSVG(m, x, y)
+	if !ok {
+		return
+	}
+	text, ok := outline.TooltipAt(m.regions, sx, sy)
+	if !ok {
+		return
+	}
+	t := &v.tooltip
+	if t.popup == nil || t.popup.Canvas != c {
+		t.label = widget.NewLabel("")
+		t.popup = widget.NewPopUp(t.label, c)
+	}
+	t.label.SetText(text)
+	t.popup.ShowAtPosition(at.Add(tooltipOffset))
+}
+
+// hideTooltip 隐藏提示并取消等待中的提示
+func (v *Viewer) hideTooltip() {
+	t := &v.tooltip
+	t.seq++
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if t.popup != nil {
+		t.popup.Hide()
+	}
+}
@@ -1,39 +1,99 @@
 package plantuml
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+
+	"plantumlmacviewer/annotate"
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/internal/secret"
+	"plantumlmacviewer/internal/watch"
+	"plantumlmacviewer/outline"
 )
 
 // Viewer 表示PlantUML查看器
 type Viewer struct {
-	filePath       string
-	content        string
-	imageView      *canvas.Image
-	container      *fyne.Container
-	rendered       bool
-	lastModified   time.Time // 文件最后修改时间
-	stopMonitoring chan bool // 停止监控的信号通道
-	onFileChanged  func()    // 文件变化时的回调函数
-}
-
-// NewViewer 创建新的PlantUML查看器
-func NewViewer(filePath string) (*Viewer, error) {
+	filePath  string
+	renderer  Renderer // 将PlantUML文件渲染为图像
+	imageView *canvas.Image
+	scroll    *swipeScroll    // 滚动容器，同时识别触控板轻扫手势和按住Cmd滚动的缩放
+	container *fyne.Container // 图像和标注层，适应窗口时是滚动容器的内容
+	centered  *fyne.Container // 居中显示container，缩放时是滚动容器的内容
+	zoomLabel *widget.Label   // 显示在右下角的缩放比例
+	root      *fyne.Container // 滚动容器和叠加在上面的缩放比例
+	rendered  bool
+	renderErr error        // 最近一次渲染的错误，成功时为nil
+	watcher   *watch.File  // 监控文件内容的变化
+	events    *event.Bus   // 发布文件变化和渲染事件，可以为nil
+	frozen    bool         // 快照：不监控文件、不重新渲染，标注不保存到文件
+	page      atomic.Int32 // 显示的页码（从1开始），0表示第一页；后台渲染时也会读取
+	virtual   bool         // 虚拟文件：渲染内存中的source而不是filePath，不监控文件，标注不保存到文件
+	network   bool         // 文件位于网络文件系统上，以较长的间隔自适应轮询，自动刷新可能延迟
+	synced    string       // 文件所在的同步文件夹的同步工具，不在同步文件夹中时为空
+	conflicts []string     // 同步工具生成的冲突副本，只在UI线程中访问
+
+	ctx    context.Context // 关闭查看器时结束，正在运行的PlantUML进程随之结束
+	cancel context.CancelFunc
+
+	renderMu     sync.Mutex
+	renderCancel context.CancelFunc // 结束正在进行的渲染，开始新的渲染时调用，只在持有renderMu时访问
+	uncached     atomic.Bool        // 下一次渲染不使用磁盘缓存，由Rerender设置
+
+	sourceMu sync.Mutex
+	source   []byte // 虚拟文件的内容，后台渲染时也会读取
+
+	keyMu sync.Mutex
+	key   secret.Key // 解密这个文件使用的凭据，只保存在内存中
+
+	encrypted         atomic.Value                                 // 文件的加密格式，没有加密时为空字符串，后台渲染时写入
+	onUnlockRequested func(kind string, done func(key secret.Key)) // 点击解锁加密文件时请求输入凭据的回调
+
+	imageSize         fyne.Size      // 渲染图像的原始像素尺寸
+	zoom              float32        // 缩放比例，0表示适应窗口
+	onViewportChanged func(Viewport) // 视口（缩放/滚动位置）变化时的回调函数
+
+	annotations     *annotate.Set                // 标注，保存在图表文件旁的标注文件中
+	annotationLayer *annotationLayer             // 叠加在图像上的标注层
+	annotationTool  AnnotationTool               // 当前使用的标注工具
+	onNoteRequested func(done func(text string)) // 添加文字说明时请求输入文字的回调
+	measureDPI      float64                      // 测量时换算毫米所用的DPI
+	onMeasured      func(string)                 // 完成测量时的回调
+	onLayoutRetry   func(engine string)          // 点击换用布局引擎重试时的回调，由调用方记住选择并重新打开文件
+
+	sourceMap         *sourceMap         // 当前图像中各元素的区域，需要时才渲染，只在UI线程中访问
+	sourceMapLoading  bool               // 正在后台渲染sourceMap
+	sourceMapWaiting  func(m *sourceMap) // sourceMap渲染完成后调用
+	onSourceRequested func(line int)     // 按住Cmd点击元素时的回调，参数为定义该元素的源码行
+	tooltip           tooltip            // 鼠标停留在元素上时显示的提示
+}
+
+// NewViewer 创建新的PlantUML查看器，renderer为nil时使用DefaultRenderer。
+// 文件变化和渲染过程发布到events，events可以为nil
+func NewViewer(filePath string, renderer Renderer, events *event.Bus) (*Viewer, error) {
+	if renderer == nil {
+		renderer = DefaultRenderer
+	}
+
 	// 检查文件是否存在
-	fileInfo, err := os.Stat(filePath)
-	if os.IsNotExist(err) {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("文件不存在: %s", filePath)
 	}
 
@@ -45,23 +105,44 @@ func NewViewer(filePath string) (*Viewer, error) {
 
 	// 创建查看器
 	viewer := &Viewer{
-		filePath:       filePath,
-		content:        string(content),
-		lastModified:   fileInfo.ModTime(),
-		stopMonitoring: make(chan bool),
+		filePath: filePath,
+		renderer: renderer,
+		events:   events,
+		watcher:  watch.New(filePath, string(content)),
+	}
+	viewer.ctx, viewer.cancel = context.WithCancel(context.Background())
+	// 编辑器分多次保存较大的文件时，等写完再渲染，避免闪现语法错误
+	viewer.watcher.Complete = sourceComplete
+	// SMB、NFS等网络文件系统上的文件每次检查都要经过网络，改为较长间隔的自适应轮询
+	// Dropbox、Syncthing等同步文件夹中的文件按内容的校验和轮询，并提示其他电脑同时修改产生的冲突副本
+	if provider := watch.SyncProvider(filePath); provider != "" {
+		log.Printf("文件 %s 位于%s同步文件夹中，按内容轮询", logging.Path(filePath), provider)
+		viewer.synced = provider
+		viewer.watcher.UseSyncPolling(SyncInterval())
+		viewer.watcher.OnConflicts = func(copies []string) {
+			fyne.Do(func() {
+				viewer.conflicts = copies
+				viewer.publish(event.SyncConflict, nil)
+			})
+		}
+	} else if watch.IsNetworkPath(filePath) {
+		log.Printf("文件 %s 位于网络文件系统上，使用自适应轮询", logging.Path(filePath))
+		viewer.network = true
+		viewer.watcher.UseNetworkPolling()
+	}
+
+	// 读取标注
+	viewer.annotations, err = annotate.Load(filePath)
+	if err != nil {
+		log.Printf("警告：%v", err)
 	}
 
 	// 初始化UI组件
 	viewer.initComponents()
 
 	// 立即渲染PlantUML，而不是异步进行
-	// 这确保在视图显示时，图像已经准备好
-	err = viewer.renderSynchronously()
-	if err != nil {
-		log.Printf("同步渲染失败: %v，尝试异步渲染...", err)
-		// 如果同步渲染失败，则使用异步方式作为备选方案
-		go viewer.renderPlantUML()
-	}
+	// 这确保在视图显示时，图像已经准备好；遇到暂时性错误时在后台重试
+	viewer.renderSynchronously()
 
 	// 启动文件监控
 	go viewer.monitorFile()
@@ -69,6 +150,71 @@ func NewViewer(filePath string) (*Viewer, error) {
 	return viewer, nil
 }
 
+// NewVirtualViewer 创建渲染内存中源码的查看器，用于编辑器中尚未保存的内容。
+// name是编辑器中的文件路径，只用于发布事件和解析相对路径，不需要存在；内容通过SetSource更新。
+// renderer需要实现SourceRenderer，为nil时使用DefaultRenderer
+func NewVirtualViewer(name string, source []byte, renderer Renderer, events *event.Bus) (*Viewer, error) {
+	if renderer == nil {
+		renderer = DefaultRenderer
+	}
+	if _, ok := renderer.(SourceRenderer); !ok {
+		return nil, fmt.Errorf("渲染器不支持渲染未保存的内容")
+	}
+
+	viewer := &Viewer{
+		filePath:    name,
+		renderer:    renderer,
+		events:      events,
+		watcher:     watch.New(name, ""),
+		virtual:     true,
+		source:      source,
+		annotations: &annotate.Set{},
+	}
+	viewer.ctx, viewer.cancel = context.WithCancel(context.Background())
+	viewer.watcher.Stop()
+	viewer.initComponents()
+	viewer.renderSynchronously()
+	return viewer, nil
+}
+
+// IsNetworkFile 返回文件是否位于网络文件系统上，这时自动刷新可能延迟十几秒
+func (v *Viewer) IsNetworkFile() bool {
+	return v.network
+}
+
+// SyncProvider 返回文件所在的同步文件夹的同步工具，不在同步文件夹中时返回空字符串
+func (v *Viewer) SyncProvider() string {
+	return v.synced
+}
+
+// Conflicts 返回同步工具为文件生成的冲突副本，需要在UI线程中调用
+func (v *Viewer) Conflicts() []string {
+	return v.conflicts
+}
+
+// IsVirtual 返回查看器是否是NewVirtualViewer创建的虚拟文件查看器
+func (v *Viewer) IsVirtual() bool {
+	return v.virtual
+}
+
+// Source 返回虚拟文件的内容，普通查看器返回nil
+func (v *Viewer) Source() []byte {
+	v.sourceMu.Lock()
+	defer v.sourceMu.Unlock()
+	return v.source
+}
+
+// SetSource 更新虚拟文件的内容并立即重新渲染，返回渲染错误。普通查看器返回错误
+func (v *Viewer) SetSource(source []byte) error {
+	if !v.virtual {
+		return fmt.Errorf("只能更新虚拟文件的内容")
+	}
+	v.sourceMu.Lock()
+	v.source = source
+	v.sourceMu.Unlock()
+	return v.renderSynchronously()
+}
+
 // initComponents 初始化UI组件
 func (v *Viewer) initComponents() {
 	// 创建用于显示渲染图像的组件
@@ -76,352 +222,474 @@ func (v *Viewer) initComponents() {
 	v.imageView.FillMode = canvas.ImageFillContain   // 内容适应屏幕
 	v.imageView.ScaleMode = canvas.ImageScaleFastest // 使用最快的缩放模式，提高性能
 
-	// 创建容器
-	v.container = container.NewMax(container.NewScroll(v.imageView))
+	// 创建容器，轻扫容器包在图像外面，渲染出错显示错误信息时手势仍然有效
+	v.annotationLayer = newAnnotationLayer(v)
+	v.container = container.NewMax(v.imageView, v.annotationLayer)
+	v.centered = container.NewCenter(v.container)
+	v.scroll = newSwipeScroll(v.container)
+	v.scroll.onZoom = v.scrollZoom
+
+	v.zoomLabel = widget.NewLabel(v.ZoomLabel())
+	v.zoomLabel.Importance = widget.LowImportance
+	v.root = container.NewStack(v.scroll, container.NewVBox(layout.NewSpacer(), container.NewHBox(layout.NewSpacer(), v.zoomLabel)))
+}
+
+// Image 返回最近一次渲染成功的图像，尚未渲染成功时返回nil
+func (v *Viewer) Image() fyne.Resource {
+	return v.imageView.Resource
+}
+
+// RenderError 返回最近一次渲染的错误，成功时返回nil。
+// PlantUML报告的错误为*RenderError，可以用ErrorLine取得出错行号
+func (v *Viewer) RenderError() error {
+	return v.renderErr
 }
 
 // GetCanvas 返回查看器的Canvas对象
 func (v *Viewer) GetCanvas() fyne.CanvasObject {
-	return v.container
+	return v.root
+}
+
+// Snapshot 创建冻结在当前图像的查看器。快照不监控文件、不重新渲染，
+// 标注复制自当前查看器但只保留在内存中，用于编辑文件时保留修改前的图表以便对比
+func (v *Viewer) Snapshot() (*Viewer, error) {
+	img := v.Image()
+	if img == nil {
+		return nil, fmt.Errorf("图表尚未渲染成功")
+	}
+
+	snapshot := &Viewer{
+		filePath:    v.filePath,
+		renderer:    v.renderer,
+		watcher:     watch.New(v.filePath, ""),
+		frozen:      true,
+		zoom:        v.zoom,
+		annotations: &annotate.Set{Items: append([]annotate.Annotation(nil), v.annotations.Items...)},
+	}
+	snapshot.ctx, snapshot.cancel = context.WithCancel(context.Background())
+	snapshot.watcher.Stop()
+	snapshot.initComponents()
+	snapshot.showImage(img)
+	return snapshot, nil
+}
+
+// IsSnapshot 返回查看器是否是Snapshot创建的快照
+func (v *Viewer) IsSnapshot() bool {
+	return v.frozen
 }
 
 // renderPlantUML 渲染PlantUML图表
 func (v *Viewer) renderPlantUML() {
-	log.Printf("开始渲染文件: %s", v.filePath)
+	v.renderFrom(0)
+}
+
+// startRender 开始一次新的渲染：结束仍在进行的上一次渲染（包括正在运行的PlantUML进程和等待中的重试），
+// 返回这次渲染使用的ctx。再次调用或关闭查看器时ctx结束，这次渲染的结果不再显示
+func (v *Viewer) startRender() context.Context {
+	v.renderMu.Lock()
+	defer v.renderMu.Unlock()
+	if v.renderCancel != nil {
+		v.renderCancel()
+	}
+	ctx, cancel := context.WithCancel(v.ctx)
+	v.renderCancel = cancel
+	return ctx
+}
+
+// renderFrom 在后台渲染图表，遇到暂时性错误（见IsTransient）时退避重试，最多重试RenderRetries次，
+// 重试期间不显示错误。attempt是已经重试的次数，大于0时先等待再渲染。
+// 文件在渲染期间再次变化时，这次渲染被新的渲染取代，结果不再显示，只显示最新的结果
+func (v *Viewer) renderFrom(attempt int) {
+	if v.frozen {
+		return
+	}
+	ctx := v.startRender()
+	if v.uncached.Swap(false) {
+		// 手动或定时重新渲染：引用的远程内容可能变了，缓存的摘要看不出来
+		ctx = render.WithoutCache(ctx)
+	}
+	log.Printf("开始渲染文件: %s", logging.Path(v.filePath))
+	fyne.Do(func() {
+		v.publish(event.RenderStarted, nil)
+	})
 
 	// 重新读取文件内容，确保获取最新的内容
-	content, err := ioutil.ReadFile(v.filePath)
+	content, err := v.readFile()
 	if err == nil {
 		// 只有成功读取时才更新内容
-		v.content = string(content)
+		v.setContent(content)
 		log.Printf("已重新读取文件内容，大小: %d 字节", len(content))
 	} else {
 		log.Printf("警告：无法重新读取文件内容: %v，使用缓存的内容", err)
 	}
 
-	// 使用 JAR 包渲染 PlantUML 图表
-	img, err := v.renderUsingJar()
+	// 渲染 PlantUML 图表
+	var img fyne.Resource
+	for {
+		if attempt > 0 {
+			delay := retryDelay(attempt)
+			log.Printf("%v后第%d次重试渲染 %s", delay, attempt, logging.Path(v.filePath))
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+		}
+		img, err = v.renderImage(ctx)
+		if err == nil || !IsTransient(err) || attempt >= RenderRetries() {
+			break
+		}
+		log.Printf("渲染遇到暂时性错误: %v", err)
+		attempt++
+	}
+	if ctx.Err() != nil {
+		// 查看器已经关闭，或者这次渲染已经被新的渲染取代，结果没有用处
+		log.Printf("渲染 %s 已取消", logging.Path(v.filePath))
+		return
+	}
 	if err != nil {
 		log.Printf("使用 JAR 渲染失败: %v", err)
-		v.showRenderError(fmt.Sprintf("无法渲染PlantUML图表: %v", err))
-		return
 	}
-
-	// 渲染成功，更新UI
 	fyne.Do(func() {
-		v.imageView.Resource = img
-		v.container.Objects[0] = container.NewScroll(v.imageView)
-		v.container.Refresh()
-		v.rendered = true
-	})
-
-	log.Printf("成功渲染文件: %s", v.filePath)
-}
-
-// renderUsingJar 使用本地jar文件渲染PlantUML图表
-func (v *Viewer) renderUsingJar() (fyne.Resource, error) {
-	// 查找可能的plantuml.jar路径
-	jarPaths := []string{
-		"/usr/local/bin/plantuml.jar",
-		"/usr/local/Cellar/plantuml/*/libexec/plantuml.jar", // 根据实际情况找到的Homebrew安装路径
-		"/usr/local/Cellar/plantuml/*/plantuml.jar",         // homebrew安装路径
-		"/opt/plantuml/plantuml.jar",
-		"/usr/share/plantuml/plantuml.jar",
-		"/Applications/plantuml.jar",
-		filepath.Join(os.Getenv("HOME"), "plantuml.jar"),
-		filepath.Join(os.Getenv("HOME"), "bin/plantuml.jar"),
-		filepath.Join(os.Getenv("HOME"), ".plantuml/plantuml.jar"),
-		filepath.Join(os.Getenv("HOME"), "/Downloads/plantuml.jar"),
-	}
-
-	// 寻找最新版本的 PlantUML JAR 包
-	var jarPath string
-	for _, path := range jarPaths {
-		// 支持glob模式匹配
-		if strings.Contains(path, "*") {
-			matches, err := filepath.Glob(path)
-			if err == nil && len(matches) > 0 {
-				// 按修改时间排序，取最新的
-				var latestJar string
-				var latestTime time.Time
-				for _, match := range matches {
-					info, err := os.Stat(match)
-					if err == nil {
-						if latestJar == "" || info.ModTime().After(latestTime) {
-							latestJar = match
-							latestTime = info.ModTime()
-						}
-					}
-				}
-				if latestJar != "" {
-					jarPath = latestJar
-					log.Printf("找到最新的 PlantUML JAR 包: %s", jarPath)
-					break
-				}
-			}
-		} else if _, err := os.Stat(path); err == nil {
-			jarPath = path
-			log.Printf("找到 PlantUML JAR 包: %s", jarPath)
-			break
+		// 在UI线程中再检查一次：等待显示期间开始的新渲染会取代这个结果
+		if ctx.Err() != nil {
+			return
 		}
-	}
-
-	if jarPath == "" {
-		// 查找 plantuml 命令行工具
-		_, err := exec.LookPath("plantuml")
-		if err == nil {
-			log.Printf("找不到 JAR 包，但找到 plantuml 命令行工具，使用命令行工具渲染")
-			return v.renderUsingCommandLine()
+		v.renderErr = err
+		if err != nil {
+			v.publish(event.RenderFailed, err)
+			v.showRenderError(err)
+			return
 		}
-
-		return nil, fmt.Errorf("找不到 plantuml.jar 或命令行工具，请确保已安装 PlantUML")
+		v.showImage(img)
+		v.publish(event.RenderFinished, nil)
+	})
+	if err == nil {
+		log.Printf("成功渲染文件: %s", logging.Path(v.filePath))
 	}
+}
 
-	// 创建临时目录用于存放生成的图像
-	tempDir, err := ioutil.TempDir("", "plantuml")
-	if err != nil {
-		return nil, fmt.Errorf("无法创建临时目录: %v", err)
+// renderImage 使用查看器的渲染器渲染PlantUML图表的当前页，按设置渲染为PNG或SVG。
+// ctx结束时结束正在运行的PlantUML进程（渲染器实现了ContextRenderer时）
+func (v *Viewer) renderImage(ctx context.Context) (fyne.Resource, error) {
+	renderer := v.renderer
+	if r, ok := renderer.(ContextRenderer); ok {
+		renderer = r.WithContext(ctx)
 	}
-	defer os.RemoveAll(tempDir) // 函数返回时删除临时目录
-
-	// 获取文件名
-	fileName := filepath.Base(v.filePath)
-	pngName := strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".png"
-	outputPath := filepath.Join(tempDir, pngName)
-
-	// 执行 plantuml.jar 命令
-	log.Printf("执行命令: java -jar %s -tpng -o %s %s", jarPath, tempDir, v.filePath)
-	cmd := exec.Command("java", "-jar", jarPath, "-tpng", "-o", tempDir, v.filePath)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
 
-	if err := cmd.Run(); err != nil {
-		log.Printf("执行失败，stderr: %s, stdout: %s", stderr.String(), stdout.String())
-		return nil, fmt.Errorf("执行 plantuml 失败: %v, %s", err, stderr.String())
+	// 有git合并冲突标记时不把源码交给PlantUML，分别渲染冲突两边的版本；加密的文件在内存中解密后渲染
+	var encrypted []byte
+	kind := ""
+	if source, err := v.readFile(); err == nil {
+		if c, ok := outline.ParseConflict(string(source)); ok {
+			return nil, v.renderConflict(renderer, c)
+		}
+		if !v.virtual {
+			kind = secret.Detect(v.filePath, source)
+			encrypted = source
+			v.encrypted.Store(kind)
+		}
 	}
 
-	log.Printf("命令执行成功，查找生成的图像文件")
-
-	// 检查输出文件是否存在
-	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
-		log.Printf("警告: 预期的输出文件不存在: %s，尝试查找生成的图像文件", outputPath)
-		// 查找临时目录中的 PNG 文件
-		files, err := filepath.Glob(filepath.Join(tempDir, "*.png"))
-		if err != nil || len(files) == 0 {
-			return nil, fmt.Errorf("无法找到生成的图像文件")
+	// 以SVG显示时由渲染器输出SVG，虚拟文件、加密的文件和不支持SVG的渲染器仍然使用PNG
+	if !v.virtual && kind == "" && useSVG(v.filePath) {
+		if svgRenderer, ok := renderer.(SVGRenderer); ok {
+			return v.renderSVGImage(svgRenderer)
 		}
-		outputPath = files[0] // 使用第一个找到的 PNG 文件
-		log.Printf("找到图像文件: %s", outputPath)
+		log.Printf("渲染器不支持SVG，以PNG显示")
 	}
 
-	// 读取生成的图像
-	imgData, err := ioutil.ReadFile(outputPath)
+	var imgData []byte
+	var err error
+	if kind != "" {
+		imgData, err = v.renderEncrypted(ctx, renderer, kind, encrypted)
+	} else if v.virtual {
+		imgData, err = renderer.(SourceRenderer).RenderSource(v.Source(), filepath.Dir(v.filePath), v.Page())
+	} else if page := int(v.page.Load()); page > 1 {
+		pageRenderer, ok := renderer.(PageRenderer)
+		if !ok {
+			return nil, fmt.Errorf("渲染器不支持显示第%d页", page)
+		}
+		imgData, err = pageRenderer.RenderPage(v.filePath, page)
+	} else {
+		imgData, err = renderer.Render(v.filePath)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("无法读取生成的图像: %v", err)
+		return nil, err
 	}
 
 	log.Printf("成功读取图像文件，大小: %d 字节", len(imgData))
 
+	if ColorBlindSafe() {
+		if remapped, err := RemapColorBlind(imgData); err != nil {
+			log.Printf("警告：%v，显示原来的颜色", err)
+		} else {
+			imgData = remapped
+		}
+	}
+
 	// 创建 Fyne 资源
 	res := fyne.NewStaticResource("plantuml_image.png", imgData)
 	return res, nil
 }
 
-// renderUsingCommandLine 使用命令行工具渲染PlantUML图表
-func (v *Viewer) renderUsingCommandLine() (fyne.Resource, error) {
-	// 创建临时目录用于存放生成的图像
-	tempDir, err := ioutil.TempDir("", "plantuml")
-	if err != nil {
-		return nil, fmt.Errorf("无法创建临时目录: %v", err)
+// Page 返回显示的页码，从1开始
+func (v *Viewer) Page() int {
+	if page := int(v.page.Load()); page > 1 {
+		return page
 	}
-	defer os.RemoveAll(tempDir) // 函数返回时删除临时目录
-
-	// 获取文件名
-	fileName := filepath.Base(v.filePath)
-	pngName := strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".png"
-	outputPath := filepath.Join(tempDir, pngName)
-
-	// 执行 plantuml 命令
-	log.Printf("执行命令: plantuml -tpng -o %s %s", tempDir, v.filePath)
-	cmd := exec.Command("plantuml", "-tpng", "-o", tempDir, v.filePath)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
+	return 1
+}
 
-	if err := cmd.Run(); err != nil {
-		log.Printf("执行失败，stderr: %s, stdout: %s", stderr.String(), stdout.String())
-		return nil, fmt.Errorf("执行 plantuml 命令失败: %v, %s", err, stderr.String())
+// SetPage 切换到多页图表的第page页（从1开始）并立即重新渲染，返回渲染错误。快照不能切换页
+func (v *Viewer) SetPage(page int) error {
+	if v.frozen || page == v.Page() {
+		return nil
 	}
-
-	log.Printf("命令执行成功，查找生成的图像文件")
-
-	// 检查输出文件是否存在
-	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
-		log.Printf("警告: 预期的输出文件不存在: %s，尝试查找生成的图像文件", outputPath)
-		// 查找临时目录中的 PNG 文件
-		files, err := filepath.Glob(filepath.Join(tempDir, "*.png"))
-		if err != nil || len(files) == 0 {
-			return nil, fmt.Errorf("无法找到生成的图像文件")
-		}
-		outputPath = files[0] // 使用第一个找到的 PNG 文件
-		log.Printf("找到图像文件: %s", outputPath)
+	if page < 1 {
+		page = 1
 	}
+	v.page.Store(int32(page))
+	return v.renderSynchronously()
+}
 
-	// 读取生成的图像
-	imgData, err := ioutil.ReadFile(outputPath)
-	if err != nil {
-		return nil, fmt.Errorf("无法读取生成的图像: %v", err)
+// setContent 记录重新读到的文件内容，并监控其中引用的本地图片，图片更新后自动重新渲染
+func (v *Viewer) setContent(content []byte) {
+	v.watcher.SetContent(string(content))
+	if !v.virtual {
+		v.watcher.SetDependencies(render.ImageFiles(content, filepath.Dir(v.filePath)))
 	}
+}
 
-	log.Printf("成功读取图像文件，大小: %d 字节", len(imgData))
-
-	// 创建 Fyne 资源
-	res := fyne.NewStaticResource("plantuml_image.png", imgData)
-	return res, nil
+// readFile 读取文件的最新内容，虚拟文件返回内存中的内容
+func (v *Viewer) readFile() ([]byte, error) {
+	if v.virtual {
+		return v.Source(), nil
+	}
+	return ioutil.ReadFile(v.filePath)
 }
 
-// showRenderError 显示渲染错误
-func (v *Viewer) showRenderError(message string) {
+// showRenderError 显示渲染错误和重试按钮。超时或Graphviz出错时，另外提供换用其他布局引擎重试的按钮；
+// 文件中有合并冲突时显示并排的冲突两边的版本，加密的文件缺少凭据时提供解锁按钮
+func (v *Viewer) showRenderError(err error) {
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		fyne.Do(func() {
+			v.container.Objects = []fyne.CanvasObject{conflictView(conflict)}
+			v.container.Refresh()
+		})
+		return
+	}
+	var locked *LockedError
+	if errors.As(err, &locked) {
+		v.showLocked(locked)
+		return
+	}
+
+	message := fmt.Sprintf("无法渲染PlantUML图表: %v", err)
+	if IsTimeout(err) {
+		// 超时的错误中只有被结束的进程的输出，直接说明原因和可以怎么做
+		message = fmt.Sprintf("渲染超过%v没有完成，已结束PlantUML进程。\n图表可能太大或布局太复杂，可以重试、换用其他布局引擎，或在“视图”菜单的“渲染超时...”中延长时间", RenderTimeout())
+	}
 	log.Printf("渲染错误: %s", message)
 
 	errorText := widget.NewLabel(message)
 	errorText.Alignment = fyne.TextAlignCenter
 
 	// 添加重试按钮
-	retryButton := widget.NewButton("重试", func() {
+	buttons := []fyne.CanvasObject{widget.NewButton("重试", func() {
 		go v.renderPlantUML()
-	})
+	})}
+	if NeedsOtherLayout(err) && !v.virtual {
+		for _, engine := range AvailableLayouts() {
+			if engine == FileLayout(v.filePath) {
+				continue
+			}
+			engine := engine
+			buttons = append(buttons, widget.NewButton("用"+LayoutLabel(engine)+"布局重试", func() {
+				// 首次打开时的错误在设置回调之前显示，点击时再读取回调
+				if v.onLayoutRetry != nil {
+					v.onLayoutRetry(engine)
+				}
+			}))
+		}
+	}
 
 	errorContainer := container.NewVBox(
 		errorText,
-		container.NewCenter(retryButton),
+		container.NewCenter(container.NewHBox(buttons...)),
 	)
 
 	// 在UI线程中更新界面
 	fyne.Do(func() {
-		v.container.Objects[0] = container.NewCenter(errorContainer)
+		v.container.Objects = []fyne.CanvasObject{container.NewCenter(errorContainer)}
 		v.container.Refresh()
 	})
 }
 
 // renderSynchronously 同步渲染PlantUML图表
 func (v *Viewer) renderSynchronously() error {
-	log.Printf("开始同步渲染文件: %s", v.filePath)
+	log.Printf("开始同步渲染文件: %s", logging.Path(v.filePath))
+	v.publish(event.RenderStarted, nil)
 
 	// 重新读取文件内容，确保获取最新的内容
-	content, err := ioutil.ReadFile(v.filePath)
+	content, err := v.readFile()
 	if err == nil {
 		// 只有成功读取时才更新内容
-		v.content = string(content)
+		v.setContent(content)
 		log.Printf("已重新读取文件内容，大小: %d 字节", len(content))
 	} else {
 		log.Printf("警告：无法重新读取文件内容: %v，使用缓存的内容", err)
 	}
 
-	// 使用 JAR 包渲染 PlantUML 图表
-	img, err := v.renderUsingJar()
+	// 渲染 PlantUML 图表，同时取代仍在后台进行的渲染
+	ctx := v.startRender()
+	img, err := v.renderImage(ctx)
+	if ctx.Err() != nil {
+		// 渲染期间文件又有变化，后台开始的新渲染会显示最新的结果
+		log.Printf("渲染 %s 已取消", logging.Path(v.filePath))
+		return nil
+	}
+	if err != nil && IsTransient(err) && RenderRetries() > 0 && !v.frozen {
+		// 暂时性错误在后台重试，重试期间保持正在渲染的状态，不显示错误
+		log.Printf("渲染遇到暂时性错误: %v，在后台重试", err)
+		go v.renderFrom(1)
+		return err
+	}
+	v.renderErr = err
 	if err != nil {
 		log.Printf("使用 JAR 渲染失败: %v", err)
-		v.showRenderError(fmt.Sprintf("无法渲染PlantUML图表: %v", err))
+		v.showRenderError(err)
+		v.publish(event.RenderFailed, err)
 		return err
 	}
 
 	// 渲染成功，更新UI
+	v.showImage(img)
+	v.publish(event.RenderFinished, nil)
+
+	log.Printf("成功同步渲染文件: %s", logging.Path(v.filePath))
+	return nil
+}
+
+// showImage 显示渲染好的图像，并保持当前的缩放比例
+func (v *Viewer) showImage(img fyne.Resource) {
 	v.imageView.Resource = img
-	v.container.Objects[0] = container.NewScroll(v.imageView)
+	v.imageSize = imageSizeOf(img)
+	if isSVGImage(img) {
+		// SVG的尺寸和其中的元素区域一起解析，跳到源码和显示提示直接使用
+		if m, err := svgSourceMap(img); err != nil {
+			log.Printf("无法解析SVG图像: %v", err)
+			v.imageSize = fyne.Size{}
+		} else {
+			v.sourceMap = m
+			v.imageSize = fyne.NewSize(float32(m.width), float32(m.height))
+		}
+	}
+	v.applyZoom()
+	v.container.Objects = []fyne.CanvasObject{v.imageView, v.annotationLayer}
 	v.container.Refresh()
 	v.rendered = true
-
-	log.Printf("成功同步渲染文件: %s", v.filePath)
-	return nil
 }
 
 // monitorFile 监控文件变化并在变化时自动刷新
 func (v *Viewer) monitorFile() {
-	// 为了减少CPU使用，不使用过于频繁的ticker
-	ticker := time.NewTicker(500 * time.Millisecond) // 每500毫秒检查一次文件变化
-	defer ticker.Stop()
+	v.watcher.Run(func(string) {
+		// 使用UI线程更新，确保UI操作线程安全
+		fyne.Do(func() {
+			v.scheduleRender(RenderDebounce)
+			v.publish(event.FileChanged, nil)
+		})
+	})
+}
 
-	log.Printf("开始监控文件: %s", v.filePath)
+// sourceComplete 判断PlantUML源码是否已经写完：不为空，并且每个@startuml等开始标记都有对应的@enduml等结束标记。
+// 没有开始标记的文件无法判断，视为已经写完
+func sourceComplete(source string) bool {
+	if strings.TrimSpace(source) == "" {
+		return false
+	}
+	starts, ends := 0, 0
+	for _, line := range strings.Split(source, "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(line, "@start"):
+			starts++
+		case strings.HasPrefix(line, "@end"):
+			ends++
+		}
+	}
+	return ends >= starts
+}
 
-	// 为防止频繁刷新，添加刷新冷却时间
-	lastRefreshTime := time.Now()
-	refreshCooldown := 1 * time.Second // 两次刷新之间最短的时间间隔
+// StopMonitoring 停止文件监控，可以安全地多次调用
+func (v *Viewer) StopMonitoring() {
+	v.watcher.Stop()
+}
 
-	// 记录文件大小，用于快速检测文件是否变化
-	fileInfo, err := os.Stat(v.filePath)
-	var lastSize int64 = 0
-	if err == nil {
-		lastSize = fileInfo.Size()
-	}
+// Close 停止文件监控，结束正在运行的渲染和后台重试，并清除解密的凭据，用于关闭标签或退出。可以安全地多次调用
+func (v *Viewer) Close() {
+	v.watcher.Stop()
+	renders.cancel(v)
+	v.cancel()
+	v.keyMu.Lock()
+	v.key = secret.Key{}
+	v.keyMu.Unlock()
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			// 检查文件是否被修改
-			fileInfo, err := os.Stat(v.filePath)
-			if err != nil {
-				log.Printf("监控文件时出错: %v", err)
-				continue
-			}
+// closed 返回查看器是否已经关闭
+func (v *Viewer) closed() bool {
+	return v.ctx.Err() != nil
+}
+
+// SetWatchPaused 暂停或恢复后台监控，暂停期间的变化在恢复后才会被发现
+func (v *Viewer) SetWatchPaused(paused bool) {
+	v.watcher.SetPaused(paused)
+}
 
-			// 快速检查：如果文件大小没变，通常内容也没变
-			currentSize := fileInfo.Size()
-			currentModTime := fileInfo.ModTime()
+// RefreshIfChanged 重新检查文件，如果内容有变化则重新渲染，返回是否发生了变化
+// 用于关闭后台监控时按需刷新（例如窗口重新获得焦点时）
+func (v *Viewer) RefreshIfChanged() bool {
+	if v.frozen || v.virtual {
+		return false
+	}
+	_, changed, err := v.watcher.Check()
+	if err != nil {
+		log.Printf("检查文件时出错: %v", err)
+		return false
+	}
+	if !changed {
+		return false
+	}
 
-			// 检查文件大小和修改时间是否有变化
-			if (currentSize != lastSize || currentModTime.After(v.lastModified)) &&
-				time.Since(lastRefreshTime) > refreshCooldown {
+	log.Printf("文件 %s 内容有变化，重新渲染", logging.Path(v.filePath))
+	v.scheduleRender(0)
+	return true
+}
 
-				log.Printf("检测到文件 %s 可能有变化，检查内容", v.filePath)
+// Rerender 在后台重新渲染，不管文件内容是否变化，用于通过!include等方式引用了外部数据的图表。
+// 不使用磁盘缓存，结果写回缓存。快照不重新渲染
+func (v *Viewer) Rerender() {
+	v.uncached.Store(true)
+	v.scheduleRender(0)
+}
 
-				// 文件可能已修改，读取内容确认
-				content, err := ioutil.ReadFile(v.filePath)
-				if err != nil {
-					log.Printf("读取已更改文件失败: %v", err)
-					continue
-				}
+// scheduleRender 通过渲染队列在delay后在后台渲染，等待期间再次请求时合并为一次并重新计时
+func (v *Viewer) scheduleRender(delay time.Duration) {
+	renders.schedule(v, delay, v.renderPlantUML)
+}
 
-				// 只有当内容真的变了才重新渲染
-				newContent := string(content)
-				if newContent != v.content {
-					log.Printf("文件内容确实有变化，准备刷新显示")
-					v.content = newContent
-					v.lastModified = currentModTime
-					lastSize = currentSize
-					lastRefreshTime = time.Now()
-
-					// 使用UI线程更新，确保UI操作线程安全
-					fyne.Do(func() {
-						go v.renderPlantUML() // 在UI线程中启动渲染
-
-						// 如果设置了回调函数，调用它
-						if v.onFileChanged != nil {
-							log.Printf("调用文件变化回调函数")
-							v.onFileChanged()
-						}
-					})
-				} else {
-					log.Printf("文件修改时间或大小变化，但内容未变，不需刷新")
-				}
-			}
-		case <-v.stopMonitoring:
-			// 收到停止监控的信号
-			log.Printf("停止监控文件: %s", v.filePath)
-			return
-		}
-	}
+// publish 发布与这个文件相关的事件，需要在UI线程中调用
+func (v *Viewer) publish(t event.Type, err error) {
+	v.events.Publish(event.Event{Type: t, Path: v.filePath, Err: err})
 }
 
-// StopMonitoring 停止文件监控
-func (v *Viewer) StopMonitoring() {
-	v.stopMonitoring <- true
+// SetOnLayoutRetry 设置渲染超时或Graphviz出错时点击换用其他布局引擎重试的回调
+func (v *Viewer) SetOnLayoutRetry(callback func(engine string)) {
+	v.onLayoutRetry = callback
 }
 
-// SetOnFileChanged 设置文件变化时的回调函数
-func (v *Viewer) SetOnFileChanged(callback func()) {
-	v.onFileChanged = callback
+// SetOnSwipe 设置触控板水平轻扫时的回调函数
+func (v *Viewer) SetOnSwipe(callback func(SwipeDirection)) {
+	v.scroll.onSwipe = callback
 }
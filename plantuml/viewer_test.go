@@ -0,0 +1,337 @@
+package plantuml
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/test"
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/internal/secret"
+)
+
+func TestSourceComplete(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"", false},
+		{"  \n", false},
+		{"@startuml\nA -> B\n", false},
+		{"@startuml\nA -> B\n@enduml\n", true},
+		{"@StartUML\nA -> B\n  @EndUML  \n", true},
+		{"@startuml\nA -> B\n@enduml\n@startmindmap\n* root\n", false},
+		{"@startuml\nA -> B\n@enduml\n@startmindmap\n* root\n@endmindmap\n", true},
+		{"A -> B\n", true},
+	}
+	for _, tt := range tests {
+		if got := sourceComplete(tt.source); got != tt.want {
+			t.Errorf("sourceComplete(%q) = %v，应为 %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+// blockingRenderer 在block为true时一直等到ctx结束，模拟卡住的PlantUML
+type blockingRenderer struct {
+	ctx     context.Context
+	block   *atomic.Bool
+	started chan struct{}
+}
+
+func (r blockingRenderer) WithContext(ctx context.Context) Renderer {
+	return blockingRenderer{ctx: ctx, block: r.block, started: r.started}
+}
+
+func (r blockingRenderer) Render(string) ([]byte, error) {
+	if r.block.Load() {
+		r.started <- struct{}{}
+		<-r.ctx.Done()
+		return nil, r.ctx.Err()
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	return buf.Bytes(), nil
+}
+
+func TestCloseCancelsRender(t *testing.T) {
+	test.NewApp()
+	path := filepath.Join(t.TempDir(), "a.puml")
+	if err := ioutil.WriteFile(path, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := blockingRenderer{block: &atomic.Bool{}, started: make(chan struct{}, 1)}
+	events := event.NewBus()
+	viewer, err := NewViewer(path, r, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failed atomic.Int32
+	events.Subscribe(func(event.Event) { failed.Add(1) }, event.RenderFailed)
+
+	r.block.Store(true)
+	done := make(chan struct{})
+	go func() {
+		viewer.renderPlantUML()
+		close(done)
+	}()
+	<-r.started
+	viewer.Close()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("关闭查看器后应结束正在进行的渲染")
+	}
+	if failed.Load() != 0 {
+		t.Error("关闭查看器后被取消的渲染不应报告为渲染失败")
+	}
+}
+
+func TestNewerRenderSupersedesOlder(t *testing.T) {
+	test.NewApp()
+	path := filepath.Join(t.TempDir(), "a.puml")
+	if err := ioutil.WriteFile(path, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := blockingRenderer{block: &atomic.Bool{}, started: make(chan struct{}, 1)}
+	events := event.NewBus()
+	viewer, err := NewViewer(path, r, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer viewer.Close()
+	var failed, finished atomic.Int32
+	events.Subscribe(func(event.Event) { failed.Add(1) }, event.RenderFailed)
+	events.Subscribe(func(event.Event) { finished.Add(1) }, event.RenderFinished)
+
+	// 第一次渲染卡住时开始第二次渲染，第一次渲染应被取消，只显示第二次的结果
+	r.block.Store(true)
+	done := make(chan struct{})
+	go func() {
+		viewer.renderPlantUML()
+		close(done)
+	}()
+	<-r.started
+	r.block.Store(false)
+	viewer.renderPlantUML()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("开始新的渲染后应结束被取代的渲染")
+	}
+	for deadline := time.Now().Add(2 * time.Second); finished.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if finished.Load() != 1 || failed.Load() != 0 {
+		t.Errorf("应只有最新的渲染完成，完成%d次，失败%d次", finished.Load(), failed.Load())
+	}
+}
+
+// countingBackend 记录实际渲染的次数，返回1×1的PNG
+type countingBackend struct {
+	calls *atomic.Int32
+}
+
+func (b countingBackend) RenderFile(ctx context.Context, filePath string, page int, opts render.Options) ([]byte, error) {
+	b.calls.Add(1)
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	return buf.Bytes(), nil
+}
+
+func (b countingBackend) RenderBytes(ctx context.Context, source []byte, dir string, page int, opts render.Options) ([]byte, error) {
+	return b.RenderFile(ctx, dir, page, opts)
+}
+
+func (countingBackend) Formats() []string {
+	return render.PlantUMLFormats
+}
+
+func TestRerenderSkipsCache(t *testing.T) {
+	test.NewApp()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.puml")
+	if err := ioutil.WriteFile(path, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var calls atomic.Int32
+	backend := render.Cached{Renderer: countingBackend{&calls}, Dir: filepath.Join(dir, "cache")}
+	viewer, err := NewViewer(path, BackendRenderer{Backend: backend}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer viewer.Close()
+
+	viewer.renderPlantUML()
+	viewer.renderPlantUML()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("内容没有变化时应使用缓存，渲染了%d次", n)
+	}
+	// 手动或定时重新渲染不使用缓存，引用的远程内容变化后也能更新
+	viewer.Rerender()
+	for deadline := time.Now().Add(2 * time.Second); calls.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Rerender应重新渲染，渲染了%d次", n)
+	}
+}
+
+func TestZoom(t *testing.T) {
+	test.NewApp()
+	path := filepath.Join(t.TempDir(), "a.puml")
+	if err := ioutil.WriteFile(path, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	viewer, err := NewViewer(path, blockingRenderer{block: &atomic.Bool{}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer viewer.Close()
+	w := test.NewWindow(viewer.GetCanvas())
+	defer w.Close()
+	w.Resize(fyne.NewSize(100, 100))
+
+	if got := viewer.ZoomLabel(); got != "适应窗口" {
+		t.Errorf("默认应适应窗口，得到 %s", got)
+	}
+	viewer.ActualSize()
+	if got := viewer.ZoomLabel(); got != "100%" {
+		t.Errorf("实际大小应为100%%，得到 %s", got)
+	}
+	viewer.ZoomIn()
+	if got := viewer.ZoomLabel(); got != "125%" {
+		t.Errorf("放大一步应为125%%，得到 %s", got)
+	}
+	viewer.ZoomOut()
+	viewer.ZoomOut()
+	if got := viewer.ZoomLabel(); got != "80%" {
+		t.Errorf("缩小两步应为80%%，得到 %s", got)
+	}
+	for i := 0; i < 20; i++ {
+		viewer.ZoomOut()
+	}
+	if viewer.Viewport().Zoom != MinZoom {
+		t.Errorf("缩放比例不应小于MinZoom，得到 %v", viewer.Viewport().Zoom)
+	}
+	viewer.ZoomToFit()
+	if viewer.Viewport().Zoom != 0 {
+		t.Errorf("适应窗口后缩放比例应为0，得到 %v", viewer.Viewport().Zoom)
+	}
+}
+
+// sourceRenderer 把源码渲染为高度为行数的图像，便于判断渲染的是哪个版本
+type sourceRenderer struct{}
+
+func (sourceRenderer) Render(string) ([]byte, error) {
+	return nil, errors.New("带冲突标记或加密的文件不应交给PlantUML")
+}
+
+func (sourceRenderer) RenderSource(source []byte, dir string, page int) ([]byte, error) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, strings.Count(string(source), "\n"))))
+	return buf.Bytes(), nil
+}
+
+func TestMergeConflict(t *testing.T) {
+	test.NewApp()
+	path := filepath.Join(t.TempDir(), "a.puml")
+	source := "@startuml\n<<<<<<< HEAD\nA -> B\n=======\nA -> C\nC -> B\n>>>>>>> feature\n@enduml\n"
+	if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	viewer, err := NewViewer(path, sourceRenderer{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer viewer.Close()
+
+	var conflict *ConflictError
+	if !errors.As(viewer.RenderError(), &conflict) {
+		t.Fatalf("有冲突标记时应返回ConflictError，得到 %v", viewer.RenderError())
+	}
+	if conflict.Count != 1 || conflict.Line != 2 || conflict.OursLabel != "HEAD" || conflict.TheirsLabel != "feature" {
+		t.Errorf("冲突信息不正确: %+v", conflict.Conflict)
+	}
+	height := func(data []byte) int {
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img.Bounds().Dy()
+	}
+	if conflict.OursErr != nil || conflict.TheirsErr != nil || height(conflict.Ours) != 3 || height(conflict.Theirs) != 4 {
+		t.Errorf("应分别渲染冲突两边的版本: %v, %v", conflict.OursErr, conflict.TheirsErr)
+	}
+}
+
+func TestEncryptedFile(t *testing.T) {
+	if _, err := exec.LookPath(secret.GPG); err != nil {
+		t.Skip("没有安装gpg")
+	}
+	test.NewApp()
+	t.Setenv("GNUPGHOME", t.TempDir())
+	t.Cleanup(func() { exec.Command("gpgconf", "--kill", "gpg-agent").Run() })
+	defer ForgetKeys()
+
+	path := filepath.Join(t.TempDir(), "net.puml")
+	if err := ioutil.WriteFile(path, []byte("@startuml\nnode db\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(secret.GPG, "--batch", "--pinentry-mode", "loopback", "--passphrase", "secret", "--symmetric", path).CombinedOutput(); err != nil {
+		t.Skipf("无法用gpg加密: %v\n%s", err, out)
+	}
+	viewer, err := NewViewer(path+".gpg", sourceRenderer{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer viewer.Close()
+
+	var locked *LockedError
+	if !errors.As(viewer.RenderError(), &locked) || locked.Kind != secret.KindGPG || viewer.Encrypted() != secret.KindGPG {
+		t.Fatalf("没有口令时应返回LockedError，得到 %v", viewer.RenderError())
+	}
+	viewer.key = secret.Key{Passphrase: "secret"}
+	if err := viewer.renderSynchronously(); err != nil {
+		t.Fatalf("输入口令后应能渲染: %v", err)
+	}
+	if viewer.Image() == nil {
+		t.Error("解密后应显示图像")
+	}
+}
+
+func TestEncryptedDecryptTimeout(t *testing.T) {
+	// 模拟卡住的gpg：一直等待，直到被结束
+	script := filepath.Join(t.TempDir(), "gpg")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := secret.GPG
+	secret.GPG = script
+	defer func() { secret.GPG = old }()
+	SetRenderTimeout(200 * time.Millisecond)
+	defer SetRenderTimeout(0)
+
+	v := &Viewer{filePath: filepath.Join(t.TempDir(), "net.puml.gpg"), key: secret.Key{Passphrase: "secret"}}
+	start := time.Now()
+	_, err := v.renderEncrypted(context.Background(), sourceRenderer{}, secret.KindGPG, []byte("encrypted"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("解密超过RenderTimeout时应结束，得到 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("卡住的解密应在RenderTimeout后结束，用了 %v", elapsed)
+	}
+}
@@ -0,0 +1,76 @@
+package plantuml
+
+import (
+	"bytes"
+	"image"
+	_ "image/png" // 注册PNG解码器，用于读取渲染图像的尺寸
+
+	"fyne.io/fyne/v2"
+)
+
+// Viewport 描述查看器当前的可视区域：缩放比例和滚动位置
+type Viewport struct {
+	Zoom   float32       // 缩放比例，0表示适应窗口
+	Offset fyne.Position // 滚动偏移
+}
+
+// Viewport 返回查看器当前的视口
+func (v *Viewer) Viewport() Viewport {
+	return Viewport{Zoom: v.zoom, Offset: v.scroll.Offset}
+}
+
+// SetViewport 将查看器调整到指定的视口
+func (v *Viewer) SetViewport(vp Viewport) {
+	if vp.Zoom < 0 {
+		vp.Zoom = 0
+	}
+	v.zoom = vp.Zoom
+	v.applyZoom()
+	v.scroll.Refresh()
+	v.scroll.ScrollToOffset(vp.Offset)
+}
+
+// SetOnViewportChanged 设置视口变化时的回调函数
+func (v *Viewer) SetOnViewportChanged(callback func(Viewport)) {
+	v.onViewportChanged = callback
+	v.scroll.OnScrolled = func(fyne.Position) {
+		v.notifyViewportChanged()
+	}
+}
+
+// notifyViewportChanged 通知视口发生了变化
+func (v *Viewer) notifyViewportChanged() {
+	if v.onViewportChanged != nil {
+		v.onViewportChanged(v.Viewport())
+	}
+}
+
+// applyZoom 根据缩放比例设置图像的最小尺寸，超出窗口的部分可以滚动查看。
+// 缩放后比窗口小的图像按原来的比例居中显示，不再拉伸到窗口大小
+func (v *Viewer) applyZoom() {
+	v.zoomLabel.SetText(v.ZoomLabel())
+	if v.zoom <= 0 || v.imageSize.IsZero() {
+		v.imageView.SetMinSize(fyne.NewSize(0, 0))
+		v.scroll.Content = v.container
+		return
+	}
+	v.imageView.SetMinSize(fyne.NewSize(v.imageSize.Width*v.zoom, v.imageSize.Height*v.zoom))
+	v.scroll.Content = v.centered
+}
+
+// imageSizeOf 读取图像资源的原始像素尺寸，无法解析时返回零尺寸
+func imageSizeOf(res fyne.Resource) fyne.Size {
+	if res == nil {
+		return fyne.Size{}
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(res.Content()))
+	if err != nil {
+		return fyne.Size{}
+	}
+	return fyne.NewSize(float32(cfg.Width), float32(cfg.Height))
+}
+
+// ImageSize 返回最近一次渲染图像的原始像素尺寸，尚未渲染成功时返回零尺寸
+func (v *Viewer) ImageSize() fyne.Size {
+	return v.imageSize
+}
@@ -0,0 +1,133 @@
+package plantuml
+
+import (
+	"fmt"
+	"math"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+// 缩放的范围和步长
+const (
+	MinZoom  float32 = 0.1  // 最小缩放比例
+	MaxZoom  float32 = 8    // 最大缩放比例，再大的位图在SVG模式下仍然清晰，但滚动会变慢
+	zoomStep float32 = 1.25 // 每次放大或缩小的倍数
+
+	// scrollZoomUnit 按住Cmd滚动这么多距离缩放一个zoomStep，鼠标滚轮一格约为一步
+	scrollZoomUnit float32 = 40
+)
+
+// ZoomIn 以视口中心为基准放大一步
+func (v *Viewer) ZoomIn() {
+	v.zoomAround(v.effectiveZoom()*zoomStep, v.viewportCenter())
+}
+
+// ZoomOut 以视口中心为基准缩小一步
+func (v *Viewer) ZoomOut() {
+	v.zoomAround(v.effectiveZoom()/zoomStep, v.viewportCenter())
+}
+
+// ZoomToFit 恢复为适应窗口显示整张图
+func (v *Viewer) ZoomToFit() {
+	v.SetViewport(Viewport{})
+	v.notifyViewportChanged()
+}
+
+// ActualSize 以视口中心为基准按图像的原始像素尺寸显示（100%）
+func (v *Viewer) ActualSize() {
+	v.zoomAround(1, v.viewportCenter())
+}
+
+// ZoomLabel 返回当前缩放比例的文字，例如 "150%"，适应窗口时为 "适应窗口"
+func (v *Viewer) ZoomLabel() string {
+	if v.zoom <= 0 {
+		return "适应窗口"
+	}
+	return fmt.Sprintf("%.0f%%", v.zoom*100)
+}
+
+// effectiveZoom 返回图像实际显示的比例，适应窗口时按视口和图像的尺寸计算
+func (v *Viewer) effectiveZoom() float32 {
+	if v.zoom > 0 {
+		return v.zoom
+	}
+	return v.fitZoom()
+}
+
+// fitZoom 返回适应窗口时的缩放比例，尺寸未知时为1
+func (v *Viewer) fitZoom() float32 {
+	size := v.scroll.Size()
+	if v.imageSize.IsZero() || size.IsZero() {
+		return 1
+	}
+	return float32(math.Min(float64(size.Width/v.imageSize.Width), float64(size.Height/v.imageSize.Height)))
+}
+
+// viewportCenter 返回视口中心在视口中的坐标
+func (v *Viewer) viewportCenter() fyne.Position {
+	size := v.scroll.Size()
+	return fyne.NewPos(size.Width/2, size.Height/2)
+}
+
+// imageOrigin 返回按比例zoom显示时图像左上角在滚动内容中的位置：内容比视口小时居中显示
+func (v *Viewer) imageOrigin(zoom float32) fyne.Position {
+	view := v.scroll.Size()
+	w, h := v.imageSize.Width*zoom, v.imageSize.Height*zoom
+	return fyne.NewPos(float32(math.Max(0, float64(view.Width-w)/2)), float32(math.Max(0, float64(view.Height-h)/2)))
+}
+
+// zoomAround 缩放到zoom，并保持视口中at处（视口坐标）的图像位置不动，用于按住Cmd滚动时以鼠标位置为中心缩放
+func (v *Viewer) zoomAround(zoom float32, at fyne.Position) {
+	if v.imageSize.IsZero() {
+		return
+	}
+	zoom = float32(math.Max(float64(MinZoom), math.Min(float64(MaxZoom), float64(zoom))))
+	old := v.effectiveZoom()
+	oldOrigin := v.imageOrigin(old)
+	// at处对应的图像像素坐标
+	px := (v.scroll.Offset.X + at.X - oldOrigin.X) / old
+	py := (v.scroll.Offset.Y + at.Y - oldOrigin.Y) / old
+
+	origin := v.imageOrigin(zoom)
+	offset := fyne.NewPos(origin.X+px*zoom-at.X, origin.Y+py*zoom-at.Y)
+	v.SetViewport(Viewport{Zoom: zoom, Offset: v.clampOffset(offset, zoom)})
+	v.notifyViewportChanged()
+}
+
+// clampOffset 把滚动偏移限制在按比例zoom显示时内容的范围内
+func (v *Viewer) clampOffset(offset fyne.Position, zoom float32) fyne.Position {
+	view := v.scroll.Size()
+	maxX := float64(v.imageSize.Width*zoom - view.Width)
+	maxY := float64(v.imageSize.Height*zoom - view.Height)
+	return fyne.NewPos(
+		float32(math.Max(0, math.Min(maxX, float64(offset.X)))),
+		float32(math.Max(0, math.Min(maxY, float64(offset.Y)))),
+	)
+}
+
+// scrollZoom 按住Cmd滚动时以鼠标位置为中心缩放，向上滚动放大
+func (v *Viewer) scrollZoom(at fyne.Position, dy float32) {
+	factor := float32(math.Pow(float64(zoomStep), float64(dy/scrollZoomUnit)))
+	v.zoomAround(v.effectiveZoom()*factor, at)
+}
+
+// pan 拖动图像，按拖动的距离反向移动滚动位置
+func (v *Viewer) pan(delta fyne.Delta) {
+	if v.zoom <= 0 {
+		return
+	}
+	offset := fyne.NewPos(v.scroll.Offset.X-delta.DX, v.scroll.Offset.Y-delta.DY)
+	v.scroll.ScrollToOffset(v.clampOffset(offset, v.zoom))
+	v.notifyViewportChanged()
+}
+
+// zoomModifierHeld 判断是否按住了Cmd（其他系统为Ctrl），按住时滚动用于缩放
+func zoomModifierHeld() bool {
+	app := fyne.CurrentApp()
+	if app == nil {
+		return false
+	}
+	d, ok := app.Driver().(desktop.Driver)
+	return ok && d.CurrentKeyModifiers()&fyne.KeyModifierShortcutDefault != 0
+}
@@ -0,0 +1,97 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Renderer 是渲染图表的一种方式：每次启动新的PlantUML（Local）、常驻的PlantUML进程（Pool）或Kroki服务（Kroki）。
+// 调用方按设置选择其中一种，不用关心具体怎样运行PlantUML，测试中也可以换成不依赖Java的实现
+type Renderer interface {
+	// RenderFile 按opts渲染文件的第page页（从1开始），!include等相对路径相对于文件所在的目录
+	RenderFile(ctx context.Context, filePath string, page int, opts Options) ([]byte, error)
+	// RenderBytes 按opts渲染PlantUML源码的第page页，源码中的相对路径相对于dir解析
+	RenderBytes(ctx context.Context, source []byte, dir string, page int, opts Options) ([]byte, error)
+	// Formats 返回可以作为opts.Format的输出格式
+	Formats() []string
+}
+
+// PlantUMLFormats 是本地的PlantUML可以输出的格式
+var PlantUMLFormats = []string{"png", "svg", "eps", "pdf", "txt", "utxt", "latex"}
+
+// KrokiFormats 是Kroki可以输出的格式。除了PlantUML，大多数图表类型只支持svg
+var KrokiFormats = []string{"png", "svg", "pdf", "txt"}
+
+// Local 每次渲染启动新的PlantUML进程，Backend不为空时只使用这个PlantUML（opts.Backend优先）
+type Local struct {
+	Backend Backend
+}
+
+// options 返回使用l.Backend的opts
+func (l Local) options(opts Options) Options {
+	if opts.Backend == "" {
+		opts.Backend = l.Backend
+	}
+	return opts
+}
+
+// RenderFile 实现Renderer，见RenderPageContext
+func (l Local) RenderFile(ctx context.Context, filePath string, page int, opts Options) ([]byte, error) {
+	return RenderPageContext(ctx, filePath, page, l.options(opts))
+}
+
+// RenderBytes 实现Renderer，见RenderSourceContext
+func (l Local) RenderBytes(ctx context.Context, source []byte, dir string, page int, opts Options) ([]byte, error) {
+	return RenderSourceContext(ctx, source, dir, page, l.options(opts))
+}
+
+// Formats 实现Renderer
+func (Local) Formats() []string {
+	return PlantUMLFormats
+}
+
+// RenderFile 实现Renderer，读取文件后交给常驻进程。文件按原来的字节交给PlantUML，编码由opts.Charset指定
+func (p *Pool) RenderFile(ctx context.Context, filePath string, page int, opts Options) ([]byte, error) {
+	source, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return p.RenderSource(ctx, source, filepath.Dir(filePath), page, opts)
+}
+
+// RenderBytes 实现Renderer，见RenderSource
+func (p *Pool) RenderBytes(ctx context.Context, source []byte, dir string, page int, opts Options) ([]byte, error) {
+	return p.RenderSource(ctx, source, dir, page, opts)
+}
+
+// Formats 实现Renderer
+func (p *Pool) Formats() []string {
+	return PlantUMLFormats
+}
+
+// RenderFile 实现Renderer，图表类型按扩展名识别（见KrokiType）。Kroki只返回第一页，文件需要是UTF-8编码
+func (k Kroki) RenderFile(ctx context.Context, filePath string, page int, opts Options) ([]byte, error) {
+	if page > 1 {
+		return nil, fmt.Errorf("Kroki只能渲染第一页")
+	}
+	source, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return k.Render(ctx, KrokiType(filePath), source, opts)
+}
+
+// RenderBytes 实现Renderer，源码当作PlantUML。Kroki读取不到dir中的文件，dir被忽略
+func (k Kroki) RenderBytes(ctx context.Context, source []byte, dir string, page int, opts Options) ([]byte, error) {
+	if page > 1 {
+		return nil, fmt.Errorf("Kroki只能渲染第一页")
+	}
+	return k.Render(ctx, "plantuml", source, opts)
+}
+
+// Formats 实现Renderer
+func (Kroki) Formats() []string {
+	return KrokiFormats
+}
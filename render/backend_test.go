@@ -0,0 +1,71 @@
+package render
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackendOption(t *testing.T) {
+	defer func(saved []Backend) { Backends = saved }(Backends)
+	Backends = []Backend{BackendJar, BackendCommand}
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "plantuml"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	if got, err := CommandLine("a.puml", Options{Backend: BackendCommand}); err != nil || got != "plantuml -tpng a.puml" {
+		t.Errorf("指定命令行工具时 CommandLine = %q, %v", got, err)
+	}
+	if FindJar() == "" {
+		if _, err := CommandLine("a.puml", Options{Backend: BackendJar}); err == nil || !strings.Contains(err.Error(), "找不到") {
+			t.Errorf("指定plantuml.jar时不应改用命令行工具，得到 %v", err)
+		}
+	}
+	Backends = []Backend{BackendJar}
+	if _, err := CommandLine("a.puml", Options{Backend: BackendCommand}); err == nil || !strings.Contains(err.Error(), "不允许") {
+		t.Errorf("指定的PlantUML不在Backends中时应返回错误，得到 %v", err)
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	dir := setupFakePipe(t)
+	pool := NewPool(1, time.Minute)
+	defer pool.Close()
+
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Write([]byte("<svg/>"))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(dir, "flow.mmd")
+	if err := ioutil.WriteFile(path, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	renderers := map[string]Renderer{"pool": pool, "kroki": Kroki{URL: server.URL}, "local": Local{Backend: BackendCommand}}
+	for name, r := range renderers {
+		if len(r.Formats()) == 0 || r.Formats()[1] != "svg" {
+			t.Errorf("%s 应支持svg，得到 %v", name, r.Formats())
+		}
+	}
+
+	data, err := renderers["pool"].RenderFile(context.Background(), path, 1, Options{Format: "svg"})
+	if err != nil || !strings.HasSuffix(string(data), "-1</svg>") {
+		t.Errorf("常驻进程渲染文件得到 %q, %v", data, err)
+	}
+	if _, err := renderers["kroki"].RenderFile(context.Background(), path, 1, Options{Format: "svg"}); err != nil || !strings.HasPrefix(gotPath, "/mermaid/svg/") {
+		t.Errorf("Kroki应按扩展名识别图表类型，请求 %s, %v", gotPath, err)
+	}
+	if _, err := renderers["kroki"].RenderBytes(context.Background(), []byte("A -> B"), dir, 2, Options{}); err == nil {
+		t.Error("Kroki不能渲染第二页")
+	}
+}
@@ -0,0 +1,107 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheFile 是缓存文件的文件名，保存在输出目录中
+const CacheFile = ".plantumlviewer-cache.json"
+
+// Cache 记录输出目录中每个导出文件是由什么内容生成的，源码和导出设置都没有变化时可以跳过重新渲染。
+// 缓存只比较摘要，调用方需要像Cached.Dependencies那样把引用的图片和!include的文件一起计入摘要，否则它们变化时不会失效。
+// 可以在多个goroutine中同时使用
+type Cache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]string // 上次保存的记录：相对输出目录的导出文件路径 -> 摘要
+	next    map[string]string // 本次确认或生成的记录，保存时只保留这些，删除的源文件随之清除
+}
+
+// LoadCache 读取输出目录中的缓存，不存在或无法解析时返回空的缓存
+func LoadCache(outDir string) *Cache {
+	c := &Cache{path: filepath.Join(outDir, CacheFile), entries: make(map[string]string), next: make(map[string]string)}
+	if data, err := ioutil.ReadFile(c.path); err == nil {
+		if err := json.Unmarshal(data, &c.entries); err != nil {
+			c.entries = make(map[string]string)
+		}
+	}
+	return c
+}
+
+// UpToDate 判断导出文件是否存在且由摘要为digest的内容生成，是最新的时同时记录到本次的缓存中
+func (c *Cache) UpToDate(output, digest string) bool {
+	key := c.key(output)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[key] != digest {
+		return false
+	}
+	if _, err := os.Stat(output); err != nil {
+		return false
+	}
+	c.next[key] = digest
+	return true
+}
+
+// Set 记录导出文件由摘要为digest的内容生成
+func (c *Cache) Set(output, digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next[c.key(output)] = digest
+}
+
+// Forget 删除导出文件的记录，下次UpToDate返回false，用于强制重新渲染
+func (c *Cache) Forget(output string) {
+	key := c.key(output)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	delete(c.next, key)
+}
+
+// Save 将本次确认或生成的记录写入缓存文件
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(c.next, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法序列化缓存: %v", err)
+	}
+	if err := ioutil.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("无法写入缓存: %v", err)
+	}
+	return nil
+}
+
+// key 返回导出文件在缓存中的键，即相对于输出目录的路径
+func (c *Cache) key(output string) string {
+	if rel, err := filepath.Rel(filepath.Dir(c.path), output); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return output
+}
+
+// Digest 返回源码和影响输出的设置（格式、比例、渲染选项等）的摘要，用作Cache中的记录
+func Digest(source []byte, settings ...string) string {
+	h := sha256.New()
+	writePart(h, source)
+	for _, s := range settings {
+		writePart(h, []byte(s))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writePart 写入长度和内容，长度作为分隔，避免不同的组合得到相同的摘要
+func writePart(h hash.Hash, part []byte) {
+	fmt.Fprintf(h, "%d:", len(part))
+	h.Write(part)
+}
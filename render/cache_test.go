@@ -0,0 +1,76 @@
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// touch 创建空文件，需要时创建所在目录
+func touch(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	source := []byte("@startuml\nA -> B\n@enduml\n")
+	digest := Digest(source, "svg", "1")
+	if Digest(source, "svg", "1") != digest {
+		t.Error("相同的内容应得到相同的摘要")
+	}
+	if Digest(source, "png", "1") == digest {
+		t.Error("不同的设置应得到不同的摘要")
+	}
+	if Digest(source, "svg1") == digest {
+		t.Error("设置的分隔不同时摘要应不同")
+	}
+}
+
+func TestCache(t *testing.T) {
+	outDir := t.TempDir()
+	output := filepath.Join(outDir, "sub", "a.svg")
+	touch(t, filepath.Join(outDir, "deleted.svg"))
+	cache := LoadCache(outDir)
+	if cache.UpToDate(output, "d1") {
+		t.Fatal("空的缓存不应认为输出是最新的")
+	}
+	cache.Set(output, "d1")
+	cache.Set(filepath.Join(outDir, "deleted.svg"), "old")
+	if err := cache.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// 缓存中有记录但输出文件不存在时仍需重新生成
+	if LoadCache(outDir).UpToDate(output, "d1") {
+		t.Error("输出文件不存在时不应认为是最新的")
+	}
+	touch(t, output)
+	loaded := LoadCache(outDir)
+	if loaded.UpToDate(output, "d2") {
+		t.Error("摘要变化时不应认为是最新的")
+	}
+	if !loaded.UpToDate(output, "d1") {
+		t.Error("源码和设置都没有变化时应认为是最新的")
+	}
+
+	// 本次没有确认的记录（例如源文件已删除）在保存时清除
+	if err := loaded.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if entries := LoadCache(outDir).entries; len(entries) != 1 || entries["sub/a.svg"] != "d1" {
+		t.Errorf("保存时应只保留本次确认的记录，得到 %v", entries)
+	}
+
+	// 删除记录后即使内容没有变化也需要重新生成
+	loaded = LoadCache(outDir)
+	loaded.Forget(output)
+	if loaded.UpToDate(output, "d1") {
+		t.Error("删除记录后不应认为是最新的")
+	}
+}
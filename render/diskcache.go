@@ -0,0 +1,205 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultCacheDir 返回渲染结果的磁盘缓存默认的目录，即用户缓存目录（Linux上为 ~/.cache）中的plantumlviewer
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("找不到用户缓存目录: %v", err)
+	}
+	return filepath.Join(dir, "plantumlviewer"), nil
+}
+
+// Cached 把Renderer渲染文件的结果按内容保存在磁盘上，文件和渲染选项都没有变化时直接读取，重新打开或重新启动后
+// 也不用再运行PlantUML。缓存以源码、渲染选项、页码、Key和Dependencies返回的文件的内容的摘要为文件名，
+// 内容变化后自然使用新的文件，旧的文件由Prune清理。渲染失败的结果不缓存。
+//
+// 只缓存RenderFile；RenderBytes直接交给Renderer，解密后的图表、编辑器中未保存的内容等不会写入磁盘。
+// 源码或引用的文件中有远程引用或动态内容（见Dynamic）时不使用缓存，ctx由WithoutCache创建时重新渲染并更新缓存
+type Cached struct {
+	Renderer Renderer
+	Dir      string // 缓存目录，为空时不缓存
+
+	// Key 是影响输出但不在渲染选项中的内容，例如渲染器的类型、Kroki的地址和PlantUML的版本，变化后缓存失效
+	Key string
+
+	// Dependencies 返回源码引用的其他本地文件，它们的内容也计入摘要，为nil时使用ImageFiles
+	Dependencies func(source []byte, dir string) []string
+}
+
+// RenderFile 实现Renderer，缓存中有相同内容的结果时直接返回，否则交给Renderer渲染后保存
+func (c Cached) RenderFile(ctx context.Context, filePath string, page int, opts Options) ([]byte, error) {
+	if c.Dir == "" {
+		return c.Renderer.RenderFile(ctx, filePath, page, opts)
+	}
+	path, err := c.path(filePath, page, opts)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return c.Renderer.RenderFile(ctx, filePath, page, opts)
+	}
+	if data, err := ioutil.ReadFile(path); err == nil && len(data) > 0 && !bypassCache(ctx) {
+		// 更新修改时间，Prune按最近使用的时间保留
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return data, nil
+	}
+
+	data, err := c.Renderer.RenderFile(ctx, filePath, page, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.store(path, data)
+	return data, nil
+}
+
+// RenderBytes 实现Renderer，不缓存
+func (c Cached) RenderBytes(ctx context.Context, source []byte, dir string, page int, opts Options) ([]byte, error) {
+	return c.Renderer.RenderBytes(ctx, source, dir, page, opts)
+}
+
+// Formats 实现Renderer
+func (c Cached) Formats() []string {
+	return c.Renderer.Formats()
+}
+
+// path 返回文件按opts渲染第page页的结果在缓存中的路径，以摘要的前两个字符分目录，避免一个目录中的文件过多。
+// 源码或引用的文件是动态的（见Dynamic）时返回空字符串，结果不能缓存
+func (c Cached) path(filePath string, page int, opts Options) (string, error) {
+	source, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	if Dynamic(source) {
+		return "", nil
+	}
+	settings, err := json.Marshal(opts)
+	if err != nil {
+		return "", fmt.Errorf("无法序列化渲染选项: %v", err)
+	}
+	dir := filepath.Dir(filePath)
+	parts := []string{c.Key, string(settings), strconv.Itoa(page), dir}
+	dependencies := c.Dependencies
+	if dependencies == nil {
+		dependencies = ImageFiles
+	}
+	for _, file := range dependencies(source, dir) {
+		// 文件不存在时为空内容的摘要，之后加上文件时缓存也会失效
+		data, _ := ioutil.ReadFile(file)
+		if Dynamic(data) {
+			return "", nil
+		}
+		parts = append(parts, file, Digest(data))
+	}
+	digest := Digest(source, parts...)
+	return filepath.Join(c.Dir, digest[:2], digest+"."+opts.format()), nil
+}
+
+// dynamicPatterns 匹配每次渲染结果可能不同的源码：引用网址的!include和!includeurl，
+// 以及读取当前时间、随机数、环境变量或JSON数据的内置函数
+var dynamicPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?mi)^\s*!include\w*\s+<?https?://`),
+	regexp.MustCompile(`(?mi)^\s*!includeurl\b`),
+	regexp.MustCompile(`(?i)%(?:date|now|load_json|random|getenv)\b`),
+}
+
+// Dynamic 判断源码的渲染结果是否可能在内容不变时变化，例如引用了远程的文件或当前日期，这样的结果不能缓存
+func Dynamic(source []byte) bool {
+	for _, pattern := range dynamicPatterns {
+		if pattern.Match(source) {
+			return true
+		}
+	}
+	return false
+}
+
+// bypassCacheKey 是WithoutCache在ctx中保存的标记
+type bypassCacheKey struct{}
+
+// WithoutCache 返回让Cached忽略已有的缓存、重新渲染并更新缓存的ctx，用于用户要求重新渲染或定时刷新，
+// 图表通过缓存的摘要看不出变化（例如引用的远程内容变了）时也能得到新的结果
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCacheKey{}, true)
+}
+
+// bypassCache 判断ctx是否由WithoutCache创建
+func bypassCache(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassCacheKey{}).(bool)
+	return bypass
+}
+
+// store 先写入临时文件再改名，同时运行的其他实例不会读到写了一半的文件。缓存写不进去时不影响渲染结果
+func (c Cached) store(path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// PruneCache 删除缓存目录dir中最久没有使用的文件，直到总大小不超过maxBytes，返回删除的文件数。
+// 目录不存在时什么也不做
+func PruneCache(dir string, maxBytes int64) (int, error) {
+	type entry struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var entries []entry
+	var total int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			entries = append(entries, entry{path, info.Size(), info.ModTime()})
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("无法读取缓存目录: %v", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+	removed := 0
+	for _, e := range entries {
+		if total <= maxBytes {
+			break
+		}
+		if err := os.Remove(e.path); err != nil {
+			continue
+		}
+		total -= e.size
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,160 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countingRenderer 记录渲染的次数，返回包含次数的结果
+type countingRenderer struct {
+	calls *int
+}
+
+func (r countingRenderer) RenderFile(ctx context.Context, filePath string, page int, opts Options) ([]byte, error) {
+	*r.calls++
+	return []byte(fmt.Sprintf("image-%d", *r.calls)), nil
+}
+
+func (r countingRenderer) RenderBytes(ctx context.Context, source []byte, dir string, page int, opts Options) ([]byte, error) {
+	*r.calls++
+	return []byte(fmt.Sprintf("image-%d", *r.calls)), nil
+}
+
+func (countingRenderer) Formats() []string {
+	return PlantUMLFormats
+}
+
+func TestCached(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.puml")
+	logo := filepath.Join(dir, "logo.png")
+	writeFile := func(path, content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(path, "@startuml\nA -> B : <img:logo.png>\n@enduml\n")
+	writeFile(logo, "v1")
+
+	calls := 0
+	cached := Cached{Renderer: countingRenderer{&calls}, Dir: filepath.Join(dir, "cache"), Key: "jar"}
+	render := func(c Cached, opts Options) string {
+		t.Helper()
+		data, err := c.RenderFile(context.Background(), path, 1, opts)
+		if err != nil {
+			t.Fatalf("RenderFile: %v", err)
+		}
+		return string(data)
+	}
+
+	if got := render(cached, Options{}); got != "image-1" {
+		t.Fatalf("第一次渲染得到 %q", got)
+	}
+	// 重新启动后的新实例也能读到缓存
+	if got := render(Cached{Renderer: countingRenderer{&calls}, Dir: cached.Dir, Key: "jar"}, Options{}); got != "image-1" || calls != 1 {
+		t.Errorf("内容没有变化时应使用缓存，得到 %q（渲染%d次）", got, calls)
+	}
+
+	changes := []struct {
+		name  string
+		apply func() (Cached, Options)
+	}{
+		{"渲染选项", func() (Cached, Options) { return cached, Options{Theme: "plain"} }},
+		{"Key", func() (Cached, Options) {
+			other := cached
+			other.Key = "kroki"
+			return other, Options{}
+		}},
+		{"引用的图片", func() (Cached, Options) { writeFile(logo, "v2"); return cached, Options{} }},
+		{"源码", func() (Cached, Options) { writeFile(path, "@startuml\nA -> C\n@enduml\n"); return cached, Options{} }},
+	}
+	for _, change := range changes {
+		before := calls
+		c, opts := change.apply()
+		render(c, opts)
+		if calls != before+1 {
+			t.Errorf("%s变化后应重新渲染", change.name)
+		}
+	}
+
+	if _, err := cached.RenderBytes(context.Background(), []byte("A -> B"), dir, 1, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.RenderBytes(context.Background(), []byte("A -> B"), dir, 1, Options{}); err != nil || calls != len(changes)+3 {
+		t.Errorf("RenderBytes不应缓存，渲染了%d次", calls)
+	}
+}
+
+func TestCachedDynamic(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	cached := Cached{Renderer: countingRenderer{&calls}, Dir: filepath.Join(dir, "cache"), Key: "jar"}
+	render := func(ctx context.Context, path string) string {
+		t.Helper()
+		data, err := cached.RenderFile(ctx, path, 1, Options{})
+		if err != nil {
+			t.Fatalf("RenderFile: %v", err)
+		}
+		return string(data)
+	}
+
+	// 引用远程文件或当前日期的图表每次都重新渲染
+	for i, source := range []string{
+		"@startuml\n!include https://example.com/common.puml\nA -> B\n@enduml\n",
+		"@startuml\n!includeurl https://example.com/common.puml\n@enduml\n",
+		"@startuml\ntitle Generated %date(\"yyyy-MM-dd\")\n@enduml\n",
+		"@startuml\n!$data = %load_json(\"data.json\")\n@enduml\n",
+	} {
+		path := filepath.Join(dir, fmt.Sprintf("dynamic-%d.puml", i))
+		if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if first, second := render(context.Background(), path), render(context.Background(), path); first == second {
+			t.Errorf("%q 不应缓存，两次都得到 %q", source, first)
+		}
+	}
+
+	// WithoutCache 重新渲染并更新缓存
+	path := filepath.Join(dir, "static.puml")
+	if err := ioutil.WriteFile(path, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	render(context.Background(), path)
+	fresh := render(WithoutCache(context.Background()), path)
+	if got := render(context.Background(), path); got != fresh {
+		t.Errorf("WithoutCache应重新渲染并更新缓存，之后得到 %q，应为 %q", got, fresh)
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	for i, name := range []string{"ab/old.png", "cd/new.png", "ab/newer.png"} {
+		path := filepath.Join(dir, name)
+		touch(t, path)
+		if err := ioutil.WriteFile(path, make([]byte, 10), 0644); err != nil {
+			t.Fatal(err)
+		}
+		used := old.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := PruneCache(dir, 25)
+	if err != nil || removed != 1 {
+		t.Fatalf("PruneCache = %d, %v，应删除1个文件", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ab", "old.png")); !os.IsNotExist(err) {
+		t.Error("应先删除最久没有使用的文件")
+	}
+	if removed, err := PruneCache(filepath.Join(dir, "missing"), 0); err != nil || removed != 0 {
+		t.Errorf("目录不存在时应什么也不做，得到 %d, %v", removed, err)
+	}
+}
@@ -0,0 +1,12 @@
+// Package render 调用本地的PlantUML（plantuml.jar或plantuml命令行工具）渲染图表，
+// 是PlantUML Viewer使用的渲染层：查找plantuml.jar、按选项渲染文件或源码、解析错误行号，
+// 找出图表引用的本地图片，按内容摘要跳过没有变化的导出的缓存和保存渲染结果的磁盘缓存，保持常驻的 plantuml -pipe 进程的进程池，
+// 以及不需要本地工具、通过Kroki服务渲染的客户端。
+//
+// 这个包是单独的Go模块，不依赖界面，静态站点生成器、CI检查等其他Go工具可以直接引入：
+//
+//	go get github.com/huangyingw/plantumlmacviewer_go/render
+//
+// 版本按语义化版本以 render/vX.Y.Z 的标签发布，v1之前的次版本号变化可能包含不兼容的修改。
+// 导出的名称就是全部的公开接口，查看器内部的改动不会影响它们。
+package render
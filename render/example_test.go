@@ -0,0 +1,79 @@
+package render_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/huangyingw/plantumlmacviewer_go/render"
+)
+
+// 把图表以2倍分辨率渲染为PNG，多页图表得到多个文件
+func ExampleRenderFile() {
+	outDir, err := ioutil.TempDir("", "diagrams")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	pages, err := render.RenderFile("docs/login.puml", outDir, render.Options{DPI: 2 * render.DefaultDPI, Theme: "plain"})
+	if err != nil {
+		// 语法错误时可以取得出错的行号
+		log.Fatalf("第%d行: %v", render.ErrorLine(err), err)
+	}
+	fmt.Println(len(pages), "页")
+}
+
+// 直接渲染内存中的源码，例如静态站点生成器从Markdown中取出的代码块
+func ExampleRenderSource() {
+	source := []byte("@startuml\nAlice -> Bob: hello\n@enduml\n")
+	svg, err := render.RenderSource(source, ".", 1, render.Options{Format: "svg", Security: "SANDBOX"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(len(svg) > 0)
+}
+
+// 批量导出时跳过源码和设置都没有变化的文件
+func ExampleCache() {
+	outDir := "site/diagrams"
+	cache := render.LoadCache(outDir)
+	for _, file := range []string{"docs/login.puml", "docs/order.puml"} {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		digest := render.Digest(source, "svg")
+		output := filepath.Join(outDir, filepath.Base(file)+".svg")
+		if cache.UpToDate(output, digest) {
+			continue
+		}
+		if _, err := render.RenderFile(file, outDir, render.Options{Format: "svg"}); err != nil {
+			log.Fatal(err)
+		}
+		cache.Set(output, digest)
+	}
+	if err := cache.Save(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// 按配置选择渲染方式，之后的代码不用关心PlantUML怎样运行
+func ExampleRenderer() {
+	var r render.Renderer = render.Local{}
+	if url := os.Getenv("KROKI_URL"); url != "" {
+		r = render.Kroki{URL: url}
+	} else if os.Getenv("PLANTUML_PIPE") != "" {
+		pool := render.NewPool(2, 0)
+		defer pool.Close()
+		r = pool
+	}
+	svg, err := r.RenderFile(context.Background(), "docs/login.puml", 1, render.Options{Format: "svg"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(len(svg) > 0, r.Formats())
+}
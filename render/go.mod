@@ -0,0 +1,3 @@
+module github.com/huangyingw/plantumlmacviewer_go/render
+
+go 1.21
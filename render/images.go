@@ -0,0 +1,42 @@
+package render
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// imagePattern 匹配Creole中的图片 <img:路径> 和 <img 路径>，路径后面可以有 {scale=0.5} 等参数
+var imagePattern = regexp.MustCompile(`<img[:\s]\s*([^>{]+?)\s*(?:\{[^}]*\})?>`)
+
+// spritePattern 匹配从图片文件定义的sprite，例如 sprite $logo images/logo.png
+var spritePattern = regexp.MustCompile(`(?mi)^\s*sprite\s+\$?\w+\s+([^\s\[{<]+\.(?:png|jpe?g|gif|svg))\s*$`)
+
+// ImageFiles 返回源码引用的本地图片文件（<img:...> 和从文件定义的sprite）的绝对路径，按出现的顺序，不重复。
+// 相对路径相对于dir（图表所在的目录）；网址和内嵌的data:图片不是本地文件，不包括在内。图片文件不存在时也返回，
+// 调用方可以在它出现后刷新
+func ImageFiles(source []byte, dir string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(ref string) {
+		ref = strings.Trim(strings.TrimSpace(ref), `"`)
+		if ref == "" || strings.Contains(ref, "://") || strings.HasPrefix(ref, "data:") {
+			return
+		}
+		if !filepath.IsAbs(ref) {
+			ref = filepath.Join(dir, ref)
+		}
+		ref = filepath.Clean(ref)
+		if !seen[ref] {
+			seen[ref] = true
+			files = append(files, ref)
+		}
+	}
+	for _, m := range imagePattern.FindAllSubmatch(source, -1) {
+		add(string(m[1]))
+	}
+	for _, m := range spritePattern.FindAllSubmatch(source, -1) {
+		add(string(m[1]))
+	}
+	return files
+}
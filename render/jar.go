@@ -0,0 +1,173 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FindJar 查找本地的plantuml.jar，找不到时返回空字符串
+func FindJar() string {
+	// 查找可能的plantuml.jar路径
+	jarPaths := []string{
+		"/usr/local/bin/plantuml.jar",
+		"/usr/local/Cellar/plantuml/*/libexec/plantuml.jar", // 根据实际情况找到的Homebrew安装路径
+		"/usr/local/Cellar/plantuml/*/plantuml.jar",         // homebrew安装路径
+		"/opt/plantuml/plantuml.jar",
+		"/usr/share/plantuml/plantuml.jar",
+		"/Applications/plantuml.jar",
+		filepath.Join(os.Getenv("HOME"), "plantuml.jar"),
+		filepath.Join(os.Getenv("HOME"), "bin/plantuml.jar"),
+		filepath.Join(os.Getenv("HOME"), ".plantuml/plantuml.jar"),
+		filepath.Join(os.Getenv("HOME"), "/Downloads/plantuml.jar"),
+	}
+
+	// 寻找最新版本的 PlantUML JAR 包
+	for _, path := range jarPaths {
+		// 支持glob模式匹配
+		if strings.Contains(path, "*") {
+			matches, err := filepath.Glob(path)
+			if err != nil || len(matches) == 0 {
+				continue
+			}
+			// 按修改时间排序，取最新的
+			var latestJar string
+			var latestTime time.Time
+			for _, match := range matches {
+				info, err := os.Stat(match)
+				if err == nil {
+					if latestJar == "" || info.ModTime().After(latestTime) {
+						latestJar = match
+						latestTime = info.ModTime()
+					}
+				}
+			}
+			if latestJar != "" {
+				log.Printf("找到最新的 PlantUML JAR 包: %s", latestJar)
+				return latestJar
+			}
+		} else if _, err := os.Stat(path); err == nil {
+			log.Printf("找到 PlantUML JAR 包: %s", path)
+			return path
+		}
+	}
+	return ""
+}
+
+// Command 创建以args为参数执行PlantUML的命令，优先使用plantuml.jar，找不到时使用plantuml命令行工具
+func Command(args ...string) (*exec.Cmd, error) {
+	return CommandContext(context.Background(), args...)
+}
+
+// WaitDelay 是命令被取消后等待它的输出关闭的最长时间，避免没有结束的子进程一直占用输出
+const WaitDelay = 2 * time.Second
+
+// Backend 是渲染使用的PlantUML
+type Backend string
+
+const (
+	BackendJar     Backend = "jar"     // 用java运行FindJar找到的plantuml.jar
+	BackendCommand Backend = "command" // PATH中的plantuml命令行工具，例如Homebrew安装的
+)
+
+// Backends 是Command可以使用的PlantUML，按顺序使用第一个找到的，默认优先使用plantuml.jar。
+// 调用方可以替换它，例如按管理员的设置只允许使用其中一种
+var Backends = []Backend{BackendJar, BackendCommand}
+
+// CommandContext 与Command相同，但命令在自己的进程组中运行，ctx结束时结束整个进程组，
+// 不会留下plantuml命令行工具启动的java进程
+func CommandContext(ctx context.Context, args ...string) (*exec.Cmd, error) {
+	return commandContext(ctx, "", args)
+}
+
+// commandContext 与CommandContext相同，backend不为空时只使用这个PlantUML
+func commandContext(ctx context.Context, backend Backend, args []string) (*exec.Cmd, error) {
+	argv, err := commandLine(backend, args)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("执行命令: %s", strings.Join(argv, " "))
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return KillProcessGroup(cmd.Process.Pid)
+	}
+	cmd.WaitDelay = WaitDelay
+	return cmd, nil
+}
+
+// commandLine 返回以args为参数执行PlantUML的完整命令行，第一项为程序名，按Backends的顺序使用第一个找到的PlantUML。
+// only不为空时只使用这个PlantUML，它不在Backends中（例如管理员不允许使用）时返回错误
+func commandLine(only Backend, args []string) ([]string, error) {
+	backends := Backends
+	if only != "" {
+		if !allowed(only) {
+			return nil, fmt.Errorf("不允许使用 PlantUML %s（可以使用: %v）", only, Backends)
+		}
+		backends = []Backend{only}
+	}
+	for _, backend := range backends {
+		switch backend {
+		case BackendJar:
+			if jarPath := FindJar(); jarPath != "" {
+				return append([]string{"java", "-jar", jarPath}, args...), nil
+			}
+		case BackendCommand:
+			if _, err := exec.LookPath("plantuml"); err == nil {
+				return append([]string{"plantuml"}, args...), nil
+			}
+		}
+	}
+	// 调用方限制了可以使用的PlantUML时说明原因
+	if len(backends) < 2 {
+		return nil, fmt.Errorf("找不到允许使用的 PlantUML（%v），请确保已安装 PlantUML", backends)
+	}
+	return nil, fmt.Errorf("找不到 plantuml.jar 或命令行工具，请确保已安装 PlantUML")
+}
+
+// allowed 判断backend是否在Backends中
+func allowed(backend Backend) bool {
+	for _, b := range Backends {
+		if b == backend {
+			return true
+		}
+	}
+	return false
+}
+
+// RunCommand 执行Command创建的命令并等待结束，默认为(*exec.Cmd).Run。所有渲染都经过它，
+// 调用方可以替换它，例如记录启动的进程，以便程序异常退出后清理
+var RunCommand = func(cmd *exec.Cmd) error {
+	return cmd.Run()
+}
+
+// versionPattern 匹配 "plantuml -version" 输出中的版本号，例如 "PlantUML version 1.2023.10 (...)"
+var versionPattern = regexp.MustCompile(`(?i)plantuml version ([0-9][0-9A-Za-z.\-]*)`)
+
+// Version 返回本机PlantUML的版本号，例如 "1.2023.10"
+func Version() (string, error) {
+	cmd, err := Command("-version")
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	err = RunCommand(cmd)
+	output := buf.Bytes()
+	if err != nil {
+		return "", fmt.Errorf("无法获取 PlantUML 版本: %v, %s", err, output)
+	}
+	match := versionPattern.FindSubmatch(output)
+	if match == nil {
+		return "", fmt.Errorf("无法识别 PlantUML 版本: %s", strings.TrimSpace(string(output)))
+	}
+	return string(match[1]), nil
+}
@@ -0,0 +1,197 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultKrokiURL 是公共的Kroki服务，团队可以部署自己的Kroki避免把图表发送到外部
+const DefaultKrokiURL = "https://kroki.io"
+
+// krokiMaxGetLength 是用GET请求时编码后的源码最大的长度，更长的源码改为POST，避免超出服务器和代理对URL长度的限制
+const krokiMaxGetLength = 4096
+
+// krokiMaxResponse 是Kroki响应最大的字节数，防止异常的服务器返回无限的数据
+const krokiMaxResponse = 64 << 20
+
+// KrokiTypes 是按扩展名识别的Kroki图表类型，不在其中的扩展名当作PlantUML
+var KrokiTypes = map[string]string{
+	".puml":        "plantuml",
+	".plantuml":    "plantuml",
+	".pu":          "plantuml",
+	".iuml":        "plantuml",
+	".mmd":         "mermaid",
+	".mermaid":     "mermaid",
+	".dot":         "graphviz",
+	".gv":          "graphviz",
+	".d2":          "d2",
+	".ditaa":       "ditaa",
+	".erd":         "erd",
+	".nomnoml":     "nomnoml",
+	".bob":         "svgbob",
+	".svgbob":      "svgbob",
+	".bpmn":        "bpmn",
+	".dbml":        "dbml",
+	".pikchr":      "pikchr",
+	".wavedrom":    "wavedrom",
+	".structurizr": "structurizr",
+	".excalidraw":  "excalidraw",
+	".vega":        "vega",
+	".vl":          "vegalite",
+	".blockdiag":   "blockdiag",
+	".seqdiag":     "seqdiag",
+	".actdiag":     "actdiag",
+	".nwdiag":      "nwdiag",
+	".packetdiag":  "packetdiag",
+	".rackdiag":    "rackdiag",
+	".tikz":        "tikz",
+	".bytefield":   "bytefield",
+	".umlet":       "umlet",
+}
+
+// KrokiType 返回文件按扩展名对应的Kroki图表类型，不认识的扩展名返回plantuml
+func KrokiType(path string) string {
+	if t, ok := KrokiTypes[strings.ToLower(filepath.Ext(path))]; ok {
+		return t
+	}
+	return "plantuml"
+}
+
+// KrokiEncode 按Kroki的GET地址格式编码源码：以deflate（zlib格式）压缩后再做URL安全的base64编码
+func KrokiEncode(source []byte) string {
+	var buf bytes.Buffer
+	w, _ := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	w.Write(source)
+	w.Close()
+	return base64.URLEncoding.EncodeToString(buf.Bytes())
+}
+
+// krokiLinePattern 匹配Kroki在PlantUML错误信息中给出的行号，例如 "Syntax Error? (line: 5)"
+var krokiLinePattern = regexp.MustCompile(`\(line: (\d+)\)`)
+
+// Kroki 通过Kroki服务（https://kroki.io 或自己部署的服务）渲染图表，不需要本地安装Java、PlantUML和Graphviz，
+// 还可以渲染Mermaid、Graphviz等Kroki支持的其他图表。源码发送到服务渲染，!include引用的本地文件服务读取不到
+type Kroki struct {
+	URL    string       // 服务地址，为空时为DefaultKrokiURL
+	Client *http.Client // 为nil时使用http.DefaultClient
+}
+
+// Render 把diagramType类型（见KrokiTypes）的源码渲染为format格式（png或svg）。PlantUML图表按opts在源码开头加上
+// 主题、预处理变量和skinparam，其他类型的图表忽略opts。服务返回错误时返回*Error，其中包含服务的错误信息
+func (k Kroki) Render(ctx context.Context, diagramType string, source []byte, opts Options) ([]byte, error) {
+	if diagramType == "" {
+		diagramType = "plantuml"
+	}
+	if diagramType == "plantuml" {
+		source = injectPreamble(source, opts.preamble())
+	}
+	base := strings.TrimRight(k.URL, "/")
+	if base == "" {
+		base = DefaultKrokiURL
+	}
+	url := fmt.Sprintf("%s/%s/%s", base, diagramType, opts.format())
+
+	var req *http.Request
+	var err error
+	if encoded := KrokiEncode(source); len(encoded) <= krokiMaxGetLength {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, url+"/"+encoded, nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(source))
+		if req != nil {
+			req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Kroki服务地址无效: %v", err)
+	}
+
+	client := k.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, &Error{Err: ctxErr}
+		}
+		return nil, &Error{Err: fmt.Errorf("无法连接Kroki服务: %v", err)}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, krokiMaxResponse))
+	if err != nil {
+		return nil, &Error{Err: fmt.Errorf("无法读取Kroki的响应: %v", err)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		output := strings.TrimSpace(string(body))
+		renderErr := &Error{Output: output, Err: fmt.Errorf("Kroki返回 %s", resp.Status)}
+		if m := krokiLinePattern.FindStringSubmatch(output); m != nil {
+			renderErr.Line, _ = strconv.Atoi(m[1])
+		}
+		return nil, renderErr
+	}
+	if len(body) == 0 {
+		return nil, fmt.Errorf("Kroki没有返回图像")
+	}
+	return body, nil
+}
+
+// preamble 返回把选项写在PlantUML源码开头的等价指令，用于不能传命令行参数的Kroki。
+// 只转换主题、预处理变量、分辨率和 -S 形式的skinparam，其他命令行参数忽略
+func (o Options) preamble() []string {
+	var lines []string
+	if o.Theme != "" {
+		lines = append(lines, "!theme "+o.Theme)
+	}
+	names := make([]string, 0, len(o.Defines))
+	for name := range o.Defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("!define %s %s", name, o.Defines[name]))
+	}
+	if o.DPI > 0 {
+		lines = append(lines, fmt.Sprintf("skinparam dpi %d", int(math.Round(o.DPI))))
+	}
+	for _, arg := range o.Args {
+		if param := strings.TrimPrefix(arg, "-S"); param != arg {
+			if name, value, ok := strings.Cut(param, "="); ok {
+				lines = append(lines, fmt.Sprintf("skinparam %s %s", name, value))
+			}
+		}
+	}
+	return lines
+}
+
+// injectPreamble 把lines插入到源码中第一个@start行之后，没有@start行时放在开头
+func injectPreamble(source []byte, lines []string) []byte {
+	if len(lines) == 0 {
+		return source
+	}
+	preamble := strings.Join(lines, "\n") + "\n"
+	text := string(source)
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), "@start") {
+			if !strings.HasSuffix(line, "\n") {
+				return []byte(text + "\n" + preamble)
+			}
+			offset += len(line)
+			return []byte(text[:offset] + preamble + text[offset:])
+		}
+		offset += len(line)
+	}
+	return []byte(preamble + text)
+}
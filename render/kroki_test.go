@@ -0,0 +1,90 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestKrokiEncode(t *testing.T) {
+	source := "@startuml\nA -> B : 登录\n@enduml\n"
+	data, err := base64.URLEncoding.DecodeString(KrokiEncode([]byte(source)))
+	if err != nil {
+		t.Fatalf("应为URL安全的base64: %v", err)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("应为zlib格式: %v", err)
+	}
+	decoded, _ := ioutil.ReadAll(r)
+	if string(decoded) != source {
+		t.Errorf("解码得到 %q，应为 %q", decoded, source)
+	}
+	if KrokiType("docs/flow.MMD") != "mermaid" || KrokiType("a.gv") != "graphviz" || KrokiType("a.txt") != "plantuml" {
+		t.Error("按扩展名识别的图表类型不正确")
+	}
+}
+
+func TestKrokiRender(t *testing.T) {
+	var gotPath, gotMethod, gotSource string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotMethod = r.URL.Path, r.Method
+		if r.Method == http.MethodPost {
+			body, _ := ioutil.ReadAll(r.Body)
+			gotSource = string(body)
+		} else {
+			parts := strings.Split(r.URL.Path, "/")
+			data, _ := base64.URLEncoding.DecodeString(parts[len(parts)-1])
+			zr, _ := zlib.NewReader(bytes.NewReader(data))
+			body, _ := ioutil.ReadAll(zr)
+			gotSource = string(body)
+		}
+		if strings.Contains(gotSource, "syntax error") {
+			http.Error(w, "Error 400: Syntax Error? (Assumed diagram type: sequence) (line: 2)", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+	k := Kroki{URL: server.URL + "/"}
+
+	opts := Options{Theme: "plain", Defines: map[string]string{"DETAIL": "true"}, Args: []string{"-SShadowing=false", "-nometadata"}}
+	data, err := k.Render(context.Background(), "plantuml", []byte("@startuml\nA -> B\n@enduml\n"), opts)
+	if err != nil || string(data) != "image" {
+		t.Fatalf("Render = %q, %v", data, err)
+	}
+	if gotMethod != http.MethodGet || !strings.HasPrefix(gotPath, "/plantuml/png/") {
+		t.Errorf("应以GET请求 /plantuml/png/，得到 %s %s", gotMethod, gotPath)
+	}
+	want := "@startuml\n!theme plain\n!define DETAIL true\nskinparam Shadowing false\nA -> B\n@enduml\n"
+	if gotSource != want {
+		t.Errorf("PlantUML源码应加上选项，得到 %q", gotSource)
+	}
+
+	// 其他类型的图表不加选项，过长的源码改为POST
+	var edges strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&edges, "n%d -- n%d; ", i*7919%2003, i*104729%2011)
+	}
+	long := "graph { " + edges.String() + "}"
+	if _, err := k.Render(context.Background(), "graphviz", []byte(long), Options{Format: "svg", Theme: "plain"}); err != nil {
+		t.Fatal(err)
+	}
+	if gotMethod != http.MethodPost || gotPath != "/graphviz/svg" || gotSource != long {
+		t.Errorf("过长的源码应以POST发送原文，得到 %s %s", gotMethod, gotPath)
+	}
+
+	_, err = k.Render(context.Background(), "plantuml", []byte("@startuml\nsyntax error\n@enduml\n"), Options{})
+	var renderErr *Error
+	if !errors.As(err, &renderErr) || renderErr.Line != 2 || !strings.Contains(renderErr.Output, "Syntax Error") {
+		t.Errorf("服务返回的错误应包含信息和行号，得到 %v", err)
+	}
+}
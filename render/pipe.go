@@ -0,0 +1,377 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPipeIdleTimeout 是常驻的PlantUML进程默认的空闲时间，超过后结束进程，释放Java虚拟机占用的内存
+const DefaultPipeIdleTimeout = 5 * time.Minute
+
+// pipeDelimiter 是常驻进程在每张图像之后输出的分隔行（-pipedelimitor），不会出现在PNG和SVG中
+const pipeDelimiter = "--plantumlviewer-pipe-end--"
+
+// Pool 保持常驻的 plantuml -pipe 进程，通过标准输入逐个渲染源码，省去每次启动Java虚拟机的一两秒。
+// 进程按工作目录和渲染选项分组，每组最多同时运行size个进程，空闲超过idleTimeout的进程自动结束。
+// 进程通过RunCommand运行，可以在多个goroutine中同时使用
+type Pool struct {
+	size        int
+	idleTimeout time.Duration
+
+	mu     sync.Mutex
+	groups map[string]*pipeGroup // 工作目录和命令行参数 -> 这组进程
+	closed bool
+	stop   chan struct{} // Close时关闭，结束清理空闲进程的goroutine
+}
+
+// pipeGroup 是使用同样的工作目录和选项的一组进程
+type pipeGroup struct {
+	slots chan struct{} // 容量为Pool的size，正在渲染的进程各占一个
+	idle  []*pipeProc   // 空闲的进程，最近用过的在最后
+}
+
+// NewPool 创建进程池，size不大于0时为1，idleTimeout不大于0时为DefaultPipeIdleTimeout。用完后需要调用Close
+func NewPool(size int, idleTimeout time.Duration) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultPipeIdleTimeout
+	}
+	p := &Pool{size: size, idleTimeout: idleTimeout, groups: make(map[string]*pipeGroup), stop: make(chan struct{})}
+	go p.reap()
+	return p
+}
+
+// RenderSource 与RenderSourceContext相同，但由常驻的进程渲染。源码中没有@startuml等开始标记时自动加上。
+// ctx结束时结束正在渲染的进程，之后的渲染启动新的进程
+func (p *Pool) RenderSource(ctx context.Context, source []byte, dir string, page int, opts Options) ([]byte, error) {
+	if page < 1 {
+		page = 1
+	}
+	args := opts.commandArgs("-pipe", "-pipeimageindex", strconv.Itoa(page-1), "-pipedelimitor", pipeDelimiter)
+	env := opts.env()
+	key := strings.Join(append(append([]string{dir, string(opts.Backend)}, args...), env...), "\x00")
+
+	g, err := p.group(key)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case g.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, &Error{Err: ctx.Err()}
+	}
+	defer func() { <-g.slots }()
+
+	proc, err := p.take(g, dir, opts.Backend, args, env)
+	if err != nil {
+		return nil, err
+	}
+	data, err := proc.render(ctx, source)
+	if proc.broken {
+		proc.kill()
+	} else {
+		p.put(g, proc)
+	}
+	return data, err
+}
+
+// Close 结束所有空闲的进程，正在渲染的进程在渲染完成后结束。之后的渲染返回错误
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	for _, g := range p.groups {
+		for _, proc := range g.idle {
+			proc.kill()
+		}
+		g.idle = nil
+	}
+}
+
+// group 返回key对应的一组进程，没有时创建
+func (p *Pool) group(key string) (*pipeGroup, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, fmt.Errorf("PlantUML进程池已经关闭")
+	}
+	g := p.groups[key]
+	if g == nil {
+		g = &pipeGroup{slots: make(chan struct{}, p.size)}
+		p.groups[key] = g
+	}
+	return g, nil
+}
+
+// take 取出最近用过的空闲进程，没有时启动新的进程
+func (p *Pool) take(g *pipeGroup, dir string, backend Backend, args, env []string) (*pipeProc, error) {
+	p.mu.Lock()
+	if n := len(g.idle); n > 0 {
+		proc := g.idle[n-1]
+		g.idle = g.idle[:n-1]
+		p.mu.Unlock()
+		return proc, nil
+	}
+	p.mu.Unlock()
+	return startPipe(dir, backend, args, env)
+}
+
+// put 把渲染完的进程放回空闲列表，进程池已经关闭时结束进程
+func (p *Pool) put(g *pipeGroup, proc *pipeProc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		proc.kill()
+		return
+	}
+	proc.lastUsed = time.Now()
+	g.idle = append(g.idle, proc)
+}
+
+// reap 定期结束空闲超过idleTimeout的进程，直到Close
+func (p *Pool) reap() {
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.reapIdle(time.Now().Add(-p.idleTimeout))
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// reapIdle 结束在before之前最后一次使用的空闲进程
+func (p *Pool) reapIdle(before time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, g := range p.groups {
+		kept := g.idle[:0]
+		for _, proc := range g.idle {
+			if proc.lastUsed.Before(before) {
+				log.Printf("结束空闲的PlantUML常驻进程")
+				proc.kill()
+			} else {
+				kept = append(kept, proc)
+			}
+		}
+		g.idle = kept
+		if len(g.idle) == 0 && len(g.slots) == 0 {
+			delete(p.groups, key)
+		}
+	}
+}
+
+// pipeProc 是一个常驻的 plantuml -pipe 进程。标准错误与标准输出写入同一个管道，
+// 错误信息按写入的顺序出现在图像之后、分隔行之前
+type pipeProc struct {
+	cancel   context.CancelFunc
+	stdin    *os.File      // 写入源码
+	out      *os.File      // 读取图像、错误信息和分隔行
+	done     chan struct{} // 进程结束后关闭
+	exitErr  error         // 进程结束的原因，done关闭后才能读取
+	pending  []byte        // 已经读到但还没有用到的输出
+	lastUsed time.Time
+	broken   bool // 渲染出错后输出可能没有读完，不能再使用
+}
+
+// startPipe 在dir中以args启动常驻的PlantUML进程，backend不为空时只使用这个PlantUML
+func startPipe(dir string, backend Backend, args, env []string) (*pipeProc, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd, err := commandContext(ctx, backend, args)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Dir = dir
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("无法创建管道: %v", err)
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		cancel()
+		inR.Close()
+		inW.Close()
+		return nil, fmt.Errorf("无法创建管道: %v", err)
+	}
+	cmd.Stdin = inR
+	cmd.Stdout = outW
+	cmd.Stderr = outW
+
+	proc := &pipeProc{cancel: cancel, stdin: inW, out: outR, done: make(chan struct{})}
+	go func() {
+		proc.exitErr = RunCommand(cmd)
+		// 关闭子进程一端后，读取输出时得到EOF
+		inR.Close()
+		outW.Close()
+		close(proc.done)
+	}()
+	return proc, nil
+}
+
+// render 把源码写入进程，读取第一张图表的图像。源码中有多张图表时PlantUML为每张图表输出一张图像，其余的读出后丢弃
+func (proc *pipeProc) render(ctx context.Context, source []byte) ([]byte, error) {
+	source, blocks := pipeSource(source)
+	type result struct {
+		data   []byte
+		err    error
+		broken bool
+	}
+	results := make(chan result, 1)
+	go func() {
+		data, broken, err := proc.exchange(source, blocks)
+		results <- result{data, err, broken}
+	}()
+	select {
+	case r := <-results:
+		proc.broken = r.broken
+		return r.data, r.err
+	case <-ctx.Done():
+		// 结束进程后exchange读到EOF返回
+		proc.broken = true
+		return nil, &Error{Err: ctx.Err()}
+	}
+}
+
+// exchange 写入源码并读取blocks张图表的输出，返回第一张图像。broken表示没有读完输出，进程不能再使用
+func (proc *pipeProc) exchange(source []byte, blocks int) (data []byte, broken bool, err error) {
+	if _, err := proc.stdin.Write(source); err != nil {
+		return nil, true, fmt.Errorf("无法把源码写入PlantUML常驻进程: %v", err)
+	}
+	var image []byte
+	var firstErr error
+	for i := 0; i < blocks; i++ {
+		block, err := proc.readBlock()
+		if err != nil {
+			return nil, true, err
+		}
+		data, err := parsePipeOutput(block)
+		if i == 0 {
+			image = data
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, false, firstErr
+	}
+	return image, false, nil
+}
+
+// readBlock 读取到下一个分隔行为止的输出，不包括分隔行
+func (proc *pipeProc) readBlock() ([]byte, error) {
+	delim := []byte(pipeDelimiter)
+	buf := make([]byte, 64<<10)
+	searched := 0 // pending中这个位置之前不会有分隔行的开头
+	for {
+		if i := bytes.Index(proc.pending[searched:], delim); i >= 0 {
+			i += searched
+			block := proc.pending[:i]
+			proc.pending = append([]byte(nil), proc.pending[i+len(delim):]...)
+			return block, nil
+		}
+		if n := len(proc.pending) - len(delim); n > searched {
+			searched = n
+		}
+		n, err := proc.out.Read(buf)
+		proc.pending = append(proc.pending, buf[:n]...)
+		if err != nil {
+			<-proc.done
+			if proc.exitErr != nil {
+				return nil, fmt.Errorf("PlantUML常驻进程已经结束: %v", proc.exitErr)
+			}
+			return nil, fmt.Errorf("PlantUML常驻进程意外退出")
+		}
+	}
+}
+
+// kill 结束进程组，可以多次调用
+func (proc *pipeProc) kill() {
+	proc.cancel()
+	proc.stdin.Close()
+	go func() {
+		<-proc.done
+		proc.out.Close()
+	}()
+}
+
+// pipeSource 返回写入进程的源码和其中的图表数。没有开始标记时加上@startuml和@enduml，末尾没有换行时加上换行，
+// 否则PlantUML会一直等待结束标记
+func pipeSource(source []byte) ([]byte, int) {
+	blocks := 0
+	for _, line := range strings.Split(string(source), "\n") {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), "@start") {
+			blocks++
+		}
+	}
+	if blocks == 0 {
+		return []byte("@startuml\n" + strings.TrimRight(string(source), "\n") + "\n@enduml\n"), 1
+	}
+	if !bytes.HasSuffix(source, []byte("\n")) {
+		source = append(append([]byte(nil), source...), '\n')
+	}
+	return source, blocks
+}
+
+// parsePipeOutput 把一张图表的输出分为图像和前后的文字（Java的提示、PlantUML的错误信息），
+// 错误信息以ERROR开头时返回包含出错行号的Error
+func parsePipeOutput(block []byte) ([]byte, error) {
+	// 上一个分隔行后面的换行
+	block = bytes.TrimLeft(block, "\r\n")
+	start, end := imageBounds(block)
+	text := stripJavaNotice(string(block[:start]) + string(block[end:]))
+	if output := strings.TrimSpace(text); strings.HasPrefix(output, "ERROR") {
+		return nil, newError(fmt.Errorf("图表有错误"), output)
+	} else if output != "" {
+		log.Printf("PlantUML常驻进程的输出: %s", output)
+	}
+	if start == end {
+		return nil, fmt.Errorf("PlantUML没有输出图像")
+	}
+	return block[start:end], nil
+}
+
+// imageBounds 返回输出中PNG或SVG图像的开始和结束位置，找不到时把ERROR之前的全部内容视为图像
+func imageBounds(block []byte) (int, int) {
+	if start := bytes.Index(block, []byte("\x89PNG")); start >= 0 {
+		if end := bytes.LastIndex(block, []byte("IEND")); end > start {
+			// IEND之后是4个字节的CRC
+			return start, min(end+8, len(block))
+		}
+		return start, len(block)
+	}
+	if start := bytes.Index(block, []byte("<?xml")); start >= 0 || bytes.Contains(block, []byte("<svg")) {
+		if start < 0 {
+			start = bytes.Index(block, []byte("<svg"))
+		}
+		if end := bytes.LastIndex(block, []byte("</svg>")); end > start {
+			return start, end + len("</svg>")
+		}
+		return start, len(block)
+	}
+	if i := bytes.Index(block, []byte("ERROR")); i >= 0 {
+		return 0, i
+	}
+	return 0, len(block)
+}
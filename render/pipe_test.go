@@ -0,0 +1,142 @@
+//go:build !windows
+
+package render
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePipe 在PATH中放一个假的plantuml命令：每读到一个@enduml输出一张包含进程ID和图表序号的SVG，
+// 图表中有error时在标准错误输出PlantUML格式的错误信息，然后输出分隔行
+const fakePipe = `#!/bin/sh
+delim=""
+prev=""
+for arg in "$@"; do
+	if [ "$prev" = "-pipedelimitor" ]; then delim="$arg"; fi
+	prev="$arg"
+done
+n=0
+bad=0
+while IFS= read -r line; do
+	case "$line" in
+	*error*) bad=1 ;;
+	@end*)
+		n=$((n+1))
+		printf '<svg>%s-%s</svg>' "$$" "$n"
+		if [ "$bad" = 1 ]; then printf 'ERROR\n2\nSyntax Error?\n' >&2; fi
+		bad=0
+		echo "$delim"
+		;;
+	esac
+done
+`
+
+func setupFakePipe(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	if FindJar() != "" {
+		t.Skip("本机安装了plantuml.jar，无法使用假的plantuml命令")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "plantuml"), []byte(fakePipe), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestPoolReusesProcess(t *testing.T) {
+	dir := setupFakePipe(t)
+	pool := NewPool(1, time.Minute)
+	defer pool.Close()
+
+	first, err := pool.RenderSource(context.Background(), []byte("@startuml\nA -> B\n@enduml\n"), dir, 1, Options{Format: "svg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有开始标记的源码自动加上，多张图表只返回第一张
+	second, err := pool.RenderSource(context.Background(), []byte("@startuml\nA\n@enduml\n@startuml\nB\n@enduml"), dir, 1, Options{Format: "svg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := strings.SplitN(strings.TrimPrefix(string(first), "<svg>"), "-", 2)[0]
+	if string(first) != "<svg>"+pid+"-1</svg>" || string(second) != "<svg>"+pid+"-2</svg>" {
+		t.Fatalf("两次渲染应由同一个进程完成，得到 %q 和 %q", first, second)
+	}
+	third, err := pool.RenderSource(context.Background(), []byte("C -> D"), dir, 1, Options{Format: "svg"})
+	if err != nil || string(third) != "<svg>"+pid+"-4</svg>" {
+		t.Fatalf("多余的图像应被读出丢弃，得到 %q, %v", third, err)
+	}
+}
+
+func TestPoolReportsErrors(t *testing.T) {
+	dir := setupFakePipe(t)
+	pool := NewPool(1, time.Minute)
+	defer pool.Close()
+
+	_, err := pool.RenderSource(context.Background(), []byte("@startuml\nerror\n@enduml\n"), dir, 1, Options{Format: "svg"})
+	if ErrorLine(err) != 2 {
+		t.Fatalf("应返回包含出错行号的Error，得到 %v", err)
+	}
+	// 出错后进程仍然可以使用
+	if data, err := pool.RenderSource(context.Background(), []byte("@startuml\nA\n@enduml\n"), dir, 1, Options{Format: "svg"}); err != nil || !strings.HasSuffix(string(data), "-2</svg>") {
+		t.Fatalf("出错后应继续使用同一个进程，得到 %q, %v", data, err)
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	dir := setupFakePipe(t)
+	pool := NewPool(1, time.Minute)
+	defer pool.Close()
+
+	// 没有结束标记，假的plantuml一直等待
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := pool.RenderSource(ctx, []byte("@startuml\nA\n"), dir, 1, Options{Format: "svg"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("超时后应返回包含ctx错误的Error，得到 %v", err)
+	}
+	data, err := pool.RenderSource(context.Background(), []byte("@startuml\nA\n@enduml\n"), dir, 1, Options{Format: "svg"})
+	if err != nil || !strings.HasSuffix(string(data), "-1</svg>") {
+		t.Fatalf("超时的进程应被结束，之后启动新的进程，得到 %q, %v", data, err)
+	}
+}
+
+func TestPoolReapsIdleProcesses(t *testing.T) {
+	dir := setupFakePipe(t)
+	pool := NewPool(1, time.Minute)
+	defer pool.Close()
+
+	first, err := pool.RenderSource(context.Background(), []byte("A"), dir, 1, Options{Format: "svg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.reapIdle(time.Now().Add(time.Second))
+	second, err := pool.RenderSource(context.Background(), []byte("A"), dir, 1, Options{Format: "svg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first) == string(second) {
+		t.Fatalf("空闲的进程结束后应启动新的进程，两次都得到 %q", first)
+	}
+}
+
+func TestParsePipeOutput(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nDATAIEND\xaeB`\x82")
+	data, err := parsePipeOutput(append([]byte("\nPicked up JAVA_TOOL_OPTIONS: -Dx=1\n"), png...))
+	if err != nil || string(data) != string(png) {
+		t.Fatalf("应去掉图像前面的Java提示，得到 %q, %v", data, err)
+	}
+	if _, err := parsePipeOutput(append(png, "ERROR\n7\nSyntax Error?\n"...)); ErrorLine(err) != 7 {
+		t.Fatalf("图像后面的错误信息应解析出行号，得到 %v", err)
+	}
+	if _, err := parsePipeOutput([]byte("\n")); err == nil {
+		t.Fatal("没有图像时应返回错误")
+	}
+}
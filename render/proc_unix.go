@@ -0,0 +1,21 @@
+//go:build !windows
+
+package render
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 让命令在自己的进程组中运行，plantuml命令行工具启动的java等子进程也在同一个组中
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// KillProcessGroup 结束以pid为组长的整个进程组，包括PlantUML启动的子进程
+func KillProcessGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
@@ -0,0 +1,65 @@
+//go:build !windows
+
+package render
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRenderSourceContextKillsProcessGroup(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	if FindJar() != "" {
+		t.Skip("本机安装了plantuml.jar，无法使用假的plantuml命令")
+	}
+	// 假的plantuml命令启动一个子进程后一直等待，模拟卡住的PlantUML
+	pidFile := filepath.Join(dir, "child.pid")
+	script := "#!/bin/sh\nsleep 30 &\necho $! > " + pidFile + "\nwait\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "plantuml"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := RenderSourceContext(ctx, []byte("@startuml\nA -> B\n@enduml\n"), dir, 1, Options{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("超时后应返回包含ctx错误的Error，得到 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > WaitDelay+time.Second {
+		t.Errorf("超时后应立即结束，用了 %v", elapsed)
+	}
+
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	deadline := time.Now().Add(2 * time.Second)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			t.Fatal("PlantUML启动的子进程应随进程组一起结束")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// processAlive 判断进程是否还在运行，已经结束但没有被回收的进程视为已结束
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	state, err := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+	return err == nil && !strings.HasPrefix(strings.TrimSpace(string(state)), "Z")
+}
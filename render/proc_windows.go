@@ -0,0 +1,18 @@
+package render
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup 在Windows上不做任何事
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// KillProcessGroup 在Windows上只结束进程pid本身
+func KillProcessGroup(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
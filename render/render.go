@@ -0,0 +1,347 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultDPI 是PlantUML渲染位图的默认分辨率
+const DefaultDPI = 96
+
+// Options 是渲染选项，零值表示以PlantUML的默认设置渲染PNG
+type Options struct {
+	Format   string            // 输出格式（png、svg等），为空时为png
+	DPI      float64           // 位图的分辨率，为0时使用PlantUML的默认值
+	Theme    string            // 使用的主题，相当于在图表开头加上 !theme
+	Defines  map[string]string // 预处理变量，相当于 -D名称=值
+	Security string            // PlantUML的安全配置（PLANTUML_SECURITY_PROFILE），例如SANDBOX，为空时使用PlantUML的默认值
+	Charset  string            // 源文件的字符编码（Java的字符集名称，例如GBK），相当于 -charset，为空时使用PlantUML的默认值
+	Args     []string          // 其他命令行参数
+	Backend  Backend           // 使用的PlantUML，为空时按Backends的顺序使用第一个找到的；不在Backends中时不能渲染
+
+	// JavaOptions 是传给Java虚拟机的选项，例如 -Dfile.encoding=UTF-8，通过JAVA_TOOL_OPTIONS环境变量传递，
+	// 使用plantuml命令行工具时也有效。选项中不能有空格
+	JavaOptions []string
+}
+
+// format 返回输出格式，没有设置时为png
+func (o Options) format() string {
+	if o.Format == "" {
+		return "png"
+	}
+	return o.Format
+}
+
+// args 返回选项对应的命令行参数，不包括输出格式
+func (o Options) args() []string {
+	var args []string
+	if o.DPI > 0 {
+		args = append(args, fmt.Sprintf("-Sdpi=%d", int(math.Round(o.DPI))))
+	}
+	if o.Theme != "" {
+		args = append(args, "-theme", o.Theme)
+	}
+	if o.Charset != "" {
+		args = append(args, "-charset", o.Charset)
+	}
+	names := make([]string, 0, len(o.Defines))
+	for name := range o.Defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "-D"+name+"="+o.Defines[name])
+	}
+	return append(args, o.Args...)
+}
+
+// env 返回需要追加的环境变量。JAVA_TOOL_OPTIONS保留环境中原有的选项，追加后与原有的同名变量重复时以追加的为准
+func (o Options) env() []string {
+	var env []string
+	if o.Security != "" {
+		env = append(env, "PLANTUML_SECURITY_PROFILE="+strings.ToUpper(o.Security))
+	}
+	if len(o.JavaOptions) > 0 {
+		options := strings.Join(o.JavaOptions, " ")
+		if existing := os.Getenv("JAVA_TOOL_OPTIONS"); existing != "" {
+			options = existing + " " + options
+		}
+		env = append(env, "JAVA_TOOL_OPTIONS="+options)
+	}
+	return env
+}
+
+// javaNoticePattern 匹配设置了JAVA_TOOL_OPTIONS等环境变量时Java在错误输出开头打印的提示
+var javaNoticePattern = regexp.MustCompile(`(?m)^(Picked up|NOTE: Picked up) \S*JAVA\S*OPTIONS:.*\r?\n`)
+
+// stripJavaNotice 去掉错误输出中Java的提示，只留下PlantUML的输出
+func stripJavaNotice(output string) string {
+	return javaNoticePattern.ReplaceAllString(output, "")
+}
+
+// commandArgs 返回按选项执行PlantUML的完整参数：输出格式、选项对应的参数，最后是args
+func (o Options) commandArgs(args ...string) []string {
+	return append(append([]string{"-t" + o.format()}, o.args()...), args...)
+}
+
+// RenderFile 将PlantUML文件渲染到outDir，返回按页码排序的输出文件路径。包含newpage的多页图表会得到多个文件
+func RenderFile(filePath, outDir string, opts Options) ([]string, error) {
+	return RenderFileContext(context.Background(), filePath, outDir, opts)
+}
+
+// RenderFileContext 与RenderFile相同，ctx结束（例如超时）时结束PlantUML进程并返回包含ctx错误的Error
+func RenderFileContext(ctx context.Context, filePath, outDir string, opts Options) ([]string, error) {
+	cmd, err := commandContext(ctx, opts.Backend, opts.commandArgs("-o", outDir, filePath))
+	if err != nil {
+		return nil, err
+	}
+	if env := opts.env(); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := RunCommand(cmd); err != nil {
+		log.Printf("执行失败，stderr: %s, stdout: %s", stderr.String(), stdout.String())
+		return nil, runError(ctx, err, stripJavaNotice(stderr.String()))
+	}
+
+	log.Printf("命令执行成功，查找生成的%s文件", opts.format())
+
+	files, err := filepath.Glob(filepath.Join(outDir, "*."+opts.format()))
+	if err != nil || len(files) == 0 {
+		return nil, fmt.Errorf("无法找到生成的图像文件")
+	}
+	sortPages(files)
+	return files, nil
+}
+
+// CommandLine 返回按选项渲染filePath的等价shell命令，可以粘贴到终端或CI中重现问题。
+// 安全配置和Java选项以环境变量的形式放在命令前面；没有指定输出目录，PlantUML把图像写到文件所在的目录
+func CommandLine(filePath string, opts Options) (string, error) {
+	argv, err := commandLine(opts.Backend, opts.commandArgs(filePath))
+	if err != nil {
+		return "", err
+	}
+	var words []string
+	if opts.Security != "" {
+		words = append(words, "PLANTUML_SECURITY_PROFILE="+shellQuote(strings.ToUpper(opts.Security)))
+	}
+	if len(opts.JavaOptions) > 0 {
+		words = append(words, "JAVA_TOOL_OPTIONS="+shellQuote(strings.Join(opts.JavaOptions, " ")))
+	}
+	for _, arg := range argv {
+		words = append(words, shellQuote(arg))
+	}
+	return strings.Join(words, " "), nil
+}
+
+// shellSafe 匹配在shell中不需要引号的参数
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote 在需要时用单引号括起参数，参数中的单引号先结束引号，再写为转义的单引号
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// MakeTempDir 在系统临时目录中创建名称以prefix开头的临时目录，默认为ioutil.TempDir。渲染和导出的临时目录都经过它，
+// 用完后用RemoveTempDir删除。调用方可以同时替换两者，例如记录创建的目录，以便程序异常退出后只清理自己创建的目录
+var MakeTempDir = func(prefix string) (string, error) {
+	return ioutil.TempDir("", prefix)
+}
+
+// RemoveTempDir 删除MakeTempDir创建的临时目录，默认为os.RemoveAll
+var RemoveTempDir = os.RemoveAll
+
+// RenderPage 渲染PlantUML文件的第page页（从1开始）并返回图像内容，页码超出图表的页数时返回错误
+func RenderPage(filePath string, page int, opts Options) ([]byte, error) {
+	return RenderPageContext(context.Background(), filePath, page, opts)
+}
+
+// RenderPageContext 与RenderPage相同，ctx结束时结束PlantUML进程
+func RenderPageContext(ctx context.Context, filePath string, page int, opts Options) ([]byte, error) {
+	// 创建临时目录用于存放生成的图像
+	tempDir, err := MakeTempDir("plantuml")
+	if err != nil {
+		return nil, fmt.Errorf("无法创建临时目录: %v", err)
+	}
+	defer RemoveTempDir(tempDir) // 函数返回时删除临时目录
+
+	pages, err := RenderFileContext(ctx, filePath, tempDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if page < 1 || page > len(pages) {
+		return nil, fmt.Errorf("图表只有%d页，无法显示第%d页", len(pages), page)
+	}
+
+	// 读取生成的图像
+	data, err := ioutil.ReadFile(pages[page-1])
+	if err != nil {
+		return nil, fmt.Errorf("无法读取生成的图像: %v", err)
+	}
+	return data, nil
+}
+
+// CheckFile 只检查PlantUML文件的语法，不生成图像，比渲染快得多，适合提交前的检查。
+// 有错误时返回包含出错行号的Error
+func CheckFile(filePath string, opts Options) error {
+	return CheckFileContext(context.Background(), filePath, opts)
+}
+
+// CheckFileContext 与CheckFile相同，ctx结束时结束PlantUML进程
+func CheckFileContext(ctx context.Context, filePath string, opts Options) error {
+	cmd, err := commandContext(ctx, opts.Backend, opts.commandArgs("-checkonly", filePath))
+	if err != nil {
+		return err
+	}
+	if env := opts.env(); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := RunCommand(cmd); err != nil {
+		// 不同版本的PlantUML把语法错误输出到标准错误或标准输出
+		output := stripJavaNotice(stderr.String())
+		if strings.TrimSpace(output) == "" {
+			output = stdout.String()
+		}
+		return runError(ctx, err, output)
+	}
+	return nil
+}
+
+// RenderSource 通过标准输入把源码交给PlantUML，返回第page页（从1开始）的图像，不需要写入文件。
+// 源码中的相对路径（如!include）相对于dir解析
+func RenderSource(source []byte, dir string, page int, opts Options) ([]byte, error) {
+	return RenderSourceContext(context.Background(), source, dir, page, opts)
+}
+
+// RenderSourceContext 与RenderSource相同，ctx结束时结束PlantUML进程
+func RenderSourceContext(ctx context.Context, source []byte, dir string, page int, opts Options) ([]byte, error) {
+	if page < 1 {
+		page = 1
+	}
+	cmd, err := commandContext(ctx, opts.Backend, opts.commandArgs("-pipe", "-pipeimageindex", strconv.Itoa(page-1)))
+	if err != nil {
+		return nil, err
+	}
+	if env := opts.env(); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(source)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// 出错时PlantUML仍会输出一张错误图像，以错误输出判断是否成功
+	err = RunCommand(cmd)
+	output := stripJavaNotice(stderr.String())
+	if err != nil || strings.HasPrefix(output, "ERROR") {
+		log.Printf("执行失败，stderr: %s", stderr.String())
+		if err == nil {
+			err = fmt.Errorf("图表有错误")
+		}
+		return nil, runError(ctx, err, output)
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("PlantUML没有输出图像")
+	}
+	return stdout.Bytes(), nil
+}
+
+// Error 是PlantUML执行失败时的错误，包含从错误输出中解析出的出错行号
+type Error struct {
+	Line   int    // 出错的行号（从1开始），无法确定时为0
+	Output string // PlantUML的错误输出
+	Err    error  // 执行命令返回的错误
+}
+
+// Unwrap 返回执行命令返回的错误，渲染因ctx结束而被终止时为ctx的错误
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("执行 plantuml 失败（第%d行）: %v, %s", e.Line, e.Err, e.Output)
+	}
+	return fmt.Sprintf("执行 plantuml 失败: %v, %s", e.Err, e.Output)
+}
+
+// errorLinePattern 匹配PlantUML错误输出中的行号，例如 "Error line 5 in file: a.puml"，
+// 或从标准输入渲染时第一行为ERROR、第二行为行号的输出
+var errorLinePattern = regexp.MustCompile(`(?i)error line (\d+)|^ERROR\r?\n(\d+)`)
+
+// newError 根据命令错误和错误输出创建Error
+func newError(err error, output string) *Error {
+	renderErr := &Error{Output: strings.TrimSpace(output), Err: err}
+	if m := errorLinePattern.FindStringSubmatch(output); m != nil {
+		renderErr.Line, _ = strconv.Atoi(m[1] + m[2])
+	}
+	return renderErr
+}
+
+// runError 返回执行命令失败时的错误。命令因ctx结束被终止时，返回的Error包含ctx的错误而不是进程的退出状态
+func runError(ctx context.Context, err error, output string) *Error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return &Error{Output: strings.TrimSpace(output), Err: ctxErr}
+	}
+	return newError(err, output)
+}
+
+// ErrorLine 返回渲染错误对应的行号，不是Error或无法确定时返回0
+func ErrorLine(err error) int {
+	var renderErr *Error
+	if errors.As(err, &renderErr) {
+		return renderErr.Line
+	}
+	return 0
+}
+
+// sortPages 按页码排序输出文件。PlantUML把第一页命名为name.png，
+// 后续页命名为name_001.png、name_002.png……
+func sortPages(files []string) {
+	sort.Slice(files, func(i, j int) bool {
+		bi, pi := pageKey(files[i])
+		bj, pj := pageKey(files[j])
+		if bi != bj {
+			return bi < bj
+		}
+		return pi < pj
+	})
+}
+
+// pageKey 返回输出文件的基本名和页码，第一页的页码为0
+func pageKey(file string) (string, int) {
+	name := filepath.Base(file)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if i := strings.LastIndex(name, "_"); i >= 0 {
+		var page int
+		if _, err := fmt.Sscanf(name[i+1:], "%d", &page); err == nil && len(name[i+1:]) == 3 {
+			return name[:i], page
+		}
+	}
+	return name, 0
+}
@@ -0,0 +1,124 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOptionsArgs(t *testing.T) {
+	opts := Options{Format: "svg", DPI: 191.6, Theme: "plain", Defines: map[string]string{"ENV": "prod", "A": "1"}, Security: "sandbox", Charset: "GBK", Args: []string{"-nometadata"}}
+	got := opts.commandArgs("-o", "/out", "a.puml")
+	want := []string{"-tsvg", "-Sdpi=192", "-theme", "plain", "-charset", "GBK", "-DA=1", "-DENV=prod", "-nometadata", "-o", "/out", "a.puml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("commandArgs = %v，应为 %v", got, want)
+	}
+	if env := opts.env(); !reflect.DeepEqual(env, []string{"PLANTUML_SECURITY_PROFILE=SANDBOX"}) {
+		t.Errorf("env = %v", env)
+	}
+
+	if got := (Options{}).commandArgs("a.puml"); !reflect.DeepEqual(got, []string{"-tpng", "a.puml"}) {
+		t.Errorf("零值选项应只指定PNG格式，得到 %v", got)
+	}
+	if env := (Options{}).env(); env != nil {
+		t.Errorf("没有安全配置时不应追加环境变量，得到 %v", env)
+	}
+}
+
+func TestJavaOptions(t *testing.T) {
+	t.Setenv("JAVA_TOOL_OPTIONS", "-Xmx512m")
+	env := Options{JavaOptions: []string{"-Dfile.encoding=UTF-8"}}.env()
+	if !reflect.DeepEqual(env, []string{"JAVA_TOOL_OPTIONS=-Xmx512m -Dfile.encoding=UTF-8"}) {
+		t.Errorf("应在环境中原有的Java选项后追加，得到 %v", env)
+	}
+
+	output := "Picked up JAVA_TOOL_OPTIONS: -Dfile.encoding=UTF-8\nERROR\n3\nSyntax Error?"
+	if got := stripJavaNotice(output); got != "ERROR\n3\nSyntax Error?" {
+		t.Errorf("stripJavaNotice = %q", got)
+	}
+	if line := newError(errors.New("exit status 200"), stripJavaNotice(output)).Line; line != 3 {
+		t.Errorf("去掉Java的提示后应能解析出错行号，得到 %d", line)
+	}
+}
+
+func TestCommandRespectsBackends(t *testing.T) {
+	defer func(saved []Backend) { Backends = saved }(Backends)
+	Backends = nil
+	if _, err := Command("-version"); err == nil || !strings.Contains(err.Error(), "允许使用") {
+		t.Errorf("不允许使用任何PlantUML时应返回错误，得到 %v", err)
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	defer func(saved []Backend) { Backends = saved }(Backends)
+	Backends = []Backend{BackendCommand}
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "plantuml"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	opts := Options{Security: "sandbox", Defines: map[string]string{"TITLE": "Login flow"}, JavaOptions: []string{"-Dfile.encoding=UTF-8", "-Dplantuml.include.path=/shared"}}
+	got, err := CommandLine("/docs/it's.puml", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `PLANTUML_SECURITY_PROFILE=SANDBOX JAVA_TOOL_OPTIONS='-Dfile.encoding=UTF-8 -Dplantuml.include.path=/shared' plantuml -tpng '-DTITLE=Login flow' '/docs/it'\''s.puml'`
+	if got != want {
+		t.Errorf("CommandLine =\n%s\n应为\n%s", got, want)
+	}
+}
+
+func TestErrorLine(t *testing.T) {
+	tests := []struct {
+		output string
+		want   int
+	}{
+		{"Error line 5 in file: a.puml\nSyntax Error?", 5},
+		{"ERROR\n12\nSyntax Error?", 12},
+		{"java.lang.OutOfMemoryError", 0},
+	}
+	for _, tt := range tests {
+		err := fmt.Errorf("渲染失败: %w", newError(errors.New("exit status 200"), tt.output))
+		if got := ErrorLine(err); got != tt.want {
+			t.Errorf("ErrorLine(%q) = %d，应为 %d", tt.output, got, tt.want)
+		}
+	}
+	if ErrorLine(errors.New("其他错误")) != 0 {
+		t.Error("不是渲染错误时应返回0")
+	}
+}
+
+func TestSortPages(t *testing.T) {
+	files := []string{"/t/a_002.png", "/t/a.png", "/t/a_010.png", "/t/a_001.png"}
+	sortPages(files)
+	want := []string{"/t/a.png", "/t/a_001.png", "/t/a_002.png", "/t/a_010.png"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("sortPages = %v，应为 %v", files, want)
+	}
+}
+
+func TestImageFiles(t *testing.T) {
+	source := []byte(`@startuml
+sprite $logo icons/logo.png
+sprite $inline [16x16/16] {
+FFFF
+}
+Alice -> Bob : <img:icons/user.png> hello <img /opt/art/db.svg{scale=0.5}>
+Bob -> Carol : <img:http://example.com/a.png> <img:icons/user.png>
+note right : <img "data:image/png;base64,AAAA">
+@enduml
+`)
+	got := ImageFiles(source, "/docs")
+	want := []string{"/docs/icons/user.png", "/opt/art/db.svg", "/docs/icons/logo.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ImageFiles = %v，应为 %v", got, want)
+	}
+	if got := ImageFiles([]byte("@startuml\nA -> B\n@enduml\n"), "/docs"); got != nil {
+		t.Errorf("没有图片时应返回nil，得到 %v", got)
+	}
+}
@@ -24,7 +24,7 @@ fi
 
 # 编译应用
 echo "${GREEN}正在编译 $APP_NAME...${NC}"
-go build -o "$BIN_DIR/$APP_NAME" .
+go build -o "$BIN_DIR/$APP_NAME" ./cmd/plantumlviewer
 
 # 检查编译是否成功
 if [ $? -ne 0 ]; then
@@ -1,7 +1,7 @@
 #!/bin/zsh
 
 # 编译并运行程序，打开测试目录中的文件
-go build -o bin/plantumlviewer main.go
+go build -o bin/plantumlviewer ./cmd/plantumlviewer
 ./bin/plantumlviewer testdata/*
 
 echo "已启动程序并打开测试文件夹中的所有puml文件"
@@ -0,0 +1,95 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/outline"
+	"plantumlmacviewer/plantuml"
+)
+
+// Description 返回当前标签的文字描述，作为图表图像的替代文本提供给读屏软件：
+// 由图表的title和caption组成，没有时为标签标题；渲染出错时为错误信息
+func (ui *MainUI) Description() string {
+	t := ui.selectedTab()
+	if t == nil {
+		return "未加载文件"
+	}
+	name := displayTitle(t)
+	if err := t.viewer.RenderError(); err != nil {
+		return renderFailureText(name, err)
+	}
+	// 快照的图像与文件不一定一致，只使用标签标题
+	if t.snapshot {
+		return name
+	}
+	return outline.Description(tabSource(t), name)
+}
+
+// renderFailureText 返回读出渲染错误时的文字，只包含错误信息的第一行
+func renderFailureText(name string, err error) string {
+	message := err.Error()
+	if i := strings.IndexByte(message, '\n'); i >= 0 {
+		message = message[:i]
+	}
+	if line := plantuml.ErrorLine(err); line > 0 {
+		return fmt.Sprintf("%s渲染出错，第%d行: %s", name, line, message)
+	}
+	return fmt.Sprintf("%s渲染出错: %s", name, message)
+}
+
+// SetOnDescriptionChanged 设置当前标签的文字描述变化时的回调，用于更新窗口内容的辅助功能标签
+func (ui *MainUI) SetOnDescriptionChanged(callback func(label string)) {
+	ui.onDescriptionChanged = callback
+}
+
+// SetOnAnnounce 设置需要让读屏软件读出消息时的回调，例如切换标签和当前标签渲染出错
+func (ui *MainUI) SetOnAnnounce(callback func(message string)) {
+	ui.onAnnounce = callback
+}
+
+// updateDescription 当前标签的文字描述变化时通知回调
+func (ui *MainUI) updateDescription() {
+	description := ui.Description()
+	if description == ui.description {
+		return
+	}
+	ui.description = description
+	if ui.onDescriptionChanged != nil {
+		ui.onDescriptionChanged(description)
+	}
+}
+
+// announce 让读屏软件读出消息
+func (ui *MainUI) announce(message string) {
+	if ui.onAnnounce != nil {
+		ui.onAnnounce(message)
+	}
+}
+
+// announceSelection 切换标签后读出新标签的描述，键盘切换标签时可以知道当前显示的是哪个图表
+func (ui *MainUI) announceSelection() {
+	if ui.selectedTab() != nil {
+		ui.announce(ui.Description())
+	}
+}
+
+// trackAnnouncements 当前标签渲染出错时读出错误，之后渲染成功时读出已恢复。
+// 后台标签的变化只体现在窗口标题的状态中，不打断用户
+func (ui *MainUI) trackAnnouncements() {
+	ui.events.Subscribe(func(e event.Event) {
+		t := ui.selectedTab()
+		if t == nil || t.path != e.Path {
+			return
+		}
+		switch {
+		case e.Type == event.RenderFailed:
+			ui.announcedFailure = e.Path
+			ui.announce(renderFailureText(displayTitle(t), e.Err))
+		case ui.announcedFailure == e.Path:
+			ui.announcedFailure = ""
+			ui.announce(displayTitle(t) + "已恢复正常")
+		}
+	}, event.RenderFinished, event.RenderFailed)
+}
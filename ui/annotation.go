@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/plantuml"
+)
+
+// SetAnnotationTool 设置所有标签使用的标注工具，AnnotationOff表示退出标注模式
+func (ui *MainUI) SetAnnotationTool(tool plantuml.AnnotationTool) {
+	ui.annotationTool = tool
+	for _, t := range ui.ordered() {
+		t.viewer.SetAnnotationTool(tool)
+	}
+}
+
+// AnnotationTool 返回当前的标注工具
+func (ui *MainUI) AnnotationTool() plantuml.AnnotationTool {
+	return ui.annotationTool
+}
+
+// UndoAnnotation 撤销当前标签的最后一条标注
+func (ui *MainUI) UndoAnnotation() {
+	if viewer := ui.selectedViewer(); viewer != nil {
+		viewer.UndoAnnotation()
+	}
+}
+
+// ClearAnnotations 删除当前标签的全部标注
+func (ui *MainUI) ClearAnnotations() {
+	viewer := ui.selectedViewer()
+	if viewer == nil {
+		return
+	}
+	dialog.ShowConfirm("清除标注", "确定要删除当前图表的全部标注吗？", func(ok bool) {
+		if ok {
+			viewer.ClearAnnotations()
+		}
+	}, ui.window)
+}
+
+// ExportAnnotatedPNG 将当前标签的图像连同标注导出为PNG文件
+func (ui *MainUI) ExportAnnotatedPNG() {
+	t := ui.selectedTab()
+	if t == nil {
+		return
+	}
+	filePath, viewer := t.path, t.viewer
+
+	save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		if writer == nil {
+			return // 用户取消
+		}
+		defer writer.Close()
+
+		if err := viewer.ExportAnnotatedPNG(writer); err != nil {
+			dialog.ShowError(fmt.Errorf("导出失败: %v", err), ui.window)
+			return
+		}
+		log.Printf("已导出带标注的图像: %s", logging.Path(writer.URI().Path()))
+	}, ui.window)
+
+	base := filepath.Base(filePath)
+	save.SetFileName(strings.TrimSuffix(base, filepath.Ext(base)) + "-annotated.png")
+	save.Show()
+}
+
+// SetMeasureDPI 设置测量工具所用的DPI并应用到所有标签
+func (ui *MainUI) SetMeasureDPI(dpi float64) {
+	ui.settings.MeasureDPI = dpi
+	for _, t := range ui.ordered() {
+		t.viewer.SetMeasureDPI(dpi)
+	}
+}
+
+// showMeasurement 在窗口标题中显示测量结果
+func (ui *MainUI) showMeasurement(text string) {
+	ui.window.SetTitle(fmt.Sprintf("PlantUML Viewer - 测量: %s", text))
+}
+
+// requestNoteText 弹出输入框让用户输入文字说明
+func (ui *MainUI) requestNoteText(done func(text string)) {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("说明文字")
+	dialog.ShowForm("添加文字说明", "添加", "取消", []*widget.FormItem{
+		widget.NewFormItem("文字", entry),
+	}, func(ok bool) {
+		if ok {
+			done(strings.TrimSpace(entry.Text))
+		}
+	}, ui.window)
+	ui.window.Canvas().Focus(entry)
+}
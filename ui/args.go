@@ -0,0 +1,66 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/plantuml"
+)
+
+// EditCurrentArgs 弹出对话框，为当前标签的文件指定额外的PlantUML参数（以空格分隔，例如 -Playout=smetana -darkmode），
+// 只允许config.ValidateArgs接受的参数。用于试用查看器还没有专门支持的PlantUML新参数，设置保存到工作区状态，
+// 下次打开同一文件时恢复，只影响查看；草稿、虚拟文件和快照标签没有对应的文件，不能设置
+func (ui *MainUI) EditCurrentArgs() {
+	t := ui.selectedTab()
+	if t == nil || t.snapshot || t.scratch != nil || t.virtual {
+		return
+	}
+
+	entry := widget.NewEntry()
+	entry.SetText(strings.Join(ui.session.FileArgs(t.path), " "))
+	entry.SetPlaceHolder("-Playout=smetana -darkmode")
+	hint := widget.NewLabel(fmt.Sprintf("可以使用 -P名称=值、-S名称=值、-D名称=值 和 %s，留空取消", strings.Join(config.AllowedFlags, " ")))
+	hint.Wrapping = fyne.TextWrapWord
+	dialog.ShowForm("额外的PlantUML参数", "确定", "取消", []*widget.FormItem{
+		widget.NewFormItem("参数", entry),
+		widget.NewFormItem("", hint),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		args := strings.Fields(entry.Text)
+		if err := config.ValidateArgs(args); err != nil {
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		ui.setFileArgs(t, args)
+	}, ui.window)
+	ui.window.Canvas().Focus(entry)
+}
+
+// setFileArgs 为标签的文件指定额外的PlantUML参数，保存设置并重新渲染
+func (ui *MainUI) setFileArgs(t *tab, args []string) {
+	plantuml.SetFileArgs(t.path, args)
+	log.Printf("%s 的额外PlantUML参数设置为 %q", logging.Path(t.path), args)
+	if err := ui.session.SetFileArgs(t.path, args); err != nil {
+		log.Printf("无法保存额外参数设置: %v", err)
+	}
+	ui.replaceViewer(t, t.path)
+}
+
+// restoreFileArgs 恢复上次为文件指定的额外参数，工作区状态中的参数不再被允许时忽略
+func (ui *MainUI) restoreFileArgs(filePath string) {
+	args := ui.session.FileArgs(filePath)
+	if err := config.ValidateArgs(args); err != nil {
+		log.Printf("忽略 %s 的额外参数: %v", logging.Path(filePath), err)
+		args = nil
+	}
+	plantuml.SetFileArgs(filePath, args)
+}
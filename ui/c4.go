@@ -0,0 +1,84 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/c4"
+	"plantumlmacviewer/internal/logging"
+)
+
+// c4Levels 返回C4图表所在的层级和各层级的配套文件。文件没有引入C4-PlantUML的层级库时，
+// 按配套文件的命名约定确定层级；都无法确定时返回false
+func c4Levels(path string) (c4.Level, map[c4.Level]string, bool) {
+	companions := c4.Companions(path)
+	if level, ok := c4.DetectFile(path); ok {
+		return level, companions, true
+	}
+	for level, companion := range companions {
+		if companion == path {
+			return level, companions, true
+		}
+	}
+	return 0, nil, false
+}
+
+// c4Bar 为C4图表创建层级切换栏，点击其他层级打开对应的配套文件，没有配套文件的层级不可点击。
+// 不是C4图表或标签不对应固定的文件（快照、草稿、跟随、虚拟文件标签）时返回nil
+func (ui *MainUI) c4Bar(t *tab) fyne.CanvasObject {
+	if t.snapshot || t.scratch != nil || t.follow != nil || t.virtual {
+		return nil
+	}
+	current, companions, ok := c4Levels(t.path)
+	if !ok {
+		return nil
+	}
+
+	bar := container.NewHBox(widget.NewLabel("C4层级"))
+	for _, level := range c4.Levels {
+		level := level
+		button := widget.NewButton(level.Label(), func() {
+			if err := ui.SwitchC4Level(level); err != nil {
+				dialog.ShowError(err, ui.window)
+			}
+		})
+		switch {
+		case level == current:
+			button.Importance = widget.HighImportance
+		case companions[level] == "":
+			button.Disable()
+		}
+		bar.Add(button)
+	}
+	return bar
+}
+
+// SwitchC4Level 打开当前C4图表在level层级的配套文件，已经打开时切换到对应的标签。
+// 只在无法切换时返回错误，配套文件的渲染错误显示在它的标签中
+func (ui *MainUI) SwitchC4Level(level c4.Level) error {
+	t := ui.selectedTab()
+	if t == nil || t.snapshot || t.scratch != nil || t.follow != nil || t.virtual {
+		return nil
+	}
+	current, companions, ok := c4Levels(t.path)
+	if !ok {
+		return fmt.Errorf("当前图表不是C4图表")
+	}
+	if level == current {
+		return nil
+	}
+	path := companions[level]
+	if path == "" {
+		return fmt.Errorf("没有找到%s层级的配套文件，配套文件应与当前文件放在同一目录，只有层级后缀不同，例如 billing-%s.puml",
+			level.Label(), level)
+	}
+	if err := ui.OpenFile(path); err != nil {
+		log.Printf("打开%s层级的配套文件 %s 时出错: %v", level.Label(), logging.Path(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package ui
+
+import (
+	"log"
+
+	"plantumlmacviewer/internal/charset"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/plantuml"
+)
+
+// CharsetLabel 返回字符编码在菜单中显示的名称，空字符串表示自动识别
+func CharsetLabel(name string) string {
+	switch name {
+	case "":
+		return "自动识别"
+	case charset.Latin1:
+		return "ISO-8859-1（Latin-1）"
+	}
+	return name
+}
+
+// SetCurrentCharset 为当前标签的文件指定字符编码（charset.Names中的名称）并重新渲染，空字符串表示恢复自动识别。
+// 用于自动识别出错、非UTF-8的标签显示为乱码的旧图表。设置保存到工作区状态，下次打开同一文件时恢复；
+// 草稿、虚拟文件和快照标签没有对应的文件，忽略设置
+func (ui *MainUI) SetCurrentCharset(name string) {
+	t := ui.selectedTab()
+	if t == nil || t.snapshot || t.scratch != nil || t.virtual {
+		return
+	}
+	plantuml.SetFileCharset(t.path, name)
+	log.Printf("%s 的字符编码设置为 %s", logging.Path(t.path), CharsetLabel(name))
+	if err := ui.session.SetCharset(t.path, name); err != nil {
+		log.Printf("无法保存字符编码设置: %v", err)
+	}
+	ui.replaceViewer(t, t.path)
+}
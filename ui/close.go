@@ -0,0 +1,148 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+// maxClosedBatches 最多记住最近几次关闭的标签页
+const maxClosedBatches = 20
+
+// closedTab 记录关闭的标签页，用于重新打开
+type closedTab struct {
+	path   string // 文件路径
+	follow string // 跟随标签的匹配模式，普通标签为空
+}
+
+// rememberClosed 把关闭的标签页记入最近关闭的列表，正在批量关闭时并入同一批。
+// 快照标签的图像、草稿和虚拟文件的内容无法恢复，不记录
+func (ui *MainUI) rememberClosed(t *tab) {
+	if t.snapshot || t.scratch != nil || t.virtual {
+		return
+	}
+	entry := closedTab{path: t.path}
+	if t.follow != nil {
+		entry.follow = t.follow.Pattern()
+	}
+
+	if ui.closingBatch != nil {
+		*ui.closingBatch = append(*ui.closingBatch, entry)
+		return
+	}
+	ui.pushClosed([]closedTab{entry})
+}
+
+// pushClosed 记录一次关闭，超过maxClosedBatches时丢弃最早的记录
+func (ui *MainUI) pushClosed(batch []closedTab) {
+	ui.closed = append(ui.closed, batch)
+	if len(ui.closed) > maxClosedBatches {
+		ui.closed = ui.closed[len(ui.closed)-maxClosedBatches:]
+	}
+}
+
+// closeTabs 关闭多个标签页，作为一次关闭记录，重新打开时一起恢复。
+// 有未保存修改的草稿不会被批量关闭，需要单独关闭
+func (ui *MainUI) closeTabs(items []*container.TabItem) {
+	var batch []closedTab
+	ui.closingBatch = &batch
+	for _, item := range items {
+		if t := ui.tabs.get(item); t != nil && t.scratch != nil && t.scratch.dirty {
+			log.Printf("草稿 %s 有未保存的修改，不关闭", t.title)
+			continue
+		}
+		ui.closeTab(item)
+	}
+	ui.closingBatch = nil
+
+	if len(batch) > 0 {
+		ui.pushClosed(batch)
+	}
+	log.Printf("已关闭 %d 个标签页", len(items))
+}
+
+// confirmClose 关闭标签页，数量超过设置中的ConfirmCloseTabs时先让用户确认
+func (ui *MainUI) confirmClose(items []*container.TabItem) {
+	if len(items) == 0 {
+		return
+	}
+	limit := ui.settings.ConfirmCloseTabs
+	if limit <= 0 || len(items) <= limit {
+		ui.closeTabs(items)
+		return
+	}
+
+	message := fmt.Sprintf("将关闭 %d 个标签页，之后可以通过“重新打开关闭的标签”恢复。确定关闭吗？", len(items))
+	dialog.ShowConfirm("关闭标签页", message, func(ok bool) {
+		if ok {
+			ui.closeTabs(items)
+		}
+	}, ui.window)
+}
+
+// CloseAllTabs 关闭所有标签页
+func (ui *MainUI) CloseAllTabs() {
+	if ui.Tabs == nil {
+		return
+	}
+	items := make([]*container.TabItem, len(ui.Tabs.Items))
+	copy(items, ui.Tabs.Items)
+	ui.confirmClose(items)
+}
+
+// CloseOtherTabs 关闭当前标签以外的所有标签页
+func (ui *MainUI) CloseOtherTabs() {
+	if ui.Tabs == nil {
+		return
+	}
+	current := ui.Tabs.Selected()
+	var items []*container.TabItem
+	for _, item := range ui.Tabs.Items {
+		if item != current {
+			items = append(items, item)
+		}
+	}
+	ui.confirmClose(items)
+}
+
+// ReopenClosedTabs 重新打开最近一次关闭的标签页，批量关闭的标签一起恢复。已不存在的文件跳过
+func (ui *MainUI) ReopenClosedTabs() {
+	if len(ui.closed) == 0 {
+		return
+	}
+	batch := ui.closed[len(ui.closed)-1]
+	ui.closed = ui.closed[:len(ui.closed)-1]
+
+	for _, entry := range batch {
+		var err error
+		if entry.follow != "" {
+			err = ui.FollowGlob(entry.follow)
+		} else {
+			err = ui.OpenFile(entry.path)
+		}
+		if err != nil {
+			log.Printf("重新打开 %s 时出错: %v", logging.Path(entry.path), err)
+		}
+	}
+}
+
+// QuitConfirmation 返回退出前需要用户确认的原因，不需要确认时返回空字符串
+func (ui *MainUI) QuitConfirmation() string {
+	if unsaved := ui.unsavedScratches(); unsaved > 0 {
+		return fmt.Sprintf("有 %d 个草稿尚未保存，退出后将丢弃。确定退出吗？", unsaved)
+	}
+	limit := ui.settings.ConfirmQuitTabs
+	if ui.Tabs == nil || limit <= 0 || len(ui.Tabs.Items) <= limit {
+		return ""
+	}
+	return fmt.Sprintf("当前打开了 %d 个标签页，退出后需要重新打开。确定退出吗？", len(ui.Tabs.Items))
+}
+
+// CanReopenClosedTabs 返回是否有可以重新打开的标签页
+func (ui *MainUI) CanReopenClosedTabs() bool {
+	return len(ui.closed) > 0
+}
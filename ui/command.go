@@ -0,0 +1,39 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/plantuml"
+)
+
+// CopyRenderCommand 把渲染当前标签时执行的PlantUML命令复制到剪贴板并显示出来，包括预处理变量、安全配置和Java选项，
+// 粘贴到终端或CI中就能重现渲染问题。草稿、虚拟文件和快照标签没有对应的文件，不能复制
+func (ui *MainUI) CopyRenderCommand() {
+	t := ui.selectedTab()
+	if t == nil || t.snapshot || t.scratch != nil || t.virtual {
+		return
+	}
+	command, err := plantuml.CommandLine(t.path)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("无法生成渲染命令: %v", err), ui.window)
+		return
+	}
+	fyne.CurrentApp().Clipboard().SetContent(command)
+	log.Printf("已复制渲染命令")
+
+	// 命令可能很长，放在可以选择文字的多行输入框中自动换行
+	entry := widget.NewMultiLineEntry()
+	entry.SetText(command)
+	entry.Wrapping = fyne.TextWrapBreak
+	entry.SetMinRowsVisible(4)
+	content := container.NewBorder(widget.NewLabel("已复制到剪贴板，在终端中运行会在图表文件旁边生成图像："), nil, nil, nil, entry)
+	d := dialog.NewCustom("渲染命令 - "+displayTitle(t), "关闭", content, ui.window)
+	d.Resize(fyne.NewSize(640, 0))
+	d.Show()
+}
@@ -0,0 +1,161 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/plantuml"
+)
+
+// maxErrorHistory 每个标签最多保留的记录数，超过时丢弃最早的记录
+const maxErrorHistory = 50
+
+// errorRecord 是一次渲染出错或出错后恢复正常的记录
+type errorRecord struct {
+	time   time.Time
+	err    error  // 渲染错误，恢复正常时为nil
+	change string // 与上一次渲染相比源码的变化，例如“修改了第12行”
+}
+
+// errorHistory 是一个标签的渲染错误历史
+type errorHistory struct {
+	records  []errorRecord
+	source   string // 上一次渲染时的源码
+	rendered bool   // 是否已经渲染过，第一次渲染时没有可以比较的源码
+	failing  bool   // 最近一次渲染是否出错
+}
+
+// add 记录一次渲染的结果：出错时总是记录，成功时只在之前出错时记录恢复
+func (h *errorHistory) add(now time.Time, source string, err error) {
+	change := "打开文件"
+	if h.rendered {
+		change = describeChange(h.source, source)
+	}
+	h.source = source
+	h.rendered = true
+
+	if err != nil || h.failing {
+		h.records = append(h.records, errorRecord{time: now, err: err, change: change})
+		if len(h.records) > maxErrorHistory {
+			h.records = h.records[len(h.records)-maxErrorHistory:]
+		}
+	}
+	h.failing = err != nil
+}
+
+// failingSince 返回连续出错中的第一次记录，没有出错时返回false
+func (h *errorHistory) failingSince() (errorRecord, bool) {
+	if !h.failing {
+		return errorRecord{}, false
+	}
+	first := len(h.records) - 1
+	for first > 0 && h.records[first-1].err != nil {
+		first--
+	}
+	return h.records[first], true
+}
+
+// describeChange 比较两次渲染的源码，返回改动所在的行，只比较开头和结尾相同的部分，中间视为一处改动
+func describeChange(old, new string) string {
+	if old == new {
+		return "源码没有变化"
+	}
+	oldLines := strings.Split(old, "\n")
+	newLines := strings.Split(new, "\n")
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+	removed := len(oldLines) - prefix - suffix
+	added := len(newLines) - prefix - suffix
+	switch {
+	case removed == 0:
+		return fmt.Sprintf("在第%d行添加了%d行", prefix+1, added)
+	case added == 0:
+		return fmt.Sprintf("删除了原来的%s", lineRange(prefix+1, prefix+removed))
+	}
+	return "修改了" + lineRange(prefix+1, prefix+added)
+}
+
+// lineRange 返回行号范围的文字，例如“第3行”或“第3-5行”
+func lineRange(from, to int) string {
+	if from == to {
+		return fmt.Sprintf("第%d行", from)
+	}
+	return fmt.Sprintf("第%d-%d行", from, to)
+}
+
+// trackErrorHistory 根据渲染事件记录每个标签的渲染错误历史，关闭标签时删除
+func (ui *MainUI) trackErrorHistory() {
+	ui.events.Subscribe(func(e event.Event) {
+		if e.Type == event.TabClosed {
+			delete(ui.errorHistories, e.Path)
+			return
+		}
+		h := ui.errorHistories[e.Path]
+		if h == nil {
+			h = &errorHistory{}
+			ui.errorHistories[e.Path] = h
+		}
+		h.add(e.Time, ui.renderedSource(e.Path), e.Err)
+	}, event.RenderFinished, event.RenderFailed, event.TabClosed)
+}
+
+// renderedSource 返回刚渲染的源码。打开文件时标签还没有创建，直接读取文件
+func (ui *MainUI) renderedSource(path string) string {
+	if t := ui.fileTab(path); t != nil {
+		return tabSource(t)
+	}
+	source, err := plantuml.ReadSource(path)
+	if err != nil {
+		return ""
+	}
+	return source
+}
+
+// errorHistoryText 返回标签的渲染错误历史，最新的记录在前。正在出错时第一行说明从哪次改动开始一直出错
+func (ui *MainUI) errorHistoryText(t *tab) string {
+	h := ui.errorHistories[t.path]
+	if h == nil || len(h.records) == 0 {
+		return "打开以来没有渲染错误"
+	}
+	var lines []string
+	if first, ok := h.failingSince(); ok {
+		lines = append(lines, fmt.Sprintf("从 %s（%s）起一直渲染出错", first.time.Format("15:04:05"), first.change), "")
+	}
+	for i := len(h.records) - 1; i >= 0; i-- {
+		r := h.records[i]
+		result := "恢复正常"
+		if r.err != nil {
+			result = renderFailureText("", r.err)
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s（%s）", r.time.Format("15:04:05"), result, r.change))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ShowErrorHistory 显示当前标签的渲染错误历史：每次出错的时间、错误和与上一次渲染相比改动的行，
+// 可以看出错误是刚出现的，还是从某次修改开始一直没有解决
+func (ui *MainUI) ShowErrorHistory() {
+	t := ui.selectedTab()
+	if t == nil {
+		return
+	}
+	label := widget.NewLabel(ui.errorHistoryText(t))
+	label.Wrapping = fyne.TextWrapWord
+	scroll := container.NewVScroll(label)
+	scroll.SetMinSize(fyne.NewSize(560, 320))
+	dialog.ShowCustom("渲染错误历史 - "+displayTitle(t), "关闭", scroll, ui.window)
+}
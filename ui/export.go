@@ -0,0 +1,437 @@
+package ui
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/export"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/internal/publish"
+)
+
+// customWidthOption 是导出比例选择框中“自定义宽度”的选项
+const customWidthOption = "自定义宽度"
+
+// ExportPDF 将当前标签的图表导出为PDF，多页图表（使用newpage分页）的所有页面按顺序合并到同一个文件中
+func (ui *MainUI) ExportPDF() {
+	ui.exportSelected("pdf", "导出为PDF")
+}
+
+// ExportPNG 按选定的比例重新渲染当前标签的图表并导出为PNG，多页图表导出第一页
+func (ui *MainUI) ExportPNG() {
+	ui.exportSelected("png", "导出为PNG")
+}
+
+// ExportSVG 将当前标签的图表导出为SVG，多页图表导出第一页。可以选择嵌入PlantUML源码，
+// 之后用查看器打开该SVG时可以导入源码
+func (ui *MainUI) ExportSVG() {
+	filePath := ui.selectedFilePath()
+	if filePath == "" {
+		return
+	}
+
+	embed := widget.NewCheck("嵌入PlantUML源码", nil)
+	embed.SetChecked(true)
+	dialog.ShowForm("导出为SVG", "导出...", "取消", []*widget.FormItem{
+		widget.NewFormItem("", embed),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		ui.saveAndPublish(filePath, ".svg", func(w io.Writer) error {
+			return export.WriteSVG(w, filePath, embed.Checked)
+		})
+	}, ui.window)
+}
+
+// ExportWithProfile 按当前文件所在项目的渲染配置中设置的格式导出，没有设置时导出为PNG
+func (ui *MainUI) ExportWithProfile() {
+	filePath := ui.selectedFilePath()
+	if filePath == "" {
+		return
+	}
+	format, err := export.ProfileFormat(filePath)
+	if err != nil {
+		dialog.ShowError(err, ui.window)
+		return
+	}
+	if format == "svg" {
+		ui.ExportSVG()
+		return
+	}
+	ui.exportSelected(format, "按渲染配置导出为"+strings.ToUpper(format))
+}
+
+// ExportRedacted 按当前文件所在项目的脱敏规则（.plantumlviewer.json中的redaction）替换主机名、IP等内容后导出副本，
+// 源文件不变，方便把内部图表发给外部而不用手工清理
+func (ui *MainUI) ExportRedacted() {
+	filePath := ui.selectedFilePath()
+	if filePath == "" {
+		return
+	}
+	rules, err := config.RedactionFor(filePath)
+	if err == nil && len(rules) == 0 {
+		err = fmt.Errorf("当前文件所在项目的 %s 中没有设置脱敏规则（redaction）", config.ProjectFile)
+	}
+	if err == nil {
+		err = export.CheckRedactable(filePath)
+	}
+	if err != nil {
+		dialog.ShowError(err, ui.window)
+		return
+	}
+
+	formatSelect := widget.NewSelect(export.Formats, nil)
+	formatSelect.SetSelectedIndex(0)
+	embed := widget.NewCheck("嵌入脱敏后的源码（只对SVG有效）", nil)
+	dialog.ShowForm("导出脱敏副本", "下一步", "取消", []*widget.FormItem{
+		widget.NewFormItem("格式", formatSelect),
+		widget.NewFormItem("", embed),
+		widget.NewFormItem("规则", widget.NewLabel(fmt.Sprintf("%d条", len(rules)))),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		format := formatSelect.Selected
+		save := func(scale export.Scale) {
+			ui.saveExport(filePath, export.RedactedSuffix+"."+format, postProcessed(filePath, "."+format, func(w io.Writer) error {
+				pages, count, err := export.WriteRedacted(w, filePath, format, scale, embed.Checked)
+				if err != nil {
+					return err
+				}
+				log.Printf("已导出脱敏副本%s（%d页，替换%d处）", strings.ToUpper(format), pages, count)
+				return nil
+			}))
+		}
+		if format == "svg" {
+			save(export.Scale{Label: "1x", Factor: 1})
+			return
+		}
+		ui.chooseExportScale("导出脱敏副本", save)
+	}, ui.window)
+}
+
+// exportSelected 选择比例和保存位置后，按format导出当前标签的图表
+func (ui *MainUI) exportSelected(format, title string) {
+	filePath := ui.selectedFilePath()
+	if filePath == "" {
+		return
+	}
+
+	ui.chooseExportScale(title, func(scale export.Scale) {
+		ui.saveAndPublish(filePath, "."+format, func(w io.Writer) error {
+			pages, err := export.Write(w, filePath, format, scale)
+			if err != nil {
+				return err
+			}
+			log.Printf("已导出%s（%d页，%s）", strings.ToUpper(format), pages, scale.Label)
+			return nil
+		})
+	})
+}
+
+// chooseExportScale 弹出对话框选择导出比例（预设比例或自定义宽度），确定后调用done
+func (ui *MainUI) chooseExportScale(title string, done func(export.Scale)) {
+	var options []string
+	for _, preset := range export.Presets {
+		options = append(options, preset.Label)
+	}
+	options = append(options, customWidthOption)
+
+	widthEntry := widget.NewEntry()
+	widthEntry.SetPlaceHolder("像素，例如 1920")
+	widthEntry.Disable()
+
+	scaleSelect := widget.NewSelect(options, func(selected string) {
+		if selected == customWidthOption {
+			widthEntry.Enable()
+		} else {
+			widthEntry.Disable()
+		}
+	})
+	scaleSelect.SetSelectedIndex(0)
+
+	dialog.ShowForm(title, "导出...", "取消", []*widget.FormItem{
+		widget.NewFormItem("比例", scaleSelect),
+		widget.NewFormItem("宽度", widthEntry),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		if index := scaleSelect.SelectedIndex(); index < len(export.Presets) {
+			done(export.Presets[index])
+			return
+		}
+
+		width, err := strconv.Atoi(strings.TrimSpace(widthEntry.Text))
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("无效的宽度: %s", widthEntry.Text), ui.window)
+			return
+		}
+		var baseWidth int
+		if viewer := ui.selectedViewer(); viewer != nil {
+			baseWidth = int(viewer.ImageSize().Width)
+		}
+		// 显示的图像已经按渲染配置的比例渲染，导出时还会再乘以该比例
+		if _, profile, err := config.ProfileFor(ui.selectedFilePath()); err == nil {
+			baseWidth = int(float64(baseWidth) / profile.ScaleFactor())
+		}
+		scale, err := export.ScaleForWidth(width, baseWidth)
+		if err != nil {
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		done(scale)
+	}, ui.window)
+}
+
+// saveExport 让用户选择保存位置，然后在后台调用write写入导出内容
+func (ui *MainUI) saveExport(filePath, ext string, write func(w io.Writer) error) {
+	save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		if writer == nil {
+			return // 用户取消
+		}
+
+		// 重新渲染需要一些时间，放到后台执行
+		go func() {
+			defer writer.Close()
+			if err := write(writer); err != nil {
+				fyne.Do(func() {
+					dialog.ShowError(fmt.Errorf("导出失败: %v", err), ui.window)
+				})
+				return
+			}
+			log.Printf("已导出: %s", logging.Path(writer.URI().Path()))
+		}()
+	}, ui.window)
+
+	base := filepath.Base(filePath)
+	save.SetFileName(strings.TrimSuffix(base, filepath.Ext(base)) + ext)
+	save.Show()
+}
+
+// saveAndPublish 与saveExport相同，但按文件的渲染配置做后处理；文件所在项目设置了发布目标（.plantumlviewer.json中的publish）时，
+// 保存后再把后处理过的内容上传到该目标。上传时使用默认的文件名，Confluence中的附件名不随保存时改的文件名变化
+func (ui *MainUI) saveAndPublish(filePath, ext string, write func(w io.Writer) error) {
+	write = postProcessed(filePath, ext, write)
+	target, err := config.PublishFor(filePath)
+	if err != nil || target == nil {
+		ui.saveExport(filePath, ext, write)
+		return
+	}
+	base := filepath.Base(filePath)
+	name := strings.TrimSuffix(base, filepath.Ext(base)) + ext
+	ui.saveExport(filePath, ext, func(w io.Writer) error {
+		var buf bytes.Buffer
+		if err := write(io.MultiWriter(w, &buf)); err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), publish.Timeout)
+		defer cancel()
+		if err := publish.Publish(ctx, *target, publish.File{Name: name, Data: buf.Bytes()}, filePath); err != nil {
+			return fmt.Errorf("文件已保存，但%v", err)
+		}
+		log.Printf("已上传%s到发布目标（%s）", name, target.EffectiveType())
+		return nil
+	})
+}
+
+// postProcessed 返回调用write后按filePath的渲染配置做后处理（见export.PostProcess）的写入函数，
+// 格式取自ext的扩展名，例如 .png 或 -redacted.svg
+func postProcessed(filePath, ext string, write func(w io.Writer) error) func(w io.Writer) error {
+	format := strings.TrimPrefix(filepath.Ext(ext), ".")
+	return func(w io.Writer) error {
+		return export.PostProcess(w, filePath, format, write)
+	}
+}
+
+// 导出图库时选择图表来源的选项
+const (
+	galleryFromTabs   = "所有打开的标签"
+	galleryFromFolder = "文件夹中的所有图表"
+)
+
+// ExportGallery 将所有打开的标签或某个文件夹（例如项目目录）中的所有图表导出为HTML图库：
+// 首页带缩略图，链接到完整图像和源码，可以直接发布到内部文档服务器
+func (ui *MainUI) ExportGallery() {
+	titleEntry := widget.NewEntry()
+	titleEntry.SetText("PlantUML图表")
+	sourceSelect := widget.NewSelect([]string{galleryFromTabs, galleryFromFolder}, nil)
+	sourceSelect.SetSelectedIndex(0)
+
+	dialog.ShowForm("导出图库", "下一步", "取消", []*widget.FormItem{
+		widget.NewFormItem("标题", titleEntry),
+		widget.NewFormItem("图表", sourceSelect),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		title := strings.TrimSpace(titleEntry.Text)
+		if sourceSelect.Selected == galleryFromTabs {
+			if files := ui.galleryFiles(); len(files) > 0 {
+				ui.writeGallery(files, title)
+			}
+			return
+		}
+
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil {
+				dialog.ShowError(err, ui.window)
+				return
+			}
+			if dir == nil {
+				return // 用户取消
+			}
+			files, err := export.FindDiagrams(dir.Path())
+			if err == nil && len(files) == 0 {
+				err = fmt.Errorf("%s 中没有PlantUML文件", dir.Path())
+			}
+			if err != nil {
+				dialog.ShowError(err, ui.window)
+				return
+			}
+			ui.writeGallery(files, title)
+		}, ui.window)
+	}, ui.window)
+}
+
+// galleryFiles 按标签顺序返回打开的文件，快照和虚拟文件标签没有对应的文件，不包括在内
+func (ui *MainUI) galleryFiles() []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, t := range ui.ordered() {
+		if t.snapshot || t.virtual || seen[t.path] {
+			continue
+		}
+		seen[t.path] = true
+		files = append(files, t.path)
+	}
+	return files
+}
+
+// writeGallery 选择比例和输出目录后，在后台把files导出为图库
+func (ui *MainUI) writeGallery(files []string, title string) {
+	ui.chooseExportScale("导出图库", func(scale export.Scale) {
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil {
+				dialog.ShowError(err, ui.window)
+				return
+			}
+			if dir == nil {
+				return // 用户取消
+			}
+
+			// 重新渲染需要一些时间，放到后台执行
+			go func() {
+				items, err := export.WriteGallery(files, dir.Path(), title, scale)
+				var failed []string
+				for _, item := range items {
+					if item.Err != nil {
+						failed = append(failed, fmt.Sprintf("%s: %v", item.Source, item.Err))
+					}
+				}
+				if err != nil || len(failed) > 0 {
+					if err != nil {
+						failed = append(failed, err.Error())
+					}
+					fyne.Do(func() {
+						dialog.ShowError(fmt.Errorf("导出图库时出错:\n%s", strings.Join(failed, "\n")), ui.window)
+					})
+				}
+			}()
+		}, ui.window)
+	})
+}
+
+// 导出幻灯片时选择图表来源的选项
+const (
+	slidesFromTabs    = "所有打开的标签"
+	slidesFromCurrent = "当前标签的所有页面"
+)
+
+// ExportSlides 把所有打开的标签或当前标签的所有页面导出为16:9的幻灯片（PDF或每张一个PNG），
+// 每个图表或每一页一张，可以直接导入Keynote或PowerPoint
+func (ui *MainUI) ExportSlides() {
+	sourceSelect := widget.NewSelect([]string{slidesFromTabs, slidesFromCurrent}, nil)
+	sourceSelect.SetSelectedIndex(0)
+	formatSelect := widget.NewSelect([]string{"pdf", "png"}, nil)
+	formatSelect.SetSelectedIndex(0)
+	titles := widget.NewCheck("在顶部显示标题", nil)
+	titles.SetChecked(true)
+
+	dialog.ShowForm("导出幻灯片", "导出...", "取消", []*widget.FormItem{
+		widget.NewFormItem("图表", sourceSelect),
+		widget.NewFormItem("格式", formatSelect),
+		widget.NewFormItem("", titles),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		// 保存对话框中默认的文件名：所有标签为slides.pdf，当前标签为“文件名-slides.pdf”
+		var files []string
+		name, ext := "slides", ".pdf"
+		if sourceSelect.Selected == slidesFromTabs {
+			files = ui.galleryFiles()
+		} else if filePath := ui.selectedFilePath(); filePath != "" {
+			files = []string{filePath}
+			name, ext = filePath, "-slides.pdf"
+		}
+		if len(files) == 0 {
+			return
+		}
+		opts := export.SlideOptions{Titles: titles.Checked, FontFile: ui.settings.SlideFontFile}
+
+		if formatSelect.Selected == "pdf" {
+			ui.saveExport(name, ext, func(w io.Writer) error {
+				slides, err := export.RenderSlides(files)
+				if err != nil {
+					return err
+				}
+				if err := export.WriteSlidesPDF(w, slides, opts); err != nil {
+					return err
+				}
+				log.Printf("已导出%d张幻灯片", len(slides))
+				return nil
+			})
+			return
+		}
+
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil {
+				dialog.ShowError(err, ui.window)
+				return
+			}
+			if dir == nil {
+				return // 用户取消
+			}
+
+			// 重新渲染需要一些时间，放到后台执行
+			go func() {
+				slides, err := export.RenderSlides(files)
+				if err == nil {
+					_, err = export.WriteSlidesPNG(dir.Path(), slides, opts)
+				}
+				if err != nil {
+					fyne.Do(func() {
+						dialog.ShowError(fmt.Errorf("导出幻灯片失败: %v", err), ui.window)
+					})
+				}
+			}()
+		}, ui.window)
+	}, ui.window)
+}
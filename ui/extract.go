@@ -0,0 +1,134 @@
+package ui
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/outline"
+)
+
+// includeExtensions 是提取出的文件可选的扩展名，第一个为默认扩展名
+var includeExtensions = []string{".iuml", ".puml"}
+
+// ExtractToInclude 把草稿编辑区中选中的行提取到新的文件（默认扩展名为.iuml），原来的位置改为 !include 这个文件，
+// 用于把过大的图表拆分成几个文件。提取的行中 !include 的相对路径改为相对于新文件。
+// 提取的文件和 !include 的路径相对于草稿保存的位置，还没有保存过的草稿需要先保存；提取可以撤销，但新文件保留
+func (ui *MainUI) ExtractToInclude() {
+	t := ui.selectedTab()
+	if t == nil || t.scratch == nil {
+		return
+	}
+	s := t.scratch
+	if s.savedPath == "" {
+		dialog.ShowError(fmt.Errorf("请先保存草稿，提取出的文件和 !include 的路径相对于草稿保存的位置"), ui.window)
+		return
+	}
+	first, last, ok := selectedLines(&s.entry.Entry)
+	if !ok {
+		dialog.ShowError(fmt.Errorf("请先在编辑区中选中要提取的行"), ui.window)
+		return
+	}
+
+	save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		if writer == nil {
+			return // 用户取消
+		}
+		chosen := writer.URI().Path()
+		writer.Close()
+		path := chosen
+		if filepath.Ext(path) == "" {
+			path += includeExtensions[0]
+			// 保存对话框已创建了没有扩展名的空文件
+			os.Remove(chosen)
+		}
+		if err := ui.extractToInclude(t, first, last, path); err != nil {
+			dialog.ShowError(err, ui.window)
+		}
+	}, ui.window)
+	save.SetFilter(storage.NewExtensionFileFilter(includeExtensions))
+	base := filepath.Base(s.savedPath)
+	save.SetFileName(strings.TrimSuffix(base, filepath.Ext(base)) + "-part" + includeExtensions[0])
+	if dir, err := storage.ListerForURI(storage.NewFileURI(filepath.Dir(s.savedPath))); err == nil {
+		save.SetLocation(dir)
+	}
+	save.Show()
+}
+
+// extractToInclude 把草稿的第first到last行写入path，原来的位置改为 !include 并立即重新渲染
+func (ui *MainUI) extractToInclude(t *tab, first, last int, path string) error {
+	s := t.scratch
+	source, extracted, err := outline.Extract(s.entry.Text, first, last, filepath.Dir(s.savedPath), path)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, []byte(extracted), 0644); err != nil {
+		return fmt.Errorf("无法写入提取的文件: %v", err)
+	}
+	log.Printf("已把第%d-%d行提取到 %s", first, last, logging.Path(path))
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	recordHistory(s)
+	s.entry.SetText(source)
+	s.entry.CursorRow, s.entry.CursorColumn = first-1, 0
+	s.entry.Refresh()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	ui.writeDraft(t)
+	return nil
+}
+
+// selectedLines 返回编辑框中选中的文字所在的行（从1开始），没有选中文字时返回false。
+// Entry只提供选中的文字，光标在选中范围的一端，按光标前后的文字判断选中的范围；
+// 选中范围结束在某一行的行首时不包括该行
+func selectedLines(entry *widget.Entry) (first, last int, ok bool) {
+	selected := entry.SelectedText()
+	if selected == "" {
+		return 0, 0, false
+	}
+	lines := strings.Split(entry.Text, "\n")
+	if entry.CursorRow >= len(lines) {
+		return 0, 0, false
+	}
+	offset := 0
+	for _, line := range lines[:entry.CursorRow] {
+		offset += len(line) + 1
+	}
+	line := lines[entry.CursorRow]
+	column := 0
+	for i := 0; i < entry.CursorColumn && column < len(line); i++ {
+		_, size := utf8.DecodeRuneInString(line[column:])
+		column += size
+	}
+	offset += column
+
+	spanned := strings.Count(strings.TrimSuffix(selected, "\n"), "\n")
+	row := entry.CursorRow + 1
+	switch {
+	case strings.HasPrefix(entry.Text[offset:], selected):
+		return row, row + spanned, true
+	case offset >= len(selected) && entry.Text[offset-len(selected):offset] == selected:
+		if strings.HasSuffix(selected, "\n") {
+			row--
+		}
+		return row - spanned, row, true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,114 @@
+package ui
+
+import (
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/outline"
+	"plantumlmacviewer/plantuml"
+)
+
+// flagsWidth 是预处理开关侧边栏的宽度
+const flagsWidth = 180
+
+// flagsPanel 在窗口右侧把当前标签源码中 !ifdef 检查的预处理变量列为复选框，勾选后以 -D名称 重新渲染，
+// 用于按需要显示图表中可选的细节。源码中没有这样的变量时隐藏
+type flagsPanel struct {
+	ui     *MainUI
+	checks *fyne.Container
+	box    *fyne.Container
+
+	path  string   // 列出的开关所属的文件
+	flags []string // 列出的开关，与复选框一一对应
+}
+
+// newFlagsPanel 创建预处理开关侧边栏，默认隐藏
+func newFlagsPanel(ui *MainUI) *flagsPanel {
+	p := &flagsPanel{ui: ui}
+	p.checks = container.NewVBox()
+	width := canvas.NewRectangle(nil)
+	width.SetMinSize(fyne.NewSize(flagsWidth, 0))
+	title := widget.NewLabelWithStyle("显示细节", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	p.box = container.NewStack(width, container.NewBorder(title, nil, nil, nil, container.NewVScroll(p.checks)))
+	p.box.Hide()
+	return p
+}
+
+// refresh 重新查找当前标签源码中的开关。草稿、虚拟文件和快照标签没有对应的文件，不显示
+func (p *flagsPanel) refresh() {
+	t := p.ui.selectedTab()
+	if t == nil || t.snapshot || t.scratch != nil || t.virtual {
+		p.show("", nil)
+		return
+	}
+	p.show(t.path, outline.Flags(tabSource(t)))
+}
+
+// show 为文件列出flags，与已经列出的相同时不重建复选框，避免打断正在进行的点击
+func (p *flagsPanel) show(path string, flags []string) {
+	if len(flags) == 0 {
+		p.path, p.flags = "", nil
+		p.checks.RemoveAll()
+		p.box.Hide()
+		return
+	}
+	if path == p.path && equalStrings(flags, p.flags) {
+		p.box.Show()
+		return
+	}
+	p.path, p.flags = path, flags
+	enabled := make(map[string]bool)
+	for _, name := range plantuml.FileFlags(path) {
+		enabled[name] = true
+	}
+	p.checks.RemoveAll()
+	for _, name := range flags {
+		check := widget.NewCheck(name, func(bool) { p.apply() })
+		check.Checked = enabled[name]
+		p.checks.Add(check)
+	}
+	p.box.Show()
+}
+
+// apply 按复选框的状态为文件设置开关并重新渲染
+func (p *flagsPanel) apply() {
+	t := p.ui.tabs.byFile(p.path)
+	if t == nil {
+		return
+	}
+	var flags []string
+	for i, obj := range p.checks.Objects {
+		if obj.(*widget.Check).Checked {
+			flags = append(flags, p.flags[i])
+		}
+	}
+	p.ui.setFileFlags(t, flags)
+}
+
+// equalStrings 判断两个字符串列表是否相同
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// setFileFlags 为标签的文件打开预处理开关，保存设置并重新渲染
+func (ui *MainUI) setFileFlags(t *tab, flags []string) {
+	plantuml.SetFileFlags(t.path, flags)
+	log.Printf("%s 打开的预处理开关设置为 %q", logging.Path(t.path), flags)
+	if err := ui.session.SetFileFlags(t.path, flags); err != nil {
+		log.Printf("无法保存预处理开关设置: %v", err)
+	}
+	ui.replaceViewer(t, t.path)
+}
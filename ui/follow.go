@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/internal/watch"
+	"plantumlmacviewer/plantuml"
+)
+
+// FollowGlob 打开一个跟随标签，始终显示匹配pattern（例如 build/diagrams/latest-*.puml）的最新文件。
+// 用于生成带时间戳的新文件而不是覆盖同一个文件的流程，出现更新的匹配文件时在同一个标签中切换过去
+func (ui *MainUI) FollowGlob(pattern string) error {
+	if abs, err := filepath.Abs(pattern); err == nil {
+		pattern = abs
+	}
+
+	follower := watch.NewGlob(pattern)
+	newest, _, err := follower.Check()
+	if err != nil {
+		return err
+	}
+
+	viewer, err := plantuml.NewViewer(newest, ui.renderer, ui.events)
+	if err != nil {
+		log.Printf("无法创建PlantUML查看器: %v", err)
+		return err
+	}
+	ui.wireViewer(viewer)
+
+	title := "跟随 " + truncateFileName(filepath.Base(pattern), 30)
+	item := container.NewTabItem(title, container.NewScroll(viewer.GetCanvas()))
+	t := ui.tabs.add(item, newest, viewer)
+	t.follow = follower
+	t.title = title
+	ui.Tabs.Append(item)
+	ui.refreshGroups()
+	ui.Tabs.Select(item)
+	ui.UpdateTitle()
+	log.Printf("开始跟随 %s，当前最新文件: %s", logging.Path(pattern), logging.Path(newest))
+
+	follower.SetPaused(ui.watchPaused)
+	go follower.Run(func(path string) {
+		fyne.Do(func() {
+			ui.switchFollowed(t, path)
+		})
+	})
+
+	ui.events.Publish(event.Event{Type: event.FileOpened, Path: newest})
+	return viewer.RenderError()
+}
+
+// switchFollowed 在跟随标签中切换到新的最新文件，标签已关闭时忽略
+func (ui *MainUI) switchFollowed(t *tab, path string) {
+	if ui.tabs.get(t.item) != t {
+		return
+	}
+	log.Printf("跟随标签切换到最新文件: %s", logging.Path(path))
+	if err := ui.replaceViewer(t, path); err != nil {
+		log.Printf("跟随的文件渲染失败: %v", err)
+	}
+	ui.events.Publish(event.Event{Type: event.FileOpened, Path: path})
+}
+
+// ChooseFollowPattern 弹出输入框输入匹配模式，确定后打开跟随标签
+func (ui *MainUI) ChooseFollowPattern() {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("例如 build/diagrams/latest-*.puml")
+	dialog.ShowForm("跟随最新文件", "跟随", "取消", []*widget.FormItem{
+		widget.NewFormItem("匹配模式", entry),
+	}, func(ok bool) {
+		pattern := strings.TrimSpace(entry.Text)
+		if !ok || pattern == "" {
+			return
+		}
+		if err := ui.FollowGlob(pattern); err != nil {
+			dialog.ShowError(fmt.Errorf("无法跟随 %s: %v", pattern, err), ui.window)
+		}
+	}, ui.window)
+	ui.window.Canvas().Focus(entry)
+}
@@ -0,0 +1,31 @@
+package ui
+
+import (
+	"log"
+
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/plantuml"
+)
+
+// SetSVGMode 设置是否以SVG渲染查看的图表并在后台重新渲染所有标签，快照标签保持不变。
+// SVG放大后仍然清晰，为文件单独指定了格式的标签不受影响；只影响查看，导出的文件不变
+func (ui *MainUI) SetSVGMode(on bool) {
+	ui.settings.SVGMode = on
+	plantuml.SetSVGMode(on)
+	ui.rerenderAll()
+}
+
+// SetCurrentImageFormat 为当前标签的文件指定查看时渲染的图像格式（plantuml.ImageFormatPNG或ImageFormatSVG）并重新渲染，
+// 空字符串表示跟随设置。设置保存到工作区状态，下次打开同一文件时恢复；草稿、虚拟文件和快照标签没有对应的文件，忽略设置
+func (ui *MainUI) SetCurrentImageFormat(format string) {
+	t := ui.selectedTab()
+	if t == nil || t.snapshot || t.scratch != nil || t.virtual {
+		return
+	}
+	plantuml.SetFileImageFormat(t.path, format)
+	log.Printf("%s 的图像格式设置为 %s", logging.Path(t.path), plantuml.ImageFormatLabel(format))
+	if err := ui.session.SetImageFormat(t.path, format); err != nil {
+		log.Printf("无法保存图像格式设置: %v", err)
+	}
+	ui.replaceViewer(t, t.path)
+}
@@ -0,0 +1,300 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/export"
+	"plantumlmacviewer/internal/logging"
+)
+
+// groupSidebarWidth 是分组侧边栏的宽度
+const groupSidebarWidth = 220
+
+// 侧边栏树节点ID的前缀，分组节点为前缀加分组名称，标签节点为前缀加TabItem的地址
+const (
+	groupNodePrefix = "g:"
+	tabNodePrefix   = "t:"
+)
+
+// groupSidebar 在窗口左侧按分组列出标签页。分组标题可以折叠，并提供刷新、导出和关闭整个分组的按钮。
+// 没有任何分组时隐藏
+type groupSidebar struct {
+	ui   *MainUI
+	tree *widget.Tree
+	box  *fyne.Container
+
+	groups  []string                      // 按分组中第一个标签的顺序排列
+	members map[string][]string           // 每个分组中标签节点的ID
+	items   map[string]*container.TabItem // 标签节点ID对应的标签
+}
+
+// newGroupSidebar 创建分组侧边栏
+func newGroupSidebar(ui *MainUI) *groupSidebar {
+	s := &groupSidebar{ui: ui}
+	s.tree = widget.NewTree(s.childUIDs, s.isBranch, s.createNode, s.updateNode)
+
+	// 点击标签节点切换到对应的标签页，不保留树中的选中状态
+	s.tree.OnSelected = func(uid widget.TreeNodeID) {
+		if item := s.items[uid]; item != nil {
+			ui.Tabs.Select(item)
+		}
+		s.tree.Unselect(uid)
+	}
+	s.tree.OnBranchOpened = func(uid widget.TreeNodeID) { s.setCollapsed(uid, false) }
+	s.tree.OnBranchClosed = func(uid widget.TreeNodeID) { s.setCollapsed(uid, true) }
+
+	width := canvas.NewRectangle(nil)
+	width.SetMinSize(fyne.NewSize(groupSidebarWidth, 0))
+	s.box = container.NewStack(width, s.tree)
+	s.box.Hide()
+	return s
+}
+
+// refresh 按当前的标签页重新生成分组列表，恢复各分组的折叠状态
+func (s *groupSidebar) refresh() {
+	s.groups = nil
+	s.members = make(map[string][]string)
+	s.items = make(map[string]*container.TabItem)
+	for _, t := range s.ui.ordered() {
+		group := t.style.Group
+		if group == "" {
+			continue
+		}
+		if _, ok := s.members[group]; !ok {
+			s.groups = append(s.groups, group)
+		}
+		uid := fmt.Sprintf("%s%p", tabNodePrefix, t.item)
+		s.members[group] = append(s.members[group], uid)
+		s.items[uid] = t.item
+	}
+
+	if len(s.groups) == 0 {
+		s.box.Hide()
+		return
+	}
+	for _, group := range s.groups {
+		if s.ui.session.GroupCollapsed(group) {
+			s.tree.CloseBranch(groupNodePrefix + group)
+		} else {
+			s.tree.OpenBranch(groupNodePrefix + group)
+		}
+	}
+	s.tree.Refresh()
+	s.box.Show()
+}
+
+// setCollapsed 记录分组的折叠状态，状态没有变化时不保存
+func (s *groupSidebar) setCollapsed(uid widget.TreeNodeID, collapsed bool) {
+	group := strings.TrimPrefix(uid, groupNodePrefix)
+	if s.ui.session.GroupCollapsed(group) == collapsed {
+		return
+	}
+	if err := s.ui.session.SetGroupCollapsed(group, collapsed); err != nil {
+		log.Printf("无法保存分组的折叠状态: %v", err)
+	}
+}
+
+func (s *groupSidebar) childUIDs(uid widget.TreeNodeID) []widget.TreeNodeID {
+	if uid == "" {
+		ids := make([]string, len(s.groups))
+		for i, group := range s.groups {
+			ids[i] = groupNodePrefix + group
+		}
+		return ids
+	}
+	return s.members[strings.TrimPrefix(uid, groupNodePrefix)]
+}
+
+func (s *groupSidebar) isBranch(uid widget.TreeNodeID) bool {
+	return uid == "" || strings.HasPrefix(uid, groupNodePrefix)
+}
+
+// createNode 创建树节点：分组节点为标题加操作按钮，标签节点为标签标题
+func (s *groupSidebar) createNode(branch bool) fyne.CanvasObject {
+	label := widget.NewLabel("")
+	label.Truncation = fyne.TextTruncateEllipsis
+	if !branch {
+		return label
+	}
+	label.TextStyle = fyne.TextStyle{Bold: true}
+	buttons := container.NewHBox(
+		newGroupButton(theme.ViewRefreshIcon()),
+		newGroupButton(theme.DocumentSaveIcon()),
+		newGroupButton(theme.WindowCloseIcon()),
+	)
+	return container.NewBorder(nil, nil, nil, buttons, label)
+}
+
+func (s *groupSidebar) updateNode(uid widget.TreeNodeID, branch bool, obj fyne.CanvasObject) {
+	if !branch {
+		if item := s.items[uid]; item != nil {
+			obj.(*widget.Label).SetText(item.Text)
+		}
+		return
+	}
+
+	group := strings.TrimPrefix(uid, groupNodePrefix)
+	row := obj.(*fyne.Container)
+	row.Objects[0].(*widget.Label).SetText(fmt.Sprintf("%s (%d)", group, len(s.members[group])))
+	buttons := row.Objects[1].(*fyne.Container).Objects
+	buttons[0].(*widget.Button).OnTapped = func() { s.ui.RefreshGroup(group) }
+	buttons[1].(*widget.Button).OnTapped = func() { s.ui.ExportGroup(group) }
+	buttons[2].(*widget.Button).OnTapped = func() { s.ui.CloseGroup(group) }
+}
+
+// newGroupButton 创建分组标题上的图标按钮，具体操作在updateNode中设置
+func newGroupButton(icon fyne.Resource) *widget.Button {
+	button := widget.NewButtonWithIcon("", icon, nil)
+	button.Importance = widget.LowImportance
+	return button
+}
+
+// refreshGroups 在标签页或分组变化后更新侧边栏
+func (ui *MainUI) refreshGroups() {
+	if ui.groups != nil {
+		ui.groups.refresh()
+	}
+}
+
+// Groups 按分组中第一个标签的顺序返回所有分组的名称
+func (ui *MainUI) Groups() []string {
+	var groups []string
+	seen := make(map[string]bool)
+	for _, t := range ui.ordered() {
+		if group := t.style.Group; group != "" && !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// tabsInGroup 按标签顺序返回分组中的标签页，group为空时返回nil，不把未分组的标签当作一个分组
+func (ui *MainUI) tabsInGroup(group string) []*tab {
+	if group == "" {
+		return nil
+	}
+	var tabs []*tab
+	for _, t := range ui.ordered() {
+		if t.style.Group == group {
+			tabs = append(tabs, t)
+		}
+	}
+	return tabs
+}
+
+// CurrentGroup 返回当前标签所属的分组，不属于任何分组时返回空字符串
+func (ui *MainUI) CurrentGroup() string {
+	if t := ui.selectedTab(); t != nil {
+		return t.style.Group
+	}
+	return ""
+}
+
+// SetTabGroup 把标签加入分组，group为空时移出分组
+func (ui *MainUI) SetTabGroup(item *container.TabItem, group string) {
+	t := ui.tabs.get(item)
+	if t == nil {
+		return
+	}
+	style := t.style
+	style.Group = strings.TrimSpace(group)
+	ui.setTabStyle(t, style)
+}
+
+// ChooseTabGroup 弹出输入框为当前标签选择或新建分组，清空后移出分组
+func (ui *MainUI) ChooseTabGroup() {
+	t := ui.selectedTab()
+	if t == nil {
+		return
+	}
+
+	entry := widget.NewSelectEntry(ui.Groups())
+	entry.SetText(t.style.Group)
+	entry.SetPlaceHolder("例如 frontend、billing")
+	dialog.ShowForm("标签分组", "确定", "取消", []*widget.FormItem{
+		widget.NewFormItem("分组", entry),
+	}, func(ok bool) {
+		if ok {
+			ui.SetTabGroup(t.item, entry.Text)
+		}
+	}, ui.window)
+	ui.window.Canvas().Focus(entry)
+}
+
+// CloseGroup 关闭分组中的所有标签页，可以通过ReopenClosedTabs一起恢复
+func (ui *MainUI) CloseGroup(group string) {
+	var items []*container.TabItem
+	for _, t := range ui.tabsInGroup(group) {
+		items = append(items, t.item)
+	}
+	if len(items) == 0 {
+		return
+	}
+	log.Printf("关闭分组 %s 的 %d 个标签页", group, len(items))
+	ui.closeTabs(items)
+}
+
+// RefreshGroup 重新渲染分组中的所有文件，快照标签保持不变
+func (ui *MainUI) RefreshGroup(group string) {
+	for _, t := range ui.tabsInGroup(group) {
+		if t.snapshot {
+			continue
+		}
+		if err := ui.replaceViewer(t, t.path); err != nil {
+			log.Printf("刷新分组 %s 中的 %s 失败: %v", group, logging.Path(t.path), err)
+		}
+	}
+}
+
+// ExportGroup 选择比例和目录后，把分组中的所有文件导出为PNG，文件名与源文件相同
+func (ui *MainUI) ExportGroup(group string) {
+	var files []string
+	for _, t := range ui.tabsInGroup(group) {
+		if !t.snapshot && !t.virtual {
+			files = append(files, t.path)
+		}
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	ui.chooseExportScale(fmt.Sprintf("导出分组 %s 为PNG", group), func(scale export.Scale) {
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil {
+				dialog.ShowError(err, ui.window)
+				return
+			}
+			if dir == nil {
+				return // 用户取消
+			}
+
+			// 重新渲染需要一些时间，放到后台执行
+			go func() {
+				var failed []string
+				for _, file := range files {
+					if _, err := export.WriteFile(file, "png", dir.Path(), scale, false); err != nil {
+						log.Printf("导出 %s 失败: %v", logging.Path(file), err)
+						failed = append(failed, fmt.Sprintf("%s: %v", file, err))
+					}
+				}
+				if len(failed) > 0 {
+					fyne.Do(func() {
+						dialog.ShowError(fmt.Errorf("导出失败:\n%s", strings.Join(failed, "\n")), ui.window)
+					})
+					return
+				}
+				log.Printf("已将分组 %s 的 %d 个文件导出到: %s", group, len(files), logging.Path(dir.Path()))
+			}()
+		}, ui.window)
+	})
+}
@@ -0,0 +1,50 @@
+package ui
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2/dialog"
+
+	"plantumlmacviewer/export"
+	"plantumlmacviewer/internal/logging"
+)
+
+// sourceExtractors 是可以从中导入PlantUML源码的图像格式，按小写扩展名取出图像中嵌入的源码
+var sourceExtractors = map[string]func([]byte) (string, bool){
+	".svg": export.ExtractSource,    // 导出SVG时选择了嵌入源码
+	".png": export.ExtractPNGSource, // PlantUML生成的PNG在元数据中保存了源码
+}
+
+// isImportableImage 判断文件是否为可以导入源码的图像，这类文件不作为图表打开
+func isImportableImage(path string) bool {
+	_, ok := sourceExtractors[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// offerImport 打开图像文件时调用。图像中嵌入了PlantUML源码时，询问是否把源码导入为草稿标签，
+// 导入后可以编辑和重新渲染；没有嵌入源码时返回错误
+func (ui *MainUI) offerImport(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("无法读取图像文件: %v", err)
+	}
+	source, ok := sourceExtractors[strings.ToLower(filepath.Ext(path))](data)
+	if !ok {
+		return fmt.Errorf("%s 中没有嵌入PlantUML源码，无法打开", filepath.Base(path))
+	}
+
+	message := fmt.Sprintf("%s 中嵌入了PlantUML源码，要导入为草稿吗？", filepath.Base(path))
+	dialog.ShowConfirm("导入PlantUML源码", message, func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := ui.openScratch(source, ""); err != nil {
+			log.Printf("导入 %s 中的源码时出错: %v", logging.Path(path), err)
+		}
+	}, ui.window)
+	return nil
+}
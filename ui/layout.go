@@ -0,0 +1,29 @@
+package ui
+
+import (
+	"log"
+
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/plantuml"
+)
+
+// SetCurrentLayout 为当前标签的文件指定布局引擎（plantuml.LayoutEngines中的名称）并重新渲染，空字符串表示恢复为Graphviz。
+// 用于在Graphviz中布局超时或者排得难以阅读的大图。设置保存到工作区状态，下次打开同一文件时恢复；
+// 草稿、虚拟文件和快照标签没有对应的文件，忽略设置
+func (ui *MainUI) SetCurrentLayout(engine string) {
+	t := ui.selectedTab()
+	if t == nil || t.snapshot || t.scratch != nil || t.virtual {
+		return
+	}
+	ui.setLayout(t, engine)
+}
+
+// setLayout 为标签的文件指定布局引擎，保存设置并重新渲染
+func (ui *MainUI) setLayout(t *tab, engine string) {
+	plantuml.SetFileLayout(t.path, engine)
+	log.Printf("%s 的布局引擎设置为 %s", logging.Path(t.path), plantuml.LayoutLabel(engine))
+	if err := ui.session.SetLayout(t.path, engine); err != nil {
+		log.Printf("无法保存布局引擎设置: %v", err)
+	}
+	ui.replaceViewer(t, t.path)
+}
@@ -0,0 +1,176 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/outline"
+	"plantumlmacviewer/plantuml"
+)
+
+// outlineWidth 是大纲侧边栏的宽度
+const outlineWidth = 220
+
+// outlinePanel 在窗口右侧列出当前标签源码中声明的参与者、类、包和状态。
+// 点击元素显示它在源码中出现的行，草稿标签还会在编辑区中依次选中各处出现的位置
+type outlinePanel struct {
+	ui    *MainUI
+	list  *widget.List
+	lines *widget.Label // 所选元素出现的行
+	box   *fyne.Container
+
+	source   string
+	elements []outline.Element
+	selected string // 最近点击的元素的ID
+	next     int    // 再次点击同一元素时选中的出现位置
+}
+
+// newOutlinePanel 创建大纲侧边栏，默认隐藏
+func newOutlinePanel(ui *MainUI) *outlinePanel {
+	p := &outlinePanel{ui: ui}
+	p.list = widget.NewList(
+		func() int { return len(p.elements) },
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return label
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			e := p.elements[id]
+			obj.(*widget.Label).SetText(fmt.Sprintf("%s  %s", e.Kind.Label(), e.Name))
+		},
+	)
+	// 不保留列表中的选中状态，再次点击同一元素时跳到下一处
+	p.list.OnSelected = func(id widget.ListItemID) {
+		p.list.Unselect(id)
+		p.show(p.elements[id])
+	}
+
+	p.lines = widget.NewLabel("")
+	p.lines.Wrapping = fyne.TextWrapWord
+
+	width := canvas.NewRectangle(nil)
+	width.SetMinSize(fyne.NewSize(outlineWidth, 0))
+	title := widget.NewLabelWithStyle("大纲", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	p.box = container.NewStack(width, container.NewBorder(title, p.lines, nil, nil, p.list))
+	p.box.Hide()
+	return p
+}
+
+// refresh 重新解析当前标签的源码。草稿标签使用编辑区中的内容，快照标签的图像与文件不一定一致，不显示大纲
+func (p *outlinePanel) refresh() {
+	if !p.box.Visible() {
+		return
+	}
+	p.source = ""
+	if t := p.ui.selectedTab(); t != nil && !t.snapshot {
+		p.source = tabSource(t)
+	}
+	p.elements = outline.Parse(p.source)
+	p.list.Refresh()
+
+	if p.selected != "" && len(outline.Occurrences(p.source, p.selected)) == 0 {
+		p.selected = ""
+		p.lines.SetText("")
+	}
+}
+
+// tabSource 返回标签的源码：草稿标签为编辑区中的内容，虚拟文件为编辑器发来的内容，其他标签读取文件并按文件的编码转换，无法读取时返回空字符串
+func tabSource(t *tab) string {
+	if t.scratch != nil {
+		return t.scratch.entry.Text
+	}
+	if t.virtual {
+		return string(t.viewer.Source())
+	}
+	source, err := plantuml.ReadSource(t.path)
+	if err != nil {
+		return ""
+	}
+	return source
+}
+
+// show 显示元素出现的行，草稿标签在编辑区中选中下一处出现的位置
+func (p *outlinePanel) show(e outline.Element) {
+	positions := outline.Occurrences(p.source, e.ID)
+	if e.ID != p.selected {
+		p.selected = e.ID
+		p.next = 0
+	}
+
+	var lines []string
+	for _, pos := range positions {
+		line := fmt.Sprint(pos.Line)
+		if len(lines) == 0 || lines[len(lines)-1] != line {
+			lines = append(lines, line)
+		}
+	}
+	p.lines.SetText(fmt.Sprintf("%s 出现在第 %s 行", e.Name, strings.Join(lines, "、")))
+
+	t := p.ui.selectedTab()
+	if t == nil || t.scratch == nil || len(positions) == 0 {
+		return
+	}
+	pos := positions[p.next%len(positions)]
+	p.next++
+	selectInEntry(&t.scratch.entry.Entry, pos)
+	p.ui.window.Canvas().Focus(t.scratch.entry)
+}
+
+// selectInEntry 在编辑框中选中pos处的文字。Entry没有设置选中范围的方法，按住Shift向右移动光标来选中
+func selectInEntry(entry *widget.Entry, pos outline.Position) {
+	// 先取消原有的选中
+	entry.TypedKey(&fyne.KeyEvent{Name: fyne.KeyLeft})
+	entry.CursorRow = pos.Line - 1
+	entry.CursorColumn = pos.Column
+	entry.Refresh()
+
+	entry.KeyDown(&fyne.KeyEvent{Name: desktop.KeyShiftLeft})
+	for i := 0; i < pos.Length; i++ {
+		entry.TypedKey(&fyne.KeyEvent{Name: fyne.KeyRight})
+	}
+	entry.KeyUp(&fyne.KeyEvent{Name: desktop.KeyShiftLeft})
+}
+
+// showSourceLine 草稿标签在编辑区中选中源码的第line行，其他标签在窗口标题中显示行号，由编辑器扩展跳到该行
+func (ui *MainUI) showSourceLine(t *tab, line int) {
+	if t.scratch == nil {
+		ui.window.SetTitle(fmt.Sprintf("PlantUML Viewer - 定义在第%d行", line))
+		return
+	}
+	lines := strings.Split(t.scratch.entry.Text, "\n")
+	if line > len(lines) {
+		return
+	}
+	selectInEntry(&t.scratch.entry.Entry, outline.Position{Line: line, Length: len([]rune(lines[line-1]))})
+	ui.window.Canvas().Focus(t.scratch.entry)
+}
+
+// SetOutlineVisible 显示或隐藏大纲侧边栏
+func (ui *MainUI) SetOutlineVisible(visible bool) {
+	if ui.outline == nil {
+		return
+	}
+	if visible {
+		ui.outline.box.Show()
+		ui.outline.refresh()
+	} else {
+		ui.outline.box.Hide()
+	}
+}
+
+// refreshOutline 在切换标签或源码变化后更新大纲和预处理开关
+func (ui *MainUI) refreshOutline() {
+	if ui.outline != nil {
+		ui.outline.refresh()
+	}
+	if ui.flags != nil {
+		ui.flags.refresh()
+	}
+}
@@ -0,0 +1,307 @@
+package ui
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/internal/watch"
+)
+
+// projectPanelWidth 是项目侧边栏的宽度
+const projectPanelWidth = 240
+
+// projectPanel 是项目模式的侧边栏：监控项目中的所有图表（不只是打开的标签），列出自上次看过后有变化的文件，
+// 审阅时可以逐个点开看过去。没有打开项目时隐藏，只在UI线程中访问
+type projectPanel struct {
+	ui      *MainUI
+	tree    *watch.Tree       // 监控项目目录，没有打开项目时为nil
+	digests map[string]string // 最近一次检查时各文件内容的摘要
+	changed []string          // 自上次看过后有变化的文件，按相对路径排列
+
+	title *widget.Label
+	empty *widget.Label // 没有变化时的提示
+	list  *widget.List
+	box   *fyne.Container
+}
+
+// newProjectPanel 创建项目侧边栏
+func newProjectPanel(ui *MainUI) *projectPanel {
+	p := &projectPanel{ui: ui}
+	p.title = widget.NewLabel("")
+	p.title.TextStyle = fyne.TextStyle{Bold: true}
+	p.title.Truncation = fyne.TextTruncateEllipsis
+	p.empty = widget.NewLabel("没有变化的图表")
+	p.empty.Importance = widget.LowImportance
+
+	p.list = widget.NewList(
+		func() int { return len(p.changed) },
+		func() fyne.CanvasObject {
+			badge := widget.NewLabel("●")
+			badge.Importance = widget.HighImportance
+			name := widget.NewLabel("")
+			name.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, badge, nil, name)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			path := p.changed[id]
+			row := obj.(*fyne.Container)
+			// 从没看过的新文件标为“新”，看过之后又有修改的标为圆点
+			badge := "●"
+			if ui.session.ViewedDigest(path) == "" {
+				badge = "新"
+			}
+			row.Objects[1].(*widget.Label).SetText(badge)
+			row.Objects[0].(*widget.Label).SetText(p.relative(path))
+		},
+	)
+	// 点击文件打开它并标为已看，不保留列表中的选中状态
+	p.list.OnSelected = func(id widget.ListItemID) {
+		p.list.Unselect(id)
+		if id >= len(p.changed) {
+			return
+		}
+		path := p.changed[id]
+		if err := ui.OpenFile(path); err != nil {
+			log.Printf("打开项目中的 %s 失败: %v", logging.Path(path), err)
+		}
+		ui.markViewed(path)
+	}
+
+	markAll := widget.NewButtonWithIcon("", theme.ConfirmIcon(), ui.MarkAllViewed)
+	markAll.Importance = widget.LowImportance
+	closeButton := widget.NewButtonWithIcon("", theme.WindowCloseIcon(), ui.CloseProject)
+	closeButton.Importance = widget.LowImportance
+	header := container.NewBorder(nil, nil, nil, container.NewHBox(markAll, closeButton), p.title)
+
+	width := canvas.NewRectangle(nil)
+	width.SetMinSize(fyne.NewSize(projectPanelWidth, 0))
+	p.box = container.NewStack(width, container.NewBorder(container.NewVBox(header, p.empty), nil, nil, nil, p.list))
+	p.box.Hide()
+	return p
+}
+
+// relative 返回文件相对于项目目录的路径
+func (p *projectPanel) relative(path string) string {
+	if p.tree != nil {
+		if rel, err := filepath.Rel(p.tree.Root(), path); err == nil {
+			return rel
+		}
+	}
+	return path
+}
+
+// update 按各文件当前的摘要重新列出有变化的文件：没有看过或内容与上次看过时不同
+func (p *projectPanel) update(digests map[string]string) {
+	p.digests = digests
+	p.changed = p.changed[:0]
+	for path, digest := range digests {
+		if p.ui.session.ViewedDigest(path) != digest {
+			p.changed = append(p.changed, path)
+		}
+	}
+	sort.Strings(p.changed)
+
+	p.title.SetText(fmt.Sprintf("%s（%d个变化）", filepath.Base(p.tree.Root()), len(p.changed)))
+	if len(p.changed) == 0 {
+		p.empty.Show()
+	} else {
+		p.empty.Hide()
+	}
+	p.list.Refresh()
+}
+
+// ChooseProject 选择一个目录（例如仓库的根目录）并打开项目模式
+func (ui *MainUI) ChooseProject() {
+	dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+		if err != nil {
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		if dir == nil {
+			return // 用户取消
+		}
+		if err := ui.OpenProject(dir.Path()); err != nil {
+			dialog.ShowError(fmt.Errorf("无法打开项目: %v", err), ui.window)
+		}
+	}, ui.window)
+}
+
+// OpenProject 打开项目模式，在后台监控root中的所有图表，侧边栏列出自上次看过后有变化的文件。
+// 新打开的项目把现有的文件都记为已看，之后的修改和新增的文件才列出；已经打开了其他项目时先关闭它
+func (ui *MainUI) OpenProject(root string) error {
+	root = canonicalPath(root)
+	if ui.project.tree != nil {
+		ui.stopProject()
+	}
+	if err := ui.startProject(root, true); err != nil {
+		return err
+	}
+	if err := ui.session.SetProject(root); err != nil {
+		log.Printf("无法保存项目目录: %v", err)
+	}
+	return nil
+}
+
+// RestoreProject 恢复上次打开的项目，此前看过的记录仍然有效，关闭期间的修改和新增的文件都会列出。
+// 项目目录已经不存在时关闭项目
+func (ui *MainUI) RestoreProject() {
+	root := ui.session.Project
+	if root == "" {
+		return
+	}
+	if _, err := os.Stat(root); err != nil {
+		log.Printf("上次打开的项目 %s 已经不存在，关闭项目", logging.Path(root))
+		if err := ui.session.SetProject(""); err != nil {
+			log.Printf("无法保存项目目录: %v", err)
+		}
+		return
+	}
+	if err := ui.startProject(root, false); err != nil {
+		log.Printf("无法恢复项目 %s: %v", logging.Path(root), err)
+	}
+}
+
+// startProject 检查一次项目目录并开始在后台监控，baseline为true时把没有记录的文件都记为已看
+func (ui *MainUI) startProject(root string, baseline bool) error {
+	tree := watch.NewTree(root)
+	digests, _, err := tree.Check()
+	if err != nil {
+		return err
+	}
+	if baseline {
+		unseen := make(map[string]string)
+		for path, digest := range digests {
+			if ui.session.ViewedDigest(path) == "" {
+				unseen[path] = digest
+			}
+		}
+		if err := ui.session.SetViewed(unseen); err != nil {
+			log.Printf("无法保存看过的文件: %v", err)
+		}
+	}
+
+	p := ui.project
+	p.tree = tree
+	p.update(digests)
+	p.box.Show()
+	log.Printf("打开项目 %s，共%d个图表，%d个有变化", logging.Path(root), len(digests), len(p.changed))
+
+	tree.SetPaused(ui.watchPaused)
+	go tree.Run(func(digests map[string]string) {
+		fyne.Do(func() {
+			if p.tree == tree {
+				p.update(digests)
+			}
+		})
+	})
+	return nil
+}
+
+// CloseProject 关闭项目模式，停止监控并清除看过的记录
+func (ui *MainUI) CloseProject() {
+	if ui.project.tree == nil {
+		return
+	}
+	log.Printf("关闭项目 %s", logging.Path(ui.project.tree.Root()))
+	ui.stopProject()
+	if err := ui.session.SetProject(""); err != nil {
+		log.Printf("无法保存项目目录: %v", err)
+	}
+}
+
+// stopProject 停止监控项目目录并隐藏侧边栏
+func (ui *MainUI) stopProject() {
+	p := ui.project
+	if p.tree == nil {
+		return
+	}
+	p.tree.Stop()
+	p.tree = nil
+	p.digests = nil
+	p.changed = nil
+	p.box.Hide()
+}
+
+// ProjectRoot 返回项目模式监控的目录，没有打开项目时返回空字符串
+func (ui *MainUI) ProjectRoot() string {
+	if ui.project == nil || ui.project.tree == nil {
+		return ""
+	}
+	return ui.project.tree.Root()
+}
+
+// ChangedProjectFiles 返回项目中自上次看过后有变化的文件，按相对路径排列
+func (ui *MainUI) ChangedProjectFiles() []string {
+	if ui.project == nil {
+		return nil
+	}
+	return append([]string(nil), ui.project.changed...)
+}
+
+// CheckProject 立即检查一次项目目录并更新侧边栏，不等待后台的下一次检查
+func (ui *MainUI) CheckProject() {
+	p := ui.project
+	if p == nil || p.tree == nil {
+		return
+	}
+	digests, _, err := p.tree.Check()
+	if err != nil {
+		log.Printf("检查项目失败: %v", err)
+		return
+	}
+	p.update(digests)
+}
+
+// MarkAllViewed 把项目中所有有变化的文件都标为已看，清空侧边栏的列表
+func (ui *MainUI) MarkAllViewed() {
+	p := ui.project
+	if p == nil || p.tree == nil || len(p.changed) == 0 {
+		return
+	}
+	viewed := make(map[string]string, len(p.changed))
+	for _, path := range p.changed {
+		viewed[path] = p.digests[path]
+	}
+	if err := ui.session.SetViewed(viewed); err != nil {
+		log.Printf("无法保存看过的文件: %v", err)
+	}
+	log.Printf("已把项目中%d个有变化的图表标为已看", len(viewed))
+	p.update(p.digests)
+}
+
+// markViewed 在标签中看到项目中的文件后，把它当前的内容记为已看。不在项目中或没有变化的文件不做任何事
+func (ui *MainUI) markViewed(path string) {
+	p := ui.project
+	if p == nil || p.tree == nil {
+		return
+	}
+	if _, ok := p.digests[path]; !ok {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	digest := watch.Digest(data)
+	if ui.session.ViewedDigest(path) == digest {
+		return
+	}
+	if err := ui.session.SetViewed(map[string]string{path: digest}); err != nil {
+		log.Printf("无法保存看过的文件: %v", err)
+	}
+	// 后台还没有发现这次修改时，先按读到的内容更新，避免刚看过的文件仍显示为有变化
+	p.digests[path] = digest
+	p.update(p.digests)
+}
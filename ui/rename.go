@@ -0,0 +1,209 @@
+package ui
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/internal/undo"
+	"plantumlmacviewer/outline"
+)
+
+// renamePreviewSize 是重命名对话框中预览区的大小
+var renamePreviewSize = fyne.NewSize(560, 240)
+
+// renamedFile 是重命名时要修改的一个被引用的文件
+type renamedFile struct {
+	path    string
+	before  string
+	after   string
+	changes []outline.Change
+}
+
+// renamePlan 是一次重命名的所有修改：草稿的新内容，以及勾选了同时修改引用的文件时各个文件的修改
+type renamePlan struct {
+	source  string
+	changes []outline.Change
+	files   []renamedFile
+	skipped []string // 不是UTF-8编码或无法读取，不修改的引用文件
+}
+
+// RenameSymbol 弹出对话框，在当前草稿标签中把一个参与者、类、包或状态的名称（有别名时为别名）改为新的名称。
+// 默认选中光标所在行的元素，确认前预览所有修改的行；编辑的是保存过的文件时，可以同时修改用 !include 引用的文件。
+// 草稿的修改可以撤销，引用的文件的修改记入各自的撤销历史，用“编辑当前文件”打开后可以撤销
+func (ui *MainUI) RenameSymbol() {
+	t := ui.selectedTab()
+	if t == nil || t.scratch == nil {
+		return
+	}
+	s := t.scratch
+	elements := outline.Parse(s.entry.Text)
+	if len(elements) == 0 {
+		dialog.ShowInformation("重命名", "草稿中没有声明参与者、类、包或状态", ui.window)
+		return
+	}
+
+	options := make([]string, len(elements))
+	for i, e := range elements {
+		options[i] = fmt.Sprintf("%s  %s", e.Kind.Label(), e.ID)
+	}
+	selected := 0
+	if e, ok := outline.ElementAt(s.entry.Text, s.entry.CursorRow+1); ok {
+		for i := range elements {
+			if elements[i] == e {
+				selected = i
+			}
+		}
+	}
+
+	entry := widget.NewEntry()
+	includes := widget.NewCheck("同时修改引用的文件", nil)
+	if s.savedPath == "" || len(outline.Includes(s.entry.Text, filepath.Dir(s.savedPath))) == 0 {
+		includes.Disable()
+	}
+	preview := widget.NewLabel("")
+	preview.TextStyle = fyne.TextStyle{Monospace: true}
+	scroll := container.NewScroll(preview)
+	scroll.SetMinSize(renamePreviewSize)
+
+	update := func() {
+		preview.SetText(ui.renamePreview(s, elements[selected].ID, strings.TrimSpace(entry.Text), includes.Checked))
+	}
+	choice := widget.NewSelect(options, func(option string) {
+		for i := range options {
+			if options[i] == option {
+				selected = i
+			}
+		}
+		entry.SetText(elements[selected].ID)
+		update()
+	})
+	entry.OnChanged = func(string) { update() }
+	includes.OnChanged = func(bool) { update() }
+	choice.SetSelectedIndex(selected)
+
+	form := widget.NewForm(
+		widget.NewFormItem("元素", choice),
+		widget.NewFormItem("新名称", entry),
+		widget.NewFormItem("", includes),
+	)
+	dialog.ShowCustomConfirm("重命名", "重命名", "取消", container.NewBorder(form, nil, nil, nil, scroll), func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := ui.renameSymbol(t, elements[selected].ID, strings.TrimSpace(entry.Text), includes.Checked); err != nil {
+			dialog.ShowError(err, ui.window)
+		}
+	}, ui.window)
+	ui.window.Canvas().Focus(entry)
+}
+
+// renamePreview 返回重命名预览区显示的文字：各个文件中修改前后的行
+func (ui *MainUI) renamePreview(s *scratch, id, newID string, includes bool) string {
+	if newID == id {
+		return "输入新的名称"
+	}
+	if !outline.ValidID(newID) {
+		return "名称只能包含字母、数字、下划线、点和中文等字符"
+	}
+	plan := planRename(s, id, newID, includes)
+	var b strings.Builder
+	writeChanges := func(title string, changes []outline.Change) {
+		fmt.Fprintf(&b, "%s：%d行\n", title, len(changes))
+		for _, c := range changes {
+			fmt.Fprintf(&b, "%4d - %s\n     + %s\n", c.Line, strings.TrimSpace(c.Before), strings.TrimSpace(c.After))
+		}
+	}
+	writeChanges("当前草稿", plan.changes)
+	for _, f := range plan.files {
+		writeChanges(filepath.Base(f.path), f.changes)
+	}
+	for _, path := range plan.skipped {
+		fmt.Fprintf(&b, "%s：不是UTF-8编码或无法读取，不修改\n", filepath.Base(path))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// planRename 计算把id改为newID的所有修改，不写入任何文件。includes为true且草稿编辑的是保存过的文件时，
+// 同时修改它用 !include 引用的文件，以及这些文件再引用的文件
+func planRename(s *scratch, id, newID string, includes bool) renamePlan {
+	var plan renamePlan
+	plan.source, plan.changes = outline.Rename(s.entry.Text, id, newID)
+	if !includes || s.savedPath == "" {
+		return plan
+	}
+
+	seen := map[string]bool{filepath.Clean(s.savedPath): true}
+	queue := outline.Includes(s.entry.Text, filepath.Dir(s.savedPath))
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		data, err := ioutil.ReadFile(path)
+		if err != nil || !utf8.Valid(data) {
+			plan.skipped = append(plan.skipped, path)
+			continue
+		}
+		before := string(data)
+		queue = append(queue, outline.Includes(before, filepath.Dir(path))...)
+		if after, changes := outline.Rename(before, id, newID); len(changes) > 0 {
+			plan.files = append(plan.files, renamedFile{path: path, before: before, after: after, changes: changes})
+		}
+	}
+	return plan
+}
+
+// renameSymbol 把草稿中的id改为newID并立即重新渲染，includes为true时同时改写引用的文件
+func (ui *MainUI) renameSymbol(t *tab, id, newID string, includes bool) error {
+	if !outline.ValidID(newID) {
+		return fmt.Errorf("名称 %q 无效，只能包含字母、数字、下划线、点和中文等字符", newID)
+	}
+	s := t.scratch
+	plan := planRename(s, id, newID, includes)
+	for _, f := range plan.files {
+		info, err := os.Stat(f.path)
+		if err != nil {
+			return fmt.Errorf("无法访问文件: %v", err)
+		}
+		if err := ioutil.WriteFile(f.path, []byte(f.after), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("无法写入文件: %v", err)
+		}
+		history := undo.Load(ui.undoDir, f.path)
+		history.Record(f.before)
+		history.Record(f.after)
+		if err := history.Save(); err != nil {
+			log.Printf("警告：%v", err)
+		}
+		log.Printf("重命名 %s 为 %s：修改了 %s 的%d行", id, newID, logging.Path(f.path), len(f.changes))
+	}
+	if len(plan.changes) == 0 {
+		return nil
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	recordHistory(s)
+	row := s.entry.CursorRow
+	s.entry.SetText(plan.source)
+	s.entry.CursorRow, s.entry.CursorColumn = row, 0
+	s.entry.Refresh()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	ui.writeDraft(t)
+	return nil
+}
@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"fyne.io/fyne/v2"
+
+	"plantumlmacviewer/internal/logging"
+)
+
+// RefreshIntervals 列出菜单中可选的定时刷新间隔，0表示不定时刷新
+var RefreshIntervals = []time.Duration{0, 10 * time.Second, 30 * time.Second, time.Minute, 5 * time.Minute}
+
+// RefreshIntervalLabel 返回定时刷新间隔在菜单中显示的名称
+func RefreshIntervalLabel(interval time.Duration) string {
+	switch {
+	case interval <= 0:
+		return "不定时刷新"
+	case interval%time.Minute == 0:
+		return fmt.Sprintf("每%d分钟", interval/time.Minute)
+	}
+	return fmt.Sprintf("每%d秒", interval/time.Second)
+}
+
+// schedule 按固定间隔重新渲染标签，用于通过!include或预处理函数引用了外部数据、
+// 文件本身不变但内容需要更新的图表
+type schedule struct {
+	interval time.Duration
+	stop     chan struct{}
+}
+
+// startSchedule 按interval定时重新渲染标签，替换原有的定时刷新，interval不大于0时只停止
+func (ui *MainUI) startSchedule(t *tab, interval time.Duration) {
+	stopSchedule(t)
+	if interval <= 0 || t.snapshot {
+		return
+	}
+
+	s := &schedule{interval: interval, stop: make(chan struct{})}
+	t.schedule = s
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				fyne.Do(func() {
+					// 标签可能已经关闭或更换了定时刷新
+					if t.schedule != s || ui.tabs.get(t.item) != t {
+						return
+					}
+					log.Printf("定时刷新: %s", logging.Path(t.path))
+					t.viewer.Rerender()
+				})
+			}
+		}
+	}()
+}
+
+// stopSchedule 停止标签的定时刷新
+func stopSchedule(t *tab) {
+	if t.schedule != nil {
+		close(t.schedule.stop)
+		t.schedule = nil
+	}
+}
+
+// refreshInterval 返回标签的定时刷新间隔，没有定时刷新时返回0
+func (t *tab) refreshInterval() time.Duration {
+	if t.schedule == nil {
+		return 0
+	}
+	return t.schedule.interval
+}
+
+// CurrentRefreshInterval 返回当前标签的定时刷新间隔，没有打开的标签或没有定时刷新时返回0
+func (ui *MainUI) CurrentRefreshInterval() time.Duration {
+	if t := ui.selectedTab(); t != nil {
+		return t.refreshInterval()
+	}
+	return 0
+}
+
+// SetCurrentRefreshInterval 设置当前标签的定时刷新间隔，0表示停止定时刷新。
+// 普通文件标签的设置保存到工作区状态，下次打开同一文件时恢复；快照标签不会重新渲染，忽略设置
+func (ui *MainUI) SetCurrentRefreshInterval(interval time.Duration) {
+	t := ui.selectedTab()
+	if t == nil || t.snapshot {
+		return
+	}
+	ui.startSchedule(t, interval)
+	ui.applyTabStyle(t)
+	ui.Tabs.Refresh()
+	ui.UpdateTitle()
+
+	if t.follow != nil || t.scratch != nil || t.virtual {
+		return
+	}
+	if err := ui.session.SetRefreshInterval(t.path, interval); err != nil {
+		log.Printf("无法保存定时刷新设置: %v", err)
+	}
+}
@@ -0,0 +1,421 @@
+package ui
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/formatter"
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/internal/samples"
+	"plantumlmacviewer/internal/undo"
+	"plantumlmacviewer/plantuml"
+)
+
+// scratchTemplate 是新建草稿的初始内容
+const scratchTemplate = "@startuml\n\n@enduml\n"
+
+// draftSaveDelay 编辑草稿后等待这么久没有新的修改再写入草稿文件并重新渲染
+const draftSaveDelay = 500 * time.Millisecond
+
+// scratchExtensions 是草稿另存为时可选的扩展名，第一个为默认扩展名
+var scratchExtensions = []string{".puml", ".plantuml", ".pu"}
+
+// scratch 是草稿标签的编辑状态。草稿内容随时写入恢复目录中的草稿文件，
+// 查看器渲染的就是这个文件，程序崩溃后下次启动时可以从恢复目录中找回
+type scratch struct {
+	entry     *historyEntry
+	draft     string        // 恢复目录中的草稿文件
+	savedPath string        // 最近一次保存到的文件，还没有保存过时为空
+	saved     string        // 最近一次保存的内容
+	dirty     bool          // 是否有未保存的修改
+	timer     *time.Timer   // 延迟写入草稿文件
+	history   *undo.History // 撤销历史，保存在数据目录中，见historyPath
+}
+
+// NewScratchTab 新建一个空白的草稿标签
+func (ui *MainUI) NewScratchTab() error {
+	return ui.openScratch(scratchTemplate, "")
+}
+
+// NewScratchFromClipboard 用剪贴板中的PlantUML代码新建草稿标签
+func (ui *MainUI) NewScratchFromClipboard() error {
+	text := strings.TrimSpace(fyne.CurrentApp().Clipboard().Content())
+	if text == "" {
+		return fmt.Errorf("剪贴板中没有文字")
+	}
+	return ui.openScratch(text+"\n", "")
+}
+
+// OpenSample 在草稿标签中打开内置的样例，可以直接修改或另存为。没有修改时关闭标签不会询问是否保存
+func (ui *MainUI) OpenSample(sample samples.Sample) error {
+	source, err := samples.Source(sample.Name)
+	if err != nil {
+		return err
+	}
+	t, err := ui.newScratch(string(source), "", "")
+	if t != nil {
+		t.title = sample.Title
+		t.scratch.dirty = false
+		ui.applyTabStyle(t)
+		ui.Tabs.Refresh()
+		ui.UpdateTitle()
+	}
+	return err
+}
+
+// EditCurrentFile 在草稿标签中编辑当前标签的文件，保存时写回该文件。之前在查看器中编辑这个文件的撤销历史会被恢复，
+// 重新启动后也可以撤销上次所做的修改
+func (ui *MainUI) EditCurrentFile() error {
+	t := ui.selectedTab()
+	if t == nil || t.scratch != nil || t.snapshot || t.virtual || t.follow != nil {
+		return fmt.Errorf("只能编辑打开的文件，草稿、快照、跟随和编辑器发来的标签不能编辑")
+	}
+	content, err := ioutil.ReadFile(t.path)
+	if err != nil {
+		return fmt.Errorf("无法读取文件: %v", err)
+	}
+	edit, err := ui.newScratch(string(content), "", t.path)
+	if edit != nil {
+		edit.title = truncateFileName(filepath.Base(t.path), 30)
+		edit.scratch.saved = string(content)
+		edit.scratch.dirty = false
+		ui.applyTabStyle(edit)
+		ui.Tabs.Refresh()
+		ui.UpdateTitle()
+	}
+	return err
+}
+
+// openScratch 打开草稿标签。draft为空时在恢复目录中新建草稿文件，否则打开已有的草稿文件（用于恢复）
+func (ui *MainUI) openScratch(content, draft string) error {
+	_, err := ui.newScratch(content, draft, "")
+	return err
+}
+
+// newScratch 与openScratch相同，同时返回新建的标签；无法创建标签时为nil。
+// savedPath不为空时编辑的是这个文件，保存时直接写回，撤销历史也属于它
+func (ui *MainUI) newScratch(content, draft, savedPath string) (*tab, error) {
+	if draft == "" {
+		if err := os.MkdirAll(ui.draftDir, 0755); err != nil {
+			return nil, fmt.Errorf("无法创建草稿目录: %v", err)
+		}
+		f, err := ioutil.TempFile(ui.draftDir, "scratch-*.puml")
+		if err != nil {
+			return nil, fmt.Errorf("无法创建草稿文件: %v", err)
+		}
+		f.Close()
+		draft = f.Name()
+	}
+	if err := ioutil.WriteFile(draft, []byte(content), 0644); err != nil {
+		return nil, fmt.Errorf("无法写入草稿文件: %v", err)
+	}
+
+	viewer, err := plantuml.NewViewer(draft, ui.renderer, ui.events)
+	if err != nil {
+		log.Printf("无法创建PlantUML查看器: %v", err)
+		return nil, err
+	}
+	ui.wireViewer(viewer)
+
+	ui.scratchCount++
+	title := fmt.Sprintf("草稿 %d", ui.scratchCount)
+	s := &scratch{entry: newHistoryEntry(), draft: draft, savedPath: savedPath, dirty: true}
+	s.entry.SetText(content)
+	ui.loadHistory(s)
+
+	item := container.NewTabItem(title, nil)
+	t := ui.tabs.add(item, draft, viewer)
+	t.title = title
+	t.scratch = s
+	item.Content = ui.tabContent(t)
+	ui.applyTabStyle(t)
+
+	s.entry.OnChanged = func(string) {
+		ui.scratchEdited(t)
+	}
+	s.entry.onUndo = func() { ui.stepHistory(t, s.history.Undo) }
+	s.entry.onRedo = func() { ui.stepHistory(t, s.history.Redo) }
+
+	ui.Tabs.Append(item)
+	ui.refreshGroups()
+	ui.Tabs.Select(item)
+	log.Printf("已打开草稿标签: %s (%s)", title, draft)
+	ui.events.Publish(event.Event{Type: event.FileOpened, Path: draft})
+	return t, viewer.RenderError()
+}
+
+// tabContent 创建标签页的内容：草稿标签为左侧编辑、右侧预览，C4图表在图表上方显示层级切换栏，其他标签只有图表
+func (ui *MainUI) tabContent(t *tab) fyne.CanvasObject {
+	preview := container.NewScroll(t.viewer.GetCanvas())
+	if t.scratch == nil {
+		if bar := ui.c4Bar(t); bar != nil {
+			return container.NewBorder(bar, nil, nil, nil, preview)
+		}
+		return preview
+	}
+	split := container.NewHSplit(t.scratch.entry, preview)
+	split.Offset = 0.35
+	return split
+}
+
+// scratchEdited 在编辑草稿后更新未保存状态，并延迟写入草稿文件和重新渲染
+func (ui *MainUI) scratchEdited(t *tab) {
+	s := t.scratch
+	dirty := s.savedPath == "" || s.entry.Text != s.saved
+	if dirty != s.dirty {
+		s.dirty = dirty
+		ui.applyTabStyle(t)
+		ui.Tabs.Refresh()
+		ui.UpdateTitle()
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(draftSaveDelay, func() {
+		fyne.Do(func() {
+			ui.writeDraft(t)
+		})
+	})
+}
+
+// writeDraft 把草稿内容写入草稿文件并重新渲染，同时记入撤销历史，标签已关闭时忽略
+func (ui *MainUI) writeDraft(t *tab) {
+	if ui.tabs.get(t.item) != t {
+		return
+	}
+	if err := ioutil.WriteFile(t.scratch.draft, []byte(t.scratch.entry.Text), 0644); err != nil {
+		log.Printf("无法写入草稿文件: %v", err)
+		return
+	}
+	recordHistory(t.scratch)
+	t.viewer.RefreshIfChanged()
+}
+
+// FormatScratch 整理当前草稿标签的源码格式（见formatter包），光标留在原来的行，整理前的内容可以撤销
+func (ui *MainUI) FormatScratch() {
+	t := ui.selectedTab()
+	if t == nil || t.scratch == nil {
+		return
+	}
+	s := t.scratch
+	formatted := formatter.Format(s.entry.Text)
+	if formatted == s.entry.Text {
+		return
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	recordHistory(s)
+	row := s.entry.CursorRow
+	s.entry.SetText(formatted)
+	if lines := strings.Count(formatted, "\n"); row > lines {
+		row = lines
+	}
+	s.entry.CursorRow, s.entry.CursorColumn = row, 0
+	s.entry.Refresh()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	ui.writeDraft(t)
+}
+
+// SaveScratch 保存当前的草稿标签，还没有保存过时选择保存位置
+func (ui *MainUI) SaveScratch() {
+	t := ui.selectedTab()
+	if t == nil || t.scratch == nil {
+		return
+	}
+	if t.scratch.savedPath == "" {
+		ui.saveScratchAs(t, nil)
+		return
+	}
+	if err := ui.writeScratch(t, t.scratch.savedPath); err != nil {
+		dialog.ShowError(err, ui.window)
+	}
+}
+
+// SaveScratchAs 选择保存位置保存当前的草稿标签
+func (ui *MainUI) SaveScratchAs() {
+	t := ui.selectedTab()
+	if t == nil || t.scratch == nil {
+		return
+	}
+	ui.saveScratchAs(t, nil)
+}
+
+// saveScratchAs 让用户选择保存位置，没有输入扩展名时使用.puml。保存成功后调用done（可以为nil）
+func (ui *MainUI) saveScratchAs(t *tab, done func()) {
+	save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		if writer == nil {
+			return // 用户取消
+		}
+
+		chosen := writer.URI().Path()
+		writer.Close()
+		path := withDefaultExtension(chosen)
+		if path != chosen {
+			// 保存对话框已创建了没有扩展名的空文件
+			os.Remove(chosen)
+		}
+		if err := ui.writeScratch(t, path); err != nil {
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		if done != nil {
+			done()
+		}
+	}, ui.window)
+	save.SetFilter(storage.NewExtensionFileFilter(scratchExtensions))
+	name := t.title + scratchExtensions[0]
+	if t.scratch.savedPath != "" {
+		name = filepath.Base(t.scratch.savedPath)
+	}
+	save.SetFileName(name)
+	save.Show()
+}
+
+// withDefaultExtension 在没有扩展名的路径后加上默认扩展名
+func withDefaultExtension(path string) string {
+	if filepath.Ext(path) == "" {
+		return path + scratchExtensions[0]
+	}
+	return path
+}
+
+// writeScratch 把草稿内容写入path，之后的标题显示为该文件名，撤销历史改为属于该文件
+func (ui *MainUI) writeScratch(t *tab, path string) error {
+	s := t.scratch
+	if err := ioutil.WriteFile(path, []byte(s.entry.Text), 0644); err != nil {
+		return fmt.Errorf("无法保存草稿: %v", err)
+	}
+	log.Printf("已保存草稿: %s", logging.Path(path))
+
+	s.history.Record(s.entry.Text)
+	if err := s.history.Rename(path); err != nil {
+		log.Printf("警告：%v", err)
+	}
+	s.savedPath = path
+	s.saved = s.entry.Text
+	s.dirty = false
+	t.title = truncateFileName(filepath.Base(path), 30)
+	ui.applyTabStyle(t)
+	ui.Tabs.Refresh()
+	ui.UpdateTitle()
+	return nil
+}
+
+// requestClose 关闭标签页，有未保存修改的草稿先询问是否保存
+func (ui *MainUI) requestClose(item *container.TabItem) {
+	t := ui.tabs.get(item)
+	if t == nil || t.scratch == nil || !t.scratch.dirty {
+		ui.closeTab(item)
+		return
+	}
+
+	var d *dialog.CustomDialog
+	message := widget.NewLabel(fmt.Sprintf("“%s”有未保存的修改，关闭前要保存吗？", t.title))
+	cancel := widget.NewButton("取消", func() { d.Hide() })
+	discard := widget.NewButton("不保存", func() {
+		d.Hide()
+		ui.closeTab(item)
+	})
+	save := widget.NewButton("保存...", func() {
+		d.Hide()
+		ui.saveScratchAs(t, func() { ui.closeTab(item) })
+	})
+	save.Importance = widget.HighImportance
+	if t.scratch.savedPath != "" {
+		save.SetText("保存")
+		save.OnTapped = func() {
+			d.Hide()
+			if err := ui.writeScratch(t, t.scratch.savedPath); err != nil {
+				dialog.ShowError(err, ui.window)
+				return
+			}
+			ui.closeTab(item)
+		}
+	}
+	d = dialog.NewCustomWithoutButtons("关闭草稿", message, ui.window)
+	d.SetButtons([]fyne.CanvasObject{cancel, discard, save})
+	d.Show()
+}
+
+// unsavedScratches 返回有未保存修改的草稿标签的数量
+func (ui *MainUI) unsavedScratches() int {
+	count := 0
+	for _, t := range ui.ordered() {
+		if t.scratch != nil && t.scratch.dirty {
+			count++
+		}
+	}
+	return count
+}
+
+// discardScratch 停止草稿的延迟写入并删除草稿文件，在关闭草稿标签时调用。
+// 没有保存过的草稿的撤销历史随之删除，保存过的文件的历史保留，下次编辑该文件时恢复
+func discardScratch(s *scratch) {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if err := os.Remove(s.draft); err != nil && !os.IsNotExist(err) {
+		log.Printf("无法删除草稿文件: %v", err)
+	}
+	if s.savedPath == "" {
+		if err := s.history.Remove(); err != nil {
+			log.Printf("警告：%v", err)
+		}
+	}
+}
+
+// DiscardDrafts 删除所有草稿标签的草稿文件，正常退出时调用。程序崩溃时草稿文件会保留下来，下次启动时恢复
+func (ui *MainUI) DiscardDrafts() {
+	for _, t := range ui.ordered() {
+		if t.scratch != nil {
+			discardScratch(t.scratch)
+		}
+	}
+}
+
+// RecoverDrafts 打开恢复目录中上次没有正常退出时留下的草稿，返回恢复的数量
+func (ui *MainUI) RecoverDrafts() int {
+	drafts, err := filepath.Glob(filepath.Join(ui.draftDir, "scratch-*.puml"))
+	if err != nil || len(drafts) == 0 {
+		return 0
+	}
+	sort.Strings(drafts)
+
+	recovered := 0
+	for _, draft := range drafts {
+		content, err := ioutil.ReadFile(draft)
+		if err != nil {
+			log.Printf("无法读取草稿文件: %v", err)
+			continue
+		}
+		if err := ui.openScratch(string(content), draft); err != nil {
+			log.Printf("恢复草稿 %s 时出错: %v", draft, err)
+		}
+		if ui.tabs.byPath(draft) != nil {
+			recovered++
+		}
+	}
+	log.Printf("已恢复 %d 个未保存的草稿", recovered)
+	return recovered
+}
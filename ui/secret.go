@@ -0,0 +1,45 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/internal/secret"
+	"plantumlmacviewer/plantuml"
+)
+
+// requestKey 请求解密加密图表的凭据：GPG文件输入口令，age文件选择密钥文件。凭据只交给查看器保存在内存中
+func (ui *MainUI) requestKey(kind string, done func(key secret.Key)) {
+	if kind == secret.KindAge {
+		dialog.ShowFileOpen(func(file fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, ui.window)
+				return
+			}
+			if file == nil {
+				return // 用户取消
+			}
+			// 只需要路径，由age读取密钥文件
+			file.Close()
+			done(secret.Key{Identity: file.URI().Path()})
+		}, ui.window)
+		return
+	}
+
+	entry := widget.NewPasswordEntry()
+	entry.SetPlaceHolder("GPG口令，私钥没有口令时留空")
+	dialog.ShowForm("解锁加密的图表", "解锁", "取消", []*widget.FormItem{
+		widget.NewFormItem("口令", entry),
+	}, func(ok bool) {
+		if ok {
+			done(secret.Key{Passphrase: entry.Text})
+		}
+	}, ui.window)
+	ui.window.Canvas().Focus(entry)
+}
+
+// ForgetKeys 清除内存中记住的解密凭据，打开的加密图表之后重新渲染时需要再次解锁
+func (ui *MainUI) ForgetKeys() {
+	plantuml.ForgetKeys()
+}
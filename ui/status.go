@@ -0,0 +1,97 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"plantumlmacviewer/internal/event"
+)
+
+// trackStatus 根据渲染事件记录正在重新渲染的文件，并在状态变化时更新窗口标题
+func (ui *MainUI) trackStatus() {
+	ui.events.Subscribe(func(e event.Event) {
+		switch e.Type {
+		case event.RenderStarted:
+			ui.rendering[e.Path] = true
+		case event.SyncConflict:
+		default:
+			delete(ui.rendering, e.Path)
+		}
+		ui.UpdateTitle()
+	}, event.RenderStarted, event.RenderFinished, event.RenderFailed, event.TabClosed, event.SyncConflict)
+}
+
+// Status 返回渲染出错的标签数和有待更新内容的标签数（正在重新渲染的文件或未保存的草稿）。
+// 快照标签不会重新渲染，不计算在内
+func (ui *MainUI) Status() (errors, pending int) {
+	for _, t := range ui.ordered() {
+		if t.snapshot {
+			continue
+		}
+		if t.viewer.RenderError() != nil {
+			errors++
+		}
+		if ui.rendering[t.path] || (t.scratch != nil && t.scratch.dirty) {
+			pending++
+		}
+	}
+	return errors, pending
+}
+
+// networkFileHint 是当前标签的文件位于网络文件系统上时窗口标题中的提示
+const networkFileHint = "[网络文件：自动刷新可能延迟，Cmd+R立即刷新]"
+
+// syncConflictHint 返回当前标签的文件在同步文件夹中有冲突副本时窗口标题中的提示，没有冲突副本时返回空字符串
+func syncConflictHint(provider string, copies []string) string {
+	if len(copies) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%s同步冲突：有%d个冲突副本，如 %s]", provider, len(copies), filepath.Base(copies[0]))
+}
+
+// statusText 返回窗口标题中显示的状态，没有需要注意的标签时返回空字符串
+func statusText(errors, pending int) string {
+	var parts []string
+	if errors > 0 {
+		parts = append(parts, fmt.Sprintf("%d个渲染错误", errors))
+	}
+	if pending > 0 {
+		parts = append(parts, fmt.Sprintf("%d个待更新", pending))
+	}
+	return strings.Join(parts, "，")
+}
+
+// UpdateTitle 按当前标签和全局状态更新窗口标题，并通知状态变化（用于Dock角标）
+func (ui *MainUI) UpdateTitle() {
+	if ui.Tabs == nil {
+		return
+	}
+	title := "PlantUML Viewer - 未加载文件"
+	if item := ui.Tabs.Selected(); item != nil {
+		title = "PlantUML Viewer - " + item.Text
+	}
+	errors, pending := ui.Status()
+	if status := statusText(errors, pending); status != "" {
+		title += "（" + status + "）"
+	}
+	if t := ui.selectedTab(); t != nil && !t.snapshot && t.viewer.IsNetworkFile() {
+		title += " " + networkFileHint
+	}
+	if t := ui.selectedTab(); t != nil && !t.snapshot {
+		if hint := syncConflictHint(t.viewer.SyncProvider(), t.viewer.Conflicts()); hint != "" {
+			title += " " + hint
+		}
+	}
+	ui.window.SetTitle(title)
+
+	if ui.onStatusChanged != nil {
+		ui.onStatusChanged(errors, pending)
+	}
+	ui.updateDescription()
+}
+
+// SetOnStatusChanged 设置全局状态可能变化时的回调，参数与Status的返回值相同
+func (ui *MainUI) SetOnStatusChanged(callback func(errors, pending int)) {
+	ui.onStatusChanged = callback
+}
@@ -0,0 +1,199 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"fyne.io/fyne/v2/container"
+
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/watch"
+	"plantumlmacviewer/plantuml"
+)
+
+// tab 是一个打开文件的标签页
+type tab struct {
+	item   *container.TabItem
+	path   string           // 文件的绝对路径
+	viewer *plantuml.Viewer // 重新打开文件时会替换为新的查看器
+	title  string           // 默认标题，没有自定义标题时显示
+	style  config.TabStyle  // 用户设置的标题和颜色
+	page   int              // 多页图表显示的页码，0表示第一页；重新打开文件时保持不变
+
+	snapshot bool        // 快照标签：冻结在创建时的图像，不随文件变化更新，按路径查找时忽略
+	follow   *watch.Glob // 跟随标签：始终显示匹配模式的最新文件，普通标签为nil
+	scratch  *scratch    // 草稿标签：可以编辑的未命名图表，普通标签为nil
+	virtual  bool        // 虚拟文件标签：显示编辑器发来的未保存内容，path为编辑器中的文件名，按路径查找时忽略
+
+	schedule *schedule // 定时刷新，没有设置时为nil
+}
+
+// tabModel 以TabItem为键记录每个标签页对应的文件和查看器。
+// 标签的位置只以DocTabs.Items为准，不在这里保存索引，标签重新排序后查找仍然有效
+type tabModel struct {
+	tabs map[*container.TabItem]*tab
+}
+
+// newTabModel 创建空的标签模型
+func newTabModel() *tabModel {
+	return &tabModel{tabs: make(map[*container.TabItem]*tab)}
+}
+
+// add 记录新的标签页
+func (m *tabModel) add(item *container.TabItem, path string, viewer *plantuml.Viewer) *tab {
+	t := &tab{item: item, path: path, viewer: viewer}
+	m.tabs[item] = t
+	return t
+}
+
+// remove 删除标签页的记录并返回它，没有记录时返回nil
+func (m *tabModel) remove(item *container.TabItem) *tab {
+	t := m.tabs[item]
+	delete(m.tabs, item)
+	return t
+}
+
+// get 返回标签页的记录，没有时返回nil
+func (m *tabModel) get(item *container.TabItem) *tab {
+	if item == nil {
+		return nil
+	}
+	return m.tabs[item]
+}
+
+// byPath 返回打开了path的标签页，没有时返回nil，不包括快照和虚拟文件标签
+func (m *tabModel) byPath(path string) *tab {
+	for _, t := range m.tabs {
+		if t.path == path && !t.snapshot && !t.virtual {
+			return t
+		}
+	}
+	return nil
+}
+
+// byFile 返回打开了与path相同文件的标签页，没有时返回nil，不包括快照和虚拟文件标签。
+// 除了路径相同，还通过os.SameFile识别硬链接和不区分大小写的文件系统上大小写不同的路径
+func (m *tabModel) byFile(path string) *tab {
+	if t := m.byPath(path); t != nil {
+		return t
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	for _, t := range m.tabs {
+		if t.snapshot || t.virtual {
+			continue
+		}
+		if other, err := os.Stat(t.path); err == nil && os.SameFile(info, other) {
+			return t
+		}
+	}
+	return nil
+}
+
+// byViewer 返回显示viewer的标签页，没有时返回nil
+func (m *tabModel) byViewer(viewer *plantuml.Viewer) *tab {
+	for _, t := range m.tabs {
+		if t.viewer == viewer {
+			return t
+		}
+	}
+	return nil
+}
+
+// byVirtual 返回名称为name的虚拟文件标签，没有时返回nil
+func (m *tabModel) byVirtual(name string) *tab {
+	for _, t := range m.tabs {
+		if t.virtual && t.path == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// canonicalPath 返回文件的绝对路径，并解析其中的符号链接，
+// 通过不同路径打开同一个文件时得到相同的结果
+func canonicalPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return path
+}
+
+// len 返回标签页的数量
+func (m *tabModel) len() int {
+	return len(m.tabs)
+}
+
+// ordered 按标签在DocTabs中的顺序返回所有标签页
+func (ui *MainUI) ordered() []*tab {
+	tabs := make([]*tab, 0, ui.tabs.len())
+	if ui.Tabs == nil {
+		return tabs
+	}
+	for _, item := range ui.Tabs.Items {
+		if t := ui.tabs.get(item); t != nil {
+			tabs = append(tabs, t)
+		}
+	}
+	return tabs
+}
+
+// tabAtIndex 返回指定索引的标签页，没有时返回nil
+func (ui *MainUI) tabAtIndex(index int) *tab {
+	if ui.Tabs == nil || index < 0 || index >= len(ui.Tabs.Items) {
+		return nil
+	}
+	return ui.tabs.get(ui.Tabs.Items[index])
+}
+
+// selectedTab 返回当前选中的标签页，没有时返回nil
+func (ui *MainUI) selectedTab() *tab {
+	if ui.Tabs == nil {
+		return nil
+	}
+	return ui.tabs.get(ui.Tabs.Selected())
+}
+
+// RevealFile 切换到已打开文件的标签，文件没有打开时返回错误。有同名的虚拟文件标签时优先切换到它
+func (ui *MainUI) RevealFile(path string) error {
+	t := ui.fileTab(path)
+	if t == nil {
+		return fmt.Errorf("文件没有打开: %s", path)
+	}
+	ui.Tabs.Select(t.item)
+	return nil
+}
+
+// FileRenderError 返回文件是否已打开，以及它最近一次渲染的错误。有同名的虚拟文件标签时返回它的结果
+func (ui *MainUI) FileRenderError(path string) (open bool, err error) {
+	t := ui.fileTab(path)
+	if t == nil {
+		return false, nil
+	}
+	return true, t.viewer.RenderError()
+}
+
+// fileTab 返回显示path的标签：优先返回同名的虚拟文件标签，其次是打开了该文件的标签
+func (ui *MainUI) fileTab(path string) *tab {
+	if t := ui.tabs.byVirtual(path); t != nil {
+		return t
+	}
+	return ui.tabs.byFile(path)
+}
+
+// OpenedFiles 按标签顺序返回所有已打开文件的路径，不包括快照、草稿和虚拟文件标签
+func (ui *MainUI) OpenedFiles() []string {
+	var paths []string
+	for _, t := range ui.ordered() {
+		if !t.snapshot && t.scratch == nil && !t.virtual {
+			paths = append(paths, t.path)
+		}
+	}
+	return paths
+}
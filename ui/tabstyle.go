@@ -0,0 +1,141 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/config"
+)
+
+// TabColor 是可以标记在标签上的颜色
+type TabColor struct {
+	Name  string // 保存在工作区状态中的名称
+	Label string // 菜单中显示的名称
+	Hex   string // 标签上圆点的颜色
+}
+
+// TabColors 是可选的标签颜色
+var TabColors = []TabColor{
+	{"red", "红色", "#e5484d"},
+	{"orange", "橙色", "#f76b15"},
+	{"yellow", "黄色", "#ffc53d"},
+	{"green", "绿色", "#30a46c"},
+	{"blue", "蓝色", "#0090ff"},
+	{"purple", "紫色", "#8e4ec6"},
+	{"gray", "灰色", "#8b8d98"},
+}
+
+// colorIcons 缓存各颜色的圆点图标，同一颜色的标签共用一个资源
+var colorIcons = make(map[string]fyne.Resource)
+
+// colorIcon 返回颜色的圆点图标，name为空或不是已知颜色时返回nil
+func colorIcon(name string) fyne.Resource {
+	if icon, ok := colorIcons[name]; ok {
+		return icon
+	}
+	for _, c := range TabColors {
+		if c.Name == name {
+			svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 16 16"><circle cx="8" cy="8" r="6" fill="%s"/></svg>`, c.Hex)
+			icon := fyne.NewStaticResource("tab-color-"+name+".svg", []byte(svg))
+			colorIcons[name] = icon
+			return icon
+		}
+	}
+	return nil
+}
+
+// SetSession 设置保存标签标题和颜色的工作区状态，需要在GetContent之前调用才会应用到启动时打开的文件
+func (ui *MainUI) SetSession(session *config.Session) {
+	ui.session = session
+}
+
+// applyTabStyle 按标签的自定义设置更新标签的文字和颜色图标，调用方负责刷新标签容器
+func (ui *MainUI) applyTabStyle(t *tab) {
+	t.item.Text = displayTitle(t)
+	if t.scratch != nil && t.scratch.dirty {
+		t.item.Text += " *"
+	}
+	if t.schedule != nil {
+		t.item.Text += " ⟳"
+	}
+	t.item.Icon = colorIcon(t.style.Color)
+}
+
+// displayTitle 返回标签显示的标题：自定义标题或默认标题，不包含未保存、定时刷新等标记
+func displayTitle(t *tab) string {
+	if t.style.Title != "" {
+		return t.style.Title
+	}
+	return t.title
+}
+
+// setTabStyle 修改标签的自定义设置。普通文件标签的设置保存到工作区状态，下次打开同一文件时恢复；
+// 快照、跟随和草稿标签的设置只在本次显示
+func (ui *MainUI) setTabStyle(t *tab, style config.TabStyle) {
+	t.style = style
+	ui.applyTabStyle(t)
+	ui.Tabs.Refresh()
+	ui.refreshGroups()
+	if ui.Tabs.Selected() == t.item {
+		ui.UpdateTitle()
+	}
+
+	if t.snapshot || t.follow != nil || t.scratch != nil || t.virtual {
+		return
+	}
+	if err := ui.session.SetTabStyle(t.path, style); err != nil {
+		log.Printf("无法保存标签设置: %v", err)
+	}
+}
+
+// RenameCurrentTab 弹出输入框修改当前标签显示的标题，清空后恢复显示文件名。只改变显示，不重命名文件
+func (ui *MainUI) RenameCurrentTab() {
+	t := ui.selectedTab()
+	if t == nil {
+		return
+	}
+
+	entry := widget.NewEntry()
+	// 不包含未保存、定时刷新等标记
+	entry.SetText(displayTitle(t))
+	entry.SetPlaceHolder(t.title)
+	dialog.ShowForm("重命名标签", "确定", "取消", []*widget.FormItem{
+		widget.NewFormItem("标题", entry),
+	}, func(ok bool) {
+		if ok {
+			ui.SetTabTitle(t.item, entry.Text)
+		}
+	}, ui.window)
+	ui.window.Canvas().Focus(entry)
+}
+
+// SetTabTitle 设置标签显示的标题，title为空或与默认标题相同时恢复默认
+func (ui *MainUI) SetTabTitle(item *container.TabItem, title string) {
+	t := ui.tabs.get(item)
+	if t == nil {
+		return
+	}
+	style := t.style
+	style.Title = strings.TrimSpace(title)
+	if style.Title == t.title {
+		style.Title = ""
+	}
+	ui.setTabStyle(t, style)
+}
+
+// SetCurrentTabColor 设置当前标签的颜色标记，name为空时清除
+func (ui *MainUI) SetCurrentTabColor(name string) {
+	t := ui.selectedTab()
+	if t == nil {
+		return
+	}
+	style := t.style
+	style.Color = name
+	ui.setTabStyle(t, style)
+}
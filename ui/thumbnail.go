@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"image/color"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	// thumbnailDelay 鼠标在标签上停留多久后显示缩略图
+	thumbnailDelay = 400 * time.Millisecond
+	// thumbnailWidth 缩略图宽度
+	thumbnailWidth float32 = 240
+	// thumbnailHeight 缩略图高度
+	thumbnailHeight float32 = 180
+)
+
+// tabThumbnails 在鼠标悬停标签头时显示对应图表的缩略图
+// DocTabs没有提供标签头的悬停事件，这里在标签栏上方覆盖一层只响应悬停的透明区域，
+// 并按照DocTabs的布局规则推算鼠标所在的标签
+type tabThumbnails struct {
+	widget.BaseWidget
+
+	ui      *MainUI
+	frame   *fyne.Container // 缩略图外框（背景+图像）
+	image   *canvas.Image
+	layer   *fyne.Container // 不参与布局的浮层，用于摆放缩略图
+	hovered int             // 当前悬停的标签索引，-1表示没有
+	timer   *time.Timer
+}
+
+// newTabThumbnails 创建标签缩略图组件
+func newTabThumbnails(ui *MainUI) *tabThumbnails {
+	t := &tabThumbnails{ui: ui, hovered: -1}
+
+	t.image = &canvas.Image{FillMode: canvas.ImageFillContain, ScaleMode: canvas.ImageScaleSmooth}
+	background := canvas.NewRectangle(theme.Color(theme.ColorNameOverlayBackground))
+	background.StrokeColor = theme.Color(theme.ColorNameShadow)
+	background.StrokeWidth = 1
+	t.frame = container.NewStack(background, container.NewPadded(t.image))
+	t.frame.Hide()
+	t.layer = container.NewWithoutLayout(t.frame)
+
+	t.ExtendBaseWidget(t)
+	return t
+}
+
+// CreateRenderer 悬停区域本身是透明的
+func (t *tabThumbnails) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(canvas.NewRectangle(color.Transparent))
+}
+
+// MinSize 悬停区域的高度与标签栏一致
+func (t *tabThumbnails) MinSize() fyne.Size {
+	return fyne.NewSize(0, tabBarHeight())
+}
+
+// MouseIn 鼠标进入标签栏
+func (t *tabThumbnails) MouseIn(ev *desktop.MouseEvent) {
+	t.MouseMoved(ev)
+}
+
+// MouseMoved 鼠标在标签栏上移动时，找到所在的标签并延迟显示缩略图
+func (t *tabThumbnails) MouseMoved(ev *desktop.MouseEvent) {
+	index, start := t.tabAt(ev.Position.X)
+	if index == t.hovered {
+		return
+	}
+	t.hide()
+	t.hovered = index
+	if index < 0 {
+		return
+	}
+
+	t.timer = time.AfterFunc(thumbnailDelay, func() {
+		fyne.Do(func() {
+			if t.hovered == index {
+				t.show(index, start)
+			}
+		})
+	})
+}
+
+// MouseOut 鼠标离开标签栏
+func (t *tabThumbnails) MouseOut() {
+	t.hovered = -1
+	t.hide()
+}
+
+// show 在标签下方显示该标签的缩略图
+func (t *tabThumbnails) show(index int, x float32) {
+	tab := t.ui.tabAtIndex(index)
+	if tab == nil || tab.viewer.Image() == nil {
+		return
+	}
+	viewer := tab.viewer
+
+	t.image.Resource = viewer.Image()
+	t.image.Refresh()
+
+	// 保证缩略图不超出窗口右侧
+	if maxX := t.ui.Tabs.Size().Width - thumbnailWidth; x > maxX {
+		x = fyne.Max(maxX, 0)
+	}
+	t.frame.Move(fyne.NewPos(x, tabBarHeight()))
+	t.frame.Resize(fyne.NewSize(thumbnailWidth, thumbnailHeight))
+	t.frame.Show()
+}
+
+// hide 隐藏缩略图并取消尚未触发的显示
+func (t *tabThumbnails) hide() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if t.frame.Visible() {
+		t.frame.Hide()
+	}
+}
+
+// tabAt 推算横坐标x处的标签索引及其起始位置，没有标签或标签栏已溢出滚动时返回-1
+func (t *tabThumbnails) tabAt(x float32) (int, float32) {
+	padding := theme.Padding()
+	var start float32
+	for i, item := range t.ui.Tabs.Items {
+		width := tabButtonWidth(item)
+		if x >= start && x < start+width {
+			if t.headerOverflows() {
+				return -1, 0
+			}
+			return i, start
+		}
+		start += width + padding
+	}
+	return -1, 0
+}
+
+// headerOverflows 判断标签栏是否已放不下全部标签（此时标签栏可以滚动，无法准确推算位置）
+func (t *tabThumbnails) headerOverflows() bool {
+	padding := theme.Padding()
+	var total float32
+	for _, item := range t.ui.Tabs.Items {
+		total += tabButtonWidth(item) + padding
+	}
+	// 标签栏右侧还有“全部标签”等按钮
+	actions := 2 * (theme.IconInlineSize() + 2*theme.InnerPadding())
+	return total > t.Size().Width-actions
+}
+
+// tabButtonWidth 按DocTabs标签按钮的布局规则计算标签宽度（颜色图标+粗体文字+关闭按钮+内边距）
+func tabButtonWidth(item *container.TabItem) float32 {
+	textSize := fyne.MeasureText(item.Text, theme.TextSize(), fyne.TextStyle{Bold: true})
+	width := textSize.Width + theme.IconInlineSize() + theme.Padding() + 2*theme.InnerPadding()
+	if item.Icon != nil {
+		width += theme.IconInlineSize() + theme.Padding()
+	}
+	return width
+}
+
+// tabBarHeight 按DocTabs标签按钮的布局规则计算标签栏高度
+func tabBarHeight() float32 {
+	textSize := fyne.MeasureText("M", theme.TextSize(), fyne.TextStyle{Bold: true})
+	return fyne.Max(textSize.Height, theme.IconInlineSize()) + 2*theme.InnerPadding()
+}
@@ -0,0 +1,150 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/export"
+	"plantumlmacviewer/internal/logging"
+)
+
+// timelineView 是历史时间轴对话框：拖动滑块在文件的各个提交之间切换，显示该版本渲染的图表。
+// 只在UI线程中访问
+type timelineView struct {
+	timeline *export.Timeline
+	image    *canvas.Image
+	status   *widget.Label // 滑块所在的版本和渲染状态
+	current  int           // 滑块所在的版本
+	loading  bool          // 正在后台渲染某个版本
+}
+
+// ShowTimeline 弹出当前标签的文件的历史时间轴，从最新的提交开始，向左拖动滑块回看图表在更早的提交中的样子，
+// 用于回顾架构是怎样演变的。各版本在拖到时才渲染并缓存，再次经过时直接显示。
+// 草稿、虚拟文件和快照标签没有对应的文件，不能查看
+func (ui *MainUI) ShowTimeline() {
+	t := ui.selectedTab()
+	if t == nil || t.snapshot || t.scratch != nil || t.virtual {
+		return
+	}
+	path := t.path
+	go func() {
+		timeline, err := export.NewTimeline(path, export.DefaultHistoryLimit)
+		fyne.Do(func() {
+			if err != nil {
+				dialog.ShowError(err, ui.window)
+				return
+			}
+			ui.showTimeline(displayTitle(t), timeline)
+		})
+	}()
+}
+
+// showTimeline 显示时间轴对话框
+func (ui *MainUI) showTimeline(title string, timeline *export.Timeline) {
+	v := &timelineView{timeline: timeline, image: &canvas.Image{}, status: widget.NewLabel("")}
+	v.image.FillMode = canvas.ImageFillContain
+	v.status.Truncation = fyne.TextTruncateEllipsis
+
+	last := len(timeline.Revisions) - 1
+	slider := widget.NewSlider(0, float64(last))
+	slider.Step = 1
+	slider.Value = float64(last)
+	slider.OnChanged = func(value float64) {
+		v.show(int(value))
+	}
+	if last == 0 {
+		slider.Disable()
+	}
+
+	exportButton := widget.NewButton("导出动画...", func() {
+		ui.exportTimelineAnimation(timeline)
+	})
+	bottom := container.NewVBox(slider, container.NewBorder(nil, nil, nil, exportButton, v.status))
+	content := container.NewBorder(nil, bottom, nil, nil, v.image)
+	size := ui.window.Canvas().Size()
+	d := dialog.NewCustom(fmt.Sprintf("历史时间轴 - %s（%d个提交）", title, len(timeline.Revisions)), "关闭", content, ui.window)
+	d.Resize(fyne.NewSize(size.Width*0.9, size.Height*0.9))
+	d.Show()
+	v.show(last)
+}
+
+// show 切换到第i个版本。已经缓存的版本立即显示；否则在后台渲染，同时只渲染一个版本，
+// 渲染期间拖过的版本不渲染，完成后渲染滑块最后所在的版本
+func (v *timelineView) show(i int) {
+	v.current = i
+	rev := v.timeline.Revisions[i]
+	if v.timeline.Cached(i) {
+		data, err := v.timeline.Render(i)
+		v.display(rev, data, err)
+		return
+	}
+	v.status.SetText(fmt.Sprintf("%s（正在渲染…）", rev.Label()))
+	if v.loading {
+		return
+	}
+	v.loading = true
+	go func() {
+		data, err := v.timeline.Render(i)
+		fyne.Do(func() {
+			v.loading = false
+			if v.current != i {
+				v.show(v.current)
+				return
+			}
+			v.display(rev, data, err)
+		})
+	}()
+}
+
+// display 显示一个版本的渲染结果，渲染失败时保留上一张图像并在状态中显示错误
+func (v *timelineView) display(rev export.Revision, data []byte, err error) {
+	if err != nil {
+		log.Printf("无法渲染 %s 在 %s 中的版本: %v", logging.Path(v.timeline.File), rev.Short, err)
+		v.status.SetText(fmt.Sprintf("%s（无法渲染: %v）", rev.Label(), err))
+		return
+	}
+	v.status.SetText(fmt.Sprintf("%s — %s", rev.Label(), rev.Author))
+	v.image.Resource = fyne.NewStaticResource("timeline_"+rev.Short+".png", data)
+	v.image.Refresh()
+}
+
+// exportTimelineAnimation 把时间轴中的所有版本导出为演变动画，按保存的文件名选择格式：.gif为GIF，其他为APNG。
+// 已经在对话框中看过的版本直接使用缓存，其他版本在后台渲染
+func (ui *MainUI) exportTimelineAnimation(timeline *export.Timeline) {
+	save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, ui.window)
+			return
+		}
+		if writer == nil {
+			return // 用户取消
+		}
+		format := "apng"
+		if strings.EqualFold(filepath.Ext(writer.URI().Path()), ".gif") {
+			format = "gif"
+		}
+		go func() {
+			defer writer.Close()
+			err := timeline.WriteAnimation(writer, format, export.DefaultFrameDelay)
+			fyne.Do(func() {
+				if err != nil {
+					dialog.ShowError(fmt.Errorf("导出失败: %v", err), ui.window)
+					return
+				}
+				log.Printf("已导出演变动画: %s", logging.Path(writer.URI().Path()))
+			})
+		}()
+	}, ui.window)
+
+	base := filepath.Base(timeline.File)
+	save.SetFileName(strings.TrimSuffix(base, filepath.Ext(base)) + "-evolution.gif")
+	save.Show()
+}
@@ -4,29 +4,75 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/internal/logging"
 	"plantumlmacviewer/plantuml"
 )
 
 // MainUI 是应用程序的主UI结构
 type MainUI struct {
-	window      fyne.Window
-	files       []string
-	Tabs        *container.DocTabs          // 导出字段以便可以从外部访问
-	OpenedFiles map[string]int              // 导出字段以便可以从外部访问
-	viewers     map[string]*plantuml.Viewer // 存储查看器引用，用于管理文件监控
+	window   fyne.Window
+	files    []string
+	settings *config.Config
+	Tabs     *container.DocTabs // 导出字段以便可以从外部访问
+	tabs     *tabModel          // 每个标签页对应的文件和查看器
+	groups   *groupSidebar      // 按分组列出标签页的侧边栏
+	project  *projectPanel      // 项目模式中列出有变化的图表的侧边栏
+	outline  *outlinePanel      // 列出当前标签中元素的大纲侧边栏
+	flags    *flagsPanel        // 列出当前标签中预处理开关的侧边栏
+	renderer plantuml.Renderer  // 渲染图表，测试中可以替换为不依赖Java的实现
+	events   *event.Bus         // 打开、关闭文件和渲染的事件
+	session  *config.Session    // 保存标签的自定义标题和颜色
+
+	watchPaused    bool              // 是否暂停了所有文件的后台监控
+	viewportLocked bool              // 是否在各标签之间同步缩放和滚动位置
+	sharedViewport plantuml.Viewport // 同步模式下共享的视口
+
+	annotationTool plantuml.AnnotationTool // 当前的标注工具，对所有标签生效
+
+	closed       [][]closedTab // 最近关闭的标签页，每次关闭为一批，最后一批最新
+	closingBatch *[]closedTab  // 正在批量关闭时收集关闭的标签页
+
+	draftDir     string // 草稿的恢复目录
+	undoDir      string // 编辑区的撤销历史目录
+	scratchCount int    // 已新建的草稿数量，用于草稿标签的默认标题
+
+	rendering       map[string]bool           // 正在重新渲染的文件
+	onStatusChanged func(errors, pending int) // 渲染错误或待更新的标签数可能变化时的回调
+
+	description          string             // 最近一次通知的当前标签的文字描述
+	announcedFailure     string             // 已通知渲染出错、还没有恢复的当前标签的文件
+	onDescriptionChanged func(label string) // 当前标签的文字描述变化时的回调
+	onAnnounce           func(message string)
+
+	errorHistories map[string]*errorHistory // 每个标签的渲染错误历史，以文件路径为键
 }
 
-// NewMainUI 创建新的UI实例
-func NewMainUI(window fyne.Window, files []string) (*MainUI, error) {
+// NewMainUI 创建新的UI实例，renderer为nil时使用plantuml.DefaultRenderer，events为nil时创建新的事件总线
+func NewMainUI(window fyne.Window, files []string, settings *config.Config, renderer plantuml.Renderer, events *event.Bus) (*MainUI, error) {
+	if events == nil {
+		events = event.NewBus()
+	}
 	ui := &MainUI{
-		window:      window,
-		files:       files,
-		OpenedFiles: make(map[string]int),
-		viewers:     make(map[string]*plantuml.Viewer),
+		window:   window,
+		files:    files,
+		settings: settings,
+		renderer: renderer,
+		events:   events,
+		session:  config.NewSession(),
+		draftDir: config.DraftDir(),
+		undoDir:  config.UndoDir(),
+		tabs:     newTabModel(),
+
+		rendering:      make(map[string]bool),
+		errorHistories: make(map[string]*errorHistory),
 	}
 	return ui, nil
 }
@@ -36,76 +82,99 @@ func (ui *MainUI) InitializeUI() fyne.CanvasObject {
 	// 创建Tab容器用于显示多个PUML文件
 	ui.Tabs = container.NewDocTabs()
 	ui.Tabs.SetTabLocation(container.TabLocationTop)
+	ui.groups = newGroupSidebar(ui)
+	ui.project = newProjectPanel(ui)
+	ui.outline = newOutlinePanel(ui)
+	ui.flags = newFlagsPanel(ui)
+
+	// 关闭有未保存修改的草稿前先询问是否保存
+	ui.Tabs.CloseIntercept = ui.requestClose
+
+	// 文件变化时自动切换到对应的标签页
+	ui.events.Subscribe(func(e event.Event) {
+		ui.selectFile(e.Path)
+	}, event.FileChanged)
+
+	// 渲染出错或待更新的标签数显示在窗口标题中
+	ui.trackStatus()
+	// 当前标签渲染出错和恢复时通知读屏软件
+	ui.trackAnnouncements()
+	// 记录每个标签的渲染错误历史
+	ui.trackErrorHistory()
+
+	// 当前标签重新渲染后，源码可能已经变化，更新大纲和预处理开关；项目中的文件看到了新内容，标为已看
+	ui.events.Subscribe(func(e event.Event) {
+		if e.Path == ui.selectedFilePath() {
+			ui.refreshOutline()
+			ui.markViewed(e.Path)
+		}
+	}, event.RenderFinished, event.RenderFailed)
+
+	// 按设置以高对比度渲染、以SVG渲染、映射色盲难以区分的颜色、重试暂时性错误、轮询同步文件夹和解密age文件，在打开文件之前设置
+	plantuml.SetHighContrast(ui.settings.HighContrast)
+	plantuml.SetSVGMode(ui.settings.SVGMode)
+	plantuml.SetColorBlindSafe(ui.settings.ColorBlindSafe)
+	plantuml.SetRenderRetries(ui.settings.RenderRetries)
+	plantuml.SetSyncInterval(time.Duration(ui.settings.SyncInterval * float64(time.Second)))
+	plantuml.SetAgeIdentity(config.ExpandPath(ui.settings.AgeIdentity))
 
 	// 如果有文件参数传入，立即打开它们
 	for _, file := range ui.files {
 		ui.OpenFile(file)
 	}
 
-	// 监听标签关闭事件，从OpenedFiles中移除并停止文件监控
+	// 监听标签关闭事件，删除标签页的记录并停止文件监控
 	ui.Tabs.OnClosed = func(item *container.TabItem) {
 		log.Printf("关闭标签页: %s", item.Text)
 
-		// 查找并移除关闭的文件
-		var closedPath string
-		var closedIndex int
-
-		for path, index := range ui.OpenedFiles {
-			if index >= len(ui.Tabs.Items) {
-				// 索引已经超出范围，直接删除
-				log.Printf("删除无效的文件记录: %s, 索引: %d", path, index)
-				delete(ui.OpenedFiles, path)
-				continue
-			}
-
-			if filepath.Base(path) == item.Text || ui.Tabs.Items[index] == item {
-				closedPath = path
-				closedIndex = index
-
-				// 停止文件监控
-				if viewer, exists := ui.viewers[path]; exists {
-					log.Printf("停止对文件 %s 的监控", path)
-					viewer.StopMonitoring()
-					delete(ui.viewers, path)
-				}
-
-				break
-			}
+		closed := ui.tabs.remove(item)
+		if closed == nil {
+			log.Printf("警告: 无法找到被关闭的标签对应的文件记录")
+			return
 		}
 
-		// 如果找到了被关闭的标签对应的文件
-		if closedPath != "" {
-			log.Printf("从映射中删除文件: %s, 索引: %d", closedPath, closedIndex)
-			delete(ui.OpenedFiles, closedPath)
-
-			// 更新其他文件的索引
-			for otherPath, otherIndex := range ui.OpenedFiles {
-				if otherIndex > closedIndex {
-					ui.OpenedFiles[otherPath] = otherIndex - 1
-					log.Printf("更新文件索引: %s, 从 %d 到 %d", otherPath, otherIndex, otherIndex-1)
-				}
-			}
-		} else {
-			log.Printf("警告: 无法找到被关闭的标签对应的文件记录")
-			// 记录当前所有标签和文件映射的状态，用于调试
-			log.Printf("当前标签数量: %d", len(ui.Tabs.Items))
-			for i, tab := range ui.Tabs.Items {
-				log.Printf("标签[%d]: %s", i, tab.Text)
-			}
-			log.Printf("当前文件映射:")
-			for path, idx := range ui.OpenedFiles {
-				log.Printf("  %s -> %d", path, idx)
-			}
+		log.Printf("停止对文件 %s 的监控", logging.Path(closed.path))
+		closed.viewer.Close()
+		stopSchedule(closed)
+		if closed.follow != nil {
+			closed.follow.Stop()
+		}
+		if closed.scratch != nil {
+			discardScratch(closed.scratch)
 		}
+		if !closed.snapshot {
+			ui.events.Publish(event.Event{Type: event.TabClosed, Path: closed.path})
+		}
+		ui.rememberClosed(closed)
+		ui.refreshGroups()
+		ui.refreshOutline()
+		ui.UpdateTitle()
 	}
 
 	// 监听标签选择事件，更新窗口标题
 	ui.Tabs.OnSelected = func(item *container.TabItem) {
-		ui.window.SetTitle(fmt.Sprintf("PlantUML Viewer - %s", item.Text))
+		ui.UpdateTitle()
+
+		// 锁定视口时，新选中的标签沿用共享的缩放和滚动位置，便于来回切换对比
+		if ui.viewportLocked {
+			if viewer := ui.selectedViewer(); viewer != nil {
+				viewer.SetViewport(ui.sharedViewport)
+			}
+		}
+		ui.refreshOutline()
+		ui.announceSelection()
+		ui.markViewed(ui.selectedFilePath())
 	}
 
-	// 直接返回tabs容器作为主布局
-	return ui.Tabs
+	// 标签栏上方叠加悬停缩略图层
+	thumbnails := newTabThumbnails(ui)
+	tabs := container.NewStack(ui.Tabs, container.NewBorder(thumbnails, nil, nil, nil), thumbnails.layer)
+
+	// 有分组时在左侧显示分组侧边栏，打开项目时在它左边显示项目侧边栏；按设置在右侧显示大纲，源码中有预处理开关时在大纲左边显示开关
+	ui.refreshGroups()
+	ui.SetOutlineVisible(ui.settings.ShowOutline)
+	ui.flags.refresh()
+	return container.NewBorder(nil, nil, container.NewHBox(ui.project.box, ui.groups.box), container.NewHBox(ui.flags.box, ui.outline.box), tabs)
 }
 
 // truncateFileName 截断过长的文件名，确保标签页不会过长
@@ -128,134 +197,367 @@ func truncateFileName(fileName string, maxLength int) string {
 	return baseName[:keep] + "..." + ext
 }
 
-// OpenFile 打开文件并创建新标签页，如果文件已打开则切换到对应标签页
-func (ui *MainUI) OpenFile(filePath string) {
-	// 获取绝对路径
-	absPath, err := filepath.Abs(filePath)
-	if err == nil {
-		filePath = absPath
-	}
+// OpenOptions 是打开文件时的选项，零值为默认行为：选中文件的标签，保持原来显示的页
+type OpenOptions struct {
+	Page     int    // 显示多页图表的第几页（从1开始），0表示不改变，新打开的文件显示第一页
+	NoSelect bool   // 不选中文件的标签，在后台打开或刷新，不打断正在查看的标签
+	Group    string // 新打开的文件没有保存过分组时加入的分组，已打开的标签和用户选择的分组不变
+}
 
-	// 检查文件是否已打开
-	if tabIndex, exists := ui.OpenedFiles[filePath]; exists {
-		// 文件已经打开，检查索引是否有效
-		if tabIndex < 0 || tabIndex >= len(ui.Tabs.Items) {
-			log.Printf("警告: 文件 %s 的标签索引 %d 无效，当前标签数量: %d", filePath, tabIndex, len(ui.Tabs.Items))
-			// 从OpenedFiles中删除无效的记录
-			delete(ui.OpenedFiles, filePath)
-			// 重新打开文件
-			ui.OpenFile(filePath)
-			return
-		}
+// OpenFile 打开文件并创建新标签页，如果文件已打开则切换到对应标签页并重新渲染。
+// 返回打开或渲染时的错误，渲染失败时标签页仍会打开并显示错误信息
+func (ui *MainUI) OpenFile(filePath string) error {
+	return ui.OpenFileWith(filePath, OpenOptions{})
+}
 
-		// 文件已经打开，切换到对应标签
-		ui.Tabs.SelectIndex(tabIndex)
+// OpenFileWith 与OpenFile相同，但按opts选择显示的页以及是否选中标签
+func (ui *MainUI) OpenFileWith(filePath string, opts OpenOptions) error {
+	// 获取解析了符号链接的绝对路径，同一个文件经不同路径打开时使用同一个标签页
+	filePath = canonicalPath(filePath)
 
-		// 立即刷新当前标签内容，确保显示最新内容
-		log.Printf("正在刷新已打开的文件: %s", filePath)
+	// SVG和PNG不是PlantUML文件，嵌入了源码时询问是否导入
+	if isImportableImage(filePath) {
+		return ui.offerImport(filePath)
+	}
 
-		// 停止旧的查看器监控
-		if oldViewer, exists := ui.viewers[filePath]; exists {
-			oldViewer.StopMonitoring()
-			delete(ui.viewers, filePath)
+	// 文件已经打开，切换到对应标签并重新渲染，确保显示最新内容
+	if t := ui.tabs.byFile(filePath); t != nil {
+		if !opts.NoSelect {
+			ui.Tabs.Select(t.item)
 		}
-
-		// 重新创建PlantUML查看器
-		newViewer, err := plantuml.NewViewer(filePath)
-		if err == nil {
-			// 设置文件变化回调，自动切换到这个标签页
-			newViewer.SetOnFileChanged(func() {
-				// 获取当前的索引，而不是使用闭包中的tabIndex
-				currentIndex, exists := ui.OpenedFiles[filePath]
-				if exists && currentIndex >= 0 && currentIndex < len(ui.Tabs.Items) {
-					log.Printf("检测到文件变化，切换到标签页: %s", filepath.Base(filePath))
-					ui.Tabs.SelectIndex(currentIndex)
-				} else {
-					log.Printf("检测到文件变化，但标签索引无效: %d，当前标签数量: %d", currentIndex, len(ui.Tabs.Items))
-				}
-			})
-
-			// 存储新的查看器引用
-			ui.viewers[filePath] = newViewer
-
-			// 成功创建新查看器，替换现有内容
-			newContent := container.NewScroll(newViewer.GetCanvas())
-			ui.Tabs.Items[tabIndex].Content = newContent
-			ui.Tabs.Refresh() // 刷新整个标签容器
-			log.Printf("已成功刷新标签内容: %s", filePath)
+		if opts.Page > 0 {
+			t.page = opts.Page
 		}
-
-		return
+		log.Printf("正在刷新已打开的文件: %s", logging.Path(t.path))
+		return ui.replaceViewer(t, t.path)
 	}
 
-	// 创建PlantUML查看器
-	viewer, err := plantuml.NewViewer(filePath)
+	// 创建PlantUML查看器，先恢复上次为文件指定的编码、布局引擎、额外参数、预处理开关和图像格式
+	plantuml.SetFileCharset(filePath, ui.session.Charset(filePath))
+	plantuml.SetFileLayout(filePath, ui.session.Layout(filePath))
+	ui.restoreFileArgs(filePath)
+	plantuml.SetFileFlags(filePath, ui.session.FileFlags(filePath))
+	plantuml.SetFileImageFormat(filePath, ui.session.ImageFormat(filePath))
+	viewer, err := plantuml.NewViewer(filePath, ui.renderer, ui.events)
 	if err != nil {
 		log.Printf("无法创建PlantUML查看器: %v", err)
-		return
+		return err
 	}
 
-	// 设置文件变化回调，自动切换到这个标签页
-	viewer.SetOnFileChanged(func() {
-		// 获取当前的索引，而不是使用预计算的索引
-		currentIndex, exists := ui.OpenedFiles[filePath]
-		if exists && currentIndex >= 0 && currentIndex < len(ui.Tabs.Items) {
-			log.Printf("检测到文件变化，切换到标签页: %s", filepath.Base(filePath))
-			ui.Tabs.SelectIndex(currentIndex)
-		} else {
-			log.Printf("检测到文件变化，但标签索引无效: %d，当前标签数量: %d", currentIndex, len(ui.Tabs.Items))
-		}
-	})
-
-	// 存储查看器引用
-	ui.viewers[filePath] = viewer
+	// 设置查看器的回调
+	ui.wireViewer(viewer)
+	if opts.Page > 1 {
+		viewer.SetPage(opts.Page)
+	}
 
 	// 创建标签项
 	fileName := filepath.Base(filePath)
 	// 截断过长的文件名
 	displayName := truncateFileName(fileName, 30) // 最多显示30个字符
 
-	// 创建标签内容
-	content := container.NewScroll(viewer.GetCanvas())
-
-	// 添加新标签
-	tab := container.NewTabItem(displayName, content)
-	ui.Tabs.Append(tab)
-
-	// 记录文件路径和对应的tab索引
-	ui.OpenedFiles[filePath] = len(ui.Tabs.Items) - 1
+	// 先记录标签页，再添加到标签容器，添加时触发的选择事件就能找到对应的查看器
+	item := container.NewTabItem(displayName, nil)
+	t := ui.tabs.add(item, filePath, viewer)
+	item.Content = ui.tabContent(t)
+	t.title = displayName
+	t.page = opts.Page
+	t.style = ui.session.TabStyle(filePath)
+	if t.style.Group == "" {
+		t.style.Group = opts.Group
+	}
+	ui.startSchedule(t, ui.session.RefreshInterval(filePath))
+	ui.applyTabStyle(t)
+	ui.Tabs.Append(item)
+	ui.refreshGroups()
 
 	// 选择新标签
-	ui.Tabs.SelectIndex(len(ui.Tabs.Items) - 1)
+	if !opts.NoSelect {
+		ui.Tabs.Select(item)
+	}
 
 	// 更新窗口标题
-	ui.window.SetTitle(fmt.Sprintf("PlantUML Viewer - %s", fileName))
+	ui.UpdateTitle()
+
+	ui.events.Publish(event.Event{Type: event.FileOpened, Path: filePath})
+	return viewer.RenderError()
+}
+
+// replaceViewer 停止标签原来的查看器，用filePath的新查看器替换标签内容，返回打开或渲染时的错误。
+// 虚拟文件没有对应的文件，用已有的内容重新渲染
+func (ui *MainUI) replaceViewer(t *tab, filePath string) error {
+	if t.virtual {
+		err := t.viewer.SetSource(t.viewer.Source())
+		ui.UpdateTitle()
+		return err
+	}
+
+	// 停止旧的查看器监控和正在进行的渲染
+	t.viewer.Close()
+
+	// 重新创建PlantUML查看器
+	newViewer, err := plantuml.NewViewer(filePath, ui.renderer, ui.events)
+	if err != nil {
+		log.Printf("无法创建PlantUML查看器: %v", err)
+		return err
+	}
+
+	// 设置查看器的回调
+	ui.wireViewer(newViewer)
+	if t.page > 1 {
+		newViewer.SetPage(t.page)
+	}
+
+	// 成功创建新查看器，替换现有内容
+	t.path = filePath
+	t.viewer = newViewer
+	t.item.Content = ui.tabContent(t)
+	ui.Tabs.Refresh() // 刷新整个标签容器
+	ui.UpdateTitle()  // 新查看器的渲染结果在替换前发布，此时才计入状态
+	log.Printf("已成功刷新标签内容: %s", logging.Path(filePath))
+
+	return newViewer.RenderError()
+}
+
+// DuplicateAsSnapshot 在当前标签后面打开它的快照标签。快照冻结在当前的图像，
+// 不随文件变化更新，便于编辑文件时保留修改前的图表进行对比
+func (ui *MainUI) DuplicateAsSnapshot() {
+	current := ui.selectedTab()
+	if current == nil {
+		return
+	}
+
+	snapshot, err := current.viewer.Snapshot()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("无法创建快照: %v", err), ui.window)
+		return
+	}
+	ui.wireViewer(snapshot)
+
+	title := fmt.Sprintf("%s（快照 %s）", truncateFileName(filepath.Base(current.path), 30), time.Now().Format("15:04:05"))
+	item := container.NewTabItem(title, container.NewScroll(snapshot.GetCanvas()))
+	t := ui.tabs.add(item, current.path, snapshot)
+	t.snapshot = true
+	t.title = title
+	// 快照沿用原标签的颜色和分组，便于看出对应关系
+	t.style = config.TabStyle{Color: current.style.Color, Group: current.style.Group}
+	ui.applyTabStyle(t)
+
+	// 插入到原标签的后面
+	items := make([]*container.TabItem, 0, len(ui.Tabs.Items)+1)
+	for _, existing := range ui.Tabs.Items {
+		items = append(items, existing)
+		if existing == current.item {
+			items = append(items, item)
+		}
+	}
+	ui.Tabs.SetItems(items)
+	ui.Tabs.Select(item)
+	ui.refreshGroups()
+	log.Printf("已创建快照标签: %s", title)
+}
+
+// wireViewer 为查看器设置轻扫手势和标注等回调
+func (ui *MainUI) wireViewer(viewer *plantuml.Viewer) {
+	// 关闭了后台监控时，只在窗口重新获得焦点等时机按需刷新
+	if !ui.settings.WatchFiles {
+		viewer.StopMonitoring()
+	}
+	viewer.SetWatchPaused(ui.watchPaused)
+
+	// 触控板水平轻扫切换标签页
+	viewer.SetOnSwipe(ui.handleSwipe)
+
+	// 标注工具对所有标签生效，添加文字说明时弹出输入框
+	viewer.SetAnnotationTool(ui.annotationTool)
+	viewer.SetOnNoteRequested(ui.requestNoteText)
+	viewer.SetOnUnlockRequested(ui.requestKey)
+	viewer.SetMeasureDPI(ui.settings.MeasureDPI)
+	viewer.SetOnMeasured(ui.showMeasurement)
+
+	// 超时或Graphviz出错时换用其他布局引擎重试，记住该文件的选择
+	viewer.SetOnLayoutRetry(func(engine string) {
+		if t := ui.tabs.byViewer(viewer); t != nil {
+			ui.setLayout(t, engine)
+		}
+	})
+
+	// 按住Cmd点击图像中的元素时跳到定义它的行
+	viewer.SetOnSourceRequested(func(line int) {
+		if t := ui.tabs.byViewer(viewer); t != nil {
+			ui.showSourceLine(t, line)
+		}
+	})
+
+	// 记录当前标签的视口，锁定时同步到其他标签
+	viewer.SetOnViewportChanged(func(vp plantuml.Viewport) {
+		if ui.viewportLocked && ui.selectedViewer() == viewer {
+			ui.sharedViewport = vp
+		}
+	})
 }
 
-// RefreshCurrentTab 刷新当前选中的标签页
-// 即使不再支持F5刷新，我们保留此方法，以便需要时可以通过程序逻辑刷新
+// selectFile 切换到文件对应的标签页，用于文件变化时
+func (ui *MainUI) selectFile(filePath string) {
+	t := ui.tabs.byPath(filePath)
+	if t == nil {
+		log.Printf("检测到文件变化，但文件没有打开的标签页: %s", logging.Path(filePath))
+		return
+	}
+	log.Printf("检测到文件变化，切换到标签页: %s", logging.Path(filePath))
+	ui.Tabs.Select(t.item)
+}
+
+// RefreshCurrentTab 立即重新渲染当前选中的标签页，用于自动刷新不及时的网络文件等场合
 func (ui *MainUI) RefreshCurrentTab() {
 	if ui.Tabs == nil || len(ui.Tabs.Items) == 0 {
 		return
 	}
 
-	currentIndex := ui.Tabs.SelectedIndex()
-	// 查找当前选中的文件路径
-	var currentFilePath string
-	for path, index := range ui.OpenedFiles {
-		if index == currentIndex {
-			currentFilePath = path
-			break
-		}
+	if t := ui.selectedTab(); t != nil && t.virtual {
+		ui.replaceViewer(t, t.path)
+		return
 	}
+	currentFilePath := ui.selectedFilePath()
 
 	// 直接调用OpenFile方法来刷新内容
 	if currentFilePath != "" {
-		log.Printf("自动刷新当前标签页文件: %s", currentFilePath)
+		log.Printf("自动刷新当前标签页文件: %s", logging.Path(currentFilePath))
 		ui.OpenFile(currentFilePath)
 	}
 }
 
+// selectedFilePath 返回当前选中标签对应的文件路径，没有时返回空字符串
+func (ui *MainUI) selectedFilePath() string {
+	if t := ui.selectedTab(); t != nil {
+		return t.path
+	}
+	return ""
+}
+
+// selectedViewer 返回当前选中标签的查看器
+func (ui *MainUI) selectedViewer() *plantuml.Viewer {
+	if t := ui.selectedTab(); t != nil {
+		return t.viewer
+	}
+	return nil
+}
+
+// SetViewportLocked 设置是否在各标签之间同步缩放和滚动位置
+func (ui *MainUI) SetViewportLocked(locked bool) {
+	ui.viewportLocked = locked
+	if !locked {
+		return
+	}
+	// 以当前标签的视口作为共享视口
+	if viewer := ui.selectedViewer(); viewer != nil {
+		ui.sharedViewport = viewer.Viewport()
+	}
+	log.Printf("已锁定各标签的缩放和滚动位置")
+}
+
+// ViewportLocked 返回是否在各标签之间同步缩放和滚动位置
+func (ui *MainUI) ViewportLocked() bool {
+	return ui.viewportLocked
+}
+
+// RefreshChangedFiles 重新检查所有已打开的文件，只重新渲染内容有变化的文件。暂停监控期间不做任何事
+func (ui *MainUI) RefreshChangedFiles() {
+	if ui.watchPaused {
+		log.Println("已暂停监控文件变化，不检查文件")
+		return
+	}
+	for _, t := range ui.ordered() {
+		if t.viewer.RefreshIfChanged() {
+			log.Printf("已刷新有变化的文件: %s", logging.Path(t.path))
+		}
+	}
+}
+
+// SetWatchFiles 开启或关闭所有已打开文件的后台监控
+func (ui *MainUI) SetWatchFiles(watch bool) {
+	ui.settings.WatchFiles = watch
+	if watch {
+		// 重新创建查看器以恢复监控，完成后恢复原来选中的标签
+		selected := ui.Tabs.Selected()
+		for _, path := range ui.OpenedFiles() {
+			ui.OpenFile(path)
+		}
+		if selected != nil {
+			ui.Tabs.Select(selected)
+		}
+		return
+	}
+	for _, t := range ui.ordered() {
+		t.viewer.StopMonitoring()
+	}
+}
+
+// SetHighContrast 开启或关闭高对比度渲染并在后台重新渲染所有标签，快照标签保持不变。只影响查看，导出的文件不变
+func (ui *MainUI) SetHighContrast(on bool) {
+	ui.settings.HighContrast = on
+	plantuml.SetHighContrast(on)
+	ui.rerenderAll()
+}
+
+// rerenderAll 在后台重新渲染所有标签，用于改变了渲染方式的设置，快照标签保持不变
+func (ui *MainUI) rerenderAll() {
+	for _, t := range ui.ordered() {
+		t.viewer.Rerender()
+	}
+}
+
+// SetColorBlindSafe 开启或关闭色盲友好的颜色映射并在后台重新渲染所有标签，快照标签保持不变。只影响查看，导出的文件不变
+func (ui *MainUI) SetColorBlindSafe(on bool) {
+	ui.settings.ColorBlindSafe = on
+	plantuml.SetColorBlindSafe(on)
+	ui.rerenderAll()
+}
+
+// SetFont 设置图表使用的字体和Java的默认编码并在后台重新渲染所有标签，快照标签保持不变。查看和导出都会使用
+func (ui *MainUI) SetFont(name, encoding string) {
+	ui.settings.FontName = name
+	ui.settings.JavaEncoding = encoding
+	plantuml.SetFont(name, encoding)
+	ui.rerenderAll()
+}
+
+// PauseWatching 暂停所有文件的后台监控，期间的变化在ResumeWatching时统一处理，
+// 适合在git操作或代码生成等会大量修改文件的过程中使用
+func (ui *MainUI) PauseWatching() {
+	ui.watchPaused = true
+	if ui.project != nil && ui.project.tree != nil {
+		ui.project.tree.SetPaused(true)
+	}
+	for _, t := range ui.ordered() {
+		t.viewer.SetWatchPaused(true)
+		if t.follow != nil {
+			t.follow.SetPaused(true)
+		}
+	}
+	log.Println("已暂停监控文件变化")
+}
+
+// ResumeWatching 恢复后台监控，并立即重新渲染暂停期间有变化的文件
+func (ui *MainUI) ResumeWatching() {
+	ui.watchPaused = false
+	if ui.project != nil && ui.project.tree != nil {
+		ui.project.tree.SetPaused(false)
+	}
+	for _, t := range ui.ordered() {
+		t.viewer.SetWatchPaused(false)
+		if t.follow != nil {
+			t.follow.SetPaused(false)
+		}
+	}
+	log.Println("已恢复监控文件变化")
+	ui.RefreshChangedFiles()
+}
+
+// WatchingPaused 返回是否暂停了文件的后台监控
+func (ui *MainUI) WatchingPaused() bool {
+	return ui.watchPaused
+}
+
 // NextTab 切换到下一个标签页
 func (ui *MainUI) NextTab() {
 	if ui.Tabs == nil || len(ui.Tabs.Items) <= 1 {
@@ -278,20 +580,35 @@ func (ui *MainUI) PrevTab() {
 	ui.Tabs.SelectIndex(prevIndex)
 }
 
+// handleSwipe 处理触控板水平轻扫手势，与Safari一致：向左轻扫到下一个标签页，向右轻扫到上一个标签页
+func (ui *MainUI) handleSwipe(direction plantuml.SwipeDirection) {
+	switch direction {
+	case plantuml.SwipeNext:
+		ui.NextTab()
+	case plantuml.SwipePrev:
+		ui.PrevTab()
+	}
+}
+
 // GetContent 返回UI内容
 func (ui *MainUI) GetContent() fyne.CanvasObject {
 	return ui.InitializeUI()
 }
 
-// StopAllMonitoring 停止所有文件监控
+// StopAllMonitoring 停止所有文件监控，并结束正在进行的渲染
 func (ui *MainUI) StopAllMonitoring() {
 	log.Println("停止所有文件监控...")
-	for path, viewer := range ui.viewers {
-		log.Printf("停止对文件 %s 的监控", path)
-		viewer.StopMonitoring()
+	for _, t := range ui.ordered() {
+		log.Printf("停止对文件 %s 的监控", logging.Path(t.path))
+		t.viewer.Close()
+		stopSchedule(t)
+		if t.follow != nil {
+			t.follow.Stop()
+		}
+	}
+	if ui.project != nil {
+		ui.stopProject()
 	}
-	// 清空查看器映射
-	ui.viewers = make(map[string]*plantuml.Viewer)
 }
 
 // CloseCurrentTab 关闭当前选中的标签页
@@ -305,6 +622,20 @@ func (ui *MainUI) CloseCurrentTab() {
 		return
 	}
 
-	// 让标签容器处理关闭逻辑（会触发OnClosed回调）
-	ui.Tabs.RemoveIndex(currentIndex)
+	ui.requestClose(ui.Tabs.Items[currentIndex])
+}
+
+// closeTab 关闭标签页，与点击标签上的关闭按钮效果相同
+func (ui *MainUI) closeTab(item *container.TabItem) {
+	for i, existing := range ui.Tabs.Items {
+		if existing != item {
+			continue
+		}
+		// RemoveIndex不会触发OnClosed回调，需要手动调用以清理文件记录和监控
+		ui.Tabs.RemoveIndex(i)
+		if ui.Tabs.OnClosed != nil {
+			ui.Tabs.OnClosed(item)
+		}
+		return
+	}
 }
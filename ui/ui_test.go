@@ -0,0 +1,1641 @@
+package ui
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/test"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/c4"
+	"plantumlmacviewer/config"
+	"plantumlmacviewer/export"
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/internal/samples"
+	"plantumlmacviewer/outline"
+	"plantumlmacviewer/plantuml"
+	"plantumlmacviewer/plantuml/plantumltest"
+)
+
+// newTestUI 创建使用假渲染器的MainUI，并打开files
+func newTestUI(t *testing.T, renderer *plantumltest.Renderer, files ...string) *MainUI {
+	return newTestUIWithEvents(t, renderer, nil, files...)
+}
+
+// newTestUIWithEvents 与newTestUI相同，但把事件发布到events
+func newTestUIWithEvents(t *testing.T, renderer *plantumltest.Renderer, events *event.Bus, files ...string) *MainUI {
+	t.Helper()
+	test.NewTempApp(t)
+	window := test.NewWindow(nil)
+	t.Cleanup(window.Close)
+
+	settings := config.Default()
+	settings.WatchFiles = false
+	ui, err := NewMainUI(window, files, settings, renderer, events)
+	if err != nil {
+		t.Fatalf("NewMainUI: %v", err)
+	}
+	ui.undoDir = t.TempDir()
+	window.SetContent(ui.GetContent())
+	t.Cleanup(ui.StopAllMonitoring)
+	return ui
+}
+
+// writeFiles 在临时目录中创建PlantUML文件，返回它们解析了符号链接的路径
+func writeFiles(t *testing.T, names ...string) []string {
+	t.Helper()
+	// macOS的临时目录位于符号链接/var下，打开文件时会被解析为/private/var
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("@startuml\nA -> B\n@enduml\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// findButton 在容器中查找文字为text的按钮
+func findButton(obj fyne.CanvasObject, text string) *widget.Button {
+	switch o := obj.(type) {
+	case *widget.Button:
+		if o.Text == text {
+			return o
+		}
+	case *fyne.Container:
+		for _, child := range o.Objects {
+			if button := findButton(child, text); button != nil {
+				return button
+			}
+		}
+	}
+	return nil
+}
+
+// findLabel 在对象树中查找文字包含text的标签
+func findLabel(obj fyne.CanvasObject, text string) *widget.Label {
+	if label, ok := obj.(*widget.Label); ok && strings.Contains(label.Text, text) {
+		return label
+	}
+	var children []fyne.CanvasObject
+	switch o := obj.(type) {
+	case *fyne.Container:
+		children = o.Objects
+	case fyne.Widget:
+		children = test.WidgetRenderer(o).Objects()
+	}
+	for _, child := range children {
+		if label := findLabel(child, text); label != nil {
+			return label
+		}
+	}
+	return nil
+}
+
+func TestOpenFilesCreatesTabs(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml")
+	ui := newTestUI(t, renderer, files...)
+
+	if len(ui.Tabs.Items) != 2 {
+		t.Fatalf("应有2个标签页，实际为 %d", len(ui.Tabs.Items))
+	}
+	if got := ui.OpenedFiles(); !reflect.DeepEqual(got, files) {
+		t.Errorf("OpenedFiles() = %v，期望 %v", got, files)
+	}
+	for _, file := range files {
+		if renderer.Calls(file) != 1 {
+			t.Errorf("%s 渲染了 %d 次，期望 1 次", file, renderer.Calls(file))
+		}
+	}
+	if ui.Tabs.SelectedIndex() != 1 {
+		t.Errorf("应选中最后打开的标签，实际选中 %d", ui.Tabs.SelectedIndex())
+	}
+	if ui.selectedViewer().Image() == nil {
+		t.Error("渲染成功后应显示图像")
+	}
+}
+
+func TestReopenFileSelectsExistingTab(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml")
+	ui := newTestUI(t, renderer, files...)
+
+	if err := ui.OpenFile(files[0]); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if len(ui.Tabs.Items) != 2 {
+		t.Fatalf("重新打开不应新增标签页，实际有 %d 个", len(ui.Tabs.Items))
+	}
+	if ui.Tabs.SelectedIndex() != 0 {
+		t.Errorf("应切换到已打开的标签，实际选中 %d", ui.Tabs.SelectedIndex())
+	}
+	if renderer.Calls(files[0]) != 2 {
+		t.Errorf("重新打开应重新渲染，渲染了 %d 次", renderer.Calls(files[0]))
+	}
+}
+
+func TestOpenSameFileThroughLinks(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml")
+	ui := newTestUI(t, renderer, files...)
+
+	dir := filepath.Dir(files[0])
+	symlink := filepath.Join(dir, "link.puml")
+	if err := os.Symlink(files[0], symlink); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+	hardlink := filepath.Join(dir, "hard.puml")
+	if err := os.Link(files[0], hardlink); err != nil {
+		t.Skipf("无法创建硬链接: %v", err)
+	}
+	dirLink := filepath.Join(t.TempDir(), "dir")
+	if err := os.Symlink(dir, dirLink); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+
+	for _, path := range []string{symlink, hardlink, filepath.Join(dirLink, "a.puml"), filepath.Join(dir, ".", "a.puml")} {
+		if err := ui.OpenFile(path); err != nil {
+			t.Fatalf("OpenFile(%s): %v", path, err)
+		}
+		if got := ui.OpenedFiles(); !reflect.DeepEqual(got, files) {
+			t.Fatalf("通过 %s 打开同一个文件不应新增标签页，OpenedFiles() = %v", path, got)
+		}
+	}
+}
+
+func TestCloseCurrentTab(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml", "c.puml")
+	ui := newTestUI(t, renderer, files...)
+
+	// 关闭最后一个标签
+	ui.CloseCurrentTab()
+	if len(ui.Tabs.Items) != 2 {
+		t.Fatalf("关闭后应剩2个标签页，实际有 %d 个", len(ui.Tabs.Items))
+	}
+	if got := ui.OpenedFiles(); !reflect.DeepEqual(got, files[:2]) {
+		t.Errorf("OpenedFiles() = %v，期望 %v", got, files[:2])
+	}
+
+	// 关闭第一个标签
+	ui.Tabs.SelectIndex(0)
+	ui.CloseCurrentTab()
+	if len(ui.Tabs.Items) != 1 {
+		t.Fatalf("关闭后应剩1个标签页，实际有 %d 个", len(ui.Tabs.Items))
+	}
+	if got := ui.OpenedFiles(); !reflect.DeepEqual(got, files[1:2]) {
+		t.Errorf("OpenedFiles() = %v，期望 %v", got, files[1:2])
+	}
+	if ui.tabs.len() != 1 {
+		t.Errorf("应只剩1个标签页记录，实际有 %d 个", ui.tabs.len())
+	}
+}
+
+func TestCloseTabWithTruncatedName(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a-very-long-diagram-file-name-that-gets-truncated.puml", "b.puml")
+	ui := newTestUI(t, renderer, files...)
+
+	ui.Tabs.SelectIndex(0)
+	ui.CloseCurrentTab()
+	if got := ui.OpenedFiles(); !reflect.DeepEqual(got, files[1:]) {
+		t.Errorf("OpenedFiles() = %v，期望 %v", got, files[1:])
+	}
+}
+
+func TestTabsSurviveReordering(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml", "c.puml")
+	ui := newTestUI(t, renderer, files...)
+
+	// 调换标签顺序：c, a, b
+	items := ui.Tabs.Items
+	ui.Tabs.SetItems([]*container.TabItem{items[2], items[0], items[1]})
+	if got, want := ui.OpenedFiles(), []string{files[2], files[0], files[1]}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("OpenedFiles() = %v，期望 %v", got, want)
+	}
+
+	// 重新打开a应选中它现在所在的位置
+	if err := ui.OpenFile(files[0]); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if ui.Tabs.SelectedIndex() != 1 || ui.selectedFilePath() != files[0] {
+		t.Errorf("应选中索引1的 %s，实际选中 %d (%s)", files[0], ui.Tabs.SelectedIndex(), ui.selectedFilePath())
+	}
+
+	ui.CloseCurrentTab()
+	if got, want := ui.OpenedFiles(), []string{files[2], files[1]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OpenedFiles() = %v，期望 %v", got, want)
+	}
+}
+
+func TestOpenFileWithOptions(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml", "c.puml")
+	renderer.SetPages(files[1], 3)
+	renderer.SetPages(files[2], 2)
+	ui := newTestUI(t, renderer, files[0])
+
+	// 在后台打开第2页，不切换标签
+	if err := ui.OpenFileWith(files[1], OpenOptions{Page: 2, NoSelect: true}); err != nil {
+		t.Fatalf("OpenFileWith: %v", err)
+	}
+	if ui.selectedFilePath() != files[0] {
+		t.Errorf("NoSelect时不应切换标签，实际选中 %s", ui.selectedFilePath())
+	}
+	b := ui.tabs.byFile(files[1])
+	if b == nil {
+		t.Fatalf("%s 应已在标签中打开", files[1])
+	}
+	if got := b.viewer.ImageSize().Width; got != 8 {
+		t.Errorf("应显示第2页（宽度8），实际宽度 %v", got)
+	}
+
+	// 刷新已打开的文件时保持显示的页
+	if err := ui.OpenFile(files[1]); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if ui.selectedFilePath() != files[1] {
+		t.Errorf("默认应切换到 %s，实际选中 %s", files[1], ui.selectedFilePath())
+	}
+	if got := ui.tabs.byFile(files[1]).viewer.ImageSize().Width; got != 8 {
+		t.Errorf("刷新后应仍显示第2页（宽度8），实际宽度 %v", got)
+	}
+
+	// 改为第3页
+	if err := ui.OpenFileWith(files[1], OpenOptions{Page: 3}); err != nil {
+		t.Fatalf("OpenFileWith: %v", err)
+	}
+	if got := ui.tabs.byFile(files[1]).viewer.ImageSize().Width; got != 12 {
+		t.Errorf("应显示第3页（宽度12），实际宽度 %v", got)
+	}
+
+	// 页码超出范围时标签仍会打开并显示错误
+	if err := ui.OpenFileWith(files[2], OpenOptions{Page: 5}); err == nil {
+		t.Error("页码超出范围时应返回错误")
+	}
+	if ui.tabs.byFile(files[2]) == nil {
+		t.Errorf("%s 应已在标签中打开", files[2])
+	}
+}
+
+func TestRevealFileAndRenderError(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml", "c.puml")
+	renderer.SetError(files[1], &plantuml.RenderError{Line: 2, Output: "Error line 2 in file"})
+	ui := newTestUI(t, renderer, files[:2]...)
+
+	if err := ui.RevealFile(files[1]); err != nil || ui.selectedFilePath() != files[1] {
+		t.Errorf("RevealFile应切换到 %s，实际选中 %s (%v)", files[1], ui.selectedFilePath(), err)
+	}
+	if err := ui.RevealFile(files[2]); err == nil {
+		t.Error("没有打开的文件应返回错误")
+	}
+
+	if open, err := ui.FileRenderError(files[0]); !open || err != nil {
+		t.Errorf("%s 应已打开且没有错误: %v, %v", files[0], open, err)
+	}
+	if open, err := ui.FileRenderError(files[1]); !open || plantuml.ErrorLine(err) != 2 {
+		t.Errorf("%s 应报告第2行的错误: %v, %v", files[1], open, err)
+	}
+	if open, _ := ui.FileRenderError(files[2]); open {
+		t.Errorf("%s 没有打开", files[2])
+	}
+}
+
+func TestRefreshCurrentTabRerenders(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml")
+	ui := newTestUI(t, renderer, files...)
+
+	ui.RefreshCurrentTab()
+	if renderer.Calls(files[0]) != 2 {
+		t.Errorf("刷新后应重新渲染，渲染了 %d 次", renderer.Calls(files[0]))
+	}
+	if len(ui.Tabs.Items) != 1 {
+		t.Errorf("刷新不应新增标签页，实际有 %d 个", len(ui.Tabs.Items))
+	}
+}
+
+func TestRenderErrorIsDisplayed(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "bad.puml")
+	renderer.SetError(files[0], &plantuml.RenderError{Line: 3, Output: "Error line 3 in file"})
+	ui := newTestUI(t, renderer)
+
+	err := ui.OpenFile(files[0])
+	if plantuml.ErrorLine(err) != 3 {
+		t.Fatalf("OpenFile应返回第3行的渲染错误，得到 %v", err)
+	}
+	if len(ui.Tabs.Items) != 1 {
+		t.Fatalf("渲染失败时标签页仍应打开，实际有 %d 个", len(ui.Tabs.Items))
+	}
+	if findLabel(ui.Tabs.Items[0].Content, "无法渲染PlantUML图表") == nil {
+		t.Error("标签页中应显示渲染错误信息")
+	}
+
+	// 修复后刷新，错误信息应消失
+	renderer.SetError(files[0], nil)
+	if err := ui.OpenFile(files[0]); err != nil {
+		t.Fatalf("修复后OpenFile: %v", err)
+	}
+	if findLabel(ui.Tabs.Items[0].Content, "无法渲染PlantUML图表") != nil {
+		t.Error("渲染成功后不应再显示错误信息")
+	}
+}
+
+func TestEventsArePublished(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "bad.puml")
+	renderer.SetError(files[1], &plantuml.RenderError{Line: 1})
+
+	events := event.NewBus()
+	var got []string
+	events.Subscribe(func(e event.Event) {
+		got = append(got, e.Type.String()+" "+filepath.Base(e.Path))
+	})
+	ui := newTestUIWithEvents(t, renderer, events, files...)
+	ui.CloseCurrentTab()
+
+	want := []string{
+		"RenderStarted a.puml",
+		"RenderFinished a.puml",
+		"FileOpened a.puml",
+		"RenderStarted bad.puml",
+		"RenderFailed bad.puml",
+		"FileOpened bad.puml",
+		"TabClosed bad.puml",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("收到的事件:\n%s\n期望:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPauseAndResumeWatching(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml")
+	ui := newTestUI(t, renderer, files...)
+
+	ui.PauseWatching()
+	if !ui.WatchingPaused() {
+		t.Fatal("PauseWatching后应处于暂停状态")
+	}
+	if err := ioutil.WriteFile(files[0], []byte("@startuml\nA -> C\n@enduml\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 暂停期间不检查文件
+	ui.RefreshChangedFiles()
+	if renderer.Calls(files[0]) != 1 {
+		t.Fatalf("暂停期间不应重新渲染，渲染了 %d 次", renderer.Calls(files[0]))
+	}
+
+	// 恢复后重新渲染暂停期间有变化的文件
+	ui.ResumeWatching()
+	deadline := time.Now().Add(2 * time.Second)
+	for renderer.Calls(files[0]) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if renderer.Calls(files[0]) != 2 {
+		t.Fatalf("恢复后应重新渲染有变化的文件，渲染了 %d 次", renderer.Calls(files[0]))
+	}
+}
+
+func TestDuplicateAsSnapshot(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml")
+	ui := newTestUI(t, renderer, files...)
+
+	ui.Tabs.SelectIndex(0)
+	before := ui.selectedViewer().Image()
+	ui.DuplicateAsSnapshot()
+
+	if len(ui.Tabs.Items) != 3 || ui.Tabs.SelectedIndex() != 1 {
+		t.Fatalf("快照应插入到原标签后面并被选中，标签数 %d，选中 %d", len(ui.Tabs.Items), ui.Tabs.SelectedIndex())
+	}
+	snapshot := ui.selectedTab()
+	if !snapshot.snapshot || !snapshot.viewer.IsSnapshot() || snapshot.path != files[0] {
+		t.Fatalf("选中的应是 %s 的快照: %+v", files[0], snapshot)
+	}
+	if got := ui.OpenedFiles(); !reflect.DeepEqual(got, files) {
+		t.Errorf("OpenedFiles() 不应包含快照，得到 %v", got)
+	}
+
+	// 文件重新渲染后，快照仍显示原来的图像
+	renderer.SetImage(files[0], plantumltest.PNG(8, 6))
+	if err := ui.OpenFile(files[0]); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if ui.Tabs.SelectedIndex() != 0 {
+		t.Errorf("重新打开应选中原标签而不是快照，选中 %d", ui.Tabs.SelectedIndex())
+	}
+	if ui.selectedViewer().Image() == before {
+		t.Error("原标签应显示新的图像")
+	}
+	if snapshot.viewer.Image() != before {
+		t.Error("快照应保持创建时的图像")
+	}
+	if snapshot.viewer.RefreshIfChanged() {
+		t.Error("快照不应重新渲染")
+	}
+
+	// 关闭快照不影响原标签
+	ui.Tabs.Select(snapshot.item)
+	ui.CloseCurrentTab()
+	if got := ui.OpenedFiles(); !reflect.DeepEqual(got, files) || len(ui.Tabs.Items) != 2 {
+		t.Errorf("关闭快照后应剩原来的标签，OpenedFiles() = %v", got)
+	}
+}
+
+func TestFollowGlobSwitchesToNewestFile(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "latest-1.puml", "other.puml")
+	ui := newTestUI(t, renderer)
+
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(files[1], old, old); err != nil {
+		t.Fatal(err)
+	}
+	pattern := filepath.Join(filepath.Dir(files[0]), "latest-*.puml")
+	if err := ui.FollowGlob(pattern); err != nil {
+		t.Fatalf("FollowGlob: %v", err)
+	}
+	followed := ui.selectedTab()
+	if followed == nil || followed.follow == nil || followed.path != files[0] {
+		t.Fatalf("应打开跟随 %s 的标签: %+v", files[0], followed)
+	}
+	// 测试中直接检查并切换，不依赖后台定时检查
+	followed.follow.Stop()
+
+	newer := filepath.Join(filepath.Dir(files[0]), "latest-2.puml")
+	if err := ioutil.WriteFile(newer, []byte("@startuml\nB -> C\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(newer, future, future); err != nil {
+		t.Fatal(err)
+	}
+	path, changed, err := followed.follow.Check()
+	if err != nil || !changed || path != newer {
+		t.Fatalf("Check() = %q, %v, %v，应找到 %s", path, changed, err, newer)
+	}
+	ui.switchFollowed(followed, path)
+
+	if len(ui.Tabs.Items) != 1 || ui.selectedTab() != followed || followed.path != newer {
+		t.Errorf("应在同一个标签中切换到 %s，标签数 %d，路径 %s", newer, len(ui.Tabs.Items), followed.path)
+	}
+	if got := renderer.Calls(newer); got == 0 {
+		t.Error("应渲染新的最新文件")
+	}
+
+	// 关闭后的跟随标签不再切换
+	ui.CloseCurrentTab()
+	ui.switchFollowed(followed, files[0])
+	if len(ui.Tabs.Items) != 0 {
+		t.Errorf("关闭后不应重新打开标签，标签数 %d", len(ui.Tabs.Items))
+	}
+}
+
+func TestFollowGlobWithoutMatches(t *testing.T) {
+	ui := newTestUI(t, plantumltest.NewRenderer())
+	if err := ui.FollowGlob(filepath.Join(t.TempDir(), "latest-*.puml")); err == nil {
+		t.Error("没有匹配的文件时应返回错误")
+	}
+	if len(ui.Tabs.Items) != 0 {
+		t.Errorf("不应打开标签，标签数 %d", len(ui.Tabs.Items))
+	}
+}
+
+func TestTabTitleAndColorPersistInSession(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml")
+	sessionPath := filepath.Join(t.TempDir(), "session.json")
+	session, err := config.LoadSession(sessionPath)
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+
+	ui := newTestUI(t, renderer, files...)
+	ui.SetSession(session)
+	ui.Tabs.SelectIndex(0)
+	item := ui.Tabs.Items[0]
+
+	plain := tabButtonWidth(item)
+	ui.SetCurrentTabColor("blue")
+	if tabButtonWidth(item) <= plain {
+		t.Error("有颜色图标时标签宽度应包括图标")
+	}
+	ui.SetTabTitle(item, " 登录流程 ")
+	if item.Text != "登录流程" || item.Icon == nil {
+		t.Fatalf("标签应显示自定义标题和颜色，得到 %q，图标 %v", item.Text, item.Icon)
+	}
+
+	// 快照沿用颜色但不沿用标题
+	ui.DuplicateAsSnapshot()
+	snapshot := ui.selectedTab()
+	if snapshot.item.Icon != item.Icon || !strings.Contains(snapshot.item.Text, "a.puml") {
+		t.Errorf("快照应沿用颜色并显示文件名，得到 %q", snapshot.item.Text)
+	}
+
+	// 重新启动后打开同一个文件时恢复设置
+	loaded, err := config.LoadSession(sessionPath)
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	want := config.TabStyle{Title: "登录流程", Color: "blue"}
+	if got := loaded.TabStyle(files[0]); got != want || len(loaded.Tabs) != 1 {
+		t.Fatalf("应只保存普通标签的设置，得到 %+v", loaded.Tabs)
+	}
+	other := newTestUI(t, renderer)
+	other.SetSession(loaded)
+	if err := other.OpenFile(files[0]); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if restored := other.Tabs.Items[0]; restored.Text != "登录流程" || restored.Icon == nil {
+		t.Errorf("应恢复标题和颜色，得到 %q", restored.Text)
+	}
+
+	// 清空标题并清除颜色后恢复默认
+	ui.Tabs.SelectIndex(0)
+	ui.SetTabTitle(ui.Tabs.Items[0], "")
+	ui.SetCurrentTabColor("")
+	if item.Text != "a.puml" || item.Icon != nil {
+		t.Errorf("应恢复显示文件名，得到 %q", item.Text)
+	}
+	if loaded, _ := config.LoadSession(sessionPath); len(loaded.Tabs) != 0 {
+		t.Errorf("恢复默认后不应保存设置，得到 %+v", loaded.Tabs)
+	}
+}
+
+func TestProjectBadges(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml")
+	dir := filepath.Dir(files[0])
+	sessionPath := filepath.Join(t.TempDir(), "session.json")
+	session, err := config.LoadSession(sessionPath)
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	ui := newTestUI(t, renderer)
+	ui.SetSession(session)
+
+	if ui.project.box.Visible() {
+		t.Error("没有打开项目时不应显示项目侧边栏")
+	}
+	if err := ui.OpenProject(dir); err != nil {
+		t.Fatalf("OpenProject: %v", err)
+	}
+	if !ui.project.box.Visible() || len(ui.ChangedProjectFiles()) != 0 {
+		t.Errorf("新打开的项目应显示侧边栏，不列出已有的文件，得到 %v", ui.ChangedProjectFiles())
+	}
+
+	// 修改和新增的文件都列出，不论是否打开
+	if err := ioutil.WriteFile(files[1], []byte("@startuml\nA -> C\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	added := filepath.Join(dir, "c.puml")
+	if err := ioutil.WriteFile(added, []byte("@startuml\nC -> D\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ui.CheckProject()
+	if got, want := ui.ChangedProjectFiles(), []string{files[1], added}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("有变化的文件 = %v，应为 %v", got, want)
+	}
+
+	// 在标签中看过之后不再列出
+	if err := ui.OpenFile(files[1]); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if got := ui.ChangedProjectFiles(); !reflect.DeepEqual(got, []string{added}) {
+		t.Errorf("看过的文件不应再列出，得到 %v", got)
+	}
+
+	// 重新启动后恢复项目，之前没看过的文件仍然列出
+	loaded, err := config.LoadSession(sessionPath)
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	other := newTestUI(t, renderer)
+	other.SetSession(loaded)
+	other.RestoreProject()
+	if other.ProjectRoot() != dir || !reflect.DeepEqual(other.ChangedProjectFiles(), []string{added}) {
+		t.Errorf("应恢复项目 %s，得到 %s，%v", dir, other.ProjectRoot(), other.ChangedProjectFiles())
+	}
+	other.MarkAllViewed()
+	if got := other.ChangedProjectFiles(); len(got) != 0 {
+		t.Errorf("全部标为已看后不应列出文件，得到 %v", got)
+	}
+	other.CloseProject()
+	if other.project.box.Visible() || other.ProjectRoot() != "" || loaded.Project != "" {
+		t.Error("关闭项目后应隐藏侧边栏并清除项目目录")
+	}
+}
+
+func TestTabGroups(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml", "c.puml")
+	session, err := config.LoadSession(filepath.Join(t.TempDir(), "session.json"))
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	ui := newTestUI(t, renderer, files...)
+	ui.SetSession(session)
+
+	if ui.groups.box.Visible() {
+		t.Error("没有分组时不应显示侧边栏")
+	}
+	ui.SetTabGroup(ui.Tabs.Items[0], "billing")
+	ui.SetTabGroup(ui.Tabs.Items[2], " billing ")
+	ui.SetTabGroup(ui.Tabs.Items[1], "frontend")
+	if !ui.groups.box.Visible() {
+		t.Error("有分组时应显示侧边栏")
+	}
+	if got := ui.Groups(); !reflect.DeepEqual(got, []string{"billing", "frontend"}) {
+		t.Errorf("Groups() = %v", got)
+	}
+	if got := ui.groups.childUIDs(groupNodePrefix + "billing"); len(got) != 2 || ui.groups.items[got[1]] != ui.Tabs.Items[2] {
+		t.Errorf("billing分组应按标签顺序包含a和c，得到 %v", got)
+	}
+
+	// 点击侧边栏中的标签切换过去
+	ui.Tabs.SelectIndex(0)
+	ui.groups.tree.Select(ui.groups.childUIDs(groupNodePrefix + "frontend")[0])
+	if ui.CurrentGroup() != "frontend" || ui.Tabs.SelectedIndex() != 1 {
+		t.Errorf("应切换到frontend分组的标签，选中 %d", ui.Tabs.SelectedIndex())
+	}
+
+	// 折叠状态保存在工作区状态中
+	ui.groups.tree.CloseBranch(groupNodePrefix + "frontend")
+	if !session.GroupCollapsed("frontend") {
+		t.Error("应记录折叠的分组")
+	}
+	if got := session.TabStyle(files[2]).Group; got != "billing" {
+		t.Errorf("应保存标签的分组，得到 %q", got)
+	}
+
+	before := renderer.Calls(files[0])
+	ui.RefreshGroup("billing")
+	if renderer.Calls(files[0]) != before+1 || renderer.Calls(files[1]) != 1 {
+		t.Error("应只重新渲染分组中的文件")
+	}
+
+	// 当前标签不属于分组时，分组操作不影响未分组的标签
+	ui.CloseGroup("")
+	if len(ui.Tabs.Items) != 3 {
+		t.Fatalf("CloseGroup(\"\") 不应关闭标签，剩 %d 个", len(ui.Tabs.Items))
+	}
+
+	ui.CloseGroup("billing")
+	if got := ui.OpenedFiles(); !reflect.DeepEqual(got, files[1:2]) {
+		t.Errorf("关闭分组后应只剩 %v，得到 %v", files[1:2], got)
+	}
+
+	ui.SetTabGroup(ui.Tabs.Items[0], "")
+	if ui.groups.box.Visible() || len(ui.Groups()) != 0 {
+		t.Error("最后一个标签移出分组后应隐藏侧边栏")
+	}
+}
+
+func TestCloseOtherAndAllTabsCanBeReopened(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml", "c.puml")
+	ui := newTestUI(t, renderer, files...)
+
+	ui.Tabs.SelectIndex(1)
+	ui.CloseOtherTabs()
+	if got := ui.OpenedFiles(); !reflect.DeepEqual(got, files[1:2]) {
+		t.Fatalf("关闭其他标签后应只剩 %v，得到 %v", files[1:2], got)
+	}
+
+	ui.CloseCurrentTab()
+	if len(ui.Tabs.Items) != 0 || !ui.CanReopenClosedTabs() {
+		t.Fatalf("应关闭全部标签并可以重新打开，剩 %d 个", len(ui.Tabs.Items))
+	}
+
+	// 先恢复单独关闭的标签，再一起恢复批量关闭的标签
+	ui.ReopenClosedTabs()
+	if got := ui.OpenedFiles(); !reflect.DeepEqual(got, files[1:2]) {
+		t.Errorf("应先重新打开 %v，得到 %v", files[1:2], got)
+	}
+	ui.ReopenClosedTabs()
+	if got := ui.OpenedFiles(); len(got) != 3 || ui.CanReopenClosedTabs() {
+		t.Errorf("应重新打开全部文件，得到 %v", got)
+	}
+
+	ui.CloseAllTabs()
+	if len(ui.Tabs.Items) != 0 || len(ui.tabs.tabs) != 0 {
+		t.Fatalf("应关闭所有标签并清理记录，剩 %d 个", len(ui.Tabs.Items))
+	}
+	ui.ReopenClosedTabs()
+	if got := ui.OpenedFiles(); len(got) != 3 {
+		t.Errorf("应重新打开关闭的所有文件，得到 %v", got)
+	}
+}
+
+func TestCloseAllTabsAsksForConfirmation(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml", "c.puml")
+	ui := newTestUI(t, renderer, files...)
+	ui.settings.ConfirmCloseTabs = 2
+
+	ui.CloseAllTabs()
+	if len(ui.Tabs.Items) != 3 {
+		t.Fatalf("超过确认数量时应先确认，不应直接关闭，剩 %d 个", len(ui.Tabs.Items))
+	}
+	if ui.window.Canvas().Overlays().Top() == nil {
+		t.Error("应显示确认框")
+	}
+
+	// 不超过确认数量时直接关闭
+	ui.Tabs.SelectIndex(0)
+	ui.CloseOtherTabs()
+	if len(ui.Tabs.Items) != 1 {
+		t.Errorf("关闭2个标签不需要确认，剩 %d 个", len(ui.Tabs.Items))
+	}
+}
+
+func TestCloseGroupCanBeReopened(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml", "c.puml")
+	ui := newTestUI(t, renderer, files...)
+	ui.SetTabGroup(ui.Tabs.Items[0], "billing")
+	ui.SetTabGroup(ui.Tabs.Items[2], "billing")
+
+	ui.CloseGroup("billing")
+	ui.ReopenClosedTabs()
+	if got := ui.OpenedFiles(); len(got) != 3 {
+		t.Fatalf("应一起重新打开分组的标签，得到 %v", got)
+	}
+	if got := ui.Groups(); !reflect.DeepEqual(got, []string{"billing"}) {
+		t.Errorf("重新打开后应恢复分组，得到 %v", got)
+	}
+}
+
+func TestOpenFileWithGroup(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml")
+	session, err := config.LoadSession(filepath.Join(t.TempDir(), "session.json"))
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	session.Tabs[files[1]] = config.TabStyle{Group: "billing"}
+	ui := newTestUI(t, renderer)
+	ui.SetSession(session)
+
+	for _, file := range files {
+		if err := ui.OpenFileWith(file, OpenOptions{Group: "payments"}); err != nil {
+			t.Fatalf("OpenFileWith: %v", err)
+		}
+	}
+	// 保存过分组的文件使用保存的分组
+	if got := ui.Groups(); !reflect.DeepEqual(got, []string{"payments", "billing"}) {
+		t.Errorf("Groups() = %v", got)
+	}
+
+	// 已打开的标签不改变分组
+	ui.SetTabGroup(ui.Tabs.Items[0], "")
+	if err := ui.OpenFileWith(files[0], OpenOptions{Group: "payments"}); err != nil {
+		t.Fatalf("OpenFileWith: %v", err)
+	}
+	if got := ui.Groups(); !reflect.DeepEqual(got, []string{"billing"}) {
+		t.Errorf("已打开的标签不应重新加入分组，得到 %v", got)
+	}
+}
+
+func TestQuitConfirmation(t *testing.T) {
+	files := writeFiles(t, "a.puml", "b.puml", "c.puml")
+	ui := newTestUI(t, plantumltest.NewRenderer(), files...)
+
+	if msg := ui.QuitConfirmation(); msg != "" {
+		t.Errorf("默认不应在退出前确认，得到 %q", msg)
+	}
+	ui.settings.ConfirmQuitTabs = 2
+	if msg := ui.QuitConfirmation(); !strings.Contains(msg, "3 个标签页") {
+		t.Errorf("超过设置的数量时应确认，得到 %q", msg)
+	}
+	ui.settings.ConfirmQuitTabs = 3
+	if msg := ui.QuitConfirmation(); msg != "" {
+		t.Errorf("没有超过设置的数量时不应确认，得到 %q", msg)
+	}
+}
+
+func TestScratchTabLifecycle(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml")
+	events := event.NewBus()
+	ui := newTestUIWithEvents(t, renderer, events, files...)
+	ui.draftDir = t.TempDir()
+
+	if err := ui.NewScratchTab(); err != nil {
+		t.Fatalf("NewScratchTab: %v", err)
+	}
+	scratchTab := ui.selectedTab()
+	s := scratchTab.scratch
+	if s == nil || scratchTab.item.Text != "草稿 1 *" {
+		t.Fatalf("应打开未保存的草稿标签，得到 %q", scratchTab.item.Text)
+	}
+	if got := ui.OpenedFiles(); !reflect.DeepEqual(got, files) {
+		t.Errorf("OpenedFiles() 不应包含草稿，得到 %v", got)
+	}
+
+	// 编辑后写入草稿文件并在后台重新渲染（测试中直接写入，不等待延迟）
+	rendered := make(chan struct{}, 1)
+	events.Subscribe(func(e event.Event) {
+		if e.Path == s.draft {
+			rendered <- struct{}{}
+		}
+	}, event.RenderFinished)
+	s.entry.SetText("@startuml\nA -> B\n@enduml\n")
+	s.timer.Stop()
+	ui.writeDraft(scratchTab)
+	if data, _ := ioutil.ReadFile(s.draft); string(data) != s.entry.Text {
+		t.Errorf("草稿文件应为编辑后的内容，得到 %q", data)
+	}
+	select {
+	case <-rendered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("写入草稿后应重新渲染")
+	}
+
+	// 有未保存的草稿时，退出前确认，批量关闭时保留
+	if msg := ui.QuitConfirmation(); !strings.Contains(msg, "草稿") {
+		t.Errorf("有未保存的草稿时应确认退出，得到 %q", msg)
+	}
+	ui.CloseAllTabs()
+	if len(ui.Tabs.Items) != 1 || ui.Tabs.Items[0] != scratchTab.item {
+		t.Fatalf("批量关闭不应关闭未保存的草稿，剩 %d 个标签", len(ui.Tabs.Items))
+	}
+	ui.CloseCurrentTab()
+	if len(ui.Tabs.Items) != 1 || ui.window.Canvas().Overlays().Top() == nil {
+		t.Fatal("关闭未保存的草稿前应询问是否保存")
+	}
+
+	// 保存后不再是未保存状态，标题显示为文件名
+	saved := filepath.Join(t.TempDir(), "flow.puml")
+	if err := ui.writeScratch(scratchTab, saved); err != nil {
+		t.Fatalf("writeScratch: %v", err)
+	}
+	if s.dirty || scratchTab.item.Text != "flow.puml" || ui.QuitConfirmation() != "" {
+		t.Errorf("保存后不应有未保存的修改，标题 %q", scratchTab.item.Text)
+	}
+	s.entry.SetText(s.entry.Text + "' 注释\n")
+	s.timer.Stop()
+	if !s.dirty || scratchTab.item.Text != "flow.puml *" {
+		t.Errorf("再次编辑后应为未保存状态，标题 %q", scratchTab.item.Text)
+	}
+	s.entry.SetText(s.saved)
+	s.timer.Stop()
+	if s.dirty {
+		t.Error("恢复为已保存的内容后不应为未保存状态")
+	}
+
+	// 关闭后删除草稿文件
+	closedBefore := len(ui.closed)
+	ui.CloseCurrentTab()
+	if len(ui.Tabs.Items) != 0 {
+		t.Fatalf("已保存的草稿应直接关闭，剩 %d 个标签", len(ui.Tabs.Items))
+	}
+	if _, err := os.Stat(s.draft); !os.IsNotExist(err) {
+		t.Errorf("关闭后应删除草稿文件: %v", err)
+	}
+	if len(ui.closed) != closedBefore {
+		t.Error("草稿不应记入最近关闭的标签")
+	}
+}
+
+func TestOpenSample(t *testing.T) {
+	ui := newTestUI(t, plantumltest.NewRenderer())
+	ui.draftDir = t.TempDir()
+
+	sample := samples.All[0]
+	if err := ui.OpenSample(sample); err != nil {
+		t.Fatalf("OpenSample: %v", err)
+	}
+	sampleTab := ui.selectedTab()
+	source, _ := samples.Source(sample.Name)
+	if sampleTab.scratch == nil || sampleTab.scratch.entry.Text != string(source) {
+		t.Fatal("应在草稿标签中打开样例的源码")
+	}
+	if sampleTab.item.Text != sample.Title || ui.unsavedScratches() != 0 {
+		t.Errorf("没有修改的样例不应为未保存状态，标题 %q", sampleTab.item.Text)
+	}
+
+	// 修改后与普通草稿一样需要保存
+	sampleTab.scratch.entry.SetText(sampleTab.scratch.entry.Text + "' 注释\n")
+	sampleTab.scratch.timer.Stop()
+	if sampleTab.item.Text != sample.Title+" *" {
+		t.Errorf("修改后应为未保存状态，标题 %q", sampleTab.item.Text)
+	}
+
+	if err := ui.OpenSample(samples.Sample{Name: "missing.puml"}); err == nil || len(ui.Tabs.Items) != 1 {
+		t.Errorf("不存在的样例应返回错误且不打开标签，得到 %v", err)
+	}
+}
+
+func TestRecoverDrafts(t *testing.T) {
+	ui := newTestUI(t, plantumltest.NewRenderer())
+	ui.draftDir = t.TempDir()
+	content := "@startuml\nX -> Y\n@enduml\n"
+	if err := ioutil.WriteFile(filepath.Join(ui.draftDir, "scratch-1.puml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := ui.RecoverDrafts(); n != 1 {
+		t.Fatalf("应恢复1个草稿，得到 %d", n)
+	}
+	recovered := ui.selectedTab()
+	if recovered.scratch == nil || recovered.scratch.entry.Text != content || !recovered.scratch.dirty {
+		t.Errorf("恢复的草稿应为未保存状态并包含原来的内容")
+	}
+
+	// 正常退出时删除草稿文件
+	ui.DiscardDrafts()
+	if n := len(mustGlob(t, filepath.Join(ui.draftDir, "*"))); n != 0 {
+		t.Errorf("退出后不应留下草稿文件，剩 %d 个", n)
+	}
+}
+
+func TestScratchUndoHistory(t *testing.T) {
+	ui := newTestUI(t, plantumltest.NewRenderer())
+	ui.draftDir = t.TempDir()
+	if err := ui.NewScratchTab(); err != nil {
+		t.Fatal(err)
+	}
+	scratchTab := ui.selectedTab()
+	s := scratchTab.scratch
+	edit := func(text string) {
+		s.entry.SetText(text)
+		s.timer.Stop()
+		ui.writeDraft(scratchTab)
+	}
+	edit("@startuml\nA -> B\n@enduml\n")
+	edit("@startuml\nA -> C\n@enduml\n")
+
+	ui.UndoEdit()
+	if s.entry.Text != "@startuml\nA -> B\n@enduml\n" {
+		t.Fatalf("撤销应回到上一个版本，得到 %q", s.entry.Text)
+	}
+	if data, _ := ioutil.ReadFile(s.draft); string(data) != s.entry.Text {
+		t.Errorf("撤销后应立即写入草稿文件，得到 %q", data)
+	}
+	s.entry.TypedShortcut(&fyne.ShortcutUndo{})
+	if s.entry.Text != scratchTemplate {
+		t.Fatalf("撤销快捷键应使用同一个撤销历史，得到 %q", s.entry.Text)
+	}
+	s.entry.TypedShortcut(&fyne.ShortcutRedo{})
+	if s.entry.Text != "@startuml\nA -> B\n@enduml\n" {
+		t.Fatalf("重做应前进到撤销前的版本，得到 %q", s.entry.Text)
+	}
+
+	// 保存后历史属于保存的文件，关闭后再编辑该文件时仍然可以撤销
+	saved := writeFiles(t, "flow.puml")[0]
+	if err := ui.writeScratch(scratchTab, saved); err != nil {
+		t.Fatal(err)
+	}
+	ui.CloseCurrentTab()
+	if err := ui.OpenFile(saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.EditCurrentFile(); err != nil {
+		t.Fatalf("EditCurrentFile: %v", err)
+	}
+	reopened := ui.selectedTab()
+	if reopened.scratch == nil || reopened.scratch.dirty || reopened.item.Text != "flow.puml" {
+		t.Fatalf("应在没有未保存修改的草稿标签中编辑文件，标题 %q", reopened.item.Text)
+	}
+	ui.UndoEdit()
+	if reopened.scratch.entry.Text != scratchTemplate || !reopened.scratch.dirty {
+		t.Errorf("重新编辑文件时应恢复之前的撤销历史，得到 %q", reopened.scratch.entry.Text)
+	}
+
+	// 没有保存过的草稿关闭后删除它的撤销历史
+	ui.draftDir = t.TempDir()
+	ui.NewScratchTab()
+	draft := ui.selectedTab().scratch
+	discardScratch(draft)
+	if files := mustGlob(t, filepath.Join(ui.undoDir, "*")); len(files) != 1 {
+		t.Errorf("应只保留保存过的文件的撤销历史，得到 %v", files)
+	}
+}
+
+func TestFormatScratch(t *testing.T) {
+	ui := newTestUI(t, plantumltest.NewRenderer())
+	ui.draftDir = t.TempDir()
+	if err := ui.openScratch("@startuml\nALT ok\nA -> B\nend\n@enduml\n", ""); err != nil {
+		t.Fatal(err)
+	}
+	s := ui.selectedTab().scratch
+	ui.FormatScratch()
+	if want := "@startuml\nalt ok\n  A -> B\nend\n@enduml\n"; s.entry.Text != want {
+		t.Fatalf("应整理草稿的源码，得到 %q", s.entry.Text)
+	}
+	if data, _ := ioutil.ReadFile(s.draft); string(data) != s.entry.Text {
+		t.Errorf("整理后应立即写入草稿文件，得到 %q", data)
+	}
+	ui.UndoEdit()
+	if !strings.Contains(s.entry.Text, "ALT ok") {
+		t.Errorf("整理格式应可以撤销，得到 %q", s.entry.Text)
+	}
+}
+
+func TestRenameSymbol(t *testing.T) {
+	ui := newTestUI(t, plantumltest.NewRenderer())
+	ui.draftDir = t.TempDir()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.puml")
+	common := filepath.Join(dir, "common.iuml")
+	source := "@startuml\n!include common.iuml\nparticipant Alice\nAlice -> Bob : Alice 你好\n@enduml\n"
+	if err := ioutil.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(common, []byte("actor Bob\nBob -> Alice\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.OpenFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.EditCurrentFile(); err != nil {
+		t.Fatal(err)
+	}
+	s := ui.selectedTab().scratch
+
+	if err := ui.renameSymbol(ui.selectedTab(), "Alice", "Bob Smith", false); err == nil {
+		t.Error("无效的名称应返回错误")
+	}
+	if preview := ui.renamePreview(s, "Alice", "Carol", true); !strings.Contains(preview, "common.iuml：1行") {
+		t.Errorf("预览应列出引用的文件中修改的行，得到 %q", preview)
+	}
+	if err := ui.renameSymbol(ui.selectedTab(), "Alice", "Carol", true); err != nil {
+		t.Fatal(err)
+	}
+	if want := "@startuml\n!include common.iuml\nparticipant Carol\nCarol -> Bob : Alice 你好\n@enduml\n"; s.entry.Text != want {
+		t.Errorf("应重命名草稿中的引用，得到 %q", s.entry.Text)
+	}
+	if data, _ := ioutil.ReadFile(common); string(data) != "actor Bob\nBob -> Carol\n" {
+		t.Errorf("应同时修改引用的文件，得到 %q", data)
+	}
+	if data, _ := ioutil.ReadFile(file); string(data) != source {
+		t.Errorf("草稿保存前不应改写编辑的文件，得到 %q", data)
+	}
+	ui.UndoEdit()
+	if !strings.Contains(s.entry.Text, "participant Alice") {
+		t.Errorf("重命名应可以撤销，得到 %q", s.entry.Text)
+	}
+}
+
+func TestExtractToInclude(t *testing.T) {
+	ui := newTestUI(t, plantumltest.NewRenderer())
+	ui.draftDir = t.TempDir()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.puml")
+	source := "@startuml\npackage core {\n  class 订单\n  class B\n}\n@enduml\n"
+	if err := ioutil.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.OpenFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.EditCurrentFile(); err != nil {
+		t.Fatal(err)
+	}
+	s := ui.selectedTab().scratch
+
+	// 从第3行的中间选到第4行的行尾
+	selectInEntry(&s.entry.Entry, outline.Position{Line: 3, Column: 8, Length: 12})
+	first, last, ok := selectedLines(&s.entry.Entry)
+	if !ok || first != 3 || last != 4 {
+		t.Fatalf("选中的行 = %d-%d %v，应为 3-4", first, last, ok)
+	}
+
+	part := filepath.Join(dir, "parts", "core.iuml")
+	if err := os.MkdirAll(filepath.Dir(part), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.extractToInclude(ui.selectedTab(), first, last, part); err != nil {
+		t.Fatal(err)
+	}
+	if want := "@startuml\npackage core {\n  !include parts/core.iuml\n}\n@enduml\n"; s.entry.Text != want {
+		t.Errorf("选中的行应改为 !include，得到 %q", s.entry.Text)
+	}
+	if data, _ := ioutil.ReadFile(part); string(data) != "class 订单\nclass B\n" {
+		t.Errorf("提取的文件内容为 %q", data)
+	}
+	ui.UndoEdit()
+	if s.entry.Text != source {
+		t.Errorf("提取应可以撤销，得到 %q", s.entry.Text)
+	}
+}
+
+func TestOpenImageOffersToImportSource(t *testing.T) {
+	ui := newTestUI(t, plantumltest.NewRenderer())
+	dir := t.TempDir()
+
+	svg := `<svg xmlns="http://www.w3.org/2000/svg"><g></g></svg>`
+	plain := filepath.Join(dir, "plain.svg")
+	if err := ioutil.WriteFile(plain, []byte(svg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.OpenFile(plain); err == nil {
+		t.Error("没有嵌入源码的SVG应返回错误")
+	}
+	// 不是PlantUML生成的PNG没有源码
+	png := filepath.Join(dir, "photo.PNG")
+	if err := ioutil.WriteFile(png, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.OpenFile(png); err == nil {
+		t.Error("没有嵌入源码的PNG应返回错误")
+	}
+
+	data, err := export.EmbedSource([]byte(svg), "@startuml\nAlice -> Bob\n@enduml\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded := filepath.Join(dir, "embedded.svg")
+	if err := ioutil.WriteFile(embedded, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ui.OpenFile(embedded); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if len(ui.Tabs.Items) != 0 {
+		t.Errorf("SVG不应作为图表打开，得到 %d 个标签", len(ui.Tabs.Items))
+	}
+	if ui.window.Canvas().Overlays().Top() == nil {
+		t.Error("应询问是否导入源码")
+	}
+}
+
+func TestC4LevelBar(t *testing.T) {
+	files := writeFiles(t, "billing-context.puml", "billing-container.puml", "plain.puml")
+	source := "@startuml\n!include <C4/C4_Context>\nPerson(user, \"User\")\n@enduml\n"
+	if err := ioutil.WriteFile(files[0], []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ui := newTestUI(t, plantumltest.NewRenderer(), files[0], files[2])
+
+	if findButton(ui.Tabs.Items[1].Content, "容器") != nil {
+		t.Error("不是C4图表时不应显示层级切换栏")
+	}
+	content := ui.Tabs.Items[0].Content
+	if b := findButton(content, "系统上下文"); b == nil || b.Importance != widget.HighImportance {
+		t.Error("应突出显示当前层级")
+	}
+	if b := findButton(content, "组件"); b == nil || !b.Disabled() {
+		t.Error("没有配套文件的层级应不可点击")
+	}
+
+	ui.Tabs.SelectIndex(0)
+	if err := ui.SwitchC4Level(c4.Component); err == nil {
+		t.Error("没有配套文件时应返回错误")
+	}
+	test.Tap(findButton(content, "容器"))
+	if got := ui.selectedFilePath(); got != files[1] {
+		t.Fatalf("应打开容器层级的配套文件，当前为 %s", got)
+	}
+	// 配套文件按文件名确定层级
+	if b := findButton(ui.Tabs.Selected().Content, "容器"); b == nil || b.Importance != widget.HighImportance {
+		t.Error("配套文件应突出显示它的层级")
+	}
+
+	if err := ui.SwitchC4Level(c4.Context); err != nil {
+		t.Fatalf("SwitchC4Level: %v", err)
+	}
+	if len(ui.Tabs.Items) != 3 || ui.Tabs.SelectedIndex() != 0 {
+		t.Errorf("已打开的层级应切换到原来的标签，共 %d 个标签，当前为第 %d 个", len(ui.Tabs.Items), ui.Tabs.SelectedIndex())
+	}
+}
+
+func TestOutlinePanel(t *testing.T) {
+	files := writeFiles(t, "a.puml")
+	if err := ioutil.WriteFile(files[0], []byte("@startuml\nclass Order\nclass Invoice\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ui := newTestUI(t, plantumltest.NewRenderer(), files...)
+	ui.draftDir = t.TempDir()
+	if ui.outline.box.Visible() {
+		t.Fatal("默认不显示大纲")
+	}
+
+	ui.SetOutlineVisible(true)
+	if got := len(ui.outline.elements); got != 2 {
+		t.Fatalf("应列出文件中的2个类，得到 %d 个", got)
+	}
+
+	source := "@startuml\nparticipant Alice\nparticipant Bob\nAlice -> Bob : hi\nBob -> Alice\n@enduml\n"
+	if err := ui.openScratch(source, ""); err != nil {
+		t.Fatalf("openScratch: %v", err)
+	}
+	p := ui.outline
+	if len(p.elements) != 2 || p.elements[1].Name != "Bob" {
+		t.Fatalf("切换标签后应列出草稿中的参与者，得到 %+v", p.elements)
+	}
+
+	// 依次点击同一元素时在编辑区中选中各处出现的位置
+	entry := ui.selectedTab().scratch.entry
+	var rows []int
+	for i := 0; i < 4; i++ {
+		p.list.Select(1)
+		if entry.SelectedText() != "Bob" {
+			t.Fatalf("第%d次点击应选中Bob，选中了 %q", i+1, entry.SelectedText())
+		}
+		rows = append(rows, entry.CursorRow)
+	}
+	if want := []int{2, 3, 4, 2}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("选中的行为 %v，应为 %v", rows, want)
+	}
+	if !strings.Contains(p.lines.Text, "第 3、4、5 行") {
+		t.Errorf("应显示出现的行，得到 %q", p.lines.Text)
+	}
+
+	ui.Tabs.SelectIndex(0)
+	if len(p.elements) != 2 || p.elements[0].Name != "Order" || p.lines.Text != "" {
+		t.Errorf("切换回文件标签后应列出文件中的元素，得到 %+v，%q", p.elements, p.lines.Text)
+	}
+}
+
+func TestStatusInWindowTitle(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "bad.puml", "good.puml")
+	renderer.SetError(files[0], &plantuml.RenderError{Line: 2, Output: "Error line 2 in file"})
+	ui := newTestUI(t, renderer, files...)
+	ui.draftDir = t.TempDir()
+
+	var errors, pending int
+	ui.SetOnStatusChanged(func(e, p int) { errors, pending = e, p })
+
+	ui.UpdateTitle()
+	if got := ui.window.Title(); got != "PlantUML Viewer - good.puml（1个渲染错误）" {
+		t.Errorf("窗口标题为 %q", got)
+	}
+	if errors != 1 || pending != 0 {
+		t.Errorf("状态回调得到 %d 个错误、%d 个待更新", errors, pending)
+	}
+
+	// 未保存的草稿算作待更新
+	if err := ui.NewScratchTab(); err != nil {
+		t.Fatalf("NewScratchTab: %v", err)
+	}
+	if got := ui.window.Title(); !strings.HasSuffix(got, "（1个渲染错误，1个待更新）") {
+		t.Errorf("窗口标题为 %q", got)
+	}
+
+	// 修复后错误消失
+	renderer.SetError(files[0], nil)
+	if err := ui.OpenFile(files[0]); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if errors != 0 || pending != 1 {
+		t.Errorf("修复后状态回调得到 %d 个错误、%d 个待更新", errors, pending)
+	}
+	if got := ui.window.Title(); got != "PlantUML Viewer - bad.puml（1个待更新）" {
+		t.Errorf("窗口标题为 %q", got)
+	}
+}
+
+func TestWithDefaultExtension(t *testing.T) {
+	for path, want := range map[string]string{
+		"/tmp/flow":          "/tmp/flow.puml",
+		"/tmp/flow.plantuml": "/tmp/flow.plantuml",
+		"/tmp/flow.pu":       "/tmp/flow.pu",
+	} {
+		if got := withDefaultExtension(path); got != want {
+			t.Errorf("withDefaultExtension(%q) = %q，应为 %q", path, got, want)
+		}
+	}
+}
+
+// mustGlob 返回匹配pattern的文件
+func mustGlob(t *testing.T, pattern string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestOpenVirtualFile(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml")
+	ui := newTestUI(t, renderer, files...)
+
+	// 虚拟文件与同名的真实文件使用不同的标签
+	if err := ui.OpenVirtual(files[0], "@startuml\nA -> B\n@enduml\n", OpenOptions{NoSelect: true}); err != nil {
+		t.Fatalf("OpenVirtual: %v", err)
+	}
+	if len(ui.Tabs.Items) != 2 || ui.selectedFilePath() != files[0] || ui.selectedTab().virtual {
+		t.Fatalf("应在后台打开新的虚拟文件标签，当前有 %d 个标签", len(ui.Tabs.Items))
+	}
+	v := ui.tabs.byVirtual(files[0])
+	if v == nil || !strings.Contains(v.item.Text, "未保存") {
+		t.Fatalf("虚拟文件标签的标题应标明未保存")
+	}
+	if got := v.viewer.ImageSize().Height; got != 3 {
+		t.Errorf("应渲染发来的3行内容，图像高度为 %v", got)
+	}
+	if got := ui.OpenedFiles(); !reflect.DeepEqual(got, files) {
+		t.Errorf("OpenedFiles() = %v，不应包括虚拟文件", got)
+	}
+
+	// 之后的内容更新同一个标签，不读取文件
+	err := ui.OpenVirtual(files[0], "@startuml\nA -> B\nsyntax error\n@enduml\n", OpenOptions{})
+	if plantuml.ErrorLine(err) != 3 {
+		t.Errorf("应返回第3行的渲染错误，得到 %v", err)
+	}
+	if len(ui.Tabs.Items) != 2 || ui.selectedTab() != v {
+		t.Fatalf("应更新并选中原来的虚拟文件标签")
+	}
+	if open, err := ui.FileRenderError(files[0]); !open || plantuml.ErrorLine(err) != 3 {
+		t.Errorf("FileRenderError应优先返回虚拟文件的结果: %v, %v", open, err)
+	}
+	if renderer.Calls(files[0]) != 1 {
+		t.Errorf("虚拟文件不应渲染磁盘上的文件，渲染了 %d 次", renderer.Calls(files[0]))
+	}
+
+	// 刷新时使用已有的内容重新渲染
+	if err := ui.OpenVirtual(files[0], "@startuml\n@enduml\n", OpenOptions{}); err != nil {
+		t.Fatalf("OpenVirtual: %v", err)
+	}
+	ui.RefreshCurrentTab()
+	if ui.selectedTab() != v || v.viewer.RenderError() != nil || v.viewer.ImageSize().Height != 2 {
+		t.Errorf("刷新后应仍显示虚拟文件的内容")
+	}
+}
+
+func TestRefreshSchedule(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "data.puml")
+	sessionPath := filepath.Join(t.TempDir(), "session.json")
+	session, err := config.LoadSession(sessionPath)
+	if err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+
+	ui := newTestUI(t, renderer, files...)
+	ui.SetSession(session)
+	ui.Tabs.SelectIndex(0)
+	tab := ui.selectedTab()
+
+	ui.SetCurrentRefreshInterval(time.Minute)
+	if ui.CurrentRefreshInterval() != time.Minute || !strings.HasSuffix(tab.item.Text, " ⟳") {
+		t.Fatalf("应设置定时刷新并在标题中标记，得到 %v，%q", ui.CurrentRefreshInterval(), tab.item.Text)
+	}
+	if loaded, _ := config.LoadSession(sessionPath); loaded.RefreshInterval(files[0]) != time.Minute {
+		t.Errorf("定时刷新间隔应保存到工作区状态，得到 %+v", loaded.Intervals)
+	}
+
+	// 文件没有变化时也按间隔重新渲染
+	calls := renderer.Calls(files[0])
+	ui.startSchedule(tab, 20*time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for renderer.Calls(files[0]) < calls+2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if renderer.Calls(files[0]) < calls+2 {
+		t.Fatalf("应定时重新渲染，渲染了 %d 次", renderer.Calls(files[0])-calls)
+	}
+
+	// 关闭标签后停止定时刷新
+	ui.CloseCurrentTab()
+	if tab.schedule != nil {
+		t.Error("关闭标签后应停止定时刷新")
+	}
+
+	// 重新打开时恢复间隔
+	if err := ui.OpenFile(files[0]); err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if ui.CurrentRefreshInterval() != time.Minute {
+		t.Errorf("重新打开时应恢复定时刷新，得到 %v", ui.CurrentRefreshInterval())
+	}
+	ui.SetCurrentRefreshInterval(0)
+	if ui.CurrentRefreshInterval() != 0 || strings.Contains(ui.selectedTab().item.Text, "⟳") {
+		t.Errorf("应停止定时刷新，标题 %q", ui.selectedTab().item.Text)
+	}
+}
+
+func TestAccessibilityDescriptions(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml")
+	if err := ioutil.WriteFile(files[1], []byte("@startuml\ntitle 登录流程\ncaption 图2\nA -> B\n@enduml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ui := newTestUI(t, renderer)
+	var labels, announced []string
+	ui.SetOnDescriptionChanged(func(label string) { labels = append(labels, label) })
+	ui.SetOnAnnounce(func(message string) { announced = append(announced, message) })
+
+	for _, file := range files {
+		if err := ui.OpenFile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := ui.Description(); got != "登录流程。图2" {
+		t.Errorf("应以标题和说明作为描述，得到 %q", got)
+	}
+	if len(labels) == 0 || labels[len(labels)-1] != "登录流程。图2" {
+		t.Errorf("描述变化时应通知回调，得到 %v", labels)
+	}
+	ui.PrevTab()
+	if got := ui.Description(); got != "a.puml" {
+		t.Errorf("没有标题时应使用标签标题，得到 %q", got)
+	}
+	if len(announced) == 0 || announced[len(announced)-1] != "a.puml" {
+		t.Errorf("切换标签后应读出新标签的描述，得到 %v", announced)
+	}
+
+	// 当前标签渲染出错和恢复时读出，后台标签出错不打断
+	announced = nil
+	renderer.SetError(files[1], &plantuml.RenderError{Line: 4, Err: errors.New("exit status 200")})
+	ui.OpenFileWith(files[1], OpenOptions{NoSelect: true})
+	renderer.SetError(files[0], &plantuml.RenderError{Line: 2, Err: errors.New("exit status 200")})
+	ui.RefreshCurrentTab()
+	if len(announced) != 1 || !strings.HasPrefix(announced[0], "a.puml渲染出错，第2行") {
+		t.Fatalf("当前标签渲染出错时应读出错误，得到 %v", announced)
+	}
+	if !strings.HasPrefix(ui.Description(), "a.puml渲染出错") {
+		t.Errorf("渲染出错时描述应为错误信息，得到 %q", ui.Description())
+	}
+	renderer.SetError(files[0], nil)
+	ui.RefreshCurrentTab()
+	if len(announced) != 2 || announced[1] != "a.puml已恢复正常" {
+		t.Errorf("恢复后应读出已恢复，得到 %v", announced)
+	}
+}
+
+func TestSetHighContrastRerenders(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml", "b.puml")
+	ui := newTestUI(t, renderer, files...)
+	defer plantuml.SetHighContrast(false)
+
+	ui.SetHighContrast(true)
+	if !ui.settings.HighContrast || !plantuml.HighContrast() {
+		t.Fatal("应开启高对比度并保存到设置")
+	}
+	// 所有标签都在后台重新渲染
+	deadline := time.Now().Add(2 * time.Second)
+	for (renderer.Calls(files[0]) < 2 || renderer.Calls(files[1]) < 2) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, file := range files {
+		if renderer.Calls(file) != 2 {
+			t.Errorf("%s 应重新渲染一次，渲染了 %d 次", filepath.Base(file), renderer.Calls(file))
+		}
+	}
+}
+
+func TestSetFontRerenders(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml")
+	ui := newTestUI(t, renderer, files...)
+	defer plantuml.SetFont("", "")
+
+	ui.SetFont("PingFang SC", "UTF-8")
+	if name, encoding := plantuml.Font(); ui.settings.FontName != "PingFang SC" || ui.settings.JavaEncoding != "UTF-8" || name != "PingFang SC" || encoding != "UTF-8" {
+		t.Fatal("应设置图表字体并保存到设置")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for renderer.Calls(files[0]) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if renderer.Calls(files[0]) != 2 {
+		t.Errorf("应重新渲染一次，渲染了 %d 次", renderer.Calls(files[0]))
+	}
+}
+
+func TestSetColorBlindSafeRerenders(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml")
+	ui := newTestUI(t, renderer, files...)
+	defer plantuml.SetColorBlindSafe(false)
+
+	ui.SetColorBlindSafe(true)
+	if !ui.settings.ColorBlindSafe || !plantuml.ColorBlindSafe() {
+		t.Fatal("应开启色盲友好的颜色并保存到设置")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for renderer.Calls(files[0]) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if renderer.Calls(files[0]) != 2 {
+		t.Errorf("应重新渲染一次，渲染了 %d 次", renderer.Calls(files[0]))
+	}
+}
+
+func TestDescribeChange(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     string
+	}{
+		{"a\nb\nc", "a\nb\nc", "源码没有变化"},
+		{"a\nb\nc", "a\nB\nc", "修改了第2行"},
+		{"a\nb\nc", "a\nb\nx\ny\nc", "在第3行添加了2行"},
+		{"a\nb\nc\nd", "a\nd", "删除了原来的第2-3行"},
+		{"a\nb\nc\nd", "a\nX\nY\nd", "修改了第2-3行"},
+	}
+	for _, tt := range tests {
+		if got := describeChange(tt.old, tt.new); got != tt.want {
+			t.Errorf("describeChange(%q, %q) = %q，应为 %q", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
+
+func TestErrorHistory(t *testing.T) {
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml")
+	ui := newTestUI(t, renderer, files...)
+	if text := ui.errorHistoryText(ui.selectedTab()); text != "打开以来没有渲染错误" {
+		t.Errorf("没有出错时应说明没有错误，得到 %q", text)
+	}
+
+	// 修改第2行后开始出错，之后修改其他行仍然出错
+	write := func(source string) {
+		t.Helper()
+		if err := ioutil.WriteFile(files[0], []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	renderer.SetError(files[0], &plantuml.RenderError{Line: 2, Err: errors.New("syntax error")})
+	write("@startuml\nA -> \n@enduml\n")
+	ui.RefreshCurrentTab()
+	write("@startuml\nA -> \nB -> C\n@enduml\n")
+	ui.RefreshCurrentTab()
+
+	h := ui.errorHistories[files[0]]
+	if h == nil || len(h.records) != 2 {
+		t.Fatalf("应记录两次出错，得到 %+v", h)
+	}
+	text := ui.errorHistoryText(ui.selectedTab())
+	if !strings.HasPrefix(text, "从 ") || !strings.Contains(text, "（修改了第2行）起一直渲染出错") {
+		t.Errorf("应说明从哪次修改开始一直出错，得到 %q", text)
+	}
+	if !strings.Contains(text, "渲染出错，第2行") || !strings.Contains(text, "在第3行添加了1行") {
+		t.Errorf("应列出每次的错误和改动，得到 %q", text)
+	}
+
+	// 恢复后记录恢复正常，不再说明一直出错
+	renderer.SetError(files[0], nil)
+	write("@startuml\nA -> B\nB -> C\n@enduml\n")
+	ui.RefreshCurrentTab()
+	if len(h.records) != 3 || h.records[2].err != nil || h.records[2].change != "修改了第2行" {
+		t.Errorf("应记录恢复正常，得到 %+v", h.records)
+	}
+	if text := ui.errorHistoryText(ui.selectedTab()); strings.Contains(text, "一直渲染出错") {
+		t.Errorf("恢复后不应说明一直出错，得到 %q", text)
+	}
+
+	// 关闭标签后删除历史
+	ui.CloseCurrentTab()
+	if _, ok := ui.errorHistories[files[0]]; ok {
+		t.Error("关闭标签后应删除渲染错误历史")
+	}
+}
+
+func TestTransientRenderErrorIsRetried(t *testing.T) {
+	defer func(delay time.Duration) { plantuml.RetryDelay = delay }(plantuml.RetryDelay)
+	plantuml.RetryDelay = 50 * time.Millisecond
+	renderer := plantumltest.NewRenderer()
+	files := writeFiles(t, "a.puml")
+	events := event.NewBus()
+	var failed int
+	events.Subscribe(func(event.Event) { failed++ }, event.RenderFailed)
+
+	// 刚安装完Java还不在PATH中，第一次渲染失败，重试前恢复
+	renderer.SetError(files[0], &plantuml.RenderError{Err: &exec.Error{Name: "java", Err: exec.ErrNotFound}})
+	ui := newTestUIWithEvents(t, renderer, events, files...)
+	if ui.selectedTab().viewer.RenderError() != nil || failed != 0 {
+		t.Fatal("暂时性错误在重试期间不应显示为出错")
+	}
+	if _, pending := ui.Status(); pending != 1 {
+		t.Errorf("重试期间应显示为待更新，得到 %d", pending)
+	}
+	renderer.SetError(files[0], nil)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for renderer.Calls(files[0]) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if renderer.Calls(files[0]) != 2 {
+		t.Fatalf("应在后台重试一次，渲染了 %d 次", renderer.Calls(files[0]))
+	}
+	if failed != 0 {
+		t.Errorf("重试成功后不应发布渲染失败，发布了 %d 次", failed)
+	}
+}
@@ -0,0 +1,107 @@
+package ui
+
+import (
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+
+	"plantumlmacviewer/internal/undo"
+)
+
+// historyEntry 是草稿的编辑区。撤销和重做的快捷键交给草稿的撤销历史处理，
+// 而不是输入框自己的撤销栈：后者在SetText时清空，也不能在重新启动后保留
+type historyEntry struct {
+	widget.Entry
+	onUndo func()
+	onRedo func()
+}
+
+// newHistoryEntry 创建等宽字体的多行编辑区，与widget.NewMultiLineEntry相同，超出宽度的行不换行
+func newHistoryEntry() *historyEntry {
+	e := &historyEntry{}
+	e.MultiLine = true
+	e.Wrapping = fyne.TextWrap(fyne.TextTruncateClip)
+	e.TextStyle = fyne.TextStyle{Monospace: true}
+	e.ExtendBaseWidget(e)
+	return e
+}
+
+// TypedShortcut 处理撤销和重做，其他快捷键交给输入框
+func (e *historyEntry) TypedShortcut(shortcut fyne.Shortcut) {
+	switch shortcut.(type) {
+	case *fyne.ShortcutUndo:
+		if e.onUndo != nil {
+			e.onUndo()
+		}
+	case *fyne.ShortcutRedo:
+		if e.onRedo != nil {
+			e.onRedo()
+		}
+	default:
+		e.Entry.TypedShortcut(shortcut)
+	}
+}
+
+// historyPath 返回撤销历史所属的文件：保存过的草稿为保存的文件，否则为恢复目录中的草稿文件
+func (s *scratch) historyPath() string {
+	if s.savedPath != "" {
+		return s.savedPath
+	}
+	return s.draft
+}
+
+// loadHistory 读取草稿的撤销历史，把当前内容记为最新的版本
+func (ui *MainUI) loadHistory(s *scratch) {
+	s.history = undo.Load(ui.undoDir, s.historyPath())
+	if s.history.Record(s.entry.Text) {
+		saveHistory(s)
+	}
+}
+
+// recordHistory 把编辑区的内容记为新的版本并保存，内容没有变化时什么也不做
+func recordHistory(s *scratch) {
+	if s.history != nil && s.history.Record(s.entry.Text) {
+		saveHistory(s)
+	}
+}
+
+// saveHistory 把撤销历史写入数据目录，失败时只记录日志，不影响编辑
+func saveHistory(s *scratch) {
+	if err := s.history.Save(); err != nil {
+		log.Printf("警告：%v", err)
+	}
+}
+
+// UndoEdit 撤销当前草稿标签的上一次编辑，包括上次运行时所做的编辑
+func (ui *MainUI) UndoEdit() {
+	if t := ui.selectedTab(); t != nil && t.scratch != nil {
+		ui.stepHistory(t, t.scratch.history.Undo)
+	}
+}
+
+// RedoEdit 重做当前草稿标签撤销的编辑
+func (ui *MainUI) RedoEdit() {
+	if t := ui.selectedTab(); t != nil && t.scratch != nil {
+		ui.stepHistory(t, t.scratch.history.Redo)
+	}
+}
+
+// stepHistory 先记录还没有写入的编辑，再用step移动到历史中的另一个版本，把它显示在编辑区并立即重新渲染
+func (ui *MainUI) stepHistory(t *tab, step func() (string, bool)) {
+	s := t.scratch
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	recordHistory(s)
+	text, ok := step()
+	if !ok {
+		return
+	}
+	saveHistory(s)
+	s.entry.SetText(text)
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	ui.writeDraft(t)
+}
@@ -0,0 +1,63 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"fyne.io/fyne/v2/container"
+
+	"plantumlmacviewer/internal/event"
+	"plantumlmacviewer/internal/logging"
+	"plantumlmacviewer/plantuml"
+)
+
+// OpenVirtual 在虚拟文件标签中显示编辑器发来的内容。name是编辑器中的文件路径，
+// 同名的虚拟文件标签已经打开时只更新内容并重新渲染，不读取或监控文件系统。
+// 返回渲染错误，渲染失败时标签页仍会打开并显示错误信息
+func (ui *MainUI) OpenVirtual(name, text string, opts OpenOptions) error {
+	if t := ui.tabs.byVirtual(name); t != nil {
+		if !opts.NoSelect {
+			ui.Tabs.Select(t.item)
+		}
+		if opts.Page > 0 {
+			t.page = opts.Page
+			// 切换页时会立即重新渲染，之后更新内容再渲染一次
+			t.viewer.SetPage(opts.Page)
+		}
+		log.Printf("更新虚拟文件: %s", logging.Path(name))
+		err := t.viewer.SetSource([]byte(text))
+		ui.UpdateTitle()
+		ui.refreshOutline()
+		return err
+	}
+
+	viewer, err := plantuml.NewVirtualViewer(name, []byte(text), ui.renderer, ui.events)
+	if err != nil {
+		log.Printf("无法创建PlantUML查看器: %v", err)
+		return err
+	}
+	ui.wireViewer(viewer)
+	if opts.Page > 1 {
+		viewer.SetPage(opts.Page)
+	}
+
+	title := fmt.Sprintf("%s（未保存）", truncateFileName(filepath.Base(name), 30))
+	item := container.NewTabItem(title, nil)
+	t := ui.tabs.add(item, name, viewer)
+	t.title = title
+	t.page = opts.Page
+	t.virtual = true
+	item.Content = ui.tabContent(t)
+	ui.applyTabStyle(t)
+	ui.Tabs.Append(item)
+	ui.refreshGroups()
+	if !opts.NoSelect {
+		ui.Tabs.Select(item)
+	}
+	ui.UpdateTitle()
+
+	log.Printf("已打开虚拟文件标签: %s", logging.Path(name))
+	ui.events.Publish(event.Event{Type: event.FileOpened, Path: name})
+	return viewer.RenderError()
+}
@@ -0,0 +1,30 @@
+package ui
+
+import "plantumlmacviewer/plantuml"
+
+// ZoomIn 放大当前标签的图像，锁定视口时其他标签切换过去后沿用同样的缩放
+func (ui *MainUI) ZoomIn() {
+	ui.withSelectedViewer((*plantuml.Viewer).ZoomIn)
+}
+
+// ZoomOut 缩小当前标签的图像
+func (ui *MainUI) ZoomOut() {
+	ui.withSelectedViewer((*plantuml.Viewer).ZoomOut)
+}
+
+// ZoomToFit 把当前标签的图像恢复为适应窗口
+func (ui *MainUI) ZoomToFit() {
+	ui.withSelectedViewer((*plantuml.Viewer).ZoomToFit)
+}
+
+// ActualSize 按原始像素尺寸（100%）显示当前标签的图像
+func (ui *MainUI) ActualSize() {
+	ui.withSelectedViewer((*plantuml.Viewer).ActualSize)
+}
+
+// withSelectedViewer 对当前标签的查看器调用fn，没有标签时什么也不做
+func (ui *MainUI) withSelectedViewer(fn func(*plantuml.Viewer)) {
+	if viewer := ui.selectedViewer(); viewer != nil {
+		fn(viewer)
+	}
+}